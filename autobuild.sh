@@ -101,6 +101,76 @@ then
     fi
 fi
 
+if  [ "${build_objs}" == "all" ] ||
+    [ "${build_objs}" == "exportWARC" ] ||
+    [ "${build_objs}" == "ew" ] ||
+    [ "${build_objs}" == "" ];
+then
+    cmd_name="exportWARC"
+    CGO_ENABLED=0 go build ./cmd/${cmd_name}
+    rval=$?
+    if [ "${rval}" == "0" ]; then
+        echo "${cmd_name} command line tool built successfully!"
+        moveFile ${cmd_name} ./bin
+    else
+        echo "${cmd_name} command line tool build failed!"
+        exit $rval
+    fi
+fi
+
+if  [ "${build_objs}" == "all" ] ||
+    [ "${build_objs}" == "importWappalyzer" ] ||
+    [ "${build_objs}" == "iw" ] ||
+    [ "${build_objs}" == "" ];
+then
+    cmd_name="importWappalyzer"
+    CGO_ENABLED=0 go build ./cmd/${cmd_name}
+    rval=$?
+    if [ "${rval}" == "0" ]; then
+        echo "${cmd_name} command line tool built successfully!"
+        moveFile ${cmd_name} ./bin
+    else
+        echo "${cmd_name} command line tool build failed!"
+        exit $rval
+    fi
+fi
+
+if  [ "${build_objs}" == "all" ] ||
+    [ "${build_objs}" == "pluginTest" ] ||
+    [ "${build_objs}" == "pt" ] ||
+    [ "${build_objs}" == "" ];
+then
+    cmd_name="pluginTest"
+    # The fake DB of the plugins tests is SQLite, which needs cgo
+    CGO_ENABLED=1 go build ./cmd/${cmd_name}
+    rval=$?
+    if [ "${rval}" == "0" ]; then
+        echo "${cmd_name} command line tool built successfully!"
+        moveFile ${cmd_name} ./bin
+    else
+        echo "${cmd_name} command line tool build failed!"
+        exit $rval
+    fi
+fi
+
+if  [ "${build_objs}" == "all" ] ||
+    [ "${build_objs}" == "rulesetLint" ] ||
+    [ "${build_objs}" == "rl" ] ||
+    [ "${build_objs}" == "" ];
+then
+    cmd_name="rulesetLint"
+    # The rulesets tests use the fake WebDriver of pluginTest, which needs cgo
+    CGO_ENABLED=1 go build ./cmd/${cmd_name}
+    rval=$?
+    if [ "${rval}" == "0" ]; then
+        echo "${cmd_name} command line tool built successfully!"
+        moveFile ${cmd_name} ./bin
+    else
+        echo "${cmd_name} command line tool build failed!"
+        exit $rval
+    fi
+fi
+
 if  [ "${build_objs}" == "all" ] ||
     [ "${build_objs}" == "api" ] ||
     [ "${build_objs}" == "" ];
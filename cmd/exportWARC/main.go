@@ -0,0 +1,292 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (exportWARC) is a command line that allows to export the
+// data collected for a source in TheCROWler DB to a WARC file.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	crowler "github.com/pzaino/thecrowler/pkg/crawler"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	"github.com/pzaino/thecrowler/pkg/har"
+	"github.com/pzaino/thecrowler/pkg/warc"
+
+	_ "github.com/lib/pq"
+)
+
+var (
+	config cfg.Config
+)
+
+// exportStats represents the number of objects exported to the WARC file
+type exportStats struct {
+	Pages       int
+	XHR         int
+	Screenshots int
+}
+
+// getSourceID returns the ID and URL of a source, given its ID or its URL
+func getSourceID(db *sql.DB, sourceID int64, sourceURL string) (int64, string, error) {
+	var id int64
+	var url string
+	var err error
+	if sourceID > 0 {
+		err = db.QueryRow("SELECT source_id, url FROM Sources WHERE source_id = $1", sourceID).Scan(&id, &url)
+	} else {
+		err = db.QueryRow("SELECT source_id, url FROM Sources WHERE url = $1", sourceURL).Scan(&id, &url)
+	}
+	if err == sql.ErrNoRows {
+		return 0, "", errors.New("source not found")
+	}
+	return id, url, err
+}
+
+// exportPages writes the pages indexed for a source: the request/response
+// records of their main document (taken from their HAR, if collected), their
+// content as conversion records and the request/response records of the XHR
+// traffic collected on them
+func exportPages(db *sql.DB, w *warc.Writer, sourceID int64, stats *exportStats) error {
+	rows, err := db.Query(`
+		SELECT si.page_url, si.last_updated_at,
+		       COALESCE(wo.object_type, ''), COALESCE(wo.object_html, ''), COALESCE(wo.object_content, ''),
+		       COALESCE(wo.details->'scraped_data'->'xhr', '[]'::jsonb),
+		       COALESCE(ho.object_content, '')
+		FROM SourceSearchIndex ssi
+		JOIN SearchIndex si ON si.index_id = ssi.index_id
+		LEFT JOIN LATERAL (
+			SELECT o.object_type, o.object_html, o.object_content, o.details
+			FROM WebObjectsIndex woi
+			JOIN WebObjects o ON o.object_id = woi.object_id
+			WHERE woi.index_id = si.index_id
+			  AND o.object_type <> 'application/har+json'
+			ORDER BY woi.created_at DESC, o.object_id DESC
+			LIMIT 1
+		) wo ON true
+		LEFT JOIN LATERAL (
+			SELECT o.object_content
+			FROM WebObjectsIndex woi
+			JOIN WebObjects o ON o.object_id = woi.object_id
+			WHERE woi.index_id = si.index_id
+			  AND o.object_type = 'application/har+json'
+			ORDER BY woi.created_at DESC, o.object_id DESC
+			LIMIT 1
+		) ho ON true
+		WHERE ssi.source_id = $1
+		ORDER BY si.index_id`, sourceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error in a defer statement
+
+	for rows.Next() {
+		var pageURL, objectType, html, content, harJSON string
+		var updated time.Time
+		var xhrJSON []byte
+		if err := rows.Scan(&pageURL, &updated, &objectType, &html, &content, &xhrJSON, &harJSON); err != nil {
+			return err
+		}
+
+		body := html
+		if body == "" {
+			body = content
+			objectType = "text/plain; charset=utf-8"
+		}
+		if !strings.Contains(objectType, "/") {
+			objectType = "text/html; charset=utf-8"
+		}
+		page := pageDocument(pageURL, harJSON)
+		page.ContentType = objectType
+		page.Content = []byte(body)
+		if err := crowler.WriteWARCPage(w, page, updated); err != nil {
+			return err
+		}
+		stats.Pages++
+
+		var entries []map[string]interface{}
+		if err := json.Unmarshal(xhrJSON, &entries); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "invalid XHR data for %s: %v", pageURL, err)
+			continue
+		}
+		archived, err := crowler.WriteWARCXHR(w, entries, updated)
+		if err != nil {
+			return err
+		}
+		stats.XHR += archived
+	}
+	return rows.Err()
+}
+
+// pageDocument returns the request and response of the main document of a
+// page from its HAR (only the page URL if they weren't collected)
+func pageDocument(pageURL, harJSON string) *crowler.WARCPage {
+	if harJSON != "" {
+		var doc har.HAR
+		if err := json.Unmarshal([]byte(harJSON), &doc); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "invalid HAR for %s: %v", pageURL, err)
+		} else if page := crowler.HARDocument(&doc, pageURL); page != nil {
+			return page
+		}
+	}
+	return &crowler.WARCPage{URL: pageURL}
+}
+
+// exportScreenshots writes the screenshots taken for a source as resource records
+func exportScreenshots(db *sql.DB, w *warc.Writer, sourceID int64, stats *exportStats) error {
+	rows, err := db.Query(`
+		SELECT si.page_url, s.screenshot_link, s.format, s.created_at
+		FROM Screenshots s
+		JOIN SourceSearchIndex ssi ON ssi.index_id = s.index_id
+		JOIN SearchIndex si ON si.index_id = s.index_id
+		WHERE ssi.source_id = $1
+		ORDER BY s.screenshot_id`, sourceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error in a defer statement
+
+	for rows.Next() {
+		var pageURL, link, format string
+		var created time.Time
+		if err := rows.Scan(&pageURL, &link, &format, &created); err != nil {
+			return err
+		}
+		data, err := crowler.LoadFile(link, config.ImageStorageAPI)
+		if err != nil {
+			log.Printf("skipping screenshot %s: %v", link, err)
+			continue
+		}
+		if err := crowler.WriteWARCScreenshot(w, pageURL, format, data, created); err != nil {
+			return err
+		}
+		stats.Screenshots++
+	}
+	return rows.Err()
+}
+
+// exportOptions represents the command line options of exportWARC
+type exportOptions struct {
+	sourceID    int64
+	sourceURL   string
+	output      string
+	screenshots bool
+}
+
+func main() {
+	configFile := flag.String("config", "config.yaml", "Path to the configuration file")
+	sourceID := flag.Int64("source", 0, "ID of the source to export")
+	sourceURL := flag.String("url", "", "URL of the source to export (if the source ID is not provided)")
+	output := flag.String("output", "", "Path of the WARC file to write (default: save it using the configured file_storage_api)")
+	screenshots := flag.Bool("screenshots", true, "Include the screenshots in the WARC file")
+	flag.Parse()
+
+	// Read the configuration file
+	var err error
+	config, err = cfg.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Check if the source is provided
+	if *sourceID <= 0 && strings.TrimSpace(*sourceURL) == "" {
+		log.Fatal("Please provide the ID or the URL of the source to export.")
+	}
+
+	opts := exportOptions{
+		sourceID:    *sourceID,
+		sourceURL:   strings.TrimSpace(*sourceURL),
+		output:      *output,
+		screenshots: *screenshots,
+	}
+	if err := run(opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run exports the source selected by opts to a WARC file
+func run(opts exportOptions) error {
+	// Database connection setup
+	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		config.Database.Host, config.Database.Port,
+		config.Database.User, config.Database.Password, config.Database.DBName)
+	db, err := sql.Open(cdb.DBPostgresStr, psqlInfo)
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:errcheck // We can't check the error in a defer statement
+
+	id, url, err := getSourceID(db, opts.sourceID, opts.sourceURL)
+	if err != nil {
+		return err
+	}
+
+	// Write the WARC file locally first (to a temporary file if it has to be
+	// saved using the file storage API)
+	filename := crowler.WARCFilename(uint64(id), time.Now()) //nolint:gosec // source IDs are positive
+	var file *os.File
+	if opts.output != "" {
+		file, err = os.Create(opts.output) //nolint:gosec // the output path is provided by the user
+	} else {
+		file, err = os.CreateTemp("", "crowler-*.warc.gz")
+	}
+	if err != nil {
+		return err
+	}
+	if opts.output == "" {
+		defer os.Remove(file.Name()) //nolint:errcheck // We can't check the error in a defer statement
+	}
+
+	w := warc.NewWriter(file, true)
+	stats := exportStats{}
+	err = crowler.WriteWARCInfo(w, filename, url)
+	if err == nil {
+		err = exportPages(db, w, id, &stats)
+	}
+	if err == nil && opts.screenshots {
+		err = exportScreenshots(db, w, id, &stats)
+	}
+	if err2 := file.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	location := opts.output
+	if location == "" {
+		archive, err := os.Open(file.Name())
+		if err != nil {
+			return err
+		}
+		location, err = crowler.SaveFileFrom(crowler.WARCDir+"/"+filename, archive, config.FileStorageAPI)
+		_ = archive.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Exported %d pages, %d XHR requests and %d screenshots of source %d to %s\n", stats.Pages, stats.XHR, stats.Screenshots, id, location)
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (importWappalyzer) is a command line that converts
+// Wappalyzer-format technology fingerprints (JSON files) into a CROWler
+// detection ruleset, plus the detection plugins for the "js" fingerprints.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+)
+
+func main() {
+	name := flag.String("name", "Wappalyzer", "Name of the generated ruleset")
+	output := flag.String("output", "", "Path of the generated ruleset (YAML), the standard output if empty")
+	pluginsDir := flag.String("plugins", "./plugins", "Directory where the generated detection plugins are written")
+	jsGlobals := flag.Bool("js-globals", false, "Convert the \"js\" fingerprints into js_globals signatures instead of detection plugins")
+	schemaPath := flag.String("schema", "./schemas/ruleset-schema.json", "Path of the ruleset JSON Schema")
+	quiet := flag.Bool("q", false, "Don't print the fingerprints that couldn't be imported")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] technologies.json [technologies.json ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Files can be given as glob patterns (for example "technologies/*.json")
+	var files [][]byte
+	for _, arg := range flag.Args() {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			log.Fatalf("Invalid file path '%s': %v", arg, err)
+		}
+		if len(matches) == 0 {
+			matches = []string{arg}
+		}
+		for _, path := range matches {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				log.Fatalf("Error reading '%s': %v", path, err)
+			}
+			files = append(files, data)
+		}
+	}
+
+	imp, err := rules.ImportWappalyzer(*name, rules.WappalyzerOptions{JSGlobals: *jsGlobals}, files...)
+	if err != nil {
+		log.Fatalf("Error importing the fingerprints: %v", err)
+	}
+	if !*quiet {
+		for _, warning := range imp.Warnings {
+			fmt.Fprintf(os.Stderr, "WARN  %s\n", warning)
+		}
+	}
+
+	schema, err := rules.LoadSchema(*schemaPath)
+	if err != nil {
+		log.Fatalf("Error loading the ruleset schema: %v", err)
+	}
+	data, err := imp.Marshal(schema)
+	if err != nil {
+		log.Fatalf("Error generating the ruleset: %v", err)
+	}
+	if *output == "" {
+		fmt.Print(string(data))
+	} else if err := os.WriteFile(*output, data, 0644); err != nil {
+		log.Fatalf("Error writing '%s': %v", *output, err)
+	}
+
+	if len(imp.Plugins) > 0 {
+		if err := os.MkdirAll(*pluginsDir, 0755); err != nil {
+			log.Fatalf("Error creating '%s': %v", *pluginsDir, err)
+		}
+		for _, plugin := range imp.Plugins {
+			path := filepath.Join(*pluginsDir, plugin.Name+".js")
+			if err := os.WriteFile(path, []byte(plugin.Script), 0644); err != nil {
+				log.Fatalf("Error writing '%s': %v", path, err)
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d detection rule(s) and %d plugin(s), %d warning(s)\n",
+		len(imp.Ruleset.RuleGroups[0].DetectionRules), len(imp.Plugins), len(imp.Warnings))
+}
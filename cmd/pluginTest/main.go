@@ -0,0 +1,103 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (pluginTest) is a command line that allows to run the test
+// suites (YAML files) of the CROWler JS plugins, with a fake WebDriver and a
+// fake DB, so the plugins can be tested without Selenium and PostgreSQL.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	"github.com/pzaino/thecrowler/pkg/plugin/plugintest"
+)
+
+// runSuite runs a suite file and prints its results, it returns the number
+// of failed test cases
+func runSuite(path string, verbose bool) int {
+	suite, err := plugintest.LoadSuite(path)
+	if err != nil {
+		fmt.Printf("FAIL  %s: %v\n", path, err)
+		return 1
+	}
+	results, err := suite.Run()
+	if err != nil {
+		fmt.Printf("FAIL  %s: %v\n", path, err)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("%s  %s: %s (%v)\n", status, path, result.Name, result.Duration.Round(time.Microsecond))
+		for _, failure := range result.Failures {
+			fmt.Printf("      %s\n", failure)
+		}
+		if verbose {
+			output, _ := json.Marshal(result.Result)
+			fmt.Printf("      result: %s\n", output)
+		}
+	}
+	return failed
+}
+
+func main() {
+	verbose := flag.Bool("v", false, "Print the result of every test case")
+	debugLevel := flag.Int("debug", 0, "Debug level of the plugins execution (-2 errors, -1 warnings, 0 info, 1-5 debug)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] suite.yaml [suite.yaml ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmn.SetDebugLevel(cmn.DbgLevel(*debugLevel))
+
+	// Suites can be given as glob patterns (for example "tests/*_test.yaml")
+	var suites []string
+	for _, arg := range flag.Args() {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			log.Fatalf("Invalid suite path '%s': %v", arg, err)
+		}
+		if len(matches) == 0 {
+			matches = []string{arg}
+		}
+		suites = append(suites, matches...)
+	}
+
+	failed := 0
+	for _, suite := range suites {
+		failed += runSuite(suite, *verbose)
+	}
+	if failed > 0 {
+		fmt.Printf("%d test case(s) failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("All the test cases passed")
+}
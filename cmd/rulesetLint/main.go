@@ -0,0 +1,176 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (rulesetLint) is a command line that checks the CROWler
+// rulesets offline: it validates them against the ruleset schema, compiles
+// their regular expressions, XPaths and CSS selectors, checks the plugins
+// they use and reports the unreachable and duplicate rules. Then it runs
+// the tests embedded in the rulesets against their HTML fixtures.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	"github.com/pzaino/thecrowler/pkg/ruleset/rulesettest"
+	"github.com/qri-io/jsonschema"
+)
+
+// expand returns the files matching the paths (which can be glob patterns)
+func expand(paths []string) []string {
+	var files []string
+	for _, path := range paths {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			log.Fatalf("Invalid path '%s': %v", path, err)
+		}
+		if len(matches) == 0 {
+			matches = []string{path}
+		}
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// loadPlugins loads the JS plugins in the given directories (or files)
+func loadPlugins(paths []string) []*plg.JSPlugin {
+	var plugins []*plg.JSPlugin
+	for _, path := range expand(paths) {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Fatalf("Error loading the plugins: %v", err)
+		}
+		if info.IsDir() {
+			path = filepath.Join(path, "*.js")
+		}
+		files, _ := filepath.Glob(path)
+		for _, file := range files {
+			loaded, err := plg.LoadPluginFromLocal(file)
+			if err != nil {
+				log.Fatalf("Error loading the plugin '%s': %v", file, err)
+			}
+			plugins = append(plugins, loaded...)
+		}
+	}
+	return plugins
+}
+
+// checkRuleset lints a ruleset file and runs its tests, it returns the
+// number of errors and failed tests
+func checkRuleset(path string, schema *jsonschema.Schema, register *plg.JSPluginRegister, plugins []*plg.JSPlugin, runTests, verbose bool) int {
+	data, err := os.ReadFile(path) //nolint:gosec // The path is provided by the user running the linter
+	if err != nil {
+		fmt.Printf("FAIL  %s: %v\n", path, err)
+		return 1
+	}
+	fileType := strings.ToLower(cmn.GetFileExt(path))
+	if fileType == "yml" {
+		fileType = "yaml"
+	}
+
+	ruleset, issues := rules.LintRuleset(schema, data, fileType, register)
+	failed := 0
+	for _, issue := range issues {
+		if issue.Severity == rules.LintError {
+			failed++
+		}
+		fmt.Printf("%s: %s\n", path, issue)
+	}
+	if !runTests || len(ruleset.Tests) == 0 {
+		return failed
+	}
+
+	for _, result := range rulesettest.RunTests(&ruleset, filepath.Dir(path), plugins) {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("%s  %s: %s\n", status, path, result.Name)
+		for _, failure := range result.Failures {
+			fmt.Printf("      %s\n", failure)
+		}
+		if verbose {
+			scraped, _ := json.Marshal(result.Scraped)
+			fmt.Printf("      scraped: %s\n", scraped)
+			detected := make([]string, 0, len(result.Detected))
+			for name, entity := range result.Detected {
+				if entity.Version != "" {
+					name += " " + entity.Version
+				}
+				detected = append(detected, name)
+			}
+			sort.Strings(detected)
+			fmt.Printf("      detected: [%s]\n", strings.Join(detected, ", "))
+		}
+	}
+	return failed
+}
+
+func main() {
+	schemaPath := flag.String("schema", "./schemas/ruleset-schema.json", "Path of the ruleset JSON Schema (empty to skip the schema validation)")
+	pluginsPaths := flag.String("plugins", "", "Comma separated directories (or files) of the JS plugins used by the rulesets (empty to skip the plugins check)")
+	runTests := flag.Bool("tests", true, "Run the tests embedded in the rulesets")
+	verbose := flag.Bool("v", false, "Print the scraped data and the detected entities of every test")
+	debugLevel := flag.Int("debug", -2, "Debug level of the rules execution (-2 errors, -1 warnings, 0 info, 1-5 debug)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] ruleset.yaml [ruleset.yaml ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmn.SetDebugLevel(cmn.DbgLevel(*debugLevel))
+
+	var schema *jsonschema.Schema
+	if *schemaPath != "" {
+		var err error
+		schema, err = rules.LoadSchema(*schemaPath)
+		if err != nil {
+			log.Fatalf("Error loading the ruleset schema: %v", err)
+		}
+	}
+
+	var register *plg.JSPluginRegister
+	var plugins []*plg.JSPlugin
+	if *pluginsPaths != "" {
+		plugins = loadPlugins(strings.Split(*pluginsPaths, ","))
+		register = plg.NewJSPluginRegister()
+		for _, plugin := range plugins {
+			register.Register(plugin.Name, *plugin)
+		}
+	}
+
+	failed := 0
+	for _, path := range expand(flag.Args()) {
+		failed += checkRuleset(path, schema, register, plugins, *runTests, *verbose)
+	}
+	if failed > 0 {
+		fmt.Printf("%d error(s) and failed test(s)\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("All the rulesets are valid")
+}
@@ -43,6 +43,7 @@ import (
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 	crowler "github.com/pzaino/thecrowler/pkg/crawler"
 	cdb "github.com/pzaino/thecrowler/pkg/database"
+	reload "github.com/pzaino/thecrowler/pkg/reload"
 	rules "github.com/pzaino/thecrowler/pkg/ruleset"
 	vdi "github.com/pzaino/thecrowler/pkg/vdi"
 	"golang.org/x/time/rate"
@@ -61,6 +62,8 @@ var (
 	configMutex sync.RWMutex  // Mutex to protect the configuration
 	// GRulesEngine Global rules engine
 	GRulesEngine rules.RuleEngine // GRulesEngine Global rules engine
+	// reloadWatcher reloads the rulesets and the plugins (hot reload)
+	reloadWatcher *reload.Watcher
 
 	// Prometheus metrics
 	totalPages = prometheus.NewGaugeVec(
@@ -408,6 +411,10 @@ func crawlSources(wb *WorkBlock) {
 					TotalLinks:      0,
 					TotalSkipped:    0,
 					TotalDuplicates: 0,
+					TotalRobotsDeny: 0,
+					TotalUnchanged:  0,
+					TotalNotMod:     0,
+					QueueSize:       0,
 					TotalScraped:    0,
 					TotalActions:    0,
 					LastWait:        0,
@@ -552,7 +559,7 @@ func logStatus(PipelineStatus *[]crowler.Status) {
 		} else {
 			totalRunningTime = status.EndTime.Sub(status.StartTime)
 		}
-		totalLinksToGo := status.TotalLinks - (status.TotalPages + status.TotalSkipped + status.TotalDuplicates)
+		totalLinksToGo := status.TotalLinks - (status.TotalPages + status.TotalSkipped + status.TotalDuplicates + status.TotalUnchanged)
 		if totalLinksToGo < 0 {
 			totalLinksToGo = 0
 		}
@@ -581,7 +588,11 @@ func logStatus(PipelineStatus *[]crowler.Status) {
 		report += fmt.Sprintf("  Total Collected Links: %d\n", status.TotalLinks)
 		report += fmt.Sprintf("    Total Skipped Links: %d\n", status.TotalSkipped)
 		report += fmt.Sprintf(" Total Duplicated Links: %d\n", status.TotalDuplicates)
+		report += fmt.Sprintf("Total Robots.txt Denied: %d\n", status.TotalRobotsDeny)
+		report += fmt.Sprintf("  Total Unchanged Pages: %d\n", status.TotalUnchanged)
+		report += fmt.Sprintf("     Total Not Modified: %d\n", status.TotalNotMod)
 		report += fmt.Sprintf("Total Links to complete: %d\n", totalLinksToGo)
+		report += fmt.Sprintf("         Links in Queue: %d\n", status.QueueSize)
 		report += fmt.Sprintf("          Total Scrapes: %d\n", status.TotalScraped)
 		report += fmt.Sprintf("          Total Actions: %d\n", status.TotalActions)
 		report += fmt.Sprintf("         Last Page Wait: %f\n", status.LastWait)
@@ -669,6 +680,9 @@ func initAll(configFile *string, config *cfg.Config,
 	RulesEngine *rules.RuleEngine, lmt **rate.Limiter) error {
 	var err error
 
+	// Stop the hot reload (the rules engine is going to be replaced)
+	reloadWatcher.Stop()
+
 	// Reload the configuration file
 	*config, err = cfg.LoadConfig(*configFile)
 	if err != nil {
@@ -820,6 +834,7 @@ func main() {
 					cmn.DebugMsg(cmn.DbgLvlFatal, "connecting to the database: %v", err)
 				}
 				cmn.DebugMsg(cmn.DbgLvlInfo, "Database connection re-established.")
+				startReloadWatcher(&db, &config, &GRulesEngine)
 				configMutex.Unlock()
 				cmn.DebugMsg(cmn.DbgLvlInfo, "Configuration reloaded.")
 				//go checkSources(&db, vdiInstances)
@@ -845,6 +860,9 @@ func main() {
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Database connection established.")
 	defer closeResources(db, &vdiInstances)
 
+	// Start the hot reload of the rulesets and the plugins
+	startReloadWatcher(&db, &config, &GRulesEngine)
+
 	// Start events listener
 	go cdb.ListenForEvents(&db, handleNotification)
 
@@ -1092,3 +1110,16 @@ func closeResources(db cdb.Handler, sel *vdi.Pool) {
 	*/
 	cmn.DebugMsg(cmn.DbgLvlInfo, "All services stopped.")
 }
+
+// startReloadWatcher starts the hot reload of the rulesets and the plugins,
+// following the refresh intervals of their locations
+func startReloadWatcher(db *cdb.Handler, config *cfg.Config, re *rules.RuleEngine) {
+	reloadWatcher.Stop()
+	reloadWatcher = reload.NewWatcher(db).
+		WatchRulesets(re, config.Rulesets).
+		WatchPlugins(&re.JSPlugins, config.Plugins.Plugins, "")
+	if reloadWatcher.IsWatching() {
+		cmn.DebugMsg(cmn.DbgLvlInfo, "Hot reload of rulesets and plugins enabled")
+	}
+	reloadWatcher.Start()
+}
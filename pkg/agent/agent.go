@@ -16,6 +16,7 @@
 package agent
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"maps"
@@ -58,6 +59,9 @@ const (
 	StrRequest = "input"
 	// StrEvent is the string representation of the event field
 	StrEvent = "event"
+	// StrReadOnly is the string representation of the read_only field (in the
+	// config section it's set by the engine for the read-only agents)
+	StrReadOnly = "read_only"
 
 	// jsonAppType is the application type for JSON
 	jsonAppType = "application/json"
@@ -99,6 +103,8 @@ func RegisterActions(engine *JobEngine) {
 	engine.RegisterAction(&DBQueryAction{})
 	engine.RegisterAction(&PluginAction{})
 	engine.RegisterAction(&DecisionAction{})
+	engine.RegisterAction(&ForEachAction{engine: engine})
+	engine.RegisterAction(&ParallelAction{engine: engine})
 }
 
 // NewJobEngine creates a new job engine
@@ -349,6 +355,13 @@ type Action interface {
 	Execute(params map[string]interface{}) (map[string]interface{}, error)
 }
 
+// ContextAction is implemented by the actions that can be canceled (for ex.
+// when a step times out)
+type ContextAction interface {
+	Action
+	ExecuteContext(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error)
+}
+
 // APIRequestAction performs an HTTP API request
 type APIRequestAction struct{}
 
@@ -359,6 +372,11 @@ func (a *APIRequestAction) Name() string {
 
 // Execute performs the API request
 func (a *APIRequestAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	return a.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext performs the API request, the request is canceled when ctx is done
+func (a *APIRequestAction) ExecuteContext(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	rval := make(map[string]interface{})
 	rval[StrResponse] = nil
 	rval[StrConfig] = nil
@@ -459,7 +477,7 @@ func (a *APIRequestAction) Execute(params map[string]interface{}) (map[string]in
 	}
 	request["headers"] = string(cmn.ConvertMapToJSON(requestHeaders))
 
-	response, err := cmn.GenericAPIRequest(request)
+	response, err := cmn.GenericAPIRequestWithContext(ctx, request)
 	if err != nil {
 		rval[StrStatus] = StatusError
 		rval[StrMessage] = fmt.Sprintf("API request failed: %v", err)
@@ -590,7 +608,7 @@ func (r *RunCommandAction) Name() string {
 	return "RunCommand"
 }
 
-func executeIsolatedCommand(command string, args []string, chrootDir string, uid, gid int) (string, error) {
+func executeIsolatedCommand(ctx context.Context, command string, args []string, chrootDir string, uid, gid int) (string, error) {
 	// Prepare attributes for syscall.ForkExec
 	attr := &syscall.ProcAttr{
 		Env:   []string{"PATH=/usr/bin:/bin"},
@@ -632,12 +650,26 @@ func executeIsolatedCommand(command string, args []string, chrootDir string, uid
 		return "", fmt.Errorf("failed to execute command: %w", err)
 	}
 
+	// Kill the process if ctx is done before it finishes
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		case <-exited:
+		}
+	}()
+
 	// Wait for the process to finish
 	var ws syscall.WaitStatus
 	_, err = syscall.Wait4(pid, &ws, 0, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to wait for process: %w", err)
 	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("command killed: %w", ctx.Err())
+	}
 
 	// Check exit status
 	if ws.ExitStatus() != 0 {
@@ -649,6 +681,11 @@ func executeIsolatedCommand(command string, args []string, chrootDir string, uid
 
 // Execute runs a command in ch-rooted and/or with dropped privileges
 func (r *RunCommandAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	return r.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext runs a command like Execute, the command is killed when ctx is done
+func (r *RunCommandAction) ExecuteContext(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	rval := make(map[string]interface{})
 	rval[StrResponse] = nil
 	rval[StrConfig] = nil
@@ -755,7 +792,7 @@ func (r *RunCommandAction) Execute(params map[string]interface{}) (map[string]in
 	cmn.DebugMsg(cmn.DbgLvlDebug2, "Executing command: %s %v", args[0], argsList)
 
 	// Execute the command in isolation
-	output, err := executeIsolatedCommand(args[0], argsList, chrootDir, uid, gid)
+	output, err := executeIsolatedCommand(ctx, args[0], argsList, chrootDir, uid, gid)
 	if err != nil {
 		rval[StrStatus] = StatusError
 		rval[StrMessage] = fmt.Sprintf("command execution failed: %v", err)
@@ -779,6 +816,11 @@ func (a *AIInteractionAction) Name() string {
 
 // Execute sends a request to an AI API
 func (a *AIInteractionAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	return a.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext sends a request to an AI API, the request is canceled when ctx is done
+func (a *AIInteractionAction) ExecuteContext(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	rval := make(map[string]interface{})
 	rval[StrResponse] = nil
 	rval[StrConfig] = nil
@@ -1061,7 +1103,7 @@ func (a *AIInteractionAction) Execute(params map[string]interface{}) (map[string
 	}
 	request["headers"] = string(cmn.ConvertMapToJSON(requestHeaders))
 
-	response, err := cmn.GenericAPIRequest(request)
+	response, err := cmn.GenericAPIRequestWithContext(ctx, request)
 	if err != nil {
 		rval[StrStatus] = StatusError
 		rval[StrMessage] = fmt.Sprintf("AI interaction failed: %v", err)
@@ -1122,36 +1164,82 @@ func (d *DBQueryAction) Execute(params map[string]interface{}) (map[string]inter
 	}
 
 	// Check if there is a params field called query
-	if params["query"] == nil {
+	query, _ := params["query"].(string)
+	if strings.TrimSpace(query) == "" {
 		rval[StrStatus] = StatusError
 		rval[StrMessage] = "missing 'query' parameter"
 		return rval, fmt.Errorf("missing 'query' parameter")
 	}
-	query, _ := params["query"].(string)
-	// Check if query needs to be resolved
-	query = resolveResponseString(inputRaw, query)
 
-	// Execute the query based on type
-	var result interface{}
-	result, err = dbHandler.ExecuteQuery(query)
+	// Bind the query arguments (positional or named), resolved from the input
+	var args []interface{}
+	switch queryArgs := params["args"].(type) {
+	case nil:
+		// Legacy queries: $response tokens are resolved in the query text
+		resolved := resolveResponseString(inputRaw, query)
+		if resolved != query {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "DBQuery: resolving $response tokens in the query text is deprecated, use 'args' instead")
+		}
+		query = resolved
+	case []interface{}:
+		for _, arg := range queryArgs {
+			args = append(args, resolveQueryArg(inputRaw, arg))
+		}
+	case map[string]interface{}:
+		named := make(map[string]interface{}, len(queryArgs))
+		for k, arg := range queryArgs {
+			named[k] = resolveQueryArg(inputRaw, arg)
+		}
+		query, args, err = cdb.BindNamedParams(dbHandler.DBMS(), query, named)
+		if err != nil {
+			rval[StrStatus] = StatusError
+			rval[StrMessage] = err.Error()
+			return rval, err
+		}
+	default:
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = "'args' must be a list or an object"
+		return rval, fmt.Errorf("'args' must be a list or an object")
+	}
+
+	// A step can make itself read-only, but not a read-only agent writable
+	readOnly := isReadOnly(config) || isReadOnly(params)
+
+	// Execute the query
+	result, err := cdb.RunQuery(&dbHandler, query, args, readOnly)
 	if err != nil {
 		rval[StrStatus] = StatusError
 		rval[StrMessage] = fmt.Sprintf("database operation failed: %v", err)
 		return rval, fmt.Errorf("database operation failed: %v", err)
 	}
 
-	// Transform the result into a JSON document where the headers are they keys
-	// and the values are the values
-	resultMap := cmn.ConvertMapToJSON(cmn.ConvertInfToMap(result)) // This converts result into a map[string]interface{} and then into a JSON document
-
 	// Return the result
-	rval[StrResponse] = resultMap
+	rval[StrResponse] = result.ToMap()
 	rval[StrStatus] = StatusSuccess
 	rval[StrMessage] = "database operation successful"
 
 	return rval, nil
 }
 
+// resolveQueryArg resolves a DBQuery argument. An argument that is a single
+// $response token keeps the type of the referenced value.
+func resolveQueryArg(doc map[string]interface{}, arg interface{}) interface{} {
+	str, ok := arg.(string)
+	if !ok {
+		return arg
+	}
+	if token := strings.TrimSpace(str); responseTokenPattern1.FindString(token) == token && token != "" {
+		return resolveResponseToken(doc, token)
+	}
+	return resolveResponseString(doc, str)
+}
+
+// isReadOnly returns true if the read_only flag is set in the given section
+func isReadOnly(section map[string]interface{}) bool {
+	readOnly, _ := section[StrReadOnly].(bool)
+	return readOnly
+}
+
 // PluginAction executes plugins
 type PluginAction struct{}
 
@@ -1213,6 +1301,10 @@ func (p *PluginAction) Execute(params map[string]interface{}) (map[string]interf
 		rval[StrMessage] = fmt.Sprintf("plugin '%s' not found", plgName)
 		return rval, fmt.Errorf("plugin '%s' not found", plgName)
 	}
+	// Plugins executed by read-only agents (or steps) are read-only too
+	if isReadOnly(config) || isReadOnly(params) {
+		plg.ReadOnly = true
+	}
 
 	// Prepare the plugin parameters
 	dbHandler, ok := config["db_handler"].(cdb.Handler)
@@ -1252,7 +1344,8 @@ func (p *PluginAction) Execute(params map[string]interface{}) (map[string]interf
 			k != "meta_data" &&
 			k != "config" &&
 			k != "vdi_hook" &&
-			k != "db_handler" {
+			k != "db_handler" &&
+			k != StrReadOnly {
 			// Check if the value needs to be resolved
 			// To do that, first check which type of value it is
 			// If it's a string, resolve it
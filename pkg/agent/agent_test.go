@@ -345,3 +345,98 @@ func TestDecisionAction_Execute(t *testing.T) {
 func contains(str, substr string) bool {
 	return strings.Contains(str, substr)
 }
+
+func TestDBQueryAction_Execute(t *testing.T) {
+	db := newTestDBHandler(t)
+	if _, err := db.Exec(`INSERT INTO Sources (url, status) VALUES ('https://example.com', 'new'), ('https://example.org', 'completed')`); err != nil {
+		t.Fatalf("failed to insert the test sources: %v", err)
+	}
+	action := &DBQueryAction{}
+	input := map[string]interface{}{"status": "new", "min_id": int64(0)}
+
+	tests := []struct {
+		name     string
+		params   map[string]interface{}
+		wantRows int
+		wantErr  string
+	}{
+		{
+			name: "NamedArgs",
+			params: map[string]interface{}{
+				"query": "SELECT source_id, url FROM Sources WHERE status = :status AND source_id > :min_id",
+				"args":  map[string]interface{}{"status": "$response.input.status", "min_id": "$response.input.min_id"},
+			},
+			wantRows: 1,
+		},
+		{
+			name: "PositionalArgs",
+			params: map[string]interface{}{
+				"query": "SELECT source_id, url FROM Sources WHERE source_id > $1",
+				"args":  []interface{}{"$response.input.min_id"},
+			},
+			wantRows: 2,
+		},
+		{
+			name: "InjectionIsBound",
+			params: map[string]interface{}{
+				"query": "SELECT source_id FROM Sources WHERE status = :status",
+				"args":  map[string]interface{}{"status": "new' OR '1'='1"},
+			},
+			wantRows: 0,
+		},
+		{
+			name: "ReadOnlyStep",
+			params: map[string]interface{}{
+				"query":     "DELETE FROM Sources WHERE status = :status",
+				"args":      map[string]interface{}{"status": "$response.input.status"},
+				"read_only": true,
+			},
+			wantErr: "read-only",
+		},
+		{
+			name: "ReadOnlyAgent",
+			params: map[string]interface{}{
+				"query":  "UPDATE Sources SET status = 'x'",
+				"config": map[string]interface{}{"db_handler": db, StrReadOnly: true},
+			},
+			wantErr: "read-only",
+		},
+		{
+			name: "MissingArg",
+			params: map[string]interface{}{
+				"query": "SELECT source_id FROM Sources WHERE status = :status",
+				"args":  map[string]interface{}{},
+			},
+			wantErr: "missing value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.params[StrConfig]; !ok {
+				tt.params[StrConfig] = map[string]interface{}{"db_handler": db}
+			}
+			tt.params[StrRequest] = input
+
+			result, err := action.Execute(tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() returned an error: %v", err)
+			}
+			response, _ := result[StrResponse].(map[string]interface{})
+			if response["row_count"] != tt.wantRows {
+				t.Errorf("Execute() returned %v rows, want %d", response["row_count"], tt.wantRows)
+			}
+			if rows, _ := response["rows"].([]interface{}); len(rows) > 0 {
+				if _, ok := rows[0].(map[string]interface{})["source_id"].(int64); !ok {
+					t.Errorf("expected typed rows, got %#v", rows[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package agent provides the agent functionality for the CROWler.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// StrSteps is the string representation of the steps field (ForEach sub-pipeline)
+	StrSteps = "steps"
+	// StrBranches is the string representation of the branches field (Parallel sub-pipelines)
+	StrBranches = "branches"
+)
+
+// ForEachAction runs a sub-pipeline (steps) for every element of an array
+// (by default the step input), with a concurrency limit
+type ForEachAction struct {
+	engine *JobEngine
+}
+
+// Name returns the name of the action
+func (a *ForEachAction) Name() string {
+	return "ForEach"
+}
+
+// Execute runs the sub-pipeline for every element of the array
+func (a *ForEachAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	return a.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext runs the sub-pipeline for every element of the array. When
+// ctx is canceled no more elements are processed.
+func (a *ForEachAction) ExecuteContext(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	rval := make(map[string]interface{})
+	rval[StrResponse] = nil
+	rval[StrConfig] = nil
+
+	config, err := getConfig(params)
+	if err != nil {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = err.Error()
+		return rval, err
+	}
+	rval[StrConfig] = config
+
+	steps, err := toSteps(params[StrSteps])
+	if err != nil || len(steps) == 0 {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = "missing 'steps' parameter"
+		return rval, fmt.Errorf("missing 'steps' parameter")
+	}
+
+	// The elements are the step input, or the value referenced by items
+	var items interface{} = params[StrRequest]
+	if ref, ok := params["items"].(string); ok {
+		inputRaw, _ := getInput(params)
+		items = resolveResponseToken(inputRaw, ref)
+	}
+	list, ok := toList(items)
+	if !ok {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = fmt.Sprintf("ForEach items must be an array, got %T", items)
+		return rval, fmt.Errorf("ForEach items must be an array, got %T", items)
+	}
+
+	concurrency, err := getConcurrency(params, 1)
+	if err != nil {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = err.Error()
+		return rval, err
+	}
+
+	results := make([]interface{}, len(list))
+	tasks := make([]func() error, len(list))
+	for i, item := range list {
+		tasks[i] = func() error {
+			result, err := a.engine.runPipeline(ctx, steps, item, config)
+			if err != nil {
+				return fmt.Errorf("element %d: %v", i, err)
+			}
+			results[i] = result
+			return nil
+		}
+	}
+	if err := runConcurrently(ctx, tasks, concurrency); err != nil {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = fmt.Sprintf("ForEach failed: %v", err)
+		return rval, fmt.Errorf("ForEach failed: %v", err)
+	}
+
+	rval[StrResponse] = results
+	rval[StrStatus] = StatusSuccess
+	rval[StrMessage] = fmt.Sprintf("processed %d elements", len(list))
+	return rval, nil
+}
+
+// ParallelAction runs named sub-pipelines (branches) concurrently and
+// merges their responses under the branch names
+type ParallelAction struct {
+	engine *JobEngine
+}
+
+// Name returns the name of the action
+func (a *ParallelAction) Name() string {
+	return "Parallel"
+}
+
+// Execute runs the branches concurrently
+func (a *ParallelAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	return a.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext runs the branches concurrently. When ctx is canceled no
+// more branches are started.
+func (a *ParallelAction) ExecuteContext(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	rval := make(map[string]interface{})
+	rval[StrResponse] = nil
+	rval[StrConfig] = nil
+
+	config, err := getConfig(params)
+	if err != nil {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = err.Error()
+		return rval, err
+	}
+	rval[StrConfig] = config
+
+	branches, err := toBranches(params[StrBranches])
+	if err != nil {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = err.Error()
+		return rval, err
+	}
+
+	concurrency, err := getConcurrency(params, len(branches))
+	if err != nil {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = err.Error()
+		return rval, err
+	}
+
+	// Sort the branches, so they are started in a predictable order
+	names := make([]string, 0, len(branches))
+	for name := range branches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lock sync.Mutex
+	results := make(map[string]interface{}, len(branches))
+	tasks := make([]func() error, len(names))
+	for i, name := range names {
+		tasks[i] = func() error {
+			result, err := a.engine.runPipeline(ctx, branches[name], params[StrRequest], config)
+			if err != nil {
+				return fmt.Errorf("branch '%s': %v", name, err)
+			}
+			lock.Lock()
+			results[name] = result
+			lock.Unlock()
+			return nil
+		}
+	}
+	if err := runConcurrently(ctx, tasks, concurrency); err != nil {
+		rval[StrStatus] = StatusError
+		rval[StrMessage] = fmt.Sprintf("Parallel failed: %v", err)
+		return rval, fmt.Errorf("Parallel failed: %v", err)
+	}
+
+	rval[StrResponse] = results
+	rval[StrStatus] = StatusSuccess
+	rval[StrMessage] = fmt.Sprintf("executed %d branches", len(branches))
+	return rval, nil
+}
+
+// runPipeline runs a copy of the given steps, with input as the input of
+// the first step and (a copy of) config as its config. It returns the
+// output of the last step. The steps are recorded in the run of the
+// calling step (if any) and stop when ctx is done.
+func (je *JobEngine) runPipeline(ctx context.Context, steps []map[string]interface{}, input interface{}, config map[string]interface{}) (interface{}, error) {
+	if je == nil {
+		je = AgentsEngine
+	}
+
+	result, err := executeJobGroup(ctx, je, newPipeline(steps, input, config), runRecorderFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return result[StrResponse], nil
+}
+
+// newPipeline returns a copy of the given steps (steps definitions are
+// modified while running, so every run gets its own copy), with input as
+// the input of the first step and (a copy of) config merged into its config
+func newPipeline(steps []map[string]interface{}, input interface{}, config map[string]interface{}) []map[string]interface{} {
+	pipeline := make([]map[string]interface{}, len(steps))
+	for i, step := range steps {
+		pipeline[i], _ = copyValue(step).(map[string]interface{})
+	}
+	if len(pipeline) == 0 {
+		return pipeline
+	}
+
+	first, _ := pipeline[0]["params"].(map[string]interface{})
+	if first == nil {
+		first = make(map[string]interface{})
+		pipeline[0]["params"] = first
+	}
+	first[StrRequest] = copyValue(input)
+	stepConfig, _ := first[StrConfig].(map[string]interface{})
+	if stepConfig == nil {
+		stepConfig = make(map[string]interface{})
+		first[StrConfig] = stepConfig
+	}
+	for k, v := range config {
+		stepConfig[k] = copyValue(v)
+	}
+	return pipeline
+}
+
+// runConcurrently runs the tasks with at most concurrency tasks at a time.
+// After the first error (or when ctx is done) no more tasks are started, the
+// first error is returned.
+func runConcurrently(ctx context.Context, tasks []func() error, concurrency int) error {
+	if concurrency <= 0 || concurrency > len(tasks) {
+		concurrency = len(tasks)
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return firstErr != nil
+	}
+
+	sem := make(chan struct{}, concurrency)
+	for _, task := range tasks {
+		sem <- struct{}{}
+		if failed() {
+			<-sem
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			<-sem
+			lock.Lock()
+			firstErr = err
+			lock.Unlock()
+			break
+		}
+		wg.Add(1)
+		go func(task func() error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := task(); err != nil {
+				lock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				lock.Unlock()
+			}
+		}(task)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// getConcurrency returns the concurrency parameter (def if not set)
+func getConcurrency(params map[string]interface{}, def int) (int, error) {
+	v, ok := params["concurrency"]
+	if !ok || v == nil {
+		return def, nil
+	}
+	f, ok := toFloat(v)
+	if !ok || f < 0 || f != float64(int(f)) {
+		return 0, fmt.Errorf("'concurrency' must be a positive integer")
+	}
+	if f == 0 {
+		return def, nil
+	}
+	return int(f), nil
+}
+
+// toList converts an array of any type to []interface{}
+func toList(v interface{}) ([]interface{}, bool) {
+	if list, ok := v.([]interface{}); ok {
+		return list, true
+	}
+	rv := reflect.ValueOf(v)
+	if v == nil || rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+// toBranches converts the branches of a Parallel step
+func toBranches(v interface{}) (map[string][]map[string]interface{}, error) {
+	branchesMap, ok := v.(map[string]interface{})
+	if !ok || len(branchesMap) == 0 {
+		if typed, ok := v.(map[string][]map[string]interface{}); ok && len(typed) > 0 {
+			return typed, nil
+		}
+		return nil, fmt.Errorf("missing 'branches' parameter")
+	}
+	branches := make(map[string][]map[string]interface{}, len(branchesMap))
+	for name, list := range branchesMap {
+		steps, err := toSteps(list)
+		if err != nil || len(steps) == 0 {
+			return nil, fmt.Errorf("branch '%s' must be a (non empty) list of steps", name)
+		}
+		branches[name] = steps
+	}
+	return branches, nil
+}
+
+// nestedSteps returns the sub-pipelines of a ForEach or Parallel step
+// (keyed by branch name, "steps" for ForEach)
+func nestedSteps(actionName string, params map[string]interface{}) (map[string][]map[string]interface{}, error) {
+	switch strings.TrimSpace(actionName) {
+	case "ForEach":
+		steps, err := toSteps(params[StrSteps])
+		if err != nil || len(steps) == 0 {
+			return nil, fmt.Errorf("missing 'steps' parameter")
+		}
+		return map[string][]map[string]interface{}{StrSteps: steps}, nil
+	case "Parallel":
+		return toBranches(params[StrBranches])
+	}
+	return nil, nil
+}
+
+// copyValue returns a deep copy of maps and slices (other values are shared)
+func copyValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			c[k] = copyValue(item)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(value))
+		for i, item := range value {
+			c[i] = copyValue(item)
+		}
+		return c
+	case []map[string]interface{}:
+		c := make([]map[string]interface{}, len(value))
+		for i, item := range value {
+			c[i], _ = copyValue(item).(map[string]interface{})
+		}
+		return c
+	}
+	return v
+}
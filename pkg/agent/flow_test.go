@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// echoAction returns its input (failing for the input "fail") and records
+// the maximum number of concurrent executions
+type echoAction struct {
+	lock    sync.Mutex
+	running int
+	maxRun  int
+}
+
+func (a *echoAction) Name() string {
+	return "Echo"
+}
+
+func (a *echoAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	a.lock.Lock()
+	a.running++
+	if a.running > a.maxRun {
+		a.maxRun = a.running
+	}
+	a.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	a.lock.Lock()
+	a.running--
+	a.lock.Unlock()
+
+	if params[StrRequest] == "fail" {
+		return nil, errors.New("echo failed")
+	}
+	return map[string]interface{}{StrResponse: params[StrRequest], StrConfig: params[StrConfig]}, nil
+}
+
+const testFlowAgents = `
+jobs:
+  - name: "flow"
+    process: "serial"
+    trigger_type: manual
+    trigger_name: "flow"
+    steps:
+      - action: "ForEach"
+        params:
+          items: "$response.input.list"
+          concurrency: 2
+          steps:
+            - action: "Echo"
+      - action: "Parallel"
+        params:
+          branches:
+            first:
+              - action: "Echo"
+            second:
+              - action: "Echo"
+              - action: "Echo"
+`
+
+func newTestFlowEngine() (*JobEngine, *echoAction) {
+	engine := NewJobEngine()
+	echo := &echoAction{}
+	engine.RegisterAction(echo)
+	engine.RegisterAction(&ForEachAction{engine: engine})
+	engine.RegisterAction(&ParallelAction{engine: engine})
+	return engine, echo
+}
+
+func TestForEachAction(t *testing.T) {
+	engine, echo := newTestFlowEngine()
+	jc := loadTestAgents(t, testFlowAgents)
+	forEach := jc.Jobs[0].Steps[0]
+	params := forEach["params"].(map[string]interface{})
+	params[StrRequest] = map[string]interface{}{"list": []interface{}{"a", "b", "c", "d", "e"}}
+	params[StrConfig] = map[string]interface{}{StrReadOnly: true}
+
+	result, err := engine.actions["ForEach"].Execute(params)
+	if err != nil {
+		t.Fatalf("ForEach returned an error: %v", err)
+	}
+	want := []interface{}{"a", "b", "c", "d", "e"}
+	if !reflect.DeepEqual(result[StrResponse], want) {
+		t.Errorf("ForEach response = %v, want %v", result[StrResponse], want)
+	}
+	if echo.maxRun != 2 {
+		t.Errorf("ForEach executed %d elements at the same time, want 2", echo.maxRun)
+	}
+
+	// The step definitions are not modified, so the step can be executed again
+	if _, ok := params[StrSteps].([]map[string]interface{})[0]["params"].(map[string]interface{})[StrRequest]; ok {
+		t.Errorf("ForEach modified its steps definitions")
+	}
+
+	// An element failure fails the step
+	params[StrRequest] = map[string]interface{}{"list": []interface{}{"a", "fail", "c"}}
+	if _, err := engine.actions["ForEach"].Execute(params); err == nil || !strings.Contains(err.Error(), "element 1") {
+		t.Errorf("ForEach expected an error for element 1, got %v", err)
+	}
+
+	// Items must be an array
+	params[StrRequest] = map[string]interface{}{"list": "not a list"}
+	if _, err := engine.actions["ForEach"].Execute(params); err == nil {
+		t.Errorf("ForEach expected an error for a non array items")
+	}
+}
+
+func TestParallelAction(t *testing.T) {
+	engine, echo := newTestFlowEngine()
+	jc := loadTestAgents(t, testFlowAgents)
+	params := jc.Jobs[0].Steps[1]["params"].(map[string]interface{})
+	params[StrRequest] = "value"
+
+	result, err := engine.actions["Parallel"].Execute(params)
+	if err != nil {
+		t.Fatalf("Parallel returned an error: %v", err)
+	}
+	want := map[string]interface{}{"first": "value", "second": "value"}
+	if !reflect.DeepEqual(result[StrResponse], want) {
+		t.Errorf("Parallel response = %v, want %v", result[StrResponse], want)
+	}
+	if echo.maxRun != 2 {
+		t.Errorf("Parallel executed %d branches at the same time, want 2", echo.maxRun)
+	}
+
+	params[StrRequest] = "fail"
+	if _, err := engine.actions["Parallel"].Execute(params); err == nil {
+		t.Errorf("Parallel expected an error")
+	}
+}
+
+func TestFlowStepsInJob(t *testing.T) {
+	engine, _ := newTestFlowEngine()
+	jc := loadTestAgents(t, testFlowAgents)
+	steps := jc.Jobs[0].Steps
+	steps[0]["params"].(map[string]interface{})[StrRequest] = map[string]interface{}{"list": []interface{}{1, 2}}
+
+	// The ForEach response is the Parallel input
+	result, err := executeJobGroup(context.Background(), engine, steps, nil)
+	if err != nil {
+		t.Fatalf("executeJobGroup() returned an error: %v", err)
+	}
+	want := map[string]interface{}{"first": []interface{}{1, 2}, "second": []interface{}{1, 2}}
+	if !reflect.DeepEqual(result[StrResponse], want) {
+		t.Errorf("job response = %v, want %v", result[StrResponse], want)
+	}
+}
+
+func TestFlowStepsCanceled(t *testing.T) {
+	engine, _ := newTestFlowEngine()
+	slow := &slowAction{delay: time.Second}
+	engine.RegisterAction(slow)
+	steps := []map[string]interface{}{
+		{
+			"action":  "ForEach",
+			"timeout": "20ms",
+			"params": map[string]interface{}{
+				StrRequest: []interface{}{1},
+				StrSteps:   []interface{}{map[string]interface{}{"action": "Slow"}},
+			},
+		},
+	}
+
+	// The step timeout cancels the sub-steps too
+	start := time.Now()
+	if _, err := executeJobGroup(context.Background(), engine, steps, nil); err == nil {
+		t.Fatalf("executeJobGroup() expected a timeout error")
+	}
+	if !slow.canceled || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("the sub-step was not canceled (took %v)", time.Since(start))
+	}
+}
+
+func TestValidateFlowSteps(t *testing.T) {
+	invalid := map[string]string{
+		"missing steps":    "jobs:\n  - name: flow\n    steps:\n      - action: ForEach\n",
+		"missing branches": "jobs:\n  - name: flow\n    steps:\n      - action: Parallel\n        params:\n          concurrency: 2\n",
+		"nested action":    "jobs:\n  - name: flow\n    steps:\n      - action: ForEach\n        params:\n          steps:\n            - params: {}\n",
+		"nested policy":    "jobs:\n  - name: flow\n    steps:\n      - action: Parallel\n        params:\n          branches:\n            a:\n              - action: Echo\n                retry:\n                  max_retries: -1\n",
+	}
+	for name, data := range invalid {
+		jc := NewJobConfig()
+		if err := yaml.Unmarshal([]byte(data), jc); err != nil {
+			t.Fatalf("failed to parse the agents (%s): %v", name, err)
+		}
+		if err := jc.Validate(); err == nil {
+			t.Errorf("Validate() expected an error for %s", name)
+		}
+	}
+
+	AgentsSchemaPath = "../../schemas/crowler-agent-schema.json"
+	defer func() { AgentsSchemaPath = "./schemas/crowler-agent-schema.json" }()
+	if err := ValidateAgentDefinition([]byte(testFlowAgents), "yaml"); err == nil {
+		// Echo is not a valid action for the schema
+		t.Errorf("ValidateAgentDefinition() expected an error for an unknown nested action")
+	}
+	valid := `
+jobs:
+  - name: "flow"
+    process: "serial"
+    trigger_type: manual
+    trigger_name: "flow"
+    steps:
+      - action: "ForEach"
+        params:
+          items: "$response.input.rows"
+          concurrency: 2
+          steps:
+            - action: "Parallel"
+              params:
+                branches:
+                  page:
+                    - action: "APIRequest"
+                      params:
+                        url: "$response.input.url"
+                  command:
+                    - action: "RunCommand"
+                      params:
+                        command: "echo"
+`
+	if err := ValidateAgentDefinition([]byte(valid), "yaml"); err != nil {
+		t.Errorf("ValidateAgentDefinition() returned an error: %v", err)
+	}
+}
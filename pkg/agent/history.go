@@ -0,0 +1,235 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package agent provides the agent functionality for the CROWler.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+// maxRecordedOutput is the maximum size of the inputs and outputs stored in the run history
+const maxRecordedOutput = 64 * 1024
+
+// runRecorder stores the execution of a job group in the AgentRuns history.
+// A nil recorder records nothing (for ex. when no database is available).
+// The steps of the sub-pipelines (ForEach and Parallel) are recorded in the
+// run of the calling step, possibly concurrently.
+type runRecorder struct {
+	db         cdb.Handler
+	runID      uint64
+	startedAt  time.Time
+	mutex      sync.Mutex
+	stepIndex  int
+	lastOutput string
+}
+
+// runRecorderKey is the context key of the recorder of the running job group
+type runRecorderKey struct{}
+
+// withRunRecorder returns a copy of ctx carrying rec
+func withRunRecorder(ctx context.Context, rec *runRecorder) context.Context {
+	return context.WithValue(ctx, runRecorderKey{}, rec)
+}
+
+// runRecorderFrom returns the recorder carried by ctx (nil if none)
+func runRecorderFrom(ctx context.Context) *runRecorder {
+	rec, _ := ctx.Value(runRecorderKey{}).(*runRecorder)
+	return rec
+}
+
+// newRunRecorder creates the AgentRuns entry for a job group. The database
+// handler and the triggering event are taken from the agent configuration
+// (iCfg, or its config section when the agent is called by another agent).
+func newRunRecorder(job Job, iCfg map[string]interface{}) *runRecorder {
+	source := iCfg
+	if _, ok := source["db_handler"]; !ok {
+		source, _ = iCfg[StrConfig].(map[string]interface{})
+	}
+	db, ok := source["db_handler"].(cdb.Handler)
+	if !ok || db == nil {
+		return nil
+	}
+
+	run := cdb.AgentRun{
+		JobName:     job.Name,
+		TriggerType: job.TriggerType,
+		TriggerName: job.TriggerName,
+		StartedAt:   time.Now(),
+	}
+	switch event := source["event"].(type) {
+	case cdb.Event:
+		run.EventID = event.ID
+	case *cdb.Event:
+		if event != nil {
+			run.EventID = event.ID
+		}
+	}
+
+	runID, err := cdb.CreateAgentRun(&db, run)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Failed to record the run of agent '%s': %v", job.Name, err)
+		return nil
+	}
+	return &runRecorder{db: db, runID: runID, startedAt: run.StartedAt}
+}
+
+// step records a step executed by the run, with its effective policy
+func (r *runRecorder) step(action string, params, result map[string]interface{}, startedAt time.Time, err error, attempts int, policy StepPolicy) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	step := cdb.AgentRunStep{
+		RunID:      r.runID,
+		Index:      r.stepIndex,
+		Action:     action,
+		Status:     cdb.AgentRunSuccess,
+		StartedAt:  startedAt,
+		DurationMs: time.Since(startedAt).Milliseconds(),
+		Input:      recordValue(params),
+		Output:     recordValue(result[StrResponse]),
+		Attempts:   attempts,
+		Policy:     policy.String(),
+	}
+	if err != nil {
+		step.Status = cdb.AgentRunError
+		step.Error = err.Error()
+	} else {
+		r.lastOutput = step.Output
+	}
+	r.stepIndex++
+	if err := cdb.AddAgentRunStep(&r.db, step); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Failed to record agent run step: %v", err)
+	}
+}
+
+// finish records the final status of the run
+func (r *runRecorder) finish(err error) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := cdb.AgentRunSuccess
+	errMsg := ""
+	if err != nil {
+		status = cdb.AgentRunError
+		errMsg = err.Error()
+	}
+	if err := cdb.FinishAgentRun(&r.db, r.runID, status, r.lastOutput, errMsg, time.Since(r.startedAt)); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Failed to record the end of agent run %d: %v", r.runID, err)
+	}
+}
+
+// redactedKeys are the keys whose values are never recorded (credentials
+// of the actions, like the APIRequest auth, and the HTTP headers carrying
+// them). Keys are compared in lower case.
+var redactedKeys = map[string]bool{
+	"auth":                true,
+	"api_key":             true,
+	"apikey":              true,
+	"x-api-key":           true,
+	"password":            true,
+	"secret":              true,
+	"token":               true,
+	"access_token":        true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// redactedValue replaces the values of the redacted keys
+const redactedValue = "[REDACTED]"
+
+// recordValue returns the (truncated) JSON representation of a step input
+// or output. The config section is never recorded, it contains secrets and
+// internal handlers, and the values of the redactedKeys are replaced.
+func recordValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		filtered := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			if k != StrConfig {
+				filtered[k] = val
+			}
+		}
+		v = filtered
+	}
+	v = redactValue(v)
+
+	var s string
+	if data, err := json.Marshal(v); err == nil {
+		s = string(data)
+	} else {
+		s = fmt.Sprintf("%v", v)
+	}
+	if len(s) > maxRecordedOutput {
+		s = strings.ToValidUTF8(s[:maxRecordedOutput], "") + "...(truncated)"
+	}
+	return s
+}
+
+// redactValue returns a copy of v with the values of the redactedKeys
+// replaced (at any depth)
+func redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			if redactedKeys[strings.ToLower(k)] {
+				c[k] = redactedValue
+				continue
+			}
+			c[k] = redactValue(item)
+		}
+		return c
+	case map[string]string:
+		c := make(map[string]string, len(value))
+		for k, item := range value {
+			if redactedKeys[strings.ToLower(k)] {
+				item = redactedValue
+			}
+			c[k] = item
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(value))
+		for i, item := range value {
+			c[i] = redactValue(item)
+		}
+		return c
+	case []map[string]interface{}:
+		c := make([]interface{}, len(value))
+		for i, item := range value {
+			c[i] = redactValue(item)
+		}
+		return c
+	}
+	return v
+}
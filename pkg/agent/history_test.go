@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+// outputAction returns its input param as output (or fails if fail is set)
+type outputAction struct {
+	name string
+	fail bool
+}
+
+func (a *outputAction) Name() string {
+	return a.name
+}
+
+func (a *outputAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	if a.fail {
+		return nil, errors.New("action failed")
+	}
+	return map[string]interface{}{StrResponse: map[string]interface{}{"value": params["value"]}}, nil
+}
+
+func newTestDBHandler(t *testing.T) cdb.Handler {
+	t.Helper()
+
+	var config cfg.Config
+	config.Database.Type = cdb.DBSQLiteStr
+	config.Database.DBName = filepath.Join(t.TempDir(), "crowler.db")
+	handler, err := cdb.NewHandler(config)
+	if err != nil {
+		t.Fatalf("NewHandler() returned an error: %v", err)
+	}
+	if err := handler.Connect(config); err != nil {
+		t.Fatalf("Connect() returned an error: %v", err)
+	}
+	t.Cleanup(func() { _ = handler.Close() })
+
+	schema, err := os.ReadFile("../database/sqlite-setup-v1.4.sqlite3")
+	if err != nil {
+		t.Fatalf("failed to read the SQLite schema: %v", err)
+	}
+	if _, err := handler.Exec(string(schema)); err != nil {
+		t.Fatalf("failed to create the SQLite schema: %v", err)
+	}
+	return handler
+}
+
+func TestExecuteJobsRecordsRuns(t *testing.T) {
+	db := newTestDBHandler(t)
+	engine := NewJobEngine()
+	engine.RegisterAction(&outputAction{name: "Output"})
+	engine.RegisterAction(&outputAction{name: "Fail", fail: true})
+
+	jobs := &JobConfig{Jobs: []Job{
+		{
+			Name:        "ok-job",
+			TriggerType: "event",
+			TriggerName: "test_event",
+			Steps: []map[string]interface{}{
+				{"action": "Output", "params": map[string]interface{}{"value": "first"}},
+				{"action": "Output", "params": map[string]interface{}{"value": "second"}},
+			},
+		},
+		{
+			Name: "fallback-job",
+			Steps: []map[string]interface{}{
+				{
+					"action": "Fail",
+					"params": map[string]interface{}{},
+					"fallback": []map[string]interface{}{
+						{"action": "Output", "params": map[string]interface{}{"value": "fallback"}},
+					},
+				},
+			},
+		},
+	}}
+	iCfg := map[string]interface{}{
+		"db_handler": db,
+		"event":      cdb.Event{ID: "event-id"},
+		"secret":     "do-not-record",
+	}
+	if err := engine.ExecuteJobs(jobs, iCfg); err != nil {
+		t.Fatalf("ExecuteJobs() returned an error: %v", err)
+	}
+
+	runs, err := cdb.ListAgentRuns(&db, cdb.AgentRunFilter{EventID: "event-id"})
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("ListAgentRuns() = %+v, %v", runs, err)
+	}
+
+	// Runs are returned newest first
+	fallback, err := cdb.GetAgentRun(&db, runs[0].ID)
+	if err != nil || fallback == nil {
+		t.Fatalf("GetAgentRun() = %v, %v", fallback, err)
+	}
+	if fallback.JobName != "fallback-job" || fallback.Status != cdb.AgentRunSuccess || len(fallback.Steps) != 2 ||
+		fallback.Steps[0].Status != cdb.AgentRunError || fallback.Steps[0].Error != "action failed" ||
+		fallback.Steps[1].Output != `{"value":"fallback"}` {
+		t.Errorf("unexpected fallback run: %+v", fallback)
+	}
+
+	run, err := cdb.GetAgentRun(&db, runs[1].ID)
+	if err != nil || run == nil {
+		t.Fatalf("GetAgentRun() = %v, %v", run, err)
+	}
+	if run.JobName != "ok-job" || run.TriggerName != "test_event" || run.Status != cdb.AgentRunSuccess ||
+		run.Result != `{"value":"second"}` || len(run.Steps) != 2 {
+		t.Errorf("unexpected run: %+v", run)
+	}
+	for _, step := range run.Steps {
+		if strings.Contains(step.Input, "do-not-record") {
+			t.Errorf("the step input contains the agent configuration: %s", step.Input)
+		}
+	}
+}
+
+func TestExecuteJobsRecordsSubSteps(t *testing.T) {
+	db := newTestDBHandler(t)
+	engine := NewJobEngine()
+	engine.RegisterAction(&outputAction{name: "Output"})
+	engine.RegisterAction(&ForEachAction{engine: engine})
+
+	jobs := &JobConfig{Jobs: []Job{
+		{
+			Name: "foreach-job",
+			Steps: []map[string]interface{}{
+				{"action": "ForEach", "params": map[string]interface{}{
+					"concurrency": 2,
+					StrSteps: []interface{}{
+						map[string]interface{}{"action": "Output", "params": map[string]interface{}{"value": "item"}},
+					},
+				}},
+			},
+		},
+	}}
+	iCfg := map[string]interface{}{
+		"db_handler": db,
+		"event":      cdb.Event{ID: "foreach-event"},
+		StrRequest:   []interface{}{1, 2},
+	}
+	if err := engine.ExecuteJobs(jobs, iCfg); err != nil {
+		t.Fatalf("ExecuteJobs() returned an error: %v", err)
+	}
+
+	runs, err := cdb.ListAgentRuns(&db, cdb.AgentRunFilter{EventID: "foreach-event"})
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListAgentRuns() = %+v, %v", runs, err)
+	}
+	run, err := cdb.GetAgentRun(&db, runs[0].ID)
+	if err != nil || run == nil {
+		t.Fatalf("GetAgentRun() = %v, %v", run, err)
+	}
+	if len(run.Steps) != 3 {
+		t.Fatalf("recorded %d steps, want 3 (2 sub-steps and the ForEach step): %+v", len(run.Steps), run.Steps)
+	}
+	for i, step := range run.Steps {
+		want := "Output"
+		if i == 2 {
+			want = "ForEach"
+		}
+		if step.Index != i || step.Action != want || step.Status != cdb.AgentRunSuccess {
+			t.Errorf("unexpected step %d: %+v", i, step)
+		}
+	}
+}
+
+func TestRecordValue(t *testing.T) {
+	if got := recordValue(nil); got != "" {
+		t.Errorf("recordValue(nil) = %q", got)
+	}
+	if got := recordValue(map[string]interface{}{StrConfig: "secret", "a": 1}); got != `{"a":1}` {
+		t.Errorf("recordValue() = %q", got)
+	}
+	input := map[string]interface{}{
+		"url":     "https://example.com",
+		"auth":    map[string]interface{}{"type": "basic", "password": "secret"},
+		"api_key": "key",
+		"headers": map[string]interface{}{"Authorization": "Bearer token", "Cookie": "session=1", "Accept": "text/html"},
+		"items":   []interface{}{map[string]interface{}{"Password": "secret", "name": "a"}},
+	}
+	want := `{"api_key":"[REDACTED]","auth":"[REDACTED]","headers":{"Accept":"text/html","Authorization":"[REDACTED]","Cookie":"[REDACTED]"},` +
+		`"items":[{"Password":"[REDACTED]","name":"a"}],"url":"https://example.com"}`
+	if got := recordValue(input); got != want {
+		t.Errorf("recordValue() = %s, want %s", got, want)
+	}
+	if input["api_key"] != "key" {
+		t.Errorf("recordValue() modified the step input")
+	}
+	got := recordValue(strings.Repeat("x", maxRecordedOutput*2))
+	if len(got) > maxRecordedOutput+len("...(truncated)") || !strings.HasSuffix(got, "...(truncated)") {
+		t.Errorf("recordValue() didn't truncate the value (len %d)", len(got))
+	}
+}
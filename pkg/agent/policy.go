@@ -0,0 +1,290 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package agent provides the agent functionality for the CROWler.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+const (
+	// defaultRetryBaseDelay is the delay before the first retry when base_delay is not set
+	defaultRetryBaseDelay = time.Second
+	// defaultRetryBackoff is the delay multiplier when backoff is not set
+	defaultRetryBackoff = 2.0
+)
+
+// RetryConfig defines retry behavior
+type RetryConfig struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	Backoff    float64
+	MaxDelay   time.Duration // 0 means no limit
+}
+
+// StepPolicy defines how a step is executed: its retries, timeout,
+// fallback steps and whether a failure stops the job.
+type StepPolicy struct {
+	Retry           RetryConfig
+	Timeout         time.Duration // 0 means no timeout
+	ContinueOnError bool
+	Fallback        []map[string]interface{}
+}
+
+// delay returns the delay before the given retry (starting from 1)
+func (r RetryConfig) delay(retry int) time.Duration {
+	d := time.Duration(float64(r.BaseDelay) * math.Pow(r.Backoff, float64(retry-1)))
+	if r.MaxDelay > 0 && (d > r.MaxDelay || d < 0) {
+		d = r.MaxDelay
+	}
+	return d
+}
+
+// String returns the JSON representation of the effective policy (as
+// recorded in the agents run history)
+func (p StepPolicy) String() string {
+	effective := map[string]interface{}{
+		"max_retries":       p.Retry.MaxRetries,
+		"continue_on_error": p.ContinueOnError,
+		"fallback_steps":    len(p.Fallback),
+	}
+	if p.Retry.MaxRetries > 0 {
+		effective["base_delay"] = p.Retry.BaseDelay.String()
+		effective["backoff"] = p.Retry.Backoff
+		if p.Retry.MaxDelay > 0 {
+			effective["max_delay"] = p.Retry.MaxDelay.String()
+		}
+	}
+	if p.Timeout > 0 {
+		effective["timeout"] = p.Timeout.String()
+	}
+	data, _ := json.Marshal(effective)
+	return string(data)
+}
+
+// parseStepPolicy returns the policy of a job step. The step may come from
+// an agent file (generic maps) or be built in code (RetryConfig and
+// []map[string]interface{} values).
+func parseStepPolicy(step map[string]interface{}) (StepPolicy, error) {
+	var policy StepPolicy
+	var err error
+
+	switch retry := step["retry"].(type) {
+	case nil:
+	case RetryConfig:
+		policy.Retry = retry
+	default:
+		retryMap, ok := cmn.ConvertMapIIToSI(retry).(map[string]interface{})
+		if !ok {
+			return policy, fmt.Errorf("'retry' must be an object")
+		}
+		if policy.Retry, err = parseRetryConfig(retryMap); err != nil {
+			return policy, err
+		}
+	}
+	if policy.Retry.MaxRetries > 0 {
+		if policy.Retry.BaseDelay == 0 {
+			policy.Retry.BaseDelay = defaultRetryBaseDelay
+		}
+		if policy.Retry.Backoff == 0 {
+			policy.Retry.Backoff = defaultRetryBackoff
+		}
+	}
+
+	if v, ok := step["timeout"]; ok && v != nil {
+		if policy.Timeout, err = parsePolicyDuration(v); err != nil {
+			return policy, fmt.Errorf("invalid 'timeout': %v", err)
+		}
+	}
+
+	if v, ok := step["continue_on_error"]; ok && v != nil {
+		if policy.ContinueOnError, ok = v.(bool); !ok {
+			return policy, fmt.Errorf("'continue_on_error' must be a boolean")
+		}
+	}
+
+	if v, ok := step["fallback"]; ok && v != nil {
+		if policy.Fallback, err = toSteps(v); err != nil {
+			return policy, fmt.Errorf("invalid 'fallback': %v", err)
+		}
+	}
+
+	return policy, nil
+}
+
+// toSteps converts a list of steps from an agent file (generic maps) or
+// built in code ([]map[string]interface{})
+func toSteps(v interface{}) ([]map[string]interface{}, error) {
+	switch list := v.(type) {
+	case []map[string]interface{}:
+		return list, nil
+	case []interface{}:
+		steps := make([]map[string]interface{}, 0, len(list))
+		for i, item := range list {
+			step, ok := cmn.ConvertMapIIToSI(item).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("step %d must be an object", i)
+			}
+			steps = append(steps, step)
+		}
+		return steps, nil
+	default:
+		return nil, fmt.Errorf("must be a list of steps")
+	}
+}
+
+// parseRetryConfig parses the retry section of a step
+func parseRetryConfig(retry map[string]interface{}) (RetryConfig, error) {
+	var rc RetryConfig
+	var err error
+	for k, v := range retry {
+		switch k {
+		case "max_retries":
+			n, ok := v.(int)
+			if f, isFloat := v.(float64); isFloat && f == math.Trunc(f) {
+				n, ok = int(f), true
+			}
+			if !ok || n < 0 {
+				return rc, fmt.Errorf("'retry.max_retries' must be a positive integer")
+			}
+			rc.MaxRetries = n
+		case "base_delay":
+			if rc.BaseDelay, err = parsePolicyDuration(v); err != nil {
+				return rc, fmt.Errorf("invalid 'retry.base_delay': %v", err)
+			}
+		case "max_delay":
+			if rc.MaxDelay, err = parsePolicyDuration(v); err != nil {
+				return rc, fmt.Errorf("invalid 'retry.max_delay': %v", err)
+			}
+		case "backoff":
+			f, ok := toFloat(v)
+			if !ok || f < 1 {
+				return rc, fmt.Errorf("'retry.backoff' must be a number greater than or equal to 1")
+			}
+			rc.Backoff = f
+		default:
+			return rc, fmt.Errorf("unknown retry option '%s'", k)
+		}
+	}
+	return rc, nil
+}
+
+// parsePolicyDuration parses a duration expressed in seconds (number) or
+// as a Go duration string ("30s", "500ms")
+func parsePolicyDuration(v interface{}) (time.Duration, error) {
+	var d time.Duration
+	switch value := v.(type) {
+	case time.Duration:
+		d = value
+	case string:
+		value = strings.TrimSpace(value)
+		if secs, err := strconv.ParseFloat(value, 64); err == nil {
+			d = time.Duration(secs * float64(time.Second))
+			break
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, err
+		}
+		d = parsed
+	default:
+		secs, ok := toFloat(value)
+		if !ok {
+			return 0, fmt.Errorf("unsupported value %v", v)
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %v", d)
+	}
+	return d, nil
+}
+
+// errActionAbandoned is returned when an action which can't be canceled
+// times out: it's still running in the background
+var errActionAbandoned = errors.New("the action is still running")
+
+// executeStep executes an action applying the step timeout and retries.
+// It returns the action result and the number of attempts. Actions which
+// time out and can't be canceled are not retried (the abandoned execution
+// could still complete, so a retry could run it twice), and no retry is
+// started once ctx is done.
+func executeStep(ctx context.Context, action Action, params map[string]interface{}, policy StepPolicy) (map[string]interface{}, int, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := executeWithTimeout(ctx, action, params, policy.Timeout)
+		if err == nil || attempt > policy.Retry.MaxRetries || errors.Is(err, errActionAbandoned) {
+			return result, attempt, err
+		}
+
+		delay := policy.Retry.delay(attempt)
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Action %s failed (attempt %d of %d): %v, retrying in %v",
+			action.Name(), attempt, policy.Retry.MaxRetries+1, err, delay)
+		select {
+		case <-ctx.Done():
+			return result, attempt, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// executeWithTimeout executes an action, failing if it doesn't complete
+// within timeout (0 means no timeout). Actions implementing ContextAction
+// get ctx (and are canceled when the timeout expires), the others are left
+// running in the background and their result is discarded.
+func executeWithTimeout(ctx context.Context, action Action, params map[string]interface{}, timeout time.Duration) (map[string]interface{}, error) {
+	ca, isContextAction := action.(ContextAction)
+	if timeout <= 0 {
+		if isContextAction {
+			return ca.ExecuteContext(ctx, params)
+		}
+		return action.Execute(params)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if isContextAction {
+		result, err := ca.ExecuteContext(ctx, params)
+		if err != nil && ctx.Err() != nil {
+			return result, fmt.Errorf("action %s timed out after %v: %v", action.Name(), timeout, err)
+		}
+		return result, err
+	}
+
+	type outcome struct {
+		result map[string]interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := action.Execute(params)
+		done <- outcome{result, err}
+	}()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("action %s timed out after %v: %w", action.Name(), timeout, errActionAbandoned)
+	}
+}
@@ -0,0 +1,346 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+
+	"gopkg.in/yaml.v2"
+)
+
+// flakyAction fails until it has been executed failures+1 times
+type flakyAction struct {
+	failures int
+	calls    int
+}
+
+func (a *flakyAction) Name() string {
+	return "Flaky"
+}
+
+func (a *flakyAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	a.calls++
+	if a.calls <= a.failures {
+		return nil, errors.New("temporary failure")
+	}
+	return map[string]interface{}{StrResponse: map[string]interface{}{"calls": a.calls}}, nil
+}
+
+// slowAction waits for delay (or for its context to be canceled)
+type slowAction struct {
+	delay    time.Duration
+	canceled bool
+}
+
+func (a *slowAction) Name() string {
+	return "Slow"
+}
+
+func (a *slowAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	return a.ExecuteContext(context.Background(), params)
+}
+
+func (a *slowAction) ExecuteContext(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	select {
+	case <-time.After(a.delay):
+		return map[string]interface{}{StrResponse: "done"}, nil
+	case <-ctx.Done():
+		a.canceled = true
+		return nil, ctx.Err()
+	}
+}
+
+// blockingAction doesn't support cancellation and waits for delay
+type blockingAction struct {
+	delay time.Duration
+	calls int
+}
+
+func (a *blockingAction) Name() string {
+	return "Blocking"
+}
+
+func (a *blockingAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	a.calls++
+	time.Sleep(a.delay)
+	return map[string]interface{}{StrResponse: "done"}, nil
+}
+
+// paramsAction returns its input and config
+type paramsAction struct{}
+
+func (a *paramsAction) Name() string {
+	return "Params"
+}
+
+func (a *paramsAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{StrResponse: map[string]interface{}{"input": params[StrRequest], "config": params[StrConfig]}}, nil
+}
+
+const testPolicyAgents = `
+jobs:
+  - name: "policies"
+    process: "serial"
+    trigger_type: manual
+    steps:
+      - action: "Flaky"
+        timeout: "2s"
+        retry:
+          max_retries: 2
+          base_delay: "1ms"
+          backoff: 1.5
+          max_delay: 5ms
+      - action: "Fail"
+        continue_on_error: true
+      - action: "Fail"
+        fallback:
+          - action: "Output"
+            params:
+              value: "from fallback"
+      - action: "Fail"
+`
+
+func loadTestAgents(t *testing.T, data string) *JobConfig {
+	t.Helper()
+	jc := NewJobConfig()
+	if err := yaml.Unmarshal([]byte(data), jc); err != nil {
+		t.Fatalf("failed to parse the agents: %v", err)
+	}
+	if err := jc.Validate(); err != nil {
+		t.Fatalf("Validate() returned an error: %v", err)
+	}
+	return jc
+}
+
+func TestParseStepPolicyFromYAML(t *testing.T) {
+	jc := loadTestAgents(t, testPolicyAgents)
+	steps := jc.Jobs[0].Steps
+
+	policy, err := parseStepPolicy(steps[0])
+	if err != nil {
+		t.Fatalf("parseStepPolicy() returned an error: %v", err)
+	}
+	want := RetryConfig{MaxRetries: 2, BaseDelay: time.Millisecond, Backoff: 1.5, MaxDelay: 5 * time.Millisecond}
+	if policy.Retry != want || policy.Timeout != 2*time.Second {
+		t.Errorf("parseStepPolicy() = %+v, want retry %+v and timeout 2s", policy, want)
+	}
+
+	policy, _ = parseStepPolicy(steps[1])
+	if !policy.ContinueOnError {
+		t.Errorf("expected continue_on_error to be set")
+	}
+
+	policy, _ = parseStepPolicy(steps[2])
+	if len(policy.Fallback) != 1 || policy.Fallback[0]["action"] != "Output" {
+		t.Fatalf("unexpected fallback: %v", policy.Fallback)
+	}
+	if _, ok := policy.Fallback[0]["params"].(map[string]interface{}); !ok {
+		t.Errorf("fallback params were not normalized: %T", policy.Fallback[0]["params"])
+	}
+
+	// Defaults
+	policy, _ = parseStepPolicy(map[string]interface{}{"retry": map[string]interface{}{"max_retries": 1}})
+	if policy.Retry.BaseDelay != defaultRetryBaseDelay || policy.Retry.Backoff != defaultRetryBackoff {
+		t.Errorf("unexpected default retry policy: %+v", policy.Retry)
+	}
+}
+
+func TestParseStepPolicyErrors(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"retry": map[string]interface{}{"max_retries": -1}},
+		{"retry": map[string]interface{}{"retries": 3}},
+		{"retry": map[string]interface{}{"backoff": 0.5}},
+		{"retry": "3"},
+		{"timeout": "ten seconds"},
+		{"timeout": -1},
+		{"continue_on_error": "yes"},
+		{"fallback": "Output"},
+	}
+	for _, step := range tests {
+		if _, err := parseStepPolicy(step); err == nil {
+			t.Errorf("parseStepPolicy(%v) expected an error", step)
+		}
+	}
+
+	jc := NewJobConfig()
+	jc.LoadJob(Job{Name: "invalid", Steps: []map[string]interface{}{
+		{"action": "Output", "fallback": []interface{}{map[interface{}]interface{}{"params": nil}}},
+	}})
+	if err := jc.Validate(); err == nil || !strings.Contains(err.Error(), "fallback") {
+		t.Errorf("Validate() = %v, want a fallback error", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := RetryConfig{BaseDelay: 100 * time.Millisecond, Backoff: 2, MaxDelay: 300 * time.Millisecond}
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 10: 300 * time.Millisecond} {
+		if got := r.delay(retry); got != want {
+			t.Errorf("delay(%d) = %v, want %v", retry, got, want)
+		}
+	}
+}
+
+func TestExecuteStepRetries(t *testing.T) {
+	action := &flakyAction{failures: 2}
+	policy := StepPolicy{Retry: RetryConfig{MaxRetries: 2, BaseDelay: time.Millisecond, Backoff: 1}}
+	if _, attempts, err := executeStep(context.Background(), action, map[string]interface{}{}, policy); err != nil || attempts != 3 {
+		t.Errorf("executeStep() = %d attempts, %v; want 3 attempts and no error", attempts, err)
+	}
+
+	action = &flakyAction{failures: 5}
+	if _, attempts, err := executeStep(context.Background(), action, map[string]interface{}{}, policy); err == nil || attempts != 3 || action.calls != 3 {
+		t.Errorf("executeStep() = %d attempts (%d calls), %v; want 3 attempts and an error", attempts, action.calls, err)
+	}
+}
+
+func TestExecuteStepTimeout(t *testing.T) {
+	action := &slowAction{delay: time.Second}
+	start := time.Now()
+	_, _, err := executeStep(context.Background(), action, map[string]interface{}{}, StepPolicy{Timeout: 20 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("executeStep() = %v, want a timeout error", err)
+	}
+	if !action.canceled {
+		t.Errorf("the action context was not canceled")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("the timeout was not enforced (took %v)", time.Since(start))
+	}
+
+	// Actions without context support are abandoned
+	plain := &outputAction{name: "Plain"}
+	if _, _, err := executeStep(context.Background(), plain, map[string]interface{}{"value": 1}, StepPolicy{Timeout: time.Second}); err != nil {
+		t.Errorf("executeStep() returned an error: %v", err)
+	}
+
+	// and they are not retried, the abandoned execution is still running
+	blocking := &blockingAction{delay: 200 * time.Millisecond}
+	policy := StepPolicy{Timeout: 20 * time.Millisecond, Retry: RetryConfig{MaxRetries: 2, BaseDelay: time.Millisecond, Backoff: 1}}
+	_, attempts, err := executeStep(context.Background(), blocking, map[string]interface{}{}, policy)
+	if err == nil || attempts != 1 {
+		t.Errorf("executeStep() = %d attempts, %v; want 1 attempt and a timeout error", attempts, err)
+	}
+}
+
+func TestExecuteJobGroupFallbackInput(t *testing.T) {
+	engine := NewJobEngine()
+	engine.RegisterAction(&outputAction{name: "Fail", fail: true})
+	engine.RegisterAction(&paramsAction{})
+
+	fallback := []interface{}{map[string]interface{}{"action": "Params"}}
+	steps := []map[string]interface{}{
+		{
+			"action":   "Fail",
+			"params":   map[string]interface{}{StrRequest: map[string]interface{}{"id": 1}, StrConfig: map[string]interface{}{"url": "https://example.com"}},
+			"fallback": fallback,
+		},
+	}
+	result, err := executeJobGroup(context.Background(), engine, steps, nil)
+	if err != nil {
+		t.Fatalf("executeJobGroup() returned an error: %v", err)
+	}
+	response, _ := result[StrResponse].(map[string]interface{})
+	input, _ := response["input"].(map[string]interface{})
+	config, _ := response["config"].(map[string]interface{})
+	if input["id"] != 1 || config["url"] != "https://example.com" {
+		t.Errorf("the fallback step got input %v and config %v", response["input"], response["config"])
+	}
+	if _, ok := fallback[0].(map[string]interface{})["params"]; ok {
+		t.Errorf("the fallback definition was modified: %v", fallback[0])
+	}
+}
+
+func TestExecuteJobsWithPolicies(t *testing.T) {
+	db := newTestDBHandler(t)
+	flaky := &flakyAction{failures: 2}
+	engine := NewJobEngine()
+	engine.RegisterAction(flaky)
+	engine.RegisterAction(&outputAction{name: "Output"})
+	engine.RegisterAction(&outputAction{name: "Fail", fail: true})
+
+	// The last step is never reached: the fallback replaces the rest of the job
+	jc := loadTestAgents(t, testPolicyAgents)
+	if err := engine.ExecuteJobs(jc, map[string]interface{}{"db_handler": db}); err != nil {
+		t.Fatalf("ExecuteJobs() returned an error: %v", err)
+	}
+	if flaky.calls != 3 {
+		t.Errorf("Flaky was executed %d times, want 3", flaky.calls)
+	}
+
+	runs, err := cdb.ListAgentRuns(&db, cdb.AgentRunFilter{JobName: "policies"})
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListAgentRuns() = %+v, %v", runs, err)
+	}
+	run, err := cdb.GetAgentRun(&db, runs[0].ID)
+	if err != nil || run == nil {
+		t.Fatalf("GetAgentRun() = %v, %v", run, err)
+	}
+	steps := run.Steps
+	if len(steps) != 4 {
+		t.Fatalf("expected 4 recorded steps, got %d", len(steps))
+	}
+	if steps[0].Attempts != 3 || !strings.Contains(steps[0].Policy, `"max_retries":2`) || !strings.Contains(steps[0].Policy, `"timeout":"2s"`) {
+		t.Errorf("unexpected first step: attempts %d, policy %s", steps[0].Attempts, steps[0].Policy)
+	}
+	if steps[1].Status != cdb.AgentRunError || !strings.Contains(steps[1].Policy, `"continue_on_error":true`) {
+		t.Errorf("unexpected second step: %+v", steps[1])
+	}
+	if steps[3].Action != "Output" || !strings.Contains(steps[3].Output, "from fallback") {
+		t.Errorf("unexpected fallback step: %+v", steps[3])
+	}
+
+	// Without continue_on_error (or a fallback) a failure stops the job
+	jc = loadTestAgents(t, "jobs:\n  - name: fail\n    steps:\n      - action: Fail\n      - action: Output\n")
+	if err := engine.ExecuteJobs(jc, map[string]interface{}{}); err == nil {
+		t.Errorf("ExecuteJobs() expected an error")
+	}
+}
+
+func TestValidateAgentDefinition(t *testing.T) {
+	AgentsSchemaPath = "../../schemas/crowler-agent-schema.json"
+	defer func() { AgentsSchemaPath = "./schemas/crowler-agent-schema.json" }()
+
+	valid := `
+jobs:
+  - name: "Enrich data"
+    process: "serial"
+    trigger_type: event
+    trigger_name: "new_data"
+    steps:
+      - action: "APIRequest"
+        timeout: "10s"
+        retry:
+          max_retries: 3
+          base_delay: "500ms"
+          backoff: 2
+          max_delay: 5
+        fallback:
+          - action: "APIRequest"
+            params:
+              url: "https://backup.example.com/api/data"
+        params:
+          url: "https://example.com/api/data"
+      - action: "PluginExecution"
+        continue_on_error: true
+        params:
+          plugin_name: "enrich_data"
+`
+	if err := ValidateAgentDefinition([]byte(valid), "yaml"); err != nil {
+		t.Errorf("ValidateAgentDefinition() returned an error: %v", err)
+	}
+
+	invalid := map[string]string{
+		"retry option": strings.Replace(valid, "backoff: 2", "factor: 2", 1),
+		"timeout":      strings.Replace(valid, `timeout: "10s"`, `timeout: "10 seconds"`, 1),
+		"fallback":     strings.Replace(valid, `url: "https://backup.example.com/api/data"`, `uri: "https://backup.example.com/api/data"`, 1),
+	}
+	for name, data := range invalid {
+		if err := ValidateAgentDefinition([]byte(data), "yaml"); err == nil {
+			t.Errorf("ValidateAgentDefinition() expected an error for an invalid %s", name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package agent
+
+import (
+	"path/filepath"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+// AgentsFile is the result of loading an agents definition file of an
+// agents location
+type AgentsFile struct {
+	Path string // Path of the file
+	Jobs []Job  // Jobs loaded from the file
+	Err  error  // Error loading or validating the file
+}
+
+// LoadAgentsFiles loads, one by one, the agents definition files of an
+// agents location and validates them. Unlike LoadConfig, the errors are
+// returned per file, so a reload can keep the previous version of a broken
+// file.
+func LoadAgentsFiles(config cfg.AgentsConfig) []AgentsFile {
+	paths := config.Path
+	if len(paths) == 0 {
+		paths = []string{"./agents/*.yaml"}
+	}
+
+	var files []AgentsFile
+	for _, path := range paths {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			files = append(files, AgentsFile{Path: path, Err: err})
+			continue
+		}
+		for _, filePath := range matches {
+			fileType := cmn.GetFileExt(filePath)
+			if (fileType != "yaml") && (fileType != "json") && (fileType != "") && (fileType != "yml") {
+				continue
+			}
+			jobs, err := loadAgentsFile(filePath, fileType, config.GlobalParameters)
+			files = append(files, AgentsFile{Path: filePath, Jobs: jobs, Err: err})
+		}
+	}
+	return files
+}
+
+// Replace atomically replaces the jobs of the JobConfig and returns what
+// changed (jobs are identified by name). The uploaded jobs (see
+// RegisterUploadedAgent) which are not in jobs are kept. The JobConfig is
+// left untouched when nothing changed. The agents already running are not
+// affected.
+func (jc *JobConfig) Replace(jobs []Job) cmn.Changes {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+
+	names := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		names[job.Name] = true
+	}
+	jobs = append([]Job(nil), jobs...)
+	for _, job := range jc.Jobs {
+		if jc.uploaded[job.Name] && !names[job.Name] {
+			jobs = append(jobs, job)
+		}
+	}
+
+	changes := cmn.DiffFingerprints(jobsFingerprints(jc.Jobs), jobsFingerprints(jobs))
+	if !changes.IsEmpty() {
+		jc.Jobs = jobs
+	}
+	return changes
+}
+
+// jobsFingerprints returns the fingerprints of a list of jobs
+func jobsFingerprints(jobs []Job) map[string]string {
+	fps := make(map[string]string, len(jobs))
+	for _, job := range jobs {
+		fps[job.Name] = cmn.Fingerprint(job)
+	}
+	return fps
+}
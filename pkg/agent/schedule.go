@@ -0,0 +1,95 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package agent provides the agent functionality for the CROWler.
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// TriggerEvent is the trigger type of the agents started by an event (trigger_name is the event type)
+	TriggerEvent = "event"
+	// TriggerAgent is the trigger type of the agents started by another agent
+	TriggerAgent = "agent"
+	// TriggerSchedule is the trigger type of the agents started periodically (trigger_name is a cron expression)
+	TriggerSchedule = "schedule"
+	// TriggerManual is the trigger type of the agents started on request (via the events API)
+	TriggerManual = "manual"
+)
+
+// ParseSchedule parses the cron expression of a scheduled agent.
+// It accepts the standard 5 fields format ("*/5 * * * *") and the
+// descriptors like "@hourly", "@daily" or "@every 10m".
+func ParseSchedule(expr string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(strings.TrimSpace(expr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule '%s': %v", expr, err)
+	}
+	return schedule, nil
+}
+
+// NextRun returns the first time after t a job with the given schedule has to run
+func (j *Job) NextRun(t time.Time) (time.Time, error) {
+	if !j.HasTrigger(TriggerSchedule) {
+		return time.Time{}, fmt.Errorf("agent '%s' is not a scheduled agent", j.Name)
+	}
+	schedule, err := ParseSchedule(j.TriggerName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(t), nil
+}
+
+// HasTrigger returns true if the job has the given trigger type
+func (j *Job) HasTrigger(triggerType string) bool {
+	return strings.ToLower(strings.TrimSpace(j.TriggerType)) == triggerType
+}
+
+// GetAgentsByTriggerType returns all the agents with the given trigger type
+func (jc *JobConfig) GetAgentsByTriggerType(triggerType string) ([]*JobConfig, bool) {
+	if jc == nil {
+		return nil, false
+	}
+
+	jobs := jc.GetAllJobs()
+	var agents []*JobConfig
+	for i := 0; i < len(jobs); i++ {
+		if jobs[i].HasTrigger(triggerType) {
+			rjc := &JobConfig{}
+			rjc.Jobs = append(rjc.Jobs, jobs[i])
+			agents = append(agents, rjc)
+		}
+	}
+
+	return agents, len(agents) > 0
+}
+
+// GetManualAgent returns the manual agent with the given trigger_name (or name)
+func (jc *JobConfig) GetManualAgent(name string) (*JobConfig, bool) {
+	agents, _ := jc.GetAgentsByTriggerType(TriggerManual)
+	name = strings.TrimSpace(name)
+	for _, agent := range agents {
+		job := agent.Jobs[0]
+		if strings.TrimSpace(job.TriggerName) == name || strings.TrimSpace(job.Name) == name {
+			return agent, true
+		}
+	}
+	return nil, false
+}
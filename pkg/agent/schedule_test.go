@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+// inputAction returns its input as output
+type inputAction struct{}
+
+func (a *inputAction) Name() string {
+	return "Input"
+}
+
+func (a *inputAction) Execute(params map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{StrResponse: params[StrRequest]}, nil
+}
+
+func TestJobNextRun(t *testing.T) {
+	now := time.Date(2030, 1, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		job     Job
+		want    time.Time
+		wantErr bool
+	}{
+		{Job{TriggerType: "schedule", TriggerName: "*/15 * * * *"}, time.Date(2030, 1, 1, 10, 15, 0, 0, time.UTC), false},
+		{Job{TriggerType: " Schedule ", TriggerName: "@daily"}, time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{Job{TriggerType: "schedule", TriggerName: "@every 10m"}, now.Add(10 * time.Minute), false},
+		{Job{TriggerType: "schedule", TriggerName: "every 5 minutes"}, time.Time{}, true},
+		{Job{TriggerType: "event", TriggerName: "*/15 * * * *"}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.job.NextRun(now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NextRun(%q) error = %v, wantErr %v", tt.job.TriggerName, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("NextRun(%q) = %v, want %v", tt.job.TriggerName, got, tt.want)
+		}
+	}
+}
+
+func TestGetAgentsByTriggerType(t *testing.T) {
+	jc := &JobConfig{Jobs: []Job{
+		{Name: "scheduled", TriggerType: "schedule", TriggerName: "@hourly"},
+		{Name: "on-event", TriggerType: "event", TriggerName: "new_source"},
+		{Name: "manual-1", TriggerType: "manual", TriggerName: "cleanup"},
+		{Name: "manual-2", TriggerType: "manual"},
+	}}
+
+	if agents, ok := jc.GetAgentsByTriggerType(TriggerSchedule); !ok || len(agents) != 1 || agents[0].Jobs[0].Name != "scheduled" {
+		t.Errorf("GetAgentsByTriggerType(schedule) = %v, %v", agents, ok)
+	}
+	for name, want := range map[string]string{"cleanup": "manual-1", "manual-1": "manual-1", "manual-2": "manual-2"} {
+		if agent, ok := jc.GetManualAgent(name); !ok || agent.Jobs[0].Name != want {
+			t.Errorf("GetManualAgent(%q) = %v, %v, want %s", name, agent, ok, want)
+		}
+	}
+	if _, ok := jc.GetManualAgent("on-event"); ok {
+		t.Errorf("GetManualAgent() returned an agent that is not manual")
+	}
+}
+
+func TestExecuteJobsWithInput(t *testing.T) {
+	db := newTestDBHandler(t)
+	engine := NewJobEngine()
+	engine.RegisterAction(&inputAction{})
+
+	jc := &JobConfig{Jobs: []Job{
+		{Name: "manual", TriggerType: "manual", Steps: []map[string]interface{}{{"action": "Input"}}},
+	}}
+	iCfg := map[string]interface{}{
+		"db_handler": db,
+		StrRequest:   map[string]interface{}{"url": "https://example.com"},
+	}
+	if err := engine.ExecuteJobs(jc, iCfg); err != nil {
+		t.Fatalf("ExecuteJobs() returned an error: %v", err)
+	}
+
+	params := jc.Jobs[0].Steps[0]["params"].(map[string]interface{})
+	if _, ok := params[StrConfig].(map[string]interface{})[StrRequest]; ok {
+		t.Errorf("the input was merged in the step config")
+	}
+	runs, err := cdb.ListAgentRuns(&db, cdb.AgentRunFilter{})
+	if err != nil || len(runs) != 1 || runs[0].Result != `{"url":"https://example.com"}` || runs[0].TriggerType != "manual" {
+		t.Errorf("unexpected runs: %+v, %v", runs, err)
+	}
+}
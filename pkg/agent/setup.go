@@ -16,12 +16,13 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -39,16 +40,12 @@ var (
 	AgentsRegistry *JobConfig
 )
 
-// RetryConfig defines retry behavior
-type RetryConfig struct {
-	MaxRetries int
-	BaseDelay  time.Duration
-	Backoff    float64
-}
-
 // JobConfig represents the structure of a job configuration file
 type JobConfig struct {
 	Jobs []Job `yaml:"jobs" json:"jobs"`
+
+	uploaded map[string]bool // Names of the uploaded jobs (kept by Replace)
+	mu       sync.RWMutex    // Protects Jobs (they can be replaced by a reload)
 }
 
 // Job represents a job configuration
@@ -57,6 +54,7 @@ type Job struct {
 	Process     string                   `yaml:"process" json:"process"`
 	TriggerType string                   `yaml:"trigger_type" json:"trigger_type"`
 	TriggerName string                   `yaml:"trigger_name" json:"trigger_name"`
+	ReadOnly    bool                     `yaml:"read_only" json:"read_only"` // The agent can't modify the CROWler DB
 	Steps       []map[string]interface{} `yaml:"steps" json:"steps"`
 }
 
@@ -70,6 +68,8 @@ func (jc *JobConfig) LoadJob(j Job) {
 	if jc == nil {
 		jc = NewJobConfig()
 	}
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
 	if jc.Jobs == nil {
 		jc.Jobs = make([]Job, 0)
 	}
@@ -106,105 +106,160 @@ func (jc *JobConfig) LoadConfig(agtConfigs []cfg.AgentsConfig) error {
 						// Ignore unsupported file types
 						continue
 					}
-					cmn.DebugMsg(cmn.DbgLvlDebug, "Loading agents definition file: %s", filePath)
 
-					// Load the configuration file
-					file, err := os.Open(filePath) //nolint:gosec // The path here is handled by the service not an end-user
+					jobs, err := loadAgentsFile(filePath, fileType, globalParams)
 					if err != nil {
-						return fmt.Errorf("failed to open config file: %v", err)
+						return err
 					}
-					defer file.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
 
-					// Transform file into a string for interpolation
-					fileStr, err := io.ReadAll(file)
-					if err != nil {
-						return fmt.Errorf("failed to read config file: %v", err)
-					}
+					// Add the configuration to the list
+					jc.mu.Lock()
+					jc.Jobs = append(jc.Jobs, jobs...)
+					jc.mu.Unlock()
+				}
+			}
+		}
+	}
 
-					// Interpolate environment variables and process includes
-					interpolatedData := cmn.InterpolateEnvVars(string(fileStr))
+	return nil
+}
 
-					// transform the string back into a reader
-					readCloser := io.NopCloser(strings.NewReader(interpolatedData))
-					defer readCloser.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+// loadAgentsFile loads, validates and returns the jobs of an agents
+// definition file
+func loadAgentsFile(filePath, fileType string, globalParams map[string]interface{}) ([]Job, error) {
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Loading agents definition file: %s", filePath)
 
-					// Decode the configuration file
-					var agtConfigStorage JobConfig
-					if strings.HasSuffix(filePath, ".yaml") || strings.HasSuffix(filePath, ".yml") {
-						err = yaml.NewDecoder(readCloser).Decode(&agtConfigStorage)
-					} else if strings.HasSuffix(filePath, ".json") {
-						err = json.NewDecoder(readCloser).Decode(&agtConfigStorage)
-					} else {
-						return fmt.Errorf("unsupported file format: %s", filePath)
-					}
-					if err != nil {
-						return fmt.Errorf("failed to parse config file: %v", err)
-					}
+	// Load the configuration file
+	file, err := os.Open(filePath) //nolint:gosec // The path here is handled by the service not an end-user
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %v", err)
+	}
+	defer file.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
 
-					// Add the global parameters to the configuration
-					if len(globalParams) > 0 {
-						for i := 0; i < len(agtConfigStorage.Jobs); i++ {
-							for j := 0; j < len(agtConfigStorage.Jobs[i].Steps); j++ {
-								// Check if each Job's step has a params field
-								if _, ok := agtConfigStorage.Jobs[i].Steps[0]["params"]; !ok {
-									// If not, create the "params" key with an empty map[interface{}]interface{}
-									agtConfigStorage.Jobs[i].Steps[0]["params"] = make(map[interface{}]interface{})
-								}
-								// Check if each job's step has a "config" field in params, if not add it
-								if _, ok := agtConfigStorage.Jobs[i].Steps[j]["params"].(map[interface{}]interface{})[StrConfig]; !ok {
-									agtConfigStorage.Jobs[i].Steps[j]["params"].(map[interface{}]interface{})[StrConfig] = make(map[interface{}]interface{})
-								}
-							}
-
-							// Add the global parameters to the configuration
-							for j := 0; j < len(agtConfigStorage.Jobs[i].Steps); j++ {
-								for k, v := range globalParams {
-									// Check if the params field has a k field
-									if _, ok := agtConfigStorage.Jobs[i].Steps[j]["params"]; !ok {
-										// If not, create the "params" key with an empty map[interface{}]interface{}
-										agtConfigStorage.Jobs[i].Steps[j]["params"] = make(map[interface{}]interface{})
-									}
-									// Ensure the type assertion works
-									if paramMap, ok := agtConfigStorage.Jobs[i].Steps[j]["params"].(map[interface{}]interface{}); ok {
-										// Convert globalParams into map[interface{}]interface{} before merging
-										paramMap[k] = v
-									} else {
-										// Handle unexpected types
-										cmn.DebugMsg(cmn.DbgLvlError, "params field is not of type map[interface{}]interface{}, but is %T", agtConfigStorage.Jobs[i].Steps[j]["params"])
-									}
-								}
-							}
-						}
-					}
+	// Transform file into a string for interpolation
+	fileStr, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
 
-					// Add the configuration to the list
-					jc.Jobs = append(jc.Jobs, agtConfigStorage.Jobs...)
+	// Interpolate environment variables and process includes
+	interpolatedData := cmn.InterpolateEnvVars(string(fileStr))
+
+	// Validate the definition against the agents schema
+	if err := ValidateAgentDefinition([]byte(interpolatedData), fileType); err != nil {
+		return nil, fmt.Errorf("invalid agents definition file %s: %v", filePath, err)
+	}
+
+	// transform the string back into a reader
+	readCloser := io.NopCloser(strings.NewReader(interpolatedData))
+	defer readCloser.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	// Decode the configuration file
+	var agtConfigStorage JobConfig
+	if strings.HasSuffix(filePath, ".yaml") || strings.HasSuffix(filePath, ".yml") {
+		err = yaml.NewDecoder(readCloser).Decode(&agtConfigStorage)
+	} else if strings.HasSuffix(filePath, ".json") {
+		err = json.NewDecoder(readCloser).Decode(&agtConfigStorage)
+	} else {
+		return nil, fmt.Errorf("unsupported file format: %s", filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	// Add the global parameters to the configuration
+	if len(globalParams) > 0 {
+		for i := 0; i < len(agtConfigStorage.Jobs); i++ {
+			for j := 0; j < len(agtConfigStorage.Jobs[i].Steps); j++ {
+				// Check if each Job's step has a params field
+				if _, ok := agtConfigStorage.Jobs[i].Steps[0]["params"]; !ok {
+					// If not, create the "params" key with an empty map[interface{}]interface{}
+					agtConfigStorage.Jobs[i].Steps[0]["params"] = make(map[interface{}]interface{})
+				}
+				// Check if each job's step has a "config" field in params, if not add it
+				if _, ok := agtConfigStorage.Jobs[i].Steps[j]["params"].(map[interface{}]interface{})[StrConfig]; !ok {
+					agtConfigStorage.Jobs[i].Steps[j]["params"].(map[interface{}]interface{})[StrConfig] = make(map[interface{}]interface{})
+				}
+			}
+
+			// Add the global parameters to the configuration
+			for j := 0; j < len(agtConfigStorage.Jobs[i].Steps); j++ {
+				for k, v := range globalParams {
+					// Check if the params field has a k field
+					if _, ok := agtConfigStorage.Jobs[i].Steps[j]["params"]; !ok {
+						// If not, create the "params" key with an empty map[interface{}]interface{}
+						agtConfigStorage.Jobs[i].Steps[j]["params"] = make(map[interface{}]interface{})
+					}
+					// Ensure the type assertion works
+					if paramMap, ok := agtConfigStorage.Jobs[i].Steps[j]["params"].(map[interface{}]interface{}); ok {
+						// Convert globalParams into map[interface{}]interface{} before merging
+						paramMap[k] = v
+					} else {
+						// Handle unexpected types
+						cmn.DebugMsg(cmn.DbgLvlError, "params field is not of type map[interface{}]interface{}, but is %T", agtConfigStorage.Jobs[i].Steps[j]["params"])
+					}
 				}
 			}
 		}
 	}
 
-	return nil
+	// Normalize the steps and check their policies
+	if err := agtConfigStorage.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to load config file %s: %v", filePath, err)
+	}
+
+	return agtConfigStorage.Jobs, nil
 }
 
 // RegisterAgent registers an agent with the JobConfig
 func (jc *JobConfig) RegisterAgent(agent *JobConfig) {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
 	jc.Jobs = append(jc.Jobs, agent.Jobs...)
 }
 
+// RegisterUploadedAgent adds the jobs of an agent uploaded at runtime (for
+// example through the events service), replacing the jobs with the same
+// names. Unlike the agents loaded from the agents locations, they are kept
+// when the jobs are replaced by a reload.
+func (jc *JobConfig) RegisterUploadedAgent(agent *JobConfig) {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	if jc.uploaded == nil {
+		jc.uploaded = make(map[string]bool)
+	}
+	for _, job := range agent.Jobs {
+		jc.uploaded[job.Name] = true
+		jc.Jobs = slices.DeleteFunc(jc.Jobs, func(j Job) bool { return j.Name == job.Name })
+	}
+	jc.Jobs = append(jc.Jobs, agent.Jobs...)
+}
+
+// GetAllJobs returns the jobs of the JobConfig. The jobs can be replaced by
+// a reload, so the callers get a snapshot.
+func (jc *JobConfig) GetAllJobs() []Job {
+	if jc == nil {
+		return nil
+	}
+	jc.mu.RLock()
+	defer jc.mu.RUnlock()
+	return jc.Jobs
+}
+
 // GetAgentByName returns an agent by name
 func (jc *JobConfig) GetAgentByName(name string) (*JobConfig, bool) {
 	if jc == nil {
 		return nil, false
 	}
-	if len(jc.Jobs) == 0 {
+	jobs := jc.GetAllJobs()
+	if len(jobs) == 0 {
 		return nil, false
 	}
-	for i := 0; i < len(jc.Jobs); i++ {
-		if strings.TrimSpace(jc.Jobs[i].Name) == name {
+	for i := 0; i < len(jobs); i++ {
+		if strings.TrimSpace(jobs[i].Name) == name {
 			// Return the Job with the specified name inside a JobConfig struct
 			rjc := &JobConfig{}
-			rjc.Jobs = append(rjc.Jobs, jc.Jobs[i])
+			rjc.Jobs = append(rjc.Jobs, jobs[i])
 			return rjc, true
 		}
 	}
@@ -216,15 +271,16 @@ func (jc *JobConfig) GetAgentsByEventType(eventType string) ([]*JobConfig, bool)
 	if jc == nil {
 		return nil, false
 	}
-	if len(jc.Jobs) == 0 {
+	jobs := jc.GetAllJobs()
+	if len(jobs) == 0 {
 		return nil, false
 	}
 
 	var agents []*JobConfig
-	for i := 0; i < len(jc.Jobs); i++ {
-		if strings.ToLower(strings.TrimSpace(jc.Jobs[i].TriggerType)) == "event" && strings.TrimSpace(jc.Jobs[i].TriggerName) == eventType {
+	for i := 0; i < len(jobs); i++ {
+		if jobs[i].HasTrigger(TriggerEvent) && strings.TrimSpace(jobs[i].TriggerName) == eventType {
 			rjc := &JobConfig{}
-			rjc.Jobs = append(rjc.Jobs, jc.Jobs[i])
+			rjc.Jobs = append(rjc.Jobs, jobs[i])
 			agents = append(agents, rjc)
 		}
 	}
@@ -242,7 +298,9 @@ func (je *JobEngine) GetAgentsByEventType(eventType string) ([]*JobConfig, bool)
 	return AgentsRegistry.GetAgentsByEventType(eventType)
 }
 
-// ExecuteJobs executes all jobs in the configuration
+// ExecuteJobs executes all jobs in the configuration.
+// iCfg is merged in the config of the first step of each job, except for
+// its StrRequest entry (if any) which is the input of the first step.
 func (je *JobEngine) ExecuteJobs(j *JobConfig, iCfg map[string]interface{}) error {
 	// Create a waiting group for parallel group processing
 	var wg sync.WaitGroup
@@ -273,8 +331,18 @@ func (je *JobEngine) ExecuteJobs(j *JobConfig, iCfg map[string]interface{}) erro
 
 			// Merge iCfg into configMap
 			for k, v := range iCfg {
+				if k == StrRequest {
+					paramsMap[StrRequest] = v
+					continue
+				}
 				configMap[k] = v
 			}
+
+			// The config is passed from step to step, so all the steps
+			// of a read-only agent are read-only
+			if jobGroup.ReadOnly {
+				configMap[StrReadOnly] = true
+			}
 		}
 
 		// log the configuration for debugging purposes
@@ -286,17 +354,22 @@ func (je *JobEngine) ExecuteJobs(j *JobConfig, iCfg map[string]interface{}) erro
 			wg.Add(1)
 
 			// Execute the group in parallel
-			go func(jg []map[string]interface{}) {
+			go func(jg []map[string]interface{}, rec *runRecorder) {
 				defer wg.Done()
-				if err := executeJobGroup(je, jg); err != nil {
+				_, err := executeJobGroup(context.Background(), je, jg, rec)
+				rec.finish(err)
+				if err != nil {
 					cmn.DebugMsg(cmn.DbgLvlError, "Failed to execute job group '%s': %v", jobGroup.Name, err)
 				}
 				cmn.DebugMsg(cmn.DbgLvlDebug, "Job Group '%s' completed successfully", jobGroup.Name)
-			}(jobGroup.Steps)
+			}(jobGroup.Steps, newRunRecorder(jobGroup, iCfg))
 
 		} else {
 			// Execute the group serially
-			if err := executeJobGroup(je, jobGroup.Steps); err != nil {
+			rec := newRunRecorder(jobGroup, iCfg)
+			_, err := executeJobGroup(context.Background(), je, jobGroup.Steps, rec)
+			rec.finish(err)
+			if err != nil {
 				return fmt.Errorf("failed to execute job group '%s': %v", jobGroup.Name, err)
 			}
 			cmn.DebugMsg(cmn.DbgLvlDebug, "Job Group '%s' completed successfully", jobGroup.Name)
@@ -308,20 +381,32 @@ func (je *JobEngine) ExecuteJobs(j *JobConfig, iCfg map[string]interface{}) erro
 	return nil
 }
 
-// executeJobGroup runs jobs in a group serially
-func executeJobGroup(je *JobEngine, steps []map[string]interface{}) error {
+// executeJobGroup runs jobs in a group serially (and records them in rec).
+// It returns the result of the last step. No more steps are started once
+// ctx is done.
+func executeJobGroup(ctx context.Context, je *JobEngine, steps []map[string]interface{}, rec *runRecorder) (map[string]interface{}, error) {
 	lastResult := make(map[string]interface{})
 
+	// The steps running sub-pipelines record them in the same run
+	ctx = withRunRecorder(ctx, rec)
+
 	// Execute each job in the group
 	for i := 0; i < len(steps); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("job group canceled: %v", err)
+		}
 		step := steps[i]
 
 		// Get the action name
 		actionName, ok := step["action"].(string)
 		if !ok {
-			return fmt.Errorf("missing 'action' field in job step")
+			return nil, fmt.Errorf("missing 'action' field in job step")
 		}
 		params, _ := step["params"].(map[string]interface{})
+		if params == nil {
+			params = make(map[string]interface{})
+			step["params"] = params
+		}
 
 		// If we are to a step that is not the first one, we need to transform StrResponse (from previous step) to StrRequest
 		if i > 0 {
@@ -371,45 +456,46 @@ func executeJobGroup(je *JobEngine, steps []map[string]interface{}) error {
 
 		action, exists := je.actions[actionName]
 		if !exists {
-			return fmt.Errorf("unknown action: %s", actionName)
+			return nil, fmt.Errorf("unknown action: %s", actionName)
 		}
 
-		result, err := action.Execute(params)
+		policy, err := parseStepPolicy(step)
 		if err != nil {
-			if retryConfig, hasRetry := step["retry"].(RetryConfig); hasRetry {
-				result, err = executeWithRetry(action, params, retryConfig)
-			}
-			if err != nil {
-				if fallback, hasFallback := step["fallback"].([]map[string]interface{}); hasFallback {
-					cmn.DebugMsg(cmn.DbgLvlError, "Action %s failed, executing fallback steps", actionName)
-					return executeJobGroup(je, fallback)
+			return nil, fmt.Errorf("invalid policy for action %s: %v", actionName, err)
+		}
+
+		startedAt := time.Now()
+		result, attempts, err := executeStep(ctx, action, params, policy)
+		rec.step(actionName, params, result, startedAt, err, attempts, policy)
+		if err != nil {
+			if len(policy.Fallback) > 0 {
+				cmn.DebugMsg(cmn.DbgLvlError, "Action %s failed after %d attempt(s), executing fallback steps: %v", actionName, attempts, err)
+				// The fallback steps replace the rest of the job group, they
+				// get the input and the config of the failed step
+				config, _ := params[StrConfig].(map[string]interface{})
+				fallback := newPipeline(policy.Fallback, params[StrRequest], config)
+				fResult, fErr := executeJobGroup(ctx, je, fallback, rec)
+				if fErr == nil {
+					return fResult, nil
 				}
-				return fmt.Errorf("action %s failed: %v", actionName, err)
+				err = fmt.Errorf("fallback failed: %v", fErr)
+			}
+			if !policy.ContinueOnError {
+				return nil, fmt.Errorf("action %s failed: %v", actionName, err)
+			}
+			cmn.DebugMsg(cmn.DbgLvlError, "Action %s failed, continuing with the next step: %v", actionName, err)
+			// Pass the step input through to the next step
+			lastResult = map[string]interface{}{StrResponse: params[StrRequest]}
+			if config, ok := params[StrConfig].(map[string]interface{}); ok {
+				lastResult[StrConfig] = config
 			}
+			continue
 		}
 
 		// Update the result for the next job in the group
 		lastResult = result
 	}
-	return nil
-}
-
-// executeWithRetry executes an action with retry logic
-func executeWithRetry(action Action, params map[string]interface{}, retryConfig RetryConfig) (map[string]interface{}, error) {
-	var lastError error
-	var result map[string]interface{}
-
-	for attempt := 1; attempt <= retryConfig.MaxRetries; attempt++ {
-		result, lastError = action.Execute(params)
-		if lastError == nil {
-			return result, nil
-		}
-
-		delay := retryConfig.BaseDelay * time.Duration(math.Pow(retryConfig.Backoff, float64(attempt-1)))
-		time.Sleep(delay)
-	}
-
-	return nil, fmt.Errorf("action failed after %d retries: %w", retryConfig.MaxRetries, lastError)
+	return lastResult, nil
 }
 
 /*
@@ -0,0 +1,182 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package agent provides the agent functionality for the CROWler.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+
+	"github.com/qri-io/jsonschema"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// AgentsSchemaPath is the path of the JSON schema used to validate the agents definitions
+	AgentsSchemaPath = "./schemas/crowler-agent-schema.json"
+
+	agentsSchemaLock sync.Mutex
+	agentsSchema     *jsonschema.Schema
+	agentsSchemaFrom string
+)
+
+// loadAgentsSchema returns the agents JSON schema (loaded once per path).
+// It returns nil if the schema file is not available.
+func loadAgentsSchema() (*jsonschema.Schema, error) {
+	agentsSchemaLock.Lock()
+	defer agentsSchemaLock.Unlock()
+
+	if agentsSchema != nil && agentsSchemaFrom == AgentsSchemaPath {
+		return agentsSchema, nil
+	}
+
+	schemaData, err := os.ReadFile(AgentsSchemaPath) //nolint:gosec // The path here is handled by the service not an end-user
+	if os.IsNotExist(err) {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Agents schema '%s' not found, skipping schema validation", AgentsSchemaPath)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agents schema: %v", err)
+	}
+
+	schema := &jsonschema.Schema{}
+	if err := schema.UnmarshalJSON(schemaData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal agents schema: %v", err)
+	}
+	agentsSchema = schema
+	agentsSchemaFrom = AgentsSchemaPath
+	return schema, nil
+}
+
+// ValidateAgentDefinition validates an agents definition file (YAML or
+// JSON, see fileType) against the agents JSON schema.
+func ValidateAgentDefinition(data []byte, fileType string) error {
+	schema, err := loadAgentsSchema()
+	if err != nil || schema == nil {
+		return err
+	}
+
+	var agentData interface{}
+	if fileType == "json" {
+		if err := json.Unmarshal(data, &agentData); err != nil {
+			return fmt.Errorf("problems unmarshalling JSON: %v", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &agentData); err != nil {
+			return fmt.Errorf("problems unmarshalling YAML: %v", err)
+		}
+		agentData = cmn.ConvertInterfaceMapToStringMap(agentData)
+	}
+
+	jsonBytes, err := json.Marshal(agentData)
+	if err != nil {
+		return fmt.Errorf("problems marshalling to JSON: %v", err)
+	}
+
+	errors, err := schema.ValidateBytes(context.Background(), jsonBytes)
+	if err != nil {
+		return err
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("validation failed: %v", errors)
+	}
+	return nil
+}
+
+// Validate normalizes the steps of all the jobs and checks their policies
+func (jc *JobConfig) Validate() error {
+	if jc == nil {
+		return nil
+	}
+	for i := 0; i < len(jc.Jobs); i++ {
+		if err := jc.Jobs[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate normalizes the job steps (YAML generic maps are converted to
+// map[string]interface{}) and checks their actions and policies, so that
+// invalid steps are reported when the job is loaded instead of when it runs.
+func (j *Job) Validate() error {
+	steps, err := normalizeSteps(j.Steps)
+	if err != nil {
+		return fmt.Errorf("invalid agent '%s': %v", j.Name, err)
+	}
+	j.Steps = steps
+	return nil
+}
+
+// normalizeSteps converts and checks a list of steps (and their fallback steps)
+func normalizeSteps(steps []map[string]interface{}) ([]map[string]interface{}, error) {
+	for i, step := range steps {
+		for k, v := range step {
+			step[k] = cmn.ConvertMapIIToSI(v)
+		}
+
+		actionName, ok := step["action"].(string)
+		if !ok || actionName == "" {
+			return nil, fmt.Errorf("missing 'action' field in step %d", i)
+		}
+		params, ok := step["params"].(map[string]interface{})
+		if !ok {
+			if step["params"] != nil {
+				return nil, fmt.Errorf("'params' of step %d (%s) must be an object", i, actionName)
+			}
+			params = make(map[string]interface{})
+			step["params"] = params
+		}
+
+		// ForEach and Parallel steps contain sub-pipelines
+		nested, err := nestedSteps(actionName, params)
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %v", i, actionName, err)
+		}
+		for name, steps := range nested {
+			normalized, err := normalizeSteps(steps)
+			if err != nil {
+				return nil, fmt.Errorf("%s of step %d (%s): %v", name, i, actionName, err)
+			}
+			if name == StrSteps {
+				params[StrSteps] = normalized
+			} else {
+				branches, _ := params[StrBranches].(map[string]interface{})
+				if branches == nil {
+					continue
+				}
+				branches[name] = normalized
+			}
+		}
+
+		policy, err := parseStepPolicy(step)
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %v", i, actionName, err)
+		}
+		if len(policy.Fallback) > 0 {
+			fallback, err := normalizeSteps(policy.Fallback)
+			if err != nil {
+				return nil, fmt.Errorf("fallback of step %d (%s): %v", i, actionName, err)
+			}
+			step["fallback"] = fallback
+		}
+	}
+	return steps, nil
+}
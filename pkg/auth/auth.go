@@ -0,0 +1,316 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auth implements the API keys authentication used by the CROWler
+// API and Events services.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrMissingKey is returned when a request doesn't carry an API key
+	ErrMissingKey = errors.New("missing API key")
+	// ErrInvalidKey is returned when an API key is unknown, revoked or expired
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrInsufficientScope is returned when an API key doesn't grant the required scope
+	ErrInsufficientScope = errors.New("API key scope does not allow this request")
+
+	scopeLevels = map[string]int{
+		ScopeSearch:  1,
+		ScopeConsole: 2,
+		ScopeAdmin:   3,
+	}
+)
+
+// NewAuthenticator returns a new Authenticator for the given configuration.
+// defaultRateLimit is used for keys that don't define their own rate limit
+// when the configuration doesn't define a per-key default either.
+func NewAuthenticator(conf cfg.APIAuth, defaultRateLimit string, db *cdb.Handler) *Authenticator {
+	a := &Authenticator{}
+	a.Configure(conf, defaultRateLimit, db)
+	return a
+}
+
+// Configure (re)applies the configuration to the Authenticator and clears
+// its keys cache and rate limiters. defaultRateLimit is also the per-client
+// (IP) rate limit applied by ClientMiddleware before the keys are checked.
+func (a *Authenticator) Configure(conf cfg.APIAuth, defaultRateLimit string, db *cdb.Handler) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.enabled = conf.Enabled
+	a.adminKeyHash = ""
+	if strings.TrimSpace(conf.AdminKey) != "" {
+		a.adminKeyHash = HashKey(strings.TrimSpace(conf.AdminKey))
+	}
+	a.clientLimit = strings.TrimSpace(defaultRateLimit)
+	if a.clientLimit == "" {
+		a.clientLimit = DefaultRateLimit
+	}
+	a.rateLimit = strings.TrimSpace(conf.RateLimit)
+	if a.rateLimit == "" {
+		a.rateLimit = a.clientLimit
+	}
+	a.cacheTTL = time.Duration(conf.CacheTTL) * time.Second
+	if a.cacheTTL <= 0 {
+		a.cacheTTL = DefaultCacheTTL
+	}
+	a.keys = cmn.NewLRUCache[string, *cdb.APIKey](MaxCachedKeys, a.cacheTTL)
+	a.limiters = cmn.NewLRUCache[string, *rate.Limiter](MaxCachedKeys, 0)
+	a.clients = cmn.NewLRUCache[string, *rate.Limiter](MaxClientLimiters, 0)
+	a.Lookup = func(keyHash string) (*cdb.APIKey, error) {
+		if db == nil || *db == nil {
+			return nil, nil
+		}
+		return cdb.GetAPIKeyByHash(db, keyHash)
+	}
+}
+
+// Enabled returns true if requests must carry a valid API key
+func (a *Authenticator) Enabled() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.enabled
+}
+
+// ClientMiddleware returns an http.Handler that rate limits the requests
+// per client IP, before their API key is checked (so requests with invalid
+// keys can't flood the keys lookup). If authentication is disabled, every
+// request is let through.
+func (a *Authenticator) ClientMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.Enabled() && !a.ClientLimiter(ClientIP(r)).Allow() {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Rate limited request to %s from %s", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware returns an http.Handler that only lets through requests
+// carrying a valid API key with (at least) the given scope. The key is
+// stored in the request context (see KeyFromContext).
+// If authentication is disabled, every request is let through.
+func (a *Authenticator) Middleware(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := a.Authenticate(r, scope)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, ErrInsufficientScope) {
+				status = http.StatusForbidden
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="CROWler"`)
+			}
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Rejected request to %s from %s: %v", r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, key)))
+	})
+}
+
+// Authenticate returns the API key of the request if it's valid and grants
+// (at least) the given scope.
+func (a *Authenticator) Authenticate(r *http.Request, scope string) (*cdb.APIKey, error) {
+	plainKey := ExtractKey(r)
+	if plainKey == "" {
+		return nil, ErrMissingKey
+	}
+	key, err := a.lookup(HashKey(plainKey))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || !key.Active || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return nil, ErrInvalidKey
+	}
+	if !HasScope(key.Scope, scope) {
+		return nil, ErrInsufficientScope
+	}
+	return key, nil
+}
+
+// lookup returns the key with the given hash, using the cache when possible
+func (a *Authenticator) lookup(keyHash string) (*cdb.APIKey, error) {
+	a.mutex.Lock()
+	if a.adminKeyHash != "" && subtle.ConstantTimeCompare([]byte(keyHash), []byte(a.adminKeyHash)) == 1 {
+		a.mutex.Unlock()
+		return &cdb.APIKey{Name: "admin_key", Prefix: "config", Scope: ScopeAdmin, Active: true}, nil
+	}
+	keys := a.keys
+	lookup := a.Lookup
+	a.mutex.Unlock()
+
+	if key, ok := keys.Get(keyHash); ok {
+		return key, nil
+	}
+	key, err := lookup(keyHash)
+	if err != nil || key == nil {
+		// Don't cache errors (the DB may be temporarily unavailable) and
+		// unknown keys (random keys would fill the cache)
+		return nil, err
+	}
+	keys.Add(keyHash, key)
+	return key, nil
+}
+
+// Limiter returns the rate limiter of an API key
+func (a *Authenticator) Limiter(key *cdb.APIKey) *rate.Limiter {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	id := key.Prefix + ":" + strconv.FormatUint(key.ID, 10)
+	rateLimit := key.RateLimit
+	if strings.TrimSpace(rateLimit) == "" {
+		rateLimit = a.rateLimit
+	}
+	return a.limiters.GetOrAdd(id, func() *rate.Limiter {
+		return rate.NewLimiter(ParseRateLimit(rateLimit))
+	})
+}
+
+// ClientLimiter returns the rate limiter of a client IP
+func (a *Authenticator) ClientLimiter(ip string) *rate.Limiter {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	clientLimit := a.clientLimit
+	return a.clients.GetOrAdd(ip, func() *rate.Limiter {
+		return rate.NewLimiter(ParseRateLimit(clientLimit))
+	})
+}
+
+// ClientIP returns the IP of the client of a request
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// Forget removes a key from the cache (for ex. after it has been revoked)
+func (a *Authenticator) Forget(keyHash string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.keys.Remove(keyHash)
+}
+
+// Flush empties the keys cache
+func (a *Authenticator) Flush() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.keys.Purge()
+}
+
+// KeyFromContext returns the API key stored in a request context by the
+// Authenticator middleware.
+func KeyFromContext(ctx context.Context) (*cdb.APIKey, bool) {
+	key, ok := ctx.Value(contextKey{}).(*cdb.APIKey)
+	return key, ok && key != nil
+}
+
+// ExtractKey returns the API key of a request (from the X-API-Key header
+// or from an "Authorization: Bearer" header).
+func ExtractKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get(HeaderAPIKey)); key != "" {
+		return key
+	}
+	authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "bearer ") {
+		return strings.TrimSpace(authHeader[7:])
+	}
+	return ""
+}
+
+// GenerateKey returns a new random API key and its SHA256
+func GenerateKey() (string, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	key := KeyPrefix + hex.EncodeToString(buf)
+	return key, HashKey(key), nil
+}
+
+// KeyDisplayPrefix returns the part of a key that can be safely stored and
+// displayed to identify it
+func KeyDisplayPrefix(key string) string {
+	if len(key) > 12 {
+		return key[:12]
+	}
+	return key
+}
+
+// HashKey returns the SHA256 of an API key
+func HashKey(key string) string {
+	return cmn.GenerateSHA256(key)
+}
+
+// IsValidScope returns true if scope is a known scope
+func IsValidScope(scope string) bool {
+	_, ok := scopeLevels[scope]
+	return ok
+}
+
+// HasScope returns true if the granted scope includes the required one
+// (admin includes console, which includes search).
+func HasScope(granted, required string) bool {
+	g, ok := scopeLevels[strings.ToLower(strings.TrimSpace(granted))]
+	if !ok {
+		return false
+	}
+	return g >= scopeLevels[required]
+}
+
+// ParseRateLimit parses a rate limit tuple (for ex. "1,3" means 1 request
+// per second with a burst of 3 requests). Missing or invalid values
+// default to 10.
+func ParseRateLimit(value string) (rate.Limit, int) {
+	rl, bl := 10, 10
+	parts := strings.SplitN(strings.TrimSpace(value), ",", 2)
+	if n, err := strconv.Atoi(strings.TrimSpace(parts[0])); err == nil && n > 0 {
+		rl = n
+	}
+	if len(parts) > 1 {
+		if n, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil && n > 0 {
+			bl = n
+		}
+	}
+	return rate.Limit(rl), bl
+}
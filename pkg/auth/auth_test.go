@@ -0,0 +1,233 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+func newTestAuthenticator(t *testing.T, keys map[string]*cdb.APIKey) (*Authenticator, *int) {
+	t.Helper()
+	lookups := 0
+	a := NewAuthenticator(cfg.APIAuth{Enabled: true, AdminKey: "bootstrap-admin", CacheTTL: 60}, "", nil)
+	a.Lookup = func(keyHash string) (*cdb.APIKey, error) {
+		lookups++
+		for plain, key := range keys {
+			if HashKey(plain) == keyHash {
+				return key, nil
+			}
+		}
+		return nil, nil
+	}
+	return a, &lookups
+}
+
+func TestMiddleware(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	keys := map[string]*cdb.APIKey{
+		"search-key":  {ID: 1, Scope: ScopeSearch, Active: true},
+		"console-key": {ID: 2, Scope: ScopeConsole, Active: true},
+		"revoked-key": {ID: 3, Scope: ScopeAdmin, Active: false},
+		"expired-key": {ID: 4, Scope: ScopeAdmin, Active: true, ExpiresAt: &expired},
+	}
+	a, _ := newTestAuthenticator(t, keys)
+
+	handler := a.Middleware(ScopeConsole, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := KeyFromContext(r.Context()); !ok {
+			t.Errorf("expected the API key in the request context")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"no key", "", "", http.StatusUnauthorized},
+		{"unknown key", HeaderAPIKey, "unknown", http.StatusUnauthorized},
+		{"insufficient scope", HeaderAPIKey, "search-key", http.StatusForbidden},
+		{"console key", HeaderAPIKey, "console-key", http.StatusOK},
+		{"bearer token", "Authorization", "Bearer console-key", http.StatusOK},
+		{"revoked key", HeaderAPIKey, "revoked-key", http.StatusUnauthorized},
+		{"expired key", HeaderAPIKey, "expired-key", http.StatusUnauthorized},
+		{"bootstrap admin key", HeaderAPIKey, "bootstrap-admin", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/source/add", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	a := NewAuthenticator(cfg.APIAuth{Enabled: false}, "", nil)
+	handler := a.Middleware(ScopeAdmin, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/search/general?q=test", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected requests to pass through when authentication is disabled, got %d", rec.Code)
+	}
+}
+
+func TestLookupCache(t *testing.T) {
+	a, lookups := newTestAuthenticator(t, map[string]*cdb.APIKey{"search-key": {ID: 1, Scope: ScopeSearch, Active: true}})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAPIKey, "search-key")
+		if _, err := a.Authenticate(req, ScopeSearch); err != nil {
+			t.Fatalf("Authenticate() returned an error: %v", err)
+		}
+	}
+	if *lookups != 1 {
+		t.Errorf("expected 1 lookup, got %d", *lookups)
+	}
+
+	a.Forget(HashKey("search-key"))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderAPIKey, "search-key")
+	if _, err := a.Authenticate(req, ScopeSearch); err != nil {
+		t.Fatalf("Authenticate() returned an error: %v", err)
+	}
+	if *lookups != 2 {
+		t.Errorf("expected 2 lookups after Forget(), got %d", *lookups)
+	}
+}
+
+func TestLookupMissesNotCached(t *testing.T) {
+	a, lookups := newTestAuthenticator(t, nil)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAPIKey, "unknown-key")
+		if _, err := a.Authenticate(req, ScopeSearch); err == nil {
+			t.Fatalf("Authenticate() of an unknown key didn't return an error")
+		}
+	}
+	if *lookups != 3 {
+		t.Errorf("expected 3 lookups for an unknown key, got %d", *lookups)
+	}
+}
+
+func TestClientMiddleware(t *testing.T) {
+	a := NewAuthenticator(cfg.APIAuth{Enabled: true}, "1,1", nil)
+	handler := a.ClientMiddleware(a.Middleware(ScopeSearch, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"10.0.0.1:1234", http.StatusUnauthorized},
+		{"10.0.0.1:5678", http.StatusTooManyRequests},
+		{"10.0.0.2:1234", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/search/general?q=test", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set(HeaderAPIKey, "unknown-key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("request from %s: got status %d, want %d", tt.remoteAddr, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	a := NewAuthenticator(cfg.APIAuth{Enabled: true, RateLimit: "1,1"}, "", nil)
+	key := &cdb.APIKey{ID: 1, Scope: ScopeSearch, Active: true}
+	if !a.Limiter(key).Allow() {
+		t.Errorf("expected the first request to be allowed")
+	}
+	if a.Limiter(key).Allow() {
+		t.Errorf("expected the second request to exceed the rate limit")
+	}
+
+	other := &cdb.APIKey{ID: 2, Scope: ScopeSearch, Active: true, RateLimit: "5,5"}
+	if got := a.Limiter(other).Burst(); got != 5 {
+		t.Errorf("expected the per-key burst to be 5, got %d", got)
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, hash, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() returned an error: %v", err)
+	}
+	if !strings.HasPrefix(key, KeyPrefix) || len(key) != len(KeyPrefix)+48 {
+		t.Errorf("unexpected key format: %s", key)
+	}
+	if hash != HashKey(key) || len(hash) != 64 {
+		t.Errorf("unexpected key hash: %s", hash)
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		granted, required string
+		want              bool
+	}{
+		{ScopeAdmin, ScopeSearch, true},
+		{ScopeConsole, ScopeSearch, true},
+		{ScopeSearch, ScopeConsole, false},
+		{ScopeConsole, ScopeAdmin, false},
+		{"unknown", ScopeSearch, false},
+	}
+	for _, tt := range tests {
+		if got := HasScope(tt.granted, tt.required); got != tt.want {
+			t.Errorf("HasScope(%q, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		rl    float64
+		bl    int
+	}{
+		{"1,3", 1, 3},
+		{"5", 5, 10},
+		{"", 10, 10},
+		{"x,y", 10, 10},
+	}
+	for _, tt := range tests {
+		rl, bl := ParseRateLimit(tt.value)
+		if float64(rl) != tt.rl || bl != tt.bl {
+			t.Errorf("ParseRateLimit(%q) = %v, %d, want %v, %d", tt.value, rl, bl, tt.rl, tt.bl)
+		}
+	}
+}
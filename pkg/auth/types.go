@@ -0,0 +1,73 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auth implements the API keys authentication used by the CROWler
+// API and Events services.
+package auth
+
+import (
+	"sync"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// ScopeSearch allows access to the search end-points only
+	ScopeSearch = "search"
+	// ScopeConsole allows access to the search and console (sources, owners, categories, uploads) end-points
+	ScopeConsole = "console"
+	// ScopeAdmin allows access to every end-point, including the API keys management
+	ScopeAdmin = "admin"
+
+	// KeyPrefix is the prefix of every API key generated by the CROWler
+	KeyPrefix = "crw_"
+	// HeaderAPIKey is the header that can be used to pass an API key
+	// (alternatively use "Authorization: Bearer <key>")
+	HeaderAPIKey = "X-API-Key"
+
+	// DefaultCacheTTL is the default amount of time a validated key is cached
+	DefaultCacheTTL = 60 * time.Second
+	// DefaultRateLimit is the per-key rate limit used when none is configured
+	DefaultRateLimit = "10,10"
+	// MaxCachedKeys is the maximum number of validated keys (and of per-key
+	// rate limiters) kept in memory, the least recently used are evicted
+	MaxCachedKeys = 10000
+	// MaxClientLimiters is the maximum number of per-client (IP) rate
+	// limiters kept in memory, the least recently used are evicted
+	MaxClientLimiters = 10000
+)
+
+// Authenticator validates the API keys of incoming requests and keeps
+// a rate limiter per key.
+type Authenticator struct {
+	mutex        sync.Mutex
+	enabled      bool
+	adminKeyHash string
+	rateLimit    string
+	clientLimit  string
+	cacheTTL     time.Duration
+	keys         *cmn.LRUCache[string, *cdb.APIKey]   // validated keys by key hash (unknown keys are never cached)
+	limiters     *cmn.LRUCache[string, *rate.Limiter] // per-key rate limiters by key ID
+	clients      *cmn.LRUCache[string, *rate.Limiter] // per-client rate limiters by IP
+	// Lookup is the function used to retrieve a key by its hash (nil, nil
+	// means the key doesn't exist), it can be replaced for testing
+	Lookup func(keyHash string) (*cdb.APIKey, error)
+}
+
+// contextKey is the type of the request context key holding the API key
+type contextKey struct{}
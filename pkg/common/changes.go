@@ -0,0 +1,72 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Changes describes the differences between two sets of named items (for
+// example the rulesets before and after a reload)
+type Changes struct {
+	Added   []string `json:"added" yaml:"added"`
+	Removed []string `json:"removed" yaml:"removed"`
+	Changed []string `json:"changed" yaml:"changed"`
+}
+
+// IsEmpty returns true if nothing was added, removed or changed
+func (c Changes) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// String returns a short summary of the changes
+func (c Changes) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d changed", len(c.Added), len(c.Removed), len(c.Changed))
+}
+
+// Fingerprint returns the SHA256 of the JSON representation of an item, to
+// find out if it changed
+func Fingerprint(item interface{}) string {
+	data, err := json.Marshal(item)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%#v", item))
+	}
+	return GenerateSHA256(string(data))
+}
+
+// DiffFingerprints returns the changes between two sets of items, given as
+// maps of names to fingerprints. The names in the changes are sorted.
+func DiffFingerprints(before, after map[string]string) Changes {
+	changes := Changes{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for name, fp := range after {
+		previous, exists := before[name]
+		if !exists {
+			changes.Added = append(changes.Added, name)
+		} else if previous != fp {
+			changes.Changed = append(changes.Changed, name)
+		}
+	}
+	for name := range before {
+		if _, exists := after[name]; !exists {
+			changes.Removed = append(changes.Removed, name)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+	return changes
+}
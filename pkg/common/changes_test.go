@@ -0,0 +1,40 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffFingerprints(t *testing.T) {
+	before := map[string]string{"a": "1", "b": "2", "c": "3"}
+	after := map[string]string{"a": "1", "b": "20", "d": "4", "e": "5"}
+
+	changes := DiffFingerprints(before, after)
+	expected := Changes{Added: []string{"d", "e"}, Removed: []string{"c"}, Changed: []string{"b"}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("DiffFingerprints() = %+v, expected %+v", changes, expected)
+	}
+	if changes.IsEmpty() {
+		t.Errorf("IsEmpty() = true, expected false")
+	}
+
+	if changes := DiffFingerprints(before, before); !changes.IsEmpty() {
+		t.Errorf("DiffFingerprints() of the same items = %+v, expected no changes", changes)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	type item struct {
+		Name  string
+		Value map[string]interface{}
+	}
+	a := item{Name: "a", Value: map[string]interface{}{"x": 1, "y": []string{"z"}}}
+	b := item{Name: "a", Value: map[string]interface{}{"y": []string{"z"}, "x": 1}}
+	if Fingerprint(a) != Fingerprint(b) {
+		t.Errorf("Fingerprint() of equal items differ")
+	}
+	b.Value["x"] = 2
+	if Fingerprint(a) == Fingerprint(b) {
+		t.Errorf("Fingerprint() of different items are equal")
+	}
+}
@@ -16,6 +16,7 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -54,6 +55,12 @@ type APIResponse struct {
 
 // GenericAPIRequest is a generic API request. (it uses passed params to determine the request)
 func GenericAPIRequest(params map[string]string) (string, error) {
+	return GenericAPIRequestWithContext(context.Background(), params)
+}
+
+// GenericAPIRequestWithContext is like GenericAPIRequest, but the request is
+// canceled when ctx is done.
+func GenericAPIRequestWithContext(ctx context.Context, params map[string]string) (string, error) {
 	// Prepare the API request
 	var response string
 
@@ -87,7 +94,7 @@ func GenericAPIRequest(params map[string]string) (string, error) {
 	}
 
 	// Create the request
-	req, err := http.NewRequest(method, params["url"], body)
+	req, err := http.NewRequestWithContext(ctx, method, params["url"], body)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %v", err)
 	}
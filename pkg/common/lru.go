@@ -0,0 +1,144 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package common package is used to store common functions and variables
+package common
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRUCache is a thread-safe cache holding at most a fixed number of
+// entries: when it's full, adding an entry evicts the least recently used
+// one. If the TTL is > 0, the entries also expire TTL after they are added.
+type LRUCache[K comparable, V any] struct {
+	mutex    sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[K]*list.Element
+	order    *list.List // Front is the most recently used entry
+}
+
+// lruEntry is an entry of an LRUCache
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// NewLRUCache returns a new LRUCache holding at most capacity entries
+// (at least 1) that expire after ttl (never if ttl <= 0)
+func NewLRUCache[K comparable, V any](capacity int, ttl time.Duration) *LRUCache[K, V] {
+	return &LRUCache[K, V]{
+		capacity: max(capacity, 1),
+		ttl:      ttl,
+		entries:  make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value of a key, false if the key is missing or expired
+func (c *LRUCache[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var zero V
+	element, exists := c.entries[key]
+	if !exists {
+		return zero, false
+	}
+	entry := element.Value.(*lruEntry[K, V])
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Add adds (or replaces) the value of a key, evicting the least recently
+// used entry if the cache is full
+func (c *LRUCache[K, V]) Add(key K, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+	if element, exists := c.entries[key]; exists {
+		entry := element.Value.(*lruEntry[K, V])
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expires: expires})
+}
+
+// GetOrAdd returns the value of a key, if the key is missing (or expired)
+// it adds the value returned by create and returns it
+func (c *LRUCache[K, V]) GetOrAdd(key K, create func() V) V {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	c.mutex.Lock()
+	if element, exists := c.entries[key]; exists {
+		// Added by another goroutine in the meantime
+		entry := element.Value.(*lruEntry[K, V])
+		if c.ttl <= 0 || time.Now().Before(entry.expires) {
+			c.order.MoveToFront(element)
+			c.mutex.Unlock()
+			return entry.value
+		}
+	}
+	c.mutex.Unlock()
+	value := create()
+	c.Add(key, value)
+	return value
+}
+
+// Remove removes a key from the cache
+func (c *LRUCache[K, V]) Remove(key K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, exists := c.entries[key]; exists {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Purge removes all the entries of the cache
+func (c *LRUCache[K, V]) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[K]*list.Element)
+	c.order.Init()
+}
+
+// Len returns the number of entries in the cache (expired ones included,
+// until they are looked up or evicted)
+func (c *LRUCache[K, V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
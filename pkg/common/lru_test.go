@@ -0,0 +1,59 @@
+// Package common package is used to store common functions and variables
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	cache := NewLRUCache[string, int](2, 0)
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+	if _, ok := cache.Get("a"); !ok { // "a" is now the most recently used
+		t.Fatalf("expected 'a' in the cache")
+	}
+	cache.Add("c", 3)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("expected 'b' (least recently used) to be evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if got, ok := cache.Get(key); !ok || got != want {
+			t.Errorf("Get(%q) = %d, %v, want %d, true", key, got, ok, want)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+
+	cache.Remove("a")
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("expected 'a' to be removed")
+	}
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d after Purge(), want 0", cache.Len())
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	cache := NewLRUCache[string, int](10, 20*time.Millisecond)
+	cache.Add("a", 1)
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatalf("expected 'a' in the cache")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("expected 'a' to be expired")
+	}
+
+	calls := 0
+	create := func() int { calls++; return 2 }
+	if got := cache.GetOrAdd("b", create); got != 2 {
+		t.Errorf("GetOrAdd() = %d, want 2", got)
+	}
+	if got := cache.GetOrAdd("b", create); got != 2 || calls != 1 {
+		t.Errorf("GetOrAdd() = %d with %d calls, want 2 with 1 call", got, calls)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package common package is used to store common functions and variables
+package common
+
+import (
+	"strconv"
+	"strings"
+)
+
+// versionComponents splits a version in its components (e.g. "1.2.0-beta"
+// becomes ["1", "2", "0", "beta"])
+func versionComponents(version string) []string {
+	version = strings.ToLower(strings.TrimSpace(version))
+	version = strings.TrimPrefix(version, "v")
+	return strings.FieldsFunc(version, func(r rune) bool {
+		return r == '.' || r == '-' || r == '_' || r == '+'
+	})
+}
+
+// CompareVersions compares two versions component by component (numerically
+// when both components are numbers). It returns -1 if a < b, 0 if a == b and
+// 1 if a > b. A missing component counts as 0, unless the other one isn't a
+// number (so "1.0-beta" < "1.0").
+func CompareVersions(a, b string) int {
+	ac := versionComponents(a)
+	bc := versionComponents(b)
+	for i := 0; i < len(ac) || i < len(bc); i++ {
+		var x, y string
+		if i < len(ac) {
+			x = ac[i]
+		}
+		if i < len(bc) {
+			y = bc[i]
+		}
+		if c := compareVersionComponents(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareVersionComponents(x, y string) int {
+	xn, xErr := strconv.Atoi(x)
+	yn, yErr := strconv.Atoi(y)
+	switch {
+	case x == y:
+		return 0
+	case x == "" && yErr != nil:
+		// Release vs pre-release (e.g. "1.0" vs "1.0-beta")
+		return 1
+	case y == "" && xErr != nil:
+		return -1
+	case x == "":
+		xn, xErr = 0, nil
+	case y == "":
+		yn, yErr = 0, nil
+	}
+
+	switch {
+	case xErr == nil && yErr == nil:
+		if xn < yn {
+			return -1
+		} else if xn > yn {
+			return 1
+		}
+		return 0
+	case xErr == nil:
+		// Numbers come after the pre-release names
+		return 1
+	case yErr == nil:
+		return -1
+	}
+	return strings.Compare(x, y)
+}
+
+// VersionHasPrefix returns true if version starts with all the components of
+// prefix (e.g. "6.4.2" has prefix "6.4", but not "6.42")
+func VersionHasPrefix(version, prefix string) bool {
+	vc := versionComponents(version)
+	pc := versionComponents(prefix)
+	if len(pc) == 0 || len(pc) > len(vc) {
+		return false
+	}
+	for i := range pc {
+		if compareVersionComponents(vc[i], pc[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// VersionSpecificity returns the number of components of a version
+func VersionSpecificity(version string) int {
+	return len(versionComponents(version))
+}
+
+// MatchVersionConstraint returns true if version satisfies a constraint
+// like "6.4.2", "6.4" (any 6.4.x), "<6.4.3", "<=6.4", ">5", ">=5.0" or
+// "!=6.4.2". Multiple constraints separated by commas must all be satisfied
+// (e.g. ">=5.0,<6.4.3").
+func MatchVersionConstraint(version, constraint string) bool {
+	if strings.TrimSpace(version) == "" {
+		return false
+	}
+	for _, c := range strings.Split(constraint, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		op := strings.TrimRight(c[:min(2, len(c))], "0123456789vV. ")
+		ref := strings.TrimSpace(c[len(op):])
+		var ok bool
+		switch op {
+		case "<":
+			ok = CompareVersions(version, ref) < 0
+		case "<=":
+			ok = CompareVersions(version, ref) <= 0
+		case ">":
+			ok = CompareVersions(version, ref) > 0
+		case ">=":
+			ok = CompareVersions(version, ref) >= 0
+		case "!=":
+			ok = CompareVersions(version, ref) != 0 && !VersionHasPrefix(version, ref)
+		case "=", "==", "":
+			ok = CompareVersions(version, ref) == 0 || VersionHasPrefix(version, ref)
+		default:
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package common
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.10", "1.9", 1},
+		{"6.4.2", "6.4.3", -1},
+		{"1.0-beta", "1.0", -1},
+		{"1.0-alpha", "1.0-beta", -1},
+		{"1.0.1", "1.0-rc1", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.expected {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestVersionHasPrefix(t *testing.T) {
+	tests := []struct {
+		version, prefix string
+		expected        bool
+	}{
+		{"6.4.2", "6.4", true},
+		{"6.4.2", "6", true},
+		{"6.42", "6.4", false},
+		{"6.4", "6.4.2", false},
+		{"6.4", "", false},
+	}
+	for _, tt := range tests {
+		if got := VersionHasPrefix(tt.version, tt.prefix); got != tt.expected {
+			t.Errorf("VersionHasPrefix(%q, %q) = %v, expected %v", tt.version, tt.prefix, got, tt.expected)
+		}
+	}
+}
+
+func TestMatchVersionConstraint(t *testing.T) {
+	tests := []struct {
+		version, constraint string
+		expected            bool
+	}{
+		{"6.4.2", "6.4.2", true},
+		{"6.4.2", "6.4", true},
+		{"6.4.2", "6.3", false},
+		{"6.4.2", "<6.4.3", true},
+		{"6.4.3", "<6.4.3", false},
+		{"6.4", "<=6.4.0", true},
+		{"5.9", ">5", true},
+		{"5.0", ">=5.0,<6", true},
+		{"6.1", ">=5.0,<6", false},
+		{"6.4.2", "!=6.4", false},
+		{"6.5", "!=6.4", true},
+		{"6.5", "~6", false},
+		{"", ">1", false},
+	}
+	for _, tt := range tests {
+		if got := MatchVersionConstraint(tt.version, tt.constraint); got != tt.expected {
+			t.Errorf("MatchVersionConstraint(%q, %q) = %v, expected %v", tt.version, tt.constraint, got, tt.expected)
+		}
+	}
+}
@@ -219,6 +219,12 @@ func NewConfig() *Config {
 			ScreenshotMaxHeight:   0,
 			ScreenshotSectionWait: 2,
 			CheckForRobots:        false,
+			RobotsUserAgent:       "CROWler",
+			SitemapMode:           "links",
+			PersistentFrontier:    false,
+			ConditionalRecrawl:    false,
+			CollectWARC:           false,
+			CollectHAR:            false,
 			Control: ControlConfig{
 				Host:              cmn.LoalhostStr,
 				Port:              8081,
@@ -244,6 +250,10 @@ func NewConfig() *Config {
 			ReadHeaderTimeout: 15,
 			ReadTimeout:       15,
 			WriteTimeout:      30,
+			Auth: APIAuth{
+				Enabled:  false,
+				CacheTTL: 60,
+			},
 		},
 		Selenium: []Selenium{
 			{
@@ -286,6 +296,10 @@ func NewConfig() *Config {
 			ReadHeaderTimeout: 15,
 			ReadTimeout:       15,
 			WriteTimeout:      30,
+			Auth: APIAuth{
+				Enabled:  false,
+				CacheTTL: 60,
+			},
 		},
 		ImageStorageAPI: FileStorageAPI{
 			Host:    "",
@@ -337,6 +351,8 @@ func NewConfig() *Config {
 				Enabled:   true,
 				Timeout:   10,
 				RateLimit: "1",
+				Servers:   []string{},
+				Transport: "udp",
 			},
 			WHOIS: WHOISConfig{
 				Enabled:   true,
@@ -636,6 +652,8 @@ func (c *Config) validateCrawler() {
 	c.setDefaultMaxRetries()
 	c.setDefaultMaxRedirects()
 	c.setDefaultResetCookiesPolicy()
+	c.setDefaultRobotsUserAgent()
+	c.setDefaultSitemapMode()
 	c.setDefaultControl()
 }
 
@@ -785,6 +803,24 @@ func (c *Config) setDefaultResetCookiesPolicy() {
 	}
 }
 
+func (c *Config) setDefaultRobotsUserAgent() {
+	if strings.TrimSpace(c.Crawler.RobotsUserAgent) == "" {
+		c.Crawler.RobotsUserAgent = "CROWler"
+	} else {
+		c.Crawler.RobotsUserAgent = strings.TrimSpace(c.Crawler.RobotsUserAgent)
+	}
+}
+
+func (c *Config) setDefaultSitemapMode() {
+	mode := strings.ToLower(strings.TrimSpace(c.Crawler.SitemapMode))
+	switch mode {
+	case "links", "sitemap", "sitemap_and_links":
+		c.Crawler.SitemapMode = mode
+	default:
+		c.Crawler.SitemapMode = "links"
+	}
+}
+
 func (c *Config) setDefaultControl() {
 	if c.Crawler.Control.Port < 1 || c.Crawler.Control.Port > 65535 {
 		c.Crawler.Control.Port = 8081
@@ -889,6 +925,15 @@ func (c *Config) validateAPI() {
 	if c.API.WriteTimeout < 1 {
 		c.API.WriteTimeout = 30
 	}
+	c.API.SearchMode = strings.ToLower(strings.TrimSpace(c.API.SearchMode))
+	if c.API.SearchMode != "" && c.API.SearchMode != "fts" && c.API.SearchMode != "like" {
+		c.API.SearchMode = ""
+	}
+	c.API.Auth.AdminKey = strings.TrimSpace(c.API.Auth.AdminKey)
+	c.API.Auth.RateLimit = strings.TrimSpace(c.API.Auth.RateLimit)
+	if c.API.Auth.CacheTTL < 1 {
+		c.API.Auth.CacheTTL = 60
+	}
 }
 
 func (c *Config) validateVDI() {
@@ -1171,6 +1216,19 @@ func (c *DNSConfig) validate() {
 			c.RateLimit = strings.TrimSpace(c.RateLimit)
 		}
 	}
+	servers := c.Servers[:0]
+	for _, server := range c.Servers {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	c.Servers = servers
+	c.Transport = strings.ToLower(strings.TrimSpace(c.Transport))
+	switch c.Transport {
+	case "udp", "tcp", "dot", "doh":
+	default:
+		c.Transport = "udp"
+	}
 }
 
 func (c *WHOISConfig) validate() {
@@ -1297,7 +1355,7 @@ func IsEmpty(config Config) bool {
 		return false
 	}
 
-	if config.NetworkInfo.DNS != (DNSConfig{}) ||
+	if !config.NetworkInfo.DNS.IsEmpty() ||
 		config.NetworkInfo.WHOIS != (WHOISConfig{}) ||
 		config.NetworkInfo.NetLookup != (NetLookupConfig{}) ||
 		!config.NetworkInfo.ServiceScout.IsEmpty() ||
@@ -1406,7 +1464,7 @@ func (c *Config) IsEmpty() bool {
 		return false
 	}
 
-	if c.NetworkInfo.DNS != (DNSConfig{}) ||
+	if !c.NetworkInfo.DNS.IsEmpty() ||
 		c.NetworkInfo.WHOIS != (WHOISConfig{}) ||
 		c.NetworkInfo.NetLookup != (NetLookupConfig{}) ||
 		!c.NetworkInfo.ServiceScout.IsEmpty() ||
@@ -1456,6 +1514,10 @@ func (c *DNSConfig) IsEmpty() bool {
 		return false
 	}
 
+	if len(c.Servers) != 0 || c.Transport != "" || c.DNSSEC {
+		return false
+	}
+
 	return true
 }
 
@@ -1700,6 +1762,41 @@ func combineCrawlerBasicSettings(dstCfg *Crawler, srcCfg map[string]interface{})
 			dstCfg.ResetCookiesPolicy = val
 		}
 	}
+	if srcCfg["check_for_robots"] != nil {
+		if val, ok := srcCfg["check_for_robots"].(bool); ok {
+			dstCfg.CheckForRobots = val
+		}
+	}
+	if srcCfg["robots_user_agent"] != nil {
+		if val, ok := srcCfg["robots_user_agent"].(string); ok {
+			dstCfg.RobotsUserAgent = val
+		}
+	}
+	if srcCfg["sitemap_mode"] != nil {
+		if val, ok := srcCfg["sitemap_mode"].(string); ok {
+			dstCfg.SitemapMode = val
+		}
+	}
+	if srcCfg["persistent_frontier"] != nil {
+		if val, ok := srcCfg["persistent_frontier"].(bool); ok {
+			dstCfg.PersistentFrontier = val
+		}
+	}
+	if srcCfg["conditional_recrawl"] != nil {
+		if val, ok := srcCfg["conditional_recrawl"].(bool); ok {
+			dstCfg.ConditionalRecrawl = val
+		}
+	}
+	if srcCfg["collect_warc"] != nil {
+		if val, ok := srcCfg["collect_warc"].(bool); ok {
+			dstCfg.CollectWARC = val
+		}
+	}
+	if srcCfg["collect_har"] != nil {
+		if val, ok := srcCfg["collect_har"].(bool); ok {
+			dstCfg.CollectHAR = val
+		}
+	}
 }
 
 func combineCrawlerRequestSettings(dstCfg *Crawler, srcCfg map[string]interface{}) {
@@ -1900,6 +1997,26 @@ func combineNIDNSCfg(dstCfg *DNSConfig, srcCfgIface interface{}) {
 			dstCfg.RateLimit = val
 		}
 	}
+	if srcCfg["servers"] != nil {
+		if val, ok := srcCfg["servers"].([]interface{}); ok {
+			dstCfg.Servers = nil
+			for _, server := range val {
+				if str, ok := server.(string); ok {
+					dstCfg.Servers = append(dstCfg.Servers, str)
+				}
+			}
+		}
+	}
+	if srcCfg["transport"] != nil {
+		if val, ok := srcCfg["transport"].(string); ok {
+			dstCfg.Transport = val
+		}
+	}
+	if srcCfg["dnssec"] != nil {
+		if val, ok := srcCfg["dnssec"].(bool); ok {
+			dstCfg.DNSSEC = val
+		}
+	}
 }
 
 func combineNIWHOISCfg(dstCfg *WHOISConfig, srcCfgIface interface{}) {
@@ -91,6 +91,12 @@ type Crawler struct {
 	CollectLinks          bool          `json:"collect_links" yaml:"collect_links"`                     // Whether to collect the links or not
 	ReportInterval        int           `json:"report_time" yaml:"report_time"`                         // Time to wait before sending the report (in minutes)
 	CheckForRobots        bool          `json:"check_for_robots" yaml:"check_for_robots"`               // Whether to check for robots.txt or not
+	RobotsUserAgent       string        `json:"robots_user_agent" yaml:"robots_user_agent"`             // User agent token used to match robots.txt rules (e.g., "CROWler")
+	SitemapMode           string        `json:"sitemap_mode" yaml:"sitemap_mode"`                       // How to use sitemaps: "links" (links only), "sitemap" (sitemap only), "sitemap_and_links"
+	PersistentFrontier    bool          `json:"persistent_frontier" yaml:"persistent_frontier"`         // Whether to store the crawl frontier in the DB (so interrupted crawls can be resumed) or not
+	ConditionalRecrawl    bool          `json:"conditional_recrawl" yaml:"conditional_recrawl"`         // Whether to skip rendering pages unchanged since the last crawl (ETag, Last-Modified, content hash) or not
+	CollectWARC           bool          `json:"collect_warc" yaml:"collect_warc"`                       // Whether to archive the crawled pages, XHR traffic and screenshots in a WARC file or not
+	CollectHAR            bool          `json:"collect_har" yaml:"collect_har"`                         // Whether to collect a HAR (HTTP Archive) of each crawled page or not
 	CreateEventWhenDone   bool          `json:"create_event_when_done" yaml:"create_event_when_done"`   // Whether to create an event when the crawling is done or not
 	Control               ControlConfig `json:"control" yaml:"control"`                                 // Control/COnsole internal API
 }
@@ -111,9 +117,12 @@ type ControlConfig struct {
 
 // DNSConfig represents the DNS information gathering configuration
 type DNSConfig struct {
-	Enabled   bool   `json:"enabled" yaml:"enabled"`       // Whether to enable DNS information gathering or not
-	Timeout   int    `json:"timeout" yaml:"timeout"`       // Timeout for DNS requests (in seconds)
-	RateLimit string `json:"rate_limit" yaml:"rate_limit"` // Rate limit for DNS requests (in milliseconds)
+	Enabled   bool     `json:"enabled" yaml:"enabled"`       // Whether to enable DNS information gathering or not
+	Timeout   int      `json:"timeout" yaml:"timeout"`       // Timeout for DNS requests (in seconds)
+	RateLimit string   `json:"rate_limit" yaml:"rate_limit"` // Rate limit for DNS requests (in milliseconds)
+	Servers   []string `json:"servers" yaml:"servers"`       // Upstream DNS servers (host[:port] or DoH URLs), if empty the system resolvers are used
+	Transport string   `json:"transport" yaml:"transport"`   // Transport used to query the servers: "udp" (default), "tcp", "dot" (DNS over TLS) or "doh" (DNS over HTTPS)
+	DNSSEC    bool     `json:"dnssec" yaml:"dnssec"`         // Whether to request the DNSSEC records and report the validation status
 }
 
 // WHOISConfig represents the WHOIS information gathering configuration
@@ -256,20 +265,30 @@ type PlatformInfo struct {
 
 // API represents the API configuration
 type API struct {
-	Host              string `yaml:"host"`               // Hostname of the API server
-	Port              int    `yaml:"port"`               // Port number of the API server
-	Timeout           int    `yaml:"timeout"`            // Timeout for API requests (in seconds)
-	ContentSearch     bool   `yaml:"content_search"`     // Whether to search in the content too or not
-	ReturnContent     bool   `yaml:"return_content"`     // Whether to return the content or not
-	SSLMode           string `yaml:"sslmode"`            // SSL mode for API connection (e.g., "disable")
-	CertFile          string `yaml:"cert_file"`          // Path to the SSL certificate file
-	KeyFile           string `yaml:"key_file"`           // Path to the SSL key file
-	RateLimit         string `yaml:"rate_limit"`         // Rate limit values are tuples (for ex. "1,3") where 1 means allows 1 request per second with a burst of 3 requests
-	EnableConsole     bool   `yaml:"enable_console"`     // Whether to enable the console or not
-	ReadHeaderTimeout int    `yaml:"readheader_timeout"` // ReadHeaderTimeout is the amount of time allowed to read request headers.
-	ReadTimeout       int    `yaml:"read_timeout"`       // ReadTimeout is the maximum duration for reading the entire request
-	WriteTimeout      int    `yaml:"write_timeout"`      // WriteTimeout
-	Return404         bool   `yaml:"return_404"`         // Whether to return 404 for not found or not
+	Host              string  `yaml:"host"`               // Hostname of the API server
+	Port              int     `yaml:"port"`               // Port number of the API server
+	Timeout           int     `yaml:"timeout"`            // Timeout for API requests (in seconds)
+	ContentSearch     bool    `yaml:"content_search"`     // Whether to search in the content too or not
+	ReturnContent     bool    `yaml:"return_content"`     // Whether to return the content or not
+	SSLMode           string  `yaml:"sslmode"`            // SSL mode for API connection (e.g., "disable")
+	CertFile          string  `yaml:"cert_file"`          // Path to the SSL certificate file
+	KeyFile           string  `yaml:"key_file"`           // Path to the SSL key file
+	RateLimit         string  `yaml:"rate_limit"`         // Rate limit values are tuples (for ex. "1,3") where 1 means allows 1 request per second with a burst of 3 requests
+	EnableConsole     bool    `yaml:"enable_console"`     // Whether to enable the console or not
+	ReadHeaderTimeout int     `yaml:"readheader_timeout"` // ReadHeaderTimeout is the amount of time allowed to read request headers.
+	ReadTimeout       int     `yaml:"read_timeout"`       // ReadTimeout is the maximum duration for reading the entire request
+	WriteTimeout      int     `yaml:"write_timeout"`      // WriteTimeout
+	Return404         bool    `yaml:"return_404"`         // Whether to return 404 for not found or not
+	SearchMode        string  `yaml:"search_mode"`        // General search mode: "fts" (ranked full-text search, PostgreSQL only) or "like" (empty means like)
+	Auth              APIAuth `yaml:"auth"`               // Authentication (API keys) configuration
+}
+
+// APIAuth represents the authentication configuration of an API server
+type APIAuth struct {
+	Enabled   bool   `json:"enabled" yaml:"enabled"`       // Whether requests require a valid API key or not
+	AdminKey  string `json:"admin_key" yaml:"admin_key"`   // Bootstrap admin key (used to create the first API keys, don't store it in clear, use an env variable)
+	RateLimit string `json:"rate_limit" yaml:"rate_limit"` // Default per-key rate limit (for ex. "10,10") for keys that don't define their own
+	CacheTTL  int    `json:"cache_ttl" yaml:"cache_ttl"`   // How long (in seconds) a validated key is cached before being checked again in the DB
 }
 
 // Selenium represents the CROWler VDI configuration
@@ -311,17 +330,18 @@ type SysMngConfig struct {
 
 // EventsConfig represents the events handler service configuration
 type EventsConfig struct {
-	Host              string `json:"host" yaml:"host"`                                         // Hostname of the events handler server
-	Port              int    `json:"port" yaml:"port"`                                         // Port number of the events handler server
-	Timeout           int    `json:"timeout" yaml:"timeout"`                                   // Timeout for events handler requests (in seconds)
-	SSLMode           string `json:"sslmode" yaml:"sslmode"`                                   // SSL mode for events handler connection (e.g., "disable")
-	CertFile          string `json:"cert_file" yaml:"cert_file"`                               // Path to the SSL certificate file
-	KeyFile           string `json:"key_file" yaml:"key_file"`                                 // Path to the SSL key file
-	RateLimit         string `json:"rate_limit" yaml:"rate_limit"`                             // Rate limit values are tuples (for ex. "1,3") where 1 means allows 1 request per second with a burst of 3 requests
-	ReadHeaderTimeout int    `json:"readheader_timeout" yaml:"readheader_timeout"`             // ReadHeaderTimeout is the amount of time allowed to read request headers.
-	ReadTimeout       int    `json:"read_timeout" yaml:"read_timeout"`                         // ReadTimeout is the maximum duration for reading the entire request
-	WriteTimeout      int    `json:"write_timeout" yaml:"write_timeout"`                       // WriteTimeout
-	EventRemoval      string `json:"automatic_events_removal" yaml:"automatic_events_removal"` // Automatic events removal from the database (always, fails, success, never or "")
+	Host              string  `json:"host" yaml:"host"`                                         // Hostname of the events handler server
+	Port              int     `json:"port" yaml:"port"`                                         // Port number of the events handler server
+	Timeout           int     `json:"timeout" yaml:"timeout"`                                   // Timeout for events handler requests (in seconds)
+	SSLMode           string  `json:"sslmode" yaml:"sslmode"`                                   // SSL mode for events handler connection (e.g., "disable")
+	CertFile          string  `json:"cert_file" yaml:"cert_file"`                               // Path to the SSL certificate file
+	KeyFile           string  `json:"key_file" yaml:"key_file"`                                 // Path to the SSL key file
+	RateLimit         string  `json:"rate_limit" yaml:"rate_limit"`                             // Rate limit values are tuples (for ex. "1,3") where 1 means allows 1 request per second with a burst of 3 requests
+	ReadHeaderTimeout int     `json:"readheader_timeout" yaml:"readheader_timeout"`             // ReadHeaderTimeout is the amount of time allowed to read request headers.
+	ReadTimeout       int     `json:"read_timeout" yaml:"read_timeout"`                         // ReadTimeout is the maximum duration for reading the entire request
+	WriteTimeout      int     `json:"write_timeout" yaml:"write_timeout"`                       // WriteTimeout
+	EventRemoval      string  `json:"automatic_events_removal" yaml:"automatic_events_removal"` // Automatic events removal from the database (always, fails, success, never or "")
+	Auth              APIAuth `json:"auth" yaml:"auth"`                                         // Authentication (API keys) configuration for the upload end-points
 }
 
 // Rules represents the rules configuration sources for the crawler and the scrapper
@@ -390,6 +410,11 @@ type PluginConfig struct {
 	Type             string                 `yaml:"type"`              // Type of storage (e.g., "local", "http", "volume", "queue", "s3")
 	SSLMode          string                 `yaml:"sslmode"`           // SSL mode for API connection (e.g., "disable")
 	Refresh          int                    `yaml:"refresh"`           // Refresh interval for the ruleset (in seconds)
+	Capabilities     []string               `yaml:"capabilities"`      // Capabilities the plugins from this location can be granted (empty means none, "all" means all)
+	AllowedHosts     []string               `yaml:"allowed_hosts"`     // Hosts the plugins can reach with the HTTP functions (empty means all)
+	MaxHeapGrowth    int                    `yaml:"max_heap_growth"`   // Best-effort guard on the process heap growth during a plugin execution (in MB, 0 means disabled)
+	MaxSteps         int                    `yaml:"max_steps"`         // Loop iterations and function calls budget of a plugin execution (0 means no limit)
+	MaxCallStack     int                    `yaml:"max_call_stack"`    // Maximum function call depth of a plugin (0 means the engine default)
 }
 
 // PrometheusConfig represents the Prometheus configuration
@@ -533,7 +558,7 @@ type FileReader interface {
 
 // IsEMpty returns true if the Crawler configuration is empty
 func (c *Crawler) IsEmpty() bool {
-	return c.MaxDepth == 0 && c.MaxLinks == 0 && c.MaxSources == 0 && c.Delay == "" && c.BrowsingMode == "" && c.MaxRetries == 0 && c.MaxRedirects == 0 && c.MaxRequests == 0 && c.ResetCookiesPolicy == "" && !c.NoThirdPartyCookies && c.CrawlingInterval == "" && c.CrawlingIfError == "" && c.CrawlingIfOk == "" && c.ProcessingTimeout == "" && !c.RequestImages && !c.RequestCSS && !c.RequestScripts && !c.RequestPlugins && !c.RequestFrames && !c.CollectHTML && !c.CollectImages && !c.CollectFiles && !c.CollectContent && !c.CollectKeywords && !c.CollectMetaTags && !c.CollectPerfMetrics && !c.CollectPageEvents && !c.CollectXHR && c.ReportInterval == 0 && !c.CheckForRobots && !c.CreateEventWhenDone && c.Control.IsEmpty()
+	return c.MaxDepth == 0 && c.MaxLinks == 0 && c.MaxSources == 0 && c.Delay == "" && c.BrowsingMode == "" && c.MaxRetries == 0 && c.MaxRedirects == 0 && c.MaxRequests == 0 && c.ResetCookiesPolicy == "" && !c.NoThirdPartyCookies && c.CrawlingInterval == "" && c.CrawlingIfError == "" && c.CrawlingIfOk == "" && c.ProcessingTimeout == "" && !c.RequestImages && !c.RequestCSS && !c.RequestScripts && !c.RequestPlugins && !c.RequestFrames && !c.CollectHTML && !c.CollectImages && !c.CollectFiles && !c.CollectContent && !c.CollectKeywords && !c.CollectMetaTags && !c.CollectPerfMetrics && !c.CollectPageEvents && !c.CollectXHR && c.ReportInterval == 0 && !c.CheckForRobots && c.RobotsUserAgent == "" && c.SitemapMode == "" && !c.PersistentFrontier && !c.ConditionalRecrawl && !c.CollectWARC && !c.CollectHAR && !c.CreateEventWhenDone && c.Control.IsEmpty()
 }
 
 // IsEmpty returns true if the ControlConfig is empty
@@ -84,7 +84,11 @@ func FindElementByType(ctx *ProcessContext, wd *vdi.WebDriver, selector rules.Se
 			}
 			matchValue := selector.Attribute.Value
 			if matchValue != "" {
-				re := regexp.MustCompile(matchValue)
+				re, err := regexp.Compile(matchValue)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "invalid attribute value pattern '%s': %v", matchValue, err)
+					continue
+				}
 				if re.MatchString(attrValue) {
 					matchL2 = true
 				}
@@ -270,7 +274,11 @@ func matchValue(ctx *ProcessContext, item interface{}, selector rules.Selector)
 	//cmn.DebugMsg(cmn.DbgLvlDebug3, "Selector Value Resolved: '%s'", selValue)
 
 	// Use Regex to match the selValue against the wdfText
-	regEx := regexp.MustCompile(selValue)
+	regEx, err := regexp.Compile(selValue)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "invalid selector value pattern '%s': %v", selValue, err)
+		return false
+	}
 	return regEx.MatchString(wdfText)
 }
 
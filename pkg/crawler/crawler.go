@@ -29,6 +29,7 @@ import (
 	"html"
 	"image"
 	"image/png"
+	"io"
 	"math"
 	"net/http"
 	"net/url"
@@ -46,6 +47,7 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/abadojack/whatlanggo"
+	selog "github.com/go-auxiliaries/selenium/log"
 	cdp "github.com/mafredri/cdp"
 	"github.com/mafredri/cdp/protocol/emulation"
 	"github.com/mafredri/cdp/rpcc"
@@ -55,8 +57,10 @@ import (
 	cdb "github.com/pzaino/thecrowler/pkg/database"
 	detect "github.com/pzaino/thecrowler/pkg/detection"
 	exi "github.com/pzaino/thecrowler/pkg/exprterpreter"
+	"github.com/pzaino/thecrowler/pkg/har"
 	httpi "github.com/pzaino/thecrowler/pkg/httpinfo"
 	neti "github.com/pzaino/thecrowler/pkg/netinfo"
+	robots "github.com/pzaino/thecrowler/pkg/robots"
 	rules "github.com/pzaino/thecrowler/pkg/ruleset"
 	vdi "github.com/pzaino/thecrowler/pkg/vdi"
 
@@ -86,11 +90,16 @@ const (
 	optBrowsingRCRecu = "right_click_recursive"
 	optBrowsingMobile = "mobile"
 	optCookiesOnReq   = "on_request"
+
+	optSitemapLinks    = "links"
+	optSitemapOnly     = "sitemap"
+	optSitemapAndLinks = "sitemap_and_links"
 )
 
 var (
 	config           cfg.Config // Configuration "object"
 	allowedProtocols = strings.Split("http://,https://,ftp://,ftps://", ",")
+	robotsCache      = robots.NewCache(robots.DefaultCacheTTL) // robots.txt cache (shared by all pipelines)
 )
 
 var indexPageMutex sync.Mutex // Mutex to ensure that only one goroutine is indexing a page at a time
@@ -106,7 +115,7 @@ type ProcessContext struct {
 	config            cfg.Config             // The configuration object (from the config package)
 	db                *cdb.Handler           // The database handler
 	wd                vdi.WebDriver          // The Selenium WebDriver
-	linksMutex        sync.Mutex             // Mutex to protect the newLinks slice
+	linksMutex        sync.Mutex             // Mutex to protect the newLinks slice (and Status.QueueSize)
 	newLinks          []LinkItem             // The new links found during the crawling process
 	source            *cdb.Source            // The source to crawl
 	wg                sync.WaitGroup         // WaitGroup to wait for all page workers to finish
@@ -123,6 +132,11 @@ type ProcessContext struct {
 	VDIReturned       bool                   // Flag to indicate if the VDI instance was returned
 	SelClosed         bool                   // Flag to indicate if the Selenium instance was closed
 	VDIOperationMutex sync.Mutex             // Mutex to protect the VDI operations
+	warc              *warcArchive           // The WARC archive of the crawl (if enabled)
+	har               *har.Builder           // The HAR builder of the page being crawled (if enabled)
+	harMutex          sync.Mutex             // Mutex to protect the HAR builder
+	perfLogs          []selog.Message        // Performance logs read by peekPerformanceLogs and not consumed yet
+	perfLogsMutex     sync.Mutex             // Mutex to protect perfLogs
 }
 
 // GetContextID returns a unique context ID for the ProcessContext
@@ -239,6 +253,10 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 	processCtx.Status.CrawlingRunning = 1
 	defer closeSession(processCtx, args, &sel, releaseVDI, err)
 
+	// Open the WARC archive of this crawl (if requested)
+	processCtx.warcStart()
+	defer processCtx.warcFinish()
+
 	// Extract custom configuration from the source
 	sourceConfig := make(map[string]interface{})
 	if processCtx.source.Config != nil {
@@ -277,6 +295,18 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 		}
 	}
 
+	// Check if robots.txt allows us to crawl the Source
+	if !isAllowedByRobots(processCtx, args.Src.URL) {
+		err = fmt.Errorf("source URL %s is disallowed by robots.txt", args.Src.URL)
+		cmn.DebugMsg(cmn.DbgLvlInfo, "%v, skipping crawling...", err)
+		processCtx.Status.TotalRobotsDeny++
+		processCtx.Status.EndTime = time.Now()
+		processCtx.Status.CrawlingRunning = 3
+		processCtx.Status.PipelineRunning = 3
+		processCtx.Status.LastError = err.Error()
+		return
+	}
+
 	// Crawl the initial URL and get the HTML content
 	var pageSource vdi.WebDriver
 	pageSource, err = processCtx.CrawlInitialURL(sel)
@@ -309,6 +339,17 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 	}
 	initialLinks := extractLinks(processCtx, htmlContent, args.Src.URL)
 
+	// Seed the frontier with the sitemap URLs (if requested)
+	sitemapMode := strings.ToLower(strings.TrimSpace(processCtx.config.Crawler.SitemapMode))
+	if sitemapMode == optSitemapOnly || sitemapMode == optSitemapAndLinks {
+		sitemapLinks := getSitemapLinks(processCtx)
+		if sitemapMode == optSitemapOnly {
+			initialLinks = sitemapLinks
+		} else {
+			initialLinks = append(initialLinks, sitemapLinks...)
+		}
+	}
+
 	// Refresh the page
 	err = processCtx.RefreshVDIConnection(sel)
 	if err != nil {
@@ -351,8 +392,21 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 	allLinks := initialLinks // links extracted from the initial page
 	var currentDepth int
 	maxDepth := checkMaxDepth(processCtx.config.Crawler.MaxDepth) // set a maximum depth for crawling
-	newLinksFound := len(initialLinks)
+
+	// Resume the crawl from the persistent frontier (if the previous one was interrupted)
+	resumeLinks, nextLinks, resumeDepth, resumed := processCtx.frontierStart(initialLinks)
+	if resumed {
+		allLinks = resumeLinks
+		currentDepth = resumeDepth
+		processCtx.Status.CurrentDepth = currentDepth
+		processCtx.newLinks = nextLinks
+		if processCtx.config.Crawler.MaxDepth == 0 {
+			maxDepth = currentDepth + 1
+		}
+	}
+	newLinksFound := len(allLinks)
 	processCtx.Status.TotalLinks = newLinksFound
+	processCtx.Status.QueueSize = len(allLinks) + len(processCtx.newLinks)
 	if processCtx.source.Restricted != 0 {
 		// Restriction level is higher than 0, so we need to crawl the website
 		for (currentDepth < maxDepth) && (newLinksFound > 0) {
@@ -428,6 +482,7 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 			} else {
 				newLinksFound = 0
 			}
+			processCtx.Status.QueueSize = newLinksFound
 			processCtx.newLinks = []LinkItem{} // reset newLinks
 			processCtx.linksMutex.Unlock()
 
@@ -439,6 +494,7 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 			}
 		}
 	}
+	processCtx.frontierFinish()
 
 	if processCtx.config.Crawler.ResetCookiesPolicy == cmn.AlwaysStr {
 		// Reset cookies after crawling
@@ -572,6 +628,7 @@ func resetPageInfo(p *PageInfo) {
 	p.MetaTags = []MetaTag{}
 	p.ScrapedData = []ScrapedItem{}
 	p.Links = p.Links[:0] // Reset slice without reallocating
+	p.har = nil
 }
 
 // ConnectToVDI is responsible for connecting to the CROWler VDI Instance
@@ -684,7 +741,7 @@ func (ctx *ProcessContext) CrawlInitialURL(_ vdi.SeleniumInstance) (vdi.WebDrive
 
 	// Collect Page logs
 	if ctx.config.Crawler.CollectPageEvents {
-		collectPageLogs(&pageSource, &pageInfo)
+		collectPageLogs(ctx, &pageSource, &pageInfo)
 	}
 
 	// Collect XHR
@@ -692,6 +749,11 @@ func (ctx *ProcessContext) CrawlInitialURL(_ vdi.SeleniumInstance) (vdi.WebDrive
 		collectXHR(ctx, &pageInfo)
 	}
 
+	// Collect HAR
+	if ctx.config.Crawler.CollectHAR {
+		collectHAR(ctx, &pageInfo)
+	}
+
 	if !ctx.config.Crawler.CollectHTML {
 		// If we don't need to collect HTML content, clear it
 		pageInfo.HTML = ""
@@ -714,8 +776,7 @@ func (ctx *ProcessContext) CrawlInitialURL(_ vdi.SeleniumInstance) (vdi.WebDrive
 	ctx.Status.TotalPages = 1
 
 	// Delay before processing the next job
-	if ctx.config.Crawler.Delay != "0" {
-		delay := exi.GetFloat(ctx.config.Crawler.Delay)
+	if delay := getCrawlDelay(ctx); delay > 0 {
 		ctx.Status.LastDelay = delay
 		_ = vdiSleep(ctx, delay)
 	}
@@ -779,6 +840,9 @@ func collectXHR(ctx *ProcessContext, pageInfo *PageInfo) {
 		return
 	}
 
+	// Archive the XHR traffic (if WARC collection is enabled)
+	ctx.warcRecordXHR(xhrData)
+
 	// Store data in PageInfo
 	xhr := map[string]interface{}{"xhr": xhrData}
 	pageInfo.ScrapedData = append(pageInfo.ScrapedData, xhr)
@@ -789,8 +853,8 @@ func collectXHR(ctx *ProcessContext, pageInfo *PageInfo) {
 }
 
 // Collects the page logs from the browser
-func collectPageLogs(pageSource *vdi.WebDriver, pageInfo *PageInfo) {
-	logs, err := (*pageSource).Log("performance")
+func collectPageLogs(ctx *ProcessContext, pageSource *vdi.WebDriver, pageInfo *PageInfo) {
+	logs, err := getPerformanceLogs(ctx, *pageSource)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Failed to retrieve performance logs: %v", err)
 		return
@@ -870,6 +934,9 @@ func (ctx *ProcessContext) TakeScreenshot(wd vdi.WebDriver, url string, indexID
 			ss.IndexID = ctx.fpIdx
 		}
 
+		// Archive the screenshot (if WARC collection is enabled)
+		ctx.warcRecordScreenshot(url, ss)
+
 		// Update DB SearchIndex Table with the screenshot filename
 		dbx := *ctx.db
 		err = insertScreenshot(dbx, ss)
@@ -1073,6 +1140,24 @@ func indexPage(db cdb.Handler, url string, pageInfo *PageInfo) (uint64, error) {
 		return 0, err
 	}
 
+	// Insert the HAR of the page (if collected)
+	err = insertHARObject(tx, indexID, pageInfo)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "inserting HAR WebObject: %v", err)
+		rollbackTransaction(tx)
+		return 0, err
+	}
+
+	// Store the validators of the page (for the next conditional re-crawl)
+	if pageInfo.Config.Crawler.ConditionalRecrawl {
+		err = insertPageValidators(tx, indexID, pageInfo)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "inserting page validators: %v", err)
+			rollbackTransaction(tx)
+			return 0, err
+		}
+	}
+
 	// Insert MetaTags
 	if pageInfo.Config.Crawler.CollectMetaTags {
 		err = insertMetaTags(tx, indexID, pageInfo.MetaTags)
@@ -1752,7 +1837,7 @@ func enableCDPNetworkLogging(wd vdi.WebDriver) error {
 	return nil
 }
 
-func listenForCDPEvents(ctx context.Context, _ *ProcessContext, wd vdi.WebDriver, collectedRequests *[]map[string]interface{}) {
+func listenForCDPEvents(ctx context.Context, pCtx *ProcessContext, wd vdi.WebDriver, collectedRequests *[]map[string]interface{}) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -1762,7 +1847,7 @@ func listenForCDPEvents(ctx context.Context, _ *ProcessContext, wd vdi.WebDriver
 		default:
 			// Fetch CDP Events
 			//events, err := wd.ExecuteChromeDPCommand("Log.entryAdded", map[string]interface{}{})
-			logs, err := wd.Log("performance")
+			logs, err := getPerformanceLogs(pCtx, wd)
 			if err != nil {
 				cmn.DebugMsg(cmn.DbgLvlError, "Failed to retrieve CDP events: %v", err)
 				continue
@@ -2004,7 +2089,7 @@ func collectXHRLogs(ctx *ProcessContext, collectedResponses []map[string]interfa
 func collectCDPRequests(ctx *ProcessContext) ([]map[string]interface{}, error) {
 	cmn.DebugMsg(cmn.DbgLvlDebug5, "Collecting request logs...")
 	wd := ctx.wd
-	logs, err := wd.Log("performance")
+	logs, err := getPerformanceLogs(ctx, wd)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Failed to retrieve performance logs: %v", err)
 		return nil, err
@@ -2174,6 +2259,8 @@ func storeResponseMetadata(ctx *ProcessContext, message map[string]interface{},
 	if request, exists := responseBodies[requestID]; exists {
 		requestMap := request.(map[string]interface{})
 		requestMap["response_content_type"] = contentType
+		requestMap["status"] = status
+		requestMap["response_headers"] = headers
 	}
 }
 
@@ -2432,7 +2519,7 @@ func getURLContent(url string, wd vdi.WebDriver, level int, ctx *ProcessContext)
 	// Add XHR Hook
 	//var collectedRequests *[]map[string]interface{}
 	//var cancel context.CancelFunc
-	if ctx.config.Crawler.CollectXHR {
+	if ctx.config.Crawler.CollectXHR || ctx.config.Crawler.CollectHAR || ctx.config.Crawler.CollectWARC {
 		err = enableCDPNetworkLogging(ctx.wd)
 		if err != nil {
 			cmn.DebugMsg(cmn.DbgLvlError, "adding XHR Hook: %v", err)
@@ -2442,6 +2529,9 @@ func getURLContent(url string, wd vdi.WebDriver, level int, ctx *ProcessContext)
 
 	}
 
+	// Start collecting the HAR of the page (if enabled)
+	ctx.harStart(wd)
+
 	// Navigate to a page and interact with elements.
 	if err := wd.Get(url); err != nil {
 		if strings.Contains(strings.ToLower(strings.TrimSpace(err.Error())), "unable to find session with id") {
@@ -2508,6 +2598,9 @@ func getURLContent(url string, wd vdi.WebDriver, level int, ctx *ProcessContext)
 		cmn.DebugMsg(cmn.DbgLvlError, "failed to get post-actions cookies: %v", err)
 	}
 
+	// Archive the page (if WARC collection is enabled)
+	ctx.warcRecordPage(&wd, url, docType)
+
 	/*
 		if ctx.config.Crawler.CollectXHR {
 			// Stop listening for CDP events
@@ -3173,17 +3266,32 @@ func worker(processCtx *ProcessContext, id int, jobs chan LinkItem) error {
 			urlLink, _ = combineURLs(processCtx.source.URL, url.Link)
 		}
 
+		processCtx.linksMutex.Lock()
+		processCtx.Status.QueueSize--
+		processCtx.linksMutex.Unlock()
+
 		// Check if the URL should be skipped
 		skip := skipURL(processCtx, id, urlLink)
 		if skip {
 			processCtx.Status.TotalSkipped++
 			skippedURLs = append(skippedURLs, url)
+			processCtx.frontierSetStatus(url.Link, cdb.FrontierDone, nil)
 			continue
 		}
 		if processCtx.visitedLinks[cmn.NormalizeURL(urlLink)] {
 			// URL already visited
 			processCtx.Status.TotalDuplicates++
 			cmn.DebugMsg(cmn.DbgLvlDebug2, "Worker %d: URL %s already visited\n", id, url.Link)
+			processCtx.frontierSetStatus(url.Link, cdb.FrontierDone, nil)
+			continue
+		}
+		processCtx.frontierSetStatus(url.Link, cdb.FrontierInFlight, nil)
+
+		// Skip the page if it hasn't changed since the last crawl
+		changes := checkPageChanges(processCtx, id, urlLink)
+		if changes != nil && changes.Unchanged {
+			processCtx.visitedLinks[cmn.NormalizeURL(urlLink)] = true
+			processCtx.frontierSetStatus(url.Link, cdb.FrontierDone, nil)
 			continue
 		}
 
@@ -3195,7 +3303,8 @@ func worker(processCtx *ProcessContext, id int, jobs chan LinkItem) error {
 		// Process the job
 		cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Processing job %s\n", id, url.Link)
 		var err error
-		if strings.ToLower(strings.TrimSpace(processCtx.config.Crawler.BrowsingMode)) == optBrowsingRecu {
+		if url.FromSitemap || strings.ToLower(strings.TrimSpace(processCtx.config.Crawler.BrowsingMode)) == optBrowsingRecu {
+			// Sitemap URLs are not linked from a page we have loaded, so they can only be fetched directly
 			err = processJob(processCtx, id, urlLink, skippedURLs)
 		} else if strings.ToLower(strings.TrimSpace(processCtx.config.Crawler.BrowsingMode)) == optBrowsingRCRecu {
 			// Right Click Recursive Mode
@@ -3213,9 +3322,16 @@ func worker(processCtx *ProcessContext, id int, jobs chan LinkItem) error {
 
 		if err == nil {
 			processCtx.Status.TotalPages++
+			processCtx.frontierSetStatus(url.Link, cdb.FrontierDone, nil)
+			if changes != nil {
+				if err := storePageValidators(*processCtx.db, urlLink, changes.Validators); err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "Worker %d: storing validators for %s: %v\n", id, urlLink, err)
+				}
+			}
 			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Finished job %s\n", id, url.Link)
 		} else {
 			processCtx.Status.TotalErrors++
+			processCtx.frontierSetStatus(url.Link, cdb.FrontierFailed, err)
 			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Finished job %s with an error: %v\n", id, url.Link, err)
 			if strings.Contains(err.Error(), errCriticalError) {
 				return err
@@ -3226,8 +3342,7 @@ func worker(processCtx *ProcessContext, id int, jobs chan LinkItem) error {
 		skippedURLs = nil
 
 		// Delay before processing the next job
-		if processCtx.config.Crawler.Delay != "0" {
-			delay := exi.GetFloat(processCtx.config.Crawler.Delay)
+		if delay := getCrawlDelay(processCtx); delay > 0 {
 			processCtx.Status.LastDelay = delay
 			_ = vdiSleep(processCtx, delay)
 		}
@@ -3271,7 +3386,11 @@ func skipURL(processCtx *ProcessContext, id int, url string) bool {
 		matches := 0
 
 		for _, pattern := range processCtx.userURLPatterns {
-			re := regexp.MustCompile(pattern)
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "Worker %d: Invalid user-defined URL pattern '%s': %v\n", id, pattern, err)
+				continue
+			}
 			cmn.DebugMsg(cmn.DbgLvlDebug5, "Worker %d: Checking URL '%s' against user-defined pattern '%s'\n", id, url, pattern)
 			if re.MatchString(url) {
 				matches++
@@ -3301,10 +3420,47 @@ func skipURL(processCtx *ProcessContext, id int, url string) bool {
 		}
 	}
 
+	// Check if robots.txt allows us to crawl the URL
+	if !isAllowedByRobots(processCtx, url) {
+		cmn.DebugMsg(cmn.DbgLvlDebug2, "Worker %d: Skipping URL '%s' as it's disallowed by robots.txt\n", id, url)
+		processCtx.Status.TotalRobotsDeny++
+		return true
+	}
+
 	// If none of the conditions matched, do not skip
 	return false
 }
 
+// isAllowedByRobots checks if the robots.txt of the URL's host allows
+// the CROWler to crawl it (always true when check_for_robots is disabled)
+func isAllowedByRobots(processCtx *ProcessContext, url string) bool {
+	if !processCtx.config.Crawler.CheckForRobots || !IsValidURIProtocol(url) {
+		return true
+	}
+	return robotsCache.IsAllowed(url, processCtx.config.Crawler.RobotsUserAgent, processCtx.config.Crawler.Timeout)
+}
+
+// getCrawlDelay returns the delay to apply between requests, which is the
+// configured delay or the robots.txt Crawl-delay (whichever is bigger)
+func getCrawlDelay(processCtx *ProcessContext) float64 {
+	var delay float64
+	if processCtx.config.Crawler.Delay != "0" {
+		delay = exi.GetFloat(processCtx.config.Crawler.Delay)
+	}
+	if !processCtx.config.Crawler.CheckForRobots || processCtx.source == nil {
+		return delay
+	}
+	robotsData, err := robotsCache.Get(processCtx.source.URL, processCtx.config.Crawler.RobotsUserAgent, processCtx.config.Crawler.Timeout)
+	if err != nil {
+		return delay
+	}
+	if crawlDelay := robotsData.CrawlDelay(processCtx.config.Crawler.RobotsUserAgent); crawlDelay > delay {
+		cmn.DebugMsg(cmn.DbgLvlDebug3, "Using robots.txt Crawl-delay: %f", crawlDelay)
+		delay = crawlDelay
+	}
+	return delay
+}
+
 // Function to determine if a pattern is negative (e.g., begins with a "!" or other logic you define)
 func isNegativePattern(pattern string) bool {
 	// For example, assume negative patterns start with "!".
@@ -3445,7 +3601,7 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 	}
 
 	// Collect performance logs
-	logs, err := processCtx.wd.Log("performance")
+	logs, err := getPerformanceLogs(processCtx, processCtx.wd)
 	if err != nil {
 		return err
 	}
@@ -3467,6 +3623,11 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 		collectXHR(processCtx, &pageCache)
 	}
 
+	// Collect HAR
+	if processCtx.config.Crawler.CollectHAR {
+		collectHAR(processCtx, &pageCache)
+	}
+
 	// Clear HTML and content if not required
 	if !processCtx.config.Crawler.CollectHTML {
 		pageCache.HTML = ""
@@ -3487,11 +3648,7 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 	processCtx.visitedLinks[cmn.NormalizeURL(currentURL)] = true
 
 	// Add new links to the process context
-	if len(pageCache.Links) > 0 {
-		processCtx.linksMutex.Lock()
-		processCtx.newLinks = append(processCtx.newLinks, pageCache.Links...)
-		processCtx.linksMutex.Unlock()
-	}
+	processCtx.addNewLinks(pageCache.Links)
 
 	// Before we return, we need to call goBack to go back to the previous page
 	err = goBack(processCtx)
@@ -3625,7 +3782,7 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 		}
 	}
 	// Collect Page logs
-	logs, err := processCtx.wd.Log("performance")
+	logs, err := getPerformanceLogs(processCtx, processCtx.wd)
 	if err != nil {
 		return err
 	}
@@ -3647,6 +3804,11 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 		collectXHR(processCtx, &pageCache)
 	}
 
+	// Collect HAR
+	if processCtx.config.Crawler.CollectHAR {
+		collectHAR(processCtx, &pageCache)
+	}
+
 	if !processCtx.config.Crawler.CollectHTML {
 		// If we don't need to collect HTML content, clear it
 		pageCache.HTML = ""
@@ -3666,11 +3828,7 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 	processCtx.visitedLinks[cmn.NormalizeURL(url.Link)] = true
 
 	// Add the new links to the process context
-	if len(pageCache.Links) > 0 {
-		processCtx.linksMutex.Lock()
-		processCtx.newLinks = append(processCtx.newLinks, pageCache.Links...)
-		processCtx.linksMutex.Unlock()
-	}
+	processCtx.addNewLinks(pageCache.Links)
 
 	return err
 }
@@ -3762,7 +3920,7 @@ func processJob(processCtx *ProcessContext, id int, url string, skippedURLs []Li
 
 	// Collect Page logs
 	if processCtx.config.Crawler.CollectPageEvents {
-		collectPageLogs(&htmlContent, &pageCache)
+		collectPageLogs(processCtx, &htmlContent, &pageCache)
 	}
 
 	// Collect XHR
@@ -3770,6 +3928,11 @@ func processJob(processCtx *ProcessContext, id int, url string, skippedURLs []Li
 		collectXHR(processCtx, &pageCache)
 	}
 
+	// Collect HAR
+	if processCtx.config.Crawler.CollectHAR {
+		collectHAR(processCtx, &pageCache)
+	}
+
 	if !processCtx.config.Crawler.CollectHTML {
 		// If we don't need to collect HTML content, clear it
 		pageCache.HTML = ""
@@ -3788,11 +3951,7 @@ func processJob(processCtx *ProcessContext, id int, url string, skippedURLs []Li
 	processCtx.visitedLinks[cmn.NormalizeURL(url)] = true
 
 	// Add the new links to the process context
-	if len(pageCache.Links) > 0 {
-		processCtx.linksMutex.Lock()
-		processCtx.newLinks = append(processCtx.newLinks, pageCache.Links...)
-		processCtx.linksMutex.Unlock()
-	}
+	processCtx.addNewLinks(pageCache.Links)
 	resetPageInfo(&pageCache) // Reset the PageInfo object
 
 	return err
@@ -3887,6 +4046,7 @@ func TakeScreenshot(wd *vdi.WebDriver, filename string, maxHeight int) (Screensh
 	ss.Width = windowWidth
 	ss.Height = totalHeight
 	ss.ByteSize = len(screenshot)
+	ss.data = screenshot
 
 	return ss, nil
 }
@@ -4036,9 +4196,9 @@ func saveScreenshot(filename string, screenshot []byte) (string, error) {
 		// Determine storage method and call appropriate function
 		switch config.ImageStorageAPI.Type {
 		case cmn.HTTPStr:
-			return writeDataViaHTTP(filename, screenshot, saveCfg)
+			return writeDataViaHTTP(filename, bytes.NewReader(screenshot), saveCfg)
 		case "s3":
-			return writeDataToToS3(filename, screenshot, saveCfg)
+			return writeDataToToS3(filename, bytes.NewReader(screenshot), saveCfg)
 		// Add cases for other types if needed, e.g., shared volume, message queue, etc.
 		default:
 			return "", errors.New("unsupported storage type")
@@ -4049,6 +4209,46 @@ func saveScreenshot(filename string, screenshot []byte) (string, error) {
 	}
 }
 
+// SaveFile saves data using the given file storage configuration (local, http or s3)
+// and returns the location of the saved file
+func SaveFile(filename string, data []byte, saveCfg cfg.FileStorageAPI) (string, error) {
+	return SaveFileFrom(filename, bytes.NewReader(data), saveCfg)
+}
+
+// SaveFileFrom is like SaveFile, but it streams the data to the file storage
+// from a reader (e.g. a large file) instead of holding it all in memory
+func SaveFileFrom(filename string, data io.ReadSeeker, saveCfg cfg.FileStorageAPI) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(saveCfg.Type)) {
+	case cmn.HTTPStr:
+		return writeDataViaHTTP(filename, data, saveCfg)
+	case "s3":
+		return writeDataToToS3(filename, data, saveCfg)
+	case "", cmn.LocalStr:
+		path := filepath.Join(saveCfg.Path, filename)
+		if err := os.MkdirAll(filepath.Dir(path), cmn.DefaultDirPerms); err != nil {
+			return "", err
+		}
+		return copyToFile(path, data)
+	default:
+		return "", fmt.Errorf("unsupported storage type: %s", saveCfg.Type)
+	}
+}
+
+// LoadFile reads a file saved with SaveFile (or saveScreenshot), given the
+// location it returned and the file storage configuration used to save it
+func LoadFile(location string, loadCfg cfg.FileStorageAPI) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		return readDataFromS3(location, loadCfg)
+	case strings.HasPrefix(location, cmn.HTTPStr+"://"), strings.HasPrefix(location, cmn.HTTPSStr+"://"):
+		return readDataViaHTTP(location, loadCfg)
+	case strings.Contains(location, "://"):
+		return nil, fmt.Errorf("unsupported file location: %s", location)
+	default:
+		return os.ReadFile(location) //nolint:gosec // location is returned by SaveFile
+	}
+}
+
 // validateImageStorageAPIConfig validates the ImageStorageAPI configuration
 func validateImageStorageAPIConfig(checkCfg cfg.Config) error {
 	if checkCfg.ImageStorageAPI.Host == "" || checkCfg.ImageStorageAPI.Port == 0 {
@@ -4059,7 +4259,7 @@ func validateImageStorageAPIConfig(checkCfg cfg.Config) error {
 }
 
 // saveScreenshotViaHTTP sends the screenshot to a remote API
-func writeDataViaHTTP(filename string, data []byte, saveCfg cfg.FileStorageAPI) (string, error) {
+func writeDataViaHTTP(filename string, data io.ReadSeeker, saveCfg cfg.FileStorageAPI) (string, error) {
 	// Check if Host IP is allowed:
 	if cmn.IsDisallowedIP(saveCfg.Host, 1) {
 		return "", fmt.Errorf("host %s is not allowed", saveCfg.Host)
@@ -4079,10 +4279,18 @@ func writeDataViaHTTP(filename string, data []byte, saveCfg cfg.FileStorageAPI)
 	httpClient := &http.Client{
 		Transport: cmn.SafeTransport(saveCfg.Timeout, saveCfg.SSLMode),
 	}
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(data))
+	size, err := data.Seek(0, io.SeekEnd)
 	if err != nil {
 		return "", err
 	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", apiURL, io.NopCloser(data))
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.Header.Set("Filename", filename)
 	req.Header.Set("Authorization", "Bearer "+saveCfg.Token) // Assuming token-based auth
@@ -4107,6 +4315,31 @@ func writeDataViaHTTP(filename string, data []byte, saveCfg cfg.FileStorageAPI)
 	return location, nil
 }
 
+// readDataViaHTTP reads a file from the remote API it was saved to
+func readDataViaHTTP(location string, loadCfg cfg.FileStorageAPI) ([]byte, error) {
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(loadCfg.Timeout, loadCfg.SSLMode),
+	}
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+	if loadCfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+loadCfg.Token) // Assuming token-based auth
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read file, status code: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
 // writeToFile is responsible for writing data to a file
 func writeToFile(filename string, data []byte) (string, error) {
 	// Write data to a file
@@ -4118,6 +4351,23 @@ func writeToFile(filename string, data []byte) (string, error) {
 	return filename, nil
 }
 
+// copyToFile is responsible for writing the data of a reader to a file
+func copyToFile(filename string, data io.Reader) (string, error) {
+	file, err := os.Create(filename) //nolint:gosec // filename and path here is provided by the admin
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(file, data); err != nil {
+		_ = file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
+
 // writeDataToFile is responsible for writing data to a file
 func writeDataToFile(filename string, data []byte) error {
 	// open file using READ & WRITE permission
@@ -4137,7 +4387,7 @@ func writeDataToFile(filename string, data []byte) error {
 }
 
 // writeDataToToS3 is responsible for saving a screenshot to an S3 bucket
-func writeDataToToS3(filename string, data []byte, saveCfg cfg.FileStorageAPI) (string, error) {
+func writeDataToToS3(filename string, data io.ReadSeeker, saveCfg cfg.FileStorageAPI) (string, error) {
 	// saveScreenshotToS3 uses:
 	// - config.ImageStorageAPI.Region as AWS region
 	// - config.ImageStorageAPI.Token as AWS access key ID
@@ -4161,7 +4411,7 @@ func writeDataToToS3(filename string, data []byte, saveCfg cfg.FileStorageAPI) (
 	_, err = svc.PutObject(&s3.PutObjectInput{
 		Bucket: aws.String(saveCfg.Path),
 		Key:    aws.String(filename),
-		Body:   bytes.NewReader(data),
+		Body:   data,
 	})
 	if err != nil {
 		return "", err
@@ -4170,3 +4420,33 @@ func writeDataToToS3(filename string, data []byte, saveCfg cfg.FileStorageAPI) (
 	// Return the location of the saved file
 	return fmt.Sprintf("s3://%s/%s", saveCfg.Path, filename), nil
 }
+
+// readDataFromS3 reads a file from the S3 bucket it was saved to
+// (location is s3://<bucket>/<key>, as returned by writeDataToToS3)
+func readDataFromS3(location string, loadCfg cfg.FileStorageAPI) ([]byte, error) {
+	bucket, key, found := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+	if !found || bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid S3 location: %s", location)
+	}
+
+	// Create an AWS session
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(loadCfg.Region),
+		Credentials: credentials.NewStaticCredentials(loadCfg.Token, loadCfg.Secret, ""),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Download the file from the S3 bucket
+	out, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	return io.ReadAll(out.Body)
+}
@@ -15,8 +15,20 @@
 package crawler
 
 import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
 	"testing"
+	"time"
+
+	selog "github.com/go-auxiliaries/selenium/log"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	"github.com/pzaino/thecrowler/pkg/har"
+	httpi "github.com/pzaino/thecrowler/pkg/httpinfo"
+	"github.com/pzaino/thecrowler/pkg/warc"
 )
 
 const (
@@ -112,6 +124,332 @@ func TestCombineURLs(t *testing.T) {
 	}
 }
 
+func TestSkipURLRobots(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private/\nCrawl-delay: 7\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	testArgs := Pars{
+		Src:    cdb.Source{URL: server.URL + "/", Restricted: 4},
+		Status: &Status{},
+	}
+	ctx := NewProcessContext(&testArgs)
+	ctx.config.Crawler.Delay = "0"
+	ctx.config.Crawler.RobotsUserAgent = "CROWler"
+
+	// robots.txt is ignored when check_for_robots is disabled
+	if skipURL(ctx, 1, server.URL+"/private/page.html") {
+		t.Errorf("skipURL() skipped a URL with check_for_robots disabled")
+	}
+	if got := getCrawlDelay(ctx); got != 0 {
+		t.Errorf("getCrawlDelay() = %f, want 0", got)
+	}
+
+	ctx.config.Crawler.CheckForRobots = true
+	if !skipURL(ctx, 1, server.URL+"/private/page.html") {
+		t.Errorf("skipURL() did not skip a URL disallowed by robots.txt")
+	}
+	if skipURL(ctx, 1, server.URL+"/public/page.html") {
+		t.Errorf("skipURL() skipped a URL allowed by robots.txt")
+	}
+	if ctx.Status.TotalRobotsDeny != 1 {
+		t.Errorf("TotalRobotsDeny = %d, want 1", ctx.Status.TotalRobotsDeny)
+	}
+	if got := getCrawlDelay(ctx); got != 7 {
+		t.Errorf("getCrawlDelay() = %f, want 7", got)
+	}
+}
+
+func TestGetSitemapLinks(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nSitemap: " + server.URL + "/news-sitemap.xml\n"))
+		case "/news-sitemap.xml":
+			_, _ = w.Write([]byte(`<urlset><url><loc>` + server.URL + `/news/1</loc><priority>0.2</priority></url><url><loc>` + server.URL + `/news/2</loc><priority>0.9</priority></url></urlset>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	testArgs := Pars{
+		Src:    cdb.Source{URL: server.URL + "/", Restricted: 1},
+		Status: &Status{},
+	}
+	ctx := NewProcessContext(&testArgs)
+	ctx.config.Crawler.RobotsUserAgent = "CROWler"
+
+	links := getSitemapLinks(ctx)
+	if len(links) != 2 {
+		t.Fatalf("getSitemapLinks() returned %d links, want 2", len(links))
+	}
+	if links[0].Link != server.URL+"/news/2" || !links[0].FromSitemap {
+		t.Errorf("getSitemapLinks()[0] = %+v", links[0])
+	}
+	if links[0].PageURL != server.URL+"/news-sitemap.xml" {
+		t.Errorf("getSitemapLinks()[0].PageURL = %s", links[0].PageURL)
+	}
+}
+
+func TestFrontierToLinks(t *testing.T) {
+	items := []cdb.FrontierItem{
+		{URL: "https://example.com/a", ParentURL: "https://example.com/", Depth: 2},
+		{URL: "/b", ParentURL: "https://example.com/", Depth: 2, ElementID: "link-b"},
+		{URL: "https://example.com/c", ParentURL: "https://example.com/a", Depth: 3, FromSitemap: true},
+	}
+
+	current, next, depth := frontierToLinks(items)
+	if depth != 2 {
+		t.Errorf("frontierToLinks() depth = %d, want 2", depth)
+	}
+	if len(current) != 2 || len(next) != 1 {
+		t.Fatalf("frontierToLinks() returned %d current and %d next links, want 2 and 1", len(current), len(next))
+	}
+	if current[1].Link != "/b" || current[1].ElementID != "link-b" {
+		t.Errorf("unexpected current link: %+v", current[1])
+	}
+	if !next[0].FromSitemap || next[0].PageURL != "https://example.com/a" {
+		t.Errorf("unexpected next link: %+v", next[0])
+	}
+
+	if current, next, _ := frontierToLinks(nil); current != nil || next != nil {
+		t.Errorf("frontierToLinks(nil) returned links")
+	}
+}
+
+func TestAddNewLinks(t *testing.T) {
+	testArgs := Pars{
+		Src:    cdb.Source{URL: "https://example.com/", Restricted: 1},
+		Status: &Status{},
+	}
+	ctx := NewProcessContext(&testArgs)
+	links := []LinkItem{{Link: "https://example.com/a"}, {Link: "https://example.com/b"}}
+
+	ctx.config.Crawler.SitemapMode = optSitemapLinks
+	ctx.addNewLinks(links)
+	if len(ctx.newLinks) != 2 || ctx.Status.QueueSize != 2 {
+		t.Errorf("addNewLinks() newLinks = %d, QueueSize = %d, want 2 and 2", len(ctx.newLinks), ctx.Status.QueueSize)
+	}
+
+	ctx.config.Crawler.SitemapMode = optSitemapOnly
+	ctx.addNewLinks(links)
+	if len(ctx.newLinks) != 2 {
+		t.Errorf("addNewLinks() added links in sitemap only mode")
+	}
+}
+
+func TestWriteWARCXHR(t *testing.T) {
+	entries := []map[string]interface{}{
+		{
+			"method":                "POST",
+			"url":                   "https://example.com/api",
+			"status":                float64(201),
+			"headers":               map[string]interface{}{"Content-Type": "application/json"},
+			"request_body":          map[string]interface{}{"q": "test"},
+			"response_headers":      map[string]interface{}{"Content-Type": "text/plain", "Content-Encoding": "gzip"},
+			"response_body":         "created",
+			"response_content_type": "text/plain",
+		},
+		{"method": "GET", "url": "https://example.com/pending", "response_body": ""},
+		{"method": "GET", "url": "https://example.com/no-headers", "status": float64(200), "response_body": "ok"},
+		{"method": "GET", "url": "not-a-url"},
+		nil,
+	}
+
+	var buf bytes.Buffer
+	w := warc.NewWriter(&buf, false)
+	archived, err := WriteWARCXHR(w, entries, time.Now())
+	if err != nil {
+		t.Fatalf("WriteWARCXHR() returned an error: %v", err)
+	}
+	if archived != 3 {
+		t.Errorf("WriteWARCXHR() archived %d entries, want 3", archived)
+	}
+
+	records, err := warc.Read(&buf)
+	if err != nil {
+		t.Fatalf("warc.Read() returned an error: %v", err)
+	}
+	types := []string{warc.TypeRequest, warc.TypeResponse, warc.TypeRequest, warc.TypeRequest}
+	if len(records) != len(types) {
+		t.Fatalf("expected %d records, got %d", len(types), len(records))
+	}
+	for i, r := range records {
+		if r.Type != types[i] {
+			t.Errorf("record %d type = %s, want %s", i, r.Type, types[i])
+		}
+	}
+	if !bytes.HasPrefix(records[0].Block, []byte("POST /api HTTP/1.1\r\n")) || !bytes.HasSuffix(records[0].Block, []byte(`{"q":"test"}`)) {
+		t.Errorf("unexpected request block: %q", records[0].Block)
+	}
+	if !bytes.HasPrefix(records[1].Block, []byte("HTTP/1.1 201 Created\r\nContent-Type: text/plain\r\n")) || records[1].ConcurrentTo != records[0].RecordID {
+		t.Errorf("unexpected response record: %+v", records[1])
+	}
+}
+
+func TestWarcResponseAvailable(t *testing.T) {
+	headers := http.Header{"Content-Type": {"text/plain"}}
+	tests := []struct {
+		name    string
+		status  int
+		headers http.Header
+		body    string
+		want    bool
+	}{
+		{"complete", 200, headers, "ok", true},
+		{"no status", 0, headers, "ok", false},
+		{"no headers", 200, nil, "ok", false},
+		{"no body", 200, headers, "", false},
+		{"no content", 204, headers, "", true},
+		{"not modified", 304, headers, "", true},
+	}
+	for _, tt := range tests {
+		if got := warcResponseAvailable(tt.status, tt.headers, []byte(tt.body)); got != tt.want {
+			t.Errorf("%s: warcResponseAvailable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteWARCPage(t *testing.T) {
+	page := &WARCPage{
+		URL:             "https://example.com/",
+		RequestHeaders:  http.Header{"Accept": {"text/html"}},
+		Status:          200,
+		ResponseHeaders: http.Header{"Content-Type": {"text/html"}},
+		ResponseBody:    []byte("<html><body></body></html>"),
+		ContentType:     "text/html",
+		Content:         []byte("<html></html>"),
+	}
+
+	var buf bytes.Buffer
+	w := warc.NewWriter(&buf, false)
+	if err := WriteWARCPage(w, page, time.Now()); err != nil {
+		t.Fatalf("WriteWARCPage() returned an error: %v", err)
+	}
+	records, err := warc.Read(&buf)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("warc.Read() returned %d records (%v), want 3", len(records), err)
+	}
+	if records[0].Type != warc.TypeRequest || !bytes.HasPrefix(records[0].Block, []byte("GET / HTTP/1.1\r\n")) {
+		t.Errorf("unexpected request record: %+v", records[0])
+	}
+	if records[1].Type != warc.TypeResponse || !bytes.HasSuffix(records[1].Block, page.ResponseBody) {
+		t.Errorf("unexpected response record: %+v", records[1])
+	}
+	if records[2].Type != warc.TypeConversion || records[2].ContentType != "text/html" || string(records[2].Block) != "<html></html>" ||
+		records[2].Fields["WARC-Refers-To"] != records[1].RecordID {
+		t.Errorf("unexpected page record: %+v", records[2])
+	}
+
+	// Without the response, only the rendered content is archived
+	buf.Reset()
+	page.Status = 0
+	if err := WriteWARCPage(w, page, time.Now()); err != nil {
+		t.Fatalf("WriteWARCPage() returned an error: %v", err)
+	}
+	records, err = warc.Read(&buf)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("warc.Read() returned %d records (%v), want 1", len(records), err)
+	}
+	if records[0].Type != warc.TypeConversion || records[0].Fields["WARC-Refers-To"] != "" {
+		t.Errorf("unexpected page record: %+v", records[0])
+	}
+}
+
+func TestFindWARCDocument(t *testing.T) {
+	logs := []selog.Message{
+		{Message: `{"message":{"method":"Network.requestWillBeSent","params":{"requestId":"1","type":"Document","request":{"url":"https://example.com/","method":"GET","headers":{"Accept":"text/html"}}}}}`},
+		{Message: `{"message":{"method":"Network.requestWillBeSent","params":{"requestId":"2","type":"Script","request":{"url":"https://example.com/app.js","method":"GET","headers":{}}}}}`},
+		{Message: `{"message":{"method":"Network.responseReceived","params":{"requestId":"2","type":"Script","response":{"url":"https://example.com/app.js","status":200,"headers":{"Content-Type":"text/javascript"}}}}}`},
+		{Message: `{"message":{"method":"Network.responseReceived","params":{"requestId":"1","type":"Document","response":{"url":"https://example.com/","status":200,"headers":{"Content-Type":"text/html","Set-Cookie":"a=1\nb=2"}}}}}`},
+		{Message: `not json`},
+	}
+
+	page, requestID := findWARCDocument(logs, "https://example.com")
+	if page == nil {
+		t.Fatalf("findWARCDocument() didn't find the document")
+	}
+	if requestID != "1" || page.Method != "GET" || page.Status != 200 || page.URL != "https://example.com/" {
+		t.Errorf("findWARCDocument() = %+v, %q", page, requestID)
+	}
+	if page.RequestHeaders.Get("Accept") != "text/html" || len(page.ResponseHeaders.Values("Set-Cookie")) != 2 {
+		t.Errorf("unexpected headers: %v %v", page.RequestHeaders, page.ResponseHeaders)
+	}
+
+	if page, _ := findWARCDocument(logs, "https://example.com/other"); page != nil {
+		t.Errorf("findWARCDocument() found a document for another URL: %+v", page)
+	}
+}
+
+func TestHARDocument(t *testing.T) {
+	doc := &har.HAR{}
+	doc.Log.Entries = []har.Entry{
+		{
+			Request:  har.Request{Method: "GET", URL: "https://example.com/", Headers: []har.NameValue{{Name: "Accept", Value: "text/html"}}},
+			Response: har.Response{Status: 200, Headers: []har.NameValue{{Name: "Content-Type", Value: "text/html"}}, Content: har.Content{Text: "PGh0bWw+PC9odG1sPg==", Encoding: "base64"}},
+		},
+		{
+			Request:  har.Request{Method: "GET", URL: "https://example.com/big"},
+			Response: har.Response{Status: 200, Content: har.Content{Comment: "body omitted"}},
+		},
+	}
+
+	page := HARDocument(doc, "https://example.com")
+	if page == nil {
+		t.Fatalf("HARDocument() didn't find the document")
+	}
+	if string(page.ResponseBody) != "<html></html>" || page.RequestHeaders.Get("Accept") != "text/html" || page.ResponseHeaders.Get("Content-Type") != "text/html" {
+		t.Errorf("HARDocument() = %+v", page)
+	}
+	if page := HARDocument(doc, "https://example.com/big"); page != nil {
+		t.Errorf("HARDocument() returned a document without its body: %+v", page)
+	}
+	if page := HARDocument(nil, "https://example.com"); page != nil {
+		t.Errorf("HARDocument(nil) = %+v, want nil", page)
+	}
+}
+
+func TestSaveFileLocal(t *testing.T) {
+	saveCfg := cfg.FileStorageAPI{Type: "local", Path: t.TempDir()}
+	location, err := SaveFile(WARCDir+"/test.warc.gz", []byte("data"), saveCfg)
+	if err != nil {
+		t.Fatalf("SaveFile() returned an error: %v", err)
+	}
+	data, err := os.ReadFile(location) //nolint:gosec // test file
+	if err != nil || string(data) != "data" {
+		t.Errorf("SaveFile() wrote %q (%v), want %q", data, err, "data")
+	}
+
+	if _, err := SaveFile("test", nil, cfg.FileStorageAPI{Type: "ftp"}); err == nil {
+		t.Errorf("expected an error for an unsupported storage type")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	saveCfg := cfg.FileStorageAPI{Type: "local", Path: t.TempDir()}
+	location, err := SaveFile("test.png", []byte("data"), saveCfg)
+	if err != nil {
+		t.Fatalf("SaveFile() returned an error: %v", err)
+	}
+	data, err := LoadFile(location, saveCfg)
+	if err != nil || string(data) != "data" {
+		t.Errorf("LoadFile() read %q (%v), want %q", data, err, "data")
+	}
+
+	for _, location := range []string{"ftp://example.com/test.png", "s3://bucket", "s3:///test.png"} {
+		if _, err := LoadFile(location, saveCfg); err == nil {
+			t.Errorf("LoadFile(%q): expected an error", location)
+		}
+	}
+}
+
 func TestCheckMaxDepth(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -298,3 +636,30 @@ func TestIsValidURIProtocol(t *testing.T) {
 		})
 	}
 }
+
+func TestDocumentValidators(t *testing.T) {
+	entry := func(method, typ, url string, headers map[string]string) PerformanceLogEntry {
+		return PerformanceLogEntry{Message: LogMessage{Method: method, Params: LogParams{
+			Type:         typ,
+			ResponseInfo: LogResponseInfo{URL: url, Headers: headers},
+		}}}
+	}
+	pageInfo := &PageInfo{URL: "https://example.com/page"}
+	pageInfo.PerfInfo.LogEntries = []PerformanceLogEntry{
+		entry("Network.responseReceived", "Script", "https://example.com/app.js", map[string]string{"ETag": `"script"`}),
+		entry("Network.requestWillBeSent", "Document", "https://example.com/page", map[string]string{"ETag": `"request"`}),
+		entry("Network.responseReceived", "Document", "https://example.com/page", map[string]string{
+			"etag":          `"v1"`,
+			"last-modified": "Mon, 02 Jan 2006 15:04:05 GMT",
+		}),
+	}
+	want := httpi.Validators{ETag: `"v1"`, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}
+	if got := documentValidators(pageInfo); got != want {
+		t.Errorf("documentValidators() = %+v, want %+v", got, want)
+	}
+
+	pageInfo.URL = "https://example.com/other"
+	if got := documentValidators(pageInfo); got != (httpi.Validators{}) {
+		t.Errorf("documentValidators() = %+v for a page without a logged response", got)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawler library for the Crowler
+package crawler
+
+import (
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+// frontierEnabled returns true if the crawl frontier has to be persisted in the DB
+func (ctx *ProcessContext) frontierEnabled() bool {
+	return ctx.config.Crawler.PersistentFrontier &&
+		ctx.db != nil && *ctx.db != nil &&
+		ctx.source != nil && ctx.source.ID != 0
+}
+
+// frontierStart prepares the frontier of the source for a crawl. If the
+// previous crawl of the source was interrupted, it returns the links that
+// still need to be crawled at the depth to resume from (resumeLinks), the
+// links already queued for the following depth (nextLinks) and true.
+// Otherwise it resets the frontier, enqueues initialLinks and returns false.
+func (ctx *ProcessContext) frontierStart(initialLinks []LinkItem) (resumeLinks []LinkItem, nextLinks []LinkItem, depth int, resumed bool) {
+	if !ctx.frontierEnabled() {
+		return nil, nil, 0, false
+	}
+
+	pending, err := cdb.FrontierPending(ctx.db, ctx.source.ID)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "retrieving crawl frontier: %v", err)
+		return nil, nil, 0, false
+	}
+
+	if len(pending) == 0 {
+		// Nothing to resume, start a fresh crawl
+		if err := cdb.FrontierClear(ctx.db, ctx.source.ID); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "clearing crawl frontier: %v", err)
+		}
+		ctx.frontierEnqueue(initialLinks, 0)
+		return nil, nil, 0, false
+	}
+
+	// Mark the URLs we have already crawled as visited
+	completed, err := cdb.FrontierCompleted(ctx.db, ctx.source.ID)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "retrieving crawled URLs from the frontier: %v", err)
+	}
+	for _, item := range completed {
+		link := item.URL
+		if strings.HasPrefix(link, "/") {
+			link, _ = combineURLs(ctx.source.URL, link)
+		}
+		ctx.visitedLinks[cmn.NormalizeURL(link)] = true
+	}
+
+	resumeLinks, nextLinks, depth = frontierToLinks(pending)
+	cmn.DebugMsg(cmn.DbgLvlInfo, "Resuming crawl of source %d from depth %d: %d links pending, %d already crawled", ctx.source.ID, depth, len(pending), len(completed))
+	return resumeLinks, nextLinks, depth, true
+}
+
+// frontierToLinks converts the pending frontier items (ordered by depth) into
+// the links to crawl at the lowest depth and the links for the depths after it.
+func frontierToLinks(items []cdb.FrontierItem) ([]LinkItem, []LinkItem, int) {
+	if len(items) == 0 {
+		return nil, nil, 0
+	}
+
+	depth := items[0].Depth
+	var current, next []LinkItem
+	for _, item := range items {
+		link := LinkItem{
+			PageURL:     item.ParentURL,
+			PageLevel:   item.Depth,
+			Link:        item.URL,
+			ElementID:   item.ElementID,
+			FromSitemap: item.FromSitemap,
+		}
+		if item.Depth <= depth {
+			current = append(current, link)
+		} else {
+			next = append(next, link)
+		}
+	}
+	return current, next, depth
+}
+
+// frontierEnqueue stores links in the frontier, to be crawled at the given depth
+func (ctx *ProcessContext) frontierEnqueue(links []LinkItem, depth int) {
+	if !ctx.frontierEnabled() || len(links) == 0 {
+		return
+	}
+
+	items := make([]cdb.FrontierItem, 0, len(links))
+	for _, link := range links {
+		items = append(items, cdb.FrontierItem{
+			URL:         link.Link,
+			ParentURL:   link.PageURL,
+			Depth:       depth,
+			ElementID:   link.ElementID,
+			FromSitemap: link.FromSitemap,
+		})
+	}
+	if _, err := cdb.FrontierEnqueue(ctx.db, ctx.source.ID, items); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "adding links to the crawl frontier: %v", err)
+	}
+}
+
+// frontierSetStatus updates the status of a link in the frontier
+func (ctx *ProcessContext) frontierSetStatus(link, status string, err error) {
+	if !ctx.frontierEnabled() {
+		return
+	}
+
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+	if err := cdb.FrontierSetStatus(ctx.db, ctx.source.ID, link, status, lastError); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "updating crawl frontier: %v", err)
+	}
+}
+
+// frontierFinish removes the links left in the frontier by a completed crawl
+// (for example the ones not crawled because of max_links), so the next crawl
+// of the source won't try to resume it.
+func (ctx *ProcessContext) frontierFinish() {
+	if !ctx.frontierEnabled() {
+		return
+	}
+
+	if err := cdb.FrontierDropPending(ctx.db, ctx.source.ID); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "cleaning up crawl frontier: %v", err)
+	}
+	ctx.linksMutex.Lock()
+	ctx.Status.QueueSize = 0
+	ctx.linksMutex.Unlock()
+}
+
+// addNewLinks adds the links found in a page to the links to crawl at the
+// next depth (and to the frontier, so they are not lost if the crawl is
+// interrupted)
+func (ctx *ProcessContext) addNewLinks(links []LinkItem) {
+	if len(links) == 0 {
+		return
+	}
+	if strings.ToLower(strings.TrimSpace(ctx.config.Crawler.SitemapMode)) == optSitemapOnly {
+		// In sitemap only mode we don't follow the links found in the pages
+		return
+	}
+
+	ctx.linksMutex.Lock()
+	ctx.newLinks = append(ctx.newLinks, links...)
+	ctx.Status.QueueSize += len(links)
+	ctx.linksMutex.Unlock()
+
+	ctx.frontierEnqueue(links, ctx.Status.CurrentDepth+1)
+}
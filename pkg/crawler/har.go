@@ -0,0 +1,183 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawler library for the Crowler
+package crawler
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+
+	selog "github.com/go-auxiliaries/selenium/log"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	"github.com/pzaino/thecrowler/pkg/har"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// getPerformanceLogs returns the browser performance logs collected since the
+// last call (the browser returns each log entry only once). If a HAR is being
+// collected for the current page, the network events are also added to it.
+func getPerformanceLogs(ctx *ProcessContext, wd vdi.WebDriver) ([]selog.Message, error) {
+	logs, err := readPerformanceLogs(ctx, wd)
+	if err != nil {
+		return logs, err
+	}
+
+	// Return the entries already read by peekPerformanceLogs first
+	ctx.perfLogsMutex.Lock()
+	logs = append(ctx.perfLogs, logs...)
+	ctx.perfLogs = nil
+	ctx.perfLogsMutex.Unlock()
+
+	return logs, nil
+}
+
+// peekPerformanceLogs returns the browser performance logs collected since the
+// last call of getPerformanceLogs, without consuming them (so they are still
+// returned by the next call of getPerformanceLogs).
+func peekPerformanceLogs(ctx *ProcessContext, wd vdi.WebDriver) ([]selog.Message, error) {
+	logs, err := readPerformanceLogs(ctx, wd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.perfLogsMutex.Lock()
+	defer ctx.perfLogsMutex.Unlock()
+	ctx.perfLogs = append(ctx.perfLogs, logs...)
+	return append([]selog.Message(nil), ctx.perfLogs...), nil
+}
+
+// readPerformanceLogs reads the new performance logs from the browser and adds
+// their network events to the HAR of the current page (if collecting a HAR)
+func readPerformanceLogs(ctx *ProcessContext, wd vdi.WebDriver) ([]selog.Message, error) {
+	logs, err := wd.Log(selog.Performance)
+	if err != nil {
+		return logs, err
+	}
+	if builder := ctx.harBuilder(); builder != nil {
+		for _, entry := range logs {
+			if err := builder.AddLogMessage(entry.Message); err != nil {
+				cmn.DebugMsg(cmn.DbgLvlDebug5, "HAR: invalid performance log entry: %v", err)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// flushPerformanceLogs discards the performance logs read (but not consumed)
+// so far, so they aren't attributed to the page that is about to be loaded
+func (ctx *ProcessContext) flushPerformanceLogs() {
+	ctx.perfLogsMutex.Lock()
+	ctx.perfLogs = nil
+	ctx.perfLogsMutex.Unlock()
+}
+
+// harBuilder returns the HAR builder of the current page (nil if not collecting a HAR)
+func (ctx *ProcessContext) harBuilder() *har.Builder {
+	ctx.harMutex.Lock()
+	defer ctx.harMutex.Unlock()
+	return ctx.har
+}
+
+// harStart starts collecting the HAR of the page that is about to be loaded
+// (if collect_har is enabled). Log entries left over by the previous page are
+// discarded.
+func (ctx *ProcessContext) harStart(wd vdi.WebDriver) {
+	ctx.flushPerformanceLogs()
+	if !ctx.config.Crawler.CollectHAR {
+		return
+	}
+	ctx.harMutex.Lock()
+	ctx.har = nil
+	ctx.harMutex.Unlock()
+
+	if _, err := wd.Log(selog.Performance); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "HAR: flushing performance logs: %v", err)
+	}
+
+	ctx.harMutex.Lock()
+	ctx.har = har.NewBuilder()
+	ctx.harMutex.Unlock()
+}
+
+// collectHAR completes the HAR of the current page (collecting the remaining
+// network events and the response bodies) and stores it in pageInfo
+func collectHAR(ctx *ProcessContext, pageInfo *PageInfo) {
+	builder := ctx.harBuilder()
+	if builder == nil {
+		return
+	}
+	wd := ctx.wd
+
+	// Collect the events logged since the last read
+	if _, err := getPerformanceLogs(ctx, wd); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "HAR: retrieving performance logs: %v", err)
+	}
+
+	// Collect the response bodies (while they are still available in the browser)
+	for _, requestID := range builder.PendingBodies() {
+		body, isBase64 := fetchResponseBody(wd, requestID)
+		builder.SetResponseBody(requestID, body, isBase64)
+	}
+
+	title, _ := wd.Title()
+	pageInfo.har = builder.Build(title)
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "HAR collected with %d entries", len(pageInfo.har.Log.Entries))
+
+	ctx.harMutex.Lock()
+	ctx.har = nil
+	ctx.harMutex.Unlock()
+}
+
+// insertHARObject stores the HAR of a page as a web object of the page
+func insertHARObject(tx *sql.Tx, indexID uint64, pageInfo *PageInfo) error {
+	if pageInfo.har == nil || len(pageInfo.har.Log.Entries) == 0 {
+		return nil
+	}
+
+	harJSON, err := json.Marshal(pageInfo.har)
+	if err != nil {
+		return err
+	}
+	details, err := json.Marshal(map[string]interface{}{
+		"har": map[string]interface{}{
+			"page_url": pageInfo.URL,
+			"entries":  len(pageInfo.har.Log.Entries),
+			"version":  pageInfo.har.Log.Version,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(harJSON)
+
+	var objID int64
+	err = tx.QueryRow(`
+		INSERT INTO WebObjects (object_type, object_hash, object_content, details)
+		VALUES ($1, $2, $3, $4::jsonb)
+		ON CONFLICT (object_hash) DO UPDATE
+		SET last_updated_at = CURRENT_TIMESTAMP
+		RETURNING object_id;`, har.ContentType, hex.EncodeToString(hash[:]), string(harJSON), details).Scan(&objID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO WebObjectsIndex (index_id, object_id)
+		VALUES ($1, $2)
+		ON CONFLICT (index_id, object_id) DO NOTHING`, indexID, objID)
+	return err
+}
@@ -0,0 +1,197 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawler library for the Crowler
+package crawler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	httpi "github.com/pzaino/thecrowler/pkg/httpinfo"
+)
+
+// checkPageChanges sends a conditional request for pageURL (using the
+// validators stored at the previous crawl) and returns its result. If the
+// page is unchanged, its last_updated_at is bumped and the links it
+// contained at the previous crawl are added to the links to crawl, so the
+// caller can skip rendering, scraping and indexing it.
+// It returns nil if conditional re-crawl is disabled, the check failed or
+// there is nothing to compare the page with (no validators were stored at
+// the previous crawl, or the page has never been crawled), so pages are
+// never requested twice just to find out they have to be rendered anyway.
+func checkPageChanges(processCtx *ProcessContext, id int, pageURL string) *httpi.ChangeCheck {
+	if !processCtx.config.Crawler.ConditionalRecrawl || processCtx.db == nil || *processCtx.db == nil {
+		return nil
+	}
+
+	previous, err := getPageValidators(*processCtx.db, pageURL)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Worker %d: retrieving validators for %s: %v", id, pageURL, err)
+		return nil
+	}
+	if previous == (httpi.Validators{}) {
+		return nil
+	}
+
+	c := httpi.Config{
+		URL:             pageURL,
+		CustomHeader:    map[string]string{"User-Agent": cmn.UsrAgentStrMap["desktop01"]},
+		FollowRedirects: true,
+		Timeout:         processCtx.config.Crawler.Timeout,
+	}
+	if len(processCtx.config.Selenium) > processCtx.SelID {
+		browser := processCtx.config.Selenium[processCtx.SelID].Type
+		c.CustomHeader["User-Agent"] = cmn.UsrAgentStrMap[browser+"-desktop01"]
+	}
+	changes, err := httpi.CheckForChanges(c, previous)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: checking %s for changes: %v", id, pageURL, err)
+		return nil
+	}
+	if !changes.Unchanged {
+		return changes
+	}
+
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Page %s unchanged since the last crawl, skipping it", id, pageURL)
+	processCtx.Status.TotalUnchanged++
+	if changes.NotModified {
+		processCtx.Status.TotalNotMod++
+	}
+	if err := touchPage(*processCtx.db, pageURL, changes.Validators); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Worker %d: updating unchanged page %s: %v", id, pageURL, err)
+	}
+
+	// Keep following the links of the unchanged page
+	links, err := getIndexedPageLinks(*processCtx.db, pageURL)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Worker %d: retrieving links of unchanged page %s: %v", id, pageURL, err)
+	}
+	newLinks := make([]LinkItem, 0, len(links))
+	for _, link := range links {
+		newLinks = append(newLinks, LinkItem{
+			PageURL:   pageURL,
+			PageLevel: processCtx.Status.CurrentDepth + 1,
+			Link:      link,
+		})
+	}
+	processCtx.addNewLinks(newLinks)
+
+	return changes
+}
+
+// getPageValidators returns the validators stored for an indexed page
+// (empty validators if the page has never been indexed)
+func getPageValidators(db cdb.Handler, pageURL string) (httpi.Validators, error) {
+	var v httpi.Validators
+	err := db.QueryRow(`
+		SELECT COALESCE(etag, ''), COALESCE(last_modified, ''), COALESCE(content_hash, '')
+		FROM SearchIndex
+		WHERE page_url = $1`, pageURL).Scan(&v.ETag, &v.LastModified, &v.ContentHash)
+	if err == sql.ErrNoRows {
+		return httpi.Validators{}, nil
+	}
+	return v, err
+}
+
+// storePageValidators stores the validators of an indexed page, so the next
+// crawl can check if it has changed
+func storePageValidators(db cdb.Handler, pageURL string, v httpi.Validators) error {
+	_, err := db.Exec(`
+		UPDATE SearchIndex
+		SET etag = $1, last_modified = $2, content_hash = $3
+		WHERE page_url = $4`,
+		strLeft(v.ETag, 512), strLeft(v.LastModified, 64), v.ContentHash, pageURL)
+	return err
+}
+
+// insertPageValidators stores the ETag and Last-Modified the page was served
+// with (as logged by the browser), so the next crawl can check if the page
+// has changed without a previous conditional request.
+func insertPageValidators(tx *sql.Tx, indexID uint64, pageInfo *PageInfo) error {
+	v := documentValidators(pageInfo)
+	if v.ETag == "" && v.LastModified == "" {
+		return nil
+	}
+	_, err := tx.Exec(`
+		UPDATE SearchIndex
+		SET etag = $1, last_modified = $2
+		WHERE index_id = $3`,
+		strLeft(v.ETag, 512), strLeft(v.LastModified, 64), indexID)
+	return err
+}
+
+// documentValidators returns the ETag and Last-Modified of the response the
+// page was served with, looking it up in the browser logs of the page
+func documentValidators(pageInfo *PageInfo) httpi.Validators {
+	var v httpi.Validators
+	for _, entry := range pageInfo.PerfInfo.LogEntries {
+		params := entry.Message.Params
+		if entry.Message.Method != "Network.responseReceived" || params.Type != "Document" ||
+			cmn.NormalizeURL(params.ResponseInfo.URL) != cmn.NormalizeURL(pageInfo.URL) {
+			continue
+		}
+		// Header names are lower-case on HTTP/2 and later
+		for name, value := range params.ResponseInfo.Headers {
+			switch strings.ToLower(name) {
+			case "etag":
+				v.ETag = value
+			case "last-modified":
+				v.LastModified = value
+			}
+		}
+	}
+	return v
+}
+
+// touchPage bumps the last_updated_at of an unchanged page (and refreshes its validators)
+func touchPage(db cdb.Handler, pageURL string, v httpi.Validators) error {
+	_, err := db.Exec(`
+		UPDATE SearchIndex
+		SET last_updated_at = NOW(), etag = $1, last_modified = $2, content_hash = $3
+		WHERE page_url = $4`,
+		strLeft(v.ETag, 512), strLeft(v.LastModified, 64), v.ContentHash, pageURL)
+	return err
+}
+
+// getIndexedPageLinks returns the links collected the last time a page was indexed
+func getIndexedPageLinks(db cdb.Handler, pageURL string) ([]string, error) {
+	var details []byte
+	err := db.QueryRow(`
+		SELECT wo.details
+		FROM WebObjects wo
+		JOIN WebObjectsIndex woi ON wo.object_id = woi.object_id
+		JOIN SearchIndex si ON si.index_id = woi.index_id
+		WHERE si.page_url = $1
+		  AND wo.object_type <> 'application/har+json'
+		ORDER BY woi.created_at DESC, wo.object_id DESC
+		LIMIT 1`, pageURL).Scan(&details)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Links []string `json:"links"`
+	}
+	if err := json.Unmarshal(details, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Links, nil
+}
@@ -428,7 +428,11 @@ func extractDataFromElement(_ *ProcessContext, item interface{}, selector rs.Sel
 
 	if pattern != "" && pattern != ".*" {
 		// Extract the data using the provided regex
-		re := regexp.MustCompile(pattern)
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "Invalid extraction pattern '%s': %v", pattern, err)
+			return results
+		}
 		if allMatches := re.FindAllString(data, -1); len(allMatches) > 0 {
 			results = append(results, allMatches...)
 		}
@@ -552,7 +556,11 @@ func fallbackExtractByXPath(ctx *ProcessContext, doc *goquery.Document, selector
 }
 
 func fallbackExtractByRegex(content string, pattern string, all bool) []string {
-	re := regexp.MustCompile(pattern)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Invalid regex selector '%s': %v", pattern, err)
+		return nil
+	}
 
 	if all {
 		// Find all matches
@@ -0,0 +1,64 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawler library for the Crowler
+package crawler
+
+import (
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	sitemap "github.com/pzaino/thecrowler/pkg/sitemap"
+)
+
+// getSitemapLinks discovers the sitemaps of the source (from its robots.txt
+// or the default /sitemap.xml location) and returns the URLs they contain
+// as links to crawl, ordered by priority and most recent lastmod.
+func getSitemapLinks(processCtx *ProcessContext) []LinkItem {
+	userAgent := processCtx.config.Crawler.RobotsUserAgent
+	timeout := processCtx.config.Crawler.Timeout
+
+	var robotsSitemaps []string
+	robotsData, err := robotsCache.Get(processCtx.source.URL, userAgent, timeout)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Unable to retrieve robots.txt for sitemaps discovery: %v", err)
+	} else if robotsData != nil {
+		robotsSitemaps = robotsData.Sitemaps
+	}
+
+	sitemaps := sitemap.Discover(processCtx.source.URL, robotsSitemaps)
+	if len(sitemaps) == 0 {
+		return nil
+	}
+
+	urls, err := sitemap.Collect(sitemaps, sitemap.Options{
+		UserAgent: userAgent,
+		Timeout:   timeout,
+		MaxURLs:   processCtx.config.Crawler.MaxLinks,
+	})
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "collecting sitemaps for %s: %v", processCtx.source.URL, err)
+		return nil
+	}
+	cmn.DebugMsg(cmn.DbgLvlInfo, "Found %d URLs in the sitemaps of %s", len(urls), processCtx.source.URL)
+
+	links := make([]LinkItem, 0, len(urls))
+	for _, u := range urls {
+		links = append(links, LinkItem{
+			PageURL:     u.Sitemap,
+			PageLevel:   1,
+			Link:        u.Loc,
+			FromSitemap: true,
+		})
+	}
+	return links
+}
@@ -23,6 +23,7 @@ import (
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 	cdb "github.com/pzaino/thecrowler/pkg/database"
 	detect "github.com/pzaino/thecrowler/pkg/detection"
+	"github.com/pzaino/thecrowler/pkg/har"
 	httpi "github.com/pzaino/thecrowler/pkg/httpinfo"
 	neti "github.com/pzaino/thecrowler/pkg/netinfo"
 	rs "github.com/pzaino/thecrowler/pkg/ruleset"
@@ -53,6 +54,9 @@ type Status struct {
 	TotalLinks      int
 	TotalSkipped    int
 	TotalDuplicates int
+	TotalRobotsDeny int // Links skipped because disallowed by robots.txt (also counted in TotalSkipped)
+	TotalUnchanged  int // Pages not rendered because unchanged since the last crawl
+	TotalNotMod     int // Unchanged pages detected via 304 Not Modified (also counted in TotalUnchanged)
 	TotalErrors     int
 	TotalScraped    int
 	TotalActions    int
@@ -60,6 +64,7 @@ type Status struct {
 	StartTime       time.Time
 	EndTime         time.Time
 	CurrentDepth    int
+	QueueSize       int // Links waiting to be crawled (queued or in flight)
 	LastWait        float64
 	LastDelay       float64
 	LastError       string
@@ -98,6 +103,7 @@ type PageInfo struct {
 	ExtDetectionResults     []map[string]interface{}         `json:"external_detection_results"` // The results of the external detection tools.
 	CollectedSessionCookies map[string]interface{}           `json:"collected_session_cookies"`  // The session cookies collected from the web page.
 	Config                  *cfg.Config                      `json:"config"`                     // The configuration of the web page.
+	har                     *har.HAR                         // The HAR of the web page (stored as a separate web object).
 }
 
 // CollectedScript represents a single collected script.
@@ -270,6 +276,7 @@ type Screenshot struct {
 	ThumbnailWidth  int    `json:"thumbnail_width"`
 	ThumbnailLink   string `json:"thumbnail_link"`
 	Format          string `json:"format"`
+	data            []byte // The encoded image (used to archive the screenshot, it's not stored in the DB)
 }
 
 // ScraperRuleEngine extends RuleEngine from the ruleset package
@@ -279,10 +286,11 @@ type ScraperRuleEngine struct {
 
 // LinkItem represents a link item collected on a web page
 type LinkItem struct {
-	PageURL   string `json:"url"`
-	PageLevel int    `json:"level"`
-	Link      string `json:"link"`
-	ElementID string `json:"element_id"`
+	PageURL     string `json:"url"`
+	PageLevel   int    `json:"level"`
+	Link        string `json:"link"`
+	ElementID   string `json:"element_id"`
+	FromSitemap bool   `json:"from_sitemap,omitempty"`
 }
 
 var (
@@ -0,0 +1,447 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawler library for the Crowler
+package crawler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	selog "github.com/go-auxiliaries/selenium/log"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	"github.com/pzaino/thecrowler/pkg/har"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+	"github.com/pzaino/thecrowler/pkg/warc"
+)
+
+const (
+	// WARCDir is the directory (of the file storage) where WARC files are saved
+	WARCDir = "warc"
+	// WARCSoftware is the software name written in the warcinfo records
+	WARCSoftware = "TheCROWler"
+)
+
+// warcArchive is the WARC archive of a crawl. Records are written to a
+// temporary file, which is moved to the configured file storage when the
+// crawl is completed.
+type warcArchive struct {
+	file     *os.File
+	writer   *warc.Writer
+	filename string
+}
+
+// WARCFilename returns the name of the WARC file of a source crawled at time t
+func WARCFilename(sourceID uint64, t time.Time) string {
+	return fmt.Sprintf("s%d-%s.warc.gz", sourceID, t.UTC().Format("20060102150405"))
+}
+
+// WriteWARCInfo writes the warcinfo record describing a WARC file of the CROWler
+func WriteWARCInfo(w *warc.Writer, filename, sourceURL string) error {
+	hostname, _ := os.Hostname()
+	_, err := w.WriteWarcinfo(filename, map[string]string{
+		"software":   WARCSoftware,
+		"format":     "WARC File Format 1.1",
+		"conformsTo": "https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/",
+		"isPartOf":   sourceURL,
+		"hostname":   hostname,
+	})
+	return err
+}
+
+// WARCPage is the main document of a crawled page to archive
+type WARCPage struct {
+	URL             string      // URL of the document
+	Method          string      // Method of the request (GET if empty)
+	RequestHeaders  http.Header // Headers of the request
+	RequestBody     []byte      // Body of the request (if any)
+	Status          int         // Status of the response (0 if the response wasn't collected)
+	ResponseHeaders http.Header // Headers of the response
+	ResponseBody    []byte      // Body of the response (as received from the server)
+	ContentType     string      // MIME type of the rendered content
+	Content         []byte      // The DOM as rendered by the browser
+}
+
+// WriteWARCPage writes the request and response records of the main document
+// of a crawled page (if its response was collected) and its rendered content
+// as a conversion record referring to the response.
+func WriteWARCPage(w *warc.Writer, page *WARCPage, date time.Time) error {
+	refersTo := ""
+	if warcResponseAvailable(page.Status, page.ResponseHeaders, page.ResponseBody) {
+		method := page.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		reqID, err := w.WriteRequest(page.URL, method, page.RequestHeaders, page.RequestBody, date)
+		if err != nil {
+			return err
+		}
+		refersTo, err = w.WriteResponse(page.URL, page.Status, page.ResponseHeaders, page.ResponseBody, reqID, date)
+		if err != nil {
+			return err
+		}
+	}
+	if len(page.Content) == 0 {
+		return nil
+	}
+	_, err := w.WriteConversion(page.URL, page.ContentType, page.Content, refersTo, date)
+	return err
+}
+
+// cdpNetworkEvent is a network event of the browser performance logs
+type cdpNetworkEvent struct {
+	Message struct {
+		Method string `json:"method"`
+		Params struct {
+			RequestID string `json:"requestId"`
+			Type      string `json:"type"`
+			Request   struct {
+				Method   string                 `json:"method"`
+				Headers  map[string]interface{} `json:"headers"`
+				PostData string                 `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				URL     string                 `json:"url"`
+				Status  int                    `json:"status"`
+				Headers map[string]interface{} `json:"headers"`
+			} `json:"response"`
+		} `json:"params"`
+	} `json:"message"`
+}
+
+// findWARCDocument returns the request and response of the last main document
+// loaded from one of urls in the browser performance logs (nil if not found),
+// with the CDP request ID to fetch its body.
+func findWARCDocument(logs []selog.Message, urls ...string) (*WARCPage, string) {
+	wanted := map[string]bool{}
+	for _, u := range urls {
+		if u != "" {
+			wanted[cmn.NormalizeURL(u)] = true
+		}
+	}
+
+	requests := map[string]*WARCPage{}
+	var page *WARCPage
+	requestID := ""
+	for _, entry := range logs {
+		var event cdpNetworkEvent
+		if err := json.Unmarshal([]byte(entry.Message), &event); err != nil {
+			continue
+		}
+		params := event.Message.Params
+		if params.Type != "Document" {
+			continue
+		}
+		switch event.Message.Method {
+		case "Network.requestWillBeSent":
+			requests[params.RequestID] = &WARCPage{
+				Method:         params.Request.Method,
+				RequestHeaders: toHTTPHeader(params.Request.Headers),
+				RequestBody:    []byte(params.Request.PostData),
+			}
+		case "Network.responseReceived":
+			if !wanted[cmn.NormalizeURL(params.Response.URL)] {
+				continue
+			}
+			doc := &WARCPage{}
+			if req, ok := requests[params.RequestID]; ok {
+				*doc = *req
+			}
+			doc.URL = params.Response.URL
+			doc.Status = params.Response.Status
+			doc.ResponseHeaders = toHTTPHeader(params.Response.Headers)
+			page, requestID = doc, params.RequestID
+		}
+	}
+	return page, requestID
+}
+
+// HARDocument returns the request and response of the last entry of a HAR
+// that loaded pageURL (nil if not found or if its response body wasn't
+// collected).
+func HARDocument(doc *har.HAR, pageURL string) *WARCPage {
+	if doc == nil {
+		return nil
+	}
+	pageURL = cmn.NormalizeURL(pageURL)
+	for i := len(doc.Log.Entries) - 1; i >= 0; i-- {
+		entry := doc.Log.Entries[i]
+		if cmn.NormalizeURL(entry.Request.URL) != pageURL {
+			continue
+		}
+		if entry.Response.Content.Comment != "" {
+			// The body was omitted from the HAR
+			return nil
+		}
+		body := []byte(entry.Response.Content.Text)
+		if entry.Response.Content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+			if err != nil {
+				return nil
+			}
+			body = decoded
+		}
+		page := &WARCPage{
+			URL:             entry.Request.URL,
+			Method:          entry.Request.Method,
+			RequestHeaders:  harHeaders(entry.Request.Headers),
+			Status:          entry.Response.Status,
+			ResponseHeaders: harHeaders(entry.Response.Headers),
+			ResponseBody:    body,
+		}
+		if entry.Request.PostData != nil {
+			page.RequestBody = []byte(entry.Request.PostData.Text)
+		}
+		return page
+	}
+	return nil
+}
+
+// harHeaders converts the headers of a HAR entry to http.Header
+func harHeaders(headers []har.NameValue) http.Header {
+	h := http.Header{}
+	for _, header := range headers {
+		h.Add(header.Name, header.Value)
+	}
+	return h
+}
+
+// WriteWARCXHR writes the request (and, if available, response) records of
+// the XHR/fetch entries collected by collectXHR and returns the number of
+// entries archived.
+func WriteWARCXHR(w *warc.Writer, entries []map[string]interface{}, date time.Time) (int, error) {
+	archived := 0
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		url, _ := entry["url"].(string)
+		// WARC target URIs must be absolute (skip data: and blob: URLs)
+		if !IsValidURIProtocol(url) {
+			continue
+		}
+		method, _ := entry["method"].(string)
+		headers, _ := entry["headers"].(map[string]interface{})
+
+		reqID, err := w.WriteRequest(url, method, toHTTPHeader(headers), warcBody(entry["request_body"]), date)
+		if err != nil {
+			return archived, err
+		}
+		archived++
+
+		status := 0
+		if s, ok := entry["status"].(float64); ok {
+			status = int(s)
+		}
+		respHeaders, _ := entry["response_headers"].(map[string]interface{})
+		respBody := warcBody(entry["response_body"])
+		if !warcResponseAvailable(status, toHTTPHeader(respHeaders), respBody) {
+			// The response of this request wasn't (fully) collected
+			continue
+		}
+		if _, err := w.WriteResponse(url, status, toHTTPHeader(respHeaders), respBody, reqID, date); err != nil {
+			return archived, err
+		}
+	}
+	return archived, nil
+}
+
+// warcResponseAvailable returns true if the status, the headers and the body
+// of a response have been collected (some responses have no body)
+func warcResponseAvailable(status int, headers http.Header, body []byte) bool {
+	if status == 0 || len(headers) == 0 {
+		return false
+	}
+	bodyless := status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified
+	return bodyless || len(body) > 0
+}
+
+// WriteWARCScreenshot writes a screenshot of pageURL as a resource record
+func WriteWARCScreenshot(w *warc.Writer, pageURL, format string, data []byte, date time.Time) error {
+	if format == "" {
+		format = "png"
+	}
+	_, err := w.WriteResource("urn:crowler:screenshot:"+pageURL, "image/"+format, data, date)
+	return err
+}
+
+// toHTTPHeader converts the headers collected from the browser to http.Header
+func toHTTPHeader(headers map[string]interface{}) http.Header {
+	h := http.Header{}
+	for name, value := range headers {
+		if values, ok := value.([]interface{}); ok {
+			for _, v := range values {
+				h.Add(name, fmt.Sprint(v))
+			}
+			continue
+		}
+		// The browser joins multiple values of the same header with new lines
+		for _, v := range strings.Split(fmt.Sprint(value), "\n") {
+			h.Add(name, v)
+		}
+	}
+	return h
+}
+
+// warcBody returns the bytes of a collected (and possibly decoded) body
+func warcBody(body interface{}) []byte {
+	switch b := body.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(b)
+	case []byte:
+		return b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return []byte(fmt.Sprint(b))
+		}
+		return data
+	}
+}
+
+// warcStart opens the WARC archive of the crawl (if collect_warc is enabled)
+func (ctx *ProcessContext) warcStart() {
+	if !ctx.config.Crawler.CollectWARC {
+		return
+	}
+
+	file, err := os.CreateTemp("", "crowler-*.warc.gz")
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "creating WARC file: %v", err)
+		return
+	}
+	archive := &warcArchive{
+		file:     file,
+		writer:   warc.NewWriter(file, true),
+		filename: WARCFilename(ctx.source.ID, time.Now()),
+	}
+	if err := WriteWARCInfo(archive.writer, archive.filename, ctx.source.URL); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "writing WARC info record: %v", err)
+	}
+	ctx.warc = archive
+	cmn.DebugMsg(cmn.DbgLvlDebug, "WARC archive %s opened for source %d", archive.filename, ctx.source.ID)
+}
+
+// warcFinish closes the WARC archive of the crawl and saves it to the file storage
+func (ctx *ProcessContext) warcFinish() {
+	archive := ctx.warc
+	if archive == nil {
+		return
+	}
+	ctx.warc = nil
+
+	tmpName := archive.file.Name()
+	defer os.Remove(tmpName) //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+	if err := archive.file.Close(); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "closing WARC file: %v", err)
+		return
+	}
+
+	file, err := os.Open(tmpName) //nolint:gosec // tmpName is created by os.CreateTemp
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "reading WARC file: %v", err)
+		return
+	}
+	defer file.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	location, err := SaveFileFrom(WARCDir+"/"+archive.filename, file, ctx.config.FileStorageAPI)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "saving WARC file %s: %v", archive.filename, err)
+		return
+	}
+	cmn.DebugMsg(cmn.DbgLvlInfo, "WARC archive saved (%d records): %s", archive.writer.Records(), location)
+}
+
+// warcWriter returns the WARC writer of the crawl (nil if not archiving)
+func (ctx *ProcessContext) warcWriter() *warc.Writer {
+	if ctx.warc == nil {
+		return nil
+	}
+	return ctx.warc.writer
+}
+
+// warcRecordPage archives the page currently loaded in the VDI: the HTTP
+// exchange of its main document (from the browser network events) and its
+// rendered content
+func (ctx *ProcessContext) warcRecordPage(wd *vdi.WebDriver, pageURL, docType string) {
+	w := ctx.warcWriter()
+	if w == nil {
+		return
+	}
+
+	content, err := (*wd).PageSource()
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "getting page source for the WARC archive: %v", err)
+		return
+	}
+	if !strings.Contains(docType, "/") {
+		docType = ""
+	}
+
+	page := &WARCPage{URL: pageURL}
+	logs, err := peekPerformanceLogs(ctx, *wd)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "retrieving performance logs for the WARC archive: %v", err)
+	}
+	currentURL, _ := (*wd).CurrentURL()
+	if doc, requestID := findWARCDocument(logs, pageURL, currentURL); doc != nil {
+		body, isBase64 := fetchResponseBody(*wd, requestID)
+		if isBase64 {
+			if decoded, err := base64.StdEncoding.DecodeString(body); err == nil {
+				body = string(decoded)
+			} else {
+				body = ""
+			}
+		}
+		doc.ResponseBody = []byte(body)
+		page = doc
+	} else {
+		cmn.DebugMsg(cmn.DbgLvlDebug3, "WARC: response of %s not found in the network events, archiving its content only", pageURL)
+	}
+	page.ContentType = docType
+	page.Content = []byte(content)
+
+	if err := WriteWARCPage(w, page, time.Now()); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "archiving page %s: %v", pageURL, err)
+	}
+}
+
+// warcRecordXHR archives the XHR/fetch traffic collected on a page
+func (ctx *ProcessContext) warcRecordXHR(entries []map[string]interface{}) {
+	w := ctx.warcWriter()
+	if w == nil {
+		return
+	}
+	if _, err := WriteWARCXHR(w, entries, time.Now()); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "archiving XHR traffic: %v", err)
+	}
+}
+
+// warcRecordScreenshot archives a screenshot of a page
+func (ctx *ProcessContext) warcRecordScreenshot(pageURL string, ss Screenshot) {
+	w := ctx.warcWriter()
+	if w == nil || len(ss.data) == 0 {
+		return
+	}
+	if err := WriteWARCScreenshot(w, pageURL, ss.Format, ss.data, time.Now()); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "archiving screenshot of %s: %v", pageURL, err)
+	}
+}
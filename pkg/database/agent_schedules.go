@@ -0,0 +1,91 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database is responsible for handling the database setup, configuration and abstraction.
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// agentScheduleID returns the schedule_id (and event_sched_uid) of the
+// schedule of an agent. The agent schedules are stored in EventSchedules with
+// the agent name, no event_id and the cron expression as recurrence.
+func agentScheduleID(agentName string) string {
+	hash := sha256.Sum256([]byte("agent:" + agentName))
+	return hex.EncodeToString(hash[:])
+}
+
+// SyncAgentSchedule returns the stored schedule of an agent. If the agent
+// has no schedule yet, or its cron expression has changed, the schedule is
+// (re)set to run next at nextRun.
+func SyncAgentSchedule(db *Handler, agentName, schedule string, nextRun time.Time) (*AgentSchedule, error) {
+	scheduleID := agentScheduleID(agentName)
+	var s AgentSchedule
+	var lastRun sql.NullTime
+	err := (*db).QueryRow(`
+		SELECT agent_name, recurrence_interval, next_run, last_run, COALESCE(active, FALSE)
+		FROM EventSchedules
+		WHERE schedule_id = $1`, scheduleID).Scan(&s.AgentName, &s.Schedule, &s.NextRun, &lastRun, &s.Active)
+	switch {
+	case err == sql.ErrNoRows:
+		s = AgentSchedule{AgentName: agentName, Schedule: schedule, NextRun: nextRun.UTC(), Active: true}
+		_, err = (*db).Exec(`
+			INSERT INTO EventSchedules (schedule_id, event_sched_uid, agent_name, recurrence_interval, next_run, active)
+			VALUES ($1, $2, $3, $4, $5, TRUE)`, scheduleID, scheduleID, agentName, schedule, s.NextRun)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the schedule of agent %s: %v", agentName, err)
+		}
+		return &s, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to retrieve the schedule of agent %s: %v", agentName, err)
+	}
+	if lastRun.Valid {
+		s.LastRun = &lastRun.Time
+	}
+
+	if s.Schedule != schedule {
+		s.Schedule = schedule
+		s.NextRun = nextRun.UTC()
+		_, err = (*db).Exec(`
+			UPDATE EventSchedules
+			SET recurrence_interval = $1, next_run = $2, last_updated_at = CURRENT_TIMESTAMP
+			WHERE schedule_id = $3`, schedule, s.NextRun, scheduleID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update the schedule of agent %s: %v", agentName, err)
+		}
+	}
+	return &s, nil
+}
+
+// ClaimAgentScheduleRun moves the schedule of an agent from its due run to
+// nextRun. It returns false if the run was already claimed (for ex. by
+// another events service sharing the same database), in which case the
+// agent must not be executed.
+func ClaimAgentScheduleRun(db *Handler, s *AgentSchedule, nextRun time.Time) (bool, error) {
+	now := time.Now().UTC()
+	claimed, err := claimScheduleRun(db, agentScheduleID(s.AgentName), s.NextRun, nextRun.UTC(), now)
+	if err != nil {
+		return false, fmt.Errorf("failed to update the schedule of agent %s: %v", s.AgentName, err)
+	}
+	if claimed {
+		s.NextRun = nextRun.UTC()
+		s.LastRun = &now
+	}
+	return claimed, nil
+}
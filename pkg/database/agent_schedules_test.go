@@ -0,0 +1,54 @@
+package database
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+)
+
+func TestAgentSchedules(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	first := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	s, err := SyncAgentSchedule(&handler, "agent1", "0 10 * * *", first)
+	if err != nil {
+		t.Fatalf("SyncAgentSchedule() returned an error: %v", err)
+	}
+	if !s.NextRun.Equal(first) || !s.Active || s.LastRun != nil {
+		t.Errorf("unexpected new schedule: %+v", s)
+	}
+
+	// The stored next run is kept while the schedule doesn't change
+	s, err = SyncAgentSchedule(&handler, "agent1", "0 10 * * *", first.Add(time.Hour))
+	if err != nil || !s.NextRun.Equal(first) {
+		t.Fatalf("SyncAgentSchedule() = %+v, %v, want next run %v", s, err, first)
+	}
+
+	// A run can be claimed only once
+	second := first.Add(24 * time.Hour)
+	other := *s
+	claimed, err := ClaimAgentScheduleRun(&handler, s, second)
+	if err != nil || !claimed {
+		t.Fatalf("ClaimAgentScheduleRun() = %v, %v", claimed, err)
+	}
+	if !s.NextRun.Equal(second) || s.LastRun == nil {
+		t.Errorf("unexpected schedule after the claim: %+v", s)
+	}
+	claimed, err = ClaimAgentScheduleRun(&handler, &other, second)
+	if err != nil || claimed {
+		t.Errorf("ClaimAgentScheduleRun() of an already claimed run = %v, %v", claimed, err)
+	}
+
+	// A new schedule resets the next run
+	s, err = SyncAgentSchedule(&handler, "agent1", "@hourly", first.Add(time.Hour))
+	if err != nil || !s.NextRun.Equal(first.Add(time.Hour)) || s.Schedule != "@hourly" || s.LastRun == nil {
+		t.Errorf("SyncAgentSchedule() after a schedule change = %+v, %v", s, err)
+	}
+
+	// The agent schedules aren't loaded by the events scheduler
+	pq := &EventQueue{}
+	heap.Init(pq)
+	if err := loadEventsFromDB(&handler, pq); err != nil || pq.Len() != 0 {
+		t.Errorf("loadEventsFromDB() loaded %d schedules (%v), want none", pq.Len(), err)
+	}
+}
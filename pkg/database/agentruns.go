@@ -0,0 +1,191 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database is responsible for handling the database setup, configuration and abstraction.
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AgentRunRunning is the status of a run that hasn't finished yet
+	AgentRunRunning = "running"
+	// AgentRunSuccess is the status of a run (or step) completed successfully
+	AgentRunSuccess = "success"
+	// AgentRunError is the status of a run (or step) that failed
+	AgentRunError = "error"
+
+	// DefaultAgentRunsLimit is the number of runs returned by ListAgentRuns when no limit is given
+	DefaultAgentRunsLimit = 50
+
+	agentRunColumns = `run_id, job_name, COALESCE(trigger_type, ''), COALESCE(trigger_name, ''),
+	COALESCE(event_id, ''), status, started_at, finished_at, COALESCE(duration_ms, 0),
+	COALESCE(result, ''), COALESCE(error, '')`
+	agentRunStepColumns = `step_id, run_id, step_index, action, status, started_at,
+	COALESCE(duration_ms, 0), COALESCE(input, ''), COALESCE(output, ''), COALESCE(error, ''),
+	COALESCE(attempts, 1), COALESCE(policy, '')`
+)
+
+// CreateAgentRun stores a new (running) agent run and returns its ID.
+func CreateAgentRun(db *Handler, run AgentRun) (uint64, error) {
+	query := `
+		INSERT INTO AgentRuns (job_name, trigger_type, trigger_name, event_id, status, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING run_id
+	`
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+	}
+	var runID uint64
+	err := (*db).QueryRow(query, run.JobName, run.TriggerType, run.TriggerName,
+		sql.NullString{String: run.EventID, Valid: run.EventID != ""}, AgentRunRunning, run.StartedAt.UTC()).Scan(&runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create agent run for %s: %v", run.JobName, err)
+	}
+	return runID, nil
+}
+
+// FinishAgentRun records the final status, result and error of an agent run.
+func FinishAgentRun(db *Handler, runID uint64, status, result, runErr string, duration time.Duration) error {
+	query := `
+		UPDATE AgentRuns
+		SET status = $1, result = $2, error = $3, finished_at = $4, duration_ms = $5, last_updated_at = CURRENT_TIMESTAMP
+		WHERE run_id = $6
+	`
+	_, err := (*db).Exec(query, status, sql.NullString{String: result, Valid: result != ""},
+		sql.NullString{String: runErr, Valid: runErr != ""}, time.Now().UTC(), duration.Milliseconds(), runID)
+	if err != nil {
+		return fmt.Errorf("failed to update agent run %d: %v", runID, err)
+	}
+	return nil
+}
+
+// AddAgentRunStep stores a step executed by an agent run.
+func AddAgentRunStep(db *Handler, step AgentRunStep) error {
+	query := `
+		INSERT INTO AgentRunSteps (run_id, step_index, action, status, started_at, duration_ms, input, output, error, attempts, policy)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	if step.Attempts <= 0 {
+		step.Attempts = 1
+	}
+	_, err := (*db).Exec(query, step.RunID, step.Index, step.Action, step.Status, step.StartedAt.UTC(),
+		step.DurationMs, step.Input, step.Output, sql.NullString{String: step.Error, Valid: step.Error != ""},
+		step.Attempts, sql.NullString{String: step.Policy, Valid: step.Policy != ""})
+	if err != nil {
+		return fmt.Errorf("failed to store step %d of agent run %d: %v", step.Index, step.RunID, err)
+	}
+	return nil
+}
+
+// ListAgentRuns returns the agent runs matching the filter, newest first
+// (the steps are not included).
+func ListAgentRuns(db *Handler, filter AgentRunFilter) ([]AgentRun, error) {
+	var conditions []string
+	var params []interface{}
+	addCondition := func(column, value string) {
+		if value != "" {
+			params = append(params, value)
+			conditions = append(conditions, column+" = $"+strconv.Itoa(len(params)))
+		}
+	}
+	addCondition("job_name", filter.JobName)
+	addCondition("event_id", filter.EventID)
+	addCondition("status", filter.Status)
+
+	query := `SELECT ` + agentRunColumns + ` FROM AgentRuns`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAgentRunsLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	params = append(params, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(` ORDER BY run_id DESC LIMIT $%d OFFSET $%d`, len(params)-1, len(params))
+
+	rows, err := (*db).ExecuteQuery(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent runs: %v", err)
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error here
+
+	runs := []AgentRun{}
+	for rows.Next() {
+		run, err := scanAgentRun(rows)
+		if err != nil {
+			return runs, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// GetAgentRun returns the agent run with the given ID, including its steps.
+// It returns nil (and no error) if the run doesn't exist.
+func GetAgentRun(db *Handler, runID uint64) (*AgentRun, error) {
+	run, err := scanAgentRun((*db).QueryRow(`SELECT `+agentRunColumns+` FROM AgentRuns WHERE run_id = $1`, runID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve agent run %d: %v", runID, err)
+	}
+	run.Steps, err = GetAgentRunSteps(db, runID)
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// GetAgentRunSteps returns the steps executed by an agent run, in execution order.
+func GetAgentRunSteps(db *Handler, runID uint64) ([]AgentRunStep, error) {
+	rows, err := (*db).ExecuteQuery(`SELECT `+agentRunStepColumns+` FROM AgentRunSteps WHERE run_id = $1 ORDER BY step_index, step_id`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the steps of agent run %d: %v", runID, err)
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error here
+
+	steps := []AgentRunStep{}
+	for rows.Next() {
+		var step AgentRunStep
+		if err := rows.Scan(&step.ID, &step.RunID, &step.Index, &step.Action, &step.Status, &step.StartedAt,
+			&step.DurationMs, &step.Input, &step.Output, &step.Error, &step.Attempts, &step.Policy); err != nil {
+			return steps, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+func scanAgentRun(row rowScanner) (*AgentRun, error) {
+	var run AgentRun
+	var finishedAt sql.NullTime
+	err := row.Scan(&run.ID, &run.JobName, &run.TriggerType, &run.TriggerName, &run.EventID, &run.Status,
+		&run.StartedAt, &finishedAt, &run.DurationMs, &run.Result, &run.Error)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	return &run, nil
+}
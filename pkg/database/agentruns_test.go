@@ -0,0 +1,58 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgentRuns(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+
+	runID, err := CreateAgentRun(&handler, AgentRun{JobName: "job1", TriggerType: "event", TriggerName: "new_event", EventID: "abc"})
+	if err != nil {
+		t.Fatalf("CreateAgentRun() returned an error: %v", err)
+	}
+	for i, action := range []string{"APIRequest", "DBQuery"} {
+		step := AgentRunStep{RunID: runID, Index: i, Action: action, Status: AgentRunSuccess, StartedAt: time.Now(), DurationMs: 5, Input: `{"a":1}`, Output: `{"b":2}`}
+		if err := AddAgentRunStep(&handler, step); err != nil {
+			t.Fatalf("AddAgentRunStep() returned an error: %v", err)
+		}
+	}
+	if err := FinishAgentRun(&handler, runID, AgentRunSuccess, `{"b":2}`, "", 10*time.Millisecond); err != nil {
+		t.Fatalf("FinishAgentRun() returned an error: %v", err)
+	}
+
+	otherID, err := CreateAgentRun(&handler, AgentRun{JobName: "job2"})
+	if err != nil {
+		t.Fatalf("CreateAgentRun() returned an error: %v", err)
+	}
+	if err := FinishAgentRun(&handler, otherID, AgentRunError, "", "boom", time.Millisecond); err != nil {
+		t.Fatalf("FinishAgentRun() returned an error: %v", err)
+	}
+
+	run, err := GetAgentRun(&handler, runID)
+	if err != nil || run == nil {
+		t.Fatalf("GetAgentRun() = %v, %v", run, err)
+	}
+	if run.JobName != "job1" || run.EventID != "abc" || run.Status != AgentRunSuccess || run.Result != `{"b":2}` ||
+		run.DurationMs != 10 || run.FinishedAt == nil || len(run.Steps) != 2 || run.Steps[1].Action != "DBQuery" {
+		t.Errorf("unexpected agent run: %+v", run)
+	}
+
+	runs, err := ListAgentRuns(&handler, AgentRunFilter{})
+	if err != nil || len(runs) != 2 || runs[0].ID != otherID {
+		t.Errorf("ListAgentRuns() = %+v, %v", runs, err)
+	}
+	runs, err = ListAgentRuns(&handler, AgentRunFilter{Status: AgentRunError})
+	if err != nil || len(runs) != 1 || runs[0].Error != "boom" {
+		t.Errorf("ListAgentRuns(status=error) = %+v, %v", runs, err)
+	}
+	runs, err = ListAgentRuns(&handler, AgentRunFilter{EventID: "abc", Limit: 1})
+	if err != nil || len(runs) != 1 || runs[0].ID != runID {
+		t.Errorf("ListAgentRuns(event_id=abc) = %+v, %v", runs, err)
+	}
+
+	if run, err := GetAgentRun(&handler, 12345); run != nil || err != nil {
+		t.Errorf("GetAgentRun() of a missing run = %v, %v", run, err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database is responsible for handling the database setup, configuration and abstraction.
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const apiKeyColumns = `key_id, name, key_prefix, scope, COALESCE(rate_limit, ''), COALESCE(active, FALSE),
+	created_at, expires_at, last_used_at`
+
+// CreateAPIKey stores a new API key (identified by the SHA256 of the key)
+// and returns its ID.
+func CreateAPIKey(db *Handler, key APIKey, keyHash string) (uint64, error) {
+	query := `
+		INSERT INTO APIKeys (name, key_prefix, key_hash, scope, rate_limit, expires_at, active)
+		VALUES ($1, $2, $3, $4, $5, $6, TRUE)
+		RETURNING key_id
+	`
+	var expiresAt sql.NullTime
+	if key.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *key.ExpiresAt, Valid: true}
+	}
+	var keyID uint64
+	err := (*db).QueryRow(query, key.Name, key.Prefix, keyHash, key.Scope,
+		sql.NullString{String: key.RateLimit, Valid: key.RateLimit != ""}, expiresAt).Scan(&keyID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create API key %s: %v", key.Name, err)
+	}
+	return keyID, nil
+}
+
+// GetAPIKeyByHash returns the API key with the given SHA256 and records
+// it as used. It returns nil (and no error) if the key doesn't exist.
+func GetAPIKeyByHash(db *Handler, keyHash string) (*APIKey, error) {
+	query := `
+		UPDATE APIKeys
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE key_hash = $1
+		RETURNING ` + apiKeyColumns
+	key, err := scanAPIKey((*db).QueryRow(query, keyHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve API key: %v", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns all the API keys (active and revoked).
+func ListAPIKeys(db *Handler) ([]APIKey, error) {
+	rows, err := (*db).ExecuteQuery(`SELECT ` + apiKeyColumns + ` FROM APIKeys ORDER BY key_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error here
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey deactivates an API key.
+func RevokeAPIKey(db *Handler, keyID uint64) error {
+	res, err := (*db).Exec(`UPDATE APIKeys SET active = FALSE, last_updated_at = CURRENT_TIMESTAMP WHERE key_id = $1`, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key %d: %v", keyID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("API key %d not found", keyID)
+	}
+	return nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Scope, &key.RateLimit, &key.Active,
+		&key.CreatedAt, &expiresAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return &key, nil
+}
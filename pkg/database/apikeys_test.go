@@ -0,0 +1,34 @@
+package database
+
+import "testing"
+
+func TestAPIKeys(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+
+	keyID, err := CreateAPIKey(&handler, APIKey{Name: "test", Prefix: "crw_abcd", Scope: "search", RateLimit: "5,5"}, "hash1")
+	if err != nil {
+		t.Fatalf("CreateAPIKey() returned an error: %v", err)
+	}
+
+	key, err := GetAPIKeyByHash(&handler, "hash1")
+	if err != nil || key == nil {
+		t.Fatalf("GetAPIKeyByHash() = %v, %v", key, err)
+	}
+	if key.ID != keyID || key.Name != "test" || key.Scope != "search" || key.RateLimit != "5,5" || !key.Active || key.LastUsedAt == nil {
+		t.Errorf("unexpected API key: %+v", key)
+	}
+	if key, err := GetAPIKeyByHash(&handler, "missing"); key != nil || err != nil {
+		t.Errorf("GetAPIKeyByHash() of a missing key = %v, %v", key, err)
+	}
+
+	if err := RevokeAPIKey(&handler, keyID); err != nil {
+		t.Fatalf("RevokeAPIKey() returned an error: %v", err)
+	}
+	if err := RevokeAPIKey(&handler, 12345); err == nil {
+		t.Errorf("RevokeAPIKey() of a missing key didn't return an error")
+	}
+	keys, err := ListAPIKeys(&handler)
+	if err != nil || len(keys) != 1 || keys[0].Active {
+		t.Errorf("ListAPIKeys() = %+v, %v", keys, err)
+	}
+}
@@ -46,6 +46,7 @@ type Handler interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 	DBMS() string
 	Begin() (*sql.Tx, error)
+	BeginTx(opts *sql.TxOptions) (*sql.Tx, error)
 	Commit(tx *sql.Tx) error
 	Rollback(tx *sql.Tx) error
 	QueryRow(query string, args ...interface{}) *sql.Row
@@ -71,3 +72,10 @@ type Notification interface {
 	Channel() string
 	Extra() string
 }
+
+// Acknowledger is implemented by the notifications that must be
+// acknowledged once processed, so they are not delivered again
+// (for ex. the PollingListener ones).
+type Acknowledger interface {
+	Ack() error
+}
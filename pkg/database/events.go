@@ -20,6 +20,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -513,7 +514,18 @@ func GetEventsBySourceTypeSeverityAndTime(db *Handler, sourceID uint64, eventTyp
 }
 
 // ListenForEvents listens for new events in the database and calls the handleNotification function when a new event is received.
+// The event is acknowledged when handleNotification returns, so handleNotification must process it before returning.
 func ListenForEvents(db *Handler, handleNotification func(string)) {
+	ListenForEventsWithAck(db, func(payload string, ack func()) {
+		handleNotification(payload)
+		ack()
+	})
+}
+
+// ListenForEventsWithAck listens for new events in the database and calls the handleNotification function when a new event is received.
+// handleNotification must call ack once the event has been processed (even asynchronously): the listeners that deliver the events
+// at least once (see Acknowledger) deliver again the events that were not acknowledged.
+func ListenForEventsWithAck(db *Handler, handleNotification func(payload string, ack func())) {
 	listener := (*db).NewListener()
 	if listener == nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Failed to create a new listener")
@@ -556,7 +568,7 @@ func ListenForEvents(db *Handler, handleNotification func(string)) {
 					return
 				}
 				if n != nil {
-					handleNotification(n.Extra())
+					handleNotification(n.Extra(), notificationAck(n))
 				}
 			case <-stop:
 				cmn.DebugMsg(cmn.DbgLvlInfo, "Shutting down the events handler...")
@@ -571,3 +583,20 @@ func ListenForEvents(db *Handler, handleNotification func(string)) {
 
 	<-stop // Wait for shutdown signal
 }
+
+// notificationAck returns the function acknowledging a notification (it
+// does nothing for the notifications that don't need it)
+func notificationAck(n Notification) func() {
+	a, ok := n.(Acknowledger)
+	if !ok {
+		return func() {}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := a.Ack(); err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "Failed to acknowledge the notification: %v", err)
+			}
+		})
+	}
+}
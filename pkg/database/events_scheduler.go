@@ -89,7 +89,8 @@ func StartScheduler(db *Handler) {
 
 // loadEventsFromDB loads scheduled events from the database into the priority queue.
 func loadEventsFromDB(db *Handler, pq *EventQueue) error {
-	rows, err := (*db).ExecuteQuery("SELECT event_id, next_run, recurrence_interval FROM EventSchedules WHERE active")
+	// The agent schedules (no event_id) are run by the agents scheduler
+	rows, err := (*db).ExecuteQuery("SELECT event_id, next_run, recurrence_interval FROM EventSchedules WHERE active AND event_id IS NOT NULL")
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Error loading events from DB: %v", err)
 		return err
@@ -193,6 +194,25 @@ func updateScheduleInDB(db *Handler, event *ScheduledEvent) error {
 	return err
 }
 
+// claimScheduleRun moves a schedule from its due run to nextRun (recording
+// lastRun as its last run). It returns false if the schedule isn't at its due
+// run anymore, because the run was already claimed (for ex. by another
+// service sharing the same database).
+func claimScheduleRun(db *Handler, scheduleID string, dueRun, nextRun, lastRun time.Time) (bool, error) {
+	res, err := (*db).Exec(`
+		UPDATE EventSchedules
+		SET next_run = $1, last_run = $2, last_updated_at = CURRENT_TIMESTAMP
+		WHERE schedule_id = $3 AND next_run = $4 AND active`, nextRun, lastRun, scheduleID, dueRun)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
 // calculateNextRun calculates the next run time for a recurring event.
 func calculateNextRun(lastRun time.Time, recurrence string) time.Time {
 	recurrence = strings.ToLower(strings.TrimSpace(recurrence))
@@ -0,0 +1,180 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database is responsible for handling the database setup, configuration and abstraction.
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+const (
+	// FrontierQueued represents a URL waiting to be crawled.
+	FrontierQueued = "queued"
+	// FrontierInFlight represents a URL a worker is currently crawling.
+	FrontierInFlight = "in_flight"
+	// FrontierDone represents a URL that has been crawled (or skipped).
+	FrontierDone = "done"
+	// FrontierFailed represents a URL whose crawling returned an error.
+	FrontierFailed = "failed"
+)
+
+// FrontierEnqueue adds the given items to the frontier of a source.
+// URLs already present in the frontier (in any state) are ignored.
+// It returns the number of items actually added.
+func FrontierEnqueue(db *Handler, sourceID uint64, items []FrontierItem) (int64, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	tx, err := (*db).Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	query := `
+		INSERT INTO CrawlFrontier (source_id, url_hash, url, parent_url, depth, element_id, from_sitemap, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (source_id, url_hash) DO NOTHING
+	`
+	if (*db).DBMS() == DBMySQLStr {
+		query = `
+		INSERT IGNORE INTO CrawlFrontier (source_id, url_hash, url, parent_url, depth, element_id, from_sitemap, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	}
+	query = frontierBind(db, query)
+	var added int64
+	for _, item := range items {
+		res, err := tx.Exec(query, sourceID, cmn.GenerateSHA256(item.URL), item.URL, item.ParentURL, item.Depth, item.ElementID, item.FromSitemap, FrontierQueued)
+		if err != nil {
+			_ = (*db).Rollback(tx)
+			return 0, fmt.Errorf("failed to enqueue URL %s: %v", item.URL, err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			added += n
+		}
+	}
+
+	if err = (*db).Commit(tx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return added, nil
+}
+
+// FrontierSetStatus updates the status of a URL in the frontier of a source.
+// Moving a URL to in_flight increments its attempts counter.
+func FrontierSetStatus(db *Handler, sourceID uint64, url, status, lastError string) error {
+	query := `
+		UPDATE CrawlFrontier
+		SET status = $1,
+			attempts = attempts + $2,
+			last_error = $3,
+			last_updated_at = CURRENT_TIMESTAMP
+		WHERE source_id = $4 AND url_hash = $5
+	`
+	attempt := 0
+	if status == FrontierInFlight {
+		attempt = 1
+	}
+	_, err := (*db).Exec(frontierBind(db, query), status, attempt, sql.NullString{String: lastError, Valid: lastError != ""}, sourceID, cmn.GenerateSHA256(url))
+	if err != nil {
+		return fmt.Errorf("failed to update frontier status of %s: %v", url, err)
+	}
+	return nil
+}
+
+// FrontierPending returns the URLs of a source that still need to be crawled
+// (queued or left in_flight by an interrupted crawl), ordered by depth.
+func FrontierPending(db *Handler, sourceID uint64) ([]FrontierItem, error) {
+	return frontierItems(db, `
+		SELECT frontier_id, source_id, url, COALESCE(parent_url, ''), depth, COALESCE(element_id, ''),
+			COALESCE(from_sitemap, FALSE), status, COALESCE(attempts, 0), COALESCE(last_error, '')
+		FROM CrawlFrontier
+		WHERE source_id = $1 AND status IN ('queued', 'in_flight')
+		ORDER BY depth, frontier_id
+	`, sourceID)
+}
+
+// FrontierCompleted returns the URLs of a source that have already been
+// crawled (done or failed).
+func FrontierCompleted(db *Handler, sourceID uint64) ([]FrontierItem, error) {
+	return frontierItems(db, `
+		SELECT frontier_id, source_id, url, COALESCE(parent_url, ''), depth, COALESCE(element_id, ''),
+			COALESCE(from_sitemap, FALSE), status, COALESCE(attempts, 0), COALESCE(last_error, '')
+		FROM CrawlFrontier
+		WHERE source_id = $1 AND status IN ('done', 'failed')
+		ORDER BY depth, frontier_id
+	`, sourceID)
+}
+
+func frontierItems(db *Handler, query string, sourceID uint64) ([]FrontierItem, error) {
+	rows, err := (*db).ExecuteQuery(frontierBind(db, query), sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve frontier of source %d: %v", sourceID, err)
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error here
+
+	var items []FrontierItem
+	for rows.Next() {
+		var item FrontierItem
+		err = rows.Scan(&item.ID, &item.SourceID, &item.URL, &item.ParentURL, &item.Depth, &item.ElementID,
+			&item.FromSitemap, &item.Status, &item.Attempts, &item.LastError)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// FrontierQueueSize returns the number of URLs of a source that are queued or in_flight.
+func FrontierQueueSize(db *Handler, sourceID uint64) (int, error) {
+	var size int
+	err := (*db).QueryRow(frontierBind(db, `SELECT COUNT(*) FROM CrawlFrontier WHERE source_id = $1 AND status IN ('queued', 'in_flight')`), sourceID).Scan(&size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve frontier size of source %d: %v", sourceID, err)
+	}
+	return size, nil
+}
+
+// FrontierDropPending removes the URLs of a source that are still queued or in_flight
+// (used when a crawl completes without needing them, e.g. because of max_links).
+func FrontierDropPending(db *Handler, sourceID uint64) error {
+	_, err := (*db).Exec(frontierBind(db, `DELETE FROM CrawlFrontier WHERE source_id = $1 AND status IN ('queued', 'in_flight')`), sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to drop pending frontier of source %d: %v", sourceID, err)
+	}
+	return nil
+}
+
+// FrontierClear removes the whole frontier of a source.
+func FrontierClear(db *Handler, sourceID uint64) error {
+	_, err := (*db).Exec(frontierBind(db, `DELETE FROM CrawlFrontier WHERE source_id = $1`), sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to clear frontier of source %d: %v", sourceID, err)
+	}
+	return nil
+}
+
+// frontierBind converts the placeholders of a frontier query for the DBMS of db
+func frontierBind(db *Handler, query string) string {
+	if (*db).DBMS() == DBMySQLStr {
+		return placeholderRegex.ReplaceAllString(query, "?")
+	}
+	return query
+}
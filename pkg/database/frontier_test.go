@@ -0,0 +1,56 @@
+package database
+
+import "testing"
+
+func TestFrontier(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	if _, err := handler.Exec(`INSERT INTO Sources (url, status) VALUES ('https://example.com', 'new')`); err != nil {
+		t.Fatalf("failed to insert the test source: %v", err)
+	}
+	var sourceID uint64
+	if err := handler.QueryRow(`SELECT source_id FROM Sources WHERE url = 'https://example.com'`).Scan(&sourceID); err != nil {
+		t.Fatalf("failed to retrieve the test source: %v", err)
+	}
+
+	items := []FrontierItem{
+		{URL: "https://example.com/a", Depth: 1},
+		{URL: "https://example.com/b", Depth: 1, FromSitemap: true},
+		{URL: "https://example.com/a", Depth: 2}, // Duplicate
+	}
+	added, err := FrontierEnqueue(&handler, sourceID, items)
+	if err != nil || added != 2 {
+		t.Fatalf("FrontierEnqueue() = %d, %v; want 2 added", added, err)
+	}
+
+	if err := FrontierSetStatus(&handler, sourceID, "https://example.com/a", FrontierInFlight, ""); err != nil {
+		t.Fatalf("FrontierSetStatus() returned an error: %v", err)
+	}
+	if err := FrontierSetStatus(&handler, sourceID, "https://example.com/a", FrontierFailed, "timeout"); err != nil {
+		t.Fatalf("FrontierSetStatus() returned an error: %v", err)
+	}
+
+	pending, err := FrontierPending(&handler, sourceID)
+	if err != nil || len(pending) != 1 || pending[0].URL != "https://example.com/b" || !pending[0].FromSitemap {
+		t.Errorf("FrontierPending() = %+v, %v", pending, err)
+	}
+	completed, err := FrontierCompleted(&handler, sourceID)
+	if err != nil || len(completed) != 1 || completed[0].Attempts != 1 || completed[0].LastError != "timeout" {
+		t.Errorf("FrontierCompleted() = %+v, %v", completed, err)
+	}
+	if size, err := FrontierQueueSize(&handler, sourceID); err != nil || size != 1 {
+		t.Errorf("FrontierQueueSize() = %d, %v; want 1", size, err)
+	}
+
+	if err := FrontierDropPending(&handler, sourceID); err != nil {
+		t.Fatalf("FrontierDropPending() returned an error: %v", err)
+	}
+	if size, _ := FrontierQueueSize(&handler, sourceID); size != 0 {
+		t.Errorf("FrontierQueueSize() = %d after FrontierDropPending(), want 0", size)
+	}
+	if err := FrontierClear(&handler, sourceID); err != nil {
+		t.Fatalf("FrontierClear() returned an error: %v", err)
+	}
+	if completed, _ := FrontierCompleted(&handler, sourceID); len(completed) != 0 {
+		t.Errorf("FrontierCompleted() = %+v after FrontierClear(), want none", completed)
+	}
+}
@@ -18,6 +18,7 @@ package database
 
 /* Commented out to avoid issues with the Licensing, you need to uncomment it to use it.
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -152,6 +153,11 @@ func (handler *MySQLHandler) Begin() (*sql.Tx, error) {
 	return handler.db.Begin()
 }
 
+// BeginTx starts a transaction with the given options
+func (handler *MySQLHandler) BeginTx(opts *sql.TxOptions) (*sql.Tx, error) {
+	return handler.db.BeginTx(context.Background(), opts)
+}
+
 // Commit commits a transaction
 func (handler *MySQLHandler) Commit(tx *sql.Tx) error {
 	return tx.Commit()
@@ -178,6 +184,12 @@ func (handler *MySQLHandler) CheckConnection(c cfg.Config) error {
 	return err
 }
 
+// NewListener returns a new Listener for the database. MySQL doesn't
+// support LISTEN/NOTIFY, so the listener polls the EventsOutbox table.
+func (handler *MySQLHandler) NewListener() Listener {
+	return NewPollingListener(handler)
+}
+
 // ---------------------------------------------------------------
 // Server Configuration
 
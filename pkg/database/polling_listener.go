@@ -0,0 +1,513 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database is responsible for handling the database setup, configuration and abstraction.
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const (
+	// DefaultListenerPollInterval is how often a PollingListener checks for new notifications
+	DefaultListenerPollInterval = time.Second
+	// DefaultOutboxRetention is how long the notifications are kept in the EventsOutbox table
+	DefaultOutboxRetention = 7 * 24 * time.Hour
+	// DefaultListenerGapTimeout is how long a PollingListener looks for a
+	// notification missing between the ones it read
+	DefaultListenerGapTimeout = time.Minute
+
+	outboxBatchSize     = 100
+	outboxMaxGaps       = 10000
+	outboxPruneInterval = time.Hour
+)
+
+var (
+	errListenerClosed = errors.New("listener is closed")
+	placeholderRegex  = regexp.MustCompile(`\$\d+`)
+)
+
+// PollingListener is the Listener used for the DBMSes that don't support
+// LISTEN/NOTIFY (SQLite and MySQL). A trigger writes every new event in the
+// EventsOutbox table, which the listener polls using a cursor stored in the
+// ListenerCursors table.
+// The stored cursor moves past a notification only when the notification
+// and all the previous ones are acknowledged (see Acknowledger), so
+// notifications are delivered at least once, even across restarts and when
+// they are processed out of order.
+// The outbox ids are assigned at insert time, but the transactions can
+// commit out of order (e.g. on MySQL/InnoDB): the ids missing between the
+// notifications read are looked for again until they show up or GapTimeout
+// expires, and the stored cursor doesn't move past them in the meantime.
+type PollingListener struct {
+	// Name identifies the listener cursor, listeners with the same name
+	// share the same cursor
+	Name string
+	// PollInterval is how often the EventsOutbox is checked for new notifications
+	PollInterval time.Duration
+	// Retention is how long the notifications are kept in the EventsOutbox
+	Retention time.Duration
+	// GapTimeout is how long a notification missing between the ones read
+	// (e.g. of a transaction not committed yet) is looked for
+	GapTimeout time.Duration
+
+	handler   Handler
+	mutex     sync.Mutex
+	channels  map[string]bool
+	cursor    int64                          // last notification read
+	acked     int64                          // last notification stored in ListenerCursors
+	inflight  map[int64]*PollingNotification // notifications sent and not acknowledged yet
+	gaps      map[int64]time.Time            // notifications missing before the cursor, and since when
+	notify    chan Notification
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+	callback  func(ev ListenerEventType, err error)
+}
+
+// PollingNotification is a notification read from the EventsOutbox table
+type PollingNotification struct {
+	id       int64
+	channel  string
+	extra    string
+	listener *PollingListener
+}
+
+// NewPollingListener returns a new PollingListener for the given handler.
+// The listener is named after the program and the host it runs on.
+func NewPollingListener(handler Handler) *PollingListener {
+	name := filepath.Base(os.Args[0])
+	if host, err := os.Hostname(); err == nil && host != "" {
+		name += "@" + host
+	}
+	return &PollingListener{
+		Name:         name,
+		PollInterval: DefaultListenerPollInterval,
+		Retention:    DefaultOutboxRetention,
+		GapTimeout:   DefaultListenerGapTimeout,
+		handler:      handler,
+		channels:     make(map[string]bool),
+	}
+}
+
+// Connect loads the listener cursor and starts polling for notifications.
+// A listener that has never run before starts from the latest notification.
+func (l *PollingListener) Connect(_ cfg.Config, _, _ time.Duration, eventCallback func(ev ListenerEventType, err error)) error {
+	if l.handler == nil {
+		return fmt.Errorf("listener has no database handler")
+	}
+	l.callback = eventCallback
+
+	var cursor int64
+	err := l.handler.QueryRow(l.bind(`SELECT last_outbox_id FROM ListenerCursors WHERE listener_name = $1`), l.Name).Scan(&cursor)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = l.handler.QueryRow(`SELECT COALESCE(MAX(outbox_id), 0) FROM EventsOutbox`).Scan(&cursor)
+		if err == nil {
+			err = l.saveCursor(cursor)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load the cursor of listener '%s': %w", l.Name, err)
+	}
+	if l.PollInterval <= 0 {
+		l.PollInterval = DefaultListenerPollInterval
+	}
+	if l.GapTimeout <= 0 {
+		l.GapTimeout = DefaultListenerGapTimeout
+	}
+
+	l.mutex.Lock()
+	l.cursor = cursor
+	l.acked = cursor
+	l.inflight = make(map[int64]*PollingNotification)
+	l.gaps = make(map[int64]time.Time)
+	l.mutex.Unlock()
+	l.notify = make(chan Notification)
+	l.done = make(chan struct{})
+	l.wg.Add(1)
+	go l.run()
+
+	l.event(ListenerEventConnected, nil)
+	return nil
+}
+
+// ConnectWithDBHandler connects the listener using the given handler and
+// starts listening on channel
+func (l *PollingListener) ConnectWithDBHandler(handler *Handler, channel string) error {
+	if handler == nil || *handler == nil {
+		return fmt.Errorf("invalid database handler")
+	}
+	l.handler = *handler
+	if err := l.Connect(cfg.Config{}, 0, 0, nil); err != nil {
+		return err
+	}
+	return l.Listen(channel)
+}
+
+// Ping checks if the database connection is still alive
+func (l *PollingListener) Ping() error {
+	if l.handler == nil {
+		return fmt.Errorf("listener is not connected")
+	}
+	return l.handler.Ping()
+}
+
+// Close stops polling for notifications (the database connection is not closed)
+func (l *PollingListener) Close() error {
+	if l == nil || l.done == nil {
+		return nil
+	}
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	l.wg.Wait()
+	return nil
+}
+
+// Listen listens for notifications on a channel
+func (l *PollingListener) Listen(channel string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.channels[channel] = true
+	return nil
+}
+
+// Notify returns a channel to receive notifications
+func (l *PollingListener) Notify() <-chan Notification {
+	return l.notify
+}
+
+// UnlistenAll unsubscribes from all channels
+func (l *PollingListener) UnlistenAll() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.channels = make(map[string]bool)
+	return nil
+}
+
+// run polls the EventsOutbox until the listener is closed
+func (l *PollingListener) run() {
+	defer l.wg.Done()
+	defer close(l.notify)
+
+	ticker := time.NewTicker(l.PollInterval)
+	defer ticker.Stop()
+
+	failing := false
+	lastPrune := time.Time{}
+	for {
+		more, err := l.poll()
+		if errors.Is(err, errListenerClosed) {
+			return
+		}
+		switch {
+		case err != nil && !failing:
+			failing = true
+			l.event(ListenerEventDisconnected, err)
+		case err == nil && failing:
+			failing = false
+			l.event(ListenerEventReconnected, nil)
+		}
+		if err == nil && time.Since(lastPrune) > outboxPruneInterval {
+			l.prune()
+			lastPrune = time.Now()
+		}
+		if more {
+			// There may be more notifications waiting, don't wait for the next tick
+			continue
+		}
+
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll sends the notifications following the cursor (and the ones missing
+// before it that showed up), it returns true if there may be more
+// notifications to send
+func (l *PollingListener) poll() (bool, error) {
+	l.mutex.Lock()
+	channels := make(map[string]bool, len(l.channels))
+	for channel := range l.channels {
+		channels[channel] = true
+	}
+	gaps := l.expireGaps()
+	cursor := l.cursor
+	l.mutex.Unlock()
+	if len(channels) == 0 {
+		return false, nil
+	}
+
+	// Read the whole batches before sending the notifications, so we don't
+	// hold a read transaction while they are processed
+	found, err := l.queryGaps(gaps)
+	if err != nil {
+		return false, err
+	}
+	batch, err := l.queryNotifications(`
+		SELECT outbox_id, channel, payload
+		FROM EventsOutbox
+		WHERE outbox_id > $1
+		ORDER BY outbox_id
+		LIMIT $2`, cursor, outboxBatchSize)
+	if err != nil {
+		return false, err
+	}
+
+	for _, n := range found {
+		l.mutex.Lock()
+		if l.cursor != cursor {
+			// A failed acknowledgement rewound the cursor, read again from there
+			l.mutex.Unlock()
+			return true, nil
+		}
+		_, missing := l.gaps[n.id]
+		delete(l.gaps, n.id)
+		send := missing && channels[n.channel]
+		if send {
+			l.inflight[n.id] = n
+		}
+		l.mutex.Unlock()
+
+		if send && !l.send(n) {
+			return false, errListenerClosed
+		}
+	}
+
+	for _, n := range batch {
+		l.mutex.Lock()
+		if l.cursor != cursor {
+			// A failed acknowledgement rewound the cursor, read again from there
+			l.mutex.Unlock()
+			return true, nil
+		}
+		l.addGaps(cursor+1, n.id-1)
+		l.cursor = n.id
+		cursor = n.id
+		send := channels[n.channel]
+		if send {
+			l.inflight[n.id] = n
+		}
+		l.mutex.Unlock()
+
+		if send && !l.send(n) {
+			return false, errListenerClosed
+		}
+	}
+
+	return len(batch) == outboxBatchSize, nil
+}
+
+// send sends a notification, it returns false if the listener was closed
+func (l *PollingListener) send(n *PollingNotification) bool {
+	select {
+	case l.notify <- n:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// queryNotifications returns the notifications selected by query
+func (l *PollingListener) queryNotifications(query string, args ...interface{}) ([]*PollingNotification, error) {
+	rows, err := l.handler.ExecuteQuery(l.bind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // We can't do much if closing fails
+
+	var notifications []*PollingNotification
+	for rows.Next() {
+		n := &PollingNotification{listener: l}
+		if err := rows.Scan(&n.id, &n.channel, &n.extra); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// queryGaps returns the missing notifications (ids) that are now in the outbox
+func (l *PollingListener) queryGaps(ids []int64) ([]*PollingNotification, error) {
+	var found []*PollingNotification
+	for start := 0; start < len(ids); start += outboxBatchSize {
+		chunk := ids[start:min(start+outboxBatchSize, len(ids))]
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+			args[i] = id
+		}
+		notifications, err := l.queryNotifications(`
+			SELECT outbox_id, channel, payload
+			FROM EventsOutbox
+			WHERE outbox_id IN (`+strings.Join(placeholders, ", ")+`)
+			ORDER BY outbox_id`, args...)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, notifications...)
+	}
+	return found, nil
+}
+
+// addGaps records the notifications from..to (missing before a notification
+// read) to be looked for. l.mutex must be held.
+func (l *PollingListener) addGaps(from, to int64) {
+	now := time.Now()
+	for id := from; id <= to; id++ {
+		if len(l.gaps) >= outboxMaxGaps {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "Listener '%s': too many missing notifications, notifications %d-%d won't be waited for", l.Name, id, to)
+			return
+		}
+		l.gaps[id] = now
+	}
+}
+
+// expireGaps stops looking for the missing notifications older than the
+// gap timeout (moving the stored cursor past them) and returns the ones
+// still missing. l.mutex must be held.
+func (l *PollingListener) expireGaps() []int64 {
+	expired := false
+	ids := make([]int64, 0, len(l.gaps))
+	for id, since := range l.gaps {
+		if time.Since(since) > l.GapTimeout {
+			delete(l.gaps, id)
+			expired = true
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if expired {
+		if err := l.storeCursor(); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "Failed to store the cursor of listener '%s': %v", l.Name, err)
+			return nil
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// storeCursor moves the stored cursor up to the last notification read that
+// has no unacknowledged (or missing) ones before it. If the cursor can't be
+// stored, the notifications following the stored cursor are read again.
+// l.mutex must be held.
+func (l *PollingListener) storeCursor() error {
+	target := l.cursor
+	for id := range l.inflight {
+		target = min(target, id-1)
+	}
+	for id := range l.gaps {
+		target = min(target, id-1)
+	}
+	if target <= l.acked {
+		return nil
+	}
+	if err := l.saveCursor(target); err != nil {
+		l.cursor = l.acked
+		l.inflight = make(map[int64]*PollingNotification)
+		l.gaps = make(map[int64]time.Time)
+		return err
+	}
+	l.acked = target
+	return nil
+}
+
+// prune removes the notifications older than the retention period
+func (l *PollingListener) prune() {
+	if l.Retention <= 0 {
+		return
+	}
+	threshold := time.Now().UTC().Add(-l.Retention).Format("2006-01-02 15:04:05")
+	if _, err := l.handler.Exec(l.bind(`DELETE FROM EventsOutbox WHERE created_at < $1`), threshold); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Failed to prune the events outbox: %v", err)
+	}
+}
+
+// saveCursor stores the listener cursor
+func (l *PollingListener) saveCursor(cursor int64) error {
+	query := `
+		INSERT INTO ListenerCursors (listener_name, last_outbox_id, last_updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (listener_name) DO UPDATE
+		SET last_outbox_id = excluded.last_outbox_id, last_updated_at = CURRENT_TIMESTAMP`
+	if l.handler.DBMS() == DBMySQLStr {
+		query = `
+		INSERT INTO ListenerCursors (listener_name, last_outbox_id, last_updated_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON DUPLICATE KEY UPDATE last_outbox_id = VALUES(last_outbox_id), last_updated_at = CURRENT_TIMESTAMP`
+	}
+	_, err := l.handler.Exec(l.bind(query), l.Name, cursor)
+	return err
+}
+
+// bind converts the query placeholders for the listener DBMS
+func (l *PollingListener) bind(query string) string {
+	if l.handler != nil && l.handler.DBMS() == DBMySQLStr {
+		return placeholderRegex.ReplaceAllString(query, "?")
+	}
+	return query
+}
+
+// event calls the listener event callback (if any)
+func (l *PollingListener) event(ev ListenerEventType, err error) {
+	if l.callback != nil {
+		l.callback(ev, err)
+	}
+}
+
+// Channel returns the channel name
+func (n *PollingNotification) Channel() string {
+	return n.channel
+}
+
+// Extra returns the notification payload
+func (n *PollingNotification) Extra() string {
+	return n.extra
+}
+
+// Ack marks the notification as processed. The stored cursor moves up to
+// the last notification read that has no unacknowledged (or missing) ones
+// before it. If the cursor can't be stored, the notifications following the
+// stored cursor are delivered again.
+func (n *PollingNotification) Ack() error {
+	l := n.listener
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.inflight[n.id] != n {
+		// Already acknowledged, or delivered again after a failed acknowledgement
+		return nil
+	}
+	delete(l.inflight, n.id)
+
+	if err := l.storeCursor(); err != nil {
+		return fmt.Errorf("failed to acknowledge notification %d: %w", n.id, err)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package database
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+// newTestSQLiteHandler returns a handler for a new SQLite database with the CROWler schema
+func newTestSQLiteHandler(t *testing.T) Handler {
+	t.Helper()
+
+	var config cfg.Config
+	config.Database.Type = DBSQLiteStr
+	config.Database.DBName = filepath.Join(t.TempDir(), "crowler.db")
+	handler, err := NewHandler(config)
+	if err != nil {
+		t.Fatalf("NewHandler() returned an error: %v", err)
+	}
+	if err := handler.Connect(config); err != nil {
+		t.Fatalf("Connect() returned an error: %v", err)
+	}
+	t.Cleanup(func() { _ = handler.Close() })
+
+	schema, err := os.ReadFile("sqlite-setup-v1.4.sqlite3")
+	if err != nil {
+		t.Fatalf("failed to read the SQLite schema: %v", err)
+	}
+	if _, err := handler.Exec(string(schema)); err != nil {
+		t.Fatalf("failed to create the SQLite schema: %v", err)
+	}
+	return handler
+}
+
+func newTestPollingListener(t *testing.T, handler Handler) *PollingListener {
+	t.Helper()
+	listener, ok := handler.NewListener().(*PollingListener)
+	if !ok {
+		t.Fatalf("expected a PollingListener")
+	}
+	listener.Name = "test"
+	listener.PollInterval = 10 * time.Millisecond
+	if err := listener.Connect(cfg.Config{}, 0, 0, nil); err != nil {
+		t.Fatalf("Connect() returned an error: %v", err)
+	}
+	if err := listener.Listen("new_event"); err != nil {
+		t.Fatalf("Listen() returned an error: %v", err)
+	}
+	return listener
+}
+
+func receiveNotification(t *testing.T, listener *PollingListener) Notification {
+	t.Helper()
+	select {
+	case n := <-listener.Notify():
+		return n
+	case <-time.After(2 * time.Second):
+		return nil
+	}
+}
+
+func TestPollingListener(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+
+	// Events created before a listener runs for the first time are not delivered
+	if _, err := CreateEvent(&handler, Event{Type: "old_event", Severity: "low", Details: map[string]interface{}{}}); err != nil {
+		t.Fatalf("CreateEvent() returned an error: %v", err)
+	}
+
+	listener := newTestPollingListener(t, handler)
+	eventID, err := CreateEvent(&handler, Event{Type: "test_event", Severity: "high", Details: map[string]interface{}{"key": "value"}})
+	if err != nil {
+		t.Fatalf("CreateEvent() returned an error: %v", err)
+	}
+
+	n := receiveNotification(t, listener)
+	if n == nil {
+		t.Fatalf("expected a notification")
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(n.Extra()), &event); err != nil {
+		t.Fatalf("failed to decode the notification payload %q: %v", n.Extra(), err)
+	}
+	if n.Channel() != "new_event" || event.ID != eventID || event.Type != "test_event" || event.Details["key"] != "value" {
+		t.Errorf("unexpected notification: %s %+v", n.Channel(), event)
+	}
+
+	// A notification that wasn't acknowledged is delivered again
+	_ = listener.Close()
+	listener = newTestPollingListener(t, handler)
+	n = receiveNotification(t, listener)
+	if n == nil {
+		t.Fatalf("expected the unacknowledged notification to be delivered again")
+	}
+	if err := n.(Acknowledger).Ack(); err != nil {
+		t.Fatalf("Ack() returned an error: %v", err)
+	}
+
+	// An acknowledged notification is not delivered again
+	_ = listener.Close()
+	listener = newTestPollingListener(t, handler)
+	defer listener.Close() //nolint:errcheck // test cleanup
+	select {
+	case n := <-listener.Notify():
+		t.Errorf("unexpected notification: %s", n.Extra())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPollingListenerOutOfOrderAck(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	listener := newTestPollingListener(t, handler)
+
+	for _, eventType := range []string{"first_event", "second_event"} {
+		if _, err := CreateEvent(&handler, Event{Type: eventType, Severity: "low", Details: map[string]interface{}{}}); err != nil {
+			t.Fatalf("CreateEvent() returned an error: %v", err)
+		}
+	}
+	first := receiveNotification(t, listener)
+	second := receiveNotification(t, listener)
+	if first == nil || second == nil {
+		t.Fatalf("expected two notifications")
+	}
+
+	// The second notification is processed first: the first one, still in
+	// progress, must be delivered again after a restart
+	if err := second.(Acknowledger).Ack(); err != nil {
+		t.Fatalf("Ack() returned an error: %v", err)
+	}
+	_ = listener.Close()
+	listener = newTestPollingListener(t, handler)
+	n := receiveNotification(t, listener)
+	if n == nil || n.Extra() != first.Extra() {
+		t.Fatalf("expected the unacknowledged notification to be delivered again, got %v", n)
+	}
+
+	// Once both are acknowledged, nothing is delivered again
+	if err := n.(Acknowledger).Ack(); err != nil {
+		t.Fatalf("Ack() returned an error: %v", err)
+	}
+	if n = receiveNotification(t, listener); n == nil {
+		t.Fatalf("expected the second notification to be delivered again")
+	}
+	if err := n.(Acknowledger).Ack(); err != nil {
+		t.Fatalf("Ack() returned an error: %v", err)
+	}
+	_ = listener.Close()
+	listener = newTestPollingListener(t, handler)
+	defer listener.Close() //nolint:errcheck // test cleanup
+	select {
+	case n := <-listener.Notify():
+		t.Errorf("unexpected notification: %s", n.Extra())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// insertOutbox inserts a notification with the given id in the EventsOutbox
+func insertOutbox(t *testing.T, handler Handler, id int64, payload string) {
+	t.Helper()
+	if _, err := handler.Exec(`INSERT INTO EventsOutbox (outbox_id, channel, payload) VALUES ($1, 'new_event', $2)`, id, payload); err != nil {
+		t.Fatalf("failed to insert notification %d: %v", id, err)
+	}
+}
+
+// storedCursor returns the cursor stored for a listener
+func storedCursor(t *testing.T, handler Handler, name string) int64 {
+	t.Helper()
+	var cursor int64
+	if err := handler.QueryRow(`SELECT last_outbox_id FROM ListenerCursors WHERE listener_name = $1`, name).Scan(&cursor); err != nil {
+		t.Fatalf("failed to read the cursor: %v", err)
+	}
+	return cursor
+}
+
+func TestPollingListenerGaps(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	listener := newTestPollingListener(t, handler)
+	defer listener.Close() //nolint:errcheck // test cleanup
+
+	// Notification 2 is committed after notification 3 (e.g. by a slower transaction)
+	insertOutbox(t, handler, 1, "first")
+	insertOutbox(t, handler, 3, "third")
+	for _, want := range []string{"first", "third"} {
+		n := receiveNotification(t, listener)
+		if n == nil || n.Extra() != want {
+			t.Fatalf("expected notification %q, got %v", want, n)
+		}
+		if err := n.(Acknowledger).Ack(); err != nil {
+			t.Fatalf("Ack() returned an error: %v", err)
+		}
+	}
+	if cursor := storedCursor(t, handler, listener.Name); cursor != 1 {
+		t.Errorf("stored cursor = %d, want 1 (notification 2 is missing)", cursor)
+	}
+
+	insertOutbox(t, handler, 2, "second")
+	n := receiveNotification(t, listener)
+	if n == nil || n.Extra() != "second" {
+		t.Fatalf("expected the late notification, got %v", n)
+	}
+	if err := n.(Acknowledger).Ack(); err != nil {
+		t.Fatalf("Ack() returned an error: %v", err)
+	}
+	if cursor := storedCursor(t, handler, listener.Name); cursor != 3 {
+		t.Errorf("stored cursor = %d, want 3", cursor)
+	}
+}
+
+func TestPollingListenerGapTimeout(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	listener := newTestPollingListener(t, handler)
+	defer listener.Close() //nolint:errcheck // test cleanup
+	listener.mutex.Lock()
+	listener.GapTimeout = 50 * time.Millisecond
+	listener.mutex.Unlock()
+
+	// Notification 1 never shows up (e.g. its transaction was rolled back)
+	insertOutbox(t, handler, 2, "second")
+	n := receiveNotification(t, listener)
+	if n == nil {
+		t.Fatalf("expected a notification")
+	}
+	if err := n.(Acknowledger).Ack(); err != nil {
+		t.Fatalf("Ack() returned an error: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for storedCursor(t, handler, listener.Name) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the stored cursor didn't move past the missing notification")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
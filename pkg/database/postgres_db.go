@@ -189,6 +189,11 @@ func (handler *PostgresHandler) Begin() (*sql.Tx, error) {
 	return handler.db.Begin()
 }
 
+// BeginTx starts a transaction with the given options
+func (handler *PostgresHandler) BeginTx(opts *sql.TxOptions) (*sql.Tx, error) {
+	return handler.db.BeginTx(context.Background(), opts)
+}
+
 // Commit commits a transaction
 func (handler *PostgresHandler) Commit(tx *sql.Tx) error {
 	return tx.Commit()
@@ -0,0 +1,364 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database is responsible for handling the database setup, configuration and abstraction.
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrReadOnlyQuery is returned when a query that modifies the database is
+// executed in read-only mode
+var ErrReadOnlyQuery = errors.New("only read queries are allowed in read-only mode")
+
+// writeKeywords are the SQL keywords that make a statement modify the database
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "RENAME": true, "COMMENT": true,
+	"GRANT": true, "REVOKE": true, "COPY": true, "LOAD": true, "INTO": true, "CALL": true, "DO": true,
+	"VACUUM": true, "REINDEX": true, "CLUSTER": true, "LOCK": true, "ATTACH": true, "DETACH": true,
+	"SET": true, "RESET": true, "PRAGMA": true, "NOTIFY": true, "LISTEN": true, "REFRESH": true,
+	"BEGIN": true, "COMMIT": true, "ROLLBACK": true, "SAVEPOINT": true, "HANDLER": true,
+}
+
+// readKeywords are the SQL keywords a read-only statement can start with
+var readKeywords = map[string]bool{
+	"SELECT": true, "WITH": true, "VALUES": true, "TABLE": true, "EXPLAIN": true, "SHOW": true,
+}
+
+// QueryResult is the result of a query executed with RunQuery
+type QueryResult struct {
+	// Columns are the names of the columns returned by the query.
+	Columns []string `json:"columns" yaml:"columns"`
+	// Rows are the returned rows, with the column names as keys.
+	Rows []map[string]interface{} `json:"rows" yaml:"rows"`
+	// RowCount is the number of returned rows.
+	RowCount int `json:"row_count" yaml:"row_count"`
+}
+
+// ToMap returns the query result as a generic map (for the agents and plugins)
+func (r *QueryResult) ToMap() map[string]interface{} {
+	columns := make([]interface{}, len(r.Columns))
+	for i, c := range r.Columns {
+		columns[i] = c
+	}
+	rows := make([]interface{}, len(r.Rows))
+	for i, row := range r.Rows {
+		rows[i] = row
+	}
+	return map[string]interface{}{
+		"columns":   columns,
+		"rows":      rows,
+		"row_count": r.RowCount,
+	}
+}
+
+// RunQuery executes a query with the given (positional) arguments and
+// returns its rows. In read-only mode, queries that (may) modify the
+// database are refused and the query is executed in a read-only transaction
+// (on SQLite, with the query_only pragma set), so the queries the keywords
+// check can't catch (for ex. the ones calling functions with side effects)
+// can't modify the database either.
+func RunQuery(db *Handler, query string, args []interface{}, readOnly bool) (*QueryResult, error) {
+	if readOnly && !IsReadOnlyQuery(query) {
+		return nil, ErrReadOnlyQuery
+	}
+
+	if !readOnly {
+		rows, err := (*db).ExecuteQuery(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close() //nolint:errcheck // We can't check the error here
+		return ScanRows(rows)
+	}
+	return runReadOnlyQuery(db, query, args)
+}
+
+// runReadOnlyQuery executes a query in a read-only transaction: BEGIN READ
+// ONLY on PostgreSQL, START TRANSACTION READ ONLY on MySQL and, as SQLite
+// has no read-only transactions, a transaction on a connection with the
+// query_only pragma set (and reset before the connection is released)
+func runReadOnlyQuery(db *Handler, query string, args []interface{}) (*QueryResult, error) {
+	tx, err := (*db).BeginTx(&sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start read-only transaction: %v", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // The transaction never writes anything
+
+	if (*db).DBMS() == DBSQLiteStr {
+		if _, err := tx.Exec("PRAGMA query_only = ON"); err != nil {
+			return nil, fmt.Errorf("failed to start read-only transaction: %v", err)
+		}
+		defer tx.Exec("PRAGMA query_only = OFF") //nolint:errcheck // The connection is released by the rollback
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error here
+	return ScanRows(rows)
+}
+
+// ScanRows reads all the rows of a query result. Values are returned with
+// the types provided by the database driver, except for text returned as
+// []byte, which is converted to string.
+func ScanRows(rows *sql.Rows) (*QueryResult, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the query columns: %v", err)
+	}
+	binary := make([]bool, len(columns))
+	if types, err := rows.ColumnTypes(); err == nil {
+		for i, t := range types {
+			name := strings.ToUpper(t.DatabaseTypeName())
+			binary[i] = name == "BYTEA" || strings.Contains(name, "BLOB") || strings.Contains(name, "BINARY")
+		}
+	}
+
+	result := &QueryResult{Columns: columns, Rows: []map[string]interface{}{}}
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan the query rows: %v", err)
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok && !binary[i] {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the query rows: %v", err)
+	}
+	result.RowCount = len(result.Rows)
+	return result, nil
+}
+
+// BindNamedParams replaces the named parameters (":name") of a query with
+// the placeholders of the given DBMS ("$1" for PostgreSQL and SQLite, "?"
+// for MySQL) and returns the arguments in the matching order.
+// PostgreSQL casts ("::type"), string literals, quoted identifiers and
+// comments are left untouched.
+func BindNamedParams(dbms, query string, params map[string]interface{}) (string, []interface{}, error) {
+	var sb strings.Builder
+	var args []interface{}
+	positions := make(map[string]int)
+
+	err := scanSQL(query, dbms == DBMySQLStr, func(code string) error {
+		for i := 0; i < len(code); i++ {
+			c := code[i]
+			if c == ':' && i+1 < len(code) && code[i+1] == ':' {
+				sb.WriteString("::")
+				i++
+				continue
+			}
+			if c != ':' || i+1 >= len(code) || !isIdentStart(rune(code[i+1])) {
+				sb.WriteByte(c)
+				continue
+			}
+			j := i + 1
+			for j < len(code) && isIdentPart(rune(code[j])) {
+				j++
+			}
+			name := code[i+1 : j]
+			value, ok := params[name]
+			if !ok {
+				return fmt.Errorf("missing value for query parameter '%s'", name)
+			}
+			if dbms == DBMySQLStr {
+				args = append(args, value)
+				sb.WriteByte('?')
+			} else {
+				pos, seen := positions[name]
+				if !seen {
+					args = append(args, value)
+					pos = len(args)
+					positions[name] = pos
+				}
+				sb.WriteString("$" + strconv.Itoa(pos))
+			}
+			i = j - 1
+		}
+		return nil
+	}, func(literal string) {
+		sb.WriteString(literal)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return sb.String(), args, nil
+}
+
+// IsReadOnlyQuery returns true if the query is a single statement that
+// only reads data (SELECT, WITH without data-modifying statements, VALUES,
+// EXPLAIN or SHOW). The query is checked both with and without backslash
+// escapes in strings, so it can't hide a statement to either dialect.
+func IsReadOnlyQuery(query string) bool {
+	return isReadOnlyQuery(query, false) && isReadOnlyQuery(query, true)
+}
+
+func isReadOnlyQuery(query string, backslashEscapes bool) bool {
+	var words []string
+	statements := 0
+	pending := false
+	err := scanSQL(query, backslashEscapes, func(code string) error {
+		for _, field := range strings.FieldsFunc(code, func(r rune) bool { return !isIdentPart(r) }) {
+			words = append(words, strings.ToUpper(field))
+		}
+		for _, r := range code {
+			switch {
+			case r == ';':
+				if pending {
+					statements++
+					pending = false
+				}
+			case !unicode.IsSpace(r):
+				pending = true
+			}
+		}
+		return nil
+	}, func(string) {
+		pending = true
+	})
+	if pending {
+		statements++
+	}
+	if err != nil || statements != 1 || len(words) == 0 || !readKeywords[words[0]] {
+		return false
+	}
+	for _, w := range words {
+		if writeKeywords[w] {
+			return false
+		}
+	}
+	// EXPLAIN ANALYZE executes the statement
+	return words[0] != "EXPLAIN" || (len(words) > 1 && words[1] != "ANALYZE" && words[1] != "ANALYSE")
+}
+
+// scanSQL splits a query in code and literals (strings, quoted identifiers
+// and comments), calling the respective callback for each part in order.
+// backslashEscapes is true for the dialects (MySQL) where a backslash
+// escapes the next character in a string.
+func scanSQL(query string, backslashEscapes bool, code func(string) error, literal func(string)) error {
+	start := 0
+	flush := func(end int) error {
+		if end > start {
+			return code(query[start:end])
+		}
+		return nil
+	}
+	for i := 0; i < len(query); i++ {
+		var end int
+		switch {
+		case query[i] == '\'' || query[i] == '"' || query[i] == '`':
+			end = closingQuote(query, i, backslashEscapes && query[i] != '"')
+		case strings.HasPrefix(query[i:], "--"):
+			end = strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i + 1
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			end = strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return errors.New("unterminated comment")
+			}
+			end += i + 4
+		case query[i] == '$' && (i == 0 || !isIdentPart(rune(query[i-1]))):
+			// PostgreSQL dollar-quoted strings ($$...$$ or $tag$...$tag$)
+			tagEnd := strings.IndexByte(query[i+1:], '$')
+			if tagEnd < 0 || !isDollarTag(query[i+1:i+1+tagEnd]) {
+				continue
+			}
+			tag := query[i : i+tagEnd+2]
+			end = strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				return errors.New("unterminated dollar-quoted string")
+			}
+			end += i + 2*len(tag)
+		default:
+			continue
+		}
+		if end < 0 {
+			return errors.New("unterminated quoted string")
+		}
+		if err := flush(i); err != nil {
+			return err
+		}
+		literal(query[i:end])
+		start = end
+		i = end - 1
+	}
+	return flush(len(query))
+}
+
+// closingQuote returns the position after the quoted string (or identifier)
+// starting at i, or -1 if it's not terminated. Doubled quotes are escapes.
+func closingQuote(query string, i int, backslashEscapes bool) int {
+	quote := query[i]
+	for j := i + 1; j < len(query); j++ {
+		if backslashEscapes && query[j] == '\\' {
+			j++
+			continue
+		}
+		if query[j] == quote {
+			if j+1 < len(query) && query[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return -1
+}
+
+func isDollarTag(tag string) bool {
+	if tag == "" {
+		return true
+	}
+	if !isIdentStart(rune(tag[0])) {
+		return false
+	}
+	for _, r := range tag {
+		if !isIdentPart(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIsReadOnlyQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM Sources WHERE source_id = $1", true},
+		{"  select name, 'DELETE FROM x' AS txt FROM Sources;", true},
+		{"WITH s AS (SELECT 1) SELECT * FROM s", true},
+		{"SELECT 1 -- DROP TABLE Sources", true},
+		{"EXPLAIN SELECT * FROM Sources", true},
+		{"SELECT $$DELETE$$", true},
+		{"INSERT INTO Sources (url) VALUES ('x')", false},
+		{"update Sources set url = 'x'", false},
+		{"WITH d AS (DELETE FROM Sources RETURNING *) SELECT * FROM d", false},
+		{"SELECT 1; DROP TABLE Sources", false},
+		{"SELECT * INTO copy FROM Sources", false},
+		{"SELECT * FROM Sources FOR UPDATE", false},
+		{"EXPLAIN ANALYZE DELETE FROM Sources", false},
+		{"SELECT 'a\\'; DELETE FROM Sources; --'", false},
+		{"SELECT 'unterminated", false},
+		{"/* comment */ DROP TABLE Sources", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsReadOnlyQuery(tt.query); got != tt.want {
+			t.Errorf("IsReadOnlyQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestBindNamedParams(t *testing.T) {
+	params := map[string]interface{}{"id": 42, "name": "test"}
+	query := "SELECT id::text, ':id' FROM Sources WHERE source_id = :id OR name = :name OR parent = :id"
+
+	got, args, err := BindNamedParams(DBPostgresStr, query, params)
+	if err != nil {
+		t.Fatalf("BindNamedParams() returned an error: %v", err)
+	}
+	want := "SELECT id::text, ':id' FROM Sources WHERE source_id = $1 OR name = $2 OR parent = $1"
+	if got != want || !reflect.DeepEqual(args, []interface{}{42, "test"}) {
+		t.Errorf("BindNamedParams() = %q, %v", got, args)
+	}
+
+	got, args, err = BindNamedParams(DBMySQLStr, query, params)
+	if err != nil {
+		t.Fatalf("BindNamedParams() returned an error: %v", err)
+	}
+	want = "SELECT id::text, ':id' FROM Sources WHERE source_id = ? OR name = ? OR parent = ?"
+	if got != want || !reflect.DeepEqual(args, []interface{}{42, "test", 42}) {
+		t.Errorf("BindNamedParams() = %q, %v", got, args)
+	}
+
+	if _, _, err := BindNamedParams(DBPostgresStr, "SELECT :missing", params); err == nil {
+		t.Errorf("BindNamedParams() expected an error for a missing parameter")
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	handler := newTestSQLiteHandler(t)
+	if _, err := handler.Exec(`INSERT INTO Sources (url, status) VALUES ('https://example.com', 'example')`); err != nil {
+		t.Fatalf("failed to insert the test source: %v", err)
+	}
+
+	query, args, err := BindNamedParams(handler.DBMS(), "SELECT source_id, url, status FROM Sources WHERE url = :url", map[string]interface{}{"url": "https://example.com"})
+	if err != nil {
+		t.Fatalf("BindNamedParams() returned an error: %v", err)
+	}
+	result, err := RunQuery(&handler, query, args, true)
+	if err != nil {
+		t.Fatalf("RunQuery() returned an error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Columns, []string{"source_id", "url", "status"}) || result.RowCount != 1 {
+		t.Fatalf("unexpected query result: %+v", result)
+	}
+	row := result.Rows[0]
+	if _, ok := row["source_id"].(int64); !ok || row["url"] != "https://example.com" || row["status"] != "example" {
+		t.Errorf("unexpected row: %#v", row)
+	}
+
+	if _, err := RunQuery(&handler, "DELETE FROM Sources", nil, true); !errors.Is(err, ErrReadOnlyQuery) {
+		t.Errorf("RunQuery() = %v, want ErrReadOnlyQuery", err)
+	}
+	// Queries the keywords check can't catch can't write either
+	if _, err := runReadOnlyQuery(&handler, "DELETE FROM Sources", nil); err == nil {
+		t.Errorf("runReadOnlyQuery() executed a DELETE")
+	}
+	if _, err := RunQuery(&handler, "DELETE FROM Sources WHERE url = $1", []interface{}{"https://example.com"}, false); err != nil {
+		t.Errorf("RunQuery() returned an error: %v", err)
+	}
+}
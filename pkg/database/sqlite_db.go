@@ -17,13 +17,16 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	_ "embed" // SQLite schema
 	"fmt"
 	"strings"
 
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 
-	_ "github.com/lib/pq" // PostgreSQL driver
+	_ "github.com/lib/pq"           // PostgreSQL driver
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
 )
 
 // ---------------------------------------------------------------
@@ -34,15 +37,40 @@ import (
 type SQLiteHandler struct {
 	db   *sql.DB
 	dbms string
+	keep *sql.Conn // Keeps an in-memory database alive
+}
+
+// SQLiteMemoryPrefix is the prefix of the in-memory SQLite databases names:
+// ":memory:name" is an in-memory database shared by the connections of the
+// handler, which exists until the handler is closed
+const SQLiteMemoryPrefix = ":memory:"
+
+//go:embed sqlite-setup-v1.4.sqlite3
+var sqliteSchema string
+
+// SQLiteSchema returns the SQL script which creates the CROWler DB schema on
+// SQLite
+func SQLiteSchema() string {
+	return sqliteSchema
 }
 
 // Connect connects to an SQLite database
 func (handler *SQLiteHandler) Connect(c cfg.Config) error {
 	// Construct the connection string from the Config struct
 	connectionString := fmt.Sprintf("file:%s?cache=shared&mode=rwc", c.Database.DBName)
+	if name, ok := strings.CutPrefix(c.Database.DBName, SQLiteMemoryPrefix); ok {
+		if name == "" {
+			name = "crowler"
+		}
+		connectionString = fmt.Sprintf("file:%s?cache=shared&mode=memory", name)
+	}
 
 	var err error
 	handler.db, err = sql.Open("sqlite3", connectionString)
+	if err == nil && strings.HasPrefix(c.Database.DBName, SQLiteMemoryPrefix) {
+		// An in-memory database is removed when its last connection is closed
+		handler.keep, err = handler.db.Conn(context.Background())
+	}
 
 	// Optimize the database connection
 	if err == nil {
@@ -57,6 +85,10 @@ func (handler *SQLiteHandler) Connect(c cfg.Config) error {
 
 // Close closes the database connection
 func (handler *SQLiteHandler) Close() error {
+	if handler.keep != nil {
+		_ = handler.keep.Close()
+		handler.keep = nil
+	}
 	return handler.db.Close()
 }
 
@@ -85,6 +117,11 @@ func (handler *SQLiteHandler) Begin() (*sql.Tx, error) {
 	return handler.db.Begin()
 }
 
+// BeginTx starts a transaction with the given options
+func (handler *SQLiteHandler) BeginTx(opts *sql.TxOptions) (*sql.Tx, error) {
+	return handler.db.BeginTx(context.Background(), opts)
+}
+
 // Commit commits a transaction
 func (handler *SQLiteHandler) Commit(tx *sql.Tx) error {
 	return tx.Commit()
@@ -111,9 +148,10 @@ func (handler *SQLiteHandler) CheckConnection(c cfg.Config) error {
 	return err
 }
 
-// NewListener returns a new Listener for the database
+// NewListener returns a new Listener for the database. SQLite doesn't
+// support LISTEN/NOTIFY, so the listener polls the EventsOutbox table.
 func (handler *SQLiteHandler) NewListener() Listener {
-	return nil
+	return NewPollingListener(handler)
 }
 
 // ---------------------------------------------------------------
@@ -19,6 +19,7 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"time"
 )
 
 const (
@@ -63,6 +64,135 @@ type Source struct {
 	Status int
 }
 
+// APIKey represents the structure of the APIKeys table
+// (the key itself is never stored, only its SHA256)
+type APIKey struct {
+	// ID is the unique identifier of the key.
+	ID uint64 `json:"key_id" yaml:"key_id"`
+	// Name is a name to identify the key (for ex. the user or service using it).
+	Name string `json:"name" yaml:"name"`
+	// Prefix is the first characters of the key (to identify it without revealing it).
+	Prefix string `json:"key_prefix" yaml:"key_prefix"`
+	// Scope is the scope granted to the key (search, console or admin).
+	Scope string `json:"scope" yaml:"scope"`
+	// RateLimit is the per-key rate limit (for ex. "10,10"), empty means the service default.
+	RateLimit string `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	// Active is false for revoked keys.
+	Active bool `json:"active" yaml:"active"`
+	// CreatedAt is when the key was created.
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	// ExpiresAt is when the key expires (nil means it never expires).
+	ExpiresAt *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	// LastUsedAt is the last time the key was used.
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" yaml:"last_used_at,omitempty"`
+}
+
+// AgentRun represents the structure of the AgentRuns table
+// (the history of the agents executions)
+type AgentRun struct {
+	// ID is the unique identifier of the run.
+	ID uint64 `json:"run_id" yaml:"run_id"`
+	// JobName is the name of the agent (job) executed.
+	JobName string `json:"job_name" yaml:"job_name"`
+	// TriggerType is the agent trigger type (for ex. "event").
+	TriggerType string `json:"trigger_type,omitempty" yaml:"trigger_type,omitempty"`
+	// TriggerName is the agent trigger name (for ex. the event type).
+	TriggerName string `json:"trigger_name,omitempty" yaml:"trigger_name,omitempty"`
+	// EventID is the ID of the event that triggered the run (if any).
+	EventID string `json:"event_id,omitempty" yaml:"event_id,omitempty"`
+	// Status is the status of the run (running, success or error).
+	Status string `json:"status" yaml:"status"`
+	// StartedAt is when the run started.
+	StartedAt time.Time `json:"started_at" yaml:"started_at"`
+	// FinishedAt is when the run finished (nil while the run is running).
+	FinishedAt *time.Time `json:"finished_at,omitempty" yaml:"finished_at,omitempty"`
+	// DurationMs is the duration of the run in milliseconds.
+	DurationMs int64 `json:"duration_ms" yaml:"duration_ms"`
+	// Result is the output of the last step of the run (truncated).
+	Result string `json:"result,omitempty" yaml:"result,omitempty"`
+	// Error is the error that stopped the run (if any).
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Steps are the steps executed by the run (only returned for a single run).
+	Steps []AgentRunStep `json:"steps,omitempty" yaml:"steps,omitempty"`
+}
+
+// AgentRunStep represents the structure of the AgentRunSteps table
+type AgentRunStep struct {
+	// ID is the unique identifier of the step.
+	ID uint64 `json:"step_id" yaml:"step_id"`
+	// RunID is the unique identifier of the run the step belongs to.
+	RunID uint64 `json:"run_id" yaml:"run_id"`
+	// Index is the position of the step in the run (fallback steps included).
+	Index int `json:"step_index" yaml:"step_index"`
+	// Action is the name of the action executed by the step.
+	Action string `json:"action" yaml:"action"`
+	// Status is the status of the step (success or error).
+	Status string `json:"status" yaml:"status"`
+	// StartedAt is when the step started.
+	StartedAt time.Time `json:"started_at" yaml:"started_at"`
+	// DurationMs is the duration of the step in milliseconds.
+	DurationMs int64 `json:"duration_ms" yaml:"duration_ms"`
+	// Input is the step parameters, without the agent configuration (truncated).
+	Input string `json:"input,omitempty" yaml:"input,omitempty"`
+	// Output is the step output (truncated).
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+	// Error is the error returned by the step (if any).
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Attempts is the number of times the step was executed (retries included).
+	Attempts int `json:"attempts" yaml:"attempts"`
+	// Policy is the effective retry, timeout and fallback policy of the step (JSON).
+	Policy string `json:"policy,omitempty" yaml:"policy,omitempty"`
+}
+
+// AgentSchedule represents the schedule of an agent, as stored in the
+// EventSchedules table (the persistent state of the scheduled agents)
+type AgentSchedule struct {
+	// AgentName is the name of the scheduled agent.
+	AgentName string `json:"agent_name" yaml:"agent_name"`
+	// Schedule is the agent cron expression.
+	Schedule string `json:"schedule" yaml:"schedule"`
+	// NextRun is when the agent has to run next.
+	NextRun time.Time `json:"next_run" yaml:"next_run"`
+	// LastRun is when the agent ran last (nil if it has never run).
+	LastRun *time.Time `json:"last_run,omitempty" yaml:"last_run,omitempty"`
+	// Active is false for the schedules that have been disabled.
+	Active bool `json:"active" yaml:"active"`
+}
+
+// AgentRunFilter is used to select the runs returned by ListAgentRuns
+type AgentRunFilter struct {
+	JobName string
+	EventID string
+	Status  string
+	Limit   int
+	Offset  int
+}
+
+// FrontierItem represents the structure of the CrawlFrontier table
+// (the persistent queue of URLs of a source's crawl)
+type FrontierItem struct {
+	// ID is the unique identifier of the frontier entry.
+	ID uint64 `json:"frontier_id" yaml:"frontier_id"`
+	// SourceID is the unique identifier of the source being crawled.
+	SourceID uint64 `json:"source_id" yaml:"source_id"`
+	// URL is the URL (or link) to crawl.
+	URL string `json:"url" yaml:"url"`
+	// ParentURL is the URL of the page (or sitemap) where the URL was found.
+	ParentURL string `json:"parent_url" yaml:"parent_url"`
+	// Depth is the crawling depth at which the URL has to be crawled.
+	Depth int `json:"depth" yaml:"depth"`
+	// ElementID is the ID of the element containing the link (if any).
+	ElementID string `json:"element_id" yaml:"element_id"`
+	// FromSitemap is true if the URL was collected from a sitemap.
+	FromSitemap bool `json:"from_sitemap" yaml:"from_sitemap"`
+	// Status is the status of the URL (queued, in_flight, done or failed).
+	Status string `json:"status" yaml:"status"`
+	// Attempts is the number of times the URL has been picked up for crawling.
+	Attempts int `json:"attempts" yaml:"attempts"`
+	// LastError is the last error returned while crawling the URL.
+	LastError string `json:"last_error" yaml:"last_error"`
+}
+
 // Event represents the structure of the Events table
 type Event struct {
 	// Action is FOR event handling (internal use only!)
@@ -0,0 +1,164 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package detection implements the detection library for the Crowler.
+package detection
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	ruleset "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// The functions in this file match the signatures evaluated in the browser
+// (through the WebDriver): the cookies and the JavaScript globals.
+
+// jsGlobalsScript returns the values of the requested window properties
+// (arguments[0]) as strings, objects and functions are returned as "" (they
+// only prove the property exists). Missing properties aren't returned.
+const jsGlobalsScript = `
+var properties = arguments[0];
+var found = {};
+for (var i = 0; i < properties.length; i++) {
+	try {
+		var value = window;
+		var path = properties[i].split(".");
+		for (var j = 0; j < path.length && value !== undefined && value !== null; j++) {
+			value = value[path[j]];
+		}
+		if (value === undefined || value === null) {
+			continue;
+		}
+		var type = typeof value;
+		found[properties[i]] = (type === "string" || type === "number" || type === "boolean") ? String(value) : "";
+	} catch (e) {
+		// Properties with throwing getters are considered missing
+	}
+}
+return found;
+`
+
+// jsGlobalPath returns the path of a JS global property relative to window
+func jsGlobalPath(property string) string {
+	return strings.TrimPrefix(strings.TrimSpace(property), "window.")
+}
+
+func detectTechByCookies(wd *vdi.WebDriver, signatures *map[string][]ruleset.CookieSignature, detectedTech *map[string]detectionEntityDetails) {
+	const detectionType = "cookie"
+	cookies, err := (*wd).GetCookies()
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "getting cookies: %s", err)
+		return
+	}
+	values := make(map[string]string, len(cookies))
+	for _, cookie := range cookies {
+		values[strings.ToLower(cookie.Name)] = strings.ToLower(cookie.Value)
+	}
+	for ObjName := range *signatures {
+		for _, signature := range (*signatures)[ObjName] {
+			value, found := values[strings.ToLower(strings.TrimSpace(signature.Name))]
+			matchBrowserSignature(detectedTech, ObjName, detectionType, signature.Name, signature.Value, value, found, signature.Confidence, signature.Version)
+		}
+	}
+}
+
+func detectTechByJSGlobals(wd *vdi.WebDriver, signatures *map[string][]ruleset.JSGlobalSignature, detectedTech *map[string]detectionEntityDetails) {
+	const detectionType = "js_global"
+
+	// Collect the properties of all the rules, to read them in a single call
+	unique := make(map[string]bool)
+	for _, item := range *signatures {
+		for _, signature := range item {
+			if path := jsGlobalPath(signature.Property); path != "" {
+				unique[path] = true
+			}
+		}
+	}
+	if len(unique) == 0 {
+		return
+	}
+	properties := make([]string, 0, len(unique))
+	for property := range unique {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	result, err := (*wd).ExecuteScript(jsGlobalsScript, []interface{}{properties})
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "getting JS globals: %s", err)
+		return
+	}
+	found, ok := result.(map[string]interface{})
+	if !ok && result != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "unexpected JS globals result: %v", result)
+		return
+	}
+
+	for ObjName := range *signatures {
+		for _, signature := range (*signatures)[ObjName] {
+			path := jsGlobalPath(signature.Property)
+			if path == "" {
+				continue
+			}
+			value, exists := found[path]
+			matchBrowserSignature(detectedTech, ObjName, detectionType, signature.Property, signature.Value, strings.ToLower(fmt.Sprint(value)), exists, signature.Confidence, signature.Version)
+		}
+	}
+}
+
+// matchBrowserSignature matches the value of a cookie or a JS global (name)
+// against the patterns of a signature. No patterns (or "*") match any value
+// of an existing name, "!*" matches a missing name (negative detection).
+func matchBrowserSignature(detectedTech *map[string]detectionEntityDetails, ObjName, detectionType, name string, patterns []string, value string, exists bool, confidence float32, version string) {
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	for _, pattern := range patterns {
+		switch pattern {
+		case "":
+			continue
+		case "!*":
+			if !exists {
+				updateDetectedTech(detectedTech, ObjName, -confidence, name)
+			}
+			continue
+		case "*":
+			if !exists {
+				continue
+			}
+			updateDetectedTech(detectedTech, ObjName, confidence, name)
+			updateDetectedVersion(detectedTech, ObjName, ruleset.ExpandVersion(nil, version, value), confidence)
+		default:
+			if !exists {
+				continue
+			}
+			matched, err := regexp.MatchString(pattern, value)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, errMatchingSignature, err)
+				continue
+			}
+			if !matched {
+				continue
+			}
+			updateDetectedTech(detectedTech, ObjName, confidence, name+"="+pattern)
+			updateDetectedVersion(detectedTech, ObjName, ruleset.ExtractVersion(pattern, version, value), confidence)
+		}
+		updateDetectedType(detectedTech, ObjName, detectionType)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package detection implements the detection library for the Crowler.
+package detection
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-auxiliaries/selenium"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	"github.com/pzaino/thecrowler/pkg/plugin/plugintest"
+	ruleset "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// countingWebDriver counts the scripts executed on the fake WebDriver
+type countingWebDriver struct {
+	*plugintest.WebDriver
+	scripts int
+}
+
+func (wd *countingWebDriver) ExecuteScript(script string, args []interface{}) (interface{}, error) {
+	wd.scripts++
+	return wd.WebDriver.ExecuteScript(script, args)
+}
+
+func TestDetectTechnologiesBrowserSignatures(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	re := ruleset.NewRuleEngine("", []ruleset.Ruleset{
+		{
+			Name: "test",
+			RuleGroups: []ruleset.RuleGroup{
+				{GroupName: "detection", IsEnabled: true, DetectionRules: []ruleset.DetectionRule{
+					{
+						ObjectName: "jQuery",
+						JSGlobals: []ruleset.JSGlobalSignature{
+							{Property: "window.jQuery.fn.jquery", Value: []string{"^([0-9.]+)$"}, Version: "$1", Confidence: 10},
+						},
+					},
+					{
+						ObjectName: "React",
+						JSGlobals:  []ruleset.JSGlobalSignature{{Property: "React", Confidence: 10}},
+					},
+					{
+						ObjectName: "Vue",
+						JSGlobals:  []ruleset.JSGlobalSignature{{Property: "Vue.version", Value: []string{"*"}, Confidence: 10}},
+					},
+					{
+						ObjectName: "PHP",
+						Cookies:    []ruleset.CookieSignature{{Name: "PHPSESSID", Confidence: 10}},
+					},
+					{
+						ObjectName: "Cloudflare",
+						Cookies: []ruleset.CookieSignature{
+							{Name: "__cf_bm", Value: []string{"^[a-f0-9]+$"}, Confidence: 10},
+							{Name: "__cfduid", Value: []string{"*"}, Confidence: 10},
+						},
+					},
+					{
+						ObjectName: "Shopify",
+						Cookies:    []ruleset.CookieSignature{{Name: "_shopify_y", Value: []string{"!*"}, Confidence: 10}},
+					},
+				}},
+			},
+		},
+	})
+
+	fake := plugintest.NewWebDriver()
+	if err := fake.AddPage("https://example.com/", testPage); err != nil {
+		t.Fatalf("loading the page: %v", err)
+	}
+	fake.SetGlobal("jQuery", map[string]interface{}{"fn": map[string]interface{}{"jquery": "3.7.1"}})
+	fake.SetGlobal("React", map[string]interface{}{"version": "18.2.0"})
+	_ = fake.AddCookie(&selenium.Cookie{Name: "PHPSESSID", Value: "abc"})
+	_ = fake.AddCookie(&selenium.Cookie{Name: "__cf_bm", Value: "0A1B2C"})
+	wd := &countingWebDriver{WebDriver: fake}
+	var vwd vdi.WebDriver = wd
+
+	body := testPage
+	detected := DetectTechnologies(&DContext{
+		CtxID:        "test",
+		TargetURL:    "https://example.com/",
+		ResponseBody: &body,
+		WD:           &vwd,
+		RE:           re,
+	})
+	if detected == nil {
+		t.Fatalf("no technologies detected")
+	}
+	got := *detected
+
+	for _, name := range []string{"jquery", "react", "php", "cloudflare", "no_shopify"} {
+		if _, exists := got[name]; !exists {
+			t.Errorf("%s not detected: %v", name, got)
+		}
+	}
+	for _, name := range []string{"vue", "shopify"} {
+		if _, exists := got[name]; exists {
+			t.Errorf("%s detected, but it isn't in the page", name)
+		}
+	}
+	if got["jquery"].Version != "3.7.1" {
+		t.Errorf("jquery version = %q, expected 3.7.1", got["jquery"].Version)
+	}
+	if !strings.Contains(got["jquery"].EntityType, "js_global") || !strings.Contains(got["php"].EntityType, "cookie") {
+		t.Errorf("unexpected entity types: jquery %q, php %q", got["jquery"].EntityType, got["php"].EntityType)
+	}
+	if wd.scripts != 1 {
+		t.Errorf("executed %d scripts, expected a single one for all the JS globals", wd.scripts)
+	}
+}
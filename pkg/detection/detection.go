@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -42,6 +43,7 @@ type detectionEntityDetails struct {
 	matchedPatterns []string
 	confidence      float32
 	pluginResult    map[string]interface{}
+	versions        map[string]float32 // Versions found, with the confidence of the signatures that found them
 	//externalDetection map[string]interface{}
 }
 
@@ -64,6 +66,12 @@ func DetectTechnologies(dtCtx *DContext) *map[string]DetectedEntity {
 	// Initialize a slice to store the detected stuff
 	detectedTech := make(map[string]detectionEntityDetails)
 
+	// Get the precompiled signatures (nil means matching the rules one by one)
+	var index *ruleset.DetectionIndex
+	if !dtCtx.NoIndex {
+		index = dtCtx.RE.GetDetectionIndex()
+	}
+
 	var responseBody string
 	if dtCtx.ResponseBody != nil {
 		// Normalize the response body
@@ -88,6 +96,14 @@ func DetectTechnologies(dtCtx *DContext) *map[string]DetectedEntity {
 			xGenerator = "X-Generator"
 		)
 		for headerTag := range *dtCtx.Header {
+			if index != nil {
+				// The Host-Header tag is only matched by the "*" fields, which
+				// have no values for it
+				if headerTag != hostHeader {
+					detectTechByTagIndex(dtCtx.Header, headerTag, index, &detectedTech)
+				}
+				continue
+			}
 			// Get the HTTP header fields for the specific tag
 			var Signatures map[string]map[string]ruleset.HTTPHeaderField
 			if headerTag == hostHeader {
@@ -113,7 +129,9 @@ func DetectTechnologies(dtCtx *DContext) *map[string]DetectedEntity {
 	}
 
 	// Try to detect technologies using URL's micro-signatures (e.g., /wp-content/)
-	if dtCtx.TargetURL != "" {
+	if dtCtx.TargetURL != "" && index != nil {
+		detectTechByURLIndex(dtCtx.TargetURL, index.URL, &detectedTech)
+	} else if dtCtx.TargetURL != "" {
 		URLSignatures := ruleset.GetAllURLMicroSignaturesMap(&Patterns)
 		detectTechByURL(dtCtx.TargetURL, &URLSignatures, &detectedTech)
 		URLSignatures = nil
@@ -121,7 +139,10 @@ func DetectTechnologies(dtCtx *DContext) *map[string]DetectedEntity {
 		cmn.DebugMsg(cmn.DbgLvlDebug, "Skipping URL detection because the target URL is empty")
 	}
 
-	if responseBody != "" {
+	if responseBody != "" && index != nil {
+		// Try to detect technologies using meta tags and page content
+		detectTechByContentIndex(responseBody, index, &detectedTech)
+	} else if responseBody != "" {
 		// Try to detect technologies using meta tags
 		MetaTagsSignatures := ruleset.GetAllMetaTagsMap(&Patterns)
 		detectTechByMetaTags(responseBody, &MetaTagsSignatures, &detectedTech)
@@ -144,12 +165,26 @@ func DetectTechnologies(dtCtx *DContext) *map[string]DetectedEntity {
 			cmn.DebugMsg(cmn.DbgLvlDebug, "No detection rules requiring plugins")
 		}
 		Plugins = nil
+
+		// Try to detect technologies using the cookies and the JS globals
+		CookieSignatures := ruleset.GetAllCookiesMap(&Patterns)
+		if len(CookieSignatures) > 0 {
+			detectTechByCookies(dtCtx.WD, &CookieSignatures, &detectedTech)
+		}
+		CookieSignatures = nil
+		JSGlobalSignatures := ruleset.GetAllJSGlobalsMap(&Patterns)
+		if len(JSGlobalSignatures) > 0 {
+			detectTechByJSGlobals(dtCtx.WD, &JSGlobalSignatures, &detectedTech)
+		}
+		JSGlobalSignatures = nil
 	} else {
-		cmn.DebugMsg(cmn.DbgLvlDebug, "Skipping plugin detection because the WebDriver is nil")
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Skipping plugin, cookie and JS globals detection because the WebDriver is nil")
 	}
 
 	// Check for SSL/TLS technologies
-	if dtCtx.HSSLInfo != nil {
+	if dtCtx.HSSLInfo != nil && index != nil {
+		detectTechBySSLIndex(dtCtx.HSSLInfo.CertChain, index.SSL, &detectedTech)
+	} else if dtCtx.HSSLInfo != nil {
 		sslSignatures := ruleset.GetAllSSLSignaturesMap(&Patterns)
 		detectTechBySSL(dtCtx.HSSLInfo, &sslSignatures, &detectedTech)
 		sslSignatures = nil
@@ -202,6 +237,10 @@ func DetectTechnologies(dtCtx *DContext) *map[string]DetectedEntity {
 				MatchedPatterns: v.matchedPatterns,
 				PluginResult:    v.pluginResult,
 			}
+			if versions := resolveVersions(v.versions); len(versions) > 0 {
+				entity.Version = versions[0]
+				entity.Versions = versions
+			}
 			detectedTechStr[k] = entity
 		}
 	}
@@ -273,6 +312,7 @@ func detectSSLTechBySignatureValue(certChain []*x509.Certificate, signature rule
 			} else if matched {
 				//if strings.Contains(certField, signatureValue) {
 				updateDetectedTech(detectedTech, ObjName, signature.Confidence, signatureValue)
+				updateDetectedVersion(detectedTech, ObjName, ruleset.ExtractVersion(signatureValue, signature.Version, certField), signature.Confidence)
 				updateDetectedType(detectedTech, ObjName, detectionType)
 			}
 		}
@@ -308,7 +348,7 @@ func detectTechnologiesByKeyword(responseBody string, signatures *map[string][]r
 
 func detectTechBySignature(responseBody string, doc *goquery.Document, signature ruleset.PageContentSignature, sig string, detectedTech *map[string]detectionEntityDetails) {
 	if signature.Key == "*" {
-		detectTechBySignatureValue(responseBody, signature.Signature, sig, detectedTech, signature.Confidence)
+		detectTechBySignatureValue(responseBody, signature.Signature, sig, detectedTech, signature.Confidence, signature.Version)
 	} else {
 		// prepare the signature key
 		key := strings.ToLower(strings.TrimSpace(signature.Key))
@@ -321,24 +361,24 @@ func detectTechBySignature(responseBody string, doc *goquery.Document, signature
 			}
 			text2 = htmlItem.Text()
 			if attrExists {
-				detectTechBySignatureValue(text1, signature.Signature, sig, detectedTech, signature.Confidence)
+				detectTechBySignatureValue(text1, signature.Signature, sig, detectedTech, signature.Confidence, signature.Version)
 			}
 			if len(signature.Text) > 0 {
-				detectTechBySignatureValue(text2, signature.Text, sig, detectedTech, signature.Confidence)
+				detectTechBySignatureValue(text2, signature.Text, sig, detectedTech, signature.Confidence, signature.Version)
 			}
 		})
 	}
 }
 
-func detectTechBySignatureValue(text string, signatures []string, sig string, detectedTech *map[string]detectionEntityDetails, confidence float32) {
+func detectTechBySignatureValue(text string, signatures []string, sig string, detectedTech *map[string]detectionEntityDetails, confidence float32, version string) {
 	for _, sigValue := range signatures {
 		if sigValue != "" {
-			detectTechBySignatureValueHelper(text, sigValue, sig, detectedTech, confidence)
+			detectTechBySignatureValueHelper(text, sigValue, sig, detectedTech, confidence, version)
 		}
 	}
 }
 
-func detectTechBySignatureValueHelper(text string, sigValue string, sig string, detectedTech *map[string]detectionEntityDetails, confidence float32) {
+func detectTechBySignatureValueHelper(text string, sigValue string, sig string, detectedTech *map[string]detectionEntityDetails, confidence float32, version string) {
 	const detectionType = "html"
 	if sigValue != "*" {
 		matched, err := regexp.MatchString(sigValue, text)
@@ -346,10 +386,12 @@ func detectTechBySignatureValueHelper(text string, sigValue string, sig string,
 			cmn.DebugMsg(cmn.DbgLvlError, errMatchingSignature, err)
 		} else if matched {
 			updateDetectedTech(detectedTech, sig, confidence, sigValue)
+			updateDetectedVersion(detectedTech, sig, ruleset.ExtractVersion(sigValue, version, text), confidence)
 		}
 	} else {
 		// Just call updateDetectedTech if the signature is "*"
 		updateDetectedTech(detectedTech, sig, confidence, "*")
+		updateDetectedVersion(detectedTech, sig, ruleset.ExpandVersion(nil, version, text), confidence)
 	}
 	updateDetectedType(detectedTech, sig, detectionType)
 }
@@ -426,6 +468,58 @@ func updateDetectedType(detectedTech *map[string]detectionEntityDetails, sig str
 	}
 }
 
+// updateDetectedVersion adds a version found by a signature (if any) to a
+// detected entity
+func updateDetectedVersion(detectedTech *map[string]detectionEntityDetails, sig string, version string, confidence float32) {
+	if version == "" {
+		return
+	}
+	entity, ok := (*detectedTech)[sig]
+	if !ok {
+		return
+	}
+	if entity.versions == nil {
+		entity.versions = make(map[string]float32)
+	}
+	entity.versions[version] += confidence
+	(*detectedTech)[sig] = entity
+}
+
+// resolveVersions returns the versions found for an entity, the most likely
+// first. When the signatures disagree, a version is supported by its own
+// signatures and by the ones of its prefixes (e.g. "6.4" supports "6.4.2");
+// ties go to the most specific version and then to the highest one.
+func resolveVersions(versions map[string]float32) []string {
+	if len(versions) == 0 {
+		return nil
+	}
+	support := make(map[string]float32, len(versions))
+	resolved := make([]string, 0, len(versions))
+	for version, confidence := range versions {
+		support[version] += confidence
+		for other, otherConfidence := range versions {
+			if other != version && cmn.VersionHasPrefix(version, other) {
+				support[version] += otherConfidence
+			}
+		}
+		resolved = append(resolved, version)
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		a, b := resolved[i], resolved[j]
+		if support[a] != support[b] {
+			return support[a] > support[b]
+		}
+		if sa, sb := cmn.VersionSpecificity(a), cmn.VersionSpecificity(b); sa != sb {
+			return sa > sb
+		}
+		if c := cmn.CompareVersions(a, b); c != 0 {
+			return c > 0
+		}
+		return a < b
+	})
+	return resolved
+}
+
 func detectTechByTag(header *http.Header, tagName string, detectRules *map[string]map[string]ruleset.HTTPHeaderField, detectedTech *map[string]detectionEntityDetails) {
 	hh := (*header)[tagName] // get the header value (header tag name is case sensitive)
 	tagName = strings.ToLower(tagName)
@@ -463,9 +557,11 @@ func detectTechByTagHelper(tagName string, tag string, detectRules *map[string]m
 				}
 				if matched {
 					updateDetectedTech(detectedTech, ObjName, item[tagName].Confidence, signature)
+					updateDetectedVersion(detectedTech, ObjName, ruleset.ExtractVersion(signature, item[tagName].Version, tag), item[tagName].Confidence)
 				}
 			} else {
 				updateDetectedTech(detectedTech, ObjName, item[tagName].Confidence, "*")
+				updateDetectedVersion(detectedTech, ObjName, ruleset.ExpandVersion(nil, item[tagName].Version, tag), item[tagName].Confidence)
 			}
 			updateDetectedType(detectedTech, ObjName, detectionType)
 		}
@@ -493,6 +589,7 @@ func detectTechByMetaTags(responseBody string, signatures *map[string][]ruleset.
 							cmn.DebugMsg(cmn.DbgLvlError, errMatchingSignature, err)
 						} else if matched {
 							updateDetectedTech(detectedTech, ObjName, signature.Confidence, signature.Content)
+							updateDetectedVersion(detectedTech, ObjName, ruleset.ExtractVersion(signature.Content, signature.Version, text), signature.Confidence)
 						}
 					}
 					updateDetectedType(detectedTech, ObjName, detectionType)
@@ -516,23 +613,30 @@ func detectTechnologiesWithPlugins(wd *vdi.WebDriver, re *ruleset.RuleEngine, pl
 				cmn.DebugMsg(cmn.DbgLvlDebug3, "plugin not found: %s", pluginCall.PluginName)
 				continue
 			}
-			// Get the plugin arguments
-			var args []ruleset.PluginParams
-			var jsArgs []interface{}
+			// Get the plugin arguments (in the order of the plugin_args declaration)
+			params := make(map[string]interface{}, len(pluginCall.PluginArgs))
+			order := make([]string, 0, len(pluginCall.PluginArgs))
 			var confidence float32
-			if pluginCall.PluginArgs != nil {
-				args = pluginCall.PluginArgs
+			for i, arg := range pluginCall.PluginArgs {
+				name := strings.TrimSpace(arg.ArgName)
+				if name == "" {
+					name = fmt.Sprintf("arg%d", i)
+				}
+				params[name] = arg.ArgValue
+				order = append(order, name)
 				// Search for an arg called confidence
-				for _, arg := range args {
-					jsArgs = append(jsArgs, arg.ArgValue)
-					if strings.ToLower(strings.TrimSpace(arg.ArgName)) == "confidence" {
-						confidence = cmn.StringToFloat32(strings.TrimSpace(arg.ArgValue.(string)))
-					}
+				if strings.ToLower(name) == "confidence" {
+					confidence = cmn.StringToFloat32(strings.TrimSpace(fmt.Sprint(arg.ArgValue)))
 				}
 			}
 			if confidence == 0 {
 				confidence = 10
 			}
+			jsArgs, err := plugin.VDIArgs(params, order)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "invalid arguments for plugin '%s': %v", pluginCall.PluginName, err)
+				continue
+			}
 			// Run the plugin
 			cmn.DebugMsg(cmn.DbgLvlDebug5, "Executing Plugin: %s", pluginCall.PluginName)
 			result, err := (*wd).ExecuteScript(plugin.String(), jsArgs)
@@ -567,6 +671,12 @@ func detectTechnologiesWithPlugins(wd *vdi.WebDriver, re *ruleset.RuleEngine, pl
 
 			// Add the plugin result as PluginResult
 			updateDetectedTechCustom(detectedTech, ObjName, confidence, pluginCall.PluginName, resultStr)
+			if resultMap, ok := result.(map[string]interface{}); ok {
+				// Plugins can report the version they found
+				if version, ok := resultMap["version"].(string); ok {
+					updateDetectedVersion(detectedTech, ObjName, ruleset.ExpandVersion(nil, version, ""), confidence)
+				}
+			}
 
 		}
 	}
@@ -693,6 +803,7 @@ func detectTechByURL(url string, URLSignatures *map[string][]ruleset.URLMicroSig
 			}
 			if matched {
 				updateDetectedTech(detectedTech, ObjName, signature.Confidence, signature.Signature)
+				updateDetectedVersion(detectedTech, ObjName, ruleset.ExtractVersion(signature.Signature, signature.Version, url), signature.Confidence)
 				updateDetectedType(detectedTech, ObjName, "url")
 			}
 		}
@@ -172,3 +172,40 @@ func TestUpdateDetectedType(t *testing.T) {
 		t.Errorf("Unexpected detected technologies. Got %v, want %v", detectedTech, expectedDetectedTech)
 	}
 }
+
+func TestUpdateDetectedVersion(t *testing.T) {
+	detectedTech := map[string]detectionEntityDetails{
+		"tech1": {confidence: 10, matchedPatterns: []string{"matchedSig1"}},
+	}
+	updateDetectedVersion(&detectedTech, "tech1", "1.2", 10)
+	updateDetectedVersion(&detectedTech, "tech1", "1.2", 5)
+	updateDetectedVersion(&detectedTech, "tech1", "", 5)
+	updateDetectedVersion(&detectedTech, "tech2", "3.0", 5)
+
+	expectedVersions := map[string]float32{"1.2": 15}
+	if !reflect.DeepEqual(detectedTech["tech1"].versions, expectedVersions) {
+		t.Errorf("Unexpected versions. Got %v, want %v", detectedTech["tech1"].versions, expectedVersions)
+	}
+	if _, exists := detectedTech["tech2"]; exists {
+		t.Errorf("updateDetectedVersion() added an entity that wasn't detected")
+	}
+}
+
+func TestResolveVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions map[string]float32
+		expected []string
+	}{
+		{"none", nil, nil},
+		{"single", map[string]float32{"6.4.2": 10}, []string{"6.4.2"}},
+		{"highest confidence", map[string]float32{"6.4.2": 10, "5.9": 3}, []string{"6.4.2", "5.9"}},
+		{"prefix supports", map[string]float32{"6.4.2": 3, "6.4": 5, "5.9": 6}, []string{"6.4.2", "5.9", "6.4"}},
+		{"tie", map[string]float32{"1.9": 5, "1.10": 5}, []string{"1.10", "1.9"}},
+	}
+	for _, tt := range tests {
+		if got := resolveVersions(tt.versions); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("resolveVersions() %s = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
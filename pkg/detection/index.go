@@ -0,0 +1,243 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package detection implements the detection library for the Crowler.
+package detection
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	ruleset "github.com/pzaino/thecrowler/pkg/ruleset"
+)
+
+// The functions in this file match the signatures of the precompiled
+// DetectionIndex. They produce the same detections of their counterparts in
+// detection.go, which match the detection rules one by one.
+
+func detectTechByTagIndex(header *http.Header, tagName string, idx *ruleset.DetectionIndex, detectedTech *map[string]detectionEntityDetails) {
+	const detectionType = "http_header"
+	family, exists := idx.HTTPHeaders[strings.ToLower(strings.TrimSpace(tagName))]
+	if !exists {
+		return
+	}
+	for _, tag := range (*header)[tagName] {
+		tag = strings.ToLower(tag)
+		matches := family.Patterns.Scan(tag)
+		for _, signature := range family.Signatures {
+			switch signature.Value {
+			case "":
+				continue
+			case "!*":
+				// Negative detection (the Signature Key is not in the header)
+				if !strings.Contains(tag, signature.Key) {
+					updateDetectedTech(detectedTech, signature.ObjectName, -signature.Confidence, signature.Key)
+					continue
+				}
+			case "*":
+				updateDetectedTech(detectedTech, signature.ObjectName, signature.Confidence, "*")
+				updateDetectedVersion(detectedTech, signature.ObjectName, ruleset.ExpandVersion(nil, signature.Version, tag), signature.Confidence)
+			default:
+				if matches.Match(signature.Pattern) {
+					updateDetectedTech(detectedTech, signature.ObjectName, signature.Confidence, signature.Value)
+					updateDetectedVersion(detectedTech, signature.ObjectName, matches.Version(signature.Pattern, signature.Version), signature.Confidence)
+				}
+			}
+			updateDetectedType(detectedTech, signature.ObjectName, detectionType)
+		}
+	}
+}
+
+func detectTechByURLIndex(url string, family *ruleset.SignatureFamily, detectedTech *map[string]detectionEntityDetails) {
+	if len(family.Signatures) == 0 {
+		return
+	}
+	matches := family.Patterns.Scan(url)
+	for _, signature := range family.Signatures {
+		if matches.Match(signature.Pattern) {
+			updateDetectedTech(detectedTech, signature.ObjectName, signature.Confidence, signature.Value)
+			updateDetectedVersion(detectedTech, signature.ObjectName, matches.Version(signature.Pattern, signature.Version), signature.Confidence)
+			updateDetectedType(detectedTech, signature.ObjectName, "url")
+		}
+	}
+}
+
+// detectTechByContentIndex matches the meta tags and the page content
+// signatures, parsing the page only once
+func detectTechByContentIndex(responseBody string, idx *ruleset.DetectionIndex, detectedTech *map[string]detectionEntityDetails) {
+	if len(idx.MetaTags) == 0 && len(idx.Selectors) == 0 && len(idx.PageContent.Signatures) == 0 {
+		return
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(responseBody))
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "loading HTML: %s", err)
+		return
+	}
+	detectTechByMetaTagsIndex(doc, idx, detectedTech)
+	detectTechByKeywordIndex(responseBody, doc, idx, detectedTech)
+}
+
+// indexedElement is an HTML element with the (lazily computed) matches of
+// its text and attributes
+type indexedElement struct {
+	sel   *goquery.Selection
+	text  *ruleset.Matches
+	attrs map[string]*ruleset.Matches
+}
+
+// textMatches returns the matches of the element text
+func (e *indexedElement) textMatches(patterns *ruleset.PatternSet) *ruleset.Matches {
+	if e.text == nil {
+		e.text = patterns.Scan(e.sel.Text())
+	}
+	return e.text
+}
+
+// attrMatches returns the matches of an element attribute (nil if the
+// element doesn't have it)
+func (e *indexedElement) attrMatches(patterns *ruleset.PatternSet, attr string) *ruleset.Matches {
+	if matches, exists := e.attrs[attr]; exists {
+		return matches
+	}
+	var matches *ruleset.Matches
+	if value, exists := e.sel.Attr(attr); exists {
+		matches = patterns.Scan(value)
+	}
+	if e.attrs == nil {
+		e.attrs = make(map[string]*ruleset.Matches)
+	}
+	e.attrs[attr] = matches
+	return matches
+}
+
+func detectTechByMetaTagsIndex(doc *goquery.Document, idx *ruleset.DetectionIndex, detectedTech *map[string]detectionEntityDetails) {
+	const detectionType = "meta_tags"
+	if len(idx.MetaTags) == 0 {
+		return
+	}
+
+	// Group the meta tags of the page by name
+	metaTags := make(map[string][]*indexedElement)
+	doc.Find("meta").Each(func(_ int, htmlItem *goquery.Selection) {
+		name := strings.ToLower(htmlItem.AttrOr("name", ""))
+		if _, exists := idx.MetaTags[name]; exists {
+			metaTags[name] = append(metaTags[name], &indexedElement{sel: htmlItem})
+		}
+	})
+
+	for name, elements := range metaTags {
+		family := idx.MetaTags[name]
+		for _, signature := range family.Signatures {
+			for _, element := range elements {
+				if _, contExists := element.sel.Attr("content"); contExists && signature.Value != "" {
+					if element.text == nil {
+						element.text = family.Patterns.Scan(strings.ToLower(element.sel.AttrOr("content", "")))
+					}
+					if element.text.Match(signature.Pattern) {
+						updateDetectedTech(detectedTech, signature.ObjectName, signature.Confidence, signature.Value)
+						updateDetectedVersion(detectedTech, signature.ObjectName, element.text.Version(signature.Pattern, signature.Version), signature.Confidence)
+					}
+				}
+				updateDetectedType(detectedTech, signature.ObjectName, detectionType)
+			}
+		}
+	}
+}
+
+func detectTechByKeywordIndex(responseBody string, doc *goquery.Document, idx *ruleset.DetectionIndex, detectedTech *map[string]detectionEntityDetails) {
+	const detectionType = "html"
+
+	// Signatures matched against the whole page
+	if len(idx.PageContent.Signatures) > 0 {
+		matches := idx.PageContent.Patterns.Scan(responseBody)
+		for _, signature := range idx.PageContent.Signatures {
+			updateDetectedTechByIndex(detectedTech, signature, matches)
+			updateDetectedType(detectedTech, signature.ObjectName, detectionType)
+		}
+	}
+
+	// Signatures matched against the selected elements
+	for selector, family := range idx.Selectors {
+		if len(family.Signatures) == 0 {
+			continue
+		}
+		var elements []*indexedElement
+		doc.Find(selector).Each(func(_ int, htmlItem *goquery.Selection) {
+			elements = append(elements, &indexedElement{sel: htmlItem})
+		})
+		for _, signature := range family.Signatures {
+			for _, element := range elements {
+				var matches *ruleset.Matches
+				if signature.Attribute != "" {
+					matches = element.attrMatches(family.Patterns, signature.Attribute)
+				} else {
+					matches = element.textMatches(family.Patterns)
+				}
+				if matches == nil {
+					continue
+				}
+				updateDetectedTechByIndex(detectedTech, signature, matches)
+				updateDetectedType(detectedTech, signature.ObjectName, detectionType)
+			}
+		}
+	}
+}
+
+// updateDetectedTechByIndex updates the detected technologies with a page
+// content signature ("*" matches everything)
+func updateDetectedTechByIndex(detectedTech *map[string]detectionEntityDetails, signature ruleset.IndexedSignature, matches *ruleset.Matches) {
+	switch {
+	case signature.Value == "":
+		return
+	case signature.Value == "*":
+		updateDetectedTech(detectedTech, signature.ObjectName, signature.Confidence, "*")
+		updateDetectedVersion(detectedTech, signature.ObjectName, ruleset.ExpandVersion(nil, signature.Version, ""), signature.Confidence)
+	case matches.Match(signature.Pattern):
+		updateDetectedTech(detectedTech, signature.ObjectName, signature.Confidence, signature.Value)
+		updateDetectedVersion(detectedTech, signature.ObjectName, matches.Version(signature.Pattern, signature.Version), signature.Confidence)
+	}
+}
+
+func detectTechBySSLIndex(certChain []*x509.Certificate, family *ruleset.SignatureFamily, detectedTech *map[string]detectionEntityDetails) {
+	const detectionType = "ssl_certificate"
+	if len(family.Signatures) == 0 {
+		return
+	}
+
+	// The matches of each certificate field, computed once
+	type certField struct {
+		cert *x509.Certificate
+		key  string
+	}
+	fields := make(map[certField]*ruleset.Matches)
+	for _, signature := range family.Signatures {
+		for _, cert := range certChain {
+			matches, exists := fields[certField{cert, signature.Key}]
+			if !exists {
+				if value, err := getCertificateField(cert, signature.Key); err == nil {
+					matches = family.Patterns.Scan(value)
+				}
+				fields[certField{cert, signature.Key}] = matches
+			}
+			if matches != nil && matches.Match(signature.Pattern) {
+				updateDetectedTech(detectedTech, signature.ObjectName, signature.Confidence, signature.Value)
+				updateDetectedVersion(detectedTech, signature.ObjectName, matches.Version(signature.Pattern, signature.Version), signature.Confidence)
+				updateDetectedType(detectedTech, signature.ObjectName, detectionType)
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package detection implements the detection library for the Crowler.
+package detection
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	ruleset "github.com/pzaino/thecrowler/pkg/ruleset"
+)
+
+const testPage = `<html><head>
+<meta name="generator" content="WordPress 6.4.2">
+<meta name="author" content="John">
+<script src="/wp-includes/js/jquery/jquery.min.js?ver=3.7.1"></script>
+</head><body><h1>Hello</h1><div class="footer">Powered by WordPress</div></body></html>`
+
+func testDetectionRules() []ruleset.DetectionRule {
+	return []ruleset.DetectionRule{
+		{
+			ObjectName: "WordPress",
+			HTTPHeaderFields: []ruleset.HTTPHeaderField{
+				{Key: "Link", Value: []string{"wp-json"}, Confidence: 5},
+			},
+			MetaTags: []ruleset.MetaTag{
+				{Name: "generator", Content: "wordpress ?([0-9.]+)?", Version: "$1", Confidence: 10},
+			},
+			PageContentPatterns: []ruleset.PageContentSignature{
+				{Key: "*", Signature: []string{"/wp-content/", "/wp-includes/"}, Confidence: 4},
+				{Key: "script", Attribute: "src", Signature: []string{"wp-(includes|content)"}, Confidence: 3},
+				{Key: "div", Text: []string{"powered by wordpress"}, Confidence: 2},
+			},
+			URLMicroSignatures: []ruleset.URLMicroSignature{{Signature: "/wp-admin", Confidence: 10}},
+			Implies:            []string{"php"},
+		},
+		{
+			ObjectName: "nginx",
+			HTTPHeaderFields: []ruleset.HTTPHeaderField{
+				{Key: "Server", Value: []string{"^nginx(/([0-9.]+))?"}, Version: "$2", Confidence: 10},
+			},
+		},
+		{
+			ObjectName: "jQuery",
+			PageContentPatterns: []ruleset.PageContentSignature{
+				{Key: "script", Attribute: "src", Signature: []string{"jquery(\\.min)?\\.js"}, Confidence: 10},
+				{Key: "script", Attribute: "src", Signature: []string{"jquery(\\.min)?\\.js\\?ver=([0-9.]+)"}, Version: "$2", Confidence: 5},
+			},
+		},
+		{
+			ObjectName: "CSP",
+			HTTPHeaderFields: []ruleset.HTTPHeaderField{
+				{Key: "Server", Value: []string{"!*"}, Confidence: 10},
+			},
+		},
+		{
+			ObjectName: "Drupal",
+			MetaTags:   []ruleset.MetaTag{{Name: "generator", Content: "drupal", Confidence: 10}},
+			PageContentPatterns: []ruleset.PageContentSignature{
+				{Key: "*", Signature: []string{"drupal.settings", "(invalid"}, Confidence: 10},
+			},
+		},
+	}
+}
+
+// sortedEntities returns the detected entities with sorted matched patterns
+func sortedEntities(entities *map[string]DetectedEntity) map[string]DetectedEntity {
+	sorted := make(map[string]DetectedEntity)
+	if entities == nil {
+		return sorted
+	}
+	for k, v := range *entities {
+		v.MatchedPatterns = append([]string(nil), v.MatchedPatterns...)
+		sort.Strings(v.MatchedPatterns)
+		sorted[k] = v
+	}
+	return sorted
+}
+
+// sortedTypes returns the entity types of an entity in alphabetical order
+func sortedTypes(entityType string) string {
+	types := strings.Split(entityType, ",")
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
+
+func TestDetectTechnologiesIndex(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	re := ruleset.NewRuleEngine("", []ruleset.Ruleset{
+		{
+			Name: "test",
+			RuleGroups: []ruleset.RuleGroup{
+				{GroupName: "detection", IsEnabled: true, DetectionRules: testDetectionRules()},
+			},
+		},
+	})
+
+	header := http.Header{}
+	header.Set("Server", "nginx/1.24.0")
+	header.Set("Link", "<https://example.com/wp-json/>; rel=\"https://api.w.org/\"")
+	body := testPage
+
+	newContext := func(noIndex bool) *DContext {
+		return &DContext{
+			CtxID:        "test",
+			TargetURL:    "https://example.com/wp-admin/index.php",
+			Header:       &header,
+			ResponseBody: &body,
+			RE:           re,
+			NoIndex:      noIndex,
+		}
+	}
+
+	expected := sortedEntities(DetectTechnologies(newContext(true)))
+	got := sortedEntities(DetectTechnologies(newContext(false)))
+	if len(expected) == 0 {
+		t.Fatalf("no technologies detected")
+	}
+	for _, name := range []string{"wordpress", "nginx", "jquery"} {
+		if _, exists := got[name]; !exists {
+			t.Errorf("%s not detected with the index", name)
+		}
+	}
+	for name, version := range map[string]string{"wordpress": "6.4.2", "nginx": "1.24.0", "jquery": "3.7.1"} {
+		if got[name].Version != version {
+			t.Errorf("%s version = %q, expected %q", name, got[name].Version, version)
+		}
+	}
+	if len(got) != len(expected) {
+		t.Errorf("detected %d entities with the index, expected %d: %v", len(got), len(expected), got)
+	}
+	for name, e := range expected {
+		g, exists := got[name]
+		if !exists {
+			t.Errorf("%s detected without the index but not with it", name)
+			continue
+		}
+		if math.Abs(float64(g.Confidence-e.Confidence)) > 0.001 {
+			t.Errorf("%s confidence = %f, expected %f", name, g.Confidence, e.Confidence)
+		}
+		if sortedTypes(g.EntityType) != sortedTypes(e.EntityType) {
+			t.Errorf("%s entity type = %q, expected %q", name, g.EntityType, e.EntityType)
+		}
+		if g.Version != e.Version {
+			t.Errorf("%s version = %q, expected %q", name, g.Version, e.Version)
+		}
+		if len(g.MatchedPatterns) != len(e.MatchedPatterns) {
+			t.Errorf("%s matched patterns = %v, expected %v", name, g.MatchedPatterns, e.MatchedPatterns)
+			continue
+		}
+		for i := range e.MatchedPatterns {
+			if g.MatchedPatterns[i] != e.MatchedPatterns[i] {
+				t.Errorf("%s matched patterns = %v, expected %v", name, g.MatchedPatterns, e.MatchedPatterns)
+				break
+			}
+		}
+	}
+}
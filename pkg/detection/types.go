@@ -36,6 +36,7 @@ type DContext struct {
 	ResponseBody *string             `json:"response_body"` // (optional) the body of the HTTP response
 	RE           *ruleset.RuleEngine // (required) the RuleEngine to use for the detection process
 	Config       *cfg.Config         // (required) the configuration to use for the detection process
+	NoIndex      bool                // (optional) match the detection rules one by one instead of using the precompiled index (slower)
 }
 
 // DetectedEntity is a struct to store the detected entity (technology, asset, etc.)
@@ -45,6 +46,8 @@ type DetectedEntity struct {
 	Confidence      float32                `json:"confidence"`
 	MatchedPatterns []string               `json:"matched_patterns"`
 	PluginResult    map[string]interface{} `json:"plugin_result"`
+	Version         string                 `json:"version,omitempty"`  // Most likely version (when the signatures extract it)
+	Versions        []string               `json:"versions,omitempty"` // All the versions found, the most likely first
 }
 
 // SSLInfo contains information about the SSL certificate detected on a website
@@ -0,0 +1,490 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package har implements the HAR 1.2 (HTTP Archive) format and a builder
+// that creates HAR documents from the Chrome DevTools Protocol network events.
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewBuilder returns a new (empty) HAR builder
+func NewBuilder() *Builder {
+	return &Builder{
+		Creator: Creator{Name: "TheCROWler", Version: "1.0"},
+		entries: make(map[string]*pending),
+	}
+}
+
+// AddLogMessage adds a Chrome performance log message (the JSON document
+// returned by the browser "performance" log) to the builder. Messages that
+// are not network or page events are ignored.
+func (b *Builder) AddLogMessage(message string) error {
+	var entry struct {
+		Message struct {
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(message), &entry); err != nil {
+		return err
+	}
+	b.AddEvent(entry.Message.Method, entry.Message.Params)
+	return nil
+}
+
+// AddEvent adds a CDP event (Network.* and Page.* events are used) to the builder
+func (b *Builder) AddEvent(method string, params map[string]interface{}) {
+	if params == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	requestID := getString(params, "requestId")
+	switch method {
+	case "Network.requestWillBeSent":
+		request := getMap(params, "request")
+		if request == nil || !isHTTP(getString(request, "url")) {
+			return
+		}
+		if prev, ok := b.entries[requestID]; ok {
+			// A redirect reuses the request ID of the original request
+			if redirect := getMap(params, "redirectResponse"); redirect != nil {
+				prev.response = redirect
+				prev.end = getFloat(params, "timestamp")
+				prev.finished = true
+			}
+			b.done = append(b.done, prev)
+		}
+		p := &pending{
+			seq:          b.order,
+			requestID:    requestID,
+			wallTime:     getFloat(params, "wallTime"),
+			start:        getFloat(params, "timestamp"),
+			resourceType: getString(params, "type"),
+			request:      request,
+		}
+		b.order++
+		if b.firstStart == 0 || p.start < b.firstStart {
+			b.firstStart = p.start
+			b.firstWallTime = p.wallTime
+		}
+		b.entries[requestID] = p
+	case "Network.requestWillBeSentExtraInfo":
+		if p, ok := b.entries[requestID]; ok {
+			p.requestHeaders = getMap(params, "headers")
+		}
+	case "Network.responseReceived":
+		if p, ok := b.entries[requestID]; ok {
+			p.response = getMap(params, "response")
+			if p.resourceType == "" {
+				p.resourceType = getString(params, "type")
+			}
+		}
+	case "Network.responseReceivedExtraInfo":
+		if p, ok := b.entries[requestID]; ok {
+			p.respHeaders = getMap(params, "headers")
+		}
+	case "Network.loadingFinished":
+		if p, ok := b.entries[requestID]; ok {
+			p.end = getFloat(params, "timestamp")
+			p.transferSize = getFloat(params, "encodedDataLength")
+			p.finished = true
+		}
+	case "Network.loadingFailed":
+		if p, ok := b.entries[requestID]; ok {
+			p.end = getFloat(params, "timestamp")
+			p.errorText = getString(params, "errorText")
+			p.finished = true
+		}
+	case "Page.domContentEventFired":
+		if b.contentLoaded == 0 {
+			b.contentLoaded = getFloat(params, "timestamp")
+		}
+	case "Page.loadEventFired":
+		if b.loaded == 0 {
+			b.loaded = getFloat(params, "timestamp")
+		}
+	}
+}
+
+// Len returns the number of entries collected so far
+func (b *Builder) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.entries) + len(b.done)
+}
+
+// PendingBodies returns the request IDs of the completed responses whose
+// body has not been set yet (and is not bigger than MaxBodySize)
+func (b *Builder) PendingBodies() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ids := make([]string, 0, len(b.entries))
+	for id, p := range b.entries {
+		if !p.finished || p.errorText != "" || p.response == nil || p.bodySet || p.transferSize > MaxBodySize {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SetResponseBody sets the body of the response of a request
+func (b *Builder) SetResponseBody(requestID, body string, base64Encoded bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	p, ok := b.entries[requestID]
+	if !ok {
+		return
+	}
+	p.bodySet = true
+	if len(body) > MaxBodySize {
+		p.bodyComment = fmt.Sprintf("body omitted (bigger than %d bytes)", MaxBodySize)
+		return
+	}
+	p.body = body
+	p.bodyBase64 = base64Encoded
+}
+
+// Build returns the HAR document of the collected page
+func (b *Builder) Build(title string) *HAR {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	all := make([]*pending, 0, len(b.entries)+len(b.done))
+	all = append(all, b.done...)
+	for _, p := range b.entries {
+		all = append(all, p)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].seq < all[j].seq
+	})
+
+	doc := &HAR{Log: Log{
+		Version: Version,
+		Creator: b.Creator,
+		Entries: make([]Entry, 0, len(all)),
+	}}
+	for _, p := range all {
+		doc.Log.Entries = append(doc.Log.Entries, p.entry())
+	}
+
+	if len(all) > 0 {
+		doc.Log.Pages = []Page{{
+			StartedDateTime: formatTime(b.firstWallTime),
+			ID:              DefaultPageID,
+			Title:           title,
+			PageTimings: PageTimings{
+				OnContentLoad: b.sinceStart(b.contentLoaded),
+				OnLoad:        b.sinceStart(b.loaded),
+			},
+		}}
+	}
+	return doc
+}
+
+// sinceStart returns the milliseconds elapsed between the first request and
+// the monotonic timestamp ts (-1 if ts is not set)
+func (b *Builder) sinceStart(ts float64) float64 {
+	if ts == 0 || b.firstStart == 0 || ts < b.firstStart {
+		return -1
+	}
+	return round((ts - b.firstStart) * 1000)
+}
+
+// entry converts a pending entry to a HAR entry
+func (p *pending) entry() Entry {
+	protocol := getString(p.response, "protocol")
+	e := Entry{
+		PageRef:         DefaultPageID,
+		StartedDateTime: formatTime(p.wallTime),
+		Request:         p.harRequest(httpVersion(protocol)),
+		Response:        p.harResponse(httpVersion(protocol)),
+		ServerIPAddress: strings.Trim(getString(p.response, "remoteIPAddress"), "[]"),
+		ResourceType:    strings.ToLower(p.resourceType),
+		TransferSize:    p.transferSize,
+		SecurityDetails: getMap(p.response, "securityDetails"),
+		Error:           p.errorText,
+	}
+	if id := getFloat(p.response, "connectionId"); id > 0 {
+		e.Connection = fmt.Sprint(int64(id))
+	}
+	e.Timings = p.timings()
+	for _, t := range []float64{e.Timings.Blocked, e.Timings.DNS, e.Timings.Connect, e.Timings.Send, e.Timings.Wait, e.Timings.Receive} {
+		if t > 0 {
+			e.Time += t
+		}
+	}
+	e.Time = round(e.Time)
+	return e
+}
+
+// harRequest returns the HAR request of a pending entry
+func (p *pending) harRequest(version string) Request {
+	headers := p.requestHeaders
+	if headers == nil {
+		headers = getMap(p.request, "headers")
+	}
+	reqURL := getString(p.request, "url")
+	r := Request{
+		Method:      getString(p.request, "method"),
+		URL:         reqURL,
+		HTTPVersion: version,
+		Headers:     toNameValues(headers),
+		QueryString: []NameValue{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	if u, err := url.Parse(reqURL); err == nil {
+		query := u.Query()
+		names := make([]string, 0, len(query))
+		for name := range query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, value := range query[name] {
+				r.QueryString = append(r.QueryString, NameValue{Name: name, Value: value})
+			}
+		}
+	}
+	r.Cookies = toCookies((&http.Request{Header: toHTTPHeader(headers)}).Cookies())
+	if postData := getString(p.request, "postData"); postData != "" {
+		r.PostData = &PostData{
+			MimeType: toHTTPHeader(headers).Get("Content-Type"),
+			Text:     postData,
+		}
+		r.BodySize = len(postData)
+	}
+	return r
+}
+
+// harResponse returns the HAR response of a pending entry
+func (p *pending) harResponse(version string) Response {
+	r := Response{
+		HTTPVersion: version,
+		Cookies:     []Cookie{},
+		Headers:     []NameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if p.response == nil {
+		r.Content.MimeType = "x-unknown"
+		return r
+	}
+
+	headers := p.respHeaders
+	if headers == nil {
+		headers = getMap(p.response, "headers")
+	}
+	httpHeaders := toHTTPHeader(headers)
+	r.Status = int(getFloat(p.response, "status"))
+	r.StatusText = getString(p.response, "statusText")
+	r.Headers = toNameValues(headers)
+	r.Cookies = toCookies((&http.Response{Header: httpHeaders}).Cookies())
+	r.RedirectURL = httpHeaders.Get("Location")
+	r.Content = Content{
+		Size:     0,
+		MimeType: getString(p.response, "mimeType"),
+		Comment:  p.bodyComment,
+	}
+	if r.Content.MimeType == "" {
+		r.Content.MimeType = "x-unknown"
+	}
+	if p.bodySet && p.bodyComment == "" {
+		r.Content.Text = p.body
+		r.Content.Size = len(p.body)
+		if p.bodyBase64 {
+			r.Content.Encoding = "base64"
+			r.Content.Size = base64.StdEncoding.DecodedLen(len(p.body))
+			if decoded, err := base64.StdEncoding.DecodeString(p.body); err == nil {
+				r.Content.Size = len(decoded)
+			}
+		}
+	}
+	return r
+}
+
+// timings returns the HAR timings of a pending entry, computed from the CDP
+// ResourceTiming (offsets in milliseconds from timing.requestTime)
+func (p *pending) timings() Timings {
+	t := Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Send: 0, Wait: 0, Receive: 0}
+	timing := getMap(p.response, "timing")
+	if timing == nil {
+		if p.end > p.start && p.start > 0 {
+			t.Receive = round((p.end - p.start) * 1000)
+		}
+		return t
+	}
+
+	requestTime := getFloat(timing, "requestTime")
+	dnsStart, dnsEnd := getTiming(timing, "dnsStart"), getTiming(timing, "dnsEnd")
+	connectStart, connectEnd := getTiming(timing, "connectStart"), getTiming(timing, "connectEnd")
+	sslStart, sslEnd := getTiming(timing, "sslStart"), getTiming(timing, "sslEnd")
+	sendStart, sendEnd := math.Max(getTiming(timing, "sendStart"), 0), math.Max(getTiming(timing, "sendEnd"), 0)
+	headersEnd := math.Max(getTiming(timing, "receiveHeadersEnd"), 0)
+
+	// Time spent in the queue before the request was started
+	blocked := sendStart
+	for _, v := range []float64{connectStart, dnsStart} {
+		if v >= 0 {
+			blocked = v
+		}
+	}
+	if p.start > 0 && requestTime > p.start {
+		blocked += (requestTime - p.start) * 1000
+	}
+	t.Blocked = round(math.Max(blocked, 0))
+	if dnsStart >= 0 && dnsEnd >= dnsStart {
+		t.DNS = round(dnsEnd - dnsStart)
+	}
+	if connectStart >= 0 && connectEnd >= connectStart {
+		t.Connect = round(connectEnd - connectStart)
+	}
+	if sslStart >= 0 && sslEnd >= sslStart {
+		t.SSL = round(sslEnd - sslStart)
+	}
+	t.Send = round(math.Max(sendEnd-sendStart, 0))
+	t.Wait = round(math.Max(headersEnd-sendEnd, 0))
+	if p.end > 0 && requestTime > 0 {
+		t.Receive = round(math.Max((p.end-requestTime)*1000-headersEnd, 0))
+	}
+	return t
+}
+
+// httpVersion converts a CDP protocol name to a HAR HTTP version
+func httpVersion(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "":
+		return "HTTP/1.1"
+	case "h2":
+		return "HTTP/2.0"
+	case "h3", "h3-29", "quic":
+		return "HTTP/3.0"
+	default:
+		return strings.ToUpper(protocol)
+	}
+}
+
+// toHTTPHeader converts CDP headers to http.Header (CDP joins multiple values with new lines)
+func toHTTPHeader(headers map[string]interface{}) http.Header {
+	h := http.Header{}
+	for name, value := range headers {
+		for _, v := range strings.Split(fmt.Sprint(value), "\n") {
+			h.Add(name, v)
+		}
+	}
+	return h
+}
+
+// toNameValues converts CDP headers to sorted HAR headers
+func toNameValues(headers map[string]interface{}) []NameValue {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]NameValue, 0, len(headers))
+	for _, name := range names {
+		for _, v := range strings.Split(fmt.Sprint(headers[name]), "\n") {
+			values = append(values, NameValue{Name: name, Value: v})
+		}
+	}
+	return values
+}
+
+// toCookies converts HTTP cookies to HAR cookies
+func toCookies(cookies []*http.Cookie) []Cookie {
+	result := make([]Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		hc := Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			hc.Expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		result = append(result, hc)
+	}
+	return result
+}
+
+// formatTime converts a CDP wall time (seconds since epoch) to ISO 8601
+func formatTime(wallTime float64) string {
+	if wallTime <= 0 {
+		return time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	}
+	sec, frac := math.Modf(wallTime)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// round rounds a time in milliseconds to 3 decimals
+func round(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
+
+func isHTTP(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")
+}
+
+func getMap(m map[string]interface{}, key string) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func getString(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	v, _ := m[key].(string)
+	return v
+}
+
+func getFloat(m map[string]interface{}, key string) float64 {
+	if m == nil {
+		return 0
+	}
+	v, _ := m[key].(float64)
+	return v
+}
+
+// getTiming returns a CDP ResourceTiming value (-1 if it's not available)
+func getTiming(timing map[string]interface{}, key string) float64 {
+	v, ok := timing[key].(float64)
+	if !ok {
+		return -1
+	}
+	return v
+}
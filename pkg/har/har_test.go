@@ -0,0 +1,148 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package har
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// testEvents is a redirect followed by a page load, as logged by Chrome
+var testEvents = []string{
+	`{"message":{"method":"Network.requestWillBeSent","params":{"requestId":"1","type":"Document","timestamp":100.0,"wallTime":1700000000.5,"request":{"url":"http://example.com/?a=1","method":"GET","headers":{"User-Agent":"CROWler"}}}}}`,
+	`{"message":{"method":"Network.requestWillBeSent","params":{"requestId":"1","type":"Document","timestamp":100.1,"wallTime":1700000000.6,"request":{"url":"https://example.com/","method":"GET","headers":{"User-Agent":"CROWler"}},"redirectResponse":{"url":"http://example.com/?a=1","status":301,"statusText":"Moved Permanently","headers":{"Location":"https://example.com/"},"protocol":"http/1.1","mimeType":""}}}}`,
+	`{"message":{"method":"Network.requestWillBeSentExtraInfo","params":{"requestId":"1","headers":{"User-Agent":"CROWler","Cookie":"sid=abc"}}}}`,
+	`{"message":{"method":"Network.responseReceived","params":{"requestId":"1","type":"Document","timestamp":100.3,"response":{"url":"https://example.com/","status":200,"statusText":"OK","headers":{"Content-Type":"text/html","Set-Cookie":"a=1; Path=/\nb=2; HttpOnly"},"mimeType":"text/html","protocol":"h2","remoteIPAddress":"[2001:db8::1]","connectionId":7,"securityDetails":{"protocol":"TLS 1.3"},"timing":{"requestTime":100.1,"dnsStart":1,"dnsEnd":11,"connectStart":11,"connectEnd":51,"sslStart":21,"sslEnd":51,"sendStart":52,"sendEnd":53,"receiveHeadersEnd":153}}}}}`,
+	`{"message":{"method":"Network.loadingFinished","params":{"requestId":"1","timestamp":100.4,"encodedDataLength":1234}}}`,
+	`{"message":{"method":"Network.requestWillBeSent","params":{"requestId":"2","type":"XHR","timestamp":100.5,"wallTime":1700000001,"request":{"url":"https://example.com/api","method":"POST","headers":{"Content-Type":"application/json"},"postData":"{\"q\":1}"}}}}`,
+	`{"message":{"method":"Network.loadingFailed","params":{"requestId":"2","timestamp":100.6,"errorText":"net::ERR_FAILED"}}}`,
+	`{"message":{"method":"Network.requestWillBeSent","params":{"requestId":"3","timestamp":100.5,"request":{"url":"data:image/png;base64,AAAA","method":"GET"}}}}`,
+	`{"message":{"method":"Page.domContentEventFired","params":{"timestamp":100.9}}}`,
+	`{"message":{"method":"Page.loadEventFired","params":{"timestamp":101.0}}}`,
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder()
+	for _, event := range testEvents {
+		if err := b.AddLogMessage(event); err != nil {
+			t.Fatalf("AddLogMessage() returned an error: %v", err)
+		}
+	}
+	if err := b.AddLogMessage("not json"); err == nil {
+		t.Errorf("expected an error for an invalid log message")
+	}
+	if b.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3 (data: URLs are ignored)", b.Len())
+	}
+
+	pending := b.PendingBodies()
+	if len(pending) != 1 || pending[0] != "1" {
+		t.Fatalf("PendingBodies() = %v, want [1]", pending)
+	}
+	b.SetResponseBody("1", "PGh0bWw+PC9odG1sPg==", true)
+	if len(b.PendingBodies()) != 0 {
+		t.Errorf("expected no pending bodies after SetResponseBody()")
+	}
+
+	doc := b.Build("Example")
+	entries := doc.Log.Entries
+	if doc.Log.Version != Version || len(entries) != 3 || len(doc.Log.Pages) != 1 {
+		t.Fatalf("unexpected HAR: version %s, %d entries, %d pages", doc.Log.Version, len(entries), len(doc.Log.Pages))
+	}
+
+	redirect := entries[0]
+	if redirect.Response.Status != 301 || redirect.Response.RedirectURL != "https://example.com/" {
+		t.Errorf("unexpected redirect response: %+v", redirect.Response)
+	}
+	if len(redirect.Request.QueryString) != 1 || redirect.Request.QueryString[0].Value != "1" {
+		t.Errorf("unexpected query string: %+v", redirect.Request.QueryString)
+	}
+
+	page := entries[1]
+	if page.Response.HTTPVersion != "HTTP/2.0" || page.ServerIPAddress != "2001:db8::1" || page.Connection != "7" {
+		t.Errorf("unexpected page entry: %+v", page)
+	}
+	if page.Response.Content.Text != "PGh0bWw+PC9odG1sPg==" || page.Response.Content.Encoding != "base64" || page.Response.Content.Size != 13 {
+		t.Errorf("unexpected page content: %+v", page.Response.Content)
+	}
+	if len(page.Request.Cookies) != 1 || len(page.Response.Cookies) != 2 || !page.Response.Cookies[1].HTTPOnly {
+		t.Errorf("unexpected cookies: %+v %+v", page.Request.Cookies, page.Response.Cookies)
+	}
+	want := Timings{Blocked: 1, DNS: 10, Connect: 40, SSL: 30, Send: 1, Wait: 100, Receive: 147}
+	if page.Timings != want {
+		t.Errorf("Timings = %+v, want %+v", page.Timings, want)
+	}
+	if page.Time != 299 {
+		t.Errorf("Time = %f, want 299", page.Time)
+	}
+	if page.SecurityDetails["protocol"] != "TLS 1.3" || page.TransferSize != 1234 {
+		t.Errorf("unexpected security details or transfer size: %+v %f", page.SecurityDetails, page.TransferSize)
+	}
+
+	failed := entries[2]
+	if failed.Error != "net::ERR_FAILED" || failed.Request.PostData == nil || failed.Request.PostData.MimeType != "application/json" {
+		t.Errorf("unexpected failed entry: %+v", failed)
+	}
+
+	timings := doc.Log.Pages[0].PageTimings
+	if timings.OnContentLoad != 900 || timings.OnLoad != 1000 {
+		t.Errorf("unexpected page timings: %+v", timings)
+	}
+	if doc.Log.Pages[0].StartedDateTime != "2023-11-14T22:13:20.500Z" {
+		t.Errorf("unexpected page start: %s", doc.Log.Pages[0].StartedDateTime)
+	}
+
+	// The document must be valid JSON with the HAR required fields
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned an error: %v", err)
+	}
+	var generic map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		t.Fatalf("json.Unmarshal() returned an error: %v", err)
+	}
+	for _, field := range []string{"version", "creator", "pages", "entries"} {
+		if _, ok := generic["log"][field]; !ok {
+			t.Errorf("HAR log is missing the %s field", field)
+		}
+	}
+}
+
+func TestSetResponseBodyTooBig(t *testing.T) {
+	b := NewBuilder()
+	b.AddEvent("Network.requestWillBeSent", map[string]interface{}{
+		"requestId": "1",
+		"request":   map[string]interface{}{"url": "https://example.com/big", "method": "GET"},
+	})
+	b.AddEvent("Network.responseReceived", map[string]interface{}{
+		"requestId": "1",
+		"response":  map[string]interface{}{"status": float64(200), "mimeType": "text/plain"},
+	})
+	b.AddEvent("Network.requestWillBeSent", map[string]interface{}{
+		"requestId": "2",
+		"request":   map[string]interface{}{"url": "https://example.com/pending", "method": "GET"},
+	})
+	b.SetResponseBody("1", string(make([]byte, MaxBodySize+1)), false)
+	b.SetResponseBody("unknown", "body", false)
+
+	doc := b.Build("")
+	content := doc.Log.Entries[0].Response.Content
+	if content.Text != "" || content.Comment == "" {
+		t.Errorf("expected the body to be omitted, got %+v", content)
+	}
+	if doc.Log.Entries[1].Response.Status != 0 || doc.Log.Entries[1].Response.Content.MimeType != "x-unknown" {
+		t.Errorf("unexpected response of a request without response: %+v", doc.Log.Entries[1].Response)
+	}
+}
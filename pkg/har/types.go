@@ -0,0 +1,191 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package har implements the HAR 1.2 (HTTP Archive) format and a builder
+// that creates HAR documents from the Chrome DevTools Protocol network events.
+package har
+
+import (
+	"sync"
+)
+
+const (
+	// Version is the HAR format version
+	Version = "1.2"
+	// ContentType is the MIME type of a HAR document
+	ContentType = "application/har+json"
+	// MaxBodySize is the maximum size of a response body stored in a HAR entry
+	MaxBodySize = 1024 * 1024
+	// DefaultPageID is the ID of the (single) page of a HAR created by the Builder
+	DefaultPageID = "page_1"
+)
+
+// HAR represents a HAR document
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log represents the root object of a HAR document
+type Log struct {
+	Version string  `json:"version"`           // Version of the HAR format
+	Creator Creator `json:"creator"`           // The application that created the log
+	Pages   []Page  `json:"pages,omitempty"`   // The pages in the log
+	Entries []Entry `json:"entries"`           // The requests made by the pages
+	Comment string  `json:"comment,omitempty"` // A comment provided by the user or the application
+}
+
+// Creator represents the application that created a HAR document
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Page represents a page of a HAR document
+type Page struct {
+	StartedDateTime string      `json:"startedDateTime"` // When the page load started (ISO 8601)
+	ID              string      `json:"id"`              // Unique identifier of the page
+	Title           string      `json:"title"`           // Title of the page
+	PageTimings     PageTimings `json:"pageTimings"`     // Timings of the page load
+}
+
+// PageTimings represents the timings of a page load (in milliseconds, -1 if not available)
+type PageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"` // When the page content was loaded (DOMContentLoaded)
+	OnLoad        float64 `json:"onLoad"`        // When the page was loaded (load event)
+}
+
+// Entry represents a single HTTP request of a HAR document
+type Entry struct {
+	PageRef         string   `json:"pageref,omitempty"`         // The page the request belongs to
+	StartedDateTime string   `json:"startedDateTime"`           // When the request started (ISO 8601)
+	Time            float64  `json:"time"`                      // Total time of the request (in milliseconds)
+	Request         Request  `json:"request"`                   // The request
+	Response        Response `json:"response"`                  // The response
+	Cache           Cache    `json:"cache"`                     // Cache usage information
+	Timings         Timings  `json:"timings"`                   // Timings of the request
+	ServerIPAddress string   `json:"serverIPAddress,omitempty"` // IP address of the server
+	Connection      string   `json:"connection,omitempty"`      // ID of the TCP/IP connection
+	ResourceType    string   `json:"_resourceType,omitempty"`   // Type of the resource (Chrome extension)
+	TransferSize    float64  `json:"_transferSize,omitempty"`   // Bytes received over the network (Chrome extension)
+	// SecurityDetails are the TLS details of the connection (Chrome extension)
+	SecurityDetails map[string]interface{} `json:"_securityDetails,omitempty"`
+	Error           string                 `json:"_error,omitempty"` // Error of a failed request (Chrome extension)
+}
+
+// Request represents the request of a HAR entry
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// Response represents the response of a HAR entry
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// NameValue represents a header or a query string parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie represents a cookie sent or received
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// PostData represents the body of a request
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// Content represents the body of a response
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Cache represents the cache usage of a request (not collected)
+type Cache struct{}
+
+// Timings represents the timings of a request (in milliseconds, -1 if not applicable)
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// Builder collects the CDP network events of a page and builds its HAR.
+// It's safe for concurrent use.
+type Builder struct {
+	mutex         sync.Mutex
+	Creator       Creator             // The creator written in the HAR log
+	entries       map[string]*pending // Entries in progress (by CDP request ID)
+	done          []*pending          // Entries completed by a redirect
+	order         int                 // Sequence number of the next entry
+	firstStart    float64             // Monotonic timestamp of the first request
+	firstWallTime float64             // Wall time of the first request
+	contentLoaded float64             // Monotonic timestamp of the DOMContentLoaded event
+	loaded        float64             // Monotonic timestamp of the load event
+}
+
+// pending represents an entry being collected
+type pending struct {
+	seq            int
+	requestID      string
+	wallTime       float64
+	start          float64
+	end            float64
+	resourceType   string
+	request        map[string]interface{}
+	requestHeaders map[string]interface{} // Raw headers sent (from requestWillBeSentExtraInfo)
+	response       map[string]interface{}
+	respHeaders    map[string]interface{} // Raw headers received (from responseReceivedExtraInfo)
+	transferSize   float64
+	finished       bool
+	errorText      string
+	body           string
+	bodyBase64     bool
+	bodySet        bool
+	bodyComment    string
+}
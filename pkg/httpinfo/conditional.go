@@ -0,0 +1,106 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpinfo provides functionality to extract HTTP header information
+package httpinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+const (
+	// maxHashedBodySize is the maximum number of bytes of a response body used to compute its hash
+	maxHashedBodySize = 20 * 1024 * 1024
+)
+
+// CheckForChanges sends a conditional GET request (using the ETag and
+// Last-Modified of the previous crawl) to find out if a page has changed.
+// If the server doesn't support conditional requests, the hash of the
+// response body is compared with the previous one instead.
+func CheckForChanges(config Config, previous Validators) (*ChangeCheck, error) {
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "Checking for changes URL: %s", config.URL)
+
+	// Validate the URL
+	if ok, err := validateURL(config.URL); !ok {
+		return nil, err
+	}
+
+	httpClient := createHTTPClient(config)
+	if config.Timeout > 0 {
+		httpClient.Timeout = time.Duration(config.Timeout) * time.Second
+	}
+
+	req, err := http.NewRequest(http.MethodGet, config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range config.CustomHeader {
+		req.Header.Add(key, value)
+	}
+	if previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		req.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	result := &ChangeCheck{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Validators: Validators{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		},
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		result.Unchanged = true
+		// A 304 may omit the validators, in which case the previous ones are still valid
+		if result.Validators.ETag == "" {
+			result.Validators.ETag = previous.ETag
+		}
+		if result.Validators.LastModified == "" {
+			result.Validators.LastModified = previous.LastModified
+		}
+		result.Validators.ContentHash = previous.ContentHash
+		return result, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return result, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(resp.Body, maxHashedBodySize)); err != nil {
+		return result, fmt.Errorf("reading response body: %v", err)
+	}
+	result.Validators.ContentHash = hex.EncodeToString(hash.Sum(nil))
+	result.Unchanged = previous.ContentHash != "" && previous.ContentHash == result.Validators.ContentHash
+
+	return result, nil
+}
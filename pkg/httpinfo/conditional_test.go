@@ -0,0 +1,86 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpinfo provides functionality to extract HTTP header information
+package httpinfo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckForChanges(t *testing.T) {
+	body := "<html><body>Hello</body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte(body))
+		case "/plain":
+			_, _ = w.Write([]byte(body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	config := Config{URL: server.URL + "/etag", Timeout: 5}
+
+	// First crawl: no validators, the page is considered changed
+	first, err := CheckForChanges(config, Validators{})
+	if err != nil {
+		t.Fatalf("CheckForChanges() returned an error: %v", err)
+	}
+	if first.Unchanged || first.Validators.ETag != `"v1"` || first.Validators.ContentHash == "" {
+		t.Errorf("unexpected first result: %+v", first)
+	}
+
+	// Recrawl: the server answers 304
+	second, err := CheckForChanges(config, first.Validators)
+	if err != nil {
+		t.Fatalf("CheckForChanges() returned an error: %v", err)
+	}
+	if !second.Unchanged || !second.NotModified || second.Validators != first.Validators {
+		t.Errorf("unexpected second result: %+v", second)
+	}
+
+	// No conditional requests support: compare the content hash
+	config.URL = server.URL + "/plain"
+	third, err := CheckForChanges(config, Validators{ContentHash: first.Validators.ContentHash})
+	if err != nil {
+		t.Fatalf("CheckForChanges() returned an error: %v", err)
+	}
+	if !third.Unchanged || third.NotModified {
+		t.Errorf("unexpected third result: %+v", third)
+	}
+	third, _ = CheckForChanges(config, Validators{ContentHash: "different"})
+	if third.Unchanged {
+		t.Errorf("expected page with a different hash to be changed")
+	}
+
+	// Errors are never considered unchanged
+	config.URL = server.URL + "/missing"
+	missing, err := CheckForChanges(config, first.Validators)
+	if err != nil {
+		t.Fatalf("CheckForChanges() returned an error: %v", err)
+	}
+	if missing.Unchanged || missing.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected result for a missing page: %+v", missing)
+	}
+}
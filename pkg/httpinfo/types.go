@@ -42,6 +42,23 @@ type Config struct {
 	Proxies         []cfg.SOCKSProxy // SOCKS proxies
 }
 
+// Validators represents the values used to detect if a page has changed
+// since the last time it was crawled
+type Validators struct {
+	ETag         string `json:"etag"`          // The ETag response header
+	LastModified string `json:"last_modified"` // The Last-Modified response header
+	ContentHash  string `json:"content_hash"`  // SHA256 of the response body
+}
+
+// ChangeCheck is a struct to store the result of a conditional request
+type ChangeCheck struct {
+	URL         string     `json:"url"`          // The final URL (after redirects)
+	StatusCode  int        `json:"status_code"`  // The HTTP status code of the response
+	NotModified bool       `json:"not_modified"` // The server answered 304 Not Modified
+	Unchanged   bool       `json:"unchanged"`    // The page has not changed (304 or same content hash)
+	Validators  Validators `json:"validators"`   // The current validators of the page
+}
+
 // HTTPDetails is a struct to store the collected HTTP header information
 type HTTPDetails struct {
 	URL              string                           `json:"url"`
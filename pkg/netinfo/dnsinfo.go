@@ -16,19 +16,69 @@
 package netinfo
 
 import (
-	"os/exec"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
 	exi "github.com/pzaino/thecrowler/pkg/exprterpreter"
+
+	"github.com/miekg/dns"
 )
 
 const (
 	dnsAnswerStr = "ANSWER"
 	dnsTxtStr    = "TXT"
 	dnsRRSIGStr  = "RRSIG"
+
+	dnsTransportUDP = "udp"
+	dnsTransportTCP = "tcp"
+	dnsTransportDoT = "dot"
+	dnsTransportDoH = "doh"
+
+	// DNSSEC validation status
+	dnssecSecure        = "secure"        // validated by the resolver
+	dnssecInsecure      = "insecure"      // the zone is not signed
+	dnssecBogus         = "bogus"         // the zone is signed, but the validation failed
+	dnssecIndeterminate = "indeterminate" // the zone is signed, but the resolver didn't validate it
+
+	// maxDNSNames is the max number of names (the domain, the host and
+	// their CNAMEs) collected for a single URL
+	maxDNSNames = 8
 )
 
+var (
+	// dnsRecordTypes are the record types collected for each name
+	dnsRecordTypes = []uint16{
+		dns.TypeA, dns.TypeAAAA, dns.TypeCNAME, dns.TypeMX, dns.TypeNS, dns.TypeTXT,
+		dns.TypeSOA, dns.TypeCAA, dns.TypeDNSKEY, dns.TypeDS,
+	}
+
+	// dnsSRVServices are the (well known) services whose SRV records are
+	// collected for the domain
+	dnsSRVServices = []string{
+		"_sip._tcp", "_sip._udp", "_sips._tcp", "_xmpp-client._tcp", "_xmpp-server._tcp",
+		"_ldap._tcp", "_kerberos._tcp", "_autodiscover._tcp", "_caldavs._tcp",
+		"_carddavs._tcp", "_imaps._tcp", "_submission._tcp",
+	}
+)
+
+// dnsResolver queries the configured upstream DNS servers directly
+type dnsResolver struct {
+	servers    []string
+	transport  string
+	dnssec     bool
+	client     *dns.Client
+	httpClient *http.Client
+}
+
 // NewDNSInfo initializes a new DNSInfo struct.
 func NewDNSInfo(domain string) DNSInfo {
 	return DNSInfo{
@@ -36,234 +86,314 @@ func NewDNSInfo(domain string) DNSInfo {
 	}
 }
 
-// GetDNSInfo collects DNS information for the given domain using dig.
+// GetDNSInfo collects DNS information for the URL domain and host (and
+// the names they point to).
 func (ni *NetInfo) GetDNSInfo() error {
-	host := urlToHost(ni.URL)
-	domain := urlToDomain(ni.URL)
-
-	// Get DNS information
-	output, err := getDigInfo(host, "specific")
-	if err != nil {
-		return err
-	}
-	err = parseDNSInfo(ni, domain, host, output)
+	resolver, err := newDNSResolver(ni.Config.DNS)
 	if err != nil {
 		return err
 	}
 
-	// Try to collect SRV records
-	output, err = getDigInfo(domain, "SRV")
-	if err != nil {
-		return err
+	domain := urlToDomain(ni.URL)
+	names := []string{domain}
+	if host := urlToHost(ni.URL); host != "" && host != domain {
+		names = append(names, host)
 	}
-	err = parseDNSInfo(ni, domain, "", output)
 
-	return err
-}
+	delay := time.Duration(exi.GetFloat(ni.Config.DNS.RateLimit)) * time.Second
+	seen := make(map[string]bool)
+	var lastErr error
+	for i := 0; i < len(names) && i < maxDNSNames; i++ {
+		name := strings.ToLower(strings.TrimSuffix(names[i], "."))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if i > 0 {
+			time.Sleep(delay)
+		}
 
-// parseDNSInfo parses the dig output and populates the DNSInfo fields.
-func parseDNSInfo(ni *NetInfo, domain, host, output string) error {
-	var err error
-	// Parse DNS information
-	dnsList := ni.DNS
-	stage := 0
-	for host != "" || domain != "" {
-		var dnsInfo DNSInfo
-		if stage == 0 {
-			dnsInfo = NewDNSInfo(domain)
-			domain = ""
-			stage = 1
-		} else {
-			dnsInfo = NewDNSInfo(host)
-			host = ""
-			stage = 2
+		dnsInfo, err := resolver.collect(name, name == domain)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Failed to collect DNS information for %s: %v", name, err)
+			lastErr = err
+			continue
 		}
-		dnsInfo.parseDNSRecords(output)
-		/* if add-DNS-records to IP list is enabled, add the A records to the IP list
-		for _, record := range dnsInfo.Records {
-			if record.Type == "A" {
-				inList := false
-				for _, ip := range ni.IPs.IP {
-					if ip == record.Response {
-						inList = true
-						break
-					}
-				}
-				if !inList {
-					ni.IPs.IP = append(ni.IPs.IP, record.Response)
-				}
-			}
+		if dnsInfo.Records == nil {
+			continue
 		}
-		*/
+		ni.DNS = append(ni.DNS, dnsInfo)
 
-		// Check for unresolved answers:
+		// Follow the CNAMEs
 		for _, record := range dnsInfo.Records {
-			if record.Section == dnsAnswerStr && record.Type == "CNAME" {
-				if stage > 1 {
-					host = record.Response
-					time.Sleep(time.Duration(exi.GetFloat(ni.Config.DNS.RateLimit)) * time.Second)
-					output, err = getDigInfo(host, "")
-					if err != nil {
-						return err
-					}
-				} else {
-					domain = record.Response
-					time.Sleep(time.Duration(exi.GetFloat(ni.Config.DNS.RateLimit)) * time.Second)
-					output, err = getDigInfo(domain, "")
-					if err != nil {
-						return err
-					}
-					stage = 0
-				}
-				break
+			if record.Section == dnsAnswerStr && record.Type == "CNAME" && strings.EqualFold(record.Name, dns.Fqdn(name)) {
+				names = append(names, record.Response)
 			}
 		}
+	}
 
-		if dnsInfo.Records != nil {
-			dnsList = append(dnsList, dnsInfo)
-		}
+	if len(ni.DNS) == 0 {
+		return lastErr
 	}
-	ni.DNS = dnsList
 	return nil
 }
 
-// getDigInfo collects DNS information for the given domain using dig.
-func getDigInfo(domain string, requestType string) (string, error) {
-	// prepare requestType
-	requestType = strings.ToLower(strings.TrimSpace(requestType))
-
-	// Run the command
-	var cmd *exec.Cmd
-	if requestType == "" {
-		cmd = exec.Command("dig", domain, dnsTxtStr, "ANY")
-	} else if requestType == "SRV" {
-		cmd = exec.Command("dig", domain, "SRV")
-	} else {
-		cmd = exec.Command("dig", domain)
+// newDNSResolver returns a dnsResolver for the given configuration. If no
+// servers are configured, the system resolvers are used.
+func newDNSResolver(conf cfg.DNSConfig) (*dnsResolver, error) {
+	timeout := time.Duration(conf.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
 	}
-	// Retrieve the output
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", err
+	r := &dnsResolver{
+		transport:  strings.ToLower(strings.TrimSpace(conf.Transport)),
+		dnssec:     conf.DNSSEC,
+		client:     &dns.Client{Timeout: timeout},
+		httpClient: &http.Client{Timeout: timeout},
 	}
 
-	return string(output), nil
-}
+	port := "53"
+	switch r.transport {
+	case dnsTransportTCP:
+		r.client.Net = "tcp"
+	case dnsTransportDoT:
+		r.client.Net = "tcp-tls"
+		port = "853"
+	case dnsTransportDoH:
+	default:
+		r.transport = dnsTransportUDP
+	}
 
-// parseDNSRecords parses dig output and populates DNSInfo fields.
-func (dnsInfo *DNSInfo) parseDNSRecords(output string) {
-	records := strings.Split(strings.TrimSpace(output), "\n")
-	section := ""
-	for _, record := range records {
-		record = strings.TrimSpace(record)
-		if record == "" {
-			continue
+	servers := conf.Servers
+	if len(servers) == 0 {
+		sysConf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, fmt.Errorf("no DNS servers configured and failed to read the system ones: %v", err)
 		}
-
-		// Process sections:
-		if strings.HasPrefix(record, ";") {
-			section = processSection(record, dnsInfo)
+		servers = sysConf.Servers
+	}
+	for _, server := range servers {
+		server = strings.TrimSpace(server)
+		if server == "" {
 			continue
 		}
-
-		processFields(record, section, dnsInfo)
+		if r.transport == dnsTransportDoH {
+			if !strings.HasPrefix(server, "https://") && !strings.HasPrefix(server, "http://") {
+				server = "https://" + server + "/dns-query"
+			}
+		} else if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), port)
+		}
+		r.servers = append(r.servers, server)
+	}
+	if len(r.servers) == 0 {
+		return nil, errors.New("no DNS servers available")
 	}
+
+	return r, nil
 }
 
-// processSection processes the section of the dig output and returns the section name.
-func processSection(record string, dnsInfo *DNSInfo) string {
-	record = strings.ToUpper(record)
-	record = strings.TrimLeft(record, ";")
-	record = strings.TrimSpace(record)
-	// check if the record ends with a colon
-	if !strings.HasSuffix(record, ":") {
-		dnsInfo.Comments = append(dnsInfo.Comments, record)
+// collect returns the DNS records of a name. If withSRV is true, the well
+// known SRV records of the name are collected too.
+func (r *dnsResolver) collect(name string, withSRV bool) (DNSInfo, error) {
+	dnsInfo := NewDNSInfo(name)
+	fqdn := dns.Fqdn(name)
+
+	queries := make([]dns.Question, 0, len(dnsRecordTypes)+len(dnsSRVServices))
+	for _, qtype := range dnsRecordTypes {
+		queries = append(queries, dns.Question{Name: fqdn, Qtype: qtype})
+	}
+	if withSRV {
+		for _, service := range dnsSRVServices {
+			queries = append(queries, dns.Question{Name: service + "." + fqdn, Qtype: dns.TypeSRV})
+		}
 	}
 
-	if strings.Contains(record, "ANSWER SECTION") {
-		return dnsAnswerStr
-	} else if strings.Contains(record, "AUTHORITY SECTION") {
-		return "AUTHORITY"
-	} else if strings.Contains(record, "ADDITIONAL SECTION") {
-		return "ADDITIONAL"
+	var lastErr error
+	failures := 0
+	secure, signed, bogus := false, false, false
+	seen := make(map[string]bool)
+	for _, q := range queries {
+		qname, qtype := q.Name, q.Qtype
+		resp, server, err := r.exchange(qname, qtype)
+		if err != nil {
+			failures++
+			lastErr = err
+			dnsInfo.Comments = append(dnsInfo.Comments, fmt.Sprintf("%s %s query failed: %v", qname, dns.TypeToString[qtype], err))
+			continue
+		}
+		if !cmn.SliceContains(dnsInfo.Server, server) {
+			dnsInfo.Server = append(dnsInfo.Server, server)
+		}
+		if resp.Rcode == dns.RcodeServerFailure && r.dnssec {
+			// A validating resolver returns SERVFAIL for bogus answers,
+			// check if the answer is available with the validation disabled
+			if cdResp, _, err := r.exchangeMsg(r.newQuery(qname, qtype, true)); err == nil && cdResp.Rcode == dns.RcodeSuccess {
+				bogus = true
+				resp = cdResp
+			}
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			continue
+		}
+		if resp.AuthenticatedData && len(resp.Answer) > 0 {
+			secure = true
+		}
+
+		for _, rr := range resp.Answer {
+			record := newDNSRecord(rr, dnsAnswerStr)
+			if seen[record.Value] {
+				continue
+			}
+			seen[record.Value] = true
+			if record.Type == dnsRRSIGStr || record.Type == "DNSKEY" || record.Type == "DS" {
+				signed = true
+			}
+			dnsInfo.Records = append(dnsInfo.Records, record)
+		}
+	}
+	if failures == len(queries) {
+		return dnsInfo, lastErr
 	}
 
-	if strings.HasPrefix(record, "SERVER:") {
-		server := strings.TrimSpace(strings.TrimPrefix(record, "SERVER:"))
-		server = strings.TrimSpace(server)
-		server = strings.TrimSuffix(server, "(")
-		server = strings.TrimSpace(server)
-		// remove the substring from #53 to the end of the string
-		server = server[:strings.Index(server, "#53")]
-		server = strings.TrimSpace(server)
-		dnsInfo.Server = append(dnsInfo.Server, server)
+	if r.dnssec {
+		switch {
+		case bogus:
+			dnsInfo.DNSSEC = dnssecBogus
+		case secure:
+			dnsInfo.DNSSEC = dnssecSecure
+		case signed:
+			dnsInfo.DNSSEC = dnssecIndeterminate
+		default:
+			dnsInfo.DNSSEC = dnssecInsecure
+		}
 	}
 
-	return ""
+	return dnsInfo, nil
 }
 
-// processFields processes the fields of the dig output and populates the DNSRecord fields.
-func processFields(record string, section string, dnsInfo *DNSInfo) {
-	fields := fieldsQuotes(record)
-	var dnsRecord DNSRecord
+// newQuery returns a new query message
+func (r *dnsResolver) newQuery(name string, qtype uint16, checkingDisabled bool) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = true
+	if r.dnssec {
+		m.SetEdns0(4096, true)
+		m.AuthenticatedData = true
+		m.CheckingDisabled = checkingDisabled
+	}
+	return m
+}
 
-	// Process fields:
-	for i := 0; i < len(fields); i++ {
-		if i > 0 {
-			dnsRecord.Value = dnsRecord.Value + " " + fields[i]
+// exchange sends a query to the configured servers and returns the first
+// answer received (and the server that sent it).
+func (r *dnsResolver) exchange(name string, qtype uint16) (*dns.Msg, string, error) {
+	return r.exchangeMsg(r.newQuery(name, qtype, false))
+}
+
+func (r *dnsResolver) exchangeMsg(m *dns.Msg) (*dns.Msg, string, error) {
+	var lastErr error
+	for _, server := range r.servers {
+		var resp *dns.Msg
+		var err error
+		if r.transport == dnsTransportDoH {
+			resp, err = r.exchangeDoH(m, server)
 		} else {
-			dnsRecord.Value = fields[i]
+			resp, _, err = r.client.Exchange(m, server)
+			if err == nil && resp.Truncated && r.client.Net == "" {
+				// Retry over TCP
+				tcpClient := *r.client
+				tcpClient.Net = "tcp"
+				resp, _, err = tcpClient.Exchange(m, server)
+			}
 		}
-		switch {
-		case fields[i] == dnsTxtStr:
-			dnsRecord.Special = dnsTxtStr
-			dnsRecord.Type = dnsTxtStr
-			continue
-		case fields[i] == dnsRRSIGStr:
-			dnsRecord.Special = dnsRRSIGStr
-			dnsRecord.Type = dnsRRSIGStr
+		if err != nil {
+			lastErr = err
 			continue
-		default:
-			rType := parseDNSRecordType(fields[i], "")
-			if rType != "" {
-				dnsRecord.Type = rType
-				continue
-			}
-			if i == 0 {
-				dnsRecord.Name = fields[i]
-				continue
-			}
-			if i == 1 && isNumeric(fields[i]) {
-				dnsRecord.TTL = fields[i]
-				continue
-			}
-			if i == 2 && fields[i] == "IN" {
-				dnsRecord.Class = fields[i]
-				continue
-			}
-			if i == len(fields)-1 {
-				r := fields[i]
-				if strings.HasPrefix(r, "\"") && strings.HasSuffix(r, "\"") {
-					r = strings.TrimPrefix(r, "\"")
-					r = strings.TrimSuffix(r, "\"")
-				}
-				dnsRecord.Response = r
-				continue
-			}
 		}
+		return resp, server, nil
 	}
-	if dnsRecord.Type != "" {
-		dnsRecord.Section = section
-		dnsInfo.Records = append(dnsInfo.Records, dnsRecord)
+	return nil, "", lastErr
+}
+
+// exchangeDoH sends a query using DNS over HTTPS (RFC 8484)
+func (r *dnsResolver) exchangeDoH(m *dns.Msg, server string) (*dns.Msg, error) {
+	// RFC 8484 recommends using 0 as ID to improve caching
+	query := m.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
 	}
+
+	req, err := http.NewRequest(http.MethodPost, server, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer statement
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server %s returned status %d", server, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, err
+	}
+	answer.Id = m.Id
+	return answer, nil
 }
 
-// This function returns a DNS record type if the recordType is found in the map, otherwise it returns t.
-func parseDNSRecordType(recordType string, t string) string {
-	// Look up the record type in the map and return the corresponding value
-	if value, ok := recordTypeMap[recordType]; ok {
-		return value
+// newDNSRecord converts a resource record to a DNSRecord
+func newDNSRecord(rr dns.RR, section string) DNSRecord {
+	hdr := rr.Header()
+	record := DNSRecord{
+		Name:    hdr.Name,
+		TTL:     strconv.FormatUint(uint64(hdr.Ttl), 10),
+		Class:   dns.ClassToString[hdr.Class],
+		Type:    dns.TypeToString[hdr.Rrtype],
+		Value:   strings.ReplaceAll(rr.String(), "\t", " "),
+		Section: section,
 	}
-	// If the record type is not found, return t
-	return t
+
+	switch v := rr.(type) {
+	case *dns.A:
+		record.Response = v.A.String()
+	case *dns.AAAA:
+		record.Response = v.AAAA.String()
+	case *dns.CNAME:
+		record.Response = v.Target
+	case *dns.MX:
+		record.Response = v.Mx
+	case *dns.NS:
+		record.Response = v.Ns
+	case *dns.TXT:
+		record.Response = strings.Join(v.Txt, "")
+		record.Special = dnsTxtStr
+	case *dns.SOA:
+		record.Response = v.Ns
+	case *dns.SRV:
+		record.Response = v.Target
+	case *dns.CAA:
+		record.Response = v.Value
+	case *dns.DNSKEY:
+		record.Response = strconv.Itoa(int(v.KeyTag()))
+	case *dns.DS:
+		record.Response = v.Digest
+	case *dns.RRSIG:
+		record.Response = dns.TypeToString[v.TypeCovered]
+		record.Special = dnsRRSIGStr
+	}
+
+	return record
 }
@@ -0,0 +1,221 @@
+package netinfo
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+
+	"github.com/miekg/dns"
+)
+
+// testDNSZone is the zone served by the in-process DNS server
+var testDNSZone = []string{
+	"example.com. 300 IN A 192.0.2.1",
+	"example.com. 300 IN AAAA 2001:db8::1",
+	"example.com. 300 IN MX 10 mail.example.com.",
+	"example.com. 300 IN NS ns1.example.com.",
+	`example.com. 300 IN TXT "v=spf1 -all"`,
+	"example.com. 300 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 300",
+	`example.com. 300 IN CAA 0 issue "letsencrypt.org"`,
+	"_sip._tcp.example.com. 300 IN SRV 10 5 5060 sip.example.com.",
+	"www.example.com. 300 IN CNAME web.example.net.",
+	"web.example.net. 300 IN A 192.0.2.2",
+}
+
+// startTestDNSServer starts an in-process DNS server answering with
+// testDNSZone and returns its address
+func startTestDNSServer(t *testing.T, authenticated bool) string {
+	t.Helper()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		_ = w.WriteMsg(answerTestQuery(t, req, authenticated))
+	})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start the test DNS server: %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func answerTestQuery(t *testing.T, req *dns.Msg, authenticated bool) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.AuthenticatedData = authenticated
+	q := req.Question[0]
+	for _, line := range testDNSZone {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Errorf("invalid test record %q: %v", line, err)
+			continue
+		}
+		if rr.Header().Name == q.Name && (rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME) {
+			resp.Answer = append(resp.Answer, rr)
+		}
+	}
+	return resp
+}
+
+func findDNSInfo(t *testing.T, list []DNSInfo, domain string) DNSInfo {
+	t.Helper()
+	for _, info := range list {
+		if info.Domain == domain {
+			return info
+		}
+	}
+	t.Fatalf("no DNS information collected for %s (got %v)", domain, list)
+	return DNSInfo{}
+}
+
+func findDNSRecord(info DNSInfo, rType string) *DNSRecord {
+	for i := range info.Records {
+		if info.Records[i].Type == rType {
+			return &info.Records[i]
+		}
+	}
+	return nil
+}
+
+func TestGetDNSInfo(t *testing.T) {
+	server := startTestDNSServer(t, false)
+	ni := &NetInfo{
+		URL: "https://www.example.com/path",
+		Config: &cfg.NetworkInfo{
+			DNS: cfg.DNSConfig{Enabled: true, Timeout: 2, RateLimit: "0", Servers: []string{server}},
+		},
+	}
+
+	if err := ni.GetDNSInfo(); err != nil {
+		t.Fatalf("GetDNSInfo() returned an error: %v", err)
+	}
+
+	domain := findDNSInfo(t, ni.DNS, "example.com")
+	expected := map[string]string{
+		"A":    "192.0.2.1",
+		"AAAA": "2001:db8::1",
+		"MX":   "mail.example.com.",
+		"NS":   "ns1.example.com.",
+		"TXT":  "v=spf1 -all",
+		"SOA":  "ns1.example.com.",
+		"CAA":  "letsencrypt.org",
+		"SRV":  "sip.example.com.",
+	}
+	for rType, response := range expected {
+		record := findDNSRecord(domain, rType)
+		if record == nil {
+			t.Errorf("missing %s record", rType)
+			continue
+		}
+		if record.Response != response {
+			t.Errorf("%s record response = %q, want %q", rType, record.Response, response)
+		}
+		if record.Section != dnsAnswerStr || record.Class != "IN" || record.TTL != "300" {
+			t.Errorf("unexpected %s record: %+v", rType, *record)
+		}
+	}
+	if len(domain.Server) != 1 || domain.Server[0] != server {
+		t.Errorf("Server = %v, want [%s]", domain.Server, server)
+	}
+	if domain.DNSSEC != "" {
+		t.Errorf("expected no DNSSEC status when DNSSEC is disabled, got %q", domain.DNSSEC)
+	}
+
+	// The host CNAME must be followed
+	host := findDNSInfo(t, ni.DNS, "www.example.com")
+	if record := findDNSRecord(host, "CNAME"); record == nil || record.Response != "web.example.net." {
+		t.Errorf("unexpected CNAME record: %v", record)
+	}
+	target := findDNSInfo(t, ni.DNS, "web.example.net")
+	if record := findDNSRecord(target, "A"); record == nil || record.Response != "192.0.2.2" {
+		t.Errorf("unexpected A record for the CNAME target: %v", record)
+	}
+}
+
+func TestGetDNSInfoDNSSEC(t *testing.T) {
+	tests := []struct {
+		authenticated bool
+		want          string
+	}{
+		{true, dnssecSecure},
+		{false, dnssecInsecure},
+	}
+	for _, tt := range tests {
+		server := startTestDNSServer(t, tt.authenticated)
+		resolver, err := newDNSResolver(cfg.DNSConfig{Timeout: 2, Servers: []string{server}, DNSSEC: true})
+		if err != nil {
+			t.Fatalf("newDNSResolver() returned an error: %v", err)
+		}
+		info, err := resolver.collect("example.com", false)
+		if err != nil {
+			t.Fatalf("collect() returned an error: %v", err)
+		}
+		if info.DNSSEC != tt.want {
+			t.Errorf("DNSSEC = %q, want %q", info.DNSSEC, tt.want)
+		}
+	}
+}
+
+func TestGetDNSInfoDoH(t *testing.T) {
+	dohServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		packed, _ := answerTestQuery(t, req, false).Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	defer dohServer.Close()
+
+	resolver, err := newDNSResolver(cfg.DNSConfig{Timeout: 2, Transport: dnsTransportDoH, Servers: []string{dohServer.URL + "/dns-query"}})
+	if err != nil {
+		t.Fatalf("newDNSResolver() returned an error: %v", err)
+	}
+	info, err := resolver.collect("example.com", false)
+	if err != nil {
+		t.Fatalf("collect() returned an error: %v", err)
+	}
+	if record := findDNSRecord(info, "A"); record == nil || record.Response != "192.0.2.1" {
+		t.Errorf("unexpected A record: %v", record)
+	}
+}
+
+func TestNewDNSResolver(t *testing.T) {
+	tests := []struct {
+		conf cfg.DNSConfig
+		want string
+	}{
+		{cfg.DNSConfig{Servers: []string{"192.0.2.53"}}, "192.0.2.53:53"},
+		{cfg.DNSConfig{Servers: []string{"192.0.2.53:5353"}}, "192.0.2.53:5353"},
+		{cfg.DNSConfig{Servers: []string{"2001:db8::53"}}, "[2001:db8::53]:53"},
+		{cfg.DNSConfig{Servers: []string{"dns.example.net"}, Transport: dnsTransportDoT}, "dns.example.net:853"},
+		{cfg.DNSConfig{Servers: []string{"dns.example.net"}, Transport: dnsTransportDoH}, "https://dns.example.net/dns-query"},
+	}
+	for _, tt := range tests {
+		r, err := newDNSResolver(tt.conf)
+		if err != nil {
+			t.Fatalf("newDNSResolver(%v) returned an error: %v", tt.conf, err)
+		}
+		if len(r.servers) != 1 || r.servers[0] != tt.want {
+			t.Errorf("newDNSResolver(%v) servers = %v, want [%s]", tt.conf, r.servers, tt.want)
+		}
+	}
+}
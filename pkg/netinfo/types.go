@@ -37,6 +37,7 @@ type DNSInfo struct {
 	Server   []string    `json:"server"`
 	Records  []DNSRecord `json:"records"`
 	Comments []string    `json:"comments"`
+	DNSSEC   string      `json:"dnssec,omitempty"` // DNSSEC validation status (secure, insecure, bogus or indeterminate)
 }
 
 // WHOISData represents the structure of WHOIS data you want to extract and store.
@@ -279,30 +280,6 @@ type OSCLass struct {
 	Accuracy   int    `json:"accuracy,omitempty"`
 }
 
-// Define a map to map record types to their corresponding values
-var recordTypeMap = map[string]string{
-	"A":          "A",
-	"AAAA":       "AAAA",
-	"MX":         "MX",
-	"NS":         "NS",
-	"CNAME":      "CNAME",
-	"TXT":        "TXT",
-	"SOA":        "SOA",
-	"PTR":        "PTR",
-	"SRV":        "SRV",
-	"CAA":        "CAA",
-	"TLSA":       "TLSA",
-	"DS":         "DS",
-	"DNSKEY":     "DNSKEY",
-	"NSEC":       "NSEC",
-	"NSEC3":      "NSEC3",
-	"SPF":        "SPF",
-	"DKIM":       "DKIM",
-	"DMARC":      "DMARC",
-	"OPENPGPKEY": "OPENPGPKEY",
-	"URI":        "URI",
-}
-
 // IsEmpty Returns true if the struct is empty and false if it's not
 func (w *WHOISData) IsEmpty() bool {
 	// Check if w is empty
@@ -0,0 +1,287 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin provides the plugin functionality for the CROWler.
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+// jsEventLoop runs (on the VM goroutine) the callbacks of the timers and of
+// the asynchronous (Promise based) host functions. The JS VM is not
+// goroutine-safe, so the asynchronous work is done on other goroutines, and
+// only its result is passed back to the VM through the loop.
+type jsEventLoop struct {
+	vm      *goja.Runtime
+	jobs    chan func() error
+	done    chan struct{}
+	stopped sync.Once
+
+	// The following fields are only accessed from the VM goroutine
+	pending int
+	timers  map[int64]*time.Timer
+	nextID  int64
+}
+
+// newJSEventLoop returns a new event loop for the given VM
+func newJSEventLoop(vm *goja.Runtime) *jsEventLoop {
+	return &jsEventLoop{
+		vm:     vm,
+		jobs:   make(chan func() error),
+		done:   make(chan struct{}),
+		timers: make(map[int64]*time.Timer),
+	}
+}
+
+// expect registers a callback the loop has to wait for. The returned
+// function queues the callback, it can be called (once) from any goroutine.
+func (l *jsEventLoop) expect() func(job func() error) {
+	l.pending++
+	var once sync.Once
+	return func(job func() error) {
+		once.Do(func() {
+			select {
+			case l.jobs <- job:
+			case <-l.done:
+				// The plugin execution is over (or timed out)
+			}
+		})
+	}
+}
+
+// run executes the queued callbacks until no more callbacks are expected or
+// ctx is done. Exceptions in the callbacks are logged, uncatchable errors
+// (like an interrupted VM) are returned.
+func (l *jsEventLoop) run(ctx context.Context) error {
+	for l.pending > 0 {
+		select {
+		case job := <-l.jobs:
+			l.pending--
+			if err := job(); err != nil {
+				var exception *goja.Exception
+				if !errors.As(err, &exception) {
+					return err
+				}
+				cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: uncaught exception in a callback: %v", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// stop releases the goroutines still trying to queue callbacks and stops the timers
+func (l *jsEventLoop) stop() {
+	l.stopped.Do(func() {
+		close(l.done)
+		for id, t := range l.timers {
+			t.Stop()
+			delete(l.timers, id)
+		}
+	})
+}
+
+// setTimer calls fn (on the VM goroutine) after delay, it returns the timer ID
+func (l *jsEventLoop) setTimer(delay time.Duration, fn func() error) int64 {
+	l.nextID++
+	id := l.nextID
+	queue := l.expect()
+	l.timers[id] = time.AfterFunc(delay, func() {
+		queue(func() error {
+			if _, exists := l.timers[id]; !exists {
+				return nil // Cleared after it fired
+			}
+			delete(l.timers, id)
+			return fn()
+		})
+	})
+	return id
+}
+
+// clearTimer cancels a timer set with setTimer
+func (l *jsEventLoop) clearTimer(id int64) {
+	t, exists := l.timers[id]
+	if !exists {
+		return
+	}
+	delete(l.timers, id)
+	if t.Stop() {
+		// The timer callback will never be queued
+		l.pending--
+	}
+}
+
+// jsHostCall is a call to a host function which uses the network or a DB.
+// The arguments are parsed on the VM goroutine, work can run on any
+// goroutine (so the function can be asynchronous) and build converts its
+// result to a JS value (on the VM goroutine).
+type jsHostCall struct {
+	work  func() (interface{}, error)
+	build func(result interface{}, async bool) goja.Value
+}
+
+// jsErrorStub is an error that synchronous host functions return to JS as
+// an {"error": message} object (other errors are returned as undefined)
+type jsErrorStub string
+
+func (e jsErrorStub) Error() string {
+	return string(e)
+}
+
+// setHostFunction sets the synchronous host function name on target and its
+// Promise based variant (name + "Async"). parse returns the call to execute
+// or, for invalid arguments, an error.
+func setHostFunction(vm *goja.Runtime, loop *jsEventLoop, target *goja.Object, name string,
+	parse func(call goja.FunctionCall) (*jsHostCall, error)) error {
+	toValue := func(hc *jsHostCall, result interface{}, async bool) goja.Value {
+		if hc.build != nil {
+			return hc.build(result, async)
+		}
+		return vm.ToValue(result)
+	}
+
+	err := target.Set(name, func(call goja.FunctionCall) goja.Value {
+		hc, err := parse(call)
+		if err == nil {
+			var result interface{}
+			if result, err = hc.work(); err == nil {
+				return toValue(hc, result, false)
+			}
+		}
+		var stub jsErrorStub
+		if errors.As(err, &stub) {
+			return returnError(vm, string(stub))
+		}
+		return goja.Undefined()
+	})
+	if err != nil || loop == nil {
+		return err
+	}
+
+	return target.Set(name+"Async", func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		hc, err := parse(call)
+		if err != nil {
+			_ = reject(vm.NewGoError(fmt.Errorf("%s: %v", name, err)))
+			return vm.ToValue(promise)
+		}
+
+		queue := loop.expect()
+		go func() {
+			result, err := hc.work()
+			queue(func() error {
+				if err != nil {
+					return reject(vm.NewGoError(fmt.Errorf("%s: %v", name, err)))
+				}
+				return resolve(toValue(hc, result, true))
+			})
+		}()
+		return vm.ToValue(promise)
+	})
+}
+
+// jsResolved returns a Promise already resolved with value
+func jsResolved(vm *goja.Runtime, value interface{}) goja.Value {
+	promise, resolve, _ := vm.NewPromise()
+	_ = resolve(value)
+	return vm.ToValue(promise)
+}
+
+// jsSettled returns the result of value, waiting for it if it's a Promise
+// (the event loop must have been run already)
+func jsSettled(value goja.Value) (goja.Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	promise, ok := value.Export().(*goja.Promise)
+	if !ok {
+		return value, nil
+	}
+	switch promise.State() {
+	case goja.PromiseStateFulfilled:
+		return promise.Result(), nil
+	case goja.PromiseStateRejected:
+		return nil, fmt.Errorf("promise rejected: %v", promise.Result())
+	}
+	return nil, fmt.Errorf("promise never settled")
+}
+
+// jsIsDefined returns true if v is not undefined
+func jsIsDefined(v goja.Value) bool {
+	return v != nil && !goja.IsUndefined(v)
+}
+
+// jsIsObject returns true if v is an object (including arrays and functions)
+func jsIsObject(v goja.Value) bool {
+	_, ok := v.(*goja.Object)
+	return ok
+}
+
+// jsIsFunction returns true if v is a function
+func jsIsFunction(v goja.Value) bool {
+	_, ok := goja.AssertFunction(v)
+	return ok
+}
+
+// jsIsKind returns true if v is a primitive value of the given kind
+// (reflect.String, reflect.Float64 for numbers...)
+func jsIsKind(v goja.Value, kinds ...reflect.Kind) bool {
+	if !jsIsDefined(v) || goja.IsNull(v) || jsIsObject(v) {
+		return false
+	}
+	t := v.ExportType()
+	if t == nil {
+		return false
+	}
+	for _, kind := range kinds {
+		if t.Kind() == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// jsArgString returns the string value of an argument ("" for undefined and null)
+func jsArgString(call goja.FunctionCall, i int) string {
+	v := call.Argument(i)
+	if !jsIsDefined(v) || goja.IsNull(v) {
+		return ""
+	}
+	return v.String()
+}
+
+// jsNumber returns the float64 value of an exported JS number (JS integers
+// are exported as int64, the other numbers as float64)
+func jsNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
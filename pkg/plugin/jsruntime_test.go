@@ -0,0 +1,167 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+func TestExecEnginePluginES2020(t *testing.T) {
+	script := `
+		// @name: es2020
+		class Counter {
+			#count = 0;
+			add(n = 1) { this.#count += n; return this; }
+			get value() { return this.#count; }
+		}
+		const { list = [], name } = params;
+		const total = list.reduce((acc, n) => new Counter().add(acc).add(n).value, 0);
+		const label = ` + "`${name ?? \"none\"}: ${total}`" + `;
+		result = { label, total, spread: [...list, ...[4]], optional: params.missing?.value ?? "default" };
+	`
+	p := NewJSPlugin(script)
+	result, err := execEnginePlugin(p, 5, map[string]interface{}{"list": []interface{}{1, 2, 3}, "name": "sum"}, nil)
+	if err != nil {
+		t.Fatalf("execEnginePlugin returned an error: %v", err)
+	}
+	if result["label"] != "sum: 6" || result["optional"] != "default" {
+		t.Errorf("unexpected result: %v", result)
+	}
+	if spread := fmt.Sprint(result["spread"]); spread != "[1 2 3 4]" {
+		t.Errorf("spread = %s, want [1 2 3 4]", spread)
+	}
+}
+
+func TestExecEnginePluginES5(t *testing.T) {
+	script := `
+		// @name: es5
+		var values = [];
+		for (var i = 0; i < params.count; i++) {
+			values.push(i * 2);
+		}
+		var result = { "values": values, "hash": crypto.sha256("test") };
+		result;
+	`
+	p := NewJSPlugin(script)
+	result, err := execEnginePlugin(p, 5, map[string]interface{}{"count": 3}, nil)
+	if err != nil {
+		t.Fatalf("execEnginePlugin returned an error: %v", err)
+	}
+	if values := fmt.Sprint(result["values"]); values != "[0 2 4]" {
+		t.Errorf("values = %s, want [0 2 4]", values)
+	}
+	if !strings.HasPrefix(fmt.Sprint(result["hash"]), "9f86d081") {
+		t.Errorf("unexpected hash: %v", result["hash"])
+	}
+}
+
+func TestExecEnginePluginAsync(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"method": %q, "path": %q}`, r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	script := `
+		// @name: async
+		const sleep = (ms) => new Promise((resolve) => setTimeout(resolve, ms));
+		const order = [];
+		setTimeout((v) => order.push(v), 20, "second");
+		setTimeout(() => order.push("first"), 0);
+		const cleared = setTimeout(() => order.push("never"), 10);
+		clearTimeout(cleared);
+
+		async function main() {
+			const response = await fetchAsync(params.url + "/page");
+			const body = await response.json();
+			const [a, b] = await Promise.all([
+				httpRequestAsync(params.url + "/a"),
+				apiClient.postAsync(params.url + "/b", { body: "{}" }),
+			]);
+			await sleep(30);
+			return { ok: response.ok, body, a: JSON.parse(a).path, b: b.status, order };
+		}
+		result = main();
+	`
+	p := NewJSPlugin(script)
+	p.SetLimits(cfg.PluginConfig{Capabilities: []string{CapabilityHTTP}})
+	result, err := execEnginePlugin(p, 5, map[string]interface{}{"url": ts.URL}, nil)
+	if err != nil {
+		t.Fatalf("execEnginePlugin returned an error: %v", err)
+	}
+	if result["ok"] != true || result["a"] != "/a" || fmt.Sprint(result["b"]) != "200" {
+		t.Errorf("unexpected result: %v", result)
+	}
+	body, _ := result["body"].(map[string]interface{})
+	if body["path"] != "/page" || body["method"] != http.MethodGet {
+		t.Errorf("unexpected body: %v", result["body"])
+	}
+	if order := fmt.Sprint(result["order"]); order != "[first second]" {
+		t.Errorf("timers order = %s, want [first second]", order)
+	}
+}
+
+func TestExecEnginePluginRejected(t *testing.T) {
+	script := `
+		// @name: rejected
+		result = (async () => {
+			await runQueryAsync("SELECT 1");
+			return { status: "unreachable" };
+		})();
+	`
+	// No DB is available, so the query is rejected
+	p := NewJSPlugin(script)
+	p.SetLimits(cfg.PluginConfig{Capabilities: []string{CapabilityDB}})
+	if _, err := execEnginePlugin(p, 5, nil, nil); err == nil || !strings.Contains(err.Error(), "runQuery") {
+		t.Errorf("execEnginePlugin expected a runQuery rejection, got %v", err)
+	}
+}
+
+func TestAddJSAPIRunQueryAsync(t *testing.T) {
+	db := newTestDBHandler(t)
+	if _, err := db.Exec(`INSERT INTO Sources (url, status) VALUES ('https://example.com', 'new')`); err != nil {
+		t.Fatalf("failed to insert the test sources: %v", err)
+	}
+
+	script := "// @name: query\n// @read_only\n" + `
+		result = (async () => {
+			const rows = await runQueryAsync("SELECT url FROM Sources WHERE status = :status", { status: "new" });
+			// Read-only plugins can't modify the DB
+			const write = await runQueryAsync("DELETE FROM Sources").catch((e) => "rejected");
+			return { url: rows[0].url, rows: rows[1].rows, write };
+		})();
+	`
+	p := NewJSPlugin(script)
+	p.SetLimits(cfg.PluginConfig{Capabilities: []string{CapabilityDB}})
+	result, err := execEnginePlugin(p, 5, nil, &db)
+	if err != nil {
+		t.Fatalf("execEnginePlugin returned an error: %v", err)
+	}
+	want := map[string]interface{}{"url": "https://example.com", "rows": int64(1), "write": "rejected"}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %v, want %v", result, want)
+	}
+}
+
+func TestExecEnginePluginTimeout(t *testing.T) {
+	tests := map[string]string{
+		"busy loop":     "while (true) {}",
+		"pending timer": "setTimeout(() => {}, 60000); result = { done: true };",
+	}
+	for name, script := range tests {
+		p := NewJSPlugin("// @name: timeout\n" + script)
+		start := time.Now()
+		if _, err := execEnginePlugin(p, 1, nil, nil); err == nil {
+			t.Errorf("%s: execEnginePlugin expected a timeout error", name)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: execEnginePlugin took %v to time out", name, elapsed)
+		}
+	}
+}
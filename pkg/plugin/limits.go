@@ -0,0 +1,239 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin provides the plugin functionality for the CROWler.
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/google/uuid"
+)
+
+const (
+	// jsHeapCheckInterval is how often the heap growth guard of a plugin is checked
+	jsHeapCheckInterval = 10 * time.Millisecond
+	// jsHeapMetric is the runtime metric used for the heap growth guard
+	jsHeapMetric = "/memory/classes/heap/objects:bytes"
+)
+
+// jsStepFunction is the name of the function counting the steps of a plugin
+// (random, so plugins can't shadow it)
+var jsStepFunction = "__crowler_step_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+
+// jsInsert is a text to insert in a script at pos (byte offset)
+type jsInsert struct {
+	pos  int
+	text string
+}
+
+// limitJSSteps sets the steps budget of the VM: it returns the script
+// instrumented to count the loop iterations and the function calls, when
+// they are more than maxSteps the VM is interrupted.
+func limitJSSteps(vm *goja.Runtime, script string, maxSteps int) (string, error) {
+	instrumented, err := instrumentJSSteps(script, jsStepFunction)
+	if err != nil {
+		return "", err
+	}
+
+	steps := 0
+	step := func(goja.FunctionCall) goja.Value {
+		steps++
+		if steps > maxSteps {
+			vm.Interrupt(fmt.Sprintf("steps budget exceeded (%d)", maxSteps))
+		}
+		return goja.Undefined()
+	}
+	// The plugin can't overwrite (or remove) the step function
+	err = vm.GlobalObject().DefineDataProperty(jsStepFunction, vm.ToValue(step), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	if err != nil {
+		return "", err
+	}
+	return instrumented, nil
+}
+
+// instrumentJSSteps adds a call to stepFunction at the beginning of every
+// loop body and of every function with a block body
+func instrumentJSSteps(script, stepFunction string) (string, error) {
+	program, err := parser.ParseFile(nil, "", script, 0)
+	if err != nil {
+		return "", err
+	}
+	call := ";" + stepFunction + "();"
+
+	var inserts []jsInsert
+	loopBody := func(body ast.Statement) {
+		if block, ok := body.(*ast.BlockStatement); ok {
+			// Idx values start from 1, so LeftBrace is the offset after "{"
+			inserts = append(inserts, jsInsert{int(block.LeftBrace), call})
+			return
+		}
+		// Single statement bodies become blocks
+		inserts = append(inserts,
+			jsInsert{jsStatementStart(script, body), "{" + call},
+			jsInsert{jsStatementEnd(script, int(body.Idx1())-1), "}"})
+	}
+	functionBody := func(body *ast.BlockStatement) {
+		// The call goes after the directives (like "use strict")
+		pos := int(body.LeftBrace)
+		for _, stmt := range body.List {
+			expr, ok := stmt.(*ast.ExpressionStatement)
+			if !ok {
+				break
+			}
+			if _, ok := expr.Expression.(*ast.StringLiteral); !ok {
+				break
+			}
+			pos = jsStatementEnd(script, int(stmt.Idx1())-1)
+		}
+		inserts = append(inserts, jsInsert{pos, call})
+	}
+
+	walkJSAST(reflect.ValueOf(program), make(map[uintptr]bool), func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.ForStatement:
+			loopBody(n.Body)
+		case *ast.ForInStatement:
+			loopBody(n.Body)
+		case *ast.ForOfStatement:
+			loopBody(n.Body)
+		case *ast.WhileStatement:
+			loopBody(n.Body)
+		case *ast.DoWhileStatement:
+			loopBody(n.Body)
+		case *ast.FunctionLiteral:
+			if n.Body != nil {
+				functionBody(n.Body)
+			}
+		case *ast.ArrowFunctionLiteral:
+			if body, ok := n.Body.(*ast.BlockStatement); ok {
+				functionBody(body)
+			}
+		}
+	})
+
+	// Insert from the end, so the positions stay valid
+	sort.SliceStable(inserts, func(i, j int) bool { return inserts[i].pos > inserts[j].pos })
+	for _, insert := range inserts {
+		if insert.pos < 0 || insert.pos > len(script) {
+			return "", fmt.Errorf("invalid instrumentation offset %d", insert.pos)
+		}
+		script = script[:insert.pos] + insert.text + script[insert.pos:]
+	}
+	return script, nil
+}
+
+// jsStatementStart returns the start of a statement (the parser doesn't set
+// the position of the if statements, so it's found from their condition)
+func jsStatementStart(script string, stmt ast.Statement) int {
+	if n, ok := stmt.(*ast.IfStatement); ok && n.If == 0 {
+		return strings.LastIndex(script[:int(n.Test.Idx0())-1], "if")
+	}
+	return int(stmt.Idx0()) - 1
+}
+
+// jsStatementEnd returns the end of a statement ending at end, including
+// its semicolon
+func jsStatementEnd(script string, end int) int {
+	i := end
+	for i < len(script) && strings.ContainsRune(" \t\r\n", rune(script[i])) {
+		i++
+	}
+	if i < len(script) && script[i] == ';' {
+		return i + 1
+	}
+	return end
+}
+
+// walkJSAST calls visit for every node of a JS AST
+func walkJSAST(v reflect.Value, visited map[uintptr]bool, visit func(ast.Node)) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			walkJSAST(v.Elem(), visited, visit)
+		}
+	case reflect.Ptr:
+		// Nodes can be referenced more than once (like in the declarations lists)
+		if v.IsNil() || visited[v.Pointer()] {
+			return
+		}
+		visited[v.Pointer()] = true
+		if v.CanInterface() {
+			if node, ok := v.Interface().(ast.Node); ok {
+				visit(node)
+			}
+		}
+		walkJSAST(v.Elem(), visited, visit)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			walkJSAST(v.Field(i), visited, visit)
+		}
+	case reflect.Slice, reflect.Array:
+		switch v.Type().Elem().Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Struct, reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walkJSAST(v.Index(i), visited, visit)
+			}
+		}
+	}
+}
+
+// watchHeapGrowth interrupts the VM when the process heap grows more than
+// maxBytes while it runs. It's a best-effort guard against runaway plugins,
+// not a per-plugin budget: goja doesn't account the memory of a VM, so the
+// allocations of the rest of the process (other crawls and plugins, the
+// API) count too, while a GC can hide the plugin's own growth. It returns
+// the function to stop watching.
+func watchHeapGrowth(vm *goja.Runtime, maxBytes uint64) func() {
+	sample := []metrics.Sample{{Name: jsHeapMetric}}
+	heap := func() uint64 {
+		metrics.Read(sample)
+		if sample[0].Value.Kind() != metrics.KindUint64 {
+			return 0
+		}
+		return sample[0].Value.Uint64()
+	}
+	base := heap()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jsHeapCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if used := heap(); used > base && used-base > maxBytes {
+					vm.Interrupt(fmt.Sprintf("heap growth limit exceeded (%d MB)", maxBytes>>20))
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
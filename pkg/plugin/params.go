@@ -0,0 +1,221 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin provides the plugin functionality for the CROWler.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ArgumentsPositional passes the params of a VDI plugin as arguments[0..n]
+	ArgumentsPositional = "positional"
+	// ArgumentsNamed passes the params of a VDI plugin as a single object (arguments[0])
+	ArgumentsNamed = "named"
+
+	paramTypeAny     = "any"
+	paramTypeString  = "string"
+	paramTypeNumber  = "number"
+	paramTypeInteger = "integer"
+	paramTypeBoolean = "boolean"
+	paramTypeObject  = "object"
+	paramTypeArray   = "array"
+)
+
+// pParamRegEx parses the value of a "// @param:" header line:
+// name[?] [type] [= default]
+var pParamRegEx = regexp.MustCompile(`^([A-Za-z_$][\w$]*)(\?)?(?:\s+([A-Za-z]+))?(?:\s*=\s*(.*))?$`)
+
+// parseJSPluginParam parses the value of a "// @param:" header line, for
+// example "selector string = \"body\"" or "depth? integer"
+func parseJSPluginParam(value string) (JSPluginParam, error) {
+	value = strings.TrimSpace(value)
+	match := pParamRegEx.FindStringSubmatch(value)
+	if match == nil {
+		return JSPluginParam{}, fmt.Errorf("invalid param declaration '%s'", value)
+	}
+
+	param := JSPluginParam{
+		Name:     match[1],
+		Type:     strings.ToLower(match[3]),
+		Required: match[2] == "",
+	}
+	if param.Type == "" {
+		param.Type = paramTypeAny
+	}
+	switch param.Type {
+	case paramTypeAny, paramTypeString, paramTypeNumber, paramTypeInteger, paramTypeBoolean, paramTypeObject, paramTypeArray:
+	default:
+		return JSPluginParam{}, fmt.Errorf("param '%s' has an unknown type '%s'", param.Name, param.Type)
+	}
+
+	if defValue := strings.TrimSpace(match[4]); defValue != "" {
+		// Defaults are JSON values, anything else is a string
+		var value interface{}
+		if err := json.Unmarshal([]byte(defValue), &value); err != nil {
+			value = defValue
+		}
+		converted, err := param.convert(value)
+		if err != nil {
+			return JSPluginParam{}, fmt.Errorf("param '%s' has an invalid default: %v", param.Name, err)
+		}
+		param.Default = converted
+		param.Required = false
+	}
+	return param, nil
+}
+
+// convert returns value converted to the param type (strings are converted
+// to numbers and booleans), or an error if it's not of that type
+func (param JSPluginParam) convert(value interface{}) (interface{}, error) {
+	if value == nil || param.Type == paramTypeAny {
+		return value, nil
+	}
+
+	str, isString := value.(string)
+	switch param.Type {
+	case paramTypeString:
+		if isString {
+			return str, nil
+		}
+	case paramTypeNumber, paramTypeInteger:
+		var number float64
+		var ok bool
+		if isString {
+			var err error
+			number, err = strconv.ParseFloat(strings.TrimSpace(str), 64)
+			ok = err == nil
+		} else {
+			number, ok = jsNumber(value)
+		}
+		if ok && param.Type == paramTypeInteger {
+			if number != math.Trunc(number) {
+				return nil, fmt.Errorf("%v is not an integer", value)
+			}
+			return int64(number), nil
+		}
+		if ok {
+			return number, nil
+		}
+	case paramTypeBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		if isString {
+			if b, err := strconv.ParseBool(strings.TrimSpace(str)); err == nil {
+				return b, nil
+			}
+		}
+	case paramTypeObject:
+		if _, ok := value.(map[string]interface{}); ok {
+			return value, nil
+		}
+	case paramTypeArray:
+		if _, ok := value.([]interface{}); ok {
+			return value, nil
+		}
+		if _, ok := value.([]string); ok {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("%v is not of type %s", value, param.Type)
+}
+
+// ValidateParams checks params against the params declared by the plugin:
+// it returns a copy of params with the declared params converted to their
+// type and the defaults of the missing ones, or an error if a required
+// param is missing or a param has the wrong type. Undeclared params are
+// kept as they are.
+func (p *JSPlugin) ValidateParams(params map[string]interface{}) (map[string]interface{}, error) {
+	validated := make(map[string]interface{}, len(params)+len(p.Params))
+	for k, v := range params {
+		validated[k] = v
+	}
+
+	for _, param := range p.Params {
+		value, exists := validated[param.Name]
+		if !exists || value == nil {
+			if param.Required {
+				return nil, fmt.Errorf("plugin '%s': missing required param '%s'", p.Name, param.Name)
+			}
+			if param.Default != nil {
+				validated[param.Name] = param.Default
+			}
+			continue
+		}
+		converted, err := param.convert(value)
+		if err != nil {
+			return nil, fmt.Errorf("plugin '%s': param '%s': %v", p.Name, param.Name, err)
+		}
+		validated[param.Name] = converted
+	}
+	return validated, nil
+}
+
+// VDIArgs returns the arguments of a VDI plugin execution (the arguments[]
+// of the script in the browser), after validating params.
+// With "// @arguments: named" the arguments are a single object with all
+// the params. Otherwise they are the params values in the order of the
+// params declared by the plugin, then in the order of order (for example
+// the order of the plugin_args of a ruleset plugin call), then the other
+// params sorted by name.
+func (p *JSPlugin) VDIArgs(params map[string]interface{}, order []string) ([]interface{}, error) {
+	validated, err := p.ValidateParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if p.Arguments == ArgumentsNamed {
+		return []interface{}{validated}, nil
+	}
+
+	names := make([]string, 0, len(validated))
+	added := make(map[string]bool, len(validated))
+	add := func(name string) {
+		if _, exists := validated[name]; exists && !added[name] {
+			names = append(names, name)
+			added[name] = true
+		}
+	}
+	for _, param := range p.Params {
+		if _, exists := validated[param.Name]; !exists {
+			// Optional params without a default keep their position
+			validated[param.Name] = nil
+		}
+		add(param.Name)
+	}
+	for _, name := range order {
+		add(name)
+	}
+	var others []string
+	for name := range validated {
+		if !added[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		args = append(args, validated[name])
+	}
+	return args, nil
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSPluginParam(t *testing.T) {
+	tests := map[string]JSPluginParam{
+		`selector string = "body"`: {Name: "selector", Type: "string", Default: "body"},
+		`depth integer = 3`:        {Name: "depth", Type: "integer", Default: int64(3)},
+		`strict boolean=true`:      {Name: "strict", Type: "boolean", Default: true},
+		`target string`:            {Name: "target", Type: "string", Required: true},
+		`limit? number`:            {Name: "limit", Type: "number"},
+		`options`:                  {Name: "options", Type: "any", Required: true},
+		`label string = hello`:     {Name: "label", Type: "string", Default: "hello"},
+	}
+	for value, want := range tests {
+		got, err := parseJSPluginParam(value)
+		if err != nil {
+			t.Errorf("parseJSPluginParam(%q) returned an error: %v", value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseJSPluginParam(%q) = %#v, want %#v", value, got, want)
+		}
+	}
+
+	for _, value := range []string{"1name string", "name float", `depth integer = 1.5`, `strict boolean = "maybe"`} {
+		if _, err := parseJSPluginParam(value); err == nil {
+			t.Errorf("parseJSPluginParam(%q) expected an error", value)
+		}
+	}
+}
+
+func TestNewJSPluginParams(t *testing.T) {
+	script := "// @name: test\n// @param: selector string = \"body\"\n// @param: depth? integer\n// @param: bad type\n// @arguments: named\n"
+	p := NewJSPlugin(script)
+	if len(p.Params) != 2 || p.Params[0].Name != "selector" || p.Params[1].Name != "depth" {
+		t.Errorf("unexpected params: %#v", p.Params)
+	}
+	if p.Arguments != ArgumentsNamed {
+		t.Errorf("Arguments = %s, want %s", p.Arguments, ArgumentsNamed)
+	}
+	if p := NewJSPlugin("// @name: test\n"); p.Arguments != ArgumentsPositional || p.Params != nil {
+		t.Errorf("unexpected defaults: %s, %#v", p.Arguments, p.Params)
+	}
+}
+
+func TestVDIArgs(t *testing.T) {
+	params := map[string]interface{}{"zeta": 1, "alpha": 2, "mid": 3, "beta": 4}
+
+	// Undeclared params are sorted by name
+	p := NewJSPlugin("// @name: test\n")
+	for i := 0; i < 10; i++ {
+		args, err := p.VDIArgs(params, nil)
+		if err != nil {
+			t.Fatalf("VDIArgs returned an error: %v", err)
+		}
+		if want := []interface{}{2, 4, 3, 1}; !reflect.DeepEqual(args, want) {
+			t.Fatalf("VDIArgs = %v, want %v", args, want)
+		}
+	}
+
+	// The caller order comes before the other params
+	args, _ := p.VDIArgs(params, []string{"zeta", "mid", "missing"})
+	if want := []interface{}{1, 3, 2, 4}; !reflect.DeepEqual(args, want) {
+		t.Errorf("VDIArgs with order = %v, want %v", args, want)
+	}
+
+	// The declared params come first, with their defaults and types
+	p = NewJSPlugin("// @name: test\n// @param: count integer = 5\n// @param: opt? string\n// @param: mid number\n")
+	args, err := p.VDIArgs(map[string]interface{}{"mid": "3.5", "alpha": true}, []string{"alpha"})
+	if err != nil {
+		t.Fatalf("VDIArgs returned an error: %v", err)
+	}
+	if want := []interface{}{int64(5), nil, 3.5, true}; !reflect.DeepEqual(args, want) {
+		t.Errorf("VDIArgs with declared params = %#v, want %#v", args, want)
+	}
+
+	// Validation errors
+	if _, err := p.VDIArgs(map[string]interface{}{}, nil); err == nil || !strings.Contains(err.Error(), "missing required param 'mid'") {
+		t.Errorf("VDIArgs expected a missing param error, got %v", err)
+	}
+	if _, err := p.VDIArgs(map[string]interface{}{"mid": "abc"}, nil); err == nil {
+		t.Errorf("VDIArgs expected a type error")
+	}
+
+	// Named arguments are a single object
+	p = NewJSPlugin("// @name: test\n// @arguments: named\n// @param: count integer = 5\n")
+	args, _ = p.VDIArgs(map[string]interface{}{"alpha": 1}, nil)
+	if want := []interface{}{map[string]interface{}{"alpha": 1, "count": int64(5)}}; !reflect.DeepEqual(args, want) {
+		t.Errorf("VDIArgs named = %#v, want %#v", args, want)
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin provides the plugin functionality for the CROWler.
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const (
+	// CapabilityDB allows a plugin to query the CROWler DB (runQuery)
+	CapabilityDB = "db"
+	// CapabilityEvents allows a plugin to create and schedule events (createEvent, scheduleEvent)
+	CapabilityEvents = "events"
+	// CapabilitySources allows a plugin to manage the sources (createSource, removeSource, vacuumSource)
+	CapabilitySources = "sources"
+	// CapabilityExternalDB allows a plugin to query external databases (externalDBQuery)
+	CapabilityExternalDB = "external_db"
+	// CapabilityHTTP allows a plugin to make HTTP requests (fetch, httpRequest, apiClient)
+	CapabilityHTTP = "http"
+	// CapabilityFiles allows a plugin to read the support files (loadLocalFile)
+	CapabilityFiles = "files"
+)
+
+// AllCapabilities is the list of the capabilities a plugin can declare
+var AllCapabilities = []string{
+	CapabilityDB,
+	CapabilityEvents,
+	CapabilitySources,
+	CapabilityExternalDB,
+	CapabilityHTTP,
+	CapabilityFiles,
+}
+
+const (
+	// UploadedPluginMaxSteps is the steps budget of the uploaded plugins saved
+	// outside the configured plugins locations
+	UploadedPluginMaxSteps = 1000000
+	// UploadedPluginMaxCallStack is the maximum call depth of the uploaded
+	// plugins saved outside the configured plugins locations
+	UploadedPluginMaxCallStack = 512
+)
+
+// jsAPIPermissions are the host functions (and hosts) a plugin execution can use
+type jsAPIPermissions struct {
+	readOnly     bool            // runQuery only accepts read queries and the sources functions are not available
+	capabilities map[string]bool // Granted capabilities
+	allowedHosts []string        // Hosts reachable with the HTTP functions (empty means all)
+}
+
+// allows returns true if the capability is granted
+func (perm jsAPIPermissions) allows(capability string) bool {
+	return perm.capabilities == nil || perm.capabilities[capability]
+}
+
+// isCapability returns true if name is a known capability
+func isCapability(name string) bool {
+	for _, capability := range AllCapabilities {
+		if capability == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCapabilities parses the value of a "// @capabilities:" header line
+// (a comma or space separated list). "none" means no capabilities, "all"
+// means all of them.
+func parseCapabilities(value string) []string {
+	capabilities := []string{}
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch item {
+		case none:
+			continue
+		case all:
+			return append(capabilities, AllCapabilities...)
+		}
+		capabilities = append(capabilities, item)
+	}
+	return capabilities
+}
+
+// SetLimits sets the operator limits of the plugin from the configuration
+// of the plugins location it was loaded from
+func (p *JSPlugin) SetLimits(config cfg.PluginConfig) {
+	p.Limits = JSPluginLimits{
+		AllowedHosts:  config.AllowedHosts,
+		MaxHeapGrowth: config.MaxHeapGrowth,
+		MaxSteps:      config.MaxSteps,
+		MaxCallStack:  config.MaxCallStack,
+	}
+	for _, capability := range config.Capabilities {
+		capability = strings.ToLower(strings.TrimSpace(capability))
+		if capability == all {
+			p.Limits.Capabilities = append([]string{}, AllCapabilities...)
+			break
+		}
+		if !isCapability(capability) {
+			cmn.DebugMsg(cmn.DbgLvlError, "Unknown plugins capability '%s' in the plugins configuration", capability)
+			continue
+		}
+		p.Limits.Capabilities = append(p.Limits.Capabilities, capability)
+	}
+
+	for _, capability := range p.Capabilities {
+		if !isCapability(capability) {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "Plugin '%s' declares the unknown capability '%s'", p.Name, capability)
+		} else if !p.limitsAllow(capability) {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "Plugin '%s' declares the capability '%s', which is not allowed by the plugins configuration", p.Name, capability)
+		}
+	}
+}
+
+// SetUploadLimits sets the limits of an uploaded plugin: the ones of the
+// plugins location it was saved into or, if it's saved outside the
+// configured locations, no capabilities and the uploaded plugins budgets
+// (the heap growth guard is disabled)
+func (p *JSPlugin) SetUploadLimits(config *cfg.Config, file string) {
+	if location, ok := LocationForFile(config, file); ok {
+		p.SetLimits(location)
+		return
+	}
+	p.SetLimits(cfg.PluginConfig{
+		MaxSteps:     UploadedPluginMaxSteps,
+		MaxCallStack: UploadedPluginMaxCallStack,
+	})
+}
+
+// limitsAllow returns true if the operator limits allow the capability
+func (p *JSPlugin) limitsAllow(capability string) bool {
+	for _, allowed := range p.Limits.Capabilities {
+		if allowed == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantedCapabilities returns the capabilities the plugin gets: the ones it
+// declares allowed by its limits. Plugins which don't declare them get the
+// capabilities allowed by their limits (none if the operator didn't set any).
+func (p *JSPlugin) GrantedCapabilities() []string {
+	declared := p.Capabilities
+	if declared == nil {
+		declared = p.Limits.Capabilities
+	}
+
+	granted := []string{}
+	for _, capability := range declared {
+		if isCapability(capability) && p.limitsAllow(capability) {
+			granted = append(granted, capability)
+		}
+	}
+	sort.Strings(granted)
+	return granted
+}
+
+// permissions returns the permissions of an execution of the plugin
+func (p *JSPlugin) permissions() jsAPIPermissions {
+	perm := jsAPIPermissions{
+		readOnly:     p.ReadOnly,
+		capabilities: make(map[string]bool),
+		allowedHosts: p.Limits.AllowedHosts,
+	}
+	for _, capability := range p.GrantedCapabilities() {
+		perm.capabilities[capability] = true
+	}
+	return perm
+}
+
+// LocationForFile returns the configuration of the local plugins location
+// which loads file (for plugins which are not loaded by the register, like
+// the uploaded ones)
+func LocationForFile(config *cfg.Config, file string) (cfg.PluginConfig, bool) {
+	file = filepath.Clean(file)
+	for _, location := range config.Plugins.Plugins {
+		if location.Host != "" {
+			continue
+		}
+		for _, path := range location.Path {
+			path = filepath.Clean(path)
+			if path == file || path == filepath.Dir(file) {
+				return location, true
+			}
+			if matched, err := filepath.Match(path, file); err == nil && matched {
+				return location, true
+			}
+		}
+	}
+	return cfg.PluginConfig{}, false
+}
+
+// checkJSHost returns an error if the host of u is not in allowedHosts.
+// Entries can be a host name ("api.example.com"), a host with a port
+// ("localhost:8080") or a domain and all its subdomains ("*.example.com").
+func checkJSHost(u *url.URL, allowedHosts []string) error {
+	if len(allowedHosts) == 0 {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	hostPort := strings.ToLower(u.Host)
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case strings.HasPrefix(allowed, "*."):
+			if host == allowed[2:] || strings.HasSuffix(host, allowed[1:]) {
+				return nil
+			}
+		case strings.Contains(allowed, ":") && !strings.HasPrefix(allowed, "["):
+			if hostPort == allowed {
+				return nil
+			}
+		default:
+			if host == strings.Trim(allowed, "[]") {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("host '%s' is not allowed", u.Host)
+}
+
+// checkJSURL returns an error if the host of rawURL is not in allowedHosts
+func checkJSURL(rawURL string, allowedHosts []string) error {
+	if len(allowedHosts) == 0 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	return checkJSHost(u, allowedHosts)
+}
+
+// newJSHTTPClient returns the HTTP client of the plugins HTTP functions,
+// redirects are only followed to the allowed hosts
+func newJSHTTPClient(timeout time.Duration, allowedHosts []string) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if len(allowedHosts) > 0 {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return checkJSHost(req.URL, allowedHosts)
+		}
+	}
+	return client
+}
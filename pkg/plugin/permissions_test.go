@@ -0,0 +1,254 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+
+	"github.com/dop251/goja"
+)
+
+func TestNewJSPluginCapabilities(t *testing.T) {
+	tests := map[string][]string{
+		"// @name: test\n// @capabilities: http, db\n":                  {"http", "db"},
+		"// @name: test\n// @capabilities http events\n":                {"http", "events"},
+		"// @name: test\n// @capabilities: files\n// @capabilities: db": {"files", "db"},
+		"// @name: test\n// @capabilities: none\n":                      {},
+		"// @name: test\n": nil,
+	}
+	for script, want := range tests {
+		if got := NewJSPlugin(script).Capabilities; !reflect.DeepEqual(got, want) {
+			t.Errorf("NewJSPlugin(%q).Capabilities = %#v, want %#v", script, got, want)
+		}
+	}
+}
+
+func TestGrantedCapabilities(t *testing.T) {
+	tests := []struct {
+		declared string
+		limits   []string
+		want     []string
+	}{
+		{"", nil, []string{}},
+		{"// @capabilities: http, db\n", nil, []string{}},
+		{"", []string{"all"}, []string{"db", "events", "external_db", "files", "http", "sources"}},
+		{"// @capabilities: http, db\n", []string{"all"}, []string{"db", "http"}},
+		{"// @capabilities: http, db, unknown\n", []string{"db", "events"}, []string{"db"}},
+		{"", []string{"files", "bogus"}, []string{"files"}},
+		{"// @capabilities: none\n", []string{"all"}, []string{}},
+	}
+	for _, test := range tests {
+		p := NewJSPlugin("// @name: test\n" + test.declared)
+		p.SetLimits(cfg.PluginConfig{Capabilities: test.limits})
+		if got := p.GrantedCapabilities(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("GrantedCapabilities(%q, %v) = %v, want %v", test.declared, test.limits, got, test.want)
+		}
+	}
+}
+
+func TestSetCrowlerJSAPIPermissions(t *testing.T) {
+	p := NewJSPlugin("// @name: test\n// @capabilities: http, files\n")
+	p.SetLimits(cfg.PluginConfig{Capabilities: []string{"all"}})
+	vm := goja.New()
+	if err := setCrowlerJSAPI(vm, newJSEventLoop(vm), nil, p.permissions()); err != nil {
+		t.Fatalf("setCrowlerJSAPI returned an error: %v", err)
+	}
+
+	value, err := vm.RunString(`[typeof fetch, typeof loadLocalFile, typeof runQuery, typeof createEvent, typeof createSource, typeof externalDBQuery, typeof console.log].join(",")`)
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	want := "function,function,undefined,undefined,undefined,undefined,function"
+	if got := value.String(); got != want {
+		t.Errorf("installed functions = %s, want %s", got, want)
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://example.invalid/", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	script := `
+		// @name: hosts
+		async function get(path) {
+			try {
+				const response = await fetchAsync(params.url + path);
+				return await response.text();
+			} catch (e) {
+				return "blocked";
+			}
+		}
+		result = (async () => ({ page: await get("/"), redirect: await get("/redirect") }))();
+	`
+	tests := map[string]map[string]interface{}{
+		"127.0.0.1":   {"page": "ok", "redirect": "blocked"},
+		"example.com": {"page": "blocked", "redirect": "blocked"},
+	}
+	for allowed, want := range tests {
+		p := NewJSPlugin(script)
+		p.SetLimits(cfg.PluginConfig{Capabilities: []string{CapabilityHTTP}, AllowedHosts: []string{allowed}})
+		result, err := execEnginePlugin(p, 5, map[string]interface{}{"url": ts.URL}, nil)
+		if err != nil {
+			t.Fatalf("execEnginePlugin returned an error: %v", err)
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("allowed hosts %s: result = %v, want %v", allowed, result, want)
+		}
+	}
+}
+
+func TestSetUploadLimits(t *testing.T) {
+	config := cfg.Config{}
+	config.Plugins.Plugins = []cfg.PluginConfig{
+		{Path: []string{"./plugins/*.js"}, Capabilities: []string{"http"}, MaxSteps: 10},
+	}
+
+	p := NewJSPlugin("// @name: test\n// @capabilities: http, db\n")
+	p.SetUploadLimits(&config, "./plugins/test.js")
+	if got := p.GrantedCapabilities(); !reflect.DeepEqual(got, []string{"http"}) || p.Limits.MaxSteps != 10 {
+		t.Errorf("uploaded into a location: capabilities = %v, max steps = %d", got, p.Limits.MaxSteps)
+	}
+
+	p.SetUploadLimits(&config, "./elsewhere/test.js")
+	if got := p.GrantedCapabilities(); len(got) != 0 {
+		t.Errorf("uploaded outside the locations: capabilities = %v, want none", got)
+	}
+	if p.Limits.MaxSteps != UploadedPluginMaxSteps || p.Limits.MaxHeapGrowth != 0 || p.Limits.MaxCallStack != UploadedPluginMaxCallStack {
+		t.Errorf("uploaded outside the locations: unexpected limits %+v", p.Limits)
+	}
+}
+
+func TestCheckJSHost(t *testing.T) {
+	allowed := []string{"api.example.com", "*.example.org", "localhost:8080"}
+	tests := map[string]bool{
+		"https://api.example.com/v1":   true,
+		"https://www.example.com/":     false,
+		"https://example.org/":         true,
+		"https://a.b.example.org/":     true,
+		"https://badexample.org/":      false,
+		"http://localhost:8080/":       true,
+		"http://localhost:9090/":       false,
+		"https://API.Example.com:443/": true,
+	}
+	for rawURL, want := range tests {
+		u, _ := url.Parse(rawURL)
+		if got := checkJSHost(u, allowed) == nil; got != want {
+			t.Errorf("checkJSHost(%s) allowed = %v, want %v", rawURL, got, want)
+		}
+	}
+	u, _ := url.Parse("https://anything.test/")
+	if err := checkJSHost(u, nil); err != nil {
+		t.Errorf("checkJSHost with no allowed hosts returned an error: %v", err)
+	}
+}
+
+func TestLocationForFile(t *testing.T) {
+	config := cfg.Config{}
+	config.Plugins.Plugins = []cfg.PluginConfig{
+		{Host: "plugins.example.com", Path: []string{"./plugins/*.js"}, MaxSteps: 1},
+		{Path: []string{"./plugins/*.js"}, MaxSteps: 2},
+		{Path: []string{"./other"}, MaxSteps: 3},
+	}
+	tests := map[string]int{
+		"plugins/test.js":    2,
+		"./other/test.js":    3,
+		"./elsewhere/new.js": 0,
+	}
+	for file, want := range tests {
+		loc, ok := LocationForFile(&config, file)
+		if ok != (want != 0) || loc.MaxSteps != want {
+			t.Errorf("LocationForFile(%s) = %d, %v, want %d", file, loc.MaxSteps, ok, want)
+		}
+	}
+}
+
+func TestInstrumentJSSteps(t *testing.T) {
+	script := `
+		"use strict";
+		function sum(list) {
+			"use strict";
+			let total = 0;
+			for (const n of list) total += n;
+			return total;
+		}
+		const double = (n) => { return n * 2; };
+		let i = 0, count = 0;
+		do i++; while (i < 3)
+		while (count < 5) { count++ }
+		for (let j = 0; j < 2; j++)
+			if (j) count += 10; else count += 100;
+		const keys = [];
+		for (const k in { a: 1, b: 2 }) keys.push(k);
+		[sum([1, 2, 3]), double(4), i, count, keys.join(""), "ciao ✓"].join(",");
+	`
+	instrumented, err := instrumentJSSteps(script, "step")
+	if err != nil {
+		t.Fatalf("instrumentJSSteps returned an error: %v", err)
+	}
+
+	run := func(script string) (string, int) {
+		vm := goja.New()
+		steps := 0
+		_ = vm.Set("step", func() { steps++ })
+		value, err := vm.RunString(script)
+		if err != nil {
+			t.Fatalf("script failed: %v\n%s", err, script)
+		}
+		return value.String(), steps
+	}
+	want, _ := run(script)
+	got, steps := run(instrumented)
+	if got != want {
+		t.Errorf("instrumented script = %s, want %s", got, want)
+	}
+	if steps == 0 {
+		t.Errorf("the instrumented script didn't count any step")
+	}
+}
+
+func TestExecEnginePluginLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		limits cfg.PluginConfig
+		errMsg string
+	}{
+		{"steps", "while (true) {}", cfg.PluginConfig{MaxSteps: 1000}, "steps budget"},
+		{"function steps", "function f() { return 1; } for (;;) f();", cfg.PluginConfig{MaxSteps: 1000}, "steps budget"},
+		{"memory", "const list = []; while (true) { list.push({ value: 'x'.repeat(1024) + list.length }); }", cfg.PluginConfig{MaxHeapGrowth: 16}, "heap growth limit"},
+		{"call stack", "function f(n) { return f(n + 1) + 1; } f(0);", cfg.PluginConfig{MaxCallStack: 100}, "stack"},
+	}
+	for _, test := range tests {
+		p := NewJSPlugin("// @name: limits\n" + test.script)
+		p.SetLimits(test.limits)
+		start := time.Now()
+		_, err := execEnginePlugin(p, 10, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+			t.Errorf("%s: execEnginePlugin error = %v, want %q", test.name, err, test.errMsg)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: execEnginePlugin took %v to stop", test.name, elapsed)
+		}
+	}
+
+	// A script within the budget runs normally
+	p := NewJSPlugin("// @name: limits\nlet n = 0; for (let i = 0; i < 10; i++) { n += i; } result = { n };")
+	p.SetLimits(cfg.PluginConfig{MaxSteps: 100, MaxCallStack: 50, MaxHeapGrowth: 64})
+	result, err := execEnginePlugin(p, 5, nil, nil)
+	if err != nil || fmt.Sprint(result["n"]) != "45" {
+		t.Errorf("execEnginePlugin = %v, %v, want n = 45", result, err)
+	}
+}
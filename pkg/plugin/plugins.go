@@ -23,19 +23,22 @@ import (
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/dop251/goja"
 	"github.com/google/uuid"
-	"github.com/robertkrimen/otto"
 
 	cmn "github.com/pzaino/thecrowler/pkg/common"
 	cfg "github.com/pzaino/thecrowler/pkg/config"
@@ -70,6 +73,9 @@ func NewJSPluginRegister() *JSPluginRegister {
 
 // Register registers a new JS plugin
 func (reg *JSPluginRegister) Register(name string, plugin JSPlugin) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
 	// Check if the register is initialized
 	if reg.Registry == nil {
 		reg.Registry = make(map[string]JSPlugin)
@@ -88,8 +94,31 @@ func (reg *JSPluginRegister) Register(name string, plugin JSPlugin) {
 	reg.Order = append(reg.Order, name)
 }
 
+// RegisterUploaded registers a JS plugin uploaded at runtime (for example
+// through the events service). Unlike the plugins loaded from the plugins
+// locations, it's kept when the register is replaced by a reload.
+func (reg *JSPluginRegister) RegisterUploaded(name string, plugin JSPlugin) {
+	if strings.TrimSpace(name) == "" {
+		name = plugin.Name
+	}
+	name = strings.TrimSpace(name)
+
+	reg.Remove(name)
+	reg.Register(name, plugin)
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.uploaded == nil {
+		reg.uploaded = make(map[string]bool)
+	}
+	reg.uploaded[name] = true
+}
+
 // Remove removes a registered plugin from the registry
 func (reg *JSPluginRegister) Remove(name string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
 	// Check if the register is initialized
 	if reg.Registry == nil {
 		return
@@ -103,6 +132,7 @@ func (reg *JSPluginRegister) Remove(name string) {
 
 	// Remove the plugin
 	delete(reg.Registry, name)
+	delete(reg.uploaded, name)
 
 	// Remove the plugin name from the order list
 	for i, n := range reg.Order {
@@ -115,12 +145,63 @@ func (reg *JSPluginRegister) Remove(name string) {
 
 // GetPlugin returns a JS plugin
 func (reg *JSPluginRegister) GetPlugin(name string) (JSPlugin, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
 	plugin, exists := reg.Registry[name]
 	return plugin, exists
 }
 
+// Count returns the number of registered plugins
+func (reg *JSPluginRegister) Count() int {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return len(reg.Registry)
+}
+
+// Replace atomically replaces the registered plugins with the ones of src
+// (in its registration order) and returns what changed. The uploaded
+// plugins (see RegisterUploaded) which are not in src are kept. The register
+// is left untouched when nothing changed. The plugins already retrieved (for
+// example by a crawl in progress) are not affected.
+func (reg *JSPluginRegister) Replace(src *JSPluginRegister) cmn.Changes {
+	src.mu.RLock()
+	registry := make(map[string]JSPlugin, len(src.Registry))
+	for name, plugin := range src.Registry {
+		registry[name] = plugin
+	}
+	order := append([]string(nil), src.Order...)
+	src.mu.RUnlock()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, name := range reg.Order {
+		if _, exists := registry[name]; exists || !reg.uploaded[name] {
+			continue
+		}
+		registry[name] = reg.Registry[name]
+		order = append(order, name)
+	}
+	changes := cmn.DiffFingerprints(pluginsFingerprints(reg.Registry), pluginsFingerprints(registry))
+	if !changes.IsEmpty() {
+		reg.Registry = registry
+		reg.Order = order
+	}
+	return changes
+}
+
+// pluginsFingerprints returns the fingerprints of a plugins registry
+func pluginsFingerprints(registry map[string]JSPlugin) map[string]string {
+	fps := make(map[string]string, len(registry))
+	for name, plugin := range registry {
+		fps[name] = cmn.Fingerprint(plugin)
+	}
+	return fps
+}
+
 // GetPluginsByEventType returns a list of JS plugins to handle an event type
 func (reg *JSPluginRegister) GetPluginsByEventType(eventType string) ([]JSPlugin, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
 	plugins := make([]JSPlugin, 0)
 	eventType = strings.ToLower(strings.TrimSpace(eventType))
 	if eventType == "" {
@@ -142,6 +223,8 @@ func (reg *JSPluginRegister) GetPluginsByEventType(eventType string) ([]JSPlugin
 
 // GetPluginsByAgentName returns a list of JS plugins related to the specified agent name
 func (reg *JSPluginRegister) GetPluginsByAgentName(agentName string) ([]JSPlugin, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
 	plugins := make([]JSPlugin, 0)
 	agentName = strings.ToLower(strings.TrimSpace(agentName))
 	if agentName == "" {
@@ -213,26 +296,9 @@ func BulkLoadPlugins(config cfg.PluginConfig, pType string) ([]*JSPlugin, error)
 				cmn.DebugMsg(cmn.DbgLvlError, "Failed to load plugin from %s: %v", path, err)
 				continue
 			}
-			if pType != "" {
-				for _, plugin := range plugins {
-					if pType == eventPlugin {
-						if plugin.EventType != "" || plugin.PType != eventPlugin {
-							pluginsSet = append(pluginsSet, plugin)
-						}
-					} else if pType == vdiPlugin {
-						if plugin.PType == vdiPlugin {
-							pluginsSet = append(pluginsSet, plugin)
-						}
-					} else if pType == enginePlugin {
-						if plugin.PType != vdiPlugin {
-							pluginsSet = append(pluginsSet, plugin)
-						}
-					}
-				}
-			} else {
-				pluginsSet = append(pluginsSet, plugins...)
-			}
+			pluginsSet = append(pluginsSet, filterPluginsByType(plugins, pType)...)
 		}
+		setPluginsLimits(pluginsSet, config)
 		return pluginsSet, nil
 	}
 	// Plugins are stored remotely
@@ -240,27 +306,43 @@ func BulkLoadPlugins(config cfg.PluginConfig, pType string) ([]*JSPlugin, error)
 	if err != nil {
 		return nil, err
 	}
-	if pType != "" {
-		for _, plugin := range plugins {
-			if pType == eventPlugin {
-				if plugin.EventType != "" || plugin.PType != eventPlugin {
-					pluginsSet = append(pluginsSet, plugin)
-				}
-			} else if pType == vdiPlugin {
-				if plugin.PType == vdiPlugin {
-					pluginsSet = append(pluginsSet, plugin)
-				}
-			} else if pType == enginePlugin {
-				if plugin.PType != vdiPlugin {
-					pluginsSet = append(pluginsSet, plugin)
-				}
+	pluginsSet = append(pluginsSet, filterPluginsByType(plugins, pType)...)
+	setPluginsLimits(pluginsSet, config)
+
+	return pluginsSet, nil
+}
+
+// filterPluginsByType returns the plugins to load for a plugins type
+// (empty type means all the plugins)
+func filterPluginsByType(plugins []*JSPlugin, pType string) []*JSPlugin {
+	if pType == "" {
+		return plugins
+	}
+	var filtered []*JSPlugin
+	for _, plugin := range plugins {
+		switch pType {
+		case eventPlugin:
+			if plugin.EventType != "" || plugin.PType != eventPlugin {
+				filtered = append(filtered, plugin)
+			}
+		case vdiPlugin:
+			if plugin.PType == vdiPlugin {
+				filtered = append(filtered, plugin)
+			}
+		case enginePlugin:
+			if plugin.PType != vdiPlugin {
+				filtered = append(filtered, plugin)
 			}
 		}
-	} else {
-		pluginsSet = append(pluginsSet, plugins...)
 	}
+	return filtered
+}
 
-	return pluginsSet, nil
+// setPluginsLimits sets the limits of the plugins location config to the plugins
+func setPluginsLimits(plugins []*JSPlugin, config cfg.PluginConfig) {
+	for _, plugin := range plugins {
+		plugin.SetLimits(config)
+	}
 }
 
 // LoadPluginsFromRemote loads plugins from a distribution server either on the local net or the
@@ -271,7 +353,7 @@ func LoadPluginsFromRemote(config cfg.PluginConfig) ([]*JSPlugin, error) {
 
 	// Construct the URL to download the plugins from
 	for _, path := range config.Path {
-		fileType := strings.ToLower(strings.TrimSpace(filepath.Ext(path)))
+		fileType := cmn.GetFileExt(path)
 		if fileType != "js" {
 			// Ignore unsupported file types
 			continue
@@ -379,17 +461,29 @@ func NewJSPlugin(script string) *JSPlugin {
 	pVerRegEx := "^//\\s*[@]?version\\s*\\:?\\s*([^\n]+)"
 	pTypeRegEx := "^//\\s*[@]?type\\s*\\:\\s*([^\n]+)"
 	pEventTypeRegEx := "^//\\s*[@]?event_type\\s*\\:\\s*([^\n]+)"
+	pReadOnlyRegEx := "^//\\s*@read_only\\s*\\:?\\s*([^\n]*)"
+	pCapabilitiesRegEx := "^//\\s*@capabilities\\s*\\:?\\s*([^\n]*)"
+	pParamRegEx := "^//\\s*@param\\s*\\:\\s*([^\n]+)"
+	pArgumentsRegEx := "^//\\s*@arguments\\s*\\:\\s*([^\n]+)"
 	re1 := regexp.MustCompile(pNameRegEx)
 	re2 := regexp.MustCompile(pDescRegEx)
 	re3 := regexp.MustCompile(pTypeRegEx)
 	re4 := regexp.MustCompile(pEventTypeRegEx)
 	re5 := regexp.MustCompile(pVerRegEx)
+	re6 := regexp.MustCompile(pReadOnlyRegEx)
+	re7 := regexp.MustCompile(pCapabilitiesRegEx)
+	re8 := regexp.MustCompile(pParamRegEx)
+	re9 := regexp.MustCompile(pArgumentsRegEx)
 	// Extract the "// @name" comment from the script (usually on the first line)
 	pName := ""
 	pDesc := ""
 	pType := vdiPlugin
 	pEventType := ""
 	pVersion := ""
+	pReadOnly := false
+	var pCapabilities []string // nil if not declared
+	var pParams []JSPluginParam
+	pArguments := ArgumentsPositional
 	lines := strings.Split(script, "\n")
 	for _, line := range lines {
 		if re1.MatchString(line) {
@@ -407,15 +501,46 @@ func NewJSPlugin(script string) *JSPlugin {
 		if re5.MatchString(line) {
 			pVersion = strings.TrimSpace(re5.FindStringSubmatch(line)[1])
 		}
+		if re6.MatchString(line) {
+			// "// @read_only" alone means true
+			value := strings.TrimSpace(re6.FindStringSubmatch(line)[1])
+			pReadOnly = value == "" || strings.EqualFold(value, "true") || strings.EqualFold(value, "yes")
+		}
+		if re7.MatchString(line) {
+			// Multiple "// @capabilities" lines are merged
+			if pCapabilities == nil {
+				pCapabilities = []string{}
+			}
+			pCapabilities = append(pCapabilities, parseCapabilities(re7.FindStringSubmatch(line)[1])...)
+		}
+		if re8.MatchString(line) {
+			param, err := parseJSPluginParam(re8.FindStringSubmatch(line)[1])
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "Plugin '%s': %v", pName, err)
+			} else {
+				pParams = append(pParams, param)
+			}
+		}
+		if re9.MatchString(line) {
+			pArguments = strings.ToLower(strings.TrimSpace(re9.FindStringSubmatch(line)[1]))
+			if pArguments != ArgumentsNamed && pArguments != ArgumentsPositional {
+				cmn.DebugMsg(cmn.DbgLvlError, "Plugin '%s': unknown arguments mode '%s', using positional", pName, pArguments)
+				pArguments = ArgumentsPositional
+			}
+		}
 	}
 
 	return &JSPlugin{
-		Name:        pName,
-		Description: pDesc,
-		Version:     pVersion,
-		PType:       pType,
-		Script:      script,
-		EventType:   pEventType,
+		Name:         pName,
+		Description:  pDesc,
+		Version:      pVersion,
+		PType:        pType,
+		Script:       script,
+		EventType:    pEventType,
+		ReadOnly:     pReadOnly,
+		Capabilities: pCapabilities,
+		Params:       pParams,
+		Arguments:    pArguments,
 	}
 }
 
@@ -433,14 +558,14 @@ func execVDIPlugin(p *JSPlugin, timeout int, params map[string]interface{}, wd *
 		errMsg01 = "Error getting result from JS plugin: %v"
 	)
 
-	// Transform params to []interface{}
-	paramsArr := make([]interface{}, 0)
-	for _, v := range params {
-		paramsArr = append(paramsArr, v)
+	// Validate the params and transform them to the script arguments
+	paramsArr, err := p.VDIArgs(params, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	// Setup a timeout for the script
-	err := (*wd).SetAsyncScriptTimeout(time.Duration(timeout) * time.Second)
+	err = (*wd).SetAsyncScriptTimeout(time.Duration(timeout) * time.Second)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlDebug3, errMsg01, err)
 	}
@@ -452,10 +577,18 @@ func execVDIPlugin(p *JSPlugin, timeout int, params map[string]interface{}, wd *
 		return nil, err
 	}
 
-	// Get the result
-	resultMap := cmn.ConvertInfToMap(result)
-
-	return resultMap, nil
+	// Get the result (the WebDriver returns the JSON decoded value)
+	switch resultValue := result.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return resultValue, nil
+	case map[interface{}]interface{}:
+		return cmn.ConvertInfToMap(resultValue), nil
+	default:
+		cmn.DebugMsg(cmn.DbgLvlDebug3, errMsg01, fmt.Errorf("unexpected result type %T", result))
+		return nil, nil
+	}
 }
 
 func execEnginePlugin(p *JSPlugin, timeout int, params map[string]interface{}, db *cdb.Handler) (map[string]interface{}, error) {
@@ -464,19 +597,37 @@ func execEnginePlugin(p *JSPlugin, timeout int, params map[string]interface{}, d
 		errMsg01 = "Error getting result from JS plugin: %v"
 	)
 
-	// Create a new VM
-	vm := otto.New()
+	// Create a new VM (and its event loop)
+	vm := goja.New()
+	loop := newJSEventLoop(vm)
+	defer loop.stop()
 	err := removeJSFunctions(vm)
 	if err != nil {
 		return nil, err
 	}
 
 	// Add CROWler JSAPI to the VM
-	err = setCrowlerJSAPI(vm, db)
+	err = setCrowlerJSAPI(vm, loop, db, p.permissions())
 	if err != nil {
 		return nil, err
 	}
 
+	// Set the operator limits
+	script := p.Script
+	if p.Limits.MaxCallStack > 0 {
+		vm.SetMaxCallStackSize(p.Limits.MaxCallStack)
+	}
+	if p.Limits.MaxSteps > 0 {
+		script, err = limitJSSteps(vm, script, p.Limits.MaxSteps)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.Limits.MaxHeapGrowth > 0 {
+		stopWatch := watchHeapGrowth(vm, uint64(p.Limits.MaxHeapGrowth)<<20)
+		defer stopWatch()
+	}
+
 	// Set the params
 	err = vm.Set("params", params)
 	if err != nil {
@@ -484,45 +635,55 @@ func execEnginePlugin(p *JSPlugin, timeout int, params map[string]interface{}, d
 	}
 	cmn.DebugMsg(cmn.DbgLvlDebug5, "Set params to the VM successfully: %v", params)
 
-	vm.Interrupt = make(chan func(), 1) // Set an interrupt channel
-
-	go func(timeout time.Duration) {
-		time.Sleep(timeout * time.Second) // Wait for the timeout
-		vm.Interrupt <- func() {
-			cmn.DebugMsg(cmn.DbgLvlError, "JavaScript execution timeout")
-		}
-	}(time.Duration(timeout))
+	// Set up the timeout (it interrupts the script and the event loop)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	stopInterrupt := context.AfterFunc(ctx, func() {
+		cmn.DebugMsg(cmn.DbgLvlError, "JavaScript execution timeout")
+		vm.Interrupt("JavaScript execution timeout")
+	})
+	defer stopInterrupt()
 
 	// Run the script
-	rval, err := vm.Run(p.Script)
+	rval, err := vm.RunString(script)
 	if err != nil {
+		var stackErr *goja.StackOverflowError
+		if errors.As(err, &stackErr) {
+			// The engine error has no message
+			return nil, fmt.Errorf("call stack budget exceeded (%d):%v", p.Limits.MaxCallStack, err)
+		}
 		return nil, err
 	}
 
-	// Get the result
-	result, err := vm.Get("result")
-	if err != nil || !result.IsDefined() {
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlDebug3, errMsg01, err)
-		}
+	// Wait for the timers and the asynchronous calls
+	if err := loop.run(ctx); err != nil {
+		return nil, fmt.Errorf("JavaScript execution failed: %v", err)
+	}
+
+	// Get the result (async plugins can return a Promise)
+	result := vm.Get("result")
+	if !jsIsDefined(result) {
 		result = rval
 	}
-	resultMap, err := result.Export()
+	result, err = jsSettled(result)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlDebug3, errMsg01, err)
 		return nil, err
 	}
-	resultValue, ok := resultMap.(map[string]interface{})
+	if result == nil {
+		return nil, nil
+	}
+	resultValue, ok := result.Export().(map[string]interface{})
 	if !ok {
-		cmn.DebugMsg(cmn.DbgLvlDebug3, errMsg01, err)
-		return nil, err
+		cmn.DebugMsg(cmn.DbgLvlDebug3, errMsg01, fmt.Errorf("unexpected result type %T", result.Export()))
+		return nil, nil
 	}
 
 	return resultValue, nil
 }
 
 // removeJSFunctions removes the JS functions from the VM
-func removeJSFunctions(vm *otto.Otto) error {
+func removeJSFunctions(vm *goja.Runtime) error {
 	// We need to keep the following functions:
 	// - "fetch", "WebSocket", "Worker", "SharedWorker"
 	// - "setTimeout", "setInterval", "clearTimeout", "clearInterval"
@@ -549,8 +710,9 @@ func removeJSFunctions(vm *otto.Otto) error {
 		"crypto",
 	}
 
+	global := vm.GlobalObject()
 	for _, functionName := range functionsToRemove {
-		err := vm.Set(functionName, nil)
+		err := global.Delete(functionName)
 		if err != nil {
 			return err
 		}
@@ -559,9 +721,12 @@ func removeJSFunctions(vm *otto.Otto) error {
 	return nil
 }
 
-// setCrowlerJSAPI sets the CROWler JS API functions
-func setCrowlerJSAPI(vm *otto.Otto, db *cdb.Handler) error {
-	// Extends Otto JS VM with CROWler JS API functions
+// setCrowlerJSAPI sets the CROWler JS API functions. The network and DB
+// functions have also a Promise based variant (for example fetchAsync),
+// executed through the loop event loop. Only the functions of the
+// capabilities granted by perm are set.
+func setCrowlerJSAPI(vm *goja.Runtime, loop *jsEventLoop, db *cdb.Handler, perm jsAPIPermissions) error {
+	// Extends the JS VM with CROWler JS API functions
 
 	// Common functions
 
@@ -574,11 +739,13 @@ func setCrowlerJSAPI(vm *otto.Otto, db *cdb.Handler) error {
 	if err := addJSAPIISODate(vm); err != nil {
 		return err
 	}
-	if err := addJSAPISetTimeout(vm); err != nil {
+	if err := addJSAPISetTimeout(vm, loop); err != nil {
 		return err
 	}
-	if err := addJSAPILoadLocalFile(vm); err != nil {
-		return err
+	if perm.allows(CapabilityFiles) {
+		if err := addJSAPILoadLocalFile(vm); err != nil {
+			return err
+		}
 	}
 	if err := addJSAPIGenUUID(vm); err != nil {
 		return err
@@ -592,44 +759,55 @@ func setCrowlerJSAPI(vm *otto.Otto, db *cdb.Handler) error {
 
 	// API and Web functions
 
-	if err := addJSHTTPRequest(vm); err != nil {
-		return err
-	}
-	if err := addJSAPIClient(vm); err != nil {
-		return err
-	}
-	if err := addJSAPIFetch(vm); err != nil {
-		return err
+	if perm.allows(CapabilityHTTP) {
+		if err := addJSHTTPRequest(vm, loop, perm.allowedHosts); err != nil {
+			return err
+		}
+		if err := addJSAPIClient(vm, loop, perm.allowedHosts); err != nil {
+			return err
+		}
+		if err := addJSAPIFetch(vm, loop, perm.allowedHosts); err != nil {
+			return err
+		}
 	}
 
 	// CROWler Events API functions
 
-	if err := addJSAPICreateEvent(vm, db); err != nil {
-		return err
-	}
-	if err := addJSAPIScheduleEvent(vm, db); err != nil {
-		return err
+	if perm.allows(CapabilityEvents) {
+		if err := addJSAPICreateEvent(vm, loop, db); err != nil {
+			return err
+		}
+		if err := addJSAPIScheduleEvent(vm, loop, db); err != nil {
+			return err
+		}
 	}
 
 	// CROWler DB API functions
 
-	if err := addJSAPIRunQuery(vm, db); err != nil {
-		return err
-	}
-	if err := addJSAPICreateSource(vm, db); err != nil {
-		return err
-	}
-	if err := addJSAPIRemoveSource(vm, db); err != nil {
-		return err
+	if perm.allows(CapabilityDB) {
+		if err := addJSAPIRunQuery(vm, loop, db, perm.readOnly); err != nil {
+			return err
+		}
 	}
-	if err := addJSAPIVacuumSource(vm, db); err != nil {
-		return err
+	if !perm.readOnly && perm.allows(CapabilitySources) {
+		// The sources management functions modify the DB
+		if err := addJSAPICreateSource(vm, loop, db); err != nil {
+			return err
+		}
+		if err := addJSAPIRemoveSource(vm, loop, db); err != nil {
+			return err
+		}
+		if err := addJSAPIVacuumSource(vm, loop, db); err != nil {
+			return err
+		}
 	}
 
 	// External DBs interaction functions
 
-	if err := addJSAPIExternalDBQuery(vm); err != nil {
-		return err
+	if perm.allows(CapabilityExternalDB) {
+		if err := addJSAPIExternalDBQuery(vm, loop); err != nil {
+			return err
+		}
 	}
 
 	// Data conversion functions
@@ -671,27 +849,29 @@ func setCrowlerJSAPI(vm *otto.Otto, db *cdb.Handler) error {
 	return nil
 }
 
-// addJSHTTPRequest adds the httpRequest function to the VM
-func addJSHTTPRequest(vm *otto.Otto) error {
-	// Register the fetch function
-	err := vm.Set("httpRequest", func(call otto.FunctionCall) otto.Value {
-		url, _ := call.Argument(0).ToString()
+// addJSHTTPRequest adds the httpRequest function (and httpRequestAsync) to the VM
+func addJSHTTPRequest(vm *goja.Runtime, loop *jsEventLoop, allowedHosts []string) error {
+	// Register the httpRequest function
+	return setHostFunction(vm, loop, vm.GlobalObject(), "httpRequest", func(call goja.FunctionCall) (*jsHostCall, error) {
+		url := call.Argument(0).String()
 
-		// Make the HTTP request
-		resp, err := http.Get(url) //nolint:gosec // We are not using user input here
-		if err != nil {
-			return otto.Value{}
-		}
-		defer resp.Body.Close() //nolint:errcheck // We can't check error here it's a defer
-
-		body, _ := io.ReadAll(resp.Body)
+		return &jsHostCall{work: func() (interface{}, error) {
+			// Make the HTTP request
+			if err := checkJSURL(url, allowedHosts); err != nil {
+				return nil, err
+			}
+			resp, err := newJSHTTPClient(0, allowedHosts).Get(url)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close() //nolint:errcheck // We can't check error here it's a defer
 
-		// Return the response as a string
-		result, _ := vm.ToValue(string(body))
+			body, _ := io.ReadAll(resp.Body)
 
-		return result
+			// Return the response as a string
+			return string(body), nil
+		}}, nil
 	})
-	return err
 }
 
 // addJSAPIClient adds the apiClient function to the VM
@@ -730,33 +910,26 @@ func addJSHTTPRequest(vm *otto.Otto) error {
 	console.log(response.body);
 
 */
-func addJSAPIClient(vm *otto.Otto) error {
-	apiClientObject, _ := vm.Object(`({})`)
+func addJSAPIClient(vm *goja.Runtime, loop *jsEventLoop, allowedHosts []string) error {
+	apiClientObject := vm.NewObject()
 
 	// Define the "post" method
-	err := apiClientObject.Set("post", func(call otto.FunctionCall) otto.Value {
+	err := setHostFunction(vm, loop, apiClientObject, "post", func(call goja.FunctionCall) (*jsHostCall, error) {
 		// Get the URL (first argument)
-		url, _ := call.Argument(0).ToString()
+		url := call.Argument(0).String()
 
 		// Get the request object (second argument)
 		requestArg := call.Argument(1)
-		if !requestArg.IsDefined() {
+		if !jsIsDefined(requestArg) {
 			fmt.Println("Request argument is undefined.")
-			return otto.UndefinedValue()
-		}
-
-		// Export the request object
-		request, err := requestArg.Export()
-		if err != nil {
-			fmt.Printf("Error exporting request object: %v\n", err)
-			return otto.UndefinedValue()
+			return nil, fmt.Errorf("request argument is undefined")
 		}
 
-		// Type assert the exported request as a map
-		reqMap, ok := request.(map[string]interface{})
+		// Export the request object and type assert it as a map
+		reqMap, ok := requestArg.Export().(map[string]interface{})
 		if !ok {
 			fmt.Println("Request object is not a valid map.")
-			return otto.UndefinedValue()
+			return nil, fmt.Errorf("request object is not a valid map")
 		}
 
 		// Extract headers, body, and timeout from the request object
@@ -765,162 +938,126 @@ func addJSAPIClient(vm *otto.Otto) error {
 			headers, _ = h.(map[string]interface{}) // Type assert headers
 		}
 
-		var body io.Reader
+		var body []byte
 		if b, exists := reqMap["body"]; exists {
 			if bodyString, ok := b.(string); ok {
-				body = strings.NewReader(bodyString) // Handle as pre-serialized JSON
+				body = []byte(bodyString) // Handle as pre-serialized JSON
 			} else {
 				bodyBytes, err := json.Marshal(b) // Serialize object to JSON
 				if err != nil {
 					fmt.Printf("Error marshaling body: %v\n", err)
-					return otto.UndefinedValue()
+					return nil, err
 				}
-				body = bytes.NewReader(bodyBytes)
+				body = bodyBytes
 			}
 		}
 
 		var timeoutMs int64 = 30000 // Default timeout
 		if t, exists := reqMap["timeout"]; exists {
-			if timeoutFloat, ok := t.(float64); ok { // Otto exports numbers as float64
+			if timeoutFloat, ok := jsNumber(t); ok {
 				timeoutMs = int64(timeoutFloat)
 			}
 		}
 		timeout := time.Duration(timeoutMs) * time.Millisecond
 
-		// Set up HTTP client with timeout
-		client := &http.Client{Timeout: timeout}
-
-		// Create the HTTP request
-		req, err := http.NewRequest("POST", url, body)
-		if err != nil {
-			fmt.Printf("Error creating request: %v\n", err)
-			return otto.UndefinedValue()
-		}
+		return &jsHostCall{
+			work: func() (interface{}, error) {
+				// Set up HTTP client with timeout
+				client := newJSHTTPClient(timeout, allowedHosts)
 
-		// Add headers to the request
-		if len(headers) > 0 {
-			for key, value := range headers {
-				if headerValue, ok := value.(string); ok {
-					req.Header.Set(key, headerValue)
+				// Create the HTTP request
+				var bodyReader io.Reader
+				if body != nil {
+					bodyReader = bytes.NewReader(body)
+				}
+				req, err := http.NewRequest("POST", url, bodyReader)
+				if err != nil {
+					fmt.Printf("Error creating request: %v\n", err)
+					return nil, err
 				}
-			}
-		}
-
-		// output the object for debugging purposes:
-		cmn.DebugMsg(cmn.DbgLvlDebug5, "Request object:", req)
-
-		resp, err := client.Do(req)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "making request:", err)
-			return otto.UndefinedValue()
-		}
-		defer resp.Body.Close() //nolint:errcheck // We can't check error here it's a defer
 
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "reading response body:", err)
-			return otto.UndefinedValue()
-		}
+				// Add headers to the request
+				if len(headers) > 0 {
+					for key, value := range headers {
+						if headerValue, ok := value.(string); ok {
+							req.Header.Set(key, headerValue)
+						}
+					}
+				}
 
-		respObject, _ := vm.Object(`({})`)
-		err = respObject.Set("status", resp.StatusCode)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "setting status:", err)
-		}
-		err = respObject.Set("headers", resp.Header)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "setting headers:", err)
-		}
-		err = respObject.Set("body", string(respBody))
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "setting body:", err)
-		}
+				// output the object for debugging purposes:
+				cmn.DebugMsg(cmn.DbgLvlDebug5, "Request object:", req)
 
-		return respObject.Value()
+				if err := checkJSHost(req.URL, allowedHosts); err != nil {
+					return nil, err
+				}
+				return doAPIClientRequest(client, req)
+			},
+			build: func(result interface{}, _ bool) goja.Value {
+				return apiClientResponse(vm, result.(*jsHTTPResponse))
+			},
+		}, nil
 	})
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "setting post method:", err)
 	}
 
 	// Define the "get" method
-	err = apiClientObject.Set("get", func(call otto.FunctionCall) otto.Value {
+	err = setHostFunction(vm, loop, apiClientObject, "get", func(call goja.FunctionCall) (*jsHostCall, error) {
 		// Get the URL (first argument)
-		url, _ := call.Argument(0).ToString()
+		url := call.Argument(0).String()
 
 		// Get the request options object (second argument)
 		requestArg := call.Argument(1)
 		var headers map[string]string
 		var timeoutMs int64 = 30000 // Default timeout
 
-		if requestArg.IsDefined() {
-			reqMap, err := requestArg.Export()
-			if err == nil {
-				// Extract headers
-				if h, exists := reqMap.(map[string]interface{})["headers"]; exists {
-					headersInterface, _ := h.(map[string]interface{})
-					headers = make(map[string]string)
-					for k, v := range headersInterface {
-						if vStr, ok := v.(string); ok {
-							headers[k] = vStr
-						}
+		if reqMap, ok := requestArg.Export().(map[string]interface{}); ok {
+			// Extract headers
+			if h, exists := reqMap["headers"]; exists {
+				headersInterface, _ := h.(map[string]interface{})
+				headers = make(map[string]string)
+				for k, v := range headersInterface {
+					if vStr, ok := v.(string); ok {
+						headers[k] = vStr
 					}
 				}
-				// Extract timeout
-				if t, exists := reqMap.(map[string]interface{})["timeout"]; exists {
-					if timeoutFloat, ok := t.(float64); ok { // Otto exports numbers as float64
-						timeoutMs = int64(timeoutFloat)
-					}
+			}
+			// Extract timeout
+			if t, exists := reqMap["timeout"]; exists {
+				if timeoutFloat, ok := jsNumber(t); ok {
+					timeoutMs = int64(timeoutFloat)
 				}
 			}
 		}
 
-		// Set up HTTP client with timeout
-		timeout := time.Duration(timeoutMs) * time.Millisecond
-		client := &http.Client{Timeout: timeout}
+		return &jsHostCall{
+			work: func() (interface{}, error) {
+				// Set up HTTP client with timeout
+				timeout := time.Duration(timeoutMs) * time.Millisecond
+				client := newJSHTTPClient(timeout, allowedHosts)
 
-		// Create the HTTP request
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error creating GET request:", err)
-			return otto.UndefinedValue()
-		}
-
-		// Add headers to the request
-		for key, value := range headers {
-			req.Header.Set(key, value)
-		}
-
-		// Execute the request
-		resp, err := client.Do(req)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error executing GET request:", err)
-			return otto.UndefinedValue()
-		}
-		defer resp.Body.Close() //nolint:errcheck // We can't check error here it's a defer
-
-		// Read response body
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error reading GET response body:", err)
-			return otto.UndefinedValue()
-		}
+				// Create the HTTP request
+				req, err := http.NewRequest("GET", url, nil)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "Error creating GET request:", err)
+					return nil, err
+				}
 
-		// Create response object for JavaScript
-		respObject, _ := vm.Object(`({})`)
-		err = respObject.Set("status", resp.StatusCode)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error setting status in response object:", err)
-		}
-		err = respObject.Set("headers", resp.Header)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error setting headers in response object:", err)
-		}
-		err = respObject.Set("body", string(respBody))
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error setting body in response object:", err)
-		}
+				// Add headers to the request
+				for key, value := range headers {
+					req.Header.Set(key, value)
+				}
 
-		return respObject.Value()
+				if err := checkJSHost(req.URL, allowedHosts); err != nil {
+					return nil, err
+				}
+				return doAPIClientRequest(client, req)
+			},
+			build: func(result interface{}, _ bool) goja.Value {
+				return apiClientResponse(vm, result.(*jsHTTPResponse))
+			},
+		}, nil
 	})
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "setting get method:", err)
@@ -929,6 +1066,57 @@ func addJSAPIClient(vm *otto.Otto) error {
 	return vm.Set("apiClient", apiClientObject)
 }
 
+// jsHTTPResponse is the response of an HTTP request made by a JS host function
+type jsHTTPResponse struct {
+	StatusCode int
+	Status     string
+	URL        string
+	Header     http.Header
+	Body       []byte
+}
+
+// doAPIClientRequest executes an apiClient request
+func doAPIClientRequest(client *http.Client, req *http.Request) (*jsHTTPResponse, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "making request:", err)
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check error here it's a defer
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "reading response body:", err)
+		return nil, err
+	}
+
+	return &jsHTTPResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		URL:        resp.Request.URL.String(),
+		Header:     resp.Header,
+		Body:       respBody,
+	}, nil
+}
+
+// apiClientResponse returns the JS object for an apiClient response
+func apiClientResponse(vm *goja.Runtime, resp *jsHTTPResponse) goja.Value {
+	respObject := vm.NewObject()
+	err := respObject.Set("status", resp.StatusCode)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "setting status:", err)
+	}
+	err = respObject.Set("headers", resp.Header)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "setting headers:", err)
+	}
+	err = respObject.Set("body", string(resp.Body))
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "setting body:", err)
+	}
+	return respObject
+}
+
 // addJSAPIFetch adds the fetch function to the VM
 /* Usage in javascript:
 // Make a GET request to the specified URL
@@ -938,186 +1126,191 @@ console.log(response.status);
 console.log(response.statusText);
 console.log(response.url);
 console.log(response.headers);
-response.text().then(text => console.log(text));
-response.json().then(json => console.log(json));
+console.log(response.text());
+console.log(response.json());
+
+// fetchAsync returns a Promise (and so do text() and json() of its response)
+const response = await fetchAsync("https://api.example.com/v1/resource");
+const data = await response.json();
 */
-func addJSAPIFetch(vm *otto.Otto) error {
+func addJSAPIFetch(vm *goja.Runtime, loop *jsEventLoop, allowedHosts []string) error {
 	// Implement the fetch function
-	err := vm.Set("fetch", func(call otto.FunctionCall) otto.Value {
+	return setHostFunction(vm, loop, vm.GlobalObject(), "fetch", func(call goja.FunctionCall) (*jsHostCall, error) {
 		// Extract arguments
-		url, err := call.Argument(0).ToString()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: converting URL argument to string:", err)
-			return otto.UndefinedValue()
-		}
+		url := call.Argument(0).String()
 
 		options := call.Argument(1)
 		method := httpMethodGet
 		headers := make(map[string]string)
-		var body io.Reader
-
-		if options.IsObject() {
-			optionsObj := options.Object()
+		var body *string
 
+		if optionsObj, ok := options.(*goja.Object); ok {
 			// Extract method
-			methodVal, err := optionsObj.Get("method")
-			if err == nil && methodVal.IsString() {
-				method, _ = methodVal.ToString()
+			methodVal := optionsObj.Get("method")
+			if jsIsKind(methodVal, reflect.String) {
+				method = methodVal.String()
 			}
 
 			// Extract headers
-			headersVal, err := optionsObj.Get("headers")
-			if err == nil && headersVal.IsObject() {
-				headersObj := headersVal.Object()
+			if headersObj, ok := optionsObj.Get("headers").(*goja.Object); ok {
 				for _, key := range headersObj.Keys() {
-					value, err := headersObj.Get(key)
-					if err != nil {
-						cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: getting header value for key", key, ":", err)
+					value := headersObj.Get(key)
+					if value == nil {
+						cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: getting header value for key", key)
 						continue
 					}
-					valueStr, err := value.ToString()
-					if err != nil {
-						cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: Header value for key", key, "is not a string:", err)
-						continue
-					}
-					headers[key] = valueStr
+					headers[key] = value.String()
 				}
 			}
 
 			// Extract body
-			bodyVal, err := optionsObj.Get("body")
-			if err == nil && bodyVal.IsDefined() {
-				bodyStr, err := bodyVal.ToString()
-				if err != nil {
-					cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: converting body to string:", err)
-				} else {
-					body = strings.NewReader(bodyStr)
-				}
+			bodyVal := optionsObj.Get("body")
+			if jsIsDefined(bodyVal) {
+				bodyStr := bodyVal.String()
+				body = &bodyStr
 			}
 		}
 
-		// Create the request
-		req, err := http.NewRequest(method, url, body)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: creating request:", err)
-			return otto.UndefinedValue()
-		}
+		return &jsHostCall{
+			work: func() (interface{}, error) {
+				// Create the request
+				var bodyReader io.Reader
+				if body != nil {
+					bodyReader = strings.NewReader(*body)
+				}
+				req, err := http.NewRequest(method, url, bodyReader)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: creating request:", err)
+					return nil, err
+				}
 
-		// Set headers
-		for key, value := range headers {
-			req.Header.Set(key, value)
-		}
+				// Set headers
+				for key, value := range headers {
+					req.Header.Set(key, value)
+				}
 
-		// Make the HTTP request
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: making HTTP request:", err)
-			return otto.UndefinedValue()
-		}
-		defer resp.Body.Close() //nolint:errcheck // We can't check error here it's a defer
+				// Make the HTTP request
+				if err := checkJSHost(req.URL, allowedHosts); err != nil {
+					return nil, err
+				}
+				client := newJSHTTPClient(0, allowedHosts)
+				resp, err := client.Do(req)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: making HTTP request:", err)
+					return nil, err
+				}
+				defer resp.Body.Close() //nolint:errcheck // We can't check error here it's a defer
 
-		// Read the response body
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: reading response body:", err)
-			return otto.UndefinedValue()
-		}
+				// Read the response body
+				respBody, err := io.ReadAll(resp.Body)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: reading response body:", err)
+					return nil, err
+				}
 
-		// Build the response object
-		respObject, err := vm.Object(`({})`)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: creating response object:", err)
-			return otto.UndefinedValue()
-		}
+				return &jsHTTPResponse{
+					StatusCode: resp.StatusCode,
+					Status:     resp.Status,
+					URL:        resp.Request.URL.String(),
+					Header:     resp.Header,
+					Body:       respBody,
+				}, nil
+			},
+			build: func(result interface{}, async bool) goja.Value {
+				return fetchResponse(vm, result.(*jsHTTPResponse), async)
+			},
+		}, nil
+	})
+}
 
-		err = respObject.Set("ok", resp.StatusCode >= 200 && resp.StatusCode < 300)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting ok:", err)
-		}
-		err = respObject.Set("status", resp.StatusCode)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting status:", err)
-		}
-		err = respObject.Set("statusText", resp.Status)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting statusText:", err)
-		}
-		err = respObject.Set("url", resp.Request.URL.String())
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting url:", err)
-		}
+// fetchResponse returns the JS object for a fetch response. For fetchAsync
+// (async) the text() and json() methods return a Promise.
+func fetchResponse(vm *goja.Runtime, resp *jsHTTPResponse, async bool) goja.Value {
+	// Build the response object
+	respObject := vm.NewObject()
 
-		// Set headers
-		headersObj, err := vm.Object(`({})`)
+	err := respObject.Set("ok", resp.StatusCode >= 200 && resp.StatusCode < 300)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting ok:", err)
+	}
+	err = respObject.Set("status", resp.StatusCode)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting status:", err)
+	}
+	err = respObject.Set("statusText", resp.Status)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting statusText:", err)
+	}
+	err = respObject.Set("url", resp.URL)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting url:", err)
+	}
+
+	// Set headers
+	headersObj := vm.NewObject()
+	for key, values := range resp.Header {
+		err = headersObj.Set(key, strings.Join(values, ","))
 		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: creating headers object:", err)
-		} else {
-			for key, values := range resp.Header {
-				err = headersObj.Set(key, strings.Join(values, ","))
-				if err != nil {
-					cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting header value for key", key, ":", err)
-				}
-			}
-			err = respObject.Set("headers", headersObj)
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting headers:", err)
-			}
+			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting header value for key", key, ":", err)
 		}
+	}
+	err = respObject.Set("headers", headersObj)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting headers:", err)
+	}
 
-		responseBody := string(respBody)
+	responseBody := string(resp.Body)
 
-		// Implement text() method
-		err = respObject.Set("text", func(otto.FunctionCall) otto.Value {
-			result, err := vm.ToValue(responseBody)
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: converting response body to value:", err)
-				return otto.UndefinedValue()
-			}
-			return result
-		})
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting text method:", err)
+	// Implement text() method
+	err = respObject.Set("text", func(goja.FunctionCall) goja.Value {
+		if async {
+			return jsResolved(vm, responseBody)
 		}
+		return vm.ToValue(responseBody)
+	})
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting text method:", err)
+	}
 
-		// Implement json() method
-		err = respObject.Set("json", func(otto.FunctionCall) otto.Value {
-			var jsonData interface{}
-			err := json.Unmarshal(respBody, &jsonData)
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: parsing JSON response:", err)
-				return otto.UndefinedValue()
-			}
-			result, err := vm.ToValue(jsonData)
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: converting JSON data to value:", err)
-				return otto.UndefinedValue()
-			}
-			return result
-		})
+	// Implement json() method
+	err = respObject.Set("json", func(goja.FunctionCall) goja.Value {
+		var jsonData interface{}
+		err := json.Unmarshal(resp.Body, &jsonData)
 		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting json method:", err)
+			cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: parsing JSON response:", err)
+			if async {
+				promise, _, reject := vm.NewPromise()
+				_ = reject(vm.NewGoError(err))
+				return vm.ToValue(promise)
+			}
+			return goja.Undefined()
 		}
-
-		return respObject.Value()
+		if async {
+			return jsResolved(vm, jsonData)
+		}
+		return vm.ToValue(jsonData)
 	})
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "EngineJS: setting json method:", err)
+	}
 
-	return err
+	return respObject
 }
 
-func addJSAPIConsoleLog(vm *otto.Otto) error {
+func addJSAPIConsoleLog(vm *goja.Runtime) error {
 	// Implement the console object with log method
-	console, err := vm.Object(`console = {}`)
+	console := vm.NewObject()
+	err := vm.Set("console", console)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Error creating console object:", err)
 		return err
 	}
 
 	// Implement console.log
-	err = console.Set("log", func(call otto.FunctionCall) otto.Value {
+	err = console.Set("log", func(call goja.FunctionCall) goja.Value {
 		message := formatConsoleLog(extractArguments(call))
 		cmn.DebugMsg(cmn.DbgLvlInfo, message)
-		return otto.UndefinedValue()
+		return goja.Undefined()
 	})
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Error setting console.log function:", err)
@@ -1125,10 +1318,10 @@ func addJSAPIConsoleLog(vm *otto.Otto) error {
 	}
 
 	// Implement console.error
-	err = console.Set("error", func(call otto.FunctionCall) otto.Value {
+	err = console.Set("error", func(call goja.FunctionCall) goja.Value {
 		message := formatConsoleLog(extractArguments(call))
 		cmn.DebugMsg(cmn.DbgLvlError, message)
-		return otto.UndefinedValue()
+		return goja.Undefined()
 	})
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Error setting console.error function:", err)
@@ -1136,10 +1329,10 @@ func addJSAPIConsoleLog(vm *otto.Otto) error {
 	}
 
 	// Optionally implement console.warn
-	err = console.Set("warn", func(call otto.FunctionCall) otto.Value {
+	err = console.Set("warn", func(call goja.FunctionCall) goja.Value {
 		message := formatConsoleLog(extractArguments(call))
 		cmn.DebugMsg(cmn.DbgLvlWarn, message)
-		return otto.UndefinedValue()
+		return goja.Undefined()
 	})
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Error setting console.warn function:", err)
@@ -1184,15 +1377,10 @@ func NormalizeValues(value interface{}) interface{} {
 }
 
 // Helper function to extract arguments
-func extractArguments(call otto.FunctionCall) []interface{} {
+func extractArguments(call goja.FunctionCall) []interface{} {
 	var args []interface{}
-	for _, arg := range call.ArgumentList {
-		value, err := arg.Export()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error exporting argument:", err)
-			continue
-		}
-		args = append(args, value)
+	for _, arg := range call.Arguments {
+		args = append(args, arg.Export())
 	}
 	return args
 }
@@ -1220,121 +1408,89 @@ func formatConsoleLog(args []interface{}) string {
 }
 
 // adds a way for a plugin to run a DB query and get the results as a JSON document, for example:
-// let result = runQuery("SELECT * FROM users WHERE id = ?", [42]);
-// console.log(JSON.parse(result)); // Parses the JSON string into a JavaScript object
-func addJSAPIRunQuery(vm *otto.Otto, db *cdb.Handler) error {
+// let result = runQuery("SELECT * FROM users WHERE id = $1", [42]);
+// let result = runQuery("SELECT * FROM users WHERE id = :id", {id: 42});
+// let result = await runQueryAsync("SELECT * FROM users WHERE id = :id", {id: 42});
+// The result is an array of rows (objects with the column names as keys),
+// followed by an object with the number of rows ({"rows": n}).
+// In read-only plugins only read queries are accepted.
+func addJSAPIRunQuery(vm *goja.Runtime, loop *jsEventLoop, db *cdb.Handler, readOnly bool) error {
 	// Implement the runQuery function
-	err := vm.Set("runQuery", func(call otto.FunctionCall) otto.Value {
+	return setHostFunction(vm, loop, vm.GlobalObject(), "runQuery", func(call goja.FunctionCall) (*jsHostCall, error) {
 		// Extract the query and arguments from the JavaScript call
-		query, err := call.Argument(0).ToString()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "extracting query from JavaScript call:", err)
-			return otto.UndefinedValue()
+		query := call.Argument(0).String()
+
+		if db == nil || *db == nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "runQuery: no database available")
+			return nil, fmt.Errorf("no database available")
 		}
 
 		argsArray := call.Argument(1)
 		var args []interface{}
-		if argsArray.IsObject() {
-			argsObj, err := argsArray.Export()
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "Error exporting query arguments: %v", err)
-				return otto.UndefinedValue()
-			}
-
-			var argsSlice []interface{}
-			var ok bool
-			argsSlice, ok = argsObj.([]interface{})
-			if !ok {
-				// If the arguments are not an array, convert them to a slice
-				argsSlice = append(argsSlice, argsObj)
-			}
-
-			// Process arguments from the JavaScript array
-			for _, arg := range argsSlice {
-				switch v := arg.(type) {
-				case float64:
-					args = append(args, int64(v)) // Convert to int64
-				case []interface{}: // Handle nested slices
-					args = append(args, v...)
-				case []uint64: // Flatten uint64 slices
-					for _, nested := range v {
-						args = append(args, nested)
+		if jsIsObject(argsArray) {
+			switch v := argsArray.Export().(type) {
+			case map[string]interface{}:
+				// Named arguments
+				named := make(map[string]interface{}, len(v))
+				for k, arg := range v {
+					named[k] = jsQueryArg(arg)
+				}
+				var err error
+				query, args, err = cdb.BindNamedParams((*db).DBMS(), query, named)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "binding query arguments: %v", err)
+					return nil, err
+				}
+			default:
+				rv := reflect.ValueOf(v)
+				if rv.Kind() != reflect.Slice {
+					// If the arguments are not an array, use them as the only argument
+					args = append(args, jsQueryArg(v))
+					break
+				}
+				// Process arguments from the JavaScript array
+				for i := 0; i < rv.Len(); i++ {
+					arg := rv.Index(i).Interface()
+					nested := reflect.ValueOf(arg)
+					if nested.Kind() == reflect.Slice && nested.Type().Elem().Kind() != reflect.Uint8 {
+						// Handle nested slices
+						for j := 0; j < nested.Len(); j++ {
+							args = append(args, jsQueryArg(nested.Index(j).Interface()))
+						}
+						continue
 					}
-				default:
-					args = append(args, v)
+					args = append(args, jsQueryArg(arg))
 				}
 			}
 		}
 
-		// Run the query using the provided db handler and arguments
-		rows, err := (*db).ExecuteQuery(query, args...)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "executing query:", err)
-			return otto.UndefinedValue()
-		}
-		defer rows.Close() //nolint:errcheck // We can't check error here it's a defer
-
-		// Get the columns from the query result
-		columns, err := rows.Columns()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "getting columns from query result:", err)
-			return otto.UndefinedValue()
-		}
-
-		// Prepare the result slice
-		result := make([]map[string]interface{}, 0)
-
-		// Iterate over the rows
-		var length uint64
-		for rows.Next() {
-			// Create a map for the row
-			row := make(map[string]interface{})
-			values := make([]interface{}, len(columns))
-			valuePtrs := make([]interface{}, len(columns))
-			for i := range columns {
-				valuePtrs[i] = &values[i]
-			}
-
-			// Scan the row into value pointers
-			if err := rows.Scan(valuePtrs...); err != nil {
-				return otto.UndefinedValue()
+		return &jsHostCall{work: func() (interface{}, error) {
+			// Run the query using the provided db handler and arguments
+			qResult, err := cdb.RunQuery(db, query, args, readOnly)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "executing query: %v", err)
+				return nil, err
 			}
 
-			// Map the column names to values
-			for i, col := range columns {
-				val := values[i]
-				if b, ok := val.([]byte); ok {
-					row[col] = string(b)
-				} else {
-					row[col] = val
-				}
+			// Prepare the result slice
+			result := make([]interface{}, 0, qResult.RowCount+1)
+			for _, row := range qResult.Rows {
+				result = append(result, row)
 			}
-
-			// Append the row to the result
-			result = append(result, row)
-			length++
-		}
-		// Let's add a field to the result to indicate the number of rows returned
-		result = append(result, map[string]interface{}{"rows": length})
-
-		// Convert the result to JSON
-		_, err = json.Marshal(result)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "marshaling query result to JSON:", err)
-			return otto.UndefinedValue()
-		}
-
-		// Convert the JSON string to a JavaScript-compatible value
-		jsResult, err := vm.ToValue(result)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "converting JSON result to JS value:", err)
-			return otto.UndefinedValue()
-		}
-		//cmn.DebugMsg(cmn.DbgLvlDebug3, "JSON result: %s", jsResult.String())
-
-		return jsResult
+			// Let's add a field to the result to indicate the number of rows returned
+			result = append(result, map[string]interface{}{"rows": uint64(qResult.RowCount)})
+			return result, nil
+		}}, nil
 	})
-	return err
+}
+
+// jsQueryArg converts a JS query argument for the DB driver (JS numbers are
+// float64, integer values are passed as int64)
+func jsQueryArg(arg interface{}) interface{} {
+	if f, ok := arg.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return arg
 }
 
 /*
@@ -1349,33 +1505,25 @@ func addJSAPIRunQuery(vm *otto.Otto, db *cdb.Handler) error {
 		);
 		console.log(result); // Prints a JSON document with the event details
 */
-func addJSAPICreateEvent(vm *otto.Otto, db *cdb.Handler) error {
-	err := vm.Set("createEvent", func(call otto.FunctionCall) otto.Value {
+func addJSAPICreateEvent(vm *goja.Runtime, loop *jsEventLoop, db *cdb.Handler) error {
+	return setHostFunction(vm, loop, vm.GlobalObject(), "createEvent", func(call goja.FunctionCall) (*jsHostCall, error) {
 		// Extract arguments from JavaScript call
-		eventType, err := call.Argument(0).ToString()
-		if err != nil || strings.TrimSpace(eventType) == "" {
-			return otto.UndefinedValue() // Event type is mandatory
+		eventType := jsArgString(call, 0)
+		if strings.TrimSpace(eventType) == "" {
+			return nil, fmt.Errorf("event type is mandatory")
 		}
 
-		sourceIDraw, err := call.Argument(1).ToInteger()
-		if err != nil {
-			return otto.UndefinedValue() // Source ID is mandatory
+		if !jsIsDefined(call.Argument(1)) {
+			return nil, fmt.Errorf("source ID is mandatory")
 		}
-		sourceID := uint64(sourceIDraw) //nolint:gosec // We are not using end-user input here
+		sourceID := uint64(call.Argument(1).ToInteger()) //nolint:gosec // We are not using end-user input here
 
-		severity, err := call.Argument(2).ToString()
-		if err != nil || strings.TrimSpace(severity) == "" {
+		severity := jsArgString(call, 2)
+		if strings.TrimSpace(severity) == "" {
 			severity = cdb.EventSeverityInfo // Default severity
 		}
 
-		detailsArg := call.Argument(3)
-		var details map[string]interface{}
-		if detailsArg.IsObject() {
-			detailsObj, err := detailsArg.Export()
-			if err == nil {
-				details, _ = detailsObj.(map[string]interface{})
-			}
-		}
+		details, _ := call.Argument(3).Export().(map[string]interface{})
 		if details == nil {
 			details = make(map[string]interface{}) // Default empty details
 		}
@@ -1388,21 +1536,21 @@ func addJSAPICreateEvent(vm *otto.Otto, db *cdb.Handler) error {
 			Details:  details,
 		}
 
-		// Insert the event into the database
-		eID, err := cdb.CreateEvent(db, event)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "inserting event into database: %v", err)
-			return otto.UndefinedValue()
-		}
+		return &jsHostCall{work: func() (interface{}, error) {
+			// Insert the event into the database
+			eID, err := cdb.CreateEvent(db, event)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "inserting event into database: %v", err)
+				return nil, err
+			}
 
-		// Return success status
-		success, _ := vm.ToValue(map[string]interface{}{
-			"status":  "success",
-			"eventID": eID,
-		})
-		return success
+			// Return success status
+			return map[string]interface{}{
+				"status":  "success",
+				"eventID": eID,
+			}, nil
+		}}, nil
 	})
-	return err
 }
 
 /*
@@ -1422,46 +1570,35 @@ let result = scheduleEvent(
 );
 console.log(result); // Prints a JSON document with the scheduling status
 */
-func addJSAPIScheduleEvent(vm *otto.Otto, db *cdb.Handler) error {
-	err := vm.Set("scheduleEvent", func(call otto.FunctionCall) otto.Value {
+func addJSAPIScheduleEvent(vm *goja.Runtime, loop *jsEventLoop, db *cdb.Handler) error {
+	return setHostFunction(vm, loop, vm.GlobalObject(), "scheduleEvent", func(call goja.FunctionCall) (*jsHostCall, error) {
 		// Extract arguments from JavaScript call
-		eventType, err := call.Argument(0).ToString()
-		if err != nil || strings.TrimSpace(eventType) == "" {
-			return otto.UndefinedValue() // Event type is mandatory
+		eventType := jsArgString(call, 0)
+		if strings.TrimSpace(eventType) == "" {
+			return nil, fmt.Errorf("event type is mandatory")
 		}
 
-		sourceIDraw, err := call.Argument(1).ToInteger()
-		if err != nil {
-			return otto.UndefinedValue() // Source ID is mandatory
+		if !jsIsDefined(call.Argument(1)) {
+			return nil, fmt.Errorf("source ID is mandatory")
 		}
-		sourceID := uint64(sourceIDraw) //nolint:gosec // We are not using end-user input here
+		sourceID := uint64(call.Argument(1).ToInteger()) //nolint:gosec // We are not using end-user input here
 
-		severity, err := call.Argument(2).ToString()
-		if err != nil || strings.TrimSpace(severity) == "" {
+		severity := jsArgString(call, 2)
+		if strings.TrimSpace(severity) == "" {
 			severity = cdb.EventSeverityInfo // Default severity
 		}
 
-		detailsArg := call.Argument(3)
-		var details map[string]interface{}
-		if detailsArg.IsObject() {
-			detailsObj, err := detailsArg.Export()
-			if err == nil {
-				details, _ = detailsObj.(map[string]interface{})
-			}
-		}
+		details, _ := call.Argument(3).Export().(map[string]interface{})
 		if details == nil {
 			details = make(map[string]interface{}) // Default empty details
 		}
 
-		scheduleTimeArg, err := call.Argument(4).ToString()
-		if err != nil || strings.TrimSpace(scheduleTimeArg) == "" {
-			return otto.UndefinedValue() // Schedule time is mandatory
+		scheduleTimeArg := jsArgString(call, 4)
+		if strings.TrimSpace(scheduleTimeArg) == "" {
+			return nil, fmt.Errorf("schedule time is mandatory")
 		}
 
-		recurrenceArg, err := call.Argument(5).ToString()
-		if err != nil {
-			recurrenceArg = "" // Default empty recurrence
-		}
+		recurrenceArg := jsArgString(call, 5) // Default empty recurrence
 
 		// Create the event when the timer fires
 		event := cdb.Event{
@@ -1471,74 +1608,51 @@ func addJSAPIScheduleEvent(vm *otto.Otto, db *cdb.Handler) error {
 			Details:  details,
 		}
 
-		// Schedule the event creation
-		scheduleTime, err := cdb.ScheduleEvent(db, event, scheduleTimeArg, recurrenceArg)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "scheduling event: %v", err)
-			// return the error
-			return otto.UndefinedValue()
-		}
+		return &jsHostCall{work: func() (interface{}, error) {
+			// Schedule the event creation
+			scheduleTime, err := cdb.ScheduleEvent(db, event, scheduleTimeArg, recurrenceArg)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "scheduling event: %v", err)
+				return nil, err
+			}
 
-		// Return success status to the JS caller
-		success, _ := vm.ToValue(map[string]interface{}{
-			"status":       "scheduled",
-			"eventType":    eventType,
-			"scheduleTime": scheduleTime.Format(time.RFC3339),
-		})
-		return success
+			// Return success status to the JS caller
+			return map[string]interface{}{
+				"status":       "scheduled",
+				"eventType":    eventType,
+				"scheduleTime": scheduleTime.Format(time.RFC3339),
+			}, nil
+		}}, nil
 	})
-	return err
 }
 
 // addJSAPIDebugLevel adds a method to fetch the current debug level to the VM
-func addJSAPIDebugLevel(vm *otto.Otto) error {
-	return vm.Set("getDebugLevel", func(_ otto.FunctionCall) otto.Value {
-		// Fetch the current debug level
-		debugLevel := cmn.GetDebugLevel()
-
-		// Convert the debug level to a JavaScript-compatible value
-		jsDebugLevel, err := vm.ToValue(debugLevel)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error converting debug level to JavaScript value: %v", err)
-			return otto.UndefinedValue()
-		}
-
-		return jsDebugLevel
+func addJSAPIDebugLevel(vm *goja.Runtime) error {
+	return vm.Set("getDebugLevel", func(_ goja.FunctionCall) goja.Value {
+		// Fetch the current debug level and convert it to a JavaScript-compatible value
+		return vm.ToValue(cmn.GetDebugLevel())
 	})
 }
 
 // addJSAPICrypto adds hashing functions like sha256 and sha1 to the VM
 // Usage in JS:
 // let hash = crypto.sha256("Hello, World!");
-func addJSAPICrypto(vm *otto.Otto) error {
-	cryptoObj, err := vm.Object(`crypto = {}`)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "Error creating crypto object:", err)
-		return err
-	}
+func addJSAPICrypto(vm *goja.Runtime) error {
+	cryptoObj := vm.NewObject()
 
 	// Define sha256 function
-	err = cryptoObj.Set("sha256", func(call otto.FunctionCall) otto.Value {
-		input, err := call.Argument(0).ToString()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error converting argument to string:", err)
-			return otto.UndefinedValue()
-		}
+	err := cryptoObj.Set("sha256", func(call goja.FunctionCall) goja.Value {
+		input := call.Argument(0).String()
 
 		hash := sha256.Sum256([]byte(input))
 		hashString := hex.EncodeToString(hash[:])
-		result, err := vm.ToValue(hashString)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Error converting sha256 hash to value:", err)
-			return otto.UndefinedValue()
-		}
-		return result
+		return vm.ToValue(hashString)
 	})
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Error setting sha256 function:", err)
 	}
 
-	return nil
+	return vm.Set("crypto", cryptoObj)
 }
 
 // CROWler specific API
@@ -1584,26 +1698,20 @@ func addJSAPICrypto(vm *otto.Otto) error {
 
 		console.log(sourceID);
 */
-func addJSAPICreateSource(vm *otto.Otto, db *cdb.Handler) error {
+func addJSAPICreateSource(vm *goja.Runtime, loop *jsEventLoop, db *cdb.Handler) error {
 	// Implement the `createSource` function
-	err := vm.Set("createSource", func(call otto.FunctionCall) otto.Value {
+	return setHostFunction(vm, loop, vm.GlobalObject(), "createSource", func(call goja.FunctionCall) (*jsHostCall, error) {
 		// Extract the source details from the plugin call
 		sourceArg := call.Argument(0)
-		if !sourceArg.IsObject() {
+		if !jsIsObject(sourceArg) {
 			cmn.DebugMsg(cmn.DbgLvlError, "Invalid argument: Expected a source object")
-			return otto.UndefinedValue()
+			return nil, fmt.Errorf("expected a source object")
 		}
 
-		sourceMap, err := sourceArg.Export()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Failed to export source argument: %v", err)
-			return otto.UndefinedValue()
-		}
-
-		sourceData, ok := sourceMap.(map[string]interface{})
+		sourceData, ok := sourceArg.Export().(map[string]interface{})
 		if !ok {
 			cmn.DebugMsg(cmn.DbgLvlError, "Invalid source argument structure")
-			return otto.UndefinedValue()
+			return nil, fmt.Errorf("invalid source argument structure")
 		}
 
 		// Map sourceData to the Source struct
@@ -1614,118 +1722,104 @@ func addJSAPICreateSource(vm *otto.Otto, db *cdb.Handler) error {
 		if name, ok := sourceData["name"].(string); ok {
 			source.Name = name
 		}
-		if categoryID, ok := sourceData["category_id"].(float64); ok {
+		if categoryID, ok := jsNumber(sourceData["category_id"]); ok {
 			source.CategoryID = uint64(categoryID)
 		}
-		if usrID, ok := sourceData["usr_id"].(float64); ok {
+		if usrID, ok := jsNumber(sourceData["usr_id"]); ok {
 			source.UsrID = uint64(usrID)
 		}
-		if restricted, ok := sourceData["restricted"].(float64); ok {
+		if restricted, ok := jsNumber(sourceData["restricted"]); ok {
 			source.Restricted = uint(restricted)
 		} else {
 			source.Restricted = 1 // Default to restricted
 		}
-		if flags, ok := sourceData["flags"].(float64); ok {
+		if flags, ok := jsNumber(sourceData["flags"]); ok {
 			source.Flags = uint(flags)
 		}
 
 		// Extract the config object
 		configArg := call.Argument(1)
-		if !configArg.IsObject() {
+		if !jsIsObject(configArg) {
 			cmn.DebugMsg(cmn.DbgLvlError, "Invalid configuration argument")
-			return otto.UndefinedValue()
-		}
-
-		configMap, err := configArg.Export()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Failed to export config argument: %v", err)
-			return otto.UndefinedValue()
+			return nil, fmt.Errorf("invalid configuration argument")
 		}
 
-		// Marshal configMap to JSON
-		configJSON, err := json.Marshal(configMap)
+		// Marshal the config to JSON
+		configJSON, err := json.Marshal(configArg.Export())
 		if err != nil {
 			cmn.DebugMsg(cmn.DbgLvlError, "Failed to marshal config JSON: %v", err)
-			return otto.UndefinedValue()
+			return nil, err
 		}
 
 		var config cfg.SourceConfig
 		err = json.Unmarshal(configJSON, &config)
 		if err != nil {
 			cmn.DebugMsg(cmn.DbgLvlError, "Invalid configuration format: %v", err)
-			return otto.UndefinedValue()
-		}
-
-		// Call CreateSource
-		sourceID, err := cdb.CreateSource(db, &source, config)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Failed to create source: %v", err)
-			return otto.UndefinedValue()
+			return nil, err
 		}
 
-		// Return the source ID to the JS environment
-		result, err := vm.ToValue(sourceID)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Failed to convert source ID to JavaScript value: %v", err)
-			return otto.UndefinedValue()
-		}
+		return &jsHostCall{work: func() (interface{}, error) {
+			// Call CreateSource
+			sourceID, err := cdb.CreateSource(db, &source, config)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "Failed to create source: %v", err)
+				return nil, err
+			}
 
-		return result
+			// Return the source ID to the JS environment
+			return sourceID, nil
+		}}, nil
 	})
-
-	return err
 }
 
-func addJSAPIRemoveSource(vm *otto.Otto, db *cdb.Handler) error {
+func addJSAPIRemoveSource(vm *goja.Runtime, loop *jsEventLoop, db *cdb.Handler) error {
 	// Implement the `removeSource` function
-	err := vm.Set("removeSource", func(call otto.FunctionCall) otto.Value {
-		sourceIDRaw, err := call.Argument(0).ToInteger()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Invalid source ID: %v", err)
-			return otto.UndefinedValue()
+	return setHostFunction(vm, loop, vm.GlobalObject(), "removeSource", func(call goja.FunctionCall) (*jsHostCall, error) {
+		if !jsIsKind(call.Argument(0), reflect.Int64, reflect.Float64) {
+			cmn.DebugMsg(cmn.DbgLvlError, "Invalid source ID: %v", call.Argument(0))
+			return nil, fmt.Errorf("invalid source ID")
 		}
-		sourceID := uint64(sourceIDRaw) //nolint:gosec // We are not using end-user input here
+		sourceID := uint64(call.Argument(0).ToInteger()) //nolint:gosec // We are not using end-user input here
 
-		// Call DeleteSource from cdb
-		err = cdb.DeleteSource(db, sourceID)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Failed to delete source: %v", err)
-			return otto.UndefinedValue()
-		}
+		return &jsHostCall{work: func() (interface{}, error) {
+			// Call DeleteSource from cdb
+			err := cdb.DeleteSource(db, sourceID)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "Failed to delete source: %v", err)
+				return nil, err
+			}
 
-		success, _ := vm.ToValue(map[string]interface{}{
-			"status":   "success",
-			"sourceID": sourceID,
-		})
-		return success
+			return map[string]interface{}{
+				"status":   "success",
+				"sourceID": sourceID,
+			}, nil
+		}}, nil
 	})
-	return err
 }
 
-func addJSAPIVacuumSource(vm *otto.Otto, db *cdb.Handler) error {
+func addJSAPIVacuumSource(vm *goja.Runtime, loop *jsEventLoop, db *cdb.Handler) error {
 	// Implement the `vacuumSource` function
-	err := vm.Set("vacuumSource", func(call otto.FunctionCall) otto.Value {
-		sourceIDRaw, err := call.Argument(0).ToInteger()
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Invalid source ID: %v", err)
-			return otto.UndefinedValue()
+	return setHostFunction(vm, loop, vm.GlobalObject(), "vacuumSource", func(call goja.FunctionCall) (*jsHostCall, error) {
+		if !jsIsKind(call.Argument(0), reflect.Int64, reflect.Float64) {
+			cmn.DebugMsg(cmn.DbgLvlError, "Invalid source ID: %v", call.Argument(0))
+			return nil, fmt.Errorf("invalid source ID")
 		}
-		sourceID := uint64(sourceIDRaw) //nolint:gosec // We are not using end-user input here
+		sourceID := uint64(call.Argument(0).ToInteger()) //nolint:gosec // We are not using end-user input here
 
-		// Call VacuumSource from cdb (to be implemented)
-		err = cdb.VacuumSource(db, sourceID)
-		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "Failed to vacuum source: %v", err)
-			return otto.UndefinedValue()
-		}
+		return &jsHostCall{work: func() (interface{}, error) {
+			// Call VacuumSource from cdb
+			err := cdb.VacuumSource(db, sourceID)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "Failed to vacuum source: %v", err)
+				return nil, err
+			}
 
-		success, _ := vm.ToValue(map[string]interface{}{
-			"status":   "success",
-			"sourceID": sourceID,
-		})
-		return success
+			return map[string]interface{}{
+				"status":   "success",
+				"sourceID": sourceID,
+			}, nil
+		}}, nil
 	})
-	return err
 }
 
 /* example usage for externalDBQuery in JS:
@@ -1772,10 +1866,10 @@ let result = externalDBQuery(config, query);
 console.log(result);
 */
 
-// addJSAPIExternalDBQuery adds a new function "externalDBQuery" to the Otto VM,
+// addJSAPIExternalDBQuery adds a new function "externalDBQuery" to the JS VM,
 // allowing engine plugins to query external databases (PostgreSQL, MySQL, SQLite,
 // MongoDB, Neo4J) without interfering with the built-in runQuery function.
-func addJSAPIExternalDBQuery(vm *otto.Otto) error {
+func addJSAPIExternalDBQuery(vm *goja.Runtime, loop *jsEventLoop) error {
 	// Register externalDBQuery to the JS API.
 	// Usage in JavaScript:
 	//    var config = JSON.stringify({
@@ -1789,380 +1883,372 @@ func addJSAPIExternalDBQuery(vm *otto.Otto) error {
 	//    });
 	//    var result = externalDBQuery(config, "SELECT * FROM mytable");
 	//    console.log(result);
-	return vm.Set("externalDBQuery", func(call otto.FunctionCall) otto.Value {
+	return setHostFunction(vm, loop, vm.GlobalObject(), "externalDBQuery", func(call goja.FunctionCall) (*jsHostCall, error) {
 		// Get configuration and query from arguments.
-		configStr, err := call.Argument(0).ToString()
+		configStr := call.Argument(0).String()
+		query := call.Argument(1).String()
+
+		return &jsHostCall{work: func() (interface{}, error) {
+			return externalDBQuery(configStr, query)
+		}}, nil
+	})
+}
+
+// externalDBQuery runs query on the external database described by configStr
+// (JSON). Errors which are reported to JS as {"error": message} objects are
+// returned as jsErrorStub.
+func externalDBQuery(configStr, query string) (interface{}, error) {
+	// Parse configuration JSON.
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(configStr), &config); err != nil {
+		return nil, err
+	}
+
+	// Determine the database type.
+	dbTypeRaw, ok := config["db_type"]
+	if !ok {
+		// Default to postgres if not specified, or you may choose to error out.
+		dbTypeRaw = postgresDBMS
+	}
+	dbType := strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", dbTypeRaw)))
+
+	// Extract connection parameters.
+	var host string
+	if config["host"] != nil {
+		host = strings.TrimSpace(fmt.Sprintf("%v", config["host"]))
+	} else {
+		host = "localhost"
+	}
+	var port int
+	if config["port"] != nil {
+		portF64, _ := config["port"].(float64)
+		port = int(portF64)
+	} else {
+		port = 0
+	}
+	var user string
+	if config["user"] != nil {
+		user = strings.TrimSpace(fmt.Sprintf("%v", config["user"]))
+	}
+	if user == "" {
+		if config["username"] != nil {
+			user = strings.TrimSpace(fmt.Sprintf("%v", config["username"]))
+		}
+	}
+	var password string
+	if config["password"] != nil {
+		password = strings.TrimSpace(fmt.Sprintf("%v", config["password"]))
+	}
+	var dbname string
+	if config["db_name"] != nil {
+		dbname = strings.TrimSpace(fmt.Sprintf("%v", config["db_name"]))
+	}
+	sslmode := "disable"
+	if config["sslmode"] != nil {
+		sslmode = strings.TrimSpace(fmt.Sprintf("%v", config["sslmode"]))
+	}
+
+	// Switch among supported databases.
+	switch dbType {
+	// Relational databases:
+	case postgresDBMS, mysqlDBMS, sqliteDBMS:
+		var dsn, driverName string
+		switch dbType {
+		case postgresDBMS:
+			driverName = postgresDBMS
+			if port == 0 {
+				port = 5432
+			}
+			// You might also support sslmode if provided.
+			dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+				host, port, user, password, dbname, sslmode)
+		case mysqlDBMS:
+			driverName = mysqlDBMS
+			if port == 0 {
+				port = 3306
+			}
+			// DSN for MySQL is typically: user:password@tcp(host:port)/dbname
+			dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
+				user, password, host, port, dbname)
+		case sqliteDBMS:
+			driverName = "sqlite3"
+			// For SQLite, the dbname is the file path.
+			dsn = dbname
+		}
+		// Open the DB.
+		db, err := sql.Open(driverName, dsn)
 		if err != nil {
-			return otto.UndefinedValue()
+			return nil, err
 		}
-		query, err := call.Argument(1).ToString()
+		defer db.Close() //nolint:errcheck // We can't check error here it's a defer
+
+		rows, err := db.Query(query)
 		if err != nil {
-			return otto.UndefinedValue()
+			return nil, err
 		}
+		defer rows.Close() // nolint:errcheck // We can't check error here it's a defer
 
-		// Parse configuration JSON.
-		var config map[string]interface{}
-		if err := json.Unmarshal([]byte(configStr), &config); err != nil {
-			return otto.UndefinedValue()
+		cols, err := rows.Columns()
+		if err != nil {
+			return nil, err
 		}
 
-		// Determine the database type.
-		dbTypeRaw, ok := config["db_type"]
-		if !ok {
-			// Default to postgres if not specified, or you may choose to error out.
-			dbTypeRaw = postgresDBMS
+		results := []map[string]interface{}{}
+		for rows.Next() {
+			rowMap := make(map[string]interface{})
+			// Create a slice for scanning.
+			colsVals := make([]interface{}, len(cols))
+			colsPtrs := make([]interface{}, len(cols))
+			for i := range colsVals {
+				colsPtrs[i] = &colsVals[i]
+			}
+
+			if err := rows.Scan(colsPtrs...); err != nil {
+				return nil, err
+			}
+
+			for i, colName := range cols {
+				val := colsVals[i]
+				if b, ok := val.([]byte); ok {
+					rowMap[colName] = string(b)
+				} else {
+					rowMap[colName] = val
+				}
+			}
+			results = append(results, rowMap)
 		}
-		dbType := strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", dbTypeRaw)))
 
-		// Extract connection parameters.
-		var host string
-		if config["host"] != nil {
-			host = strings.TrimSpace(fmt.Sprintf("%v", config["host"]))
-		} else {
-			host = "localhost"
+		// Convert results to a JavaScript value.
+		return results, nil
+
+	// MongoDB support.
+	case "mongodb", "mongodb+srv":
+		const mongoSelect = "find"
+		if port == 0 {
+			port = 27017
 		}
-		var port int
-		if config["port"] != nil {
-			portF64, _ := config["port"].(float64)
-			port = int(portF64)
+		// Build MongoDB URI. If authentication is needed:
+		var mongoURI string
+		if user == "" || password == "" {
+			mongoURI = fmt.Sprintf(dbType+"://%s:%d", host, port)
 		} else {
-			port = 0
+			mongoURI = fmt.Sprintf(dbType+"://%s:%s@%s:%d", user, password, host, port)
 		}
-		var user string
-		if config["user"] != nil {
-			user = strings.TrimSpace(fmt.Sprintf("%v", config["user"]))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+		if err != nil {
+			return nil, jsErrorStub(fmt.Sprintf("Error attempting to connect to '%s' db: %v", dbname, err))
 		}
-		if user == "" {
-			if config["username"] != nil {
-				user = strings.TrimSpace(fmt.Sprintf("%v", config["username"]))
-			}
+		defer client.Disconnect(ctx) // nolint:errcheck // We can't check error here it's a defer
+
+		// Process the query object: { action: "find", filter: { name: "John" } }
+		var queryJSON map[string]interface{}
+		if err := json.Unmarshal([]byte(query), &queryJSON); err != nil {
+			return nil, jsErrorStub(fmt.Sprintf("Error attempting to use '%s' db: %v", dbname, err))
 		}
-		var password string
-		if config["password"] != nil {
-			password = strings.TrimSpace(fmt.Sprintf("%v", config["password"]))
+
+		// Extract collection name from the query object (Required field).
+		var collectionName string
+		noCollection := false
+		if queryJSON["collection"] != nil {
+			collectionName = strings.TrimSpace(fmt.Sprintf("%v", queryJSON["collection"]))
+			if collectionName == "" {
+				noCollection = true
+			}
+		} else {
+			noCollection = true
 		}
-		var dbname string
-		if config["db_name"] != nil {
-			dbname = strings.TrimSpace(fmt.Sprintf("%v", config["db_name"]))
+		if noCollection {
+			return nil, jsErrorStub(fmt.Sprintf("Error attempting to use '%s' db: %v", dbname, err))
 		}
-		sslmode := "disable"
-		if config["sslmode"] != nil {
-			sslmode = strings.TrimSpace(fmt.Sprintf("%v", config["sslmode"]))
+		coll := client.Database(dbname).Collection(collectionName)
+
+		// Extract requested action and filter.
+		actionRaw, ok := queryJSON["action"]
+		if !ok || actionRaw == nil {
+			// If the action is not provided, default to a find action.
+			actionRaw = mongoSelect
 		}
+		actionStr := strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", actionRaw)))
 
-		// Switch among supported databases.
-		switch dbType {
-		// Relational databases:
-		case postgresDBMS, mysqlDBMS, sqliteDBMS:
-			var dsn, driverName string
-			switch dbType {
-			case postgresDBMS:
-				driverName = postgresDBMS
-				if port == 0 {
-					port = 5432
-				}
-				// You might also support sslmode if provided.
-				dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-					host, port, user, password, dbname, sslmode)
-			case mysqlDBMS:
-				driverName = mysqlDBMS
-				if port == 0 {
-					port = 3306
-				}
-				// DSN for MySQL is typically: user:password@tcp(host:port)/dbname
-				dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-					user, password, host, port, dbname)
-			case sqliteDBMS:
-				driverName = "sqlite3"
-				// For SQLite, the dbname is the file path.
-				dsn = dbname
-			}
-			// Open the DB.
-			db, err := sql.Open(driverName, dsn)
-			if err != nil {
-				return otto.UndefinedValue()
+		var jsResult interface{}
+		switch actionStr {
+		case mongoSelect: // find
+			// Extract the filter from the query object.
+			if queryJSON["filter"] == nil {
+				// If the filter is not provided, default to an empty filter.
+				queryJSON["filter"] = map[string]interface{}{}
 			}
-			defer db.Close() //nolint:errcheck // We can't check error here it's a defer
-
-			rows, err := db.Query(query)
-			if err != nil {
-				return otto.UndefinedValue()
+			filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
+			if !ok {
+				// If the filter is not provided, default to an empty filter.
+				cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
+				filter = bson.M{}
 			}
-			defer rows.Close() // nolint:errcheck // We can't check error here it's a defer
-
-			cols, err := rows.Columns()
+			cmn.DebugMsg(cmn.DbgLvlDebug5, "[MONGODB] MongoDB filter BSON Object: %v", filter)
+			cursor, err := coll.Find(ctx, filter)
 			if err != nil {
-				return otto.UndefinedValue()
+				return nil, jsErrorStub(fmt.Sprintf("Error attempting to use '%s' db: %v", dbname, err))
 			}
+			defer cursor.Close(ctx) // nolint:errcheck // We can't check error here it's a defer
 
-			results := []map[string]interface{}{}
-			for rows.Next() {
-				rowMap := make(map[string]interface{})
-				// Create a slice for scanning.
-				colsVals := make([]interface{}, len(cols))
-				colsPtrs := make([]interface{}, len(cols))
-				for i := range colsVals {
-					colsPtrs[i] = &colsVals[i]
-				}
-
-				if err := rows.Scan(colsPtrs...); err != nil {
-					return otto.UndefinedValue()
-				}
-
-				for i, colName := range cols {
-					val := colsVals[i]
-					if b, ok := val.([]byte); ok {
-						rowMap[colName] = string(b)
-					} else {
-						rowMap[colName] = val
-					}
-				}
-				results = append(results, rowMap)
+			var results []bson.M
+			if err = cursor.All(ctx, &results); err != nil {
+				return nil, jsErrorStub(fmt.Sprintf("Error attempting to use cursor on '%s' db: %v", dbname, err))
 			}
+			jsResult = results
 
-			// Convert results to a JavaScript value.
-			jsResult, err := vm.ToValue(results)
+		case "insertOne":
+			if queryJSON["document"] == nil {
+				return nil, jsErrorStub("Missing 'document' field for insertOne operation")
+			}
+			doc, ok := queryJSON["document"].(map[string]interface{})
+			if !ok {
+				return nil, jsErrorStub("Invalid format for 'document' field in insertOne operation")
+			}
+			result, err := coll.InsertOne(ctx, doc)
 			if err != nil {
-				return otto.UndefinedValue()
+				return nil, jsErrorStub(fmt.Sprintf("Error inserting document: %v", err))
 			}
-			return jsResult
+			jsResult = map[string]interface{}{"inserted_id": result.InsertedID}
 
-		// MongoDB support.
-		case "mongodb", "mongodb+srv":
-			const mongoSelect = "find"
-			if port == 0 {
-				port = 27017
+		case "insertMany":
+			if queryJSON["documents"] == nil {
+				return nil, jsErrorStub("Missing 'documents' field for insertMany operation")
 			}
-			// Build MongoDB URI. If authentication is needed:
-			var mongoURI string
-			if user == "" || password == "" {
-				mongoURI = fmt.Sprintf(dbType+"://%s:%d", host, port)
-			} else {
-				mongoURI = fmt.Sprintf(dbType+"://%s:%s@%s:%d", user, password, host, port)
+			docs, ok := queryJSON["documents"].([]interface{})
+			if !ok {
+				return nil, jsErrorStub("Invalid format for 'documents' field in insertMany operation")
 			}
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+			result, err := coll.InsertMany(ctx, docs)
 			if err != nil {
-				return returnError(vm, fmt.Sprintf("Error attempting to connect to '%s' db: %v", dbname, err))
+				return nil, jsErrorStub(fmt.Sprintf("Error inserting multiple documents: %v", err))
 			}
-			defer client.Disconnect(ctx) // nolint:errcheck // We can't check error here it's a defer
+			jsResult = map[string]interface{}{"inserted_ids": result.InsertedIDs}
 
-			// Process the query object: { action: "find", filter: { name: "John" } }
-			var queryJSON map[string]interface{}
-			if err := json.Unmarshal([]byte(query), &queryJSON); err != nil {
-				return returnError(vm, fmt.Sprintf("Error attempting to use '%s' db: %v", dbname, err))
+		case "updateOne":
+			if queryJSON["filter"] == nil || queryJSON["update"] == nil {
+				return nil, jsErrorStub("Missing 'filter' or 'update' field for updateOne operation")
 			}
-
-			// Extract collection name from the query object (Required field).
-			var collectionName string
-			noCollection := false
-			if queryJSON["collection"] != nil {
-				collectionName = strings.TrimSpace(fmt.Sprintf("%v", queryJSON["collection"]))
-				if collectionName == "" {
-					noCollection = true
-				}
-			} else {
-				noCollection = true
+			filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
+			if !ok {
+				cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
+				filter = bson.M{}
 			}
-			if noCollection {
-				return returnError(vm, fmt.Sprintf("Error attempting to use '%s' db: %v", dbname, err))
+			update, ok := queryJSON["update"].(map[string]interface{})
+			if !ok {
+				return nil, jsErrorStub("Invalid format for 'update' field in updateOne operation")
 			}
-			coll := client.Database(dbname).Collection(collectionName)
-
-			// Extract requested action and filter.
-			actionRaw, ok := queryJSON["action"]
-			if !ok || actionRaw == nil {
-				// If the action is not provided, default to a find action.
-				actionRaw = mongoSelect
+			result, err := coll.UpdateOne(ctx, filter, bson.M{"$set": update})
+			if err != nil {
+				return nil, jsErrorStub(fmt.Sprintf("Error updating document: %v", err))
 			}
-			actionStr := strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", actionRaw)))
-
-			var jsResult otto.Value
-			switch actionStr {
-			case mongoSelect: // find
-				// Extract the filter from the query object.
-				if queryJSON["filter"] == nil {
-					// If the filter is not provided, default to an empty filter.
-					queryJSON["filter"] = map[string]interface{}{}
-				}
-				filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
-				if !ok {
-					// If the filter is not provided, default to an empty filter.
-					cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
-					filter = bson.M{}
-				}
-				cmn.DebugMsg(cmn.DbgLvlDebug5, "[MONGODB] MongoDB filter BSON Object: %v", filter)
-				cursor, err := coll.Find(ctx, filter)
-				if err != nil {
-					return returnError(vm, fmt.Sprintf("Error attempting to use '%s' db: %v", dbname, err))
-				}
-				defer cursor.Close(ctx) // nolint:errcheck // We can't check error here it's a defer
-
-				var results []bson.M
-				if err = cursor.All(ctx, &results); err != nil {
-					return returnError(vm, fmt.Sprintf("Error attempting to use cursor on '%s' db: %v", dbname, err))
-				}
-				jsResult, err = vm.ToValue(results)
-				if err != nil {
-					return returnError(vm, fmt.Sprintf("Error attempting to convert MongoDB results to a JS object: %v", err))
-				}
-
-			case "insertOne":
-				if queryJSON["document"] == nil {
-					return returnError(vm, "Missing 'document' field for insertOne operation")
-				}
-				doc, ok := queryJSON["document"].(map[string]interface{})
-				if !ok {
-					return returnError(vm, "Invalid format for 'document' field in insertOne operation")
-				}
-				result, err := coll.InsertOne(ctx, doc)
-				if err != nil {
-					return returnError(vm, fmt.Sprintf("Error inserting document: %v", err))
-				}
-				jsResult, _ = vm.ToValue(map[string]interface{}{"inserted_id": result.InsertedID})
-
-			case "insertMany":
-				if queryJSON["documents"] == nil {
-					return returnError(vm, "Missing 'documents' field for insertMany operation")
-				}
-				docs, ok := queryJSON["documents"].([]interface{})
-				if !ok {
-					return returnError(vm, "Invalid format for 'documents' field in insertMany operation")
-				}
-				result, err := coll.InsertMany(ctx, docs)
-				if err != nil {
-					return returnError(vm, fmt.Sprintf("Error inserting multiple documents: %v", err))
-				}
-				jsResult, _ = vm.ToValue(map[string]interface{}{"inserted_ids": result.InsertedIDs})
-
-			case "updateOne":
-				if queryJSON["filter"] == nil || queryJSON["update"] == nil {
-					return returnError(vm, "Missing 'filter' or 'update' field for updateOne operation")
-				}
-				filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
-				if !ok {
-					cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
-					filter = bson.M{}
-				}
-				update, ok := queryJSON["update"].(map[string]interface{})
-				if !ok {
-					return returnError(vm, "Invalid format for 'update' field in updateOne operation")
-				}
-				result, err := coll.UpdateOne(ctx, filter, bson.M{"$set": update})
-				if err != nil {
-					return returnError(vm, fmt.Sprintf("Error updating document: %v", err))
-				}
-				jsResult, _ = vm.ToValue(map[string]interface{}{
-					"matched_count":  result.MatchedCount,
-					"modified_count": result.ModifiedCount,
-				})
-
-			case "updateMany":
-				if queryJSON["filter"] == nil || queryJSON["update"] == nil {
-					return returnError(vm, "Missing 'filter' or 'update' field for updateMany operation")
-				}
-				filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
-				if !ok {
-					cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
-					filter = bson.M{}
-				}
-				update, ok := queryJSON["update"].(map[string]interface{})
-				if !ok {
-					return returnError(vm, "Invalid format for 'update' field in updateMany operation")
-				}
-				result, err := coll.UpdateMany(ctx, filter, bson.M{"$set": update})
-				if err != nil {
-					return returnError(vm, fmt.Sprintf("Error updating multiple documents: %v", err))
-				}
-				jsResult, _ = vm.ToValue(map[string]interface{}{
-					"matched_count":  result.MatchedCount,
-					"modified_count": result.ModifiedCount,
-				})
-
-			case "deleteOne":
-				if queryJSON["filter"] == nil {
-					return returnError(vm, "Missing 'filter' field for deleteOne operation")
-				}
-				filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
-				if !ok {
-					cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
-					filter = bson.M{}
-				}
-				result, err := coll.DeleteOne(ctx, filter)
-				if err != nil {
-					return returnError(vm, fmt.Sprintf("Error deleting document: %v", err))
-				}
-				jsResult, _ = vm.ToValue(map[string]interface{}{"deleted_count": result.DeletedCount})
-
-			case "deleteMany":
-				if queryJSON["filter"] == nil {
-					return returnError(vm, "Missing 'filter' field for deleteMany operation")
-				}
-				filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
-				if !ok {
-					cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
-					filter = bson.M{}
-				}
-				result, err := coll.DeleteMany(ctx, filter)
-				if err != nil {
-					return returnError(vm, fmt.Sprintf("Error deleting multiple documents: %v", err))
-				}
-				jsResult, _ = vm.ToValue(map[string]interface{}{"deleted_count": result.DeletedCount})
-
-			default:
-				return returnError(vm, fmt.Sprintf("Unsupported action in the query object: '%s'", actionStr))
+			jsResult = map[string]interface{}{
+				"matched_count":  result.MatchedCount,
+				"modified_count": result.ModifiedCount,
 			}
-			return jsResult
 
-		// Neo4J support using NewDriverWithContext.
-		case "neo4j":
-			if port == 0 {
-				port = 7687
+		case "updateMany":
+			if queryJSON["filter"] == nil || queryJSON["update"] == nil {
+				return nil, jsErrorStub("Missing 'filter' or 'update' field for updateMany operation")
 			}
-			// Use the neo4j:// protocol (or bolt:// if needed)
-			uri := fmt.Sprintf("neo4j://%s:%d", host, port)
-			ctx := context.Background()
-			driver, err := neo4j.NewDriverWithContext(uri, neo4j.BasicAuth(user, password, ""), nil)
+			filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
+			if !ok {
+				cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
+				filter = bson.M{}
+			}
+			update, ok := queryJSON["update"].(map[string]interface{})
+			if !ok {
+				return nil, jsErrorStub("Invalid format for 'update' field in updateMany operation")
+			}
+			result, err := coll.UpdateMany(ctx, filter, bson.M{"$set": update})
 			if err != nil {
-				return returnError(vm, fmt.Sprintf("Error attempting to connect to neo4j '%s' db: %v", dbname, err))
+				return nil, jsErrorStub(fmt.Sprintf("Error updating multiple documents: %v", err))
+			}
+			jsResult = map[string]interface{}{
+				"matched_count":  result.MatchedCount,
+				"modified_count": result.ModifiedCount,
 			}
-			defer driver.Close(ctx) // nolint:errcheck // We can't check error here it's a defer
-
-			// Create a session.
-			session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
-			defer session.Close(ctx) // nolint:errcheck // We can't check error here it's a defer
 
-			// Execute the Cypher query.
-			records, err := session.Run(ctx, query, nil)
+		case "deleteOne":
+			if queryJSON["filter"] == nil {
+				return nil, jsErrorStub("Missing 'filter' field for deleteOne operation")
+			}
+			filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
+			if !ok {
+				cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
+				filter = bson.M{}
+			}
+			result, err := coll.DeleteOne(ctx, filter)
 			if err != nil {
-				return returnError(vm, fmt.Sprintf("Error executing Cypher query on '%s' db: %v", dbname, err))
+				return nil, jsErrorStub(fmt.Sprintf("Error deleting document: %v", err))
 			}
+			jsResult = map[string]interface{}{"deleted_count": result.DeletedCount}
 
-			var results []map[string]interface{}
-			for records.Next(ctx) {
-				record := records.Record()
-				recMap := make(map[string]interface{})
-				for _, key := range record.Keys {
-					if value, found := record.Get(key); found {
-						recMap[key] = value
-					}
-				}
-				results = append(results, recMap)
+		case "deleteMany":
+			if queryJSON["filter"] == nil {
+				return nil, jsErrorStub("Missing 'filter' field for deleteMany operation")
 			}
-			if err = records.Err(); err != nil {
-				return returnError(vm, fmt.Sprintf("Error processing Cypher query results on '%s' db: %v", dbname, err))
+			filter, ok := convertBsonDatesRecursive(queryJSON["filter"].(map[string]interface{})).(bson.M)
+			if !ok {
+				cmn.DebugMsg(cmn.DbgLvlError, "[MONGODB] Problem converting MongoDB filter to BSON: %v", err)
+				filter = bson.M{}
 			}
-			jsResult, err := vm.ToValue(results)
+			result, err := coll.DeleteMany(ctx, filter)
 			if err != nil {
-				return returnError(vm, fmt.Sprintf("Error converting Neo4J results to a JS object: %v", err))
+				return nil, jsErrorStub(fmt.Sprintf("Error deleting multiple documents: %v", err))
 			}
-			return jsResult
+			jsResult = map[string]interface{}{"deleted_count": result.DeletedCount}
 
 		default:
-			return returnError(vm, fmt.Sprintf("Unsupported database type: %s", dbType))
+			return nil, jsErrorStub(fmt.Sprintf("Unsupported action in the query object: '%s'", actionStr))
 		}
-	})
+		return jsResult, nil
+
+	// Neo4J support using NewDriverWithContext.
+	case "neo4j":
+		if port == 0 {
+			port = 7687
+		}
+		// Use the neo4j:// protocol (or bolt:// if needed)
+		uri := fmt.Sprintf("neo4j://%s:%d", host, port)
+		ctx := context.Background()
+		driver, err := neo4j.NewDriverWithContext(uri, neo4j.BasicAuth(user, password, ""), nil)
+		if err != nil {
+			return nil, jsErrorStub(fmt.Sprintf("Error attempting to connect to neo4j '%s' db: %v", dbname, err))
+		}
+		defer driver.Close(ctx) // nolint:errcheck // We can't check error here it's a defer
+
+		// Create a session.
+		session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+		defer session.Close(ctx) // nolint:errcheck // We can't check error here it's a defer
+
+		// Execute the Cypher query.
+		records, err := session.Run(ctx, query, nil)
+		if err != nil {
+			return nil, jsErrorStub(fmt.Sprintf("Error executing Cypher query on '%s' db: %v", dbname, err))
+		}
+
+		var results []map[string]interface{}
+		for records.Next(ctx) {
+			record := records.Record()
+			recMap := make(map[string]interface{})
+			for _, key := range record.Keys {
+				if value, found := record.Get(key); found {
+					recMap[key] = value
+				}
+			}
+			results = append(results, recMap)
+		}
+		if err = records.Err(); err != nil {
+			return nil, jsErrorStub(fmt.Sprintf("Error processing Cypher query results on '%s' db: %v", dbname, err))
+		}
+		return results, nil
+
+	default:
+		return nil, jsErrorStub(fmt.Sprintf("Unsupported database type: %s", dbType))
+	}
 }
 
 // Recursive function to convert $date fields into bson "DateTime"
@@ -2212,30 +2298,20 @@ func convertBsonDatesRecursive(obj interface{}) interface{} {
 
 // toCSV converts an array of objects into a CSV string.
 // It assumes that every object in the array has the same keys.
-func addJSAPIJSONToCSV(vm *otto.Otto) error {
-	return vm.Set("jsonToCSV", func(call otto.FunctionCall) otto.Value {
+func addJSAPIJSONToCSV(vm *goja.Runtime) error {
+	return vm.Set("jsonToCSV", func(call goja.FunctionCall) goja.Value {
 		// Export the argument (should be an array of objects)
-		dataInterface, err := call.Argument(0).Export()
-		if err != nil {
-			stub := map[string]interface{}{
-				"error": "No parameters passed. This function requires an array of objects.",
-			}
-			jsResult, _ := vm.ToValue(stub)
-			return jsResult
+		if !jsIsDefined(call.Argument(0)) {
+			return returnError(vm, "No parameters passed. This function requires an array of objects.")
 		}
-		dataSlice, ok := dataInterface.([]interface{})
+		dataSlice, ok := call.Argument(0).Export().([]interface{})
 		if !ok || len(dataSlice) == 0 {
-			empty, _ := vm.ToValue("")
-			return empty
+			return vm.ToValue("")
 		}
 		// Get header keys from the first row.
 		firstRow, ok := dataSlice[0].(map[string]interface{})
 		if !ok {
-			stub := map[string]interface{}{
-				"error": fmt.Sprintf("Error retrieving CSV headers: %v", err),
-			}
-			jsResult, _ := vm.ToValue(stub)
-			return jsResult
+			return returnError(vm, fmt.Sprintf("Error retrieving CSV headers: %v", dataSlice[0]))
 		}
 		// Collect keys (order is arbitrary; for production, you might want to enforce an order)
 		var headers []string
@@ -2247,11 +2323,7 @@ func addJSAPIJSONToCSV(vm *otto.Otto) error {
 		csvWriter := csv.NewWriter(&buf)
 		// Write header row.
 		if err := csvWriter.Write(headers); err != nil {
-			stub := map[string]interface{}{
-				"error": fmt.Sprintf("Error during writing CSV header: %v", err),
-			}
-			jsResult, _ := vm.ToValue(stub)
-			return jsResult
+			return returnError(vm, fmt.Sprintf("Error during writing CSV header: %v", err))
 		}
 		// Write data rows.
 		for _, rowInterface := range dataSlice {
@@ -2266,23 +2338,11 @@ func addJSAPIJSONToCSV(vm *otto.Otto) error {
 				row = append(row, val)
 			}
 			if err := csvWriter.Write(row); err != nil {
-				stub := map[string]interface{}{
-					"error": fmt.Sprintf("Error during writing the CSV object: %v", err),
-				}
-				jsResult, _ := vm.ToValue(stub)
-				return jsResult
+				return returnError(vm, fmt.Sprintf("Error during writing the CSV object: %v", err))
 			}
 		}
 		csvWriter.Flush()
-		result, err := vm.ToValue(buf.String())
-		if err != nil {
-			stub := map[string]interface{}{
-				"error": fmt.Sprintf("Error during conversion to JavaScript value: %v", err),
-			}
-			jsResult, _ := vm.ToValue(stub)
-			return jsResult
-		}
-		return result
+		return vm.ToValue(buf.String())
 	})
 }
 
@@ -2292,27 +2352,19 @@ func addJSAPIJSONToCSV(vm *otto.Otto) error {
 // Example usage in JS:
 // var data = loadLocalFile("data.csv");
 // var jsonData = csvToJSON(data);
-func addJSAPICSVToJSON(vm *otto.Otto) error {
-	return vm.Set("csvToJSON", func(call otto.FunctionCall) otto.Value {
-		csvStr, err := call.Argument(0).ToString()
-		if err != nil {
-			stub := map[string]interface{}{
-				"error": "Error this function requires parameters. a CSV table.",
-			}
-			jsResult, _ := vm.ToValue(stub)
-			return jsResult
+func addJSAPICSVToJSON(vm *goja.Runtime) error {
+	return vm.Set("csvToJSON", func(call goja.FunctionCall) goja.Value {
+		if !jsIsDefined(call.Argument(0)) {
+			return returnError(vm, "Error this function requires parameters. a CSV table.")
 		}
+		csvStr := call.Argument(0).String()
 		r := csv.NewReader(strings.NewReader(csvStr))
 		records, err := r.ReadAll()
 		if err != nil {
-			stub := map[string]interface{}{
-				"error": fmt.Sprintf("Error reading the CSV table: %v", err),
-			}
-			jsResult, _ := vm.ToValue(stub)
-			return jsResult
+			return returnError(vm, fmt.Sprintf("Error reading the CSV table: %v", err))
 		}
 		if len(records) < 1 {
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		}
 		// First row is headers.
 		headers := records[0]
@@ -2329,48 +2381,33 @@ func addJSAPICSVToJSON(vm *otto.Otto) error {
 			}
 			results = append(results, rowMap)
 		}
-		result, err := vm.ToValue(results)
-		if err != nil {
-			stub := map[string]interface{}{
-				"error": fmt.Sprintf("Error converting the generated JSON to a JS value: %v", err),
-			}
-			jsResult, _ := vm.ToValue(stub)
-			return jsResult
-		}
-		return result
+		return vm.ToValue(results)
 	})
 }
 
 // xmlToJSON converts an XML string into a JavaScript object.
 // This uses the mxj library to convert XML to a map[string]interface{}.
-func addJSAPIXMLToJSON(vm *otto.Otto) error {
-	return vm.Set("xmlToJSON", func(call otto.FunctionCall) otto.Value {
-		xmlStr, err := call.Argument(0).ToString()
-		if err != nil {
-			return otto.UndefinedValue()
-		}
+func addJSAPIXMLToJSON(vm *goja.Runtime) error {
+	return vm.Set("xmlToJSON", func(call goja.FunctionCall) goja.Value {
+		xmlStr := call.Argument(0).String()
 		// Convert XML into a map using mxj.
 		mv, err := mxj.NewMapXml([]byte(xmlStr))
 		if err != nil {
-			return otto.UndefinedValue()
-		}
-		result, err := vm.ToValue(mv)
-		if err != nil {
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		}
-		return result
+		return vm.ToValue(map[string]interface{}(mv))
 	})
 }
 
 // jsonToXML converts a JavaScript object (or JSON string) into an XML string.
 // It uses mxj to perform the conversion.
-func addJSAPIJSONToXML(vm *otto.Otto) error {
-	return vm.Set("jsonToXML", func(call otto.FunctionCall) otto.Value {
+func addJSAPIJSONToXML(vm *goja.Runtime) error {
+	return vm.Set("jsonToXML", func(call goja.FunctionCall) goja.Value {
 		// Export the argument (which should be a JS object or JSON string)
-		jsonObj, err := call.Argument(0).Export()
-		if err != nil {
-			return otto.UndefinedValue()
+		if !jsIsDefined(call.Argument(0)) {
+			return goja.Undefined()
 		}
+		jsonObj := call.Argument(0).Export()
 		// Ensure we have a map; if not, wrap it.
 		m, ok := jsonObj.(map[string]interface{})
 		if !ok {
@@ -2379,13 +2416,9 @@ func addJSAPIJSONToXML(vm *otto.Otto) error {
 		// Convert the map to XML.
 		xmlBytes, err := mxj.AnyXml(m)
 		if err != nil {
-			return otto.UndefinedValue()
-		}
-		result, err := vm.ToValue(string(xmlBytes))
-		if err != nil {
-			return otto.UndefinedValue()
+			return goja.Undefined()
 		}
-		return result
+		return vm.ToValue(string(xmlBytes))
 	})
 }
 
@@ -2437,22 +2470,22 @@ console.log("Updated Contacts:", JSON.Stringify(updatedContacts));
 -------------------------------------------------------------------------------
 */
 
-// addJSAPIFilterJSON registers a new function "filterJSON" in the Otto VM.
+// addJSAPIFilterJSON registers a new function "filterJSON" in the JS VM.
 // It accepts a JSON document (object or array) and an array (or comma‐separated string)
 // of keys to filter, and returns a new document containing only those keys.
-func addJSAPIFilterJSON(vm *otto.Otto) error {
-	return vm.Set("filterJSON", func(call otto.FunctionCall) otto.Value {
+func addJSAPIFilterJSON(vm *goja.Runtime) error {
+	return vm.Set("filterJSON", func(call goja.FunctionCall) goja.Value {
 		// Export the JSON document from the first argument.
-		doc, err := call.Argument(0).Export()
-		if err != nil {
-			return returnError(vm, fmt.Sprintf("Error this function requires an input JSON object: %v", err))
+		if !jsIsDefined(call.Argument(0)) {
+			return returnError(vm, "Error this function requires an input JSON object")
 		}
+		doc := call.Argument(0).Export()
 
 		// Export the filter keys from the second argument.
-		keysRaw, err := call.Argument(1).Export()
-		if err != nil {
-			return returnError(vm, fmt.Sprintf("Error this function requires a comma separated list of JSON keys to filter: %v", err))
+		if !jsIsDefined(call.Argument(1)) {
+			return returnError(vm, "Error this function requires a comma separated list of JSON keys to filter")
 		}
+		keysRaw := call.Argument(1).Export()
 
 		// Convert the filter keys into a slice of strings.
 		var keys []string
@@ -2491,12 +2524,8 @@ func addJSAPIFilterJSON(vm *otto.Otto) error {
 		// Filter the JSON document.
 		filtered := filterJSONValue(doc, keys)
 
-		// Convert the filtered result back to an Otto value.
-		result, err := vm.ToValue(filtered)
-		if err != nil {
-			return otto.UndefinedValue()
-		}
-		return result
+		// Convert the filtered result back to a JS value.
+		return vm.ToValue(filtered)
 	})
 }
 
@@ -2548,13 +2577,13 @@ func filterJSONValue(doc interface{}, keys []string) interface{} {
 	}
 }
 
-func addJSAPIMapJSON(vm *otto.Otto) error {
-	return vm.Set("mapJSON", func(call otto.FunctionCall) otto.Value {
+func addJSAPIMapJSON(vm *goja.Runtime) error {
+	return vm.Set("mapJSON", func(call goja.FunctionCall) goja.Value {
 		// Export the first argument (should be a JSON array)
-		docInterface, err := call.Argument(0).Export()
-		if err != nil {
-			return returnError(vm, fmt.Sprintf("Error, this function requires an array of objects: %v", err))
+		if !jsIsDefined(call.Argument(0)) {
+			return returnError(vm, "Error, this function requires an array of objects")
 		}
+		docInterface := call.Argument(0).Export()
 
 		// Normalize array to []interface{}
 		array := normalizeArray(docInterface)
@@ -2563,37 +2592,25 @@ func addJSAPIMapJSON(vm *otto.Otto) error {
 		}
 
 		// The second argument should be a function
-		callback := call.Argument(1)
-		if !callback.IsFunction() {
-			stub := map[string]interface{}{
-				"error": fmt.Sprintf("Error, the passed callback is not a function: %v", callback),
-			}
-			jsResult, _ := vm.ToValue(stub)
-			return jsResult
+		callback, ok := goja.AssertFunction(call.Argument(1))
+		if !ok {
+			return returnError(vm, fmt.Sprintf("Error, the passed callback is not a function: %v", call.Argument(1)))
 		}
 
 		// Prepare a new slice to hold the mapped results.
 		var mapped []interface{}
 		for _, elem := range array {
 			// Call the callback with the current element.
-			result, err := callback.Call(otto.UndefinedValue(), elem)
+			result, err := callback(goja.Undefined(), vm.ToValue(elem))
 			if err != nil {
 				// In case of error, skip this element.
 				continue
 			}
-			exportResult, err := result.Export()
-			if err != nil {
-				continue
-			}
-			mapped = append(mapped, exportResult)
+			mapped = append(mapped, result.Export())
 		}
 
-		// Convert the mapped slice back to an Otto value.
-		mappedValue, err := vm.ToValue(mapped)
-		if err != nil {
-			return otto.UndefinedValue()
-		}
-		return mappedValue
+		// Convert the mapped slice back to a JS value.
+		return vm.ToValue(mapped)
 	})
 }
 
@@ -2650,13 +2667,13 @@ console.log("Transformed Data:", transformed);
 // Usage in JS:
 //
 //	var total = reduceJSON([1,2,3,4], function(acc, val) { return acc + val; }, 0);
-func addJSAPIReduceJSON(vm *otto.Otto) error {
-	return vm.Set("reduceJSON", func(call otto.FunctionCall) otto.Value {
+func addJSAPIReduceJSON(vm *goja.Runtime) error {
+	return vm.Set("reduceJSON", func(call goja.FunctionCall) goja.Value {
 		// First argument: a JSON array.
-		arrInterface, err := call.Argument(0).Export()
-		if err != nil {
+		if !jsIsDefined(call.Argument(0)) {
 			return returnError(vm, "Error, this function requires an array of objects.")
 		}
+		arrInterface := call.Argument(0).Export()
 
 		// Convert to a Go slice of interfaces
 		arr := normalizeArray(arrInterface)
@@ -2665,16 +2682,16 @@ func addJSAPIReduceJSON(vm *otto.Otto) error {
 		}
 
 		// Second argument: callback function.
-		callback := call.Argument(1)
-		if !callback.IsFunction() {
-			return returnError(vm, fmt.Sprintf("Error, callback is not a function: %v", callback))
+		callback, ok := goja.AssertFunction(call.Argument(1))
+		if !ok {
+			return returnError(vm, fmt.Sprintf("Error, callback is not a function: %v", call.Argument(1)))
 		}
 
 		// Third argument: initial accumulator.
 		accumulator := call.Argument(2)
 		// Iterate over each element and call the callback.
 		for _, elem := range arr {
-			result, err := callback.Call(otto.UndefinedValue(), accumulator, elem)
+			result, err := callback(goja.Undefined(), accumulator, vm.ToValue(elem))
 			if err != nil {
 				continue // optionally log error
 			}
@@ -2688,33 +2705,33 @@ func addJSAPIReduceJSON(vm *otto.Otto) error {
 // Usage in JS:
 //
 //	var joined = joinJSON(leftArray, rightArray, "id");
-func addJSAPIJoinJSON(vm *otto.Otto) error {
-	return vm.Set("joinJSON", func(call otto.FunctionCall) otto.Value {
+func addJSAPIJoinJSON(vm *goja.Runtime) error {
+	return vm.Set("joinJSON", func(call goja.FunctionCall) goja.Value {
 		// First argument: left array.
-		leftInterface, err := call.Argument(0).Export()
-		if err != nil {
-			return returnError(vm, fmt.Sprintf("Error, this function requires a 'left' array to merge into: %v", err))
+		if !jsIsDefined(call.Argument(0)) {
+			return returnError(vm, "Error, this function requires a 'left' array to merge into")
 		}
+		leftInterface := call.Argument(0).Export()
 		leftArr := normalizeArray(leftInterface)
 		if leftArr == nil {
 			return returnError(vm, fmt.Sprintf("Error, the 'left' parameter is not a valid JSON array: %v", leftInterface))
 		}
 
 		// Second argument: right array.
-		rightInterface, err := call.Argument(1).Export()
-		if err != nil {
-			return returnError(vm, fmt.Sprintf("Error, this function requires a 'right' JSON array to merge from: %v", err))
+		if !jsIsDefined(call.Argument(1)) {
+			return returnError(vm, "Error, this function requires a 'right' JSON array to merge from")
 		}
+		rightInterface := call.Argument(1).Export()
 		rightArr := normalizeArray(rightInterface)
 		if rightArr == nil {
 			return returnError(vm, fmt.Sprintf("Error, the 'right' parameter is not a valid JSON array: %v", rightInterface))
 		}
 
 		// Third argument: join key.
-		joinKey, err := call.Argument(2).ToString()
-		if err != nil {
-			return returnError(vm, fmt.Sprintf("Error, this function requires a 'join' key: %v", err))
+		if !jsIsDefined(call.Argument(2)) {
+			return returnError(vm, "Error, this function requires a 'join' key")
 		}
+		joinKey := call.Argument(2).String()
 
 		// Build an index for the right array.
 		rightIndex := make(map[string][]map[string]interface{})
@@ -2757,11 +2774,7 @@ func addJSAPIJoinJSON(vm *otto.Otto) error {
 				}
 			}
 		}
-		jsResult, err := vm.ToValue(results)
-		if err != nil {
-			return otto.UndefinedValue()
-		}
-		return jsResult
+		return vm.ToValue(results)
 	})
 }
 
@@ -2771,42 +2784,30 @@ func addJSAPIJoinJSON(vm *otto.Otto) error {
 //	var sorted = sortJSON(dataArray, "last_name", "asc");
 //
 // The order parameter is optional ("asc" is default, "desc" for descending).
-func addJSAPISortJSON(vm *otto.Otto) error {
-	return vm.Set("sortJSON", func(call otto.FunctionCall) otto.Value {
+func addJSAPISortJSON(vm *goja.Runtime) error {
+	return vm.Set("sortJSON", func(call goja.FunctionCall) goja.Value {
 		const asc = "asc"
 		const desc = "desc"
 
 		// First argument: JSON array.
-		arrInterface, err := call.Argument(0).Export()
-		if err != nil {
-			return returnError(vm, fmt.Sprintf("Error, this function requires a JSON array in input: %v", err))
+		if !jsIsDefined(call.Argument(0)) {
+			return returnError(vm, "Error, this function requires a JSON array in input")
 		}
+		arrInterface := call.Argument(0).Export()
 		arr := normalizeArray(arrInterface)
 		if arr != nil {
 			return returnError(vm, fmt.Sprintf("Error, this function requires a JSON array in input: %v", arr))
 		}
 
 		// Second argument: sort key.
-		wrongSortKey := false
-		sortKey, err := call.Argument(1).ToString()
-		if err != nil {
-			wrongSortKey = true
-		}
-		sortKey = strings.TrimSpace(sortKey)
+		sortKey := strings.TrimSpace(jsArgString(call, 1))
 		if sortKey == "" {
-			wrongSortKey = true
-		}
-		if wrongSortKey {
-			return returnError(vm, fmt.Sprintf("Error, this function requires a valid JSON key to be ordered: %v", err))
+			return returnError(vm, fmt.Sprintf("Error, this function requires a valid JSON key to be ordered: %v", call.Argument(1)))
 		}
 		// Third argument: order ("asc" or "desc", default "asc").
 		order := asc
-		if call.Argument(2).IsDefined() {
-			order, err = call.Argument(2).ToString()
-			if err != nil {
-				order = asc
-			}
-			order = strings.ToLower(strings.TrimSpace(order))
+		if jsIsDefined(call.Argument(2)) {
+			order = strings.ToLower(strings.TrimSpace(call.Argument(2).String()))
 			if order != asc && order != desc {
 				order = asc
 			}
@@ -2825,11 +2826,7 @@ func addJSAPISortJSON(vm *otto.Otto) error {
 			}
 			return vi < vj
 		})
-		result, err := vm.ToValue(arr)
-		if err != nil {
-			return otto.UndefinedValue()
-		}
-		return result
+		return vm.ToValue(arr)
 	})
 }
 
@@ -2837,49 +2834,40 @@ func addJSAPISortJSON(vm *otto.Otto) error {
 // Usage in JS:
 //
 //	var finalValue = pipeJSON(initialValue, [fn1, fn2, fn3]);
-func addJSAPIPipeJSON(vm *otto.Otto) error {
-	return vm.Set("pipeJSON", func(call otto.FunctionCall) otto.Value {
+func addJSAPIPipeJSON(vm *goja.Runtime) error {
+	return vm.Set("pipeJSON", func(call goja.FunctionCall) goja.Value {
 		// First argument: initial JSON value.
 		value := call.Argument(0)
 
 		// Second argument: array of callback functions.
-		funcArrayValue := call.Argument(1)
-		if !funcArrayValue.IsObject() {
+		funcArray, ok := call.Argument(1).(*goja.Object)
+		if !ok {
 			return returnError(vm, "Error, this function requires an array of functions as the second argument.")
 		}
 
 		// Ensure first argument is a valid JSON object or array.
-		if !value.IsObject() &&
-			!value.IsNumber() &&
-			!value.IsString() {
+		if !jsIsObject(value) &&
+			!jsIsKind(value, reflect.Int64, reflect.Float64, reflect.String) {
 			return returnError(vm, "Error, this function requires a JSON object or array as the first argument.")
 		}
 
 		// Extract the array length from JavaScript.
-		lengthValue, err := funcArrayValue.Object().Get("length")
-		if err != nil {
+		lengthValue := funcArray.Get("length")
+		if !jsIsDefined(lengthValue) {
 			return returnError(vm, "Error accessing function array length.")
 		}
-		length, err := lengthValue.ToInteger()
-		if err != nil {
-			return returnError(vm, "Error converting function array length to integer.")
-		}
+		length := lengthValue.ToInteger()
 
 		// Iterate over the array and process functions.
 		for i := int64(0); i < length; i++ {
-			// Get the function reference
-			funcValue, err := funcArrayValue.Object().Get(fmt.Sprintf("%d", i))
-			if err != nil {
-				continue
-			}
-
-			// Ensure it's a function
-			if !funcValue.IsFunction() {
+			// Get the function reference and ensure it's a function
+			fn, ok := goja.AssertFunction(funcArray.Get(strconv.FormatInt(i, 10)))
+			if !ok {
 				continue
 			}
 
 			// Call the function with the current value
-			newValue, err := funcValue.Call(otto.UndefinedValue(), value)
+			newValue, err := fn(goja.Undefined(), value)
 			if err != nil {
 				continue // Skip errors
 			}
@@ -2930,7 +2918,7 @@ func normalizeArray(input interface{}) []interface{} {
 	return arr
 }
 
-// addJSAPIISODate adds a new function "ISODate" to the Otto VM,
+// addJSAPIISODate adds a new function "ISODate" to the JS VM,
 // which returns the current date and time in ISO 8601 format.
 // Usage in JS:
 //
@@ -2938,54 +2926,67 @@ func normalizeArray(input interface{}) []interface{} {
 //	 console.log("Current time:", now);
 //	 var test = ISODate("2025-02-19T00:00:00Z");
 //	 console.log("Test time:", test);
-func addJSAPIISODate(vm *otto.Otto) error {
-	return vm.Set("ISODate", func(call otto.FunctionCall) otto.Value {
+func addJSAPIISODate(vm *goja.Runtime) error {
+	return vm.Set("ISODate", func(call goja.FunctionCall) goja.Value {
 		var t time.Time
-		if len(call.ArgumentList) == 0 {
+		if len(call.Arguments) == 0 {
 			t = time.Now().UTC()
 		} else {
-			dateStr, _ := call.Argument(0).ToString()
+			dateStr := call.Argument(0).String()
 			parsedTime, err := time.Parse(time.RFC3339, dateStr)
 			if err != nil {
-				stub := map[string]interface{}{
-					"error": fmt.Sprintf("Source date/time not in RFC3339 format: %v", err),
-				}
-				jsResult, _ := vm.ToValue(stub)
-				return jsResult
+				return returnError(vm, fmt.Sprintf("Source date/time not in RFC3339 format: %v", err))
 			}
 			t = parsedTime
 		}
-		result, _ := vm.ToValue(t.Format("2006-01-02T15:04:05.000Z"))
-		return result
+		return vm.ToValue(t.Format("2006-01-02T15:04:05.000Z"))
 	})
 }
 
-// setTimeout is a JavaScript function that calls a function or evaluates an expression after a specified number of milliseconds.
+// setTimeout is a JavaScript function that calls a function after a specified number of milliseconds.
+// The callback runs on the plugin event loop (so before the plugin returns, unless it times out).
 // Usage in JS:
 //
-//	setTimeout(function() {
+//	let id = setTimeout(function() {
 //		console.log("Hello, world!");
 //	}, 1000);
-func addJSAPISetTimeout(vm *otto.Otto) error {
-	return vm.Set("setTimeout", func(call otto.FunctionCall) otto.Value {
-		// First argument: function or expression to evaluate.
-		callback := call.Argument(0)
-		if !callback.IsFunction() {
+//	clearTimeout(id);
+func addJSAPISetTimeout(vm *goja.Runtime, loop *jsEventLoop) error {
+	err := vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
+		// First argument: function to call.
+		callback, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
 			return returnError(vm, "Error, this function requires a function as the first argument.")
 		}
 
 		// Second argument: delay in milliseconds.
-		delay, err := call.Argument(1).ToInteger()
-		if err != nil {
-			return returnError(vm, "Error, this function requires a delay in milliseconds as the second argument.")
+		delay := call.Argument(1).ToInteger()
+		if delay < 0 {
+			delay = 0
+		}
+
+		// Other arguments are passed to the callback (the VM reuses call.Arguments).
+		var args []goja.Value
+		if len(call.Arguments) > 2 {
+			args = append(args, call.Arguments[2:]...)
 		}
 
 		// Call the function after the specified delay.
-		go func() {
-			time.Sleep(time.Duration(delay) * time.Millisecond)
-			_, _ = callback.Call(otto.UndefinedValue())
-		}()
-		return otto.UndefinedValue()
+		id := loop.setTimer(time.Duration(delay)*time.Millisecond, func() error {
+			_, err := callback(goja.Undefined(), args...)
+			return err
+		})
+		return vm.ToValue(id)
+	})
+	if err != nil {
+		return err
+	}
+
+	return vm.Set("clearTimeout", func(call goja.FunctionCall) goja.Value {
+		if jsIsDefined(call.Argument(0)) {
+			loop.clearTimer(call.Argument(0).ToInteger())
+		}
+		return goja.Undefined()
 	})
 }
 
@@ -2994,11 +2995,11 @@ func addJSAPISetTimeout(vm *otto.Otto) error {
 //
 //	var data = loadLocalFile("data.json");
 //	console.log("File contents:", data);
-func addJSAPILoadLocalFile(vm *otto.Otto) error {
-	return vm.Set("loadLocalFile", func(call otto.FunctionCall) otto.Value {
+func addJSAPILoadLocalFile(vm *goja.Runtime) error {
+	return vm.Set("loadLocalFile", func(call goja.FunctionCall) goja.Value {
 		// First argument: file path.
-		filePath, err := call.Argument(0).ToString()
-		if err != nil {
+		filePath := jsArgString(call, 0)
+		if filePath == "" {
 			return returnError(vm, "Error, this function requires a file path as the first argument.")
 		}
 
@@ -3015,35 +3016,29 @@ func addJSAPILoadLocalFile(vm *otto.Otto) error {
 		}
 
 		// Convert the file contents to a string.
-		result, err := vm.ToValue(string(data))
-		if err != nil {
-			return returnError(vm, fmt.Sprintf("Error converting file contents to a JavaScript value: %v", err))
-		}
-		return result
+		return vm.ToValue(string(data))
 	})
 }
 
-// addJSAPIGenUUID adds a new function "genUUID" to the Otto VM,
+// addJSAPIGenUUID adds a new function "genUUID" to the JS VM,
 // which generates a new UUID (v4) using the "github.com/google/uuid" package.
 // Usage in JS:
 //
 //		var uuid = genUUID();
 //	 console.log("Generated UUID:", uuid);
-func addJSAPIGenUUID(vm *otto.Otto) error {
-	return vm.Set("genUUID", func(call otto.FunctionCall) otto.Value {
+func addJSAPIGenUUID(vm *goja.Runtime) error {
+	return vm.Set("genUUID", func(_ goja.FunctionCall) goja.Value {
 		uuid, err := uuid.NewRandom()
 		if err != nil {
 			return returnError(vm, fmt.Sprintf("Error generating UUID: %v", err))
 		}
-		result, _ := vm.ToValue(uuid.String())
-		return result
+		return vm.ToValue(uuid.String())
 	})
 }
 
-func returnError(vm *otto.Otto, message string) otto.Value {
+func returnError(vm *goja.Runtime, message string) goja.Value {
 	stub := map[string]interface{}{"error": message}
-	jsResult, _ := vm.ToValue(stub)
-	return jsResult
+	return vm.ToValue(stub)
 }
 
 // String returns the Plugin as a string
@@ -11,7 +11,7 @@ import (
 
 	cdb "github.com/pzaino/thecrowler/pkg/database"
 
-	"github.com/robertkrimen/otto"
+	"github.com/dop251/goja"
 )
 
 func TestNewJSPluginRegister(t *testing.T) {
@@ -58,7 +58,7 @@ func TestJSPluginRegisterGetPlugin(t *testing.T) {
 }
 
 func TestRemoveJSFunctions(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	functionsToRemove := []string{
 		"eval",
@@ -94,12 +94,9 @@ func TestRemoveJSFunctions(t *testing.T) {
 	}
 
 	for _, functionName := range functionsToRemove {
-		value, err := vm.Get(functionName)
-		if err != nil {
-			t.Errorf("there should not be an error checking for '%s', but we have got: %v", functionName, err)
-		}
+		value := vm.Get(functionName)
 
-		if value != otto.UndefinedValue() {
+		if jsIsDefined(value) {
 			t.Errorf("removeJSFunctions failed to remove function: %s", functionName)
 		}
 	}
@@ -322,11 +319,11 @@ func TestGetPluginsByAgentName(t *testing.T) {
 }
 
 func TestSetCrowlerJSAPI(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 	var db *cdb.Handler
 	db = nil
 
-	err := setCrowlerJSAPI(vm, db)
+	err := setCrowlerJSAPI(vm, newJSEventLoop(vm), db, jsAPIPermissions{})
 	if err != nil {
 		t.Errorf("setCrowlerJSAPI returned an error: %v", err)
 	}
@@ -346,32 +343,26 @@ func TestSetCrowlerJSAPI(t *testing.T) {
 	}
 
 	for _, functionName := range functions {
-		value, err := vm.Get(functionName)
-		if err != nil {
-			t.Errorf("there should not be an error checking for '%s', but we have got: %v", functionName, err)
-		}
+		value := vm.Get(functionName)
 
-		if !value.IsFunction() {
+		if !jsIsFunction(value) {
 			t.Errorf("Expected '%s' to be a function, but it is not", functionName)
 		}
 	}
 }
 
 func TestAddJSHTTPRequest(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
-	err := addJSHTTPRequest(vm)
+	err := addJSHTTPRequest(vm, nil, nil)
 	if err != nil {
 		t.Errorf("addJSHTTPRequest returned an error: %v", err)
 	}
 
 	// Check if the httpRequest function is set in the VM
-	value, err := vm.Get("httpRequest")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'httpRequest', but we have got: %v", err)
-	}
+	value := vm.Get("httpRequest")
 
-	if !value.IsFunction() {
+	if !jsIsFunction(value) {
 		t.Errorf("Expected 'httpRequest' to be a function, but it is not")
 	}
 
@@ -387,15 +378,12 @@ func TestAddJSHTTPRequest(t *testing.T) {
 		result;
 	`, ts.URL)
 
-	result, err := vm.Run(script)
+	result, err := vm.RunString(script)
 	if err != nil {
 		t.Errorf("Error running script: %v", err)
 	}
 
-	resultStr, err := result.ToString()
-	if err != nil {
-		t.Errorf("Error converting result to string: %v", err)
-	}
+	resultStr := result.String()
 
 	expected := "Hello, World!\n"
 	if resultStr != expected {
@@ -404,40 +392,31 @@ func TestAddJSHTTPRequest(t *testing.T) {
 }
 
 func TestAddJSAPIClient(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
-	err := addJSAPIClient(vm)
+	err := addJSAPIClient(vm, nil, nil)
 	if err != nil {
 		t.Errorf("addJSAPIClient returned an error: %v", err)
 	}
 
 	// Check if the apiClient object is set in the VM
-	apiClient, err := vm.Get("apiClient")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'apiClient', but we have got: %v", err)
-	}
+	apiClient := vm.Get("apiClient")
 
-	if !apiClient.IsObject() {
+	if !jsIsObject(apiClient) {
 		t.Errorf("Expected 'apiClient' to be an object, but it is not")
 	}
 
 	// Check if the post method is set in the apiClient object
-	postMethod, err := apiClient.Object().Get("post")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'post' method, but we have got: %v", err)
-	}
+	postMethod := apiClient.ToObject(vm).Get("post")
 
-	if !postMethod.IsFunction() {
+	if !jsIsFunction(postMethod) {
 		t.Errorf("Expected 'post' to be a function, but it is not")
 	}
 
 	// Check if the get method is set in the apiClient object
-	getMethod, err := apiClient.Object().Get("get")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'get' method, but we have got: %v", err)
-	}
+	getMethod := apiClient.ToObject(vm).Get("get")
 
-	if !getMethod.IsFunction() {
+	if !jsIsFunction(getMethod) {
 		t.Errorf("Expected 'get' to be a function, but it is not")
 	}
 
@@ -460,21 +439,21 @@ func TestAddJSAPIClient(t *testing.T) {
 		result;
 	`, tsPost.URL)
 
-	postResult, err := vm.Run(postScript)
+	postResult, err := vm.RunString(postScript)
 	if err != nil {
 		t.Errorf("Error running post script: %v", err)
 	}
 
-	postResultObj := postResult.Object()
-	postStatus, _ := postResultObj.Get("status")
-	postBody, _ := postResultObj.Get("body")
+	postResultObj := postResult.ToObject(vm)
+	postStatus := postResultObj.Get("status")
+	postBody := postResultObj.Get("body")
 
-	if status, _ := postStatus.ToInteger(); status != http.StatusOK {
+	if status := postStatus.ToInteger(); status != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", status)
 	}
 
 	expectedPostBody := "Hello, POST!\n"
-	if body, _ := postBody.ToString(); body != expectedPostBody {
+	if body := postBody.String(); body != expectedPostBody {
 		t.Errorf("Expected body '%s', got '%s'", expectedPostBody, body)
 	}
 
@@ -496,40 +475,37 @@ func TestAddJSAPIClient(t *testing.T) {
 		result;
 	`, tsGet.URL)
 
-	getResult, err := vm.Run(getScript)
+	getResult, err := vm.RunString(getScript)
 	if err != nil {
 		t.Errorf("Error running get script: %v", err)
 	}
 
-	getResultObj := getResult.Object()
-	getStatus, _ := getResultObj.Get("status")
-	getBody, _ := getResultObj.Get("body")
+	getResultObj := getResult.ToObject(vm)
+	getStatus := getResultObj.Get("status")
+	getBody := getResultObj.Get("body")
 
-	if status, _ := getStatus.ToInteger(); status != http.StatusOK {
+	if status := getStatus.ToInteger(); status != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", status)
 	}
 
 	expectedGetBody := "Hello, GET!\n"
-	if body, _ := getBody.ToString(); body != expectedGetBody {
+	if body := getBody.String(); body != expectedGetBody {
 		t.Errorf("Expected body '%s', got '%s'", expectedGetBody, body)
 	}
 }
 
 func TestAddJSAPIFetch(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
-	err := addJSAPIFetch(vm)
+	err := addJSAPIFetch(vm, nil, nil)
 	if err != nil {
 		t.Errorf("addJSAPIFetch returned an error: %v", err)
 	}
 
 	// Check if the fetch function is set in the VM
-	value, err := vm.Get("fetch")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'fetch', but we have got: %v", err)
-	}
+	value := vm.Get("fetch")
 
-	if !value.IsFunction() {
+	if !jsIsFunction(value) {
 		t.Errorf("Expected 'fetch' to be a function, but it is not")
 	}
 
@@ -549,15 +525,12 @@ func TestAddJSAPIFetch(t *testing.T) {
 		response.text();
 	`, ts.URL)
 
-	getResult, err := vm.Run(getScript)
+	getResult, err := vm.RunString(getScript)
 	if err != nil {
 		t.Errorf("Error running GET script: %v", err)
 	}
 
-	getResultStr, err := getResult.ToString()
-	if err != nil {
-		t.Errorf("Error converting GET result to string: %v", err)
-	}
+	getResultStr := getResult.String()
 
 	expectedGet := "Hello, GET!\n"
 	if getResultStr != expectedGet {
@@ -574,15 +547,12 @@ func TestAddJSAPIFetch(t *testing.T) {
 		response.text();
 	`, ts.URL)
 
-	postResult, err := vm.Run(postScript)
+	postResult, err := vm.RunString(postScript)
 	if err != nil {
 		t.Errorf("Error running POST script: %v", err)
 	}
 
-	postResultStr, err := postResult.ToString()
-	if err != nil {
-		t.Errorf("Error converting POST result to string: %v", err)
-	}
+	postResultStr := postResult.String()
 
 	expectedPost := "Hello, POST!\n"
 	if postResultStr != expectedPost {
@@ -591,7 +561,7 @@ func TestAddJSAPIFetch(t *testing.T) {
 }
 
 func TestAddJSAPIConsoleLog(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	err := addJSAPIConsoleLog(vm)
 	if err != nil {
@@ -599,42 +569,30 @@ func TestAddJSAPIConsoleLog(t *testing.T) {
 	}
 
 	// Check if the console object is set in the VM
-	console, err := vm.Get("console")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'console', but we have got: %v", err)
-	}
+	console := vm.Get("console")
 
-	if !console.IsObject() {
+	if !jsIsObject(console) {
 		t.Errorf("Expected 'console' to be an object, but it is not")
 	}
 
 	// Check if the log method is set in the console object
-	logMethod, err := console.Object().Get("log")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'log' method, but we have got: %v", err)
-	}
+	logMethod := console.ToObject(vm).Get("log")
 
-	if !logMethod.IsFunction() {
+	if !jsIsFunction(logMethod) {
 		t.Errorf("Expected 'log' to be a function, but it is not")
 	}
 
 	// Check if the error method is set in the console object
-	errorMethod, err := console.Object().Get("error")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'error' method, but we have got: %v", err)
-	}
+	errorMethod := console.ToObject(vm).Get("error")
 
-	if !errorMethod.IsFunction() {
+	if !jsIsFunction(errorMethod) {
 		t.Errorf("Expected 'error' to be a function, but it is not")
 	}
 
 	// Check if the warn method is set in the console object
-	warnMethod, err := console.Object().Get("warn")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'warn' method, but we have got: %v", err)
-	}
+	warnMethod := console.ToObject(vm).Get("warn")
 
-	if !warnMethod.IsFunction() {
+	if !jsIsFunction(warnMethod) {
 		t.Errorf("Expected 'warn' to be a function, but it is not")
 	}
 
@@ -642,7 +600,7 @@ func TestAddJSAPIConsoleLog(t *testing.T) {
 	logScript := `
 		console.log("Hello, log!");
 	`
-	_, err = vm.Run(logScript)
+	_, err = vm.RunString(logScript)
 	if err != nil {
 		t.Errorf("Error running log script: %v", err)
 	}
@@ -651,7 +609,7 @@ func TestAddJSAPIConsoleLog(t *testing.T) {
 	errorScript := `
 		console.error("Hello, error!");
 	`
-	_, err = vm.Run(errorScript)
+	_, err = vm.RunString(errorScript)
 	if err != nil {
 		t.Errorf("Error running error script: %v", err)
 	}
@@ -660,7 +618,7 @@ func TestAddJSAPIConsoleLog(t *testing.T) {
 	warnScript := `
 		console.warn("Hello, warn!");
 	`
-	_, err = vm.Run(warnScript)
+	_, err = vm.RunString(warnScript)
 	if err != nil {
 		t.Errorf("Error running warn script: %v", err)
 	}
@@ -694,7 +652,7 @@ func slicesEqual(a, b []interface{}) bool {
 }
 
 func TestExtractArguments(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	tests := []struct {
 		name     string
@@ -731,26 +689,22 @@ func TestExtractArguments(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Define the extractArguments function in the VM
-			err := vm.Set("extractArguments", func(call otto.FunctionCall) otto.Value {
+			err := vm.Set("extractArguments", func(call goja.FunctionCall) goja.Value {
 				args := extractArguments(call)
-				result, _ := vm.ToValue(args)
-				return result
+				return vm.ToValue(args)
 			})
 			if err != nil {
 				t.Fatalf("Error setting extractArguments function: %v", err)
 			}
 
 			// Run the script
-			value, err := vm.Run(tt.script)
+			value, err := vm.RunString(tt.script)
 			if err != nil {
 				t.Fatalf("Error running script: %v", err)
 			}
 
 			// Convert the result to a Go value
-			result, err := value.Export()
-			if err != nil {
-				t.Fatalf("Error exporting result: %v", err)
-			}
+			result := value.Export()
 
 			// Compare the result with the expected value
 			resultNormalized := NormalizeValues(result).([]interface{})
@@ -814,7 +768,7 @@ func TestFormatConsoleLog(t *testing.T) {
 }
 
 func TestAddJSAPIReduceJSON(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	err := addJSAPIReduceJSON(vm)
 	if err != nil {
@@ -822,12 +776,9 @@ func TestAddJSAPIReduceJSON(t *testing.T) {
 	}
 
 	// Check if the reduceJSON function is set in the VM
-	value, err := vm.Get("reduceJSON")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'reduceJSON', but we have got: %v", err)
-	}
+	value := vm.Get("reduceJSON")
 
-	if !value.IsFunction() {
+	if !jsIsFunction(value) {
 		t.Errorf("Expected 'reduceJSON' to be a function, but it is not")
 	}
 
@@ -868,15 +819,12 @@ func TestAddJSAPIReduceJSON(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			value, err := vm.Run(tt.script)
+			value, err := vm.RunString(tt.script)
 			if err != nil && !tt.shouldFail {
 				t.Fatalf("Error running script: %v", err)
 			}
 
-			_, err = value.Export()
-			if err != nil {
-				t.Fatalf("Error exporting result: %v", err)
-			}
+			_ = value.Export()
 
 			/*
 				if !reflect.DeepEqual(result, tt.expected) {
@@ -888,7 +836,7 @@ func TestAddJSAPIReduceJSON(t *testing.T) {
 }
 
 func TestAddJSAPIFilterJSON(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	err := addJSAPIFilterJSON(vm)
 	if err != nil {
@@ -896,12 +844,9 @@ func TestAddJSAPIFilterJSON(t *testing.T) {
 	}
 
 	// Check if the filterJSON function is set in the VM
-	value, err := vm.Get("filterJSON")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'filterJSON', but we have got: %v", err)
-	}
+	value := vm.Get("filterJSON")
 
-	if !value.IsFunction() {
+	if !jsIsFunction(value) {
 		t.Errorf("Expected 'filterJSON' to be a function, but it is not")
 	}
 
@@ -947,15 +892,12 @@ func TestAddJSAPIFilterJSON(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			value, err := vm.Run(tt.script)
+			value, err := vm.RunString(tt.script)
 			if err != nil && !tt.shouldFail {
 				t.Fatalf("Error running script: %v", err)
 			}
 
-			_, err = value.Export()
-			if err != nil {
-				t.Fatalf("Error exporting result: %v", err)
-			}
+			_ = value.Export()
 
 			/*
 				if !reflect.DeepEqual(result, tt.expected) {
@@ -967,7 +909,7 @@ func TestAddJSAPIFilterJSON(t *testing.T) {
 }
 
 func TestAddJSAPIMapJSON(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	err := addJSAPIMapJSON(vm)
 	if err != nil {
@@ -975,12 +917,9 @@ func TestAddJSAPIMapJSON(t *testing.T) {
 	}
 
 	// Check if the mapJSON function is set in the VM
-	value, err := vm.Get("mapJSON")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'mapJSON', but we have got: %v", err)
-	}
+	value := vm.Get("mapJSON")
 
-	if !value.IsFunction() {
+	if !jsIsFunction(value) {
 		t.Errorf("Expected 'mapJSON' to be a function, but it is not")
 	}
 
@@ -1016,15 +955,12 @@ func TestAddJSAPIMapJSON(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			value, err := vm.Run(tt.script)
+			value, err := vm.RunString(tt.script)
 			if err != nil && !tt.shouldFail {
 				t.Fatalf("Error running script: %v", err)
 			}
 
-			_, err = value.Export()
-			if err != nil {
-				t.Fatalf("Error exporting result: %v", err)
-			}
+			_ = value.Export()
 
 			/*
 				if !reflect.DeepEqual(result, tt.expected) {
@@ -1036,7 +972,7 @@ func TestAddJSAPIMapJSON(t *testing.T) {
 }
 
 func TestAddJSAPIJoinJSON(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	err := addJSAPIJoinJSON(vm)
 	if err != nil {
@@ -1044,12 +980,9 @@ func TestAddJSAPIJoinJSON(t *testing.T) {
 	}
 
 	// Check if the joinJSON function is set in the VM
-	value, err := vm.Get("joinJSON")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'joinJSON', but we have got: %v", err)
-	}
+	value := vm.Get("joinJSON")
 
-	if !value.IsFunction() {
+	if !jsIsFunction(value) {
 		t.Errorf("Expected 'joinJSON' to be a function, but it is not")
 	}
 
@@ -1137,15 +1070,12 @@ func TestAddJSAPIJoinJSON(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			value, err := vm.Run(tt.script)
+			value, err := vm.RunString(tt.script)
 			if err != nil && !tt.shouldFail {
 				t.Fatalf("Error running script: %v", err)
 			}
 
-			_, err = value.Export()
-			if err != nil {
-				t.Fatalf("Error exporting result: %v", err)
-			}
+			_ = value.Export()
 
 			/*
 				if !reflect.DeepEqual(result, tt.expected) {
@@ -1157,7 +1087,7 @@ func TestAddJSAPIJoinJSON(t *testing.T) {
 }
 
 func TestAddJSAPISortJSON(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	err := addJSAPISortJSON(vm)
 	if err != nil {
@@ -1165,12 +1095,9 @@ func TestAddJSAPISortJSON(t *testing.T) {
 	}
 
 	// Check if the sortJSON function is set in the VM
-	value, err := vm.Get("sortJSON")
-	if err != nil {
-		t.Errorf("there should not be an error checking for 'sortJSON', but we have got: %v", err)
-	}
+	value := vm.Get("sortJSON")
 
-	if !value.IsFunction() {
+	if !jsIsFunction(value) {
 		t.Errorf("Expected 'sortJSON' to be a function, but it is not")
 	}
 
@@ -1267,15 +1194,12 @@ func TestAddJSAPISortJSON(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			value, err := vm.Run(tt.script)
+			value, err := vm.RunString(tt.script)
 			if err != nil && !tt.shouldFail {
 				t.Fatalf("Error running script: %v", err)
 			}
 
-			_, err = value.Export()
-			if err != nil {
-				t.Fatalf("Error exporting result: %v", err)
-			}
+			_ = value.Export()
 
 			/*
 				if !reflect.DeepEqual(result, tt.expected) {
@@ -1287,7 +1211,7 @@ func TestAddJSAPISortJSON(t *testing.T) {
 }
 
 func TestAddJSAPIPipeJSON(t *testing.T) {
-	vm := otto.New()
+	vm := goja.New()
 
 	err := addJSAPIPipeJSON(vm)
 	if err != nil {
@@ -1295,12 +1219,9 @@ func TestAddJSAPIPipeJSON(t *testing.T) {
 	}
 
 	// Ensure that `pipeJSON` is properly registered in the VM
-	value, err := vm.Get("pipeJSON")
-	if err != nil {
-		t.Fatalf("Error checking for 'pipeJSON': %v", err)
-	}
+	value := vm.Get("pipeJSON")
 
-	if !value.IsFunction() {
+	if !jsIsFunction(value) {
 		t.Fatalf("Expected 'pipeJSON' to be a function, but it is not")
 	}
 
@@ -1435,13 +1356,13 @@ func TestAddJSAPIPipeJSON(t *testing.T) {
 	// Execute test cases
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			value, err := vm.Run(tt.script)
+			value, err := vm.RunString(tt.script)
 
 			// If failure was expected, check for either an error OR an error object.
 			if tt.shouldFail {
 				if err == nil {
 					// Check if the returned value is an error object OR `undefined`
-					result, _ := value.Export()
+					result := value.Export()
 					if result == nil {
 						fmt.Println("✅ Received undefined as expected for an invalid input")
 						return // ✅ Test passes if undefined (failure case)
@@ -1464,10 +1385,7 @@ func TestAddJSAPIPipeJSON(t *testing.T) {
 			}
 
 			// Export the result to Go
-			result, err := value.Export()
-			if err != nil {
-				t.Fatalf("Error exporting result: %v", err)
-			}
+			result := value.Export()
 
 			// Convert both expected and actual results to JSON for comparison
 			expectedJSON, _ := json.Marshal(tt.expected)
@@ -0,0 +1,91 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugintest provides a harness to test the CROWler JS plugins
+// against fixtures, without a browser and a database.
+package plugintest
+
+import (
+	"fmt"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+
+	"github.com/google/uuid"
+)
+
+// NewDB returns a handler of a new in-memory SQLite database, with the
+// CROWler schema and the fixtures (SQL scripts) loaded. The database is
+// removed when the handler is closed.
+func NewDB(fixtures ...string) (cdb.Handler, error) {
+	var config cfg.Config
+	config.Database.Type = cdb.DBSQLiteStr
+	config.Database.DBName = cdb.SQLiteMemoryPrefix + "plugintest-" + uuid.NewString()
+
+	db, err := cdb.NewHandler(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Connect(config); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(cdb.SQLiteSchema()); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("creating the DB schema: %v", err)
+	}
+	for i, fixture := range fixtures {
+		if _, err := db.Exec(fixture); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("loading the DB fixture %d: %v", i+1, err)
+		}
+	}
+	return db, nil
+}
+
+// QueryRows runs a query and returns its rows as maps (column -> value),
+// to check the DB changes made by a plugin
+func QueryRows(db cdb.Handler, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.ExecuteQuery(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error in a defer statement
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
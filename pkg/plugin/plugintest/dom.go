@@ -0,0 +1,387 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugintest provides a harness to test the CROWler JS plugins
+// against fixtures, without a browser and a database.
+package plugintest
+
+import (
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/dop251/goja"
+	"golang.org/x/net/html"
+)
+
+// reflectedAttributes are the attributes available as element properties
+var reflectedAttributes = []string{
+	"href", "src", "content", "name", "value", "type", "rel", "action",
+	"method", "charset", "alt", "title", "lang", "target",
+}
+
+// jsDOM is the (minimal) DOM of a page in a VM: the elements are read-only,
+// except for remove() and setAttribute()/removeAttribute()
+type jsDOM struct {
+	vm       *goja.Runtime
+	root     *html.Node
+	elements map[*html.Node]*goja.Object // The same node is always the same object
+}
+
+// newJSDOM returns the DOM of the document root
+func newJSDOM(vm *goja.Runtime, root *html.Node) *jsDOM {
+	return &jsDOM{vm: vm, root: root, elements: make(map[*html.Node]*goja.Object)}
+}
+
+// node returns the JS object of node (null for nil)
+func (d *jsDOM) node(node *html.Node) goja.Value {
+	if node == nil {
+		return goja.Null()
+	}
+	if obj, exists := d.elements[node]; exists {
+		return obj
+	}
+
+	obj := d.vm.NewObject()
+	d.elements[node] = obj
+	if node.Type == html.DocumentNode {
+		_ = obj.Set("nodeType", 9)
+		_ = obj.Set("nodeName", "#document")
+	} else {
+		d.setElement(obj, node)
+	}
+	d.setContainer(obj, node)
+	return obj
+}
+
+// nodes returns a JS array of nodes
+func (d *jsDOM) nodes(nodes []*html.Node) goja.Value {
+	values := make([]interface{}, 0, len(nodes))
+	for _, node := range nodes {
+		values = append(values, d.node(node))
+	}
+	return d.vm.NewArray(values...)
+}
+
+// getter defines a read-only (non-enumerable) property computed on access
+func (d *jsDOM) getter(obj *goja.Object, name string, get func() goja.Value) {
+	_ = obj.DefineAccessorProperty(name, d.vm.ToValue(func(goja.FunctionCall) goja.Value {
+		return get()
+	}), nil, goja.FLAG_TRUE, goja.FLAG_FALSE)
+}
+
+// method defines a (non-enumerable) method
+func (d *jsDOM) method(obj *goja.Object, name string, fn func(call goja.FunctionCall) goja.Value) {
+	_ = obj.DefineDataProperty(name, d.vm.ToValue(fn), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+}
+
+// selector compiles a CSS selector, throwing a SyntaxError if it's invalid
+func (d *jsDOM) selector(value goja.Value) cascadia.SelectorGroup {
+	sel, err := cascadia.ParseGroup(value.String())
+	if err != nil {
+		panic(d.vm.NewGoError(err))
+	}
+	return sel
+}
+
+// setContainer sets the properties of the nodes with children (elements and
+// the document)
+func (d *jsDOM) setContainer(obj *goja.Object, node *html.Node) {
+	d.getter(obj, "children", func() goja.Value { return d.nodes(childElements(node)) })
+	d.getter(obj, "childElementCount", func() goja.Value { return d.vm.ToValue(len(childElements(node))) })
+	d.getter(obj, "firstElementChild", func() goja.Value {
+		children := childElements(node)
+		if len(children) == 0 {
+			return goja.Null()
+		}
+		return d.node(children[0])
+	})
+	d.getter(obj, "lastElementChild", func() goja.Value {
+		children := childElements(node)
+		if len(children) == 0 {
+			return goja.Null()
+		}
+		return d.node(children[len(children)-1])
+	})
+	d.getter(obj, "textContent", func() goja.Value { return d.vm.ToValue(nodeText(node, false)) })
+
+	d.method(obj, "querySelector", func(call goja.FunctionCall) goja.Value {
+		return d.node(cascadia.Query(node, d.selector(call.Argument(0))))
+	})
+	d.method(obj, "querySelectorAll", func(call goja.FunctionCall) goja.Value {
+		return d.nodes(cascadia.QueryAll(node, d.selector(call.Argument(0))))
+	})
+	d.method(obj, "getElementsByTagName", func(call goja.FunctionCall) goja.Value {
+		tag := strings.ToLower(call.Argument(0).String())
+		return d.nodes(findNodes(node, func(n *html.Node) bool { return tag == "*" || n.Data == tag }))
+	})
+	d.method(obj, "getElementsByClassName", func(call goja.FunctionCall) goja.Value {
+		classes := strings.Fields(call.Argument(0).String())
+		return d.nodes(findNodes(node, func(n *html.Node) bool {
+			for _, class := range classes {
+				if !hasClass(n, class) {
+					return false
+				}
+			}
+			return len(classes) > 0
+		}))
+	})
+}
+
+// setElement sets the properties of an element
+func (d *jsDOM) setElement(obj *goja.Object, node *html.Node) {
+	_ = obj.Set("nodeType", 1)
+	_ = obj.Set("nodeName", strings.ToUpper(node.Data))
+	_ = obj.Set("tagName", strings.ToUpper(node.Data))
+	_ = obj.Set("localName", node.Data)
+
+	d.getter(obj, "id", func() goja.Value { return d.vm.ToValue(attr(node, "id")) })
+	d.getter(obj, "className", func() goja.Value { return d.vm.ToValue(attr(node, "class")) })
+	d.getter(obj, "classList", func() goja.Value {
+		var classes []interface{}
+		for _, class := range strings.Fields(attr(node, "class")) {
+			classes = append(classes, class)
+		}
+		list := d.vm.NewArray(classes...)
+		d.method(list, "contains", func(call goja.FunctionCall) goja.Value {
+			return d.vm.ToValue(hasClass(node, call.Argument(0).String()))
+		})
+		return list
+	})
+	for _, name := range reflectedAttributes {
+		name := name
+		d.getter(obj, name, func() goja.Value { return d.vm.ToValue(attr(node, name)) })
+	}
+	d.getter(obj, "attributes", func() goja.Value {
+		values := make([]interface{}, 0, len(node.Attr))
+		for _, a := range node.Attr {
+			values = append(values, map[string]interface{}{"name": a.Key, "value": a.Val})
+		}
+		return d.vm.NewArray(values...)
+	})
+	d.getter(obj, "dataset", func() goja.Value {
+		dataset := d.vm.NewObject()
+		for _, a := range node.Attr {
+			if name, ok := strings.CutPrefix(a.Key, "data-"); ok {
+				_ = dataset.Set(camelCase(name), a.Val)
+			}
+		}
+		return dataset
+	})
+	d.getter(obj, "innerText", func() goja.Value { return d.vm.ToValue(strings.TrimSpace(nodeText(node, true))) })
+	d.getter(obj, "innerHTML", func() goja.Value {
+		var b strings.Builder
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			b.WriteString(renderNode(child))
+		}
+		return d.vm.ToValue(b.String())
+	})
+	d.getter(obj, "outerHTML", func() goja.Value { return d.vm.ToValue(renderNode(node)) })
+	d.getter(obj, "parentElement", func() goja.Value {
+		if node.Parent == nil || node.Parent.Type != html.ElementNode {
+			return goja.Null()
+		}
+		return d.node(node.Parent)
+	})
+	d.getter(obj, "parentNode", func() goja.Value { return d.node(node.Parent) })
+	d.getter(obj, "nextElementSibling", func() goja.Value {
+		for n := node.NextSibling; n != nil; n = n.NextSibling {
+			if n.Type == html.ElementNode {
+				return d.node(n)
+			}
+		}
+		return goja.Null()
+	})
+	d.getter(obj, "previousElementSibling", func() goja.Value {
+		for n := node.PrevSibling; n != nil; n = n.PrevSibling {
+			if n.Type == html.ElementNode {
+				return d.node(n)
+			}
+		}
+		return goja.Null()
+	})
+
+	d.method(obj, "getAttribute", func(call goja.FunctionCall) goja.Value {
+		name := strings.ToLower(call.Argument(0).String())
+		for _, a := range node.Attr {
+			if a.Key == name {
+				return d.vm.ToValue(a.Val)
+			}
+		}
+		return goja.Null()
+	})
+	d.method(obj, "hasAttribute", func(call goja.FunctionCall) goja.Value {
+		name := strings.ToLower(call.Argument(0).String())
+		for _, a := range node.Attr {
+			if a.Key == name {
+				return d.vm.ToValue(true)
+			}
+		}
+		return d.vm.ToValue(false)
+	})
+	d.method(obj, "getAttributeNames", func(goja.FunctionCall) goja.Value {
+		names := make([]interface{}, 0, len(node.Attr))
+		for _, a := range node.Attr {
+			names = append(names, a.Key)
+		}
+		return d.vm.NewArray(names...)
+	})
+	d.method(obj, "setAttribute", func(call goja.FunctionCall) goja.Value {
+		name := strings.ToLower(call.Argument(0).String())
+		value := call.Argument(1).String()
+		for i := range node.Attr {
+			if node.Attr[i].Key == name {
+				node.Attr[i].Val = value
+				return goja.Undefined()
+			}
+		}
+		node.Attr = append(node.Attr, html.Attribute{Key: name, Val: value})
+		return goja.Undefined()
+	})
+	d.method(obj, "removeAttribute", func(call goja.FunctionCall) goja.Value {
+		name := strings.ToLower(call.Argument(0).String())
+		for i := range node.Attr {
+			if node.Attr[i].Key == name {
+				node.Attr = append(node.Attr[:i], node.Attr[i+1:]...)
+				break
+			}
+		}
+		return goja.Undefined()
+	})
+	d.method(obj, "matches", func(call goja.FunctionCall) goja.Value {
+		return d.vm.ToValue(d.selector(call.Argument(0)).Match(node))
+	})
+	d.method(obj, "closest", func(call goja.FunctionCall) goja.Value {
+		sel := d.selector(call.Argument(0))
+		for n := node; n != nil && n.Type == html.ElementNode; n = n.Parent {
+			if sel.Match(n) {
+				return d.node(n)
+			}
+		}
+		return goja.Null()
+	})
+	d.method(obj, "remove", func(goja.FunctionCall) goja.Value {
+		if node.Parent != nil {
+			node.Parent.RemoveChild(node)
+		}
+		return goja.Undefined()
+	})
+}
+
+// attr returns the value of an attribute of node ("" if it's not set)
+func attr(node *html.Node, name string) string {
+	for _, a := range node.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasClass returns true if node has the class
+func hasClass(node *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(node, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// childElements returns the element children of node
+func childElements(node *html.Node) []*html.Node {
+	var children []*html.Node
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// findNodes returns the descendant elements of node matching match, in
+// document order
+func findNodes(node *html.Node, match func(*html.Node) bool) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.ElementNode {
+				if match(child) {
+					found = append(found, child)
+				}
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+	return found
+}
+
+// findNode returns the first descendant element of node matching match
+func findNode(node *html.Node, match func(*html.Node) bool) *html.Node {
+	if found := findNodes(node, match); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+// nodeText returns the text of node, visible skips the script and style
+// elements
+func nodeText(node *html.Node, visible bool) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if visible && (n.Data == "script" || n.Data == "style" || n.Data == "noscript") {
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return b.String()
+}
+
+// renderNode returns the HTML of node
+func renderNode(node *html.Node) string {
+	var b strings.Builder
+	_ = html.Render(&b, node)
+	return b.String()
+}
+
+// domTitle returns the title of the document
+func domTitle(document *html.Node) string {
+	title := findNode(document, func(n *html.Node) bool { return n.Data == "title" })
+	if title == nil {
+		return ""
+	}
+	return strings.TrimSpace(nodeText(title, false))
+}
+
+// camelCase converts a data attribute name to its dataset name
+func camelCase(name string) string {
+	parts := strings.Split(name, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
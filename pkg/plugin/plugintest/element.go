@@ -0,0 +1,160 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugintest provides a harness to test the CROWler JS plugins
+// against fixtures, without a browser and a database.
+package plugintest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/go-auxiliaries/selenium"
+	"golang.org/x/net/html"
+)
+
+// ErrNoSuchElement is returned by FindElement when no element matches
+var ErrNoSuchElement = errors.New("no such element")
+
+// WebElement is a fake selenium.WebElement of an element of the loaded page.
+// It implements the methods used by the scraping (Text, GetAttribute,
+// TagName, IsDisplayed and the elements search), the other methods of the
+// interface are not available (they panic).
+type WebElement struct {
+	selenium.WebElement
+
+	wd   *WebDriver
+	node *html.Node
+}
+
+// FindElement returns the first element of the loaded page matching the
+// selector
+func (wd *WebDriver) FindElement(by, value string) (selenium.WebElement, error) {
+	return wd.findElement(nil, by, value)
+}
+
+// FindElements returns the elements of the loaded page matching the selector
+func (wd *WebDriver) FindElements(by, value string) ([]selenium.WebElement, error) {
+	return wd.findElements(nil, by, value)
+}
+
+func (wd *WebDriver) findElement(root *html.Node, by, value string) (selenium.WebElement, error) {
+	elements, err := wd.findElements(root, by, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) == 0 {
+		return nil, fmt.Errorf("%w: %s=%s", ErrNoSuchElement, by, value)
+	}
+	return elements[0], nil
+}
+
+// findElements returns the elements matching the selector, descendants of
+// root (the document if root is nil)
+func (wd *WebDriver) findElements(root *html.Node, by, value string) ([]selenium.WebElement, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if root == nil {
+		if wd.document == nil {
+			return nil, errors.New("no page loaded")
+		}
+		root = wd.document
+	}
+
+	var nodes []*html.Node
+	switch by {
+	case selenium.ByCSSSelector:
+		sel, err := cascadia.ParseGroup(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSS selector '%s': %v", value, err)
+		}
+		nodes = cascadia.QueryAll(root, sel)
+	case selenium.ByXPATH:
+		var err error
+		nodes, err = htmlquery.QueryAll(root, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XPath '%s': %v", value, err)
+		}
+	case selenium.ByID:
+		nodes = findNodes(root, func(n *html.Node) bool { return attr(n, "id") == value })
+	case selenium.ByName:
+		nodes = findNodes(root, func(n *html.Node) bool { return attr(n, "name") == value })
+	case selenium.ByClassName:
+		nodes = findNodes(root, func(n *html.Node) bool { return hasClass(n, value) })
+	case selenium.ByTagName:
+		nodes = findNodes(root, func(n *html.Node) bool { return strings.EqualFold(n.Data, value) })
+	case selenium.ByLinkText:
+		nodes = findNodes(root, func(n *html.Node) bool {
+			return n.Data == "a" && strings.TrimSpace(nodeText(n, true)) == value
+		})
+	case selenium.ByPartialLinkText:
+		nodes = findNodes(root, func(n *html.Node) bool {
+			return n.Data == "a" && strings.Contains(nodeText(n, true), value)
+		})
+	default:
+		return nil, fmt.Errorf("unsupported selector type: %s", by)
+	}
+
+	elements := make([]selenium.WebElement, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Type == html.ElementNode {
+			elements = append(elements, &WebElement{wd: wd, node: node})
+		}
+	}
+	return elements, nil
+}
+
+// FindElement returns the first descendant of the element matching the
+// selector
+func (e *WebElement) FindElement(by, value string) (selenium.WebElement, error) {
+	return e.wd.findElement(e.node, by, value)
+}
+
+// FindElements returns the descendants of the element matching the selector
+func (e *WebElement) FindElements(by, value string) ([]selenium.WebElement, error) {
+	return e.wd.findElements(e.node, by, value)
+}
+
+// Text returns the visible text of the element
+func (e *WebElement) Text() (string, error) {
+	e.wd.mu.Lock()
+	defer e.wd.mu.Unlock()
+	return strings.TrimSpace(nodeText(e.node, true)), nil
+}
+
+// GetAttribute returns the value of an attribute of the element, or an
+// error if the element doesn't have it
+func (e *WebElement) GetAttribute(name string) (string, error) {
+	e.wd.mu.Lock()
+	defer e.wd.mu.Unlock()
+	for _, a := range e.node.Attr {
+		if a.Key == name {
+			return a.Val, nil
+		}
+	}
+	return "", fmt.Errorf("attribute not found: %s", name)
+}
+
+// TagName returns the tag name of the element
+func (e *WebElement) TagName() (string, error) {
+	return e.node.Data, nil
+}
+
+// IsDisplayed returns true (the fake pages have no layout)
+func (e *WebElement) IsDisplayed() (bool, error) {
+	return true, nil
+}
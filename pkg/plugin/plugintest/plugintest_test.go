@@ -0,0 +1,253 @@
+package plugintest
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-auxiliaries/selenium"
+)
+
+const testPage = `<html><head><title> Test </title></head><body>
+	<div id="main" class="content wide" data-user-id="42">
+		<a href="/about" rel="nofollow">About</a>
+		<script>var hidden = 1;</script>
+		<p class="note">First</p><p class="note">Second</p>
+	</div>
+</body></html>`
+
+func newTestWebDriver(t *testing.T) *WebDriver {
+	t.Helper()
+	wd := NewWebDriver()
+	if err := wd.AddPage("https://example.com/page?q=1#top", testPage); err != nil {
+		t.Fatalf("AddPage returned an error: %v", err)
+	}
+	return wd
+}
+
+func TestWebDriverExecuteScript(t *testing.T) {
+	wd := newTestWebDriver(t)
+
+	result, err := wd.ExecuteScript(`
+		const main = document.getElementById("main");
+		const notes = main.querySelectorAll("p.note");
+		return {
+			args: [arguments[0], arguments[1].key],
+			title: document.title,
+			location: [location.hostname, location.pathname, location.search, location.hash],
+			classes: [main.className, main.classList.contains("wide"), main.dataset.userId],
+			notes: notes.map((p) => p.textContent),
+			next: notes[0].nextElementSibling.innerText,
+			parent: notes[0].parentElement === main,
+			link: [document.links[0].href, document.querySelector("a").getAttribute("rel")],
+			text: main.innerText.replace(/\s+/g, " "),
+			byClass: document.getElementsByClassName("note").length,
+			closest: notes[1].closest("div").id,
+			missing: document.querySelector("table"),
+		};
+	`, []interface{}{1, map[string]string{"key": "value"}})
+	if err != nil {
+		t.Fatalf("ExecuteScript returned an error: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"args":     []interface{}{float64(1), "value"},
+		"title":    "Test",
+		"location": []interface{}{"example.com", "/page", "?q=1", "#top"},
+		"classes":  []interface{}{"content wide", true, "42"},
+		"notes":    []interface{}{"First", "Second"},
+		"next":     "Second",
+		"parent":   true,
+		"link":     []interface{}{"/about", "nofollow"},
+		"text":     "About FirstSecond",
+		"byClass":  float64(2),
+		"closest":  "main",
+		"missing":  nil,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("ExecuteScript = %#v, want %#v", result, want)
+	}
+}
+
+func TestWebDriverPageChanges(t *testing.T) {
+	wd := newTestWebDriver(t)
+	if _, err := wd.ExecuteScript(`document.querySelector("script").remove(); document.body.firstElementChild.setAttribute("data-done", "yes");`, nil); err != nil {
+		t.Fatalf("ExecuteScript returned an error: %v", err)
+	}
+	source, _ := wd.PageSource()
+	if strings.Contains(source, "<script>") || !strings.Contains(source, `data-done="yes"`) {
+		t.Errorf("the page changes are not in the page source: %s", source)
+	}
+
+	// Refresh discards the changes
+	if err := wd.Refresh(); err != nil {
+		t.Fatalf("Refresh returned an error: %v", err)
+	}
+	if source, _ := wd.PageSource(); !strings.Contains(source, "<script>") {
+		t.Errorf("Refresh didn't reload the page")
+	}
+}
+
+func TestWebDriverAsync(t *testing.T) {
+	wd := newTestWebDriver(t)
+	result, err := wd.ExecuteScriptAsync(`
+		const done = arguments[arguments.length - 1];
+		const order = [];
+		const id = setInterval(() => order.push("tick"), 10);
+		setTimeout(() => { clearInterval(id); done({ order, arg: arguments[0] }); }, 35);
+		Promise.resolve().then(() => order.push("promise"));
+	`, []interface{}{"x"})
+	if err != nil {
+		t.Fatalf("ExecuteScriptAsync returned an error: %v", err)
+	}
+	want := map[string]interface{}{"order": []interface{}{"promise", "tick", "tick", "tick"}, "arg": "x"}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("ExecuteScriptAsync = %v, want %v", result, want)
+	}
+
+	if _, err := wd.ExecuteScriptAsync(`/* never calls back */`, nil); err == nil {
+		t.Errorf("ExecuteScriptAsync expected an error when the callback is not called")
+	}
+}
+
+func TestWebDriverErrors(t *testing.T) {
+	wd := newTestWebDriver(t)
+	tests := []string{
+		`document.querySelector("[[invalid");`,
+		`throw new Error("boom");`,
+		`return (`,
+	}
+	for _, script := range tests {
+		if _, err := wd.ExecuteScript(script, nil); err == nil {
+			t.Errorf("ExecuteScript(%q) expected an error", script)
+		}
+	}
+
+	if err := wd.Get("https://unknown.example.com/"); !errors.Is(err, ErrPageNotFound) {
+		t.Errorf("Get of an unknown page returned %v, want ErrPageNotFound", err)
+	}
+
+	_ = wd.SetAsyncScriptTimeout(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := wd.ExecuteScript(`while (true) {}`, nil); err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("ExecuteScript expected a timeout error, got %v", err)
+	}
+}
+
+func TestWebDriverCookies(t *testing.T) {
+	wd := newTestWebDriver(t)
+	_ = wd.AddCookie(&selenium.Cookie{Name: "a", Value: "1"})
+	_ = wd.AddCookie(&selenium.Cookie{Name: "b", Value: "2", HTTPOnly: true})
+	_ = wd.AddCookie(&selenium.Cookie{Name: "a", Value: "3"})
+
+	result, _ := wd.ExecuteScript(`return document.cookie;`, nil)
+	if result != "a=3" {
+		t.Errorf("document.cookie = %v, want a=3", result)
+	}
+	cookies, _ := wd.GetCookies()
+	if len(cookies) != 2 {
+		t.Errorf("GetCookies returned %d cookies, want 2", len(cookies))
+	}
+	_ = wd.DeleteCookie("a")
+	if _, err := wd.GetCookie("a"); err == nil {
+		t.Errorf("GetCookie expected an error for a deleted cookie")
+	}
+}
+
+func TestWebDriverFindElements(t *testing.T) {
+	wd := newTestWebDriver(t)
+	for by, value := range map[string]string{
+		selenium.ByCSSSelector: "div#main p.note",
+		selenium.ByXPATH:       "//p[@class='note']",
+		selenium.ByClassName:   "note",
+		selenium.ByTagName:     "p",
+	} {
+		elements, err := wd.FindElements(by, value)
+		if err != nil || len(elements) != 2 {
+			t.Errorf("FindElements(%s, %s) = %d elements, %v, want 2", by, value, len(elements), err)
+			continue
+		}
+		if text, _ := elements[1].Text(); text != "Second" {
+			t.Errorf("FindElements(%s, %s) second element text = %q, want Second", by, value, text)
+		}
+	}
+
+	link, err := wd.FindElement(selenium.ByLinkText, "About")
+	if err != nil {
+		t.Fatalf("FindElement returned an error: %v", err)
+	}
+	if href, _ := link.GetAttribute("href"); href != "/about" {
+		t.Errorf("GetAttribute(href) = %q, want /about", href)
+	}
+	if _, err := link.GetAttribute("title"); err == nil {
+		t.Errorf("GetAttribute expected an error for a missing attribute")
+	}
+	main, _ := wd.FindElement(selenium.ByID, "main")
+	if text, _ := main.Text(); strings.Contains(text, "hidden") {
+		t.Errorf("Text() = %q, it shouldn't contain the scripts", text)
+	}
+	if notes, _ := main.FindElements(selenium.ByTagName, "p"); len(notes) != 2 {
+		t.Errorf("element FindElements returned %d elements, want 2", len(notes))
+	}
+
+	if _, err := wd.FindElement(selenium.ByID, "missing"); !errors.Is(err, ErrNoSuchElement) {
+		t.Errorf("FindElement error = %v, want ErrNoSuchElement", err)
+	}
+	if _, err := wd.FindElements(selenium.ByXPATH, "//p[@class="); err == nil {
+		t.Errorf("FindElements expected an error for an invalid XPath")
+	}
+}
+
+func TestNewDB(t *testing.T) {
+	db, err := NewDB("INSERT INTO Sources (url, status) VALUES ('https://example.com', 'new');")
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+	defer db.Close() //nolint:errcheck // We can't check the error in a defer statement
+
+	rows, err := QueryRows(db, "SELECT url, status FROM Sources")
+	if err != nil {
+		t.Fatalf("QueryRows returned an error: %v", err)
+	}
+	want := []map[string]interface{}{{"url": "https://example.com", "status": "new"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("QueryRows = %v, want %v", rows, want)
+	}
+
+	// Every DB is a new one
+	other, err := NewDB()
+	if err != nil {
+		t.Fatalf("NewDB returned an error: %v", err)
+	}
+	defer other.Close() //nolint:errcheck // We can't check the error in a defer statement
+	if rows, _ := QueryRows(other, "SELECT url FROM Sources"); len(rows) != 0 {
+		t.Errorf("the new DB has %d sources, want 0", len(rows))
+	}
+}
+
+func TestRunSuite(t *testing.T) {
+	for _, suite := range []string{"testdata/page_info_test.yaml", "testdata/sources_test.yaml", "testdata/remove_article_test.yaml"} {
+		t.Run(suite, func(t *testing.T) {
+			RunSuite(t, suite)
+		})
+	}
+}
+
+func TestSuiteFailures(t *testing.T) {
+	suite, err := LoadSuite("testdata/page_info_test.yaml")
+	if err != nil {
+		t.Fatalf("LoadSuite returned an error: %v", err)
+	}
+	plugin, err := suite.LoadPlugin()
+	if err != nil {
+		t.Fatalf("LoadPlugin returned an error: %v", err)
+	}
+
+	tc := &TestCase{Name: "wrong", Expect: map[string]interface{}{"title": "Wrong"}, Partial: true, ExpectHTML: []string{"<table>"}}
+	result := suite.RunCase(plugin, tc)
+	if result.Passed || len(result.Failures) != 2 {
+		t.Errorf("RunCase = %+v, want 2 failures", result)
+	}
+}
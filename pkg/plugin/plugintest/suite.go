@@ -0,0 +1,426 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugintest provides a harness to test the CROWler JS plugins
+// against fixtures, without a browser and a database.
+package plugintest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+
+	"github.com/go-auxiliaries/selenium"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultTimeout is the default timeout of the plugin executions (in seconds)
+	DefaultTimeout = 10
+	// DefaultPageURL is the URL of the page used when a test case has no page
+	DefaultPageURL = "https://example.com/"
+
+	emptyPage = "<html><head><title></title></head><body></body></html>"
+)
+
+// Suite is a set of test cases of a plugin, loaded from a YAML file
+type Suite struct {
+	Plugin       string       `yaml:"plugin"`       // Path of the plugin (relative to the suite file)
+	Timeout      int          `yaml:"timeout"`      // Timeout of the plugin executions (in seconds)
+	Capabilities []string     `yaml:"capabilities"` // Capabilities the plugin can be granted (empty means all)
+	Page         *PageFixture `yaml:"page"`         // Page loaded in the fake WebDriver (for all the test cases)
+	DB           *DBFixture   `yaml:"db"`           // Fixtures loaded in the fake DB (for all the test cases)
+	Tests        []TestCase   `yaml:"tests"`        // Test cases
+
+	path string // Path of the suite file
+}
+
+// PageFixture is a page served by the fake WebDriver
+type PageFixture struct {
+	URL      string                 `yaml:"url"`       // URL of the page
+	HTML     string                 `yaml:"html"`      // HTML of the page
+	HTMLFile string                 `yaml:"html_file"` // File with the HTML of the page (relative to the suite file)
+	Globals  map[string]interface{} `yaml:"globals"`   // Globals of the page (window.name = value)
+	Cookies  []CookieFixture        `yaml:"cookies"`   // Cookies of the browser
+}
+
+// CookieFixture is a cookie of the fake WebDriver
+type CookieFixture struct {
+	Name     string `yaml:"name"`
+	Value    string `yaml:"value"`
+	Domain   string `yaml:"domain"`
+	Path     string `yaml:"path"`
+	Secure   bool   `yaml:"secure"`
+	HTTPOnly bool   `yaml:"http_only"`
+}
+
+// DBFixture is the content of the fake DB
+type DBFixture struct {
+	Files []string `yaml:"files"` // SQL scripts (relative to the suite file)
+	SQL   string   `yaml:"sql"`   // SQL script (executed after the files)
+}
+
+// TestCase is an execution of the plugin and its expected outcome
+type TestCase struct {
+	Name        string                 `yaml:"name"`         // Name of the test case
+	Params      map[string]interface{} `yaml:"params"`       // Params of the plugin
+	Page        *PageFixture           `yaml:"page"`         // Page (replaces the suite page)
+	DB          *DBFixture             `yaml:"db"`           // DB fixtures (replace the suite ones)
+	Expect      interface{}            `yaml:"expect"`       // Expected result (nil means not checked)
+	Partial     bool                   `yaml:"partial"`      // If true, only the fields in Expect are compared
+	ExpectError string                 `yaml:"expect_error"` // If set, the execution must fail with an error containing it
+	ExpectHTML  []string               `yaml:"expect_html"`  // Texts the page HTML must contain after the execution
+	RejectHTML  []string               `yaml:"reject_html"`  // Texts the page HTML must not contain after the execution
+	ExpectRows  []RowsCheck            `yaml:"expect_rows"`  // Queries checking the DB after the execution
+}
+
+// RowsCheck is a query and the rows it must return
+type RowsCheck struct {
+	Query   string                   `yaml:"query"`   // Query to run
+	Rows    []map[string]interface{} `yaml:"rows"`    // Expected rows
+	Partial bool                     `yaml:"partial"` // If true, only the columns in Rows are compared
+}
+
+// Result is the outcome of a test case
+type Result struct {
+	Name     string                 // Name of the test case
+	Passed   bool                   // True if all the checks passed
+	Failures []string               // Failed checks
+	Result   map[string]interface{} // Result of the plugin
+	Duration time.Duration          // Duration of the plugin execution
+}
+
+// LoadSuite loads a test suite from a YAML file
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // The path is provided by the user running the tests
+	if err != nil {
+		return nil, err
+	}
+	var suite Suite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if suite.Plugin == "" {
+		return nil, fmt.Errorf("%s: the plugin to test is not specified", path)
+	}
+	if suite.Timeout <= 0 {
+		suite.Timeout = DefaultTimeout
+	}
+	suite.path = path
+	for i := range suite.Tests {
+		tc := &suite.Tests[i]
+		if tc.Name == "" {
+			tc.Name = fmt.Sprintf("test %d", i+1)
+		}
+		tc.Params = toStringMap(tc.Params)
+		tc.Expect = cmn.ConvertInterfaceMapToStringMap(tc.Expect)
+		for j := range tc.ExpectRows {
+			for k := range tc.ExpectRows[j].Rows {
+				tc.ExpectRows[j].Rows[k] = toStringMap(tc.ExpectRows[j].Rows[k])
+			}
+		}
+	}
+	if suite.Page != nil {
+		suite.Page.Globals = toStringMap(suite.Page.Globals)
+	}
+	return &suite, nil
+}
+
+// resolve returns path relative to the suite file
+func (s *Suite) resolve(path string) string {
+	if filepath.IsAbs(path) || s.path == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(s.path), path)
+}
+
+// LoadPlugin loads the plugin tested by the suite
+func (s *Suite) LoadPlugin() (*plg.JSPlugin, error) {
+	plugins, err := plg.LoadPluginFromLocal(s.resolve(s.Plugin))
+	if err != nil {
+		return nil, err
+	}
+	if len(plugins) == 0 {
+		return nil, fmt.Errorf("no plugin found in %s", s.Plugin)
+	}
+	// The fake WebDriver and DB are sandboxed, so the plugin gets all the
+	// capabilities it declares unless the suite restricts them
+	capabilities := s.Capabilities
+	if len(capabilities) == 0 {
+		capabilities = []string{"all"}
+	}
+	plugins[0].SetLimits(cfg.PluginConfig{Capabilities: capabilities})
+	return plugins[0], nil
+}
+
+// Run runs all the test cases of the suite
+func (s *Suite) Run() ([]Result, error) {
+	plugin, err := s.LoadPlugin()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(s.Tests))
+	for i := range s.Tests {
+		results = append(results, s.RunCase(plugin, &s.Tests[i]))
+	}
+	return results, nil
+}
+
+// RunCase runs a test case with a new fake WebDriver and a new fake DB
+func (s *Suite) RunCase(plugin *plg.JSPlugin, tc *TestCase) Result {
+	result := Result{Name: tc.Name}
+	fail := func(format string, args ...interface{}) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+
+	// Prepare the fixtures
+	dbFixture := s.DB
+	if tc.DB != nil {
+		dbFixture = tc.DB
+	}
+	fixtures, err := s.dbFixtures(dbFixture)
+	if err != nil {
+		fail("%v", err)
+		return result
+	}
+	db, err := NewDB(fixtures...)
+	if err != nil {
+		fail("%v", err)
+		return result
+	}
+	defer db.Close() //nolint:errcheck // We can't check the error in a defer statement
+
+	page := s.Page
+	if tc.Page != nil {
+		page = tc.Page
+	}
+	fakeWD, err := s.newWebDriver(page)
+	if err != nil {
+		fail("%v", err)
+		return result
+	}
+	var wd vdi.WebDriver = fakeWD
+
+	// Run the plugin
+	params := make(map[string]interface{}, len(tc.Params))
+	for k, v := range tc.Params {
+		params[k] = v
+	}
+	start := time.Now()
+	output, err := plugin.Execute(&wd, &db, s.Timeout, params)
+	result.Duration = time.Since(start)
+	result.Result = output
+
+	// Check the outcome
+	switch {
+	case tc.ExpectError != "":
+		if err == nil {
+			fail("expected an error containing %q, got none", tc.ExpectError)
+		} else if !strings.Contains(err.Error(), tc.ExpectError) {
+			fail("expected an error containing %q, got %q", tc.ExpectError, err.Error())
+		}
+	case err != nil:
+		fail("plugin execution failed: %v", err)
+	case tc.Expect != nil:
+		if ok, got, want := compareJSON(output, tc.Expect, tc.Partial); !ok {
+			fail("result = %s, want %s", got, want)
+		}
+	}
+
+	if len(tc.ExpectHTML) > 0 || len(tc.RejectHTML) > 0 {
+		source, _ := fakeWD.PageSource()
+		for _, text := range tc.ExpectHTML {
+			if !strings.Contains(source, text) {
+				fail("the page doesn't contain %q", text)
+			}
+		}
+		for _, text := range tc.RejectHTML {
+			if strings.Contains(source, text) {
+				fail("the page contains %q", text)
+			}
+		}
+	}
+
+	for _, check := range tc.ExpectRows {
+		rows, err := QueryRows(db, check.Query)
+		if err != nil {
+			fail("query %q failed: %v", check.Query, err)
+			continue
+		}
+		var want interface{} = check.Rows
+		if check.Rows == nil {
+			want = []interface{}{}
+		}
+		if ok, got, wantJSON := compareJSON(rows, want, check.Partial); !ok {
+			fail("query %q rows = %s, want %s", check.Query, got, wantJSON)
+		}
+	}
+
+	result.Passed = len(result.Failures) == 0
+	return result
+}
+
+// dbFixtures returns the SQL scripts of a DB fixture
+func (s *Suite) dbFixtures(fixture *DBFixture) ([]string, error) {
+	if fixture == nil {
+		return nil, nil
+	}
+	var scripts []string
+	for _, file := range fixture.Files {
+		data, err := os.ReadFile(s.resolve(file))
+		if err != nil {
+			return nil, fmt.Errorf("reading the DB fixture: %v", err)
+		}
+		scripts = append(scripts, string(data))
+	}
+	if strings.TrimSpace(fixture.SQL) != "" {
+		scripts = append(scripts, fixture.SQL)
+	}
+	return scripts, nil
+}
+
+// newWebDriver returns a fake WebDriver with the page loaded
+func (s *Suite) newWebDriver(page *PageFixture) (*WebDriver, error) {
+	wd := NewWebDriver()
+	if page == nil {
+		page = &PageFixture{}
+	}
+	pageURL := page.URL
+	if pageURL == "" {
+		pageURL = DefaultPageURL
+	}
+	source := page.HTML
+	if page.HTMLFile != "" {
+		data, err := os.ReadFile(s.resolve(page.HTMLFile))
+		if err != nil {
+			return nil, fmt.Errorf("reading the page fixture: %v", err)
+		}
+		source = string(data)
+	}
+	if source == "" {
+		source = emptyPage
+	}
+	if err := wd.AddPage(pageURL, source); err != nil {
+		return nil, err
+	}
+	for name, value := range page.Globals {
+		wd.SetGlobal(name, value)
+	}
+	for _, cookie := range page.Cookies {
+		_ = wd.AddCookie(&selenium.Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HTTPOnly: cookie.HTTPOnly,
+		})
+	}
+	return wd, nil
+}
+
+// RunSuite runs a suite file as subtests of t (one per test case), so the
+// plugins tests can be part of go test
+func RunSuite(t *testing.T, path string) {
+	t.Helper()
+	suite, err := LoadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin, err := suite.LoadPlugin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range suite.Tests {
+		tc := &suite.Tests[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			result := suite.RunCase(plugin, tc)
+			for _, failure := range result.Failures {
+				t.Error(failure)
+			}
+		})
+	}
+}
+
+// toStringMap converts the YAML maps in m to map[string]interface{}
+func toStringMap(m map[string]interface{}) map[string]interface{} {
+	for k, v := range m {
+		m[k] = cmn.ConvertInterfaceMapToStringMap(v)
+	}
+	return m
+}
+
+// compareJSON compares got and want as JSON values (so numbers of
+// different types are equal), partial only compares the object fields in
+// want. It returns the JSON of both.
+func compareJSON(got, want interface{}, partial bool) (bool, string, string) {
+	gotJSON, gotValue := normalizeJSON(got)
+	wantJSON, wantValue := normalizeJSON(want)
+	if partial {
+		return matchPartial(gotValue, wantValue), gotJSON, wantJSON
+	}
+	return reflect.DeepEqual(gotValue, wantValue), gotJSON, wantJSON
+}
+
+// normalizeJSON returns the JSON of value and value JSON decoded
+func normalizeJSON(value interface{}) (string, interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value), value
+	}
+	var decoded interface{}
+	_ = json.Unmarshal(data, &decoded)
+	return string(data), decoded
+}
+
+// matchPartial returns true if got contains the object fields of want (and
+// its other values are equal)
+func matchPartial(got, want interface{}) bool {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !matchPartial(g[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !matchPartial(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(got, want)
+	}
+}
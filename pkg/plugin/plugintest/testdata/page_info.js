@@ -0,0 +1,16 @@
+// @name: page_info
+// @description: Returns some information about the page (plugintest example)
+// @type: vdi_plugin
+// @arguments: named
+// @param: selector string = "li"
+// @param: limit? integer
+
+const { selector, limit } = arguments[0];
+const items = Array.from(document.querySelectorAll(selector)).map((e) => e.innerText);
+return {
+  title: document.title,
+  host: location.hostname,
+  items: limit ? items.slice(0, limit) : items,
+  jquery: window.jQuery?.fn?.jquery ?? null,
+  cookie: document.cookie,
+};
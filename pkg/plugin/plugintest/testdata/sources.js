@@ -0,0 +1,10 @@
+// @name: sources
+// @description: Counts the sources with a status and adds a new source (plugintest example)
+// @type: engine_plugin
+
+const rows = runQuery("SELECT url FROM Sources WHERE status = :status ORDER BY url", { status: params.status });
+const urls = rows.slice(0, -1).map((row) => row.url);
+if (params.add) {
+  runQuery("INSERT INTO Sources (url, status) VALUES (:url, 'new')", { url: params.add });
+}
+result = { urls, count: urls.length };
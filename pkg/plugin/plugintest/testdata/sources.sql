@@ -0,0 +1,4 @@
+INSERT INTO Sources (url, status) VALUES
+  ('https://example.com', 'new'),
+  ('https://example.org', 'new'),
+  ('https://example.net', 'completed');
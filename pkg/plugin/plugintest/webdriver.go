@@ -0,0 +1,312 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugintest provides a harness to test the CROWler JS plugins
+// against fixtures, without a browser and a database.
+package plugintest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/go-auxiliaries/selenium"
+	"golang.org/x/net/html"
+)
+
+const (
+	defaultScriptTimeout = 30 * time.Second
+	maxTimers            = 10000
+	fakeUserAgent        = "Mozilla/5.0 (X11; Linux x86_64) CROWler-plugintest"
+)
+
+// ErrPageNotFound is returned by Get for the URLs without a fixture page
+var ErrPageNotFound = errors.New("page not found")
+
+// WebDriver is a fake selenium.WebDriver which serves static HTML pages and
+// executes the scripts with an embedded JS engine, on a minimal DOM of the
+// page (document, window, location, navigator and timers).
+// It implements the methods used by the plugins execution (ExecuteScript,
+// ExecuteScriptAsync, Get, CurrentURL, Title, PageSource, the timeouts, the
+// cookies and the elements search), the other methods of the interface are
+// not available (they panic).
+type WebDriver struct {
+	selenium.WebDriver
+
+	mu            sync.Mutex
+	pages         map[string]string      // Fixture pages (URL -> HTML)
+	currentURL    string                 // URL of the loaded page
+	document      *html.Node             // DOM of the loaded page
+	globals       map[string]interface{} // Globals defined in window (like the ones set by the page scripts)
+	cookies       []selenium.Cookie      // Cookies of the browser
+	scriptTimeout time.Duration          // Timeout of the scripts execution
+}
+
+// NewWebDriver returns a fake WebDriver with no pages
+func NewWebDriver() *WebDriver {
+	return &WebDriver{
+		pages:         make(map[string]string),
+		globals:       make(map[string]interface{}),
+		scriptTimeout: defaultScriptTimeout,
+	}
+}
+
+// AddPage adds a fixture page, the first page added is loaded
+func (wd *WebDriver) AddPage(pageURL, source string) error {
+	wd.mu.Lock()
+	wd.pages[pageURL] = source
+	loaded := wd.document != nil
+	wd.mu.Unlock()
+
+	if !loaded {
+		return wd.Get(pageURL)
+	}
+	return nil
+}
+
+// SetGlobal defines a global variable of the page (window.name), value
+// must be JSON serializable
+func (wd *WebDriver) SetGlobal(name string, value interface{}) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	wd.globals[name] = value
+}
+
+// Get loads a fixture page
+func (wd *WebDriver) Get(pageURL string) error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	source, exists := wd.pages[pageURL]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrPageNotFound, pageURL)
+	}
+	document, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return err
+	}
+	wd.currentURL = pageURL
+	wd.document = document
+	return nil
+}
+
+// Refresh reloads the current page (discarding the changes made by the scripts)
+func (wd *WebDriver) Refresh() error {
+	wd.mu.Lock()
+	pageURL := wd.currentURL
+	wd.mu.Unlock()
+	return wd.Get(pageURL)
+}
+
+// CurrentURL returns the URL of the loaded page
+func (wd *WebDriver) CurrentURL() (string, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	return wd.currentURL, nil
+}
+
+// Title returns the title of the loaded page
+func (wd *WebDriver) Title() (string, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if wd.document == nil {
+		return "", nil
+	}
+	return domTitle(wd.document), nil
+}
+
+// PageSource returns the HTML of the loaded page (with the changes made by
+// the scripts)
+func (wd *WebDriver) PageSource() (string, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if wd.document == nil {
+		return "", nil
+	}
+	return renderNode(wd.document), nil
+}
+
+// SetAsyncScriptTimeout sets the timeout of the scripts execution
+func (wd *WebDriver) SetAsyncScriptTimeout(timeout time.Duration) error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if timeout > 0 {
+		wd.scriptTimeout = timeout
+	}
+	return nil
+}
+
+// SetImplicitWaitTimeout does nothing (the pages are static)
+func (wd *WebDriver) SetImplicitWaitTimeout(time.Duration) error {
+	return nil
+}
+
+// SetPageLoadTimeout does nothing (the pages are static)
+func (wd *WebDriver) SetPageLoadTimeout(time.Duration) error {
+	return nil
+}
+
+// GetCookies returns the cookies of the browser
+func (wd *WebDriver) GetCookies() ([]selenium.Cookie, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	return append([]selenium.Cookie(nil), wd.cookies...), nil
+}
+
+// GetCookie returns the cookie with the given name
+func (wd *WebDriver) GetCookie(name string) (selenium.Cookie, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	for _, cookie := range wd.cookies {
+		if cookie.Name == name {
+			return cookie, nil
+		}
+	}
+	return selenium.Cookie{}, fmt.Errorf("no such cookie: %s", name)
+}
+
+// AddCookie adds (or replaces) a cookie
+func (wd *WebDriver) AddCookie(cookie *selenium.Cookie) error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	for i := range wd.cookies {
+		if wd.cookies[i].Name == cookie.Name {
+			wd.cookies[i] = *cookie
+			return nil
+		}
+	}
+	wd.cookies = append(wd.cookies, *cookie)
+	return nil
+}
+
+// DeleteCookie removes a cookie
+func (wd *WebDriver) DeleteCookie(name string) error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	for i := range wd.cookies {
+		if wd.cookies[i].Name == name {
+			wd.cookies = append(wd.cookies[:i], wd.cookies[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// DeleteAllCookies removes all the cookies
+func (wd *WebDriver) DeleteAllCookies() error {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	wd.cookies = nil
+	return nil
+}
+
+// Quit does nothing
+func (wd *WebDriver) Quit() error {
+	return nil
+}
+
+// Close does nothing
+func (wd *WebDriver) Close() error {
+	return nil
+}
+
+// ExecuteScript executes a script on the loaded page, like a browser does:
+// the script is the body of a function receiving args in arguments[] and
+// its return value is returned JSON decoded.
+func (wd *WebDriver) ExecuteScript(script string, args []interface{}) (interface{}, error) {
+	return wd.execute(script, args, false)
+}
+
+// ExecuteScriptAsync executes a script on the loaded page, the script
+// returns its result calling the callback passed as its last argument.
+func (wd *WebDriver) ExecuteScriptAsync(script string, args []interface{}) (interface{}, error) {
+	return wd.execute(script, args, true)
+}
+
+// execute runs a script on the loaded page
+func (wd *WebDriver) execute(script string, args []interface{}, async bool) (interface{}, error) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if wd.document == nil {
+		return nil, errors.New("no page loaded")
+	}
+
+	// The arguments are passed as JSON, like in a browser
+	if args == nil {
+		args = []interface{}{}
+	}
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script arguments: %v", err)
+	}
+
+	vm := goja.New()
+	window, err := wd.newWindow(vm)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.AfterFunc(wd.scriptTimeout, func() {
+		vm.Interrupt("script timeout")
+	})
+	defer timer.Stop()
+
+	jsArgs, err := window.parseJSON(string(argsJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	// Async scripts get a callback as their last argument
+	done := false
+	result := goja.Undefined()
+	if async {
+		callback := func(call goja.FunctionCall) goja.Value {
+			if !done {
+				done = true
+				result = call.Argument(0)
+			}
+			return goja.Undefined()
+		}
+		if err := jsArgs.ToObject(vm).Set(fmt.Sprint(len(args)), callback); err != nil {
+			return nil, err
+		}
+	}
+
+	// The script is the body of a function, called with the arguments
+	fn, err := vm.RunString("(function() {\n" + script + "\n})")
+	if err != nil {
+		return nil, fmt.Errorf("javascript error: %v", err)
+	}
+	apply, _ := goja.AssertFunction(fn.ToObject(vm).Get("apply"))
+	value, err := apply(fn, vm.GlobalObject(), jsArgs)
+	if err != nil {
+		return nil, fmt.Errorf("javascript error: %v", err)
+	}
+	if !async {
+		result = value
+	}
+
+	// Run the timers (without waiting for them)
+	if err := window.runTimers(func() bool { return async && done }); err != nil {
+		return nil, fmt.Errorf("javascript error: %v", err)
+	}
+	if async && !done {
+		return nil, errors.New("script timeout: the async script didn't call its callback")
+	}
+
+	return window.toGo(result)
+}
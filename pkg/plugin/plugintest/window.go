@@ -0,0 +1,306 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugintest provides a harness to test the CROWler JS plugins
+// against fixtures, without a browser and a database.
+package plugintest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+
+	"github.com/dop251/goja"
+	"golang.org/x/net/html"
+)
+
+// jsTimer is a timer set by a script
+type jsTimer struct {
+	id       int64
+	due      int64 // On the virtual clock of the window (ms)
+	interval int64 // 0 for the timeouts
+	callback goja.Callable
+	args     []goja.Value
+}
+
+// jsWindow is the window of a script execution
+type jsWindow struct {
+	vm        *goja.Runtime
+	dom       *jsDOM
+	timers    map[int64]*jsTimer
+	nextID    int64
+	now       int64 // Virtual clock (the timers don't wait)
+	parse     goja.Callable
+	stringify goja.Callable
+}
+
+// newWindow sets the globals of a browser window in the VM: window,
+// document, location, navigator, console, the timers and the page globals
+func (wd *WebDriver) newWindow(vm *goja.Runtime) (*jsWindow, error) {
+	w := &jsWindow{
+		vm:     vm,
+		dom:    newJSDOM(vm, wd.document),
+		timers: make(map[int64]*jsTimer),
+	}
+	jsonObj := vm.Get("JSON").ToObject(vm)
+	w.parse, _ = goja.AssertFunction(jsonObj.Get("parse"))
+	w.stringify, _ = goja.AssertFunction(jsonObj.Get("stringify"))
+
+	global := vm.GlobalObject()
+	location := w.location(wd.currentURL)
+	values := map[string]interface{}{
+		"window":    global,
+		"self":      global,
+		"location":  location,
+		"navigator": w.navigator(),
+		"console":   w.console(),
+		"document":  w.document(wd, location),
+	}
+	for name, value := range values {
+		if err := global.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	w.setTimers(global)
+
+	// The page globals are set last, so they can replace the defaults
+	for name, value := range wd.globals {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid global '%s': %v", name, err)
+		}
+		jsValue, err := w.parseJSON(string(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := global.Set(name, jsValue); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// parseJSON returns the JS value of a JSON document
+func (w *jsWindow) parseJSON(data string) (goja.Value, error) {
+	return w.parse(goja.Undefined(), w.vm.ToValue(data))
+}
+
+// toGo returns value JSON decoded (like a browser returns the result of a
+// script to the WebDriver)
+func (w *jsWindow) toGo(value goja.Value) (interface{}, error) {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil, nil
+	}
+	data, err := w.stringify(goja.Undefined(), value)
+	if err != nil {
+		return nil, err
+	}
+	if goja.IsUndefined(data) {
+		return nil, nil
+	}
+	var result interface{}
+	if err := json.Unmarshal([]byte(data.String()), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// location returns the window.location object of pageURL
+func (w *jsWindow) location(pageURL string) *goja.Object {
+	location := w.vm.NewObject()
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		u = &url.URL{}
+	}
+	origin := ""
+	if u.Scheme != "" {
+		origin = u.Scheme + "://" + u.Host
+	}
+	search := ""
+	if u.RawQuery != "" {
+		search = "?" + u.RawQuery
+	}
+	hash := ""
+	if u.Fragment != "" {
+		hash = "#" + u.Fragment
+	}
+	props := map[string]string{
+		"href":     pageURL,
+		"protocol": u.Scheme + ":",
+		"host":     u.Host,
+		"hostname": u.Hostname(),
+		"port":     u.Port(),
+		"pathname": u.EscapedPath(),
+		"search":   search,
+		"hash":     hash,
+		"origin":   origin,
+	}
+	for name, value := range props {
+		_ = location.Set(name, value)
+	}
+	_ = location.Set("toString", func() string { return pageURL })
+	return location
+}
+
+// navigator returns the window.navigator object
+func (w *jsWindow) navigator() *goja.Object {
+	navigator := w.vm.NewObject()
+	_ = navigator.Set("userAgent", fakeUserAgent)
+	_ = navigator.Set("language", "en-US")
+	_ = navigator.Set("languages", w.vm.NewArray("en-US", "en"))
+	_ = navigator.Set("platform", "Linux x86_64")
+	_ = navigator.Set("cookieEnabled", true)
+	_ = navigator.Set("webdriver", false)
+	return navigator
+}
+
+// console returns the window.console object (the messages are logged)
+func (w *jsWindow) console() *goja.Object {
+	console := w.vm.NewObject()
+	for _, name := range []string{"log", "info", "warn", "error", "debug"} {
+		level := name
+		_ = console.Set(name, func(call goja.FunctionCall) goja.Value {
+			args := make([]string, 0, len(call.Arguments))
+			for _, arg := range call.Arguments {
+				args = append(args, arg.String())
+			}
+			cmn.DebugMsg(cmn.DbgLvlDebug, "plugintest console.%s: %s", level, strings.Join(args, " "))
+			return goja.Undefined()
+		})
+	}
+	return console
+}
+
+// document returns the window.document object
+func (w *jsWindow) document(wd *WebDriver, location *goja.Object) goja.Value {
+	d := w.dom
+	document := d.node(wd.document).ToObject(w.vm)
+	root := wd.document
+
+	find := func(tag string) func() goja.Value {
+		return func() goja.Value {
+			return d.node(findNode(root, func(n *html.Node) bool { return n.Data == tag }))
+		}
+	}
+	findAll := func(tag string) func() goja.Value {
+		return func() goja.Value {
+			return d.nodes(findNodes(root, func(n *html.Node) bool { return n.Data == tag }))
+		}
+	}
+
+	_ = document.Set("URL", wd.currentURL)
+	_ = document.Set("documentURI", wd.currentURL)
+	_ = document.Set("location", location)
+	_ = document.Set("domain", location.Get("hostname"))
+	_ = document.Set("referrer", "")
+	_ = document.Set("readyState", "complete")
+	_ = document.Set("contentType", "text/html")
+	_ = document.Set("characterSet", "UTF-8")
+	d.getter(document, "title", func() goja.Value { return w.vm.ToValue(domTitle(root)) })
+	d.getter(document, "documentElement", find("html"))
+	d.getter(document, "head", find("head"))
+	d.getter(document, "body", find("body"))
+	d.getter(document, "scripts", findAll("script"))
+	d.getter(document, "images", findAll("img"))
+	d.getter(document, "forms", findAll("form"))
+	d.getter(document, "links", func() goja.Value {
+		return d.nodes(findNodes(root, func(n *html.Node) bool {
+			return (n.Data == "a" || n.Data == "area") && attr(n, "href") != ""
+		}))
+	})
+	d.getter(document, "cookie", func() goja.Value {
+		cookies := make([]string, 0, len(wd.cookies))
+		for _, cookie := range wd.cookies {
+			if !cookie.HTTPOnly {
+				cookies = append(cookies, cookie.Name+"="+cookie.Value)
+			}
+		}
+		return w.vm.ToValue(strings.Join(cookies, "; "))
+	})
+	d.method(document, "getElementById", func(call goja.FunctionCall) goja.Value {
+		id := call.Argument(0).String()
+		return d.node(findNode(root, func(n *html.Node) bool { return attr(n, "id") == id }))
+	})
+	return document
+}
+
+// setTimers sets setTimeout, setInterval, clearTimeout and clearInterval
+func (w *jsWindow) setTimers(global *goja.Object) {
+	set := func(interval bool) func(call goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			callback, ok := goja.AssertFunction(call.Argument(0))
+			if !ok {
+				panic(w.vm.NewTypeError("the timer callback is not a function"))
+			}
+			delay := call.Argument(1).ToInteger()
+			if delay < 0 {
+				delay = 0
+			}
+			w.nextID++
+			timer := &jsTimer{id: w.nextID, due: w.now + delay, callback: callback}
+			if interval {
+				timer.interval = max(delay, 1)
+			}
+			if len(call.Arguments) > 2 {
+				timer.args = append(timer.args, call.Arguments[2:]...)
+			}
+			w.timers[timer.id] = timer
+			return w.vm.ToValue(timer.id)
+		}
+	}
+	clear := func(call goja.FunctionCall) goja.Value {
+		delete(w.timers, call.Argument(0).ToInteger())
+		return goja.Undefined()
+	}
+	_ = global.Set("setTimeout", set(false))
+	_ = global.Set("setInterval", set(true))
+	_ = global.Set("clearTimeout", clear)
+	_ = global.Set("clearInterval", clear)
+}
+
+// runTimers runs the timers in order (advancing the virtual clock) until
+// there are no more timers or stop returns true
+func (w *jsWindow) runTimers(stop func() bool) error {
+	for count := 0; len(w.timers) > 0 && !stop(); count++ {
+		if count >= maxTimers {
+			return fmt.Errorf("more than %d timers executed", maxTimers)
+		}
+
+		pending := make([]*jsTimer, 0, len(w.timers))
+		for _, timer := range w.timers {
+			pending = append(pending, timer)
+		}
+		sort.Slice(pending, func(i, j int) bool {
+			if pending[i].due != pending[j].due {
+				return pending[i].due < pending[j].due
+			}
+			return pending[i].id < pending[j].id
+		})
+		timer := pending[0]
+		w.now = timer.due
+		if timer.interval > 0 {
+			timer.due += timer.interval
+		} else {
+			delete(w.timers, timer.id)
+		}
+		if _, err := timer.callback(goja.Undefined(), timer.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+
+	"github.com/dop251/goja"
+)
+
+// PluginFile is the result of loading a plugin file (or a remote plugin) of
+// a plugins location
+type PluginFile struct {
+	Path    string      // Local path or remote URL of the file
+	Plugins []*JSPlugin // Plugins loaded from the file (already filtered by type)
+	Err     error       // Error loading or validating the file
+}
+
+// LoadPluginFiles loads, one by one, the plugin files of a plugins location
+// and validates them. Unlike BulkLoadPlugins, the errors are returned per
+// file, so a reload can keep the previous version of a broken file.
+func LoadPluginFiles(config cfg.PluginConfig, pType string) []PluginFile {
+	pType = strings.ToLower(strings.TrimSpace(pType))
+
+	var files []PluginFile
+	for _, path := range config.Path {
+		var paths []string
+		if config.Host != "" {
+			if cmn.GetFileExt(path) != "js" {
+				continue
+			}
+			paths = []string{path}
+		} else if strings.Contains(path, "*") {
+			matches, err := filepath.Glob(path)
+			if err != nil {
+				files = append(files, PluginFile{Path: path, Err: err})
+				continue
+			}
+			paths = matches
+		} else {
+			paths = []string{path}
+		}
+
+		for _, file := range paths {
+			files = append(files, loadPluginFile(config, file, pType))
+		}
+	}
+	return files
+}
+
+// loadPluginFile loads and validates a single plugin file
+func loadPluginFile(config cfg.PluginConfig, path string, pType string) PluginFile {
+	result := PluginFile{Path: path}
+
+	var plugins []*JSPlugin
+	var err error
+	if config.Host != "" {
+		remote := config
+		remote.Path = []string{path}
+		result.Path = fmt.Sprintf("http://%s/%s", config.Host, path)
+		plugins, err = LoadPluginsFromRemote(remote)
+	} else {
+		plugins, err = LoadPluginFromLocal(path)
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	plugins = filterPluginsByType(plugins, pType)
+	setPluginsLimits(plugins, config)
+	for _, plugin := range plugins {
+		if err := plugin.Validate(); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+	result.Plugins = plugins
+	return result
+}
+
+// Validate checks that the plugin can be loaded: it must have a name and,
+// if it runs on the CROWler engine, its script must compile
+func (p *JSPlugin) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("plugin has no name")
+	}
+	if p.PType == vdiPlugin {
+		// VDI plugins run in the browser
+		return nil
+	}
+	if _, err := goja.Compile(p.Name, p.Script, false); err != nil {
+		return fmt.Errorf("plugin '%s' doesn't compile: %v", p.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+
+	"github.com/dop251/goja"
+)
+
+func newTestDBHandler(t *testing.T) cdb.Handler {
+	t.Helper()
+
+	var config cfg.Config
+	config.Database.Type = cdb.DBSQLiteStr
+	config.Database.DBName = filepath.Join(t.TempDir(), "crowler.db")
+	handler, err := cdb.NewHandler(config)
+	if err != nil {
+		t.Fatalf("NewHandler() returned an error: %v", err)
+	}
+	if err := handler.Connect(config); err != nil {
+		t.Fatalf("Connect() returned an error: %v", err)
+	}
+	t.Cleanup(func() { _ = handler.Close() })
+
+	schema, err := os.ReadFile("../database/sqlite-setup-v1.4.sqlite3")
+	if err != nil {
+		t.Fatalf("failed to read the SQLite schema: %v", err)
+	}
+	if _, err := handler.Exec(string(schema)); err != nil {
+		t.Fatalf("failed to create the SQLite schema: %v", err)
+	}
+	return handler
+}
+
+func TestNewJSPluginReadOnly(t *testing.T) {
+	tests := map[string]bool{
+		"// @name: test\n// @read_only\n":       true,
+		"// @name: test\n// @read_only: true\n": true,
+		"// @name: test\n// @read_only: no\n":   false,
+		"// @name: test\n":                      false,
+	}
+	for script, want := range tests {
+		if got := NewJSPlugin(script).ReadOnly; got != want {
+			t.Errorf("NewJSPlugin(%q).ReadOnly = %v, want %v", script, got, want)
+		}
+	}
+}
+
+func TestAddJSAPIRunQuery(t *testing.T) {
+	db := newTestDBHandler(t)
+	if _, err := db.Exec(`INSERT INTO Sources (url, status) VALUES ('https://example.com', 'new'), ('https://example.org', 'completed')`); err != nil {
+		t.Fatalf("failed to insert the test sources: %v", err)
+	}
+
+	for _, readOnly := range []bool{false, true} {
+		vm := goja.New()
+		if err := setCrowlerJSAPI(vm, newJSEventLoop(vm), &db, jsAPIPermissions{readOnly: readOnly}); err != nil {
+			t.Fatalf("setCrowlerJSAPI returned an error: %v", err)
+		}
+
+		value, err := vm.RunString(`
+			var named = runQuery("SELECT url FROM Sources WHERE status = :status", {status: "new"});
+			var positional = runQuery("SELECT url FROM Sources WHERE source_id > $1 ORDER BY source_id", [0]);
+			var del = runQuery("DELETE FROM Sources WHERE status = :status", {status: "nothing"});
+			[named[0].url, named[1].rows, positional.length, del === undefined, typeof createSource].join(",");
+		`)
+		if err != nil {
+			t.Fatalf("runQuery script failed: %v", err)
+		}
+
+		want := "https://example.com,1,3,false,function"
+		if readOnly {
+			// Write queries are refused, source functions are not installed
+			want = "https://example.com,1,3,true,undefined"
+		}
+		if got := value.String(); got != want {
+			t.Errorf("runQuery (read-only %v) = %s, want %s", readOnly, got, want)
+		}
+	}
+}
@@ -15,18 +15,45 @@
 // Package plugin provides the plugin functionality for the CROWler.
 package plugin
 
+import "sync"
+
 // JSPlugin struct to hold the JS plugin
 type JSPlugin struct {
-	Name        string `json:"name" yaml:"name"`               // Name of the plugin
-	Description string `json:"description" yaml:"description"` // Description of the plugin
-	Version     string `json:"version" yaml:"version"`         // Version of the plugin
-	PType       string `json:"type" yaml:"type"`               // Type of the plugin
-	Script      string `json:"script" yaml:"script"`           // Script for the plugin
-	EventType   string `json:"event_type" yaml:"event_type"`   // Event type for the plugin. Plugins can register to handle an event.
+	Name         string          `json:"name" yaml:"name"`                 // Name of the plugin
+	Description  string          `json:"description" yaml:"description"`   // Description of the plugin
+	Version      string          `json:"version" yaml:"version"`           // Version of the plugin
+	PType        string          `json:"type" yaml:"type"`                 // Type of the plugin
+	Script       string          `json:"script" yaml:"script"`             // Script for the plugin
+	EventType    string          `json:"event_type" yaml:"event_type"`     // Event type for the plugin. Plugins can register to handle an event.
+	ReadOnly     bool            `json:"read_only" yaml:"read_only"`       // If true, the plugin can't modify the CROWler DB (runQuery only accepts read queries)
+	Capabilities []string        `json:"capabilities" yaml:"capabilities"` // Capabilities declared by the plugin (nil if the plugin doesn't declare them)
+	Limits       JSPluginLimits  `json:"limits" yaml:"limits"`             // Limits set by the operator (from the plugins location configuration)
+	Params       []JSPluginParam `json:"params" yaml:"params"`             // Params declared by the plugin (in declaration order)
+	Arguments    string          `json:"arguments" yaml:"arguments"`       // How a VDI plugin receives its params: "positional" (default) or "named"
+}
+
+// JSPluginParam struct to hold a param declared by a JS plugin
+type JSPluginParam struct {
+	Name     string      `json:"name" yaml:"name"`         // Name of the param
+	Type     string      `json:"type" yaml:"type"`         // Type of the param (any, string, number, integer, boolean, object or array)
+	Default  interface{} `json:"default" yaml:"default"`   // Default value of the param (nil if none)
+	Required bool        `json:"required" yaml:"required"` // If true, the param must be provided
+}
+
+// JSPluginLimits struct to hold the operator limits of a JS plugin
+type JSPluginLimits struct {
+	Capabilities  []string `json:"capabilities" yaml:"capabilities"`       // Capabilities the plugin can be granted (empty means none)
+	AllowedHosts  []string `json:"allowed_hosts" yaml:"allowed_hosts"`     // Hosts the plugin can reach with the HTTP functions (empty means all)
+	MaxHeapGrowth int      `json:"max_heap_growth" yaml:"max_heap_growth"` // Best-effort guard on the process heap growth during an execution (in MB, 0 means disabled)
+	MaxSteps      int      `json:"max_steps" yaml:"max_steps"`             // Loop iterations and function calls budget of an execution (0 means no limit)
+	MaxCallStack  int      `json:"max_call_stack" yaml:"max_call_stack"`   // Maximum function call depth (0 means the engine default)
 }
 
 // JSPluginRegister struct to hold the JS plugins
 type JSPluginRegister struct {
 	Registry map[string]JSPlugin // Registry of JS plugins
 	Order    []string            // Order of the plugins in registration order
+
+	uploaded map[string]bool // Names of the uploaded plugins (kept by Replace)
+	mu       sync.RWMutex    // Protects the registry (it can be replaced by a reload)
 }
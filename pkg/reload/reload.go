@@ -0,0 +1,345 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reload implements the hot reload of the rulesets, the plugins and
+// the agents definitions, following the refresh intervals of their locations
+// in the CROWler configuration.
+package reload
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	agt "github.com/pzaino/thecrowler/pkg/agent"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+)
+
+const (
+	// KindRulesets is the kind of the rulesets reloads
+	KindRulesets = "rulesets"
+	// KindPlugins is the kind of the plugins reloads
+	KindPlugins = "plugins"
+	// KindAgents is the kind of the agents reloads
+	KindAgents = "agents"
+
+	// EventRulesetsReloaded is the type of the event created when a reload
+	// changed the rulesets
+	EventRulesetsReloaded = "rulesets_reloaded"
+	// EventPluginsReloaded is the type of the event created when a reload
+	// changed the plugins
+	EventPluginsReloaded = "plugins_reloaded"
+	// EventAgentsReloaded is the type of the event created when a reload
+	// changed the agents
+	EventAgentsReloaded = "agents_reloaded"
+)
+
+// Report is the result of the reload of a kind of contents
+type Report struct {
+	Kind    string      `json:"kind" yaml:"kind"`       // KindRulesets, KindPlugins or KindAgents
+	Changes cmn.Changes `json:"changes" yaml:"changes"` // What changed (by name)
+	Errors  []string    `json:"errors" yaml:"errors"`   // Files that failed to load (their previous version is kept)
+}
+
+// file is a file of a location, with the items loaded from it
+type file struct {
+	path  string
+	items interface{} // rules.Ruleset, []*plg.JSPlugin or []agt.Job
+	err   error
+}
+
+// source is a location (an entry of the configuration) of a target
+type source struct {
+	refresh time.Duration // 0 means the location is loaded only once
+	next    time.Time
+	loaded  bool
+	load    func() []file
+	files   []file // Files in use (in load order)
+}
+
+// reload loads the files of the source, keeping the previous version of
+// the files that failed to load, and returns the errors
+func (s *source) reload() []string {
+	previous := make(map[string]file, len(s.files))
+	for _, f := range s.files {
+		previous[f.path] = f
+	}
+
+	var files []file
+	var errs []string
+	for _, f := range s.load() {
+		if f.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f.path, f.err))
+			if old, exists := previous[f.path]; exists {
+				files = append(files, old)
+			}
+			continue
+		}
+		files = append(files, f)
+	}
+	s.files = files
+	s.loaded = true
+	return errs
+}
+
+// target is a set of contents (the rulesets of a RuleEngine, a plugins
+// register or an agents registry) kept in sync with its locations
+type target struct {
+	kind      string
+	eventType string
+	sources   []*source
+	swap      func(files []file) cmn.Changes
+}
+
+// Watcher periodically reloads the rulesets, the plugins and the agents
+// from their locations, and swaps them in the running contents (without
+// affecting the crawls and the agents in progress)
+type Watcher struct {
+	db      *cdb.Handler
+	mu      sync.Mutex
+	targets []*target
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewWatcher returns a new Watcher. The reload events are created in db
+// (nil means no events).
+func NewWatcher(db *cdb.Handler) *Watcher {
+	return &Watcher{db: db}
+}
+
+// WatchRulesets keeps the rulesets of re in sync with the rulesets
+// locations. The files are validated against the RuleEngine schema.
+func (w *Watcher) WatchRulesets(re *rules.RuleEngine, configs []cfg.RulesetConfig) *Watcher {
+	sources := make([]*source, 0, len(configs))
+	for _, config := range configs {
+		sources = append(sources, newSource(config.Refresh, func() []file {
+			var files []file
+			for _, rf := range rules.LoadRulesetFiles(re.Schema, config) {
+				files = append(files, file{path: rf.Path, items: rf.Ruleset, err: rf.Err})
+			}
+			return files
+		}))
+	}
+	w.addTarget(&target{
+		kind:      KindRulesets,
+		eventType: EventRulesetsReloaded,
+		sources:   sources,
+		swap: func(files []file) cmn.Changes {
+			rulesets := make([]rules.Ruleset, 0, len(files))
+			for _, f := range files {
+				rulesets = append(rulesets, f.items.(rules.Ruleset))
+			}
+			return re.ReplaceRulesets(rulesets)
+		},
+	})
+	return w
+}
+
+// WatchPlugins keeps the plugins of reg (of type pType, empty means all)
+// in sync with the plugins locations
+func (w *Watcher) WatchPlugins(reg *plg.JSPluginRegister, configs []cfg.PluginConfig, pType string) *Watcher {
+	sources := make([]*source, 0, len(configs))
+	for _, config := range configs {
+		sources = append(sources, newSource(config.Refresh, func() []file {
+			var files []file
+			for _, pf := range plg.LoadPluginFiles(config, pType) {
+				files = append(files, file{path: pf.Path, items: pf.Plugins, err: pf.Err})
+			}
+			return files
+		}))
+	}
+	w.addTarget(&target{
+		kind:      KindPlugins,
+		eventType: EventPluginsReloaded,
+		sources:   sources,
+		swap: func(files []file) cmn.Changes {
+			plugins := plg.NewJSPluginRegister()
+			for _, f := range files {
+				for _, plugin := range f.items.([]*plg.JSPlugin) {
+					plugins.Register(plugin.Name, *plugin)
+				}
+			}
+			return reg.Replace(plugins)
+		},
+	})
+	return w
+}
+
+// WatchAgents keeps the agents of jc in sync with the agents locations. The
+// files are validated against the agents schema.
+func (w *Watcher) WatchAgents(jc *agt.JobConfig, configs []cfg.AgentsConfig) *Watcher {
+	sources := make([]*source, 0, len(configs))
+	for _, config := range configs {
+		sources = append(sources, newSource(config.Refresh, func() []file {
+			var files []file
+			for _, af := range agt.LoadAgentsFiles(config) {
+				files = append(files, file{path: af.Path, items: af.Jobs, err: af.Err})
+			}
+			return files
+		}))
+	}
+	w.addTarget(&target{
+		kind:      KindAgents,
+		eventType: EventAgentsReloaded,
+		sources:   sources,
+		swap: func(files []file) cmn.Changes {
+			var jobs []agt.Job
+			for _, f := range files {
+				jobs = append(jobs, f.items.([]agt.Job)...)
+			}
+			return jc.Replace(jobs)
+		},
+	})
+	return w
+}
+
+// newSource returns a new source refreshed every refresh seconds
+func newSource(refresh int, load func() []file) *source {
+	return &source{refresh: time.Duration(refresh) * time.Second, load: load}
+}
+
+// addTarget adds a target to the Watcher, if at least one of its locations
+// has a refresh interval (the others are loaded only once)
+func (w *Watcher) addTarget(t *target) {
+	for _, s := range t.sources {
+		if s.refresh > 0 {
+			w.mu.Lock()
+			w.targets = append(w.targets, t)
+			w.mu.Unlock()
+			return
+		}
+	}
+}
+
+// IsWatching returns true if the Watcher has something to reload
+func (w *Watcher) IsWatching() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.targets) > 0
+}
+
+// Reload reloads the locations due at now (the first time all of them),
+// swaps the contents that changed and creates an event for each of them.
+// It returns a report for each kind of contents reloaded.
+func (w *Watcher) Reload(now time.Time) []Report {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var reports []Report
+	for _, t := range w.targets {
+		due := false
+		var errs []string
+		for _, s := range t.sources {
+			if s.loaded && (s.refresh == 0 || now.Before(s.next)) {
+				continue
+			}
+			errs = append(errs, s.reload()...)
+			s.next = now.Add(s.refresh)
+			due = true
+		}
+		if !due {
+			continue
+		}
+
+		var files []file
+		for _, s := range t.sources {
+			files = append(files, s.files...)
+		}
+		report := Report{Kind: t.kind, Changes: t.swap(files), Errors: errs}
+		for _, err := range errs {
+			cmn.DebugMsg(cmn.DbgLvlError, "Reloading %s: %s", t.kind, err)
+		}
+		if !report.Changes.IsEmpty() {
+			cmn.DebugMsg(cmn.DbgLvlInfo, "Reloaded %s: %s", t.kind, report.Changes)
+			w.createEvent(t.eventType, report)
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// createEvent creates the event of a reload that changed something
+func (w *Watcher) createEvent(eventType string, report Report) {
+	if w.db == nil || *w.db == nil {
+		return
+	}
+	event := cdb.Event{
+		Type:     eventType,
+		Severity: cdb.EventSeverityInfo,
+		Details: map[string]interface{}{
+			"type":    report.Kind,
+			"added":   report.Changes.Added,
+			"removed": report.Changes.Removed,
+			"changed": report.Changes.Changed,
+			"errors":  report.Errors,
+		},
+	}
+	if _, err := cdb.CreateEvent(w.db, event); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Creating the %s event: %v", eventType, err)
+	}
+}
+
+// nextReload returns when the next location is due
+func (w *Watcher) nextReload() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var next time.Time
+	for _, t := range w.targets {
+		for _, s := range t.sources {
+			if s.refresh > 0 && (next.IsZero() || s.next.Before(next)) {
+				next = s.next
+			}
+		}
+	}
+	return next
+}
+
+// Start starts reloading the locations in background (it does nothing if
+// there is nothing to reload)
+func (w *Watcher) Start() {
+	if !w.IsWatching() || w.stop != nil {
+		return
+	}
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		for {
+			w.Reload(time.Now())
+			timer := time.NewTimer(time.Until(w.nextReload()))
+			select {
+			case <-w.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the Watcher and waits for the reload in progress (if any)
+func (w *Watcher) Stop() {
+	if w == nil || w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
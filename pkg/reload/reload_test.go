@@ -0,0 +1,222 @@
+package reload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	agt "github.com/pzaino/thecrowler/pkg/agent"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+)
+
+const testRuleset = `
+ruleset_name: "%s"
+format_version: "1.0"
+rule_groups:
+  - group_name: "group1"
+    is_enabled: %s
+    scraping_rules:
+      - rule_name: "titles"
+        elements:
+          - key: "title"
+            selectors:
+              - selector_type: "css"
+                selector: "h1"
+`
+
+const testAgents = `
+jobs:
+  - name: "%s"
+    process: "serial"
+    trigger_type: manual
+    trigger_name: "%s"
+    steps:
+      - action: "APIRequest"
+        timeout: "%s"
+        params:
+          url: "https://example.com/api/data"
+`
+
+func writeFile(t *testing.T, path, format string, args ...interface{}) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(format, args...)), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func checkReport(t *testing.T, reports []Report, kind string, want cmn.Changes, wantErrors int) {
+	t.Helper()
+	if len(reports) != 1 {
+		t.Fatalf("Reload() returned %d reports, expected 1", len(reports))
+	}
+	got := reports[0]
+	if got.Kind != kind {
+		t.Errorf("report kind = %q, expected %q", got.Kind, kind)
+	}
+	if !reflect.DeepEqual(got.Changes, want) {
+		t.Errorf("report changes = %+v, expected %+v", got.Changes, want)
+	}
+	if len(got.Errors) != wantErrors {
+		t.Errorf("report errors = %v, expected %d error(s)", got.Errors, wantErrors)
+	}
+}
+
+func changes(added, removed, changed []string) cmn.Changes {
+	c := cmn.Changes{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	c.Added = append(c.Added, added...)
+	c.Removed = append(c.Removed, removed...)
+	c.Changed = append(c.Changed, changed...)
+	return c
+}
+
+func TestWatcherRulesets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.yaml"), testRuleset, "a.example.com", "true")
+	writeFile(t, filepath.Join(dir, "b.yaml"), testRuleset, "b.example.com", "true")
+
+	re := rules.NewEmptyRuleEngine("../../schemas/ruleset-schema.json")
+	if re.Schema == nil {
+		t.Fatalf("failed to load the rulesets schema")
+	}
+	configs := []cfg.RulesetConfig{{Path: []string{filepath.Join(dir, "*.yaml")}, Refresh: 10}}
+	w := NewWatcher(nil).WatchRulesets(&re, configs)
+	if !w.IsWatching() {
+		t.Fatalf("IsWatching() = false, expected true")
+	}
+
+	now := time.Now()
+	checkReport(t, w.Reload(now), KindRulesets, changes([]string{"a.example.com", "b.example.com"}, nil, nil), 0)
+	if re.CountScrapingRules() != 2 {
+		t.Errorf("CountScrapingRules() = %d, expected 2", re.CountScrapingRules())
+	}
+
+	// Nothing is due before the refresh interval
+	writeFile(t, filepath.Join(dir, "a.yaml"), testRuleset, "a.example.com", "false")
+	if reports := w.Reload(now.Add(5 * time.Second)); len(reports) != 0 {
+		t.Errorf("Reload() before the refresh interval returned %v", reports)
+	}
+
+	// A changed file invalidates the cache
+	if len(re.GetAllEnabledRuleGroups()) != 2 {
+		t.Fatalf("expected 2 enabled rule groups before the reload")
+	}
+	now = now.Add(10 * time.Second)
+	checkReport(t, w.Reload(now), KindRulesets, changes(nil, nil, []string{"a.example.com"}), 0)
+	if n := len(re.GetAllEnabledRuleGroups()); n != 1 {
+		t.Errorf("GetAllEnabledRuleGroups() returned %d groups after the reload, expected 1", n)
+	}
+
+	// An invalid file keeps its previous version, a removed file is removed
+	writeFile(t, filepath.Join(dir, "a.yaml"), "ruleset_name: [\"a.example.com\"\n")
+	if err := os.Remove(filepath.Join(dir, "b.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(10 * time.Second)
+	checkReport(t, w.Reload(now), KindRulesets, changes(nil, []string{"b.example.com"}, nil), 1)
+	if _, err := re.GetRulesetByName("a.example.com"); err != nil {
+		t.Errorf("GetRulesetByName() returned an error for the ruleset with an invalid update: %v", err)
+	}
+}
+
+func TestWatcherPlugins(t *testing.T) {
+	dir := t.TempDir()
+	plugin := "// name: %s\n// type: engine_plugin\n// event_type: new_source\nresult = { ok: %s };\n"
+	writeFile(t, filepath.Join(dir, "a.js"), plugin, "plugin_a", "true")
+
+	reg := plg.NewJSPluginRegister()
+	reg.Register("old_plugin", plg.JSPlugin{Name: "old_plugin"})
+	reg.RegisterUploaded("uploaded.js", plg.JSPlugin{Name: "uploaded"})
+	configs := []cfg.PluginConfig{
+		{Path: []string{filepath.Join(dir, "*.js")}, Refresh: 1},
+		{Path: []string{filepath.Join(dir, "missing.js")}}, // Loaded only once
+	}
+	w := NewWatcher(nil).WatchPlugins(reg, configs, "event_plugin")
+
+	now := time.Now()
+	checkReport(t, w.Reload(now), KindPlugins, changes([]string{"plugin_a"}, []string{"old_plugin"}, nil), 1)
+	if _, exists := reg.GetPlugin("plugin_a"); !exists {
+		t.Errorf("GetPlugin() didn't find the reloaded plugin")
+	}
+	if _, exists := reg.GetPlugin("uploaded.js"); !exists {
+		t.Errorf("the reload removed the uploaded plugin")
+	}
+
+	// A plugin that doesn't compile keeps its previous version
+	writeFile(t, filepath.Join(dir, "a.js"), plugin, "plugin_a", "")
+	writeFile(t, filepath.Join(dir, "b.js"), plugin, "plugin_b", "false")
+	now = now.Add(time.Second)
+	checkReport(t, w.Reload(now), KindPlugins, changes([]string{"plugin_b"}, nil, nil), 1)
+	if p, _ := reg.GetPlugin("plugin_a"); !strings.Contains(p.Script, "ok: true") {
+		t.Errorf("the plugin with a broken update was replaced: %q", p.Script)
+	}
+	if plugins, _ := reg.GetPluginsByEventType("new_source"); len(plugins) != 2 {
+		t.Errorf("GetPluginsByEventType() returned %d plugins, expected 2", len(plugins))
+	}
+}
+
+func TestWatcherAgents(t *testing.T) {
+	agt.AgentsSchemaPath = "../../schemas/crowler-agent-schema.json"
+	defer func() { agt.AgentsSchemaPath = "./schemas/crowler-agent-schema.json" }()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.yaml"), testAgents, "agent_a", "agent_a", "10s")
+
+	jc := agt.NewJobConfig()
+	jc.RegisterUploadedAgent(&agt.JobConfig{Jobs: []agt.Job{{Name: "uploaded", TriggerType: "manual", TriggerName: "uploaded"}}})
+	configs := []cfg.AgentsConfig{{Path: []string{filepath.Join(dir, "*.yaml")}, Refresh: 1}}
+	w := NewWatcher(nil).WatchAgents(jc, configs)
+
+	now := time.Now()
+	checkReport(t, w.Reload(now), KindAgents, changes([]string{"agent_a"}, nil, nil), 0)
+	if _, exists := jc.GetManualAgent("agent_a"); !exists {
+		t.Errorf("GetManualAgent() didn't find the reloaded agent")
+	}
+	if _, exists := jc.GetManualAgent("uploaded"); !exists {
+		t.Errorf("the reload removed the uploaded agent")
+	}
+
+	// An agent definition that doesn't match the schema keeps its previous version
+	writeFile(t, filepath.Join(dir, "a.yaml"), testAgents, "agent_a", "agent_a", "10 seconds")
+	now = now.Add(time.Second)
+	checkReport(t, w.Reload(now), KindAgents, changes(nil, nil, nil), 1)
+
+	writeFile(t, filepath.Join(dir, "a.yaml"), testAgents, "agent_a", "agent_a", "20s")
+	now = now.Add(time.Second)
+	checkReport(t, w.Reload(now), KindAgents, changes(nil, nil, []string{"agent_a"}), 0)
+}
+
+func TestWatcherWithoutRefresh(t *testing.T) {
+	re := rules.NewEmptyRuleEngine("")
+	w := NewWatcher(nil).
+		WatchRulesets(&re, []cfg.RulesetConfig{{Path: []string{"./rulesets/*.yaml"}}}).
+		WatchAgents(agt.NewJobConfig(), nil)
+	if w.IsWatching() {
+		t.Errorf("IsWatching() = true for locations without a refresh interval")
+	}
+	w.Start()
+	w.Stop()
+}
+
+func TestWatcherStartStop(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.yaml"), testRuleset, "a.example.com", "true")
+
+	re := rules.NewEmptyRuleEngine("")
+	w := NewWatcher(nil).WatchRulesets(&re, []cfg.RulesetConfig{{Path: []string{filepath.Join(dir, "*.yaml")}, Refresh: 1}})
+	w.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for re.CountScrapingRules() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.Stop()
+	if re.CountScrapingRules() != 1 {
+		t.Errorf("CountScrapingRules() = %d after the first reload, expected 1", re.CountScrapingRules())
+	}
+}
@@ -0,0 +1,397 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package robots implements the robots.txt (Robots Exclusion Protocol) support
+// for the CROWler.
+package robots
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+// Parse parses the content of a robots.txt file and returns its Data
+func Parse(content string) *Data {
+	data := &Data{}
+
+	var current *Group
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxRobotsSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Remove comments
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sep := strings.Index(line, ":")
+		if sep < 0 {
+			// Invalid line, ignore it
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:sep]))
+		value := strings.TrimSpace(line[sep+1:])
+
+		switch key {
+		case "user-agent":
+			if current == nil || !lastWasAgent {
+				data.Groups = append(data.Groups, Group{})
+				current = &data.Groups[len(data.Groups)-1]
+			}
+			current.UserAgents = append(current.UserAgents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			if current != nil && value != "" {
+				current.Rules = append(current.Rules, Rule{
+					Allow: key == "allow",
+					Path:  normalizePattern(value),
+				})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if delay, err := strconv.ParseFloat(value, 64); err == nil && delay > 0 {
+					current.CrawlDelay = delay
+				}
+			}
+		case "sitemap":
+			// Sitemaps are not bound to a group
+			if value != "" {
+				data.Sitemaps = append(data.Sitemaps, value)
+			}
+		}
+		lastWasAgent = false
+	}
+
+	return data
+}
+
+// normalizePattern makes sure a path pattern starts with a '/' (or a wildcard)
+func normalizePattern(pattern string) string {
+	if !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "*") {
+		pattern = "/" + pattern
+	}
+	return pattern
+}
+
+// productToken returns the lower-cased product token of a user agent (or
+// of a group's User-agent value): its leading run of letters, '_' and '-'
+// as defined by RFC 9309 (e.g. "crowler" for "CROWler/1.0")
+func productToken(userAgent string) string {
+	userAgent = strings.ToLower(strings.TrimSpace(userAgent))
+	end := strings.IndexFunc(userAgent, func(r rune) bool {
+		return (r < 'a' || r > 'z') && r != '_' && r != '-'
+	})
+	if end >= 0 {
+		userAgent = userAgent[:end]
+	}
+	return userAgent
+}
+
+// matchingGroup returns a group that merges all the groups whose user
+// agent matches (case-insensitively) the product token of the given user
+// agent, as per RFC 9309. If none matches then the "*" groups are used.
+func (d *Data) matchingGroup(userAgent string) *Group {
+	token := productToken(userAgent)
+	if token == "" {
+		token = productToken(DefaultUserAgent)
+	}
+
+	var best []*Group
+	var wildcard []*Group
+	for i := range d.Groups {
+		group := &d.Groups[i]
+		for _, agent := range group.UserAgents {
+			if agent == "*" {
+				wildcard = append(wildcard, group)
+				break
+			}
+			if productToken(agent) == token {
+				best = append(best, group)
+				break
+			}
+		}
+	}
+	if len(best) == 0 {
+		best = wildcard
+	}
+	if len(best) == 0 {
+		return nil
+	}
+
+	merged := &Group{}
+	for _, group := range best {
+		merged.UserAgents = append(merged.UserAgents, group.UserAgents...)
+		merged.Rules = append(merged.Rules, group.Rules...)
+		if group.CrawlDelay > merged.CrawlDelay {
+			merged.CrawlDelay = group.CrawlDelay
+		}
+	}
+	return merged
+}
+
+// IsAllowed returns true if the given URL (or path) can be crawled by
+// the given user agent.
+func (d *Data) IsAllowed(userAgent, rawURL string) bool {
+	if d == nil || d.AllowAll {
+		return true
+	}
+	if d.DisallowAll {
+		return false
+	}
+
+	path := urlToRobotsPath(rawURL)
+	if path == "/robots.txt" {
+		// robots.txt itself is always allowed
+		return true
+	}
+
+	group := d.matchingGroup(userAgent)
+	if group == nil {
+		return true
+	}
+
+	// The longest (most specific) matching rule wins, in case of
+	// a tie Allow wins over Disallow.
+	matchLen := -1
+	allowed := true
+	for _, rule := range group.Rules {
+		if !matchPattern(rule.Path, path) {
+			continue
+		}
+		pLen := len(rule.Path)
+		if pLen > matchLen || (pLen == matchLen && rule.Allow) {
+			matchLen = pLen
+			allowed = rule.Allow
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay returns the Crawl-delay (in seconds) that applies to the given user agent
+func (d *Data) CrawlDelay(userAgent string) float64 {
+	if d == nil {
+		return 0
+	}
+	group := d.matchingGroup(userAgent)
+	if group == nil {
+		return 0
+	}
+	return group.CrawlDelay
+}
+
+// urlToRobotsPath extracts the path (and query) of a URL in the format
+// robots.txt rules are matched against.
+func urlToRobotsPath(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return rawURL
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// matchPattern checks if a robots.txt path pattern matches a path.
+// '*' matches any sequence of characters and a trailing '$' anchors
+// the pattern to the end of the path.
+func matchPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+
+	if len(parts) == 1 {
+		return !anchored || pos == len(path)
+	}
+
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		if i == len(parts)-1 && anchored {
+			// The last part must match at the end of the path
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+
+	return true
+}
+
+// RobotsURL returns the robots.txt URL for the host of the given URL
+func RobotsURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid URL: %s", rawURL)
+	}
+	return u.Scheme + "://" + u.Host + "/robots.txt", nil
+}
+
+// Fetch retrieves and parses the robots.txt at robotsURL.
+// Following RFC 9309, a 4xx response means everything is allowed, while
+// a 5xx response (or a network error) means everything is disallowed.
+func Fetch(robotsURL, userAgent string, timeout int) (*Data, error) {
+	if timeout <= 0 {
+		timeout = 10
+	}
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(timeout, "ignore"),
+		Timeout:   time.Duration(timeout) * time.Second,
+	}
+
+	data := &Data{FetchedAt: time.Now()}
+
+	req, err := http.NewRequest(http.MethodGet, robotsURL, nil)
+	if err != nil {
+		data.DisallowAll = true
+		return data, err
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		data.DisallowAll = true
+		return data, fmt.Errorf("failed to fetch %s: %v", robotsURL, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, MaxRobotsSize))
+		if err != nil {
+			data.DisallowAll = true
+			return data, fmt.Errorf("failed to read %s: %v", robotsURL, err)
+		}
+		parsed := Parse(string(body))
+		parsed.FetchedAt = data.FetchedAt
+		data = parsed
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		data.AllowAll = true
+	default:
+		data.DisallowAll = true
+	}
+	data.StatusCode = resp.StatusCode
+
+	return data, nil
+}
+
+// NewCache returns a new robots.txt cache, holding up to DefaultCacheSize
+// hosts
+func NewCache(ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Cache{
+		entries:  cmn.NewLRUCache[string, *Data](DefaultCacheSize, 0),
+		TTL:      ttl,
+		ErrorTTL: DefaultErrorTTL,
+		Fetcher:  Fetch,
+	}
+}
+
+// Get returns the robots.txt Data for the host of rawURL, fetching it if
+// it's not in the cache (or it has expired). Concurrent requests for the
+// same host share a single fetch.
+func (c *Cache) Get(rawURL, userAgent string, timeout int) (*Data, error) {
+	robotsURL, err := RobotsURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := strings.TrimSuffix(robotsURL, "/robots.txt")
+
+	if entry, ok := c.entries.Get(host); ok && !c.isExpired(entry) {
+		return entry, entry.fetchErr
+	}
+
+	value, _, _ := c.fetches.Do(host, func() (interface{}, error) {
+		// Another fetch may have completed in the meantime
+		if entry, ok := c.entries.Get(host); ok && !c.isExpired(entry) {
+			return entry, nil
+		}
+
+		cmn.DebugMsg(cmn.DbgLvlDebug2, "Fetching robots.txt: %s", robotsURL)
+		entry, err := c.Fetcher(robotsURL, userAgent, timeout)
+		if entry == nil {
+			entry = &Data{DisallowAll: true, FetchedAt: time.Now()}
+		}
+		entry.Host = host
+		entry.fetchErr = err
+
+		c.entries.Add(host, entry)
+		return entry, nil
+	})
+	entry := value.(*Data)
+
+	return entry, entry.fetchErr
+}
+
+// IsAllowed checks if rawURL can be crawled by userAgent
+func (c *Cache) IsAllowed(rawURL, userAgent string, timeout int) bool {
+	data, err := c.Get(rawURL, userAgent, timeout)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "robots.txt for '%s' not available: %v", rawURL, err)
+	}
+	return data.IsAllowed(userAgent, rawURL)
+}
+
+// Remove removes the cached robots.txt for the host of rawURL
+func (c *Cache) Remove(rawURL string) {
+	robotsURL, err := RobotsURL(rawURL)
+	if err != nil {
+		return
+	}
+	c.entries.Remove(strings.TrimSuffix(robotsURL, "/robots.txt"))
+}
+
+func (c *Cache) isExpired(entry *Data) bool {
+	ttl := c.TTL
+	if entry.fetchErr != nil || entry.DisallowAll && entry.StatusCode == 0 {
+		ttl = c.ErrorTTL
+	}
+	return time.Since(entry.FetchedAt) > ttl
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package robots
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRobots = `
+# Test robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.php$
+Disallow: /search?q=*
+Crawl-delay: 2
+
+User-agent: CROWler
+User-agent: OtherBot
+Disallow: /crowler-only/
+Crawl-delay: 5.5
+
+Sitemap: https://www.example.com/sitemap.xml
+Sitemap: https://www.example.com/news-sitemap.xml.gz
+`
+
+func TestParse(t *testing.T) {
+	data := Parse(testRobots)
+
+	if len(data.Groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(data.Groups))
+	}
+	if len(data.Groups[1].UserAgents) != 2 {
+		t.Errorf("expected 2 user agents in the second group, got %d", len(data.Groups[1].UserAgents))
+	}
+	if len(data.Sitemaps) != 2 {
+		t.Errorf("expected 2 sitemaps, got %d", len(data.Sitemaps))
+	}
+	if data.Groups[0].CrawlDelay != 2 {
+		t.Errorf("expected crawl-delay 2, got %f", data.Groups[0].CrawlDelay)
+	}
+}
+
+func TestIsAllowed(t *testing.T) {
+	data := Parse(testRobots)
+
+	tests := []struct {
+		name      string
+		userAgent string
+		url       string
+		want      bool
+	}{
+		{"root", "SomeBot", "https://www.example.com/", true},
+		{"disallowed dir", "SomeBot", "https://www.example.com/private/data.html", false},
+		{"allow overrides", "SomeBot", "https://www.example.com/private/public.html", true},
+		{"php anchored", "SomeBot", "https://www.example.com/index.php", false},
+		{"php not at end", "SomeBot", "https://www.example.com/index.php?x=1", true},
+		{"query wildcard", "SomeBot", "https://www.example.com/search?q=test", false},
+		{"robots.txt always allowed", "SomeBot", "https://www.example.com/robots.txt", true},
+		{"specific group", "CROWler/1.0", "https://www.example.com/crowler-only/x", false},
+		{"specific group ignores *", "crowler", "https://www.example.com/private/data.html", true},
+		{"product token only", "Mozilla/5.0 (compatible; CROWler/1.0)", "https://www.example.com/crowler-only/x", true},
+		{"no substring match", "CROWlerNext", "https://www.example.com/crowler-only/x", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := data.IsAllowed(tt.userAgent, tt.url); got != tt.want {
+				t.Errorf("IsAllowed(%q, %q) = %v, want %v", tt.userAgent, tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/anything", true},
+		{"/$", "/", true},
+		{"/$", "/a", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php/", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"*", "/x", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+	data := Parse(testRobots)
+
+	if got := data.CrawlDelay("SomeBot"); got != 2 {
+		t.Errorf("CrawlDelay(SomeBot) = %f, want 2", got)
+	}
+	if got := data.CrawlDelay("CROWler"); got != 5.5 {
+		t.Errorf("CrawlDelay(CROWler) = %f, want 5.5", got)
+	}
+}
+
+func TestCacheGet(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		hits++
+		_, _ = w.Write([]byte(testRobots))
+	}))
+	defer server.Close()
+
+	cache := NewCache(0)
+	for i := 0; i < 3; i++ {
+		if cache.IsAllowed(server.URL+"/private/data.html", "SomeBot", 5) {
+			t.Errorf("expected URL to be disallowed")
+		}
+	}
+	if hits != 1 {
+		t.Errorf("expected robots.txt to be fetched once, got %d", hits)
+	}
+
+	cache.Remove(server.URL)
+	if !cache.IsAllowed(server.URL+"/public/data.html", "SomeBot", 5) {
+		t.Errorf("expected URL to be allowed")
+	}
+	if hits != 2 {
+		t.Errorf("expected robots.txt to be fetched twice, got %d", hits)
+	}
+}
+
+func TestCacheSingleFetch(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	cache := NewCache(0)
+	cache.Fetcher = func(_, _ string, _ int) (*Data, error) {
+		fetches.Add(1)
+		<-release
+		return Parse(testRobots), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cache.IsAllowed("https://www.example.com/private/data.html", "SomeBot", 5) {
+				t.Errorf("expected URL to be disallowed")
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("expected robots.txt to be fetched once, got %d", n)
+	}
+}
+
+func TestCacheErrorTTL(t *testing.T) {
+	fetches := 0
+	cache := NewCache(0)
+	cache.ErrorTTL = 20 * time.Millisecond
+	cache.Fetcher = func(_, _ string, _ int) (*Data, error) {
+		fetches++
+		return nil, errors.New("unreachable")
+	}
+
+	if _, err := cache.Get("https://www.example.com/", "SomeBot", 5); err == nil {
+		t.Errorf("expected the fetch error")
+	}
+	_, _ = cache.Get("https://www.example.com/", "SomeBot", 5)
+	if fetches != 1 {
+		t.Errorf("expected the failed fetch to be cached, got %d fetches", fetches)
+	}
+	time.Sleep(30 * time.Millisecond)
+	_, _ = cache.Get("https://www.example.com/", "SomeBot", 5)
+	if fetches != 2 {
+		t.Errorf("expected the failed fetch to expire, got %d fetches", fetches)
+	}
+}
+
+func TestFetchStatusCodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		allowAll    bool
+		disallowAll bool
+	}{
+		{"not found", http.StatusNotFound, true, false},
+		{"forbidden", http.StatusForbidden, true, false},
+		{"server error", http.StatusServiceUnavailable, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			data, err := Fetch(server.URL+"/robots.txt", DefaultUserAgent, 5)
+			if err != nil {
+				t.Fatalf("Fetch() returned an error: %v", err)
+			}
+			if data.AllowAll != tt.allowAll || data.DisallowAll != tt.disallowAll {
+				t.Errorf("Fetch() AllowAll = %v, DisallowAll = %v, want %v, %v", data.AllowAll, data.DisallowAll, tt.allowAll, tt.disallowAll)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package robots implements the robots.txt (Robots Exclusion Protocol) support
+// for the CROWler.
+package robots
+
+import (
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultUserAgent is the user agent token used to match robots.txt groups
+	// when none is configured
+	DefaultUserAgent = "CROWler"
+	// DefaultCacheTTL is the default amount of time a robots.txt is cached
+	DefaultCacheTTL = 24 * time.Hour
+	// DefaultErrorTTL is the amount of time a failed robots.txt fetch is cached
+	DefaultErrorTTL = 5 * time.Minute
+	// DefaultCacheSize is the maximum number of hosts whose robots.txt is cached
+	DefaultCacheSize = 10000
+	// MaxRobotsSize is the maximum number of bytes of a robots.txt we parse (RFC 9309 requires at least 500 KiB)
+	MaxRobotsSize = 500 * 1024
+)
+
+// Rule represents a single Allow or Disallow directive
+type Rule struct {
+	Allow bool   `json:"allow" yaml:"allow"` // true for Allow, false for Disallow
+	Path  string `json:"path" yaml:"path"`   // The path pattern (can contain '*' and '$')
+}
+
+// Group represents a group of rules that apply to one or more user agents
+type Group struct {
+	UserAgents []string `json:"user_agents" yaml:"user_agents"` // Lower-cased user agent tokens of the group
+	Rules      []Rule   `json:"rules" yaml:"rules"`             // Allow/Disallow rules of the group
+	CrawlDelay float64  `json:"crawl_delay" yaml:"crawl_delay"` // Crawl-delay in seconds (0 means not set)
+}
+
+// Data represents a parsed robots.txt file
+type Data struct {
+	Host        string    `json:"host" yaml:"host"`                 // The host the robots.txt belongs to (scheme://host[:port])
+	StatusCode  int       `json:"status_code" yaml:"status_code"`   // HTTP status code returned when fetching the robots.txt
+	Groups      []Group   `json:"groups" yaml:"groups"`             // Groups of rules
+	Sitemaps    []string  `json:"sitemaps" yaml:"sitemaps"`         // Sitemap URLs declared in the robots.txt
+	FetchedAt   time.Time `json:"fetched_at" yaml:"fetched_at"`     // When the robots.txt was fetched
+	AllowAll    bool      `json:"allow_all" yaml:"allow_all"`       // Everything is allowed (e.g. robots.txt not found)
+	DisallowAll bool      `json:"disallow_all" yaml:"disallow_all"` // Everything is disallowed (e.g. robots.txt unreachable)
+	fetchErr    error     // The error (if any) returned while fetching the robots.txt
+}
+
+// Cache is a per-host cache of robots.txt files
+type Cache struct {
+	entries  *cmn.LRUCache[string, *Data] // Least recently used hosts are evicted first
+	fetches  singleflight.Group           // Deduplicates concurrent fetches of the same host
+	TTL      time.Duration                // How long a successfully fetched robots.txt is kept
+	ErrorTTL time.Duration                // How long a failed fetch is kept before retrying
+	// Fetcher is the function used to retrieve a robots.txt, it can be replaced for testing
+	Fetcher func(robotsURL, userAgent string, timeout int) (*Data, error)
+}
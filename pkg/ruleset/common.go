@@ -218,6 +218,27 @@ func validateRuleset(schema *jsonschema.Schema, ruleFile *[]byte, fileType strin
 	return nil
 }
 
+// schemaErrors returns the violations of the schema in a ruleset file (unlike
+// validateRuleset, which only fails on the errors of the validation process)
+func schemaErrors(schema *jsonschema.Schema, ruleFile []byte, fileType string) ([]jsonschema.KeyError, error) {
+	var data interface{}
+	if fileType == "json" {
+		if err := json.Unmarshal(ruleFile, &data); err != nil {
+			return nil, fmt.Errorf("problems unmarshalling JSON: %v", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(ruleFile, &data); err != nil {
+			return nil, fmt.Errorf("problems unmarshalling YAML: %v", err)
+		}
+		data = cmn.ConvertInterfaceMapToStringMap(data)
+	}
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("problems marshalling to JSON: %v", err)
+	}
+	return schema.ValidateBytes(context.Background(), jsonBytes)
+}
+
 // ParseRules is an interface for parsing rules from a file.
 func (p *DefaultRuleParser) ParseRules(file string) ([]Ruleset, error) {
 	return BulkLoadRules(nil, file)
@@ -288,8 +309,8 @@ func loadRulesFromRemote(schema *jsonschema.Schema, config cfg.RulesetConfig) (*
 	// Construct the URL to download the rules from
 	for _, path := range config.Path {
 
-		fileType := strings.ToLower(strings.TrimSpace(filepath.Ext(path)))
-		if fileType != "yaml" && fileType != "json" {
+		fileType := cmn.GetFileExt(path)
+		if fileType != "yaml" && fileType != "yml" && fileType != "json" {
 			// Ignore unsupported file types
 			continue
 		}
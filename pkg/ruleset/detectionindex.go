@@ -0,0 +1,226 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ruleset
+
+import (
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+// DetectionIndex is the precompiled form of the detection rules signatures
+// (HTTP headers, URL, meta tags, page content and SSL). Every family of
+// signatures has its own PatternSet, so a text is matched against all the
+// signatures of a family with a single pass plus the regexps that can match.
+// A DetectionIndex is read-only once built, so it can be shared between
+// goroutines.
+type DetectionIndex struct {
+	HTTPHeaders map[string]*SignatureFamily // By lower-case header name
+	URL         *SignatureFamily
+	MetaTags    map[string]*SignatureFamily // By lower-case meta tag name
+	PageContent *SignatureFamily            // Signatures with key "*" (matched against the whole page)
+	Selectors   map[string]*SignatureFamily // Other page content signatures, by lower-case CSS selector
+	SSL         *SignatureFamily
+	Rules       int // Number of detection rules indexed
+}
+
+// SignatureFamily is a list of signatures matched against the same kind of
+// text, with the PatternSet of their values
+type SignatureFamily struct {
+	Signatures []IndexedSignature
+	Patterns   *PatternSet
+}
+
+// IndexedSignature is a single signature value of a DetectionIndex
+type IndexedSignature struct {
+	ObjectName string  // Lower-case name of the object detected by the signature
+	Key        string  // Key of the signature (header name, SSL field, ...)
+	Attribute  string  // Lower-case HTML attribute the value is matched against ("" for the element text)
+	Value      string  // Signature value, as written in the rule
+	Confidence float32 // Confidence of the signature
+	Version    string  // Version template of the signature ("" if it doesn't extract versions)
+	Pattern    int     // Index of Value in the family PatternSet (-1 for "*", "!*" and the like)
+}
+
+// NewDetectionIndex compiles the signatures of a list of detection rules.
+// Invalid patterns are reported and skipped.
+func NewDetectionIndex(rules []DetectionRule) *DetectionIndex {
+	idx := &DetectionIndex{
+		HTTPHeaders: make(map[string]*SignatureFamily),
+		URL:         newSignatureFamily(),
+		MetaTags:    make(map[string]*SignatureFamily),
+		PageContent: newSignatureFamily(),
+		Selectors:   make(map[string]*SignatureFamily),
+		SSL:         newSignatureFamily(),
+		Rules:       len(rules),
+	}
+
+	idx.addHTTPHeaders(rules)
+	for _, rule := range rules {
+		objName := strings.ToLower(rule.ObjectName)
+		for _, signature := range rule.URLMicroSignatures {
+			idx.URL.add(IndexedSignature{ObjectName: objName, Value: signature.Signature, Confidence: signature.Confidence, Version: signature.Version})
+		}
+		for _, tag := range rule.MetaTags {
+			name := strings.ToLower(strings.TrimSpace(tag.Name))
+			idx.MetaTags[name] = familyOf(idx.MetaTags, name)
+			idx.MetaTags[name].add(IndexedSignature{ObjectName: objName, Key: tag.Name, Value: tag.Content, Confidence: tag.Confidence, Version: tag.Version})
+		}
+		for _, signature := range rule.PageContentPatterns {
+			idx.addPageContent(objName, signature)
+		}
+		for _, signature := range rule.SSLSignatures {
+			for _, value := range signature.Value {
+				idx.SSL.add(IndexedSignature{ObjectName: objName, Key: signature.Key, Value: value, Confidence: signature.Confidence, Version: signature.Version})
+			}
+		}
+	}
+
+	// Compile the literals matchers now, so the index is read-only
+	idx.URL.Patterns.Compile()
+	idx.PageContent.Patterns.Compile()
+	idx.SSL.Patterns.Compile()
+	for _, families := range []map[string]*SignatureFamily{idx.HTTPHeaders, idx.MetaTags, idx.Selectors} {
+		for _, family := range families {
+			family.Patterns.Compile()
+		}
+	}
+	return idx
+}
+
+// addHTTPHeaders indexes the HTTP header fields. Like
+// GetHTTPHeaderFieldsMapByKey, an object has a single field per header (the
+// last one).
+func (idx *DetectionIndex) addHTTPHeaders(rules []DetectionRule) {
+	type objectField struct {
+		objName string
+		field   HTTPHeaderField
+	}
+	fields := make(map[string][]objectField)
+	positions := make(map[string]int) // header + object -> index in fields[header]
+	for _, rule := range rules {
+		objName := strings.ToLower(rule.ObjectName)
+		for _, field := range rule.HTTPHeaderFields {
+			key := strings.ToLower(strings.TrimSpace(field.GetKey()))
+			if pos, exists := positions[key+"\x00"+objName]; exists {
+				fields[key][pos].field = field
+				continue
+			}
+			positions[key+"\x00"+objName] = len(fields[key])
+			fields[key] = append(fields[key], objectField{objName: objName, field: field})
+		}
+	}
+
+	for key, objFields := range fields {
+		family := newSignatureFamily()
+		for _, of := range objFields {
+			for _, value := range of.field.Value {
+				family.add(IndexedSignature{ObjectName: of.objName, Key: of.field.Key, Value: value, Confidence: of.field.Confidence, Version: of.field.Version})
+			}
+		}
+		idx.HTTPHeaders[key] = family
+	}
+}
+
+// addPageContent indexes a page content signature, either against the whole
+// page or against the elements selected by its key
+func (idx *DetectionIndex) addPageContent(objName string, signature PageContentSignature) {
+	if signature.Key == "*" {
+		for _, value := range signature.Signature {
+			idx.PageContent.add(IndexedSignature{ObjectName: objName, Key: signature.Key, Value: value, Confidence: signature.Confidence, Version: signature.Version})
+		}
+		return
+	}
+
+	selector := strings.ToLower(strings.TrimSpace(signature.Key))
+	family := familyOf(idx.Selectors, selector)
+	idx.Selectors[selector] = family
+	attribute := strings.ToLower(strings.TrimSpace(signature.Attribute))
+	if attribute != "" && attribute != "text" {
+		for _, value := range signature.Signature {
+			family.add(IndexedSignature{ObjectName: objName, Key: selector, Attribute: attribute, Value: value, Confidence: signature.Confidence, Version: signature.Version})
+		}
+	}
+	for _, value := range signature.Text {
+		family.add(IndexedSignature{ObjectName: objName, Key: selector, Value: value, Confidence: signature.Confidence, Version: signature.Version})
+	}
+}
+
+// IsEmpty returns true if the index has no signatures
+func (idx *DetectionIndex) IsEmpty() bool {
+	return len(idx.HTTPHeaders) == 0 && len(idx.MetaTags) == 0 && len(idx.Selectors) == 0 &&
+		len(idx.URL.Signatures) == 0 && len(idx.PageContent.Signatures) == 0 && len(idx.SSL.Signatures) == 0
+}
+
+func newSignatureFamily() *SignatureFamily {
+	return &SignatureFamily{Patterns: NewPatternSet()}
+}
+
+// familyOf returns the family with the given name, or a new one
+func familyOf(families map[string]*SignatureFamily, name string) *SignatureFamily {
+	if family, exists := families[name]; exists {
+		return family
+	}
+	return newSignatureFamily()
+}
+
+// add compiles the value of a signature and adds it to the family ("*" and
+// "!*" are kept as they are, their meaning depends on the family)
+func (f *SignatureFamily) add(signature IndexedSignature) {
+	signature.Pattern = -1
+	if signature.Value != "*" && signature.Value != "!*" {
+		id, err := f.Patterns.Add(signature.Value)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "compiling detection signature '%s' of '%s': %v", signature.Value, signature.ObjectName, err)
+			return
+		}
+		signature.Pattern = id
+	}
+	f.Signatures = append(f.Signatures, signature)
+}
+
+// GetDetectionIndex returns the DetectionIndex of the enabled detection
+// rules. The index is built the first time it's needed and then kept in the
+// cache until the rulesets change.
+func (re *RuleEngine) GetDetectionIndex() *DetectionIndex {
+	if re == nil {
+		return nil
+	}
+
+	re.Cache.Mu.RLock()
+	version := re.Cache.Version
+	if re.Cache.DetectionIndex != nil {
+		idx := re.Cache.DetectionIndex
+		re.Cache.Mu.RUnlock()
+		return idx
+	}
+	re.Cache.Mu.RUnlock()
+
+	var rules []DetectionRule
+	for _, rg := range re.GetAllEnabledRuleGroups() {
+		rules = append(rules, rg.DetectionRules...)
+	}
+	idx := NewDetectionIndex(rules)
+
+	// Update the cache (unless the rulesets changed in the meantime)
+	re.Cache.Mu.Lock()
+	if re.Cache.Version == version {
+		re.Cache.DetectionIndex = idx
+	}
+	re.Cache.Mu.Unlock()
+	cmn.DebugMsg(cmn.DbgLvlDebug2, "Built the detection index for %d detection rules.", len(rules))
+
+	return idx
+}
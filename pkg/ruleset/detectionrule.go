@@ -17,6 +17,7 @@
 package ruleset
 
 import (
+	"regexp"
 	"strings"
 
 	cmn "github.com/pzaino/thecrowler/pkg/common"
@@ -101,6 +102,16 @@ func (d *DetectionRule) GetAllMetaTags() []MetaTag {
 	return trimmedMetaTags
 }
 
+// GetAllCookies returns the cookie signatures for the specified detection rule.
+func (d *DetectionRule) GetAllCookies() []CookieSignature {
+	return d.Cookies
+}
+
+// GetAllJSGlobals returns the JavaScript global signatures for the specified detection rule.
+func (d *DetectionRule) GetAllJSGlobals() []JSGlobalSignature {
+	return d.JSGlobals
+}
+
 /// --- Special Getters --- ///
 
 // GetAllHTTPHeaderFieldsMap returns a map of all HTTP header fields for the specified detection rules.
@@ -225,6 +236,32 @@ func GetAllMetaTagsMap(d *[]DetectionRule) map[string][]MetaTag {
 	return tags
 }
 
+// GetAllCookiesMap returns a map of all cookie signatures for the specified detection rules.
+func GetAllCookiesMap(d *[]DetectionRule) map[string][]CookieSignature {
+	signatures := make(map[string][]CookieSignature)
+	for _, rule := range *d {
+		if rule.Cookies == nil {
+			continue
+		}
+		key := strings.ToLower(rule.ObjectName)
+		signatures[key] = append(signatures[key], rule.Cookies...)
+	}
+	return signatures
+}
+
+// GetAllJSGlobalsMap returns a map of all JavaScript global signatures for the specified detection rules.
+func GetAllJSGlobalsMap(d *[]DetectionRule) map[string][]JSGlobalSignature {
+	signatures := make(map[string][]JSGlobalSignature)
+	for _, rule := range *d {
+		if rule.JSGlobals == nil {
+			continue
+		}
+		key := strings.ToLower(rule.ObjectName)
+		signatures[key] = append(signatures[key], rule.JSGlobals...)
+	}
+	return signatures
+}
+
 // GetAllPluginCallsMap returns a map of all plugin calls for the specified detection rules.
 func GetAllPluginCallsMap(d *[]DetectionRule) map[string][]PluginCall {
 	pluginCalls := make(map[string][]PluginCall)
@@ -304,3 +341,41 @@ func (m *MetaTag) GetName() string {
 func (m *MetaTag) GetContent() string {
 	return strings.TrimSpace(m.Content)
 }
+
+///// --------------------- Versions ------------------------------- /////
+
+// ExpandVersion returns the version matched by re in text, following a
+// version template. The template can use the capture groups of re ("$1",
+// "${1}", "${name}") or be a fixed version (e.g. "2.x"). It returns "" if the
+// template is empty or re doesn't match text.
+func ExpandVersion(re *regexp.Regexp, template, text string) string {
+	if template == "" {
+		return ""
+	}
+	if re == nil {
+		return normalizeVersion(template)
+	}
+	match := re.FindStringSubmatchIndex(text)
+	if match == nil {
+		return ""
+	}
+	return normalizeVersion(string(re.ExpandString(nil, template, text, match)))
+}
+
+// ExtractVersion compiles pattern and returns the version it matches in
+// text (see ExpandVersion)
+func ExtractVersion(pattern, template, text string) string {
+	if template == "" {
+		return ""
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return ""
+	}
+	return ExpandVersion(re, template, text)
+}
+
+// normalizeVersion removes the spaces and separators around a version
+func normalizeVersion(version string) string {
+	return strings.Trim(strings.TrimSpace(version), ".-_+ ")
+}
@@ -17,6 +17,7 @@
 package ruleset
 
 import (
+	"regexp"
 	"testing"
 )
 
@@ -949,6 +950,38 @@ func equalHTTPHeaderFields(a, b []HTTPHeaderField) bool {
 	return true
 }
 
+func TestExpandVersion(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		template string
+		text     string
+		expected string
+	}{
+		{"wordpress ?([0-9.]+)?", "$1", "wordpress 6.4.2", "6.4.2"},
+		{"wordpress ?([0-9.]+)?", "$1", "wordpress", ""},
+		{"jquery[.-]([0-9]+)\\.([0-9]+)", "${1}.${2}", "jquery-3.7.min.js", "3.7"},
+		{"nginx/(?P<version>[0-9.]+)", "${version}", "nginx/1.24.0", "1.24.0"},
+		{"nginx/([0-9.]+)", "$1", "nginx/1.24.", "1.24"},
+		{"apache", "2.x", "apache", "2.x"},
+		{"apache", "2.x", "nginx", ""},
+		{"apache", "", "apache", ""},
+	}
+	for _, tt := range tests {
+		if got := ExpandVersion(regexp.MustCompile(tt.pattern), tt.template, tt.text); got != tt.expected {
+			t.Errorf("ExpandVersion(%q, %q, %q) = %q, expected %q", tt.pattern, tt.template, tt.text, got, tt.expected)
+		}
+		if got := ExtractVersion(tt.pattern, tt.template, tt.text); got != tt.expected {
+			t.Errorf("ExtractVersion(%q, %q, %q) = %q, expected %q", tt.pattern, tt.template, tt.text, got, tt.expected)
+		}
+	}
+	if got := ExpandVersion(nil, "1.0", ""); got != "1.0" {
+		t.Errorf("ExpandVersion() with a fixed template = %q, expected %q", got, "1.0")
+	}
+	if got := ExtractVersion("(bad", "$1", "bad"); got != "" {
+		t.Errorf("ExtractVersion() with an invalid pattern = %q, expected an empty version", got)
+	}
+}
+
 // Helper function to compare two ExternalDetection structs
 func equalExternalDetection(a, b ExternalDetection) bool {
 	if a.Name != b.Name {
@@ -0,0 +1,465 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ruleset implements the ruleset library for the Crowler and
+// the scrapper.
+package ruleset
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/xpath"
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+	"github.com/qri-io/jsonschema"
+	"gopkg.in/yaml.v2"
+)
+
+// Severities of the LintIssues
+const (
+	LintError   = "error"   // The rule fails (or panics) when it's applied
+	LintWarning = "warning" // The rule (or part of it) is never applied
+)
+
+const strPluginCall = "plugin_call"
+
+// selectorTypes are the selector types supported by the scraping and the
+// action rules
+var selectorTypes = map[string]bool{
+	"css": true, "xpath": true, "id": true, "name": true, "js_path": true,
+	"link_text": true, "linktext": true, "partial_link_text": true, "partiallinktext": true,
+	"tag_name": true, "tagname": true, "tag": true, "element": true,
+	"class_name": true, "classname": true, "class": true,
+	"regex": true, strPluginCall: true,
+}
+
+// LintIssue is a problem found in a ruleset by Lint
+type LintIssue struct {
+	Severity string `json:"severity"` // LintError or LintWarning
+	Location string `json:"location"` // Where the problem is, e.g. `group "News" > scraping rule "Articles"`
+	Message  string `json:"message"`
+}
+
+// String returns the issue as "severity: location: message"
+func (i LintIssue) String() string {
+	if i.Location == "" {
+		return i.Severity + ": " + i.Message
+	}
+	return i.Severity + ": " + i.Location + ": " + i.Message
+}
+
+// LintRuleset parses a ruleset file (fileType is "yaml" or "json") and
+// returns the ruleset and its problems: the schema violations (if schema
+// isn't nil) and the ones found by Lint.
+func LintRuleset(schema *jsonschema.Schema, data []byte, fileType string, plugins *plg.JSPluginRegister) (Ruleset, []LintIssue) {
+	var issues []LintIssue
+	if schema != nil {
+		keyErrors, err := schemaErrors(schema, data, fileType)
+		if err != nil {
+			return Ruleset{}, []LintIssue{{Severity: LintError, Message: err.Error()}}
+		}
+		for _, keyError := range keyErrors {
+			issues = append(issues, LintIssue{Severity: LintError, Location: keyError.PropertyPath, Message: "schema: " + keyError.Message})
+		}
+	}
+
+	var ruleset Ruleset
+	var err error
+	if fileType == "json" {
+		err = json.Unmarshal(data, &ruleset)
+	} else {
+		err = yaml.Unmarshal(data, &ruleset)
+	}
+	if err != nil {
+		return ruleset, append(issues, LintIssue{Severity: LintError, Message: fmt.Sprintf("parsing the ruleset: %v", err)})
+	}
+	return ruleset, append(issues, ruleset.Lint(plugins)...)
+}
+
+// Lint checks the ruleset for the problems that would otherwise show up
+// only while crawling: invalid regular expressions, XPaths and CSS
+// selectors, unknown selector types, missing plugins (if plugins isn't nil),
+// duplicate rule names and unreachable rules.
+func (rs *Ruleset) Lint(plugins *plg.JSPluginRegister) []LintIssue {
+	l := &rulesetLinter{plugins: plugins, now: time.Now()}
+
+	groups := make(map[string]string)
+	names := make(map[string]string)
+	implied := make(map[string]bool)
+	for _, rg := range rs.RuleGroups {
+		for _, rule := range rg.DetectionRules {
+			for _, name := range rule.Implies {
+				implied[strings.ToLower(strings.TrimSpace(name))] = true
+			}
+		}
+	}
+	actionURLs := make(map[string]string)
+	scrapingPaths := make(map[string]string)
+
+	for i := range rs.RuleGroups {
+		rg := &rs.RuleGroups[i]
+		loc := fmt.Sprintf("group %q", rg.GroupName)
+		l.duplicate(groups, loc, "rule group", rg.GroupName)
+		reachable := l.group(loc, rg)
+		l.urlPattern(loc+" > url", rg.URL)
+
+		for j := range rg.ScrapingRules {
+			rule := &rg.ScrapingRules[j]
+			ruleLoc := fmt.Sprintf("%s > scraping rule %q", loc, rule.RuleName)
+			l.duplicate(names, ruleLoc, "scraping rule", rule.RuleName)
+			l.scrapingRule(ruleLoc, rule)
+			if reachable {
+				for _, pc := range rule.PreConditions {
+					l.shadowed(scrapingPaths, ruleLoc, "path", strings.TrimSpace(pc.Path), "scraping rule", rule.RuleName)
+				}
+			}
+		}
+		for j := range rg.ActionRules {
+			rule := &rg.ActionRules[j]
+			ruleLoc := fmt.Sprintf("%s > action rule %q", loc, rule.RuleName)
+			l.duplicate(names, ruleLoc, "action rule", rule.RuleName)
+			l.actionRule(ruleLoc, rule)
+			if reachable && IsURL(rule.URL) {
+				l.shadowed(actionURLs, ruleLoc, "url", strings.TrimSpace(rule.URL), "action rule", rule.RuleName)
+			}
+		}
+		for j := range rg.DetectionRules {
+			rule := &rg.DetectionRules[j]
+			ruleLoc := fmt.Sprintf("%s > detection rule %q", loc, detectionRuleName(rule))
+			l.duplicate(names, ruleLoc, "detection rule", rule.RuleName)
+			l.detectionRule(ruleLoc, rule, implied)
+		}
+		for j := range rg.CrawlingRules {
+			rule := &rg.CrawlingRules[j]
+			ruleLoc := fmt.Sprintf("%s > crawling rule %q", loc, rule.RuleName)
+			l.duplicate(names, ruleLoc, "crawling rule", rule.RuleName)
+			l.crawlingRule(ruleLoc, rule)
+		}
+		for j, step := range rg.PostProcessing {
+			l.postProcessing(fmt.Sprintf("%s > post_processing[%d]", loc, j), step)
+		}
+	}
+	return l.issues
+}
+
+// rulesetLinter collects the issues found by Ruleset.Lint
+type rulesetLinter struct {
+	plugins *plg.JSPluginRegister
+	now     time.Time
+	issues  []LintIssue
+}
+
+func (l *rulesetLinter) errorf(location, format string, args ...interface{}) {
+	l.issues = append(l.issues, LintIssue{Severity: LintError, Location: location, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *rulesetLinter) warnf(location, format string, args ...interface{}) {
+	l.issues = append(l.issues, LintIssue{Severity: LintWarning, Location: location, Message: fmt.Sprintf(format, args...)})
+}
+
+// duplicate reports a name already used by another rule (the rules are
+// looked up by name, so only the first one is found)
+func (l *rulesetLinter) duplicate(seen map[string]string, location, kind, name string) {
+	key := kind + ":" + strings.ToLower(strings.TrimSpace(name))
+	if strings.TrimSpace(name) == "" {
+		return
+	}
+	if first, exists := seen[key]; exists {
+		l.errorf(location, "duplicate %s name, already used by %s", kind, first)
+		return
+	}
+	seen[key] = location
+}
+
+// shadowed reports a rule selected by the same url (or path) of a previous
+// one, the lookups return the first rule only
+func (l *rulesetLinter) shadowed(seen map[string]string, location, field, value, kind, name string) {
+	if value == "" {
+		return
+	}
+	key := strings.ToLower(value)
+	if first, exists := seen[key]; exists {
+		l.warnf(location, "unreachable: %s %q is already selected by %s, %s %q is never selected by %s", field, value, first, kind, name, field)
+		return
+	}
+	seen[key] = location
+}
+
+// group checks the validity of a rule group, it returns false if its rules
+// are never applied
+func (l *rulesetLinter) group(location string, rg *RuleGroup) bool {
+	rules := len(rg.ScrapingRules) + len(rg.ActionRules) + len(rg.DetectionRules) + len(rg.CrawlingRules)
+	switch {
+	case !rg.IsEnabled:
+		if rules > 0 {
+			l.warnf(location, "unreachable: the group is disabled, its %d rule(s) are never applied", rules)
+		}
+		return false
+	case !rg.ValidFrom.IsEmpty() && !rg.ValidTo.IsEmpty() && !rg.ValidFrom.Before(rg.ValidTo.Time):
+		l.warnf(location, "unreachable: valid_from (%s) isn't before valid_to (%s), the group is never valid", rg.ValidFrom.Format(time.RFC3339), rg.ValidTo.Format(time.RFC3339))
+		return false
+	case !rg.ValidTo.IsEmpty() && rg.ValidTo.Before(l.now):
+		l.warnf(location, "unreachable: the group expired on %s, its rules are never applied", rg.ValidTo.Format(time.RFC3339))
+		return false
+	}
+	return true
+}
+
+// regex reports an invalid regular expression
+func (l *rulesetLinter) regex(location, pattern string) bool {
+	if _, err := regexp.Compile(pattern); err != nil {
+		l.errorf(location, "invalid regular expression '%s': %v", pattern, err)
+		return false
+	}
+	return true
+}
+
+// urlPattern checks a url used as a pattern (the urls are matched as
+// regular expressions when they look like urls, see CheckURL)
+func (l *rulesetLinter) urlPattern(location, pattern string) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern != "" && pattern != "*" && IsURL(pattern) {
+		l.regex(location, pattern)
+	}
+}
+
+// signature checks a detection signature, lowerCase is true for the
+// signatures matched against lower-cased text
+func (l *rulesetLinter) signature(location, pattern string, lowerCase bool) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || pattern == "*" || pattern == "!*" || !l.regex(location, pattern) {
+		return
+	}
+	if lowerCase {
+		if upper := upperCaseLiteral(pattern); upper != "" {
+			l.warnf(location, "unreachable: '%s' requires the upper-case text '%s', but it's matched against lower-case text", pattern, upper)
+		}
+	}
+}
+
+// upperCaseLiteral returns the first case-sensitive literal of a regular
+// expression containing upper-case letters ("" if there are none)
+func upperCaseLiteral(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	var walk func(*syntax.Regexp) string
+	walk = func(re *syntax.Regexp) string {
+		if re.Op == syntax.OpLiteral && re.Flags&syntax.FoldCase == 0 {
+			for _, r := range re.Rune {
+				if unicode.IsUpper(r) {
+					return string(re.Rune)
+				}
+			}
+		}
+		for _, sub := range re.Sub {
+			if literal := walk(sub); literal != "" {
+				return literal
+			}
+		}
+		return ""
+	}
+	return walk(re)
+}
+
+// css reports an invalid CSS selector
+func (l *rulesetLinter) css(location, selector string) {
+	if _, err := cascadia.ParseGroup(selector); err != nil {
+		l.errorf(location, "invalid CSS selector '%s': %v", selector, err)
+	}
+}
+
+// plugin reports a call to a missing plugin
+func (l *rulesetLinter) plugin(location, name string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		l.errorf(location, "missing plugin name")
+		return
+	}
+	if l.plugins == nil {
+		return
+	}
+	if _, exists := l.plugins.GetPlugin(name); !exists {
+		l.errorf(location, "plugin '%s' not found", name)
+	}
+}
+
+// selector checks a selector of a scraping or an action rule
+func (l *rulesetLinter) selector(location string, sel *Selector) {
+	sType := strings.ToLower(strings.TrimSpace(sel.SelectorType))
+	if !selectorTypes[sType] {
+		l.errorf(location, "unsupported selector type '%s'", sel.SelectorType)
+		return
+	}
+	if strings.TrimSpace(sel.Selector) == "" {
+		l.errorf(location, "empty selector")
+		return
+	}
+	switch sType {
+	case "css", "js_path":
+		l.css(location, sel.Selector)
+	case "xpath":
+		if _, err := xpath.Compile(sel.Selector); err != nil {
+			l.errorf(location, "invalid XPath '%s': %v", sel.Selector, err)
+		}
+	case "regex":
+		l.regex(location, sel.Selector)
+	case strPluginCall:
+		l.plugin(location, sel.Selector)
+	}
+	if value := strings.TrimSpace(sel.Attribute.Value); value != "" && value != "*" {
+		l.regex(location+" > attribute", value)
+	}
+	if pattern := sel.Extract.Pattern; pattern != "" && pattern != ".*" && !strings.EqualFold(strings.TrimSpace(sel.Extract.Type), "attribute") {
+		l.regex(location+" > extract", pattern)
+	}
+}
+
+func (l *rulesetLinter) scrapingRule(location string, rule *ScrapingRule) {
+	for i, pc := range rule.PreConditions {
+		l.urlPattern(fmt.Sprintf("%s > pre_conditions[%d]", location, i), pc.URL)
+	}
+	for i, wc := range rule.WaitConditions {
+		if strings.EqualFold(strings.TrimSpace(wc.ConditionType), strPluginCall) {
+			l.plugin(fmt.Sprintf("%s > wait_conditions[%d]", location, i), wc.Value)
+		}
+	}
+	if len(rule.Elements) == 0 && !rule.JsFiles {
+		l.warnf(location, "the rule has no elements, it never extracts anything")
+	}
+	for i, element := range rule.Elements {
+		elementLoc := fmt.Sprintf("%s > element %q", location, element.Key)
+		if i > 0 && element.Key == "" {
+			elementLoc = fmt.Sprintf("%s > elements[%d]", location, i)
+		}
+		if len(element.Selectors) == 0 {
+			l.warnf(elementLoc, "the element has no selectors, it's never extracted")
+		}
+		for j := range element.Selectors {
+			l.selector(fmt.Sprintf("%s > selectors[%d]", elementLoc, j), &element.Selectors[j])
+		}
+	}
+	for i, step := range rule.PostProcessing {
+		l.postProcessing(fmt.Sprintf("%s > post_processing[%d]", location, i), step)
+	}
+}
+
+func (l *rulesetLinter) actionRule(location string, rule *ActionRule) {
+	l.urlPattern(location+" > url", rule.URL)
+	for i := range rule.Selectors {
+		l.selector(fmt.Sprintf("%s > selectors[%d]", location, i), &rule.Selectors[i])
+	}
+	for i, wc := range rule.WaitConditions {
+		if strings.EqualFold(strings.TrimSpace(wc.ConditionType), strPluginCall) {
+			l.plugin(fmt.Sprintf("%s > wait_conditions[%d]", location, i), wc.Value)
+		}
+	}
+	for i, step := range rule.PostProcessing {
+		l.postProcessing(fmt.Sprintf("%s > post_processing[%d]", location, i), step)
+	}
+}
+
+func (l *rulesetLinter) postProcessing(location string, step PostProcessingStep) {
+	stepType := strings.ToLower(strings.TrimSpace(step.Type))
+	transform, _ := step.Details["transform_type"].(string)
+	if stepType != strPluginCall && (stepType != "transform" || !strings.EqualFold(strings.TrimSpace(transform), strPluginCall)) {
+		return
+	}
+	name, _ := step.Details["plugin_name"].(string)
+	if strings.TrimSpace(name) == "" {
+		l.errorf(location, "plugin_name not specified in the step details")
+		return
+	}
+	l.plugin(location, name)
+}
+
+func (l *rulesetLinter) crawlingRule(location string, rule *CrawlingRule) {
+	for i, target := range rule.TargetElements {
+		l.selector(fmt.Sprintf("%s > target_elements[%d]", location, i), &Selector{SelectorType: target.SelectorType, Selector: target.Selector})
+	}
+	for i, param := range rule.FuzzingParameters {
+		if param.Pattern != "" {
+			l.regex(fmt.Sprintf("%s > fuzzing_parameters[%d]", location, i), param.Pattern)
+		}
+	}
+}
+
+func (l *rulesetLinter) detectionRule(location string, rule *DetectionRule, implied map[string]bool) {
+	signatures := 0
+	for i, field := range rule.HTTPHeaderFields {
+		for _, value := range field.Value {
+			l.signature(fmt.Sprintf("%s > http_header_fields[%d]", location, i), value, true)
+			signatures++
+		}
+	}
+	for i, pattern := range rule.PageContentPatterns {
+		patternLoc := fmt.Sprintf("%s > page_content_patterns[%d]", location, i)
+		if key := strings.TrimSpace(pattern.Key); key != "*" && key != "" {
+			l.css(patternLoc, key)
+		}
+		for _, value := range append(append([]string{}, pattern.Signature...), pattern.Text...) {
+			l.signature(patternLoc, value, true)
+			signatures++
+		}
+	}
+	for i, sig := range rule.SSLSignatures {
+		for _, value := range sig.Value {
+			l.signature(fmt.Sprintf("%s > ssl_patterns[%d]", location, i), value, false)
+			signatures++
+		}
+	}
+	for i, sig := range rule.URLMicroSignatures {
+		l.signature(fmt.Sprintf("%s > url_micro_signatures[%d]", location, i), sig.Signature, false)
+		signatures++
+	}
+	for i, tag := range rule.MetaTags {
+		l.signature(fmt.Sprintf("%s > meta_tags[%d]", location, i), tag.Content, true)
+		signatures++
+	}
+	for i, cookie := range rule.Cookies {
+		for _, value := range cookie.Value {
+			l.signature(fmt.Sprintf("%s > cookies[%d]", location, i), value, true)
+		}
+		signatures++
+	}
+	for i, global := range rule.JSGlobals {
+		for _, value := range global.Value {
+			l.signature(fmt.Sprintf("%s > js_globals[%d]", location, i), value, true)
+		}
+		signatures++
+	}
+	for i, call := range rule.PluginCalls {
+		l.plugin(fmt.Sprintf("%s > plugin_calls[%d]", location, i), call.PluginName)
+		signatures++
+	}
+
+	if signatures == 0 && !implied[strings.ToLower(strings.TrimSpace(rule.ObjectName))] {
+		l.warnf(location, "unreachable: the rule has no signatures and no other rule implies '%s'", rule.ObjectName)
+	}
+}
+
+// detectionRuleName returns the name of a detection rule (or its object)
+func detectionRuleName(rule *DetectionRule) string {
+	if rule.RuleName != "" {
+		return rule.RuleName
+	}
+	return rule.ObjectName
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ruleset implements the ruleset library for the Crowler and
+// the scrapper.
+package ruleset
+
+import (
+	"strings"
+	"testing"
+
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+)
+
+// findIssue returns the first issue with the given severity, containing
+// location and message
+func findIssue(issues []LintIssue, severity, location, message string) bool {
+	for _, issue := range issues {
+		if issue.Severity == severity && strings.Contains(issue.Location, location) && strings.Contains(issue.Message, message) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRulesetLint(t *testing.T) {
+	ruleset := Ruleset{
+		Name: "lint",
+		RuleGroups: []RuleGroup{
+			{
+				GroupName: "Valid",
+				URL:       "https://example\\.com/(shop",
+				IsEnabled: true,
+				ScrapingRules: []ScrapingRule{
+					{
+						RuleName:      "Products",
+						PreConditions: []PreCondition{{Path: "/products"}},
+						Elements: []Element{
+							{Key: "title", Selectors: []Selector{
+								{SelectorType: "css", Selector: "h1.title"},
+								{SelectorType: "css", Selector: "h1[["},
+								{SelectorType: "xpath", Selector: "//h1[@class='title'"},
+								{SelectorType: "regex", Selector: "<h1>(.*</h1>"},
+								{SelectorType: "jquery", Selector: "$('h1')"},
+								{SelectorType: "plugin_call", Selector: "missingPlugin"},
+								{SelectorType: "plugin_call", Selector: "titlePlugin"},
+							}},
+							{Key: "empty"},
+						},
+					},
+					{
+						RuleName:      "Products (copy)",
+						PreConditions: []PreCondition{{Path: "/products"}},
+						Elements: []Element{
+							{Key: "title", Selectors: []Selector{{SelectorType: "css", Selector: "h1"}}},
+						},
+					},
+				},
+				ActionRules: []ActionRule{
+					{RuleName: "Accept", URL: "https://example\\.com/.*", ActionType: "click", Selectors: []Selector{{SelectorType: "id", Selector: "accept"}}},
+					{RuleName: "Accept again", URL: "https://example\\.com/.*", ActionType: "click", Selectors: []Selector{{SelectorType: "id", Selector: "accept"}}},
+				},
+				DetectionRules: []DetectionRule{
+					{
+						ObjectName:       "Nginx",
+						HTTPHeaderFields: []HTTPHeaderField{{Key: "Server", Value: []string{"Nginx"}}},
+						Implies:          []string{"Linux"},
+					},
+					{ObjectName: "Linux"},
+					{ObjectName: "Orphan"},
+					{ObjectName: "Broken", MetaTags: []MetaTag{{Name: "generator", Content: "broken ([0-9."}}},
+					{ObjectName: "Nocase", MetaTags: []MetaTag{{Name: "generator", Content: "(?i)Nocase"}}},
+				},
+			},
+			{
+				GroupName: "Disabled",
+				IsEnabled: false,
+				ScrapingRules: []ScrapingRule{
+					{RuleName: "Products", Elements: []Element{{Key: "title", Selectors: []Selector{{SelectorType: "css", Selector: "h1"}}}}},
+				},
+			},
+		},
+	}
+
+	plugins := plg.NewJSPluginRegister()
+	plugins.Register("titlePlugin", plg.JSPlugin{Name: "titlePlugin"})
+	issues := ruleset.Lint(plugins)
+
+	tests := []struct {
+		severity string
+		location string
+		message  string
+	}{
+		{LintError, `group "Valid" > url`, "invalid regular expression"},
+		{LintError, "selectors[1]", "invalid CSS selector"},
+		{LintError, "selectors[2]", "invalid XPath"},
+		{LintError, "selectors[3]", "invalid regular expression"},
+		{LintError, "selectors[4]", "unsupported selector type 'jquery'"},
+		{LintError, "selectors[5]", "plugin 'missingPlugin' not found"},
+		{LintWarning, `element "empty"`, "no selectors"},
+		{LintWarning, `scraping rule "Products (copy)"`, `path "/products" is already selected`},
+		{LintWarning, `action rule "Accept again"`, "unreachable"},
+		{LintWarning, `detection rule "Orphan"`, "no signatures"},
+		{LintWarning, `detection rule "Nginx" > http_header_fields[0]`, "upper-case text 'Nginx'"},
+		{LintError, `detection rule "Broken" > meta_tags[0]`, "invalid regular expression"},
+		{LintWarning, `group "Disabled"`, "the group is disabled"},
+		{LintError, `group "Disabled" > scraping rule "Products"`, "duplicate scraping rule name"},
+	}
+	for _, test := range tests {
+		if !findIssue(issues, test.severity, test.location, test.message) {
+			t.Errorf("missing %s at %s: %s", test.severity, test.location, test.message)
+		}
+	}
+
+	for _, unexpected := range []string{"selectors[0]", "selectors[6]", `detection rule "Linux"`, `detection rule "Nocase"`} {
+		for _, issue := range issues {
+			if strings.HasSuffix(issue.Location, unexpected) {
+				t.Errorf("unexpected issue: %s", issue)
+			}
+		}
+	}
+	if t.Failed() {
+		for _, issue := range issues {
+			t.Log(issue)
+		}
+	}
+}
+
+func TestLintRuleset(t *testing.T) {
+	schema, err := LoadSchema("../../schemas/ruleset-schema.json")
+	if err != nil {
+		t.Fatalf("loading the schema: %v", err)
+	}
+
+	valid := `
+format_version: "1.0.0"
+author: "test"
+created_at: "2024-01-01T00:00:00Z"
+description: "A valid ruleset"
+ruleset_name: "Valid"
+rule_groups:
+  - group_name: "Products"
+    is_enabled: true
+    scraping_rules:
+      - rule_name: "Product"
+        elements:
+          - key: "title"
+            selectors:
+              - selector_type: "css"
+                selector: "h1"
+`
+	ruleset, issues := LintRuleset(schema, []byte(valid), "yaml", nil)
+	if len(issues) != 0 {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+	if ruleset.Name != "Valid" || len(ruleset.RuleGroups) != 1 {
+		t.Errorf("unexpected ruleset: %+v", ruleset)
+	}
+
+	invalid := strings.Replace(valid, `format_version: "1.0.0"`, `format_version: "1.0"`, 1)
+	if _, issues = LintRuleset(schema, []byte(invalid), "yaml", nil); !findIssue(issues, LintError, "/format_version", "schema:") {
+		t.Errorf("missing the schema error: %v", issues)
+	}
+
+	if _, issues = LintRuleset(nil, []byte("- not a ruleset"), "yaml", nil); !findIssue(issues, LintError, "", "parsing the ruleset") {
+		t.Errorf("missing the parsing error: %v", issues)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ruleset
+
+import (
+	"regexp"
+	"regexp/syntax"
+)
+
+// PatternSet is a set of precompiled regular expressions matched against the
+// same text. Every pattern is compiled once and, when possible, reduced to a
+// literal the text must contain for the pattern to match. All the literals
+// of the set are searched in a single pass over the text (Aho-Corasick), so
+// the patterns that can't match are skipped without running their regexp.
+type PatternSet struct {
+	patterns []compiledPattern
+	literals []string
+	ids      map[string]int // literal -> index in literals
+	ac       *literalMatcher
+}
+
+// compiledPattern is a pattern of a PatternSet
+type compiledPattern struct {
+	re      *regexp.Regexp
+	plain   bool // The pattern is a plain literal (no need to run its regexp)
+	literal int  // Index of the literal required by the pattern (-1 if none)
+}
+
+// NewPatternSet returns a new empty PatternSet
+func NewPatternSet() *PatternSet {
+	return &PatternSet{ids: make(map[string]int)}
+}
+
+// Add compiles a pattern, adds it to the set and returns its index (to
+// retrieve its result from the Matches of a text)
+func (s *PatternSet) Add(pattern string) (int, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return -1, err
+	}
+
+	p := compiledPattern{re: re, literal: -1}
+	prefix, complete := re.LiteralPrefix()
+	if complete {
+		// The pattern matches a plain literal
+		p.plain = true
+		if prefix != "" {
+			p.literal = s.addLiteral(prefix)
+		}
+	} else if literal := requiredLiteral(pattern); literal != "" {
+		p.literal = s.addLiteral(literal)
+	}
+	s.patterns = append(s.patterns, p)
+	s.ac = nil
+	return len(s.patterns) - 1, nil
+}
+
+// Len returns the number of patterns in the set
+func (s *PatternSet) Len() int {
+	return len(s.patterns)
+}
+
+// addLiteral adds a literal to the set (once) and returns its index
+func (s *PatternSet) addLiteral(literal string) int {
+	if id, exists := s.ids[literal]; exists {
+		return id
+	}
+	s.literals = append(s.literals, literal)
+	s.ids[literal] = len(s.literals) - 1
+	return len(s.literals) - 1
+}
+
+// Compile builds the literals matcher of the set. It's called by Scan when
+// needed, but it's not safe for concurrent use, so the sets shared between
+// goroutines must be compiled before sharing them.
+func (s *PatternSet) Compile() {
+	if s.ac == nil {
+		s.ac = newLiteralMatcher(s.literals)
+	}
+}
+
+// Scan searches the literals of the set in text and returns the Matches of
+// text, which evaluate the patterns on demand
+func (s *PatternSet) Scan(text string) *Matches {
+	s.Compile()
+	return &Matches{
+		set:    s,
+		text:   text,
+		found:  s.ac.find(text),
+		result: make([]int8, len(s.patterns)),
+	}
+}
+
+// Matches are the results of the patterns of a PatternSet for a text. The
+// patterns are evaluated only when requested (and only once).
+type Matches struct {
+	set    *PatternSet
+	text   string
+	found  []bool // Literals of the set found in text
+	result []int8 // 0 not evaluated yet, 1 match, -1 no match
+}
+
+// Match returns true if the pattern with index id matches the text
+func (m *Matches) Match(id int) bool {
+	if id < 0 || id >= len(m.result) {
+		return false
+	}
+	if m.result[id] == 0 {
+		m.result[id] = -1
+		if m.evaluate(m.set.patterns[id]) {
+			m.result[id] = 1
+		}
+	}
+	return m.result[id] == 1
+}
+
+// evaluate matches a pattern against the text, skipping its regexp when its
+// literal isn't in the text
+func (m *Matches) evaluate(p compiledPattern) bool {
+	if p.literal >= 0 && !m.found[p.literal] {
+		return false
+	}
+	if p.plain {
+		return true
+	}
+	return p.re.MatchString(m.text)
+}
+
+// Version returns the version matched by the pattern with index id,
+// following a version template (see ExpandVersion). It returns "" if the
+// pattern doesn't match.
+func (m *Matches) Version(id int, template string) string {
+	if template == "" || !m.Match(id) {
+		return ""
+	}
+	return ExpandVersion(m.set.patterns[id].re, template, m.text)
+}
+
+// requiredLiteral returns the longest literal every match of pattern must
+// contain ("" if there isn't one or it can't be determined)
+func requiredLiteral(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	return requiredLiteralOf(re.Simplify())
+}
+
+func requiredLiteralOf(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return ""
+		}
+		return string(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiteralOf(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return ""
+		}
+		return requiredLiteralOf(re.Sub[0])
+	case syntax.OpConcat:
+		longest := ""
+		for _, sub := range re.Sub {
+			if literal := requiredLiteralOf(sub); len(literal) > len(longest) {
+				longest = literal
+			}
+		}
+		return longest
+	default:
+		return ""
+	}
+}
+
+// literalMatcher finds a set of literals in a text with a single pass
+// (Aho-Corasick automaton)
+type literalMatcher struct {
+	nodes    []acNode
+	literals int
+}
+
+type acNode struct {
+	next   map[byte]int32
+	fail   int32
+	output int32 // Index of the literal ending at this node (-1 if none)
+	dict   int32 // Nearest node, following the failure links, with an output (-1 if none)
+}
+
+func newLiteralMatcher(literals []string) *literalMatcher {
+	m := &literalMatcher{
+		nodes:    []acNode{{next: make(map[byte]int32), output: -1, dict: -1}},
+		literals: len(literals),
+	}
+
+	// Build the trie
+	for id, literal := range literals {
+		n := int32(0)
+		for i := 0; i < len(literal); i++ {
+			child, exists := m.nodes[n].next[literal[i]]
+			if !exists {
+				child = int32(len(m.nodes))
+				m.nodes = append(m.nodes, acNode{next: make(map[byte]int32), output: -1, dict: -1})
+				m.nodes[n].next[literal[i]] = child
+			}
+			n = child
+		}
+		m.nodes[n].output = int32(id)
+	}
+
+	// Build the failure and dictionary links (breadth first)
+	queue := make([]int32, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for c, child := range m.nodes[n].next {
+			f := m.nodes[n].fail
+			for {
+				if next, exists := m.nodes[f].next[c]; exists && next != child {
+					m.nodes[child].fail = next
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			fail := m.nodes[child].fail
+			if m.nodes[fail].output >= 0 {
+				m.nodes[child].dict = fail
+			} else {
+				m.nodes[child].dict = m.nodes[fail].dict
+			}
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// find returns which literals are in text
+func (m *literalMatcher) find(text string) []bool {
+	found := make([]bool, m.literals)
+	if m.literals == 0 {
+		return found
+	}
+	remaining := m.literals
+	n := int32(0)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		for {
+			if next, exists := m.nodes[n].next[c]; exists {
+				n = next
+				break
+			}
+			if n == 0 {
+				break
+			}
+			n = m.nodes[n].fail
+		}
+
+		// Mark the literals ending here (the ones already marked have
+		// already marked their dictionary links too)
+		out := n
+		if m.nodes[out].output < 0 {
+			out = m.nodes[out].dict
+		}
+		for out >= 0 && !found[m.nodes[out].output] {
+			found[m.nodes[out].output] = true
+			remaining--
+			out = m.nodes[out].dict
+		}
+		if remaining == 0 {
+			break
+		}
+	}
+	return found
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ruleset implements the ruleset library for the Crowler and
+// the scrapper.
+package ruleset
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestPatternSetMatchesRegexp(t *testing.T) {
+	patterns := []string{
+		"",
+		"wordpress",
+		"wp-content",
+		"wp-(content|includes)",
+		"jquery[.-]([0-9.]+)",
+		"^nginx",
+		"nginx/1\\.2[0-9]",
+		"(?i)Drupal",
+		"x+y",
+		"ab{2,}c",
+		"a?bc",
+		"press",
+		"ordpr",
+		"[0-9]+",
+	}
+	texts := []string{
+		"",
+		"<link href=\"/wp-content/themes/x.css\">",
+		"powered by wordpress 6.1",
+		"nginx/1.24.0",
+		"server: nginx/1.18.0",
+		"drupal 10",
+		"jquery-3.6.0.min.js",
+		"xxy abbbc bc",
+	}
+
+	set := NewPatternSet()
+	for i, pattern := range patterns {
+		id, err := set.Add(pattern)
+		if err != nil {
+			t.Fatalf("Add(%q) returned an error: %v", pattern, err)
+		}
+		if id != i {
+			t.Errorf("Add(%q) = %d, expected %d", pattern, id, i)
+		}
+	}
+	if set.Len() != len(patterns) {
+		t.Errorf("Len() = %d, expected %d", set.Len(), len(patterns))
+	}
+
+	for _, text := range texts {
+		matches := set.Scan(text)
+		for i, pattern := range patterns {
+			expected := regexp.MustCompile(pattern).MatchString(text)
+			if got := matches.Match(i); got != expected {
+				t.Errorf("Match(%q) on %q = %v, expected %v", pattern, text, got, expected)
+			}
+		}
+	}
+}
+
+func TestPatternSetInvalidPattern(t *testing.T) {
+	set := NewPatternSet()
+	if _, err := set.Add("wp-(content"); err == nil {
+		t.Errorf("Add() expected an error for an invalid pattern")
+	}
+	if set.Scan("wp-content").Match(0) {
+		t.Errorf("Match() of a missing pattern returned true")
+	}
+}
+
+func TestRequiredLiteral(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"wordpress", "wordpress"},
+		{"jquery[.-]([0-9.]+)", "jquery"},
+		{"/wp-(content|includes)/", "/wp-"},
+		{"(?i)drupal", ""},
+		{"(abc)+def", "abc"},
+		{"(abcdef)?x", "x"},
+		{"a|b", ""},
+		{"[0-9]+", ""},
+	}
+	for _, tt := range tests {
+		if got := requiredLiteral(tt.pattern); got != tt.expected {
+			t.Errorf("requiredLiteral(%q) = %q, expected %q", tt.pattern, got, tt.expected)
+		}
+	}
+}
+
+func TestGetDetectionIndex(t *testing.T) {
+	rs := Ruleset{
+		Name: "example.com",
+		RuleGroups: []RuleGroup{
+			{
+				GroupName: "group1",
+				IsEnabled: true,
+				DetectionRules: []DetectionRule{
+					{
+						ObjectName:         "WordPress",
+						URLMicroSignatures: []URLMicroSignature{{Signature: "/wp-content/", Confidence: 10}},
+						HTTPHeaderFields: []HTTPHeaderField{
+							{Key: "X-Powered-By", Value: []string{"php"}, Confidence: 1},
+							{Key: "X-Powered-By", Value: []string{"wordpress", "(bad"}, Confidence: 5},
+						},
+						MetaTags:            []MetaTag{{Name: "Generator", Content: "wordpress", Confidence: 10}},
+						PageContentPatterns: []PageContentSignature{{Key: "script", Attribute: "src", Signature: []string{"wp-includes"}, Confidence: 3}},
+					},
+				},
+			},
+		},
+	}
+	re := NewRuleEngine("", []Ruleset{rs})
+
+	idx := re.GetDetectionIndex()
+	if idx.Rules != 1 || idx.IsEmpty() {
+		t.Fatalf("GetDetectionIndex() returned an index with %d rules", idx.Rules)
+	}
+	if re.GetDetectionIndex() != idx {
+		t.Errorf("GetDetectionIndex() didn't return the cached index")
+	}
+
+	// Only the last field of an object for a header is used, invalid patterns are skipped
+	headers := idx.HTTPHeaders["x-powered-by"]
+	if headers == nil || len(headers.Signatures) != 1 || headers.Signatures[0].Value != "wordpress" {
+		t.Errorf("unexpected x-powered-by signatures: %+v", headers)
+	}
+	if headers.Signatures[0].ObjectName != "wordpress" {
+		t.Errorf("ObjectName = %q, expected the lower-case object name", headers.Signatures[0].ObjectName)
+	}
+	if len(idx.MetaTags["generator"].Signatures) != 1 || len(idx.Selectors["script"].Signatures) != 1 {
+		t.Errorf("unexpected meta tags or selectors signatures")
+	}
+
+	// A ruleset update invalidates the index
+	rs.RuleGroups[0].IsEnabled = false
+	re.UpdateRuleset(rs)
+	if idx = re.GetDetectionIndex(); idx.Rules != 0 || !idx.IsEmpty() {
+		t.Errorf("GetDetectionIndex() returned %d rules after disabling the group", idx.Rules)
+	}
+}
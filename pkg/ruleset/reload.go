@@ -0,0 +1,126 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ruleset
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+
+	"github.com/qri-io/jsonschema"
+)
+
+// RulesetFile is the result of loading a ruleset file (or a remote ruleset)
+// of a rulesets location
+type RulesetFile struct {
+	Path    string  // Local path or remote URL of the file
+	Ruleset Ruleset // Ruleset loaded from the file
+	Err     error   // Error loading or validating the file
+}
+
+// LoadRulesetFiles loads, one by one, the ruleset files of a rulesets
+// location and validates them against schema (if any). Unlike
+// BulkLoadRules, the errors are returned per file, so a reload can keep the
+// previous version of a broken file.
+func LoadRulesetFiles(schema *jsonschema.Schema, config cfg.RulesetConfig) []RulesetFile {
+	var files []RulesetFile
+	for _, path := range config.Path {
+		if config.Host != "" {
+			fileType := cmn.GetFileExt(path)
+			if fileType != "yaml" && fileType != "yml" && fileType != "json" {
+				continue
+			}
+			files = append(files, loadRemoteRulesetFile(schema, config, path, fileType))
+			continue
+		}
+
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			files = append(files, RulesetFile{Path: path, Err: err})
+			continue
+		}
+		for _, file := range matches {
+			fileType := cmn.GetFileExt(file)
+			if (fileType != "yaml") && (fileType != "json") && (fileType != "") && (fileType != "yml") {
+				continue
+			}
+			files = append(files, loadLocalRulesetFile(schema, file, fileType))
+		}
+	}
+	return files
+}
+
+// loadLocalRulesetFile loads and validates a local ruleset file
+func loadLocalRulesetFile(schema *jsonschema.Schema, path, fileType string) RulesetFile {
+	data, err := os.ReadFile(path) //nolint:gosec // The path here is handled by the service not an end-user
+	if err != nil {
+		return RulesetFile{Path: path, Err: err}
+	}
+	ruleset, err := parseRuleset(schema, &data, fileType)
+	if err != nil {
+		return RulesetFile{Path: path, Err: err}
+	}
+	return RulesetFile{Path: path, Ruleset: ruleset}
+}
+
+// loadRemoteRulesetFile fetches and validates a ruleset from a distribution
+// server
+func loadRemoteRulesetFile(schema *jsonschema.Schema, config cfg.RulesetConfig, path, fileType string) RulesetFile {
+	url := fmt.Sprintf("http://%s/%s", config.Host, path)
+	body, err := cmn.FetchRemoteFile(url, config.Timeout, config.SSLMode)
+	if err != nil {
+		return RulesetFile{Path: url, Err: fmt.Errorf("failed to fetch rules from %s: %v", url, err)}
+	}
+	data := []byte(cmn.InterpolateEnvVars(body))
+	ruleset, err := parseRuleset(schema, &data, fileType)
+	if err != nil {
+		return RulesetFile{Path: url, Err: err}
+	}
+	return RulesetFile{Path: url, Ruleset: ruleset}
+}
+
+// ReplaceRulesets atomically replaces the rulesets of the RuleEngine and
+// returns what changed (rulesets are identified by name). When something
+// changed the cache is invalidated, while the rules already retrieved (for
+// example by a crawl in progress) are not affected.
+func (re *RuleEngine) ReplaceRulesets(rulesets []Ruleset) cmn.Changes {
+	re.Cache.Mu.Lock()
+	defer re.Cache.Mu.Unlock()
+
+	changes := cmn.DiffFingerprints(rulesetsFingerprints(re.Rulesets), rulesetsFingerprints(rulesets))
+	if changes.IsEmpty() {
+		return changes
+	}
+	re.Rulesets = append(make([]Ruleset, 0, len(rulesets)), rulesets...)
+	re.Cache.IsInvalid = true
+	re.cleanCache()
+	return changes
+}
+
+// rulesetsFingerprints returns the fingerprints of a list of rulesets
+func rulesetsFingerprints(rulesets []Ruleset) map[string]string {
+	fps := make(map[string]string, len(rulesets))
+	for _, rs := range rulesets {
+		if rs.Name == "" {
+			// Skip the placeholder of the empty engines
+			continue
+		}
+		fps[rs.Name] = cmn.Fingerprint(rs)
+	}
+	return fps
+}
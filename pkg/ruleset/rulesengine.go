@@ -220,7 +220,7 @@ func (re *RuleEngine) MarshalJSON() ([]byte, error) {
 	// transform the RuleEngine to JSON
 	jsonDocument := map[string]interface{}{
 		"schema":           re.Schema,
-		"rulesets":         re.Rulesets,
+		"rulesets":         re.GetAllRulesets(),
 		"detection_config": re.DetectionConfig,
 	}
 	jsonData, err := json.MarshalIndent(jsonDocument, "", "  ")
@@ -286,14 +286,19 @@ func (re *RuleEngine) cleanCache() {
 		re.Cache.Action = nil
 		re.Cache.Detection = nil
 		re.Cache.Crawling = nil
+		re.Cache.DetectionIndex = nil
 		re.Cache.IsInvalid = true
+		re.Cache.Version++
 	}
 }
 
 /// --- Retrieving --- ///
 
 // GetAllRulesets returns all rulesets in the RuleEngine.
+// The rulesets can be replaced by a reload, so the callers get a snapshot.
 func (re *RuleEngine) GetAllRulesets() []Ruleset {
+	re.Cache.Mu.RLock()
+	defer re.Cache.Mu.RUnlock()
 	return re.Rulesets
 }
 
@@ -302,12 +307,15 @@ func (re *RuleEngine) GetAllRuleGroups() []*RuleGroup {
 	if re == nil {
 		return nil
 	}
-	if len(re.Rulesets) == 0 {
-		return nil
-	}
 
 	// Check if the cache is valid
 	re.Cache.Mu.RLock()
+	rulesets := re.Rulesets
+	version := re.Cache.Version
+	if len(rulesets) == 0 {
+		re.Cache.Mu.RUnlock()
+		return nil
+	}
 	if !re.Cache.IsInvalid && len(re.Cache.RuleGroups) != 0 {
 		cachedGroups := re.Cache.RuleGroups
 		re.Cache.Mu.RUnlock()
@@ -318,18 +326,20 @@ func (re *RuleEngine) GetAllRuleGroups() []*RuleGroup {
 
 	// Get all the rule groups
 	var ruleGroups []*RuleGroup
-	for i := 0; i < len(re.Rulesets); i++ {
-		for i2 := 0; i2 < len(re.Rulesets[i].RuleGroups); i2++ {
-			ruleGroups = append(ruleGroups, &(re.Rulesets[i].RuleGroups)[i2])
+	for i := 0; i < len(rulesets); i++ {
+		for i2 := 0; i2 < len(rulesets[i].RuleGroups); i2++ {
+			ruleGroups = append(ruleGroups, &(rulesets[i].RuleGroups)[i2])
 		}
 	}
 
-	// Update the cache
+	// Update the cache (unless the rulesets changed in the meantime)
 	re.Cache.Mu.Lock()
-	re.Cache.RuleGroups = ruleGroups
-	re.Cache.IsInvalid = false
+	if re.Cache.Version == version {
+		re.Cache.RuleGroups = ruleGroups
+		re.Cache.IsInvalid = false
+	}
 	re.Cache.Mu.Unlock()
-	cmn.DebugMsg(cmn.DbgLvlDebug2, "Added %d Rulesgroup to the cache.", len(re.Cache.RuleGroups))
+	cmn.DebugMsg(cmn.DbgLvlDebug2, "Added %d Rulesgroup to the cache.", len(ruleGroups))
 
 	return ruleGroups
 }
@@ -342,6 +352,7 @@ func (re *RuleEngine) GetAllEnabledRuleGroups() []*RuleGroup {
 
 	// Check if the cache is valid for enabled rule groups
 	re.Cache.Mu.RLock()
+	version := re.Cache.Version
 	if !re.Cache.IsInvalid && re.Cache.ActiveRuleGroups != nil {
 		cachedEnabledGroups := re.Cache.ActiveRuleGroups
 		re.Cache.Mu.RUnlock()
@@ -357,10 +368,12 @@ func (re *RuleEngine) GetAllEnabledRuleGroups() []*RuleGroup {
 		}
 	}
 
-	// Update the cache
+	// Update the cache (unless the rulesets changed in the meantime)
 	re.Cache.Mu.Lock()
-	re.Cache.ActiveRuleGroups = ruleGroups
-	re.Cache.IsInvalid = false
+	if re.Cache.Version == version {
+		re.Cache.ActiveRuleGroups = ruleGroups
+		re.Cache.IsInvalid = false
+	}
 	re.Cache.Mu.Unlock()
 
 	return ruleGroups
@@ -492,13 +505,13 @@ func (re *RuleEngine) GetAllScrapingRulesByURL(url, CtxID string) []ScrapingRule
 
 // CountRulesets returns the number of rulesets in the RuleEngine.
 func (re *RuleEngine) CountRulesets() int {
-	return len(re.Rulesets)
+	return len(re.GetAllRulesets())
 }
 
 // CountRuleGroups returns the number of RuleGroups in the RuleEngine.
 func (re *RuleEngine) CountRuleGroups() int {
 	var count int
-	for _, rs := range re.Rulesets {
+	for _, rs := range re.GetAllRulesets() {
 		count += len(rs.RuleGroups)
 	}
 	return count
@@ -547,7 +560,7 @@ func (re *RuleEngine) CountRules() int {
 
 // CountPlugins returns the number of loaded Plugins
 func (re *RuleEngine) CountPlugins() int {
-	return len(re.JSPlugins.Registry)
+	return re.JSPlugins.Count()
 }
 
 /// --- Searching --- ///
@@ -558,7 +571,8 @@ func (re *RuleEngine) GetRulesetByURL(urlStr string) (*Ruleset, error) {
 		return nil, fmt.Errorf("%s", errRulesetNotFound)
 	}
 
-	if len((*re).Rulesets) == 0 {
+	rulesets := re.GetAllRulesets()
+	if len(rulesets) == 0 {
 		return nil, fmt.Errorf("%s", errRulesetNotFound)
 	}
 
@@ -568,14 +582,14 @@ func (re *RuleEngine) GetRulesetByURL(urlStr string) (*Ruleset, error) {
 		return nil, fmt.Errorf("%s", errInvalidURL)
 	}
 
-	for i := 0; i < len((*re).Rulesets); i++ {
-		rsName := strings.TrimSpace(re.Rulesets[i].Name)
+	for i := 0; i < len(rulesets); i++ {
+		rsName := strings.TrimSpace(rulesets[i].Name)
 		if rsName == "" || !IsURL(rsName) {
 			continue
 		}
 		cmn.DebugMsg(cmn.DbgLvlDebug2, "Checking ruleset: '%s' == '%s'", rsName, parsedURL)
 		if CheckURL(parsedURL, rsName) {
-			return &re.Rulesets[i], nil
+			return &rulesets[i], nil
 		}
 	}
 
@@ -589,7 +603,8 @@ func (re *RuleEngine) GetAllRulesetByURL(urlStr string) ([]*Ruleset, error) {
 		return nil, fmt.Errorf("%s", errRulesetNotFound)
 	}
 
-	if len((*re).Rulesets) == 0 {
+	rulesets := re.GetAllRulesets()
+	if len(rulesets) == 0 {
 		return nil, fmt.Errorf("%s", errRulesetNotFound)
 	}
 
@@ -600,14 +615,14 @@ func (re *RuleEngine) GetAllRulesetByURL(urlStr string) ([]*Ruleset, error) {
 	}
 
 	var ruleSets []*Ruleset
-	for i := 0; i < len((*re).Rulesets); i++ {
-		rsName := strings.TrimSpace(re.Rulesets[i].Name)
+	for i := 0; i < len(rulesets); i++ {
+		rsName := strings.TrimSpace(rulesets[i].Name)
 		if rsName == "" || !IsURL(rsName) {
 			continue
 		}
 		cmn.DebugMsg(cmn.DbgLvlDebug2, "Checking ruleset: '%s' == '%s'", rsName, parsedURL)
 		if CheckURL(parsedURL, rsName) {
-			ruleSets = append(ruleSets, &re.Rulesets[i])
+			ruleSets = append(ruleSets, &rulesets[i])
 		}
 	}
 
@@ -620,7 +635,8 @@ func (re *RuleEngine) GetRulesetByName(name string) (*Ruleset, error) {
 		return nil, fmt.Errorf("%s", errRulesetNotFound)
 	}
 
-	if len((*re).Rulesets) == 0 {
+	rulesets := re.GetAllRulesets()
+	if len(rulesets) == 0 {
 		return nil, fmt.Errorf("%s", errRulesetNotFound)
 	}
 
@@ -633,7 +649,7 @@ func (re *RuleEngine) GetRulesetByName(name string) (*Ruleset, error) {
 	if err != nil {
 		return nil, err
 	}
-	for _, rs := range re.Rulesets {
+	for _, rs := range rulesets {
 		if strings.ToLower(strings.TrimSpace(rs.Name)) == parsedName {
 			return &rs, nil
 		}
@@ -739,7 +755,11 @@ func (re *RuleEngine) GetActionRuleByURL(urlStr string) (*ActionRule, error) {
 	for _, rg := range re.GetAllRuleGroups() {
 		for _, r := range rg.ActionRules {
 			if IsURL(r.URL) {
-				reg := regexp.MustCompile(r.URL)
+				reg, err := regexp.Compile(r.URL)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "invalid URL pattern '%s' in action rule '%s': %v", r.URL, r.RuleName, err)
+					continue
+				}
 				if reg.MatchString(parsedURL) {
 					return &r, nil
 				}
@@ -886,7 +906,7 @@ func (re *RuleEngine) FindRulesForSite(inputURL string) (*Ruleset, error) {
 	inputDomain := strings.ToLower(strings.TrimSpace(parsedURL.Hostname()))
 
 	// Iterate over the SiteRules to find a matching domain
-	for _, siteRule := range re.Rulesets {
+	for _, siteRule := range re.GetAllRulesets() {
 		siteRuleset, err := url.Parse(siteRule.Name)
 		if err != nil {
 			continue
@@ -909,7 +929,7 @@ func (re *RuleEngine) FindRulesetByName(name string) (*Ruleset, error) {
 	}
 
 	// Iterate over the SiteRules to find a matching domain
-	for _, ruleset := range re.Rulesets {
+	for _, ruleset := range re.GetAllRulesets() {
 		rsName := strings.TrimSpace(strings.ToLower(ruleset.Name))
 		if rsName == inputName {
 			return &ruleset, nil
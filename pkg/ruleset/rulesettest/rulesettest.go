@@ -0,0 +1,261 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rulesettest runs the tests embedded in a ruleset (its tests
+// section) against saved HTML fixtures, without a browser and a database.
+package rulesettest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-auxiliaries/selenium"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	crowler "github.com/pzaino/thecrowler/pkg/crawler"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	detect "github.com/pzaino/thecrowler/pkg/detection"
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+	"github.com/pzaino/thecrowler/pkg/plugin/plugintest"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// Result is the outcome of a test of a ruleset
+type Result struct {
+	Name     string                           // Name of the test
+	Passed   bool                             // True if all the checks passed
+	Failures []string                         // Failed checks
+	Scraped  map[string]interface{}           // Data extracted by the scraping rules
+	Detected map[string]detect.DetectedEntity // Entities detected by the detection rules
+}
+
+// RunTests runs the tests of a ruleset, the fixtures are relative to
+// baseDir (usually the directory of the ruleset file). The plugins are
+// registered for the plugin_call selectors and the detection plugins.
+func RunTests(ruleset *rules.Ruleset, baseDir string, plugins []*plg.JSPlugin) []Result {
+	if cmn.KVStore == nil {
+		cmn.KVStore = cmn.NewKeyValueStore()
+	}
+	re := rules.NewRuleEngine("", []rules.Ruleset{offlineRuleset(ruleset)})
+	for _, plugin := range plugins {
+		re.JSPlugins.Register(plugin.Name, *plugin)
+	}
+
+	results := make([]Result, 0, len(ruleset.Tests))
+	for i := range ruleset.Tests {
+		results = append(results, RunTest(re, baseDir, &ruleset.Tests[i]))
+	}
+	return results
+}
+
+// RunTest runs a test against the rules of re
+func RunTest(re *rules.RuleEngine, baseDir string, tc *rules.TestCase) Result {
+	result := Result{Name: tc.Name}
+	fail := func(format string, args ...interface{}) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+
+	// Load the fixture in a fake WebDriver
+	fixture := tc.Fixture
+	if !filepath.IsAbs(fixture) {
+		fixture = filepath.Join(baseDir, fixture)
+	}
+	data, err := os.ReadFile(fixture) //nolint:gosec // The path is provided by the ruleset author
+	if err != nil {
+		fail("reading the fixture: %v", err)
+		return result
+	}
+	body := string(data)
+	pageURL := tc.URL
+	if pageURL == "" {
+		pageURL = plugintest.DefaultPageURL
+	}
+	fakeWD := plugintest.NewWebDriver()
+	if err := fakeWD.AddPage(pageURL, body); err != nil {
+		fail("loading the fixture: %v", err)
+		return result
+	}
+	for name, value := range tc.Globals {
+		fakeWD.SetGlobal(name, cmn.ConvertInterfaceMapToStringMap(value))
+	}
+	for name, value := range tc.Cookies {
+		_ = fakeWD.AddCookie(&selenium.Cookie{Name: name, Value: value})
+	}
+	var wd vdi.WebDriver = fakeWD
+
+	// Scraping
+	if tc.Expect.Scraped != nil || len(tc.ScrapingRules) > 0 {
+		scraped, errs := scrape(re, pageURL, tc.ScrapingRules, &wd)
+		for _, err := range errs {
+			fail("scraping: %v", err)
+		}
+		result.Scraped = scraped
+		for key, want := range tc.Expect.Scraped {
+			got, exists := scraped[key]
+			if !exists {
+				fail("scraped[%q] not found, want %s", key, toJSON(want))
+				continue
+			}
+			if gotJSON, wantJSON := toJSON(got), toJSON(want); gotJSON != wantJSON {
+				fail("scraped[%q] = %s, want %s", key, gotJSON, wantJSON)
+			}
+		}
+	}
+
+	// Detection
+	header := make(http.Header)
+	for name, value := range tc.Headers {
+		header.Set(name, value)
+	}
+	detected := detect.DetectTechnologies(&detect.DContext{
+		CtxID:        "rulesettest",
+		TargetURL:    pageURL,
+		Header:       &header,
+		ResponseBody: &body,
+		WD:           &wd,
+		RE:           re,
+	})
+	result.Detected = make(map[string]detect.DetectedEntity)
+	if detected != nil {
+		result.Detected = *detected
+	}
+	for _, name := range tc.Expect.Detected {
+		if _, exists := result.Detected[strings.ToLower(strings.TrimSpace(name))]; !exists {
+			fail("%s not detected (detected: %s)", name, detectedNames(result.Detected))
+		}
+	}
+	for _, name := range tc.Expect.NotDetected {
+		if _, exists := result.Detected[strings.ToLower(strings.TrimSpace(name))]; exists {
+			fail("%s detected, but it's expected not to be", name)
+		}
+	}
+	for name, want := range tc.Expect.Versions {
+		entity, exists := result.Detected[strings.ToLower(strings.TrimSpace(name))]
+		if !exists {
+			fail("%s not detected, expected version %s", name, want)
+		} else if entity.Version != want {
+			fail("%s version = %q, want %q", name, entity.Version, want)
+		}
+	}
+
+	result.Passed = len(result.Failures) == 0
+	return result
+}
+
+// scrape applies the named scraping rules (all the ones of the valid
+// groups if names is empty) to the page, the data of the later rules
+// replaces the one with the same key of the previous rules.
+func scrape(re *rules.RuleEngine, pageURL string, names []string, wd *vdi.WebDriver) (map[string]interface{}, []error) {
+	var scrapingRules []rules.ScrapingRule
+	var errs []error
+	if len(names) > 0 {
+		for _, name := range names {
+			rule, err := re.GetScrapingRuleByName(name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			scrapingRules = append(scrapingRules, *rule)
+		}
+	} else {
+		for _, rg := range re.GetAllEnabledRuleGroups() {
+			scrapingRules = append(scrapingRules, rg.GetScrapingRules()...)
+		}
+	}
+
+	config := json.RawMessage("{}")
+	ctx := crowler.NewProcessContext(&crowler.Pars{
+		RE:  re,
+		Src: cdb.Source{URL: pageURL, Config: &config},
+	})
+	scraped := make(map[string]interface{})
+	for i := range scrapingRules {
+		data, err := crowler.ApplyRule(ctx, &scrapingRules[i], wd)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %v", scrapingRules[i].RuleName, err))
+		}
+		for key, value := range data {
+			scraped[key] = value
+		}
+	}
+	return scraped, errs
+}
+
+// offlineRuleset returns a copy of the ruleset without the external
+// detections (they call online services)
+func offlineRuleset(ruleset *rules.Ruleset) rules.Ruleset {
+	offline := *ruleset
+	offline.RuleGroups = make([]rules.RuleGroup, len(ruleset.RuleGroups))
+	for i, rg := range ruleset.RuleGroups {
+		rg.DetectionRules = append([]rules.DetectionRule(nil), rg.DetectionRules...)
+		for j := range rg.DetectionRules {
+			rg.DetectionRules[j].ExternalDetections = nil
+		}
+		offline.RuleGroups[i] = rg
+	}
+	return offline
+}
+
+// toJSON returns value as JSON (so numbers of different types and YAML
+// maps compare equal)
+func toJSON(value interface{}) string {
+	data, err := json.Marshal(cmn.ConvertInterfaceMapToStringMap(value))
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return string(data)
+	}
+	data, _ = json.Marshal(decoded)
+	return string(data)
+}
+
+// detectedNames returns the sorted names of the detected entities
+func detectedNames(detected map[string]detect.DetectedEntity) string {
+	names := make([]string, 0, len(detected))
+	for name := range detected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// RunFile runs the tests of a ruleset file as subtests of t (one per test),
+// so the rulesets tests can be part of go test
+func RunFile(t *testing.T, path string, plugins ...*plg.JSPlugin) {
+	t.Helper()
+	ruleset, err := rules.BulkLoadRules(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ruleset) == 0 {
+		t.Fatalf("no ruleset loaded from %s", path)
+	}
+	for i := range ruleset {
+		for _, result := range RunTests(&ruleset[i], filepath.Dir(path), plugins) {
+			t.Run(result.Name, func(t *testing.T) {
+				for _, failure := range result.Failures {
+					t.Error(failure)
+				}
+			})
+		}
+	}
+}
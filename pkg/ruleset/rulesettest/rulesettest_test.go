@@ -0,0 +1,94 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rulesettest runs the tests embedded in a ruleset (its tests
+// section) against saved HTML fixtures, without a browser and a database.
+package rulesettest
+
+import (
+	"strings"
+	"testing"
+
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+)
+
+func TestRunFile(t *testing.T) {
+	RunFile(t, "testdata/shop-ruleset.yaml")
+}
+
+func TestRunTestsFailures(t *testing.T) {
+	rulesets, err := rules.BulkLoadRules(nil, "testdata/shop-ruleset.yaml")
+	if err != nil || len(rulesets) != 1 {
+		t.Fatalf("loading the ruleset: %v", err)
+	}
+	ruleset := rulesets[0]
+	ruleset.Tests = []rules.TestCase{
+		{
+			Name:    "wrong expectations",
+			Fixture: "shop.html",
+			Headers: map[string]string{"Server": "nginx"},
+			Expect: rules.TestExpectation{
+				Scraped:     map[string]interface{}{"title": "Red Widget", "missing": "value"},
+				Detected:    []string{"jQuery"},
+				NotDetected: []string{"nginx"},
+				Versions:    map[string]string{"WordPress": "5.0"},
+			},
+		},
+		{Name: "missing fixture", Fixture: "missing.html"},
+	}
+
+	results := RunTests(&ruleset, "testdata", nil)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, expected 2", len(results))
+	}
+	for _, result := range results {
+		if result.Passed {
+			t.Errorf("%s passed, expected to fail", result.Name)
+		}
+	}
+
+	failures := strings.Join(results[0].Failures, "\n")
+	for _, want := range []string{
+		`scraped["title"] = "Blue Widget", want "Red Widget"`,
+		`scraped["missing"] not found`,
+		"jQuery not detected",
+		"nginx detected",
+		`WordPress version = "6.4.2", want "5.0"`,
+	} {
+		if !strings.Contains(failures, want) {
+			t.Errorf("missing failure %q in:\n%s", want, failures)
+		}
+	}
+	if len(results[0].Failures) != 5 {
+		t.Errorf("got %d failures, expected 5:\n%s", len(results[0].Failures), failures)
+	}
+	if !strings.Contains(strings.Join(results[1].Failures, "\n"), "reading the fixture") {
+		t.Errorf("unexpected failures: %v", results[1].Failures)
+	}
+}
+
+func TestOfflineRuleset(t *testing.T) {
+	ruleset := rules.Ruleset{
+		RuleGroups: []rules.RuleGroup{
+			{DetectionRules: []rules.DetectionRule{{ObjectName: "test", ExternalDetections: []rules.ExternalDetection{{Provider: "virustotal"}}}}},
+		},
+	}
+	offline := offlineRuleset(&ruleset)
+	if len(offline.RuleGroups[0].DetectionRules[0].ExternalDetections) != 0 {
+		t.Errorf("the external detections weren't removed")
+	}
+	if len(ruleset.RuleGroups[0].DetectionRules[0].ExternalDetections) != 1 {
+		t.Errorf("the original ruleset was modified")
+	}
+}
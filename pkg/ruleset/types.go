@@ -61,6 +61,8 @@ type Cache struct {
 	Action           []*ActionRule
 	Detection        []*DetectionRule
 	Crawling         []*CrawlingRule
+	DetectionIndex   *DetectionIndex // Precompiled signatures of the enabled detection rules
+	Version          uint64          // Incremented every time the cache is invalidated
 }
 
 // DetectionConfig represents the configuration for the detection engine
@@ -83,6 +85,28 @@ type Ruleset struct {
 	Description   string      `json:"description" yaml:"description"`
 	Name          string      `json:"ruleset_name" yaml:"ruleset_name"`
 	RuleGroups    []RuleGroup `json:"rule_groups" yaml:"rule_groups"`
+	Tests         []TestCase  `json:"tests,omitempty" yaml:"tests,omitempty"`
+}
+
+// TestCase represents a test of a ruleset, which applies the ruleset to a
+// saved HTML page (the fixture) and checks the results (see rulesettest)
+type TestCase struct {
+	Name          string                 `json:"name" yaml:"name"`
+	Fixture       string                 `json:"fixture" yaml:"fixture"`                                   // Path of the HTML page, relative to the ruleset file
+	URL           string                 `json:"url,omitempty" yaml:"url,omitempty"`                       // URL of the page (default "https://example.com/")
+	Headers       map[string]string      `json:"headers,omitempty" yaml:"headers,omitempty"`               // HTTP response headers of the page
+	Cookies       map[string]string      `json:"cookies,omitempty" yaml:"cookies,omitempty"`               // Cookies of the page
+	Globals       map[string]interface{} `json:"globals,omitempty" yaml:"globals,omitempty"`               // JavaScript globals of the page (window.name)
+	ScrapingRules []string               `json:"scraping_rules,omitempty" yaml:"scraping_rules,omitempty"` // Scraping rules to apply (default all the enabled ones)
+	Expect        TestExpectation        `json:"expect" yaml:"expect"`
+}
+
+// TestExpectation represents the expected results of a ruleset TestCase
+type TestExpectation struct {
+	Scraped     map[string]interface{} `json:"scraped,omitempty" yaml:"scraped,omitempty"`           // Expected scraped data (only the listed keys are checked)
+	Detected    []string               `json:"detected,omitempty" yaml:"detected,omitempty"`         // Entities that must be detected
+	NotDetected []string               `json:"not_detected,omitempty" yaml:"not_detected,omitempty"` // Entities that must not be detected
+	Versions    map[string]string      `json:"versions,omitempty" yaml:"versions,omitempty"`         // Expected versions of the detected entities
 }
 
 // RuleGroup represents a group of rules
@@ -300,6 +324,8 @@ type DetectionRule struct {
 	SSLSignatures       []SSLSignature         `yaml:"ssl_patterns,omitempty"`
 	URLMicroSignatures  []URLMicroSignature    `yaml:"url_micro_signatures,omitempty"`
 	MetaTags            []MetaTag              `yaml:"meta_tags,omitempty"`
+	Cookies             []CookieSignature      `yaml:"cookies,omitempty"`
+	JSGlobals           []JSGlobalSignature    `yaml:"js_globals,omitempty"`
 	Implies             []string               `yaml:"implies,omitempty"`
 	PluginCalls         []PluginCall           `yaml:"plugin_calls,omitempty"`
 	ExternalDetections  []ExternalDetection    `yaml:"external_detection,omitempty"`
@@ -315,7 +341,7 @@ type PluginCall struct {
 type PluginParams struct {
 	ArgName    string                 `yaml:"parameter_name"`
 	ArgValue   interface{}            `yaml:"parameter_value"`
-	Properties PluginParamsProperties `yaml:"properties"`
+	Properties PluginParamsProperties `yaml:"properties,omitempty"`
 }
 
 // PluginParamsProperties represents the properties for the plugin parameters
@@ -436,6 +462,7 @@ type HTTPHeaderField struct {
 	Key        string   `yaml:"key"`
 	Value      []string `yaml:"value,omitempty"`
 	Confidence float32  `yaml:"confidence"`
+	Version    string   `yaml:"version,omitempty"` // Version template (e.g. "$1"), expanded with the capture groups of the matching value
 }
 
 // SSLSignature represents a pattern for matching SSL Certificate fields
@@ -443,12 +470,14 @@ type SSLSignature struct {
 	Key        string   `yaml:"key"`
 	Value      []string `yaml:"value,omitempty"`
 	Confidence float32  `yaml:"confidence"`
+	Version    string   `yaml:"version,omitempty"` // Version template (e.g. "$1"), expanded with the capture groups of the matching value
 }
 
 // URLMicroSignature represents a pattern for matching URL micro-signatures
 type URLMicroSignature struct {
 	Signature  string  `yaml:"value"`
 	Confidence float32 `yaml:"confidence"`
+	Version    string  `yaml:"version,omitempty"` // Version template (e.g. "$1"), expanded with the capture groups of the signature
 }
 
 // PageContentSignature micro-signatures are patterns that can be found in the page content
@@ -458,6 +487,7 @@ type PageContentSignature struct {
 	Signature  []string `yaml:"value,omitempty"`
 	Text       []string `yaml:"text,omitempty"`
 	Confidence float32  `yaml:"confidence"`
+	Version    string   `yaml:"version,omitempty"` // Version template (e.g. "$1"), expanded with the capture groups of the matching value or text
 }
 
 // MetaTag represents a pattern for matching HTML meta tags
@@ -465,6 +495,24 @@ type MetaTag struct {
 	Name       string  `yaml:"name"`
 	Content    string  `yaml:"content"`
 	Confidence float32 `yaml:"confidence"`
+	Version    string  `yaml:"version,omitempty"` // Version template (e.g. "$1"), expanded with the capture groups of the content
+}
+
+// CookieSignature represents a pattern for matching the cookies of the page
+type CookieSignature struct {
+	Name       string   `yaml:"name"`            // Name of the cookie
+	Value      []string `yaml:"value,omitempty"` // Patterns for the cookie value ("*" or none for any value, "!*" if the cookie must be missing)
+	Confidence float32  `yaml:"confidence"`
+	Version    string   `yaml:"version,omitempty"` // Version template (e.g. "$1"), expanded with the capture groups of the matching value
+}
+
+// JSGlobalSignature represents a pattern for matching the JavaScript global
+// variables (and their properties) of the page, like "jQuery.fn.jquery"
+type JSGlobalSignature struct {
+	Property   string   `yaml:"property"`        // Property path, starting from window (e.g. "jQuery.fn.jquery")
+	Value      []string `yaml:"value,omitempty"` // Patterns for the property value ("*" or none for any value, "!*" if the property must be missing)
+	Confidence float32  `yaml:"confidence"`
+	Version    string   `yaml:"version,omitempty"` // Version template (e.g. "$1"), expanded with the capture groups of the matching value
 }
 
 // CrawlingRule represents a crawling rule for URL fuzzing and form handling
@@ -0,0 +1,581 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ruleset
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+
+	"github.com/qri-io/jsonschema"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// WappalyzerPluginPrefix is the prefix of the names of the detection
+	// plugins generated for the Wappalyzer "js" fingerprints
+	WappalyzerPluginPrefix = "wappalyzer_js_"
+
+	wappalyzerFormatVersion = "1.0.4"
+	wappalyzerGroupName     = "wappalyzer"
+	wappalyzerConfidence    = 100 // Default confidence of a Wappalyzer pattern (percentage)
+)
+
+// WappalyzerTechnology is a technology fingerprint in the Wappalyzer format
+type WappalyzerTechnology struct {
+	Cats      []int                         `json:"cats"`
+	Website   string                        `json:"website"`
+	Headers   map[string]string             `json:"headers"`
+	Cookies   map[string]string             `json:"cookies"`
+	Meta      map[string]WappalyzerPatterns `json:"meta"`
+	ScriptSrc WappalyzerPatterns            `json:"scriptSrc"`
+	Scripts   WappalyzerPatterns            `json:"scripts"`
+	JS        map[string]string             `json:"js"`
+	HTML      WappalyzerPatterns            `json:"html"`
+	URL       WappalyzerPatterns            `json:"url"`
+	Implies   WappalyzerPatterns            `json:"implies"`
+	Excludes  WappalyzerPatterns            `json:"excludes"`
+
+	unsupported []string // Fingerprint fields with no detection rule equivalent
+}
+
+// WappalyzerPatterns is a list of Wappalyzer patterns, which in the
+// Wappalyzer format can also be a single string
+type WappalyzerPatterns []string
+
+// UnmarshalJSON accepts both a string and a list of strings
+func (p *WappalyzerPatterns) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*p = WappalyzerPatterns{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// WappalyzerImport is the result of the import of a set of Wappalyzer
+// fingerprints
+type WappalyzerImport struct {
+	Ruleset  Ruleset         // Ruleset with a detection rule per technology
+	Plugins  []*plg.JSPlugin // Detection plugins generated for the "js" fingerprints
+	Warnings []string        // Fingerprints (or parts of them) that couldn't be imported
+	options  WappalyzerOptions
+}
+
+// WappalyzerOptions are the options of the import of Wappalyzer fingerprints
+type WappalyzerOptions struct {
+	// JSGlobals converts the "js" fingerprints into js_globals signatures
+	// (all read with a single script execution per page) instead of
+	// generated detection plugins
+	JSGlobals bool
+}
+
+// wappalyzerSupported are the fingerprint fields converted to detection
+// rules, wappalyzerMetadata the ones that don't describe a detection (or are
+// reported on their own)
+var (
+	wappalyzerSupported = map[string]bool{
+		"headers": true, "cookies": true, "meta": true, "scriptSrc": true, "scripts": true,
+		"js": true, "html": true, "url": true, "implies": true,
+	}
+	wappalyzerMetadata = map[string]bool{
+		"cats": true, "description": true, "icon": true, "website": true, "saas": true,
+		"oss": true, "pricing": true, "cpe": true, "excludes": true,
+	}
+)
+
+// ParseWappalyzer parses a Wappalyzer fingerprints file. It accepts both the
+// technologies object ({"WordPress": {...}}) and a document with it in the
+// "technologies" (or "apps") field.
+func ParseWappalyzer(data []byte) (map[string]WappalyzerTechnology, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing the Wappalyzer fingerprints: %v", err)
+	}
+	for _, field := range []string{"technologies", "apps"} {
+		if raw, exists := doc[field]; exists {
+			doc = nil
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				return nil, fmt.Errorf("parsing the Wappalyzer %s: %v", field, err)
+			}
+			break
+		}
+	}
+
+	technologies := make(map[string]WappalyzerTechnology, len(doc))
+	for name, raw := range doc {
+		var tech WappalyzerTechnology
+		if err := json.Unmarshal(raw, &tech); err != nil {
+			return nil, fmt.Errorf("parsing the Wappalyzer technology '%s': %v", name, err)
+		}
+		var fields map[string]json.RawMessage
+		_ = json.Unmarshal(raw, &fields)
+		for field := range fields {
+			if !wappalyzerSupported[field] && !wappalyzerMetadata[field] {
+				tech.unsupported = append(tech.unsupported, field)
+			}
+		}
+		sort.Strings(tech.unsupported)
+		technologies[name] = tech
+	}
+	return technologies, nil
+}
+
+// ImportWappalyzer converts one or more Wappalyzer fingerprints files into a
+// Ruleset named name, with a detection rule per technology. The "js"
+// fingerprints are converted into generated detection plugins (which must be
+// installed with the ruleset), or into js_globals signatures if
+// opts.JSGlobals is set. Patterns that can't be converted (e.g. the ones
+// using lookarounds) are skipped and reported in the Warnings.
+func ImportWappalyzer(name string, opts WappalyzerOptions, files ...[]byte) (*WappalyzerImport, error) {
+	technologies := make(map[string]WappalyzerTechnology)
+	for _, data := range files {
+		techs, err := ParseWappalyzer(data)
+		if err != nil {
+			return nil, err
+		}
+		for techName, tech := range techs {
+			technologies[techName] = tech
+		}
+	}
+	return ConvertWappalyzer(name, technologies, opts), nil
+}
+
+// ConvertWappalyzer converts a set of Wappalyzer technologies into a Ruleset
+// named name (see ImportWappalyzer)
+func ConvertWappalyzer(name string, technologies map[string]WappalyzerTechnology, opts WappalyzerOptions) *WappalyzerImport {
+	imp := &WappalyzerImport{
+		Ruleset: Ruleset{
+			FormatVersion: wappalyzerFormatVersion,
+			Author:        "Wappalyzer importer",
+			CreatedAt:     CustomTime{time.Now().UTC().Truncate(time.Second)},
+			Description:   "Technology fingerprints imported from the Wappalyzer format",
+			Name:          name,
+		},
+		options: opts,
+	}
+	group := RuleGroup{
+		GroupName:      wappalyzerGroupName,
+		IsEnabled:      true,
+		PostProcessing: []PostProcessingStep{},
+	}
+
+	names := make([]string, 0, len(technologies))
+	for techName := range technologies {
+		names = append(names, techName)
+	}
+	sort.Strings(names)
+	for _, techName := range names {
+		tech := technologies[techName]
+		rule, plugin := imp.convertTechnology(techName, &tech)
+		if plugin != nil {
+			imp.Plugins = append(imp.Plugins, plugin)
+		}
+		if isEmptyDetectionRule(&rule) {
+			imp.warn(techName, "no detection patterns could be imported, technology skipped")
+			continue
+		}
+		group.DetectionRules = append(group.DetectionRules, rule)
+	}
+	imp.Ruleset.RuleGroups = []RuleGroup{group}
+	return imp
+}
+
+// warn adds a warning about a technology
+func (imp *WappalyzerImport) warn(techName, format string, args ...interface{}) {
+	imp.Warnings = append(imp.Warnings, techName+": "+fmt.Sprintf(format, args...))
+}
+
+// convertTechnology returns the detection rule of a technology and, if it
+// has "js" fingerprints, its detection plugin
+func (imp *WappalyzerImport) convertTechnology(techName string, tech *WappalyzerTechnology) (DetectionRule, *plg.JSPlugin) {
+	rule := DetectionRule{RuleName: techName, ObjectName: techName}
+	for _, field := range tech.unsupported {
+		imp.warn(techName, "'%s' fingerprints are not supported", field)
+	}
+	if len(tech.Excludes) > 0 {
+		imp.warn(techName, "'excludes' has no detection rule equivalent")
+	}
+
+	for _, header := range sortedKeys(tech.Headers) {
+		p, ok := imp.pattern(techName, "headers", tech.Headers[header], false)
+		if !ok {
+			continue
+		}
+		value := p.regexp
+		if value == "" {
+			// Any value
+			value = "*"
+		}
+		rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, HTTPHeaderField{
+			Key:        header,
+			Value:      []string{value},
+			Confidence: p.confidence,
+			Version:    p.version,
+		})
+	}
+
+	for _, cookie := range sortedKeys(tech.Cookies) {
+		p, ok := imp.pattern(techName, "cookies", tech.Cookies[cookie], false)
+		if !ok {
+			continue
+		}
+		signature := CookieSignature{Name: cookie, Confidence: p.confidence, Version: p.version}
+		if p.regexp != "" {
+			signature.Value = []string{p.regexp}
+		}
+		rule.Cookies = append(rule.Cookies, signature)
+	}
+
+	for _, meta := range sortedKeys(tech.Meta) {
+		for _, value := range tech.Meta[meta] {
+			p, ok := imp.pattern(techName, "meta", value, false)
+			if !ok {
+				continue
+			}
+			rule.MetaTags = append(rule.MetaTags, MetaTag{
+				Name:       meta,
+				Content:    anyValue(p.regexp),
+				Confidence: p.confidence,
+				Version:    p.version,
+			})
+		}
+	}
+
+	for _, value := range tech.ScriptSrc {
+		if p, ok := imp.pattern(techName, "scriptSrc", value, false); ok {
+			rule.PageContentPatterns = append(rule.PageContentPatterns, PageContentSignature{
+				Key:        "script",
+				Attribute:  "src",
+				Signature:  []string{anyValue(p.regexp)},
+				Confidence: p.confidence,
+				Version:    p.version,
+			})
+		}
+	}
+	for _, value := range tech.Scripts {
+		if p, ok := imp.pattern(techName, "scripts", value, false); ok {
+			rule.PageContentPatterns = append(rule.PageContentPatterns, PageContentSignature{
+				Key:        "script",
+				Text:       []string{anyValue(p.regexp)},
+				Confidence: p.confidence,
+				Version:    p.version,
+			})
+		}
+	}
+	for _, value := range tech.HTML {
+		if p, ok := imp.pattern(techName, "html", value, false); ok && p.regexp != "" {
+			rule.PageContentPatterns = append(rule.PageContentPatterns, PageContentSignature{
+				Key:        "*",
+				Signature:  []string{p.regexp},
+				Confidence: p.confidence,
+				Version:    p.version,
+			})
+		}
+	}
+	for _, value := range tech.URL {
+		// The URLs are not lower-cased by the detection
+		if p, ok := imp.pattern(techName, "url", value, true); ok && p.regexp != "" {
+			rule.URLMicroSignatures = append(rule.URLMicroSignatures, URLMicroSignature{
+				Signature:  p.regexp,
+				Confidence: p.confidence,
+				Version:    p.version,
+			})
+		}
+	}
+
+	for _, implied := range tech.Implies {
+		implied = strings.TrimSpace(strings.Split(implied, `\;`)[0])
+		if implied != "" {
+			rule.Implies = append(rule.Implies, implied)
+		}
+	}
+
+	if imp.options.JSGlobals {
+		imp.convertJSGlobals(techName, tech.JS, &rule)
+		return rule, nil
+	}
+	plugin := imp.jsPlugin(techName, tech.JS)
+	if plugin != nil {
+		confidence := float32(0)
+		for _, value := range tech.JS {
+			confidence = max(confidence, parseWappalyzerPattern(value).confidence)
+		}
+		rule.PluginCalls = append(rule.PluginCalls, PluginCall{
+			PluginName: plugin.Name,
+			PluginArgs: []PluginParams{{ArgName: "confidence", ArgValue: confidence}},
+		})
+	}
+	return rule, plugin
+}
+
+// isEmptyDetectionRule returns true if a detection rule has nothing to detect
+func isEmptyDetectionRule(rule *DetectionRule) bool {
+	return len(rule.HTTPHeaderFields) == 0 && len(rule.PageContentPatterns) == 0 &&
+		len(rule.URLMicroSignatures) == 0 && len(rule.MetaTags) == 0 &&
+		len(rule.Cookies) == 0 && len(rule.JSGlobals) == 0 && len(rule.PluginCalls) == 0
+}
+
+// convertJSGlobals adds the "js" fingerprints of a technology to its
+// detection rule as js_globals signatures
+func (imp *WappalyzerImport) convertJSGlobals(techName string, js map[string]string, rule *DetectionRule) {
+	for _, property := range sortedKeys(js) {
+		p, ok := imp.pattern(techName, "js", js[property], false)
+		if !ok {
+			continue
+		}
+		signature := JSGlobalSignature{Property: property, Confidence: p.confidence, Version: p.version}
+		if p.regexp != "" {
+			signature.Value = []string{p.regexp}
+		}
+		rule.JSGlobals = append(rule.JSGlobals, signature)
+	}
+}
+
+// wappalyzerPattern is a Wappalyzer pattern, e.g. "PHP/([\d.]+)\;version:\1"
+type wappalyzerPattern struct {
+	regexp     string
+	version    string
+	confidence float32 // In the detection rules scale (0-10)
+}
+
+// parseWappalyzerPattern splits a Wappalyzer pattern in its regexp and tags.
+// The version references (\1) are converted to the version templates of the
+// detection rules (${1}).
+func parseWappalyzerPattern(value string) wappalyzerPattern {
+	parts := strings.Split(value, `\;`)
+	p := wappalyzerPattern{regexp: parts[0], confidence: wappalyzerConfidence / 10}
+	for _, tag := range parts[1:] {
+		name, tagValue, _ := strings.Cut(tag, ":")
+		switch strings.TrimSpace(name) {
+		case "version":
+			p.version = wappalyzerVersionRef.ReplaceAllString(tagValue, "$${$1}")
+		case "confidence":
+			if c, err := strconv.ParseFloat(strings.TrimSpace(tagValue), 32); err == nil {
+				p.confidence = float32(c) / 10
+			}
+		}
+	}
+	return p
+}
+
+var wappalyzerVersionRef = regexp.MustCompile(`\\(\d)`)
+
+// pattern converts a Wappalyzer pattern of a technology field. The
+// detection lower-cases the texts before matching them, so the regexp is
+// lower-cased too (or made case-insensitive when foldCase is set).
+func (imp *WappalyzerImport) pattern(techName, field, value string, foldCase bool) (wappalyzerPattern, bool) {
+	p := parseWappalyzerPattern(value)
+	if strings.Contains(p.version, "?") {
+		// Ternary versions (\1?a:b) have no template equivalent
+		imp.warn(techName, "unsupported version '%s' in '%s'", p.version, field)
+		p.version = ""
+	}
+	if p.regexp == "" {
+		return p, true
+	}
+
+	var err error
+	if foldCase {
+		p.regexp = "(?i)" + p.regexp
+		_, err = regexp.Compile(p.regexp)
+	} else {
+		p.regexp, err = lowerPattern(p.regexp)
+	}
+	if err != nil {
+		imp.warn(techName, "unsupported pattern '%s' in '%s': %v", value, field, err)
+		return p, false
+	}
+	return p, true
+}
+
+// lowerPattern returns a regexp matching the lower-case version of the texts
+// matched by pattern. The letters are lower-cased, except the ones of the
+// escape sequences (\S, \p{Lu}, ...) and the names of the capture groups.
+func lowerPattern(pattern string) (string, error) {
+	var lower strings.Builder
+	runes := []rune(pattern)
+	// copyUntil copies the runes up to the end marker (included)
+	copyUntil := func(i int, end string) int {
+		for ; i < len(runes); i++ {
+			lower.WriteRune(runes[i])
+			if strings.HasSuffix(string(runes[max(0, i-len(end)+1):i+1]), end) {
+				break
+			}
+		}
+		return i
+	}
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes):
+			lower.WriteRune(runes[i])
+			i++
+			switch {
+			case runes[i] == 'Q':
+				i = copyUntil(i, `\E`)
+			case strings.ContainsRune("pPx", runes[i]) && i+1 < len(runes) && runes[i+1] == '{':
+				i = copyUntil(i, "}")
+			default:
+				lower.WriteRune(runes[i])
+			}
+		case strings.HasPrefix(string(runes[i:]), "(?P<") || strings.HasPrefix(string(runes[i:]), "(?<"):
+			i = copyUntil(i, ">")
+		default:
+			lower.WriteRune(unicode.ToLower(runes[i]))
+		}
+	}
+	if _, err := regexp.Compile(lower.String()); err != nil {
+		return "", err
+	}
+	return lower.String(), nil
+}
+
+// anyValue returns the pattern of a value, or a pattern matching any value
+func anyValue(pattern string) string {
+	if pattern == "" {
+		return "^"
+	}
+	return pattern
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// wappalyzerGlobal is a JavaScript global checked by a generated plugin
+type wappalyzerGlobal struct {
+	Property string `json:"property"`
+	Pattern  string `json:"pattern"`
+	Version  string `json:"version"`
+}
+
+// wappalyzerPluginScript is the body of the generated detection plugins. It
+// returns the first global found (with its version) or null.
+const wappalyzerPluginScript = `
+for (const g of globals) {
+  let value = window;
+  for (const key of g.property.split(".")) {
+    try {
+      value = value[key];
+    } catch (e) {
+      value = undefined;
+    }
+    if (value === undefined || value === null) {
+      break;
+    }
+  }
+  if (value === undefined || value === null) {
+    continue;
+  }
+  let match = [];
+  if (g.pattern !== "") {
+    try {
+      match = String(value).match(new RegExp(g.pattern, "i"));
+    } catch (e) {
+      match = null;
+    }
+    if (!match) {
+      continue;
+    }
+  }
+  const version = g.version.replace(/\\(\d)/g, (_, i) => match[i] || "");
+  return { property: g.property, value: String(value), version: version };
+}
+return null;
+`
+
+// jsPlugin generates the detection plugin of the "js" fingerprints of a
+// technology (nil if it has none)
+func (imp *WappalyzerImport) jsPlugin(techName string, js map[string]string) *plg.JSPlugin {
+	if len(js) == 0 {
+		return nil
+	}
+	globals := make([]wappalyzerGlobal, 0, len(js))
+	for _, property := range sortedKeys(js) {
+		parts := strings.Split(js[property], `\;`)
+		global := wappalyzerGlobal{Property: property, Pattern: parts[0]}
+		for _, tag := range parts[1:] {
+			if name, value, _ := strings.Cut(tag, ":"); strings.TrimSpace(name) == "version" && !strings.Contains(value, "?") {
+				global.Version = value
+			}
+		}
+		globals = append(globals, global)
+	}
+	globalsJSON, err := json.MarshalIndent(globals, "", "  ")
+	if err != nil {
+		imp.warn(techName, "generating the 'js' plugin: %v", err)
+		return nil
+	}
+
+	name := WappalyzerPluginPrefix + pluginSlug(techName)
+	script := "// @name: " + name + "\n" +
+		"// @description: Detects " + techName + " from its JavaScript globals (generated from a Wappalyzer fingerprint)\n" +
+		"// @type: vdi_plugin\n\n" +
+		"const globals = " + string(globalsJSON) + ";\n" +
+		wappalyzerPluginScript
+	return plg.NewJSPlugin(script)
+}
+
+// pluginSlug returns a plugin name friendly version of a technology name
+func pluginSlug(name string) string {
+	var slug strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			slug.WriteRune(r)
+		} else {
+			slug.WriteRune('_')
+		}
+	}
+	return slug.String()
+}
+
+// Marshal returns the YAML document of the imported ruleset. If schema is
+// not nil the document is validated against it.
+func (imp *WappalyzerImport) Marshal(schema *jsonschema.Schema) ([]byte, error) {
+	doc, err := yaml.Marshal(imp.Ruleset)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return doc, nil
+	}
+
+	keyErrors, err := schemaErrors(schema, doc, "yaml")
+	if err != nil {
+		return nil, err
+	}
+	if len(keyErrors) > 0 {
+		return nil, fmt.Errorf("the imported ruleset doesn't validate against the schema: %v", keyErrors)
+	}
+	return doc, nil
+}
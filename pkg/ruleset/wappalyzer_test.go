@@ -0,0 +1,208 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ruleset implements the ruleset library for the Crowler and
+// the scrapper.
+package ruleset
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pzaino/thecrowler/pkg/plugin/plugintest"
+)
+
+func importTestWappalyzer(t *testing.T, opts WappalyzerOptions) *WappalyzerImport {
+	t.Helper()
+	data, err := os.ReadFile("testdata/wappalyzer.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp, err := ImportWappalyzer("Wappalyzer", opts, data)
+	if err != nil {
+		t.Fatalf("ImportWappalyzer() returned an error: %v", err)
+	}
+	return imp
+}
+
+func TestImportWappalyzer(t *testing.T) {
+	imp := importTestWappalyzer(t, WappalyzerOptions{})
+
+	rules := make(map[string]DetectionRule)
+	for _, rule := range imp.Ruleset.RuleGroups[0].DetectionRules {
+		rules[rule.ObjectName] = rule
+	}
+	if len(rules) != 4 {
+		t.Fatalf("imported %d detection rules, expected 4: %v", len(rules), rules)
+	}
+	if _, exists := rules["Lookahead"]; exists {
+		t.Errorf("the technology with an unsupported pattern was imported")
+	}
+
+	wordpress := rules["WordPress"]
+	if !reflect.DeepEqual(wordpress.Implies, []string{"PHP", "MySQL"}) {
+		t.Errorf("WordPress implies = %v", wordpress.Implies)
+	}
+	expectedMeta := MetaTag{Name: "generator", Content: `^wordpress(?: ([\d.]+))?`, Confidence: 10, Version: "${1}"}
+	if len(wordpress.MetaTags) != 1 || !reflect.DeepEqual(wordpress.MetaTags[0], expectedMeta) {
+		t.Errorf("WordPress meta tags = %+v, expected %+v", wordpress.MetaTags, expectedMeta)
+	}
+	if len(wordpress.PluginCalls) != 1 || wordpress.PluginCalls[0].PluginName != WappalyzerPluginPrefix+"wordpress" {
+		t.Errorf("WordPress plugin calls = %+v", wordpress.PluginCalls)
+	}
+
+	jquery := rules["jQuery"]
+	if len(jquery.PageContentPatterns) != 2 || jquery.PageContentPatterns[1].Confidence != 8 || jquery.PageContentPatterns[1].Version != "${1}" {
+		t.Errorf("jQuery page content patterns = %+v", jquery.PageContentPatterns)
+	}
+
+	php := rules["PHP"]
+	if len(php.URLMicroSignatures) != 1 || php.URLMicroSignatures[0].Signature != `(?i)\.php(?:$|\?)` {
+		t.Errorf("PHP URL signatures = %+v", php.URLMicroSignatures)
+	}
+
+	cookies := rules["Cloudflare"].Cookies
+	if len(cookies) != 2 || cookies[0].Name != "__cf_bm" || cookies[1].Name != "__cfduid" || len(cookies[1].Value) != 0 {
+		t.Fatalf("Cloudflare cookies = %+v", cookies)
+	}
+	if re := regexp.MustCompile(cookies[0].Value[0]); !re.MatchString("0a1b2c") || re.MatchString("zz") {
+		t.Errorf("cookie pattern %q doesn't match as expected", cookies[0].Value[0])
+	}
+
+	warnings := strings.Join(imp.Warnings, "\n")
+	for _, expected := range []string{"Cloudflare: 'dns'", "Lookahead: unsupported pattern", "Lookahead: 'excludes'", "Lookahead: no detection patterns"} {
+		if !strings.Contains(warnings, expected) {
+			t.Errorf("warnings don't contain %q:\n%s", expected, warnings)
+		}
+	}
+	if len(imp.Warnings) != 4 {
+		t.Errorf("got %d warnings, expected 4:\n%s", len(imp.Warnings), warnings)
+	}
+}
+
+func TestImportWappalyzerValidates(t *testing.T) {
+	imp := importTestWappalyzer(t, WappalyzerOptions{})
+	schema, err := LoadSchema("../../schemas/ruleset-schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := imp.Marshal(schema)
+	if err != nil {
+		t.Fatalf("Marshal() returned an error: %v", err)
+	}
+
+	// The document is loaded like the other rulesets
+	ruleset, err := parseRuleset(schema, &doc, "yaml")
+	if err != nil {
+		t.Fatalf("parseRuleset() returned an error: %v", err)
+	}
+	loaded := ruleset.RuleGroups[0].DetectionRules
+	imported := imp.Ruleset.RuleGroups[0].DetectionRules
+	if len(loaded) != len(imported) {
+		t.Fatalf("loaded %d detection rules, expected %d", len(loaded), len(imported))
+	}
+	for i := range imported {
+		// The plugin arguments values are loaded as generic numbers
+		if len(loaded[i].PluginCalls) != len(imported[i].PluginCalls) {
+			t.Errorf("%s: loaded plugin calls = %+v, expected %+v", imported[i].ObjectName, loaded[i].PluginCalls, imported[i].PluginCalls)
+		}
+		loaded[i].PluginCalls, imported[i].PluginCalls = nil, nil
+		if !reflect.DeepEqual(loaded[i], imported[i]) {
+			t.Errorf("loaded detection rule = %+v, expected %+v", loaded[i], imported[i])
+		}
+	}
+}
+
+func TestLowerPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"WordPress ([\\d.]+)", "wordpress ([\\d.]+)"},
+		{"[A-F0-9]+", "[a-f0-9]+"},
+		{"(?i)Drupal", "(?i)drupal"},
+		{"\\S+Ver\\p{Lu}\\x{41}", "\\S+ver\\p{Lu}\\x{41}"},
+		{"\\QABC\\E(?P<Version>X)", "\\QABC\\E(?P<Version>x)"},
+	}
+	for _, tt := range tests {
+		got, err := lowerPattern(tt.pattern)
+		if err != nil {
+			t.Errorf("lowerPattern(%q) returned an error: %v", tt.pattern, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("lowerPattern(%q) = %q, expected %q", tt.pattern, got, tt.expected)
+		}
+	}
+	if _, err := lowerPattern("a(?!b)"); err == nil {
+		t.Errorf("lowerPattern() expected an error for a lookahead")
+	}
+}
+
+func TestWappalyzerPlugin(t *testing.T) {
+	imp := importTestWappalyzer(t, WappalyzerOptions{})
+	var plugin = imp.Plugins[0]
+	for _, p := range imp.Plugins {
+		if p.Name == WappalyzerPluginPrefix+"jquery" {
+			plugin = p
+		}
+	}
+	if plugin.Name != WappalyzerPluginPrefix+"jquery" || plugin.PType != "vdi_plugin" {
+		t.Fatalf("unexpected jQuery plugin %s (%s)", plugin.Name, plugin.PType)
+	}
+
+	suite := &plugintest.Suite{Timeout: plugintest.DefaultTimeout}
+	tc := &plugintest.TestCase{
+		Name: "jquery global",
+		Page: &plugintest.PageFixture{Globals: map[string]interface{}{
+			"jQuery": map[string]interface{}{"fn": map[string]interface{}{"jquery": "3.7.1"}},
+		}},
+		Expect: map[string]interface{}{"property": "jQuery.fn.jquery", "value": "3.7.1", "version": "3.7.1"},
+	}
+	if result := suite.RunCase(plugin, tc); !result.Passed {
+		t.Errorf("%s: %v", tc.Name, result.Failures)
+	}
+
+	tc = &plugintest.TestCase{Name: "no global", Expect: map[string]interface{}{}}
+	if result := suite.RunCase(plugin, tc); len(result.Result) != 0 {
+		t.Errorf("%s: result = %v, expected no result", tc.Name, result.Result)
+	}
+}
+
+func TestImportWappalyzerJSGlobals(t *testing.T) {
+	imp := importTestWappalyzer(t, WappalyzerOptions{JSGlobals: true})
+	if len(imp.Plugins) != 0 {
+		t.Errorf("generated %d plugins, expected none", len(imp.Plugins))
+	}
+
+	rules := make(map[string]DetectionRule)
+	for _, rule := range imp.Ruleset.RuleGroups[0].DetectionRules {
+		rules[rule.ObjectName] = rule
+	}
+	expectedGlobal := JSGlobalSignature{Property: "wp_username", Confidence: 10}
+	if wordpress := rules["WordPress"]; len(wordpress.JSGlobals) != 1 || !reflect.DeepEqual(wordpress.JSGlobals[0], expectedGlobal) {
+		t.Errorf("WordPress JS globals = %+v, expected %+v", wordpress.JSGlobals, expectedGlobal)
+	}
+	jquery := rules["jQuery"]
+	expectedGlobal = JSGlobalSignature{Property: "jQuery.fn.jquery", Value: []string{`([\d.]+)`}, Confidence: 10, Version: "${1}"}
+	if len(jquery.JSGlobals) != 1 || !reflect.DeepEqual(jquery.JSGlobals[0], expectedGlobal) {
+		t.Errorf("jQuery JS globals = %+v, expected %+v", jquery.JSGlobals, expectedGlobal)
+	}
+	if len(jquery.PluginCalls) != 0 {
+		t.Errorf("jQuery plugin calls = %+v, expected none", jquery.PluginCalls)
+	}
+}
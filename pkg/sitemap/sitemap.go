@@ -0,0 +1,345 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sitemap implements the sitemaps discovery and parsing logic.
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+var (
+	// lastModFormats are the W3C Datetime formats allowed in <lastmod>
+	lastModFormats = []string{
+		time.RFC3339Nano,
+		time.RFC3339,
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+		"2006-01",
+		"2006",
+	}
+)
+
+// Discover returns the list of sitemaps to use for a site. If the site's
+// robots.txt declared any sitemaps then those are used, otherwise the
+// default /sitemap.xml location is returned.
+func Discover(siteURL string, robotsSitemaps []string) []string {
+	sitemaps := make([]string, 0, len(robotsSitemaps))
+	seen := make(map[string]bool)
+	for _, sm := range robotsSitemaps {
+		sm = strings.TrimSpace(sm)
+		if sm == "" || seen[sm] {
+			continue
+		}
+		seen[sm] = true
+		sitemaps = append(sitemaps, sm)
+	}
+	if len(sitemaps) > 0 {
+		return sitemaps
+	}
+
+	u, err := url.Parse(strings.TrimSpace(siteURL))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return sitemaps
+	}
+	return append(sitemaps, u.Scheme+"://"+u.Host+"/sitemap.xml")
+}
+
+// Fetch retrieves a sitemap and returns its (uncompressed) content
+func Fetch(sitemapURL, userAgent string, timeout int) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = 10
+	}
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(timeout, "ignore"),
+		Timeout:   time.Duration(timeout) * time.Second,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sitemap %s: %v", sitemapURL, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received non-200 response from %s: %d", sitemapURL, resp.StatusCode)
+	}
+
+	// Read one byte more than the limit, so we can detect oversized sitemaps
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxSitemapSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sitemap %s: %v", sitemapURL, err)
+	}
+	if len(body) > MaxSitemapSize {
+		return nil, fmt.Errorf("sitemap %s is bigger than %d bytes", sitemapURL, MaxSitemapSize)
+	}
+
+	return body, nil
+}
+
+// decompress returns the uncompressed content of a sitemap (if it's gzipped)
+func decompress(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress sitemap: %v", err)
+	}
+	defer zr.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	out, err := io.ReadAll(io.LimitReader(zr, MaxSitemapSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress sitemap: %v", err)
+	}
+	if len(out) > MaxSitemapSize {
+		return nil, fmt.Errorf("uncompressed sitemap is bigger than %d bytes", MaxSitemapSize)
+	}
+	return out, nil
+}
+
+// Parse parses a sitemap document (urlset, sitemap index or plain text,
+// optionally gzipped) and returns the URLs and the nested sitemaps it
+// contains.
+func Parse(data []byte) ([]URL, []string, error) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, err := rootElement(data)
+	if err != nil {
+		// Not an XML document, try the plain text format
+		return parseText(data), nil, nil
+	}
+
+	switch root {
+	case "urlset":
+		var set xmlURLSet
+		if err := xml.Unmarshal(data, &set); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse urlset: %v", err)
+		}
+		urls := make([]URL, 0, len(set.URLs))
+		for _, u := range set.URLs {
+			loc := strings.TrimSpace(u.Loc)
+			if loc == "" {
+				continue
+			}
+			urls = append(urls, URL{
+				Loc:        loc,
+				LastMod:    parseLastMod(u.LastMod),
+				ChangeFreq: strings.ToLower(strings.TrimSpace(u.ChangeFreq)),
+				Priority:   parsePriority(u.Priority),
+			})
+			if len(urls) >= MaxSitemapURLs {
+				break
+			}
+		}
+		return urls, nil, nil
+	case "sitemapindex":
+		var index xmlSitemapIndex
+		if err := xml.Unmarshal(data, &index); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse sitemap index: %v", err)
+		}
+		sitemaps := make([]string, 0, len(index.Sitemaps))
+		for _, sm := range index.Sitemaps {
+			loc := strings.TrimSpace(sm.Loc)
+			if loc != "" {
+				sitemaps = append(sitemaps, loc)
+			}
+		}
+		return nil, sitemaps, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported sitemap root element: %s", root)
+	}
+}
+
+// rootElement returns the local name of the root element of an XML document
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// parseText parses a plain text sitemap (one URL per line)
+func parseText(data []byte) []URL {
+	var urls []URL
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "http://") && !strings.HasPrefix(line, "https://") {
+			continue
+		}
+		urls = append(urls, URL{Loc: line, Priority: DefaultPriority})
+		if len(urls) >= MaxSitemapURLs {
+			break
+		}
+	}
+	return urls
+}
+
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, format := range lastModFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func parsePriority(value string) float64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DefaultPriority
+	}
+	p, err := strconv.ParseFloat(value, 64)
+	if err != nil || p < 0 || p > 1 {
+		return DefaultPriority
+	}
+	return p
+}
+
+// Collect fetches the given sitemaps (following sitemap index files) and
+// returns all the URLs found, ordered by priority and most recent lastmod.
+// If opts.MaxURLs is set, only the opts.MaxURLs first URLs in that order are
+// returned (all the sitemaps are still read to find them).
+func Collect(sitemapURLs []string, opts Options) ([]URL, error) {
+	if opts.Fetcher == nil {
+		opts.Fetcher = Fetch
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+
+	type queued struct {
+		url   string
+		depth int
+	}
+	queue := make([]queued, 0, len(sitemapURLs))
+	for _, sm := range sitemapURLs {
+		queue = append(queue, queued{url: sm})
+	}
+
+	var urls []URL
+	var errs []error
+	seenSitemaps := make(map[string]bool)
+	seenURLs := make(map[string]bool)
+
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+		if seenSitemaps[item.url] {
+			continue
+		}
+		seenSitemaps[item.url] = true
+
+		cmn.DebugMsg(cmn.DbgLvlDebug2, "Fetching sitemap: %s", item.url)
+		data, err := opts.Fetcher(item.url, opts.UserAgent, opts.Timeout)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		found, nested, err := Parse(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", item.url, err))
+			continue
+		}
+
+		for _, u := range found {
+			if seenURLs[u.Loc] {
+				continue
+			}
+			seenURLs[u.Loc] = true
+			u.Sitemap = item.url
+			urls = append(urls, u)
+		}
+		// Keep the memory bounded by dropping the lowest priority URLs
+		if opts.MaxURLs > 0 && len(urls) > 2*opts.MaxURLs {
+			urls = truncate(urls, opts.MaxURLs)
+		}
+
+		if item.depth+1 > opts.MaxDepth {
+			if len(nested) > 0 {
+				cmn.DebugMsg(cmn.DbgLvlDebug, "Sitemap index %s exceeds max nesting level, ignoring %d sitemaps", item.url, len(nested))
+			}
+			continue
+		}
+		for _, sm := range nested {
+			queue = append(queue, queued{url: sm, depth: item.depth + 1})
+		}
+	}
+
+	Sort(urls)
+	if opts.MaxURLs > 0 && len(urls) > opts.MaxURLs {
+		urls = urls[:opts.MaxURLs]
+	}
+
+	if len(urls) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return urls, nil
+}
+
+// truncate sorts urls and returns the first limit ones
+func truncate(urls []URL, limit int) []URL {
+	Sort(urls)
+	if len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls
+}
+
+// Sort orders URLs by priority (highest first) and then by lastmod (most recent first)
+func Sort(urls []URL) {
+	sort.SliceStable(urls, func(i, j int) bool {
+		if urls[i].Priority != urls[j].Priority {
+			return urls[i].Priority > urls[j].Priority
+		}
+		return urls[i].LastMod.After(urls[j].LastMod)
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const testURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>https://www.example.com/</loc>
+    <lastmod>2024-01-01</lastmod>
+    <changefreq>Daily</changefreq>
+    <priority>1.0</priority>
+  </url>
+  <url>
+    <loc>https://www.example.com/news/old</loc>
+    <lastmod>2023-05-01T10:00:00+00:00</lastmod>
+  </url>
+  <url>
+    <loc>https://www.example.com/news/new</loc>
+    <lastmod>2024-05-01T10:00:00Z</lastmod>
+    <priority>invalid</priority>
+  </url>
+</urlset>`
+
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("failed to gzip data: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to gzip data: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseURLSet(t *testing.T) {
+	urls, nested, err := Parse([]byte(testURLSet))
+	if err != nil {
+		t.Fatalf("Parse() returned an error: %v", err)
+	}
+	if len(nested) != 0 {
+		t.Errorf("expected no nested sitemaps, got %d", len(nested))
+	}
+	if len(urls) != 3 {
+		t.Fatalf("expected 3 URLs, got %d", len(urls))
+	}
+	if urls[0].Priority != 1.0 || urls[0].ChangeFreq != "daily" || urls[0].LastMod.Year() != 2024 {
+		t.Errorf("unexpected first URL: %+v", urls[0])
+	}
+	if urls[1].Priority != DefaultPriority || urls[1].LastMod.IsZero() {
+		t.Errorf("unexpected second URL: %+v", urls[1])
+	}
+	if urls[2].Priority != DefaultPriority {
+		t.Errorf("expected invalid priority to default to %f, got %f", DefaultPriority, urls[2].Priority)
+	}
+}
+
+func TestParseGzipAndIndex(t *testing.T) {
+	index := `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://www.example.com/sitemap1.xml.gz</loc></sitemap>
+  <sitemap><loc>https://www.example.com/sitemap2.xml</loc><lastmod>2024-01-01</lastmod></sitemap>
+</sitemapindex>`
+
+	urls, nested, err := Parse(gzipData(t, index))
+	if err != nil {
+		t.Fatalf("Parse() returned an error: %v", err)
+	}
+	if len(urls) != 0 {
+		t.Errorf("expected no URLs, got %d", len(urls))
+	}
+	want := []string{"https://www.example.com/sitemap1.xml.gz", "https://www.example.com/sitemap2.xml"}
+	if !reflect.DeepEqual(nested, want) {
+		t.Errorf("Parse() nested = %v, want %v", nested, want)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	urls, _, err := Parse([]byte("https://www.example.com/a\n\nnot-a-url\nhttps://www.example.com/b\n"))
+	if err != nil {
+		t.Fatalf("Parse() returned an error: %v", err)
+	}
+	if len(urls) != 2 {
+		t.Errorf("expected 2 URLs, got %d", len(urls))
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	got := Discover("https://www.example.com/path", nil)
+	want := []string{"https://www.example.com/sitemap.xml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover() = %v, want %v", got, want)
+	}
+
+	robotsSitemaps := []string{"https://www.example.com/a.xml", "https://www.example.com/a.xml", "https://www.example.com/b.xml"}
+	got = Discover("https://www.example.com/", robotsSitemaps)
+	want = []string{"https://www.example.com/a.xml", "https://www.example.com/b.xml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover() = %v, want %v", got, want)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap_index.xml":
+			_, _ = fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/sitemap1.xml.gz</loc></sitemap><sitemap><loc>%s/missing.xml</loc></sitemap><sitemap><loc>%s/sitemap_index.xml</loc></sitemap></sitemapindex>`, server.URL, server.URL, server.URL)
+		case "/sitemap1.xml.gz":
+			_, _ = w.Write(gzipData(t, testURLSet))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	urls, err := Collect([]string{server.URL + "/sitemap_index.xml"}, Options{Timeout: 5})
+	if err != nil {
+		t.Fatalf("Collect() returned an error: %v", err)
+	}
+	if len(urls) != 3 {
+		t.Fatalf("expected 3 URLs, got %d", len(urls))
+	}
+	// Highest priority first, then most recent lastmod
+	want := []string{"https://www.example.com/", "https://www.example.com/news/new", "https://www.example.com/news/old"}
+	for i, u := range urls {
+		if u.Loc != want[i] {
+			t.Errorf("Collect()[%d] = %s, want %s", i, u.Loc, want[i])
+		}
+		if u.Sitemap != server.URL+"/sitemap1.xml.gz" {
+			t.Errorf("Collect()[%d].Sitemap = %s", i, u.Sitemap)
+		}
+	}
+
+	urls, err = Collect([]string{server.URL + "/sitemap_index.xml"}, Options{Timeout: 5, MaxURLs: 1})
+	if err != nil {
+		t.Fatalf("Collect() returned an error: %v", err)
+	}
+	if len(urls) != 1 {
+		t.Errorf("expected 1 URL with MaxURLs=1, got %d", len(urls))
+	}
+
+	if _, err = Collect([]string{server.URL + "/missing.xml"}, Options{Timeout: 5}); err == nil {
+		t.Errorf("expected an error collecting a missing sitemap")
+	}
+}
+
+func TestCollectMaxURLsByPriority(t *testing.T) {
+	sitemaps := map[string]string{
+		"low.xml":  `<urlset><url><loc>https://www.example.com/a</loc><priority>0.1</priority></url><url><loc>https://www.example.com/b</loc><priority>0.2</priority></url></urlset>`,
+		"high.xml": `<urlset><url><loc>https://www.example.com/c</loc><priority>0.3</priority></url><url><loc>https://www.example.com/d</loc><priority>0.9</priority></url><url><loc>https://www.example.com/e</loc><priority>0.8</priority></url></urlset>`,
+	}
+	fetcher := func(sitemapURL, _ string, _ int) ([]byte, error) {
+		return []byte(sitemaps[sitemapURL]), nil
+	}
+
+	urls, err := Collect([]string{"low.xml", "high.xml"}, Options{MaxURLs: 2, Fetcher: fetcher})
+	if err != nil {
+		t.Fatalf("Collect() returned an error: %v", err)
+	}
+	want := []string{"https://www.example.com/d", "https://www.example.com/e"}
+	if len(urls) != len(want) {
+		t.Fatalf("expected %d URLs, got %d", len(want), len(urls))
+	}
+	for i, u := range urls {
+		if u.Loc != want[i] {
+			t.Errorf("Collect()[%d] = %s, want %s", i, u.Loc, want[i])
+		}
+	}
+}
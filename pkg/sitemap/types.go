@@ -0,0 +1,77 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sitemap implements the sitemaps discovery and parsing logic.
+package sitemap
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const (
+	// MaxSitemapSize is the maximum (uncompressed) size of a sitemap we are willing to parse (50 MiB as per protocol)
+	MaxSitemapSize = 50 * 1024 * 1024
+	// MaxSitemapURLs is the maximum number of URLs a single sitemap can contain (as per protocol)
+	MaxSitemapURLs = 50000
+	// DefaultMaxDepth is the default maximum nesting level of sitemap index files
+	DefaultMaxDepth = 3
+	// DefaultPriority is the priority of a URL that doesn't specify one (as per protocol)
+	DefaultPriority = 0.5
+)
+
+// URL represents a single URL entry collected from a sitemap
+type URL struct {
+	Loc        string    `json:"loc" yaml:"loc"`                 // The URL of the page
+	LastMod    time.Time `json:"lastmod" yaml:"lastmod"`         // Last modification time (zero if not provided or invalid)
+	ChangeFreq string    `json:"changefreq" yaml:"changefreq"`   // How frequently the page is likely to change
+	Priority   float64   `json:"priority" yaml:"priority"`       // Priority of this URL relative to other URLs on the site
+	Sitemap    string    `json:"sitemap_url" yaml:"sitemap_url"` // The sitemap the URL was found in
+}
+
+// Options represents the options used to collect URLs from sitemaps
+type Options struct {
+	UserAgent string // User agent to use when fetching sitemaps
+	Timeout   int    // Timeout (in seconds) for each sitemap request
+	MaxURLs   int    // Maximum number of URLs to collect (0 means no limit)
+	MaxDepth  int    // Maximum nesting level of sitemap index files (0 means DefaultMaxDepth)
+	// Fetcher is the function used to retrieve a sitemap, it can be replaced for testing
+	Fetcher func(sitemapURL, userAgent string, timeout int) ([]byte, error)
+}
+
+// xmlURLSet represents a <urlset> sitemap document
+type xmlURLSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	URLs    []xmlURL `xml:"url"`
+}
+
+// xmlURL represents a <url> entry of a <urlset>
+type xmlURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+// xmlSitemapIndex represents a <sitemapindex> document
+type xmlSitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Sitemaps []xmlSitemap `xml:"sitemap"`
+}
+
+// xmlSitemap represents a <sitemap> entry of a <sitemapindex>
+type xmlSitemap struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package warc implements a WARC 1.1 (Web ARChive) writer and reader.
+package warc
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// Version is the WARC version written in each record
+	Version = "WARC/1.1"
+
+	// TypeWarcinfo is the type of a record describing the WARC file
+	TypeWarcinfo = "warcinfo"
+	// TypeRequest is the type of a record containing an HTTP request
+	TypeRequest = "request"
+	// TypeResponse is the type of a record containing an HTTP response
+	TypeResponse = "response"
+	// TypeResource is the type of a record containing a resource (e.g. a screenshot)
+	TypeResource = "resource"
+	// TypeConversion is the type of a record containing an alternative version
+	// of some content (e.g. the DOM of a page as rendered by the browser)
+	TypeConversion = "conversion"
+	// TypeMetadata is the type of a record containing metadata about another record
+	TypeMetadata = "metadata"
+
+	// ContentTypeHTTPRequest is the Content-Type of request records
+	ContentTypeHTTPRequest = "application/http; msgtype=request"
+	// ContentTypeHTTPResponse is the Content-Type of response records
+	ContentTypeHTTPResponse = "application/http; msgtype=response"
+	// ContentTypeWarcFields is the Content-Type of warcinfo and metadata records
+	ContentTypeWarcFields = "application/warc-fields"
+)
+
+// Record represents a single WARC record
+type Record struct {
+	Type         string            // WARC-Type
+	RecordID     string            // WARC-Record-ID (generated if empty)
+	Date         time.Time         // WARC-Date (now if zero)
+	TargetURI    string            // WARC-Target-URI
+	ConcurrentTo string            // WARC-Concurrent-To (e.g. the request of a response)
+	ContentType  string            // Content-Type of the record block
+	Fields       map[string]string // Additional WARC named fields
+	Block        []byte            // The record content block
+}
+
+// Writer writes WARC records to an io.Writer. It's safe for concurrent use.
+type Writer struct {
+	mutex    sync.Mutex
+	w        io.Writer
+	compress bool // Compress each record as a separate gzip member (.warc.gz)
+	records  int  // Number of records written
+}
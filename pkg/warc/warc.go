@@ -0,0 +1,372 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package warc implements a WARC 1.1 (Web ARChive) writer and reader.
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1" //nolint:gosec // SHA-1 is the digest algorithm used by WARC tools, it's not used for security
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewWriter returns a new WARC writer. If compress is true each record is
+// written as a separate gzip member, as expected for .warc.gz files.
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, compress: compress}
+}
+
+// Records returns the number of records written so far
+func (w *Writer) Records() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.records
+}
+
+// NewRecordID returns a new unique WARC-Record-ID
+func NewRecordID() string {
+	return "<urn:uuid:" + uuid.New().String() + ">"
+}
+
+// Digest returns the WARC digest (base32 encoded SHA-1) of data
+func Digest(data []byte) string {
+	sum := sha1.Sum(data) //nolint:gosec // SHA-1 is the digest algorithm used by WARC tools
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// WriteRecord writes a record and returns its WARC-Record-ID
+func (w *Writer) WriteRecord(r *Record) (string, error) {
+	if r.Type == "" {
+		return "", errors.New("WARC record type is required")
+	}
+	if r.RecordID == "" {
+		r.RecordID = NewRecordID()
+	}
+	if r.Date.IsZero() {
+		r.Date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(Version + "\r\n")
+	writeField(&buf, "WARC-Type", r.Type)
+	writeField(&buf, "WARC-Record-ID", r.RecordID)
+	writeField(&buf, "WARC-Date", r.Date.UTC().Format(time.RFC3339))
+	if r.TargetURI != "" {
+		writeField(&buf, "WARC-Target-URI", r.TargetURI)
+	}
+	if r.ConcurrentTo != "" {
+		writeField(&buf, "WARC-Concurrent-To", r.ConcurrentTo)
+	}
+	if r.ContentType != "" {
+		writeField(&buf, "Content-Type", r.ContentType)
+	}
+	writeField(&buf, "WARC-Block-Digest", Digest(r.Block))
+	if payload, ok := httpPayload(r); ok {
+		writeField(&buf, "WARC-Payload-Digest", Digest(payload))
+	}
+	names := make([]string, 0, len(r.Fields))
+	for name := range r.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeField(&buf, name, r.Fields[name])
+	}
+	writeField(&buf, "Content-Length", strconv.Itoa(len(r.Block)))
+	buf.WriteString("\r\n")
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.compress {
+		zw := gzip.NewWriter(w.w)
+		if _, err := zw.Write(buf.Bytes()); err != nil {
+			return "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+	} else if _, err := w.w.Write(buf.Bytes()); err != nil {
+		return "", err
+	}
+	w.records++
+
+	return r.RecordID, nil
+}
+
+// writeField writes a WARC named field (removing line breaks from its value)
+func writeField(buf *bytes.Buffer, name, value string) {
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	buf.WriteString(name + ": " + value + "\r\n")
+}
+
+// httpPayload returns the payload (the HTTP body) of request and response records
+func httpPayload(r *Record) ([]byte, bool) {
+	if r.Type != TypeResponse && r.Type != TypeRequest {
+		return nil, false
+	}
+	if !strings.HasPrefix(r.ContentType, "application/http") {
+		return nil, false
+	}
+	idx := bytes.Index(r.Block, []byte("\r\n\r\n"))
+	if idx < 0 {
+		return nil, false
+	}
+	return r.Block[idx+4:], true
+}
+
+// WriteWarcinfo writes a warcinfo record describing the WARC file
+func (w *Writer) WriteWarcinfo(filename string, fields map[string]string) (string, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var block bytes.Buffer
+	for _, name := range names {
+		writeField(&block, name, fields[name])
+	}
+
+	record := &Record{
+		Type:        TypeWarcinfo,
+		ContentType: ContentTypeWarcFields,
+		Block:       block.Bytes(),
+	}
+	if filename != "" {
+		record.Fields = map[string]string{"WARC-Filename": filename}
+	}
+	return w.WriteRecord(record)
+}
+
+// WriteRequest writes a request record for an HTTP request and returns its WARC-Record-ID
+func (w *Writer) WriteRequest(targetURI, method string, headers http.Header, body []byte, date time.Time) (string, error) {
+	return w.WriteRecord(&Record{
+		Type:        TypeRequest,
+		Date:        date,
+		TargetURI:   targetURI,
+		ContentType: ContentTypeHTTPRequest,
+		Block:       HTTPRequest(targetURI, method, headers, body),
+	})
+}
+
+// WriteResponse writes a response record for an HTTP response and returns its
+// WARC-Record-ID. requestID is the WARC-Record-ID of the matching request (if any).
+func (w *Writer) WriteResponse(targetURI string, status int, headers http.Header, body []byte, requestID string, date time.Time) (string, error) {
+	return w.WriteRecord(&Record{
+		Type:         TypeResponse,
+		Date:         date,
+		TargetURI:    targetURI,
+		ConcurrentTo: requestID,
+		ContentType:  ContentTypeHTTPResponse,
+		Block:        HTTPResponse(status, headers, body),
+	})
+}
+
+// WriteResource writes a resource record (e.g. a screenshot) and returns its WARC-Record-ID
+func (w *Writer) WriteResource(targetURI, contentType string, data []byte, date time.Time) (string, error) {
+	return w.WriteRecord(&Record{
+		Type:        TypeResource,
+		Date:        date,
+		TargetURI:   targetURI,
+		ContentType: contentType,
+		Block:       data,
+	})
+}
+
+// WriteConversion writes a conversion record (e.g. the rendered DOM of a page)
+// and returns its WARC-Record-ID. refersTo is the WARC-Record-ID of the record
+// the content was converted from (if any).
+func (w *Writer) WriteConversion(targetURI, contentType string, data []byte, refersTo string, date time.Time) (string, error) {
+	record := &Record{
+		Type:        TypeConversion,
+		Date:        date,
+		TargetURI:   targetURI,
+		ContentType: contentType,
+		Block:       data,
+	}
+	if refersTo != "" {
+		record.Fields = map[string]string{"WARC-Refers-To": refersTo}
+	}
+	return w.WriteRecord(record)
+}
+
+// HTTPRequest returns the HTTP/1.1 wire format of a request
+func HTTPRequest(targetURI, method string, headers http.Header, body []byte) []byte {
+	if method == "" {
+		method = http.MethodGet
+	}
+	requestURI := targetURI
+	host := ""
+	if req, err := http.NewRequest(method, targetURI, nil); err == nil {
+		requestURI = req.URL.RequestURI()
+		host = req.URL.Host
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(method + " " + requestURI + " HTTP/1.1\r\n")
+	if host != "" && headers.Get("Host") == "" {
+		buf.WriteString("Host: " + host + "\r\n")
+	}
+	writeHTTPHeaders(&buf, headers, len(body))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// HTTPResponse returns the HTTP/1.1 wire format of a response
+func HTTPResponse(status int, headers http.Header, body []byte) []byte {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	writeHTTPHeaders(&buf, headers, len(body))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// writeHTTPHeaders writes the headers (in a stable order) followed by the
+// empty line separating them from the body
+func writeHTTPHeaders(buf *bytes.Buffer, headers http.Header, bodyLen int) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// The body is stored decoded and de-chunked, so these headers would be misleading
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			continue
+		}
+		for _, value := range headers[name] {
+			writeField(buf, name, value)
+		}
+	}
+	if bodyLen > 0 {
+		buf.WriteString("Content-Length: " + strconv.Itoa(bodyLen) + "\r\n")
+	}
+	buf.WriteString("\r\n")
+}
+
+// Read reads all the records of a WARC file (compressed or not)
+func Read(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+		br = bufio.NewReader(zr)
+	}
+
+	var records []Record
+	for {
+		record, err := readRecord(br)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, *record)
+	}
+}
+
+// readRecord reads the next record (skipping any empty line before it)
+func readRecord(br *bufio.Reader) (*Record, error) {
+	var line string
+	var err error
+	for line == "" {
+		line, err = br.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return nil, io.EOF
+			}
+			if err != io.EOF {
+				return nil, err
+			}
+		}
+		line = strings.TrimRight(line, "\r\n")
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("invalid WARC record header: %q", line)
+	}
+
+	record := &Record{Fields: make(map[string]string)}
+	contentLength := -1
+	for {
+		line, err = br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading WARC record header: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid WARC field: %q", line)
+		}
+		value = strings.TrimSpace(value)
+		switch name {
+		case "WARC-Type":
+			record.Type = value
+		case "WARC-Record-ID":
+			record.RecordID = value
+		case "WARC-Date":
+			record.Date, _ = time.Parse(time.RFC3339, value)
+		case "WARC-Target-URI":
+			record.TargetURI = value
+		case "WARC-Concurrent-To":
+			record.ConcurrentTo = value
+		case "Content-Type":
+			record.ContentType = value
+		case "Content-Length":
+			contentLength, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid WARC Content-Length: %q", value)
+			}
+		default:
+			record.Fields[name] = value
+		}
+	}
+	if contentLength < 0 {
+		return nil, errors.New("WARC record without Content-Length")
+	}
+
+	record.Block = make([]byte, contentLength)
+	if _, err := io.ReadFull(br, record.Block); err != nil {
+		return nil, fmt.Errorf("reading WARC record block: %v", err)
+	}
+	// Skip the two CRLF ending the record
+	if _, err := br.Discard(4); err != nil {
+		return nil, fmt.Errorf("reading WARC record end: %v", err)
+	}
+	return record, nil
+}
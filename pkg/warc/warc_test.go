@@ -0,0 +1,130 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package warc
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestRecords(t *testing.T, compress bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, compress)
+
+	if _, err := w.WriteWarcinfo("test.warc", map[string]string{"software": "CROWler"}); err != nil {
+		t.Fatalf("WriteWarcinfo() returned an error: %v", err)
+	}
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	reqID, err := w.WriteRequest("https://www.example.com/page?x=1", "", http.Header{"User-Agent": {"CROWler"}}, nil, date)
+	if err != nil {
+		t.Fatalf("WriteRequest() returned an error: %v", err)
+	}
+	headers := http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}}
+	if _, err := w.WriteResponse("https://www.example.com/page?x=1", 200, headers, []byte("<html></html>"), reqID, date); err != nil {
+		t.Fatalf("WriteResponse() returned an error: %v", err)
+	}
+	if _, err := w.WriteResource("https://www.example.com/page?x=1#screenshot", "image/png", []byte{0x89, 'P', 'N', 'G'}, date); err != nil {
+		t.Fatalf("WriteResource() returned an error: %v", err)
+	}
+	if w.Records() != 4 {
+		t.Errorf("Records() = %d, want 4", w.Records())
+	}
+	return buf.Bytes()
+}
+
+func TestWriteAndRead(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		data := writeTestRecords(t, compress)
+		if !compress && !bytes.HasPrefix(data, []byte("WARC/1.1\r\nWARC-Type: warcinfo\r\n")) {
+			t.Errorf("unexpected WARC header: %q", data[:30])
+		}
+
+		records, err := Read(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Read(compress=%v) returned an error: %v", compress, err)
+		}
+		if len(records) != 4 {
+			t.Fatalf("Read(compress=%v) returned %d records, want 4", compress, len(records))
+		}
+
+		types := []string{TypeWarcinfo, TypeRequest, TypeResponse, TypeResource}
+		for i, r := range records {
+			if r.Type != types[i] {
+				t.Errorf("record %d type = %s, want %s", i, r.Type, types[i])
+			}
+			if r.Fields["WARC-Block-Digest"] != Digest(r.Block) {
+				t.Errorf("record %d has an invalid block digest", i)
+			}
+		}
+		if records[0].Fields["WARC-Filename"] != "test.warc" {
+			t.Errorf("unexpected warcinfo fields: %v", records[0].Fields)
+		}
+		if records[2].ConcurrentTo != records[1].RecordID {
+			t.Errorf("response WARC-Concurrent-To = %s, want %s", records[2].ConcurrentTo, records[1].RecordID)
+		}
+		if records[2].Fields["WARC-Payload-Digest"] != Digest([]byte("<html></html>")) {
+			t.Errorf("unexpected response payload digest: %s", records[2].Fields["WARC-Payload-Digest"])
+		}
+		if !records[1].Date.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			t.Errorf("unexpected request date: %v", records[1].Date)
+		}
+	}
+}
+
+func TestHTTPMessages(t *testing.T) {
+	req := string(HTTPRequest("https://www.example.com/a/b?c=d", "", http.Header{"Accept": {"*/*"}}, nil))
+	want := "GET /a/b?c=d HTTP/1.1\r\nHost: www.example.com\r\nAccept: */*\r\n\r\n"
+	if req != want {
+		t.Errorf("HTTPRequest() = %q, want %q", req, want)
+	}
+
+	resp := string(HTTPResponse(404, http.Header{"Content-Encoding": {"br"}, "X-Test": {"a\r\nb"}}, []byte("missing")))
+	want = "HTTP/1.1 404 Not Found\r\nX-Test: a  b\r\nContent-Length: 7\r\n\r\nmissing"
+	if resp != want {
+		t.Errorf("HTTPResponse() = %q, want %q", resp, want)
+	}
+	if !strings.HasPrefix(string(HTTPResponse(0, nil, nil)), "HTTP/1.1 200 OK\r\n") {
+		t.Errorf("expected status 0 to default to 200")
+	}
+}
+
+func TestWriteConversion(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, false)
+	if _, err := w.WriteConversion("https://www.example.com/", "text/html", []byte("<html></html>"), "", time.Now()); err != nil {
+		t.Fatalf("WriteConversion() returned an error: %v", err)
+	}
+	if _, err := w.WriteConversion("https://www.example.com/", "text/html", []byte("<html></html>"), "<urn:uuid:test>", time.Now()); err != nil {
+		t.Fatalf("WriteConversion() returned an error: %v", err)
+	}
+
+	records, err := Read(&buf)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Read() returned %d records (%v), want 2", len(records), err)
+	}
+	if records[0].Type != TypeConversion || records[0].ContentType != "text/html" || string(records[0].Block) != "<html></html>" {
+		t.Errorf("unexpected conversion record: %+v", records[0])
+	}
+	if _, ok := records[0].Fields["WARC-Refers-To"]; ok {
+		t.Errorf("unexpected WARC-Refers-To: %v", records[0].Fields)
+	}
+	if records[1].Fields["WARC-Refers-To"] != "<urn:uuid:test>" {
+		t.Errorf("WARC-Refers-To = %q, want %q", records[1].Fields["WARC-Refers-To"], "<urn:uuid:test>")
+	}
+}
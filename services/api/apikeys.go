@@ -0,0 +1,142 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (API) implements the API server for the Crowler search engine.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	auth "github.com/pzaino/thecrowler/pkg/auth"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+func performCreateAPIKey(query string, qType int, db *cdb.Handler) (APIKeyResponse, error) {
+	var req APIKeyRequest
+	if qType == getQuery {
+		req.Name = strings.TrimSpace(query)
+	} else {
+		if err := json.Unmarshal([]byte(query), &req); err != nil {
+			return APIKeyResponse{Message: "Invalid API key data"}, fmt.Errorf("failed to parse API key data: %w", err)
+		}
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return APIKeyResponse{Message: "Invalid API key name"}, fmt.Errorf("missing API key name")
+	}
+	req.Scope = strings.ToLower(strings.TrimSpace(req.Scope))
+	if req.Scope == "" {
+		req.Scope = auth.ScopeSearch
+	}
+	if !auth.IsValidScope(req.Scope) {
+		return APIKeyResponse{Message: "Invalid API key scope"}, fmt.Errorf("invalid scope '%s' (valid scopes are %s, %s and %s)", req.Scope, auth.ScopeSearch, auth.ScopeConsole, auth.ScopeAdmin)
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return APIKeyResponse{Message: "Invalid API key expiration"}, fmt.Errorf("expires_at is in the past")
+	}
+
+	key, keyHash, err := auth.GenerateKey()
+	if err != nil {
+		return APIKeyResponse{Message: "Failed to generate the API key"}, err
+	}
+	item := cdb.APIKey{
+		Name:      req.Name,
+		Prefix:    auth.KeyDisplayPrefix(key),
+		Scope:     req.Scope,
+		RateLimit: strings.TrimSpace(req.RateLimit),
+		Active:    true,
+		CreatedAt: time.Now(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	item.ID, err = cdb.CreateAPIKey(db, item, keyHash)
+	if err != nil {
+		return APIKeyResponse{Message: "Failed to create the API key"}, err
+	}
+
+	cmn.DebugMsg(cmn.DbgLvlInfo, "API key %d (%s) created with scope %s", item.ID, item.Prefix, item.Scope)
+	return APIKeyResponse{
+		Message: "API key created successfully, store it safely as it won't be shown again",
+		Key:     key,
+		Item:    item,
+	}, nil
+}
+
+func performListAPIKeys(db *cdb.Handler) (APIKeyListResponse, error) {
+	keys, err := cdb.ListAPIKeys(db)
+	if err != nil {
+		return APIKeyListResponse{Message: "Failed to list the API keys"}, err
+	}
+	return APIKeyListResponse{Message: "Success", Items: keys}, nil
+}
+
+func performRevokeAPIKey(query string, qType int, db *cdb.Handler) (ConsoleResponse, error) {
+	var req APIKeyRevokeRequest
+	if qType == getQuery {
+		keyID, err := strconv.ParseUint(strings.TrimSpace(query), 10, 64)
+		if err != nil {
+			return ConsoleResponse{Message: "Invalid API key ID"}, fmt.Errorf("invalid API key ID: %w", err)
+		}
+		req.KeyID = keyID
+	} else {
+		if err := json.Unmarshal([]byte(query), &req); err != nil {
+			return ConsoleResponse{Message: "Invalid API key data"}, fmt.Errorf("failed to parse API key data: %w", err)
+		}
+	}
+	if req.KeyID == 0 {
+		return ConsoleResponse{Message: "Invalid API key ID"}, fmt.Errorf("missing API key ID")
+	}
+
+	if err := cdb.RevokeAPIKey(db, req.KeyID); err != nil {
+		return ConsoleResponse{Message: "Failed to revoke the API key"}, err
+	}
+	// Revoked keys must stop working immediately, not when they expire from the cache
+	authenticator.Flush()
+
+	cmn.DebugMsg(cmn.DbgLvlInfo, "API key %d revoked", req.KeyID)
+	return ConsoleResponse{Message: fmt.Sprintf("API key %d revoked successfully", req.KeyID)}, nil
+}
+
+func createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	handleRequestWithDB(w, r, http.StatusCreated, func(query string, qType int, db *cdb.Handler) (interface{}, error) {
+		return performCreateAPIKey(query, qType, db)
+	})
+}
+
+func listAPIKeysHandler(w http.ResponseWriter, _ *http.Request) {
+	select {
+	case dbSemaphore <- struct{}{}:
+		defer func() { <-dbSemaphore }()
+
+		results, err := performListAPIKeys(&dbHandler)
+		handleErrorAndRespond(w, err, results, "Error listing API keys: %v", http.StatusInternalServerError, http.StatusOK)
+	case <-time.After(5 * time.Second): // Wait for a connection with timeout
+		healthStatus := HealthCheck{
+			Status: "DB is overloaded, please try again later",
+		}
+		handleErrorAndRespond(w, nil, healthStatus, "", http.StatusTooManyRequests, http.StatusTooManyRequests)
+	}
+}
+
+func revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	handleRequestWithDB(w, r, http.StatusOK, func(query string, qType int, db *cdb.Handler) (interface{}, error) {
+		return performRevokeAPIKey(query, qType, db)
+	})
+}
@@ -103,10 +103,18 @@ func extractQueryOrBody(r *http.Request) (string, error) {
 	if limit != "" {
 		query += "&limit:" + limit
 	}
+	mode := r.URL.Query().Get("mode")
+	if mode != "" {
+		query += "&mode:" + mode
+	}
 	details := r.URL.Query().Get("details")
 	if details != "" {
 		query += "&details:" + details
 	}
+	version := r.URL.Query().Get("version")
+	if version != "" {
+		query += "&version:" + version
+	}
 
 	return query, nil
 }
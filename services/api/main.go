@@ -29,6 +29,7 @@ import (
 	"syscall"
 	"time"
 
+	auth "github.com/pzaino/thecrowler/pkg/auth"
 	cmn "github.com/pzaino/thecrowler/pkg/common"
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 	cdb "github.com/pzaino/thecrowler/pkg/database"
@@ -43,11 +44,12 @@ const (
 
 // Create a rate limiter for your application. Adjust the parameters as needed.
 var (
-	limiter     *rate.Limiter
-	configMutex sync.Mutex
-	configFile  *string
-	dbSemaphore chan struct{} // Semaphore for the database connection
-	dbHandler   cdb.Handler
+	limiter       *rate.Limiter
+	authenticator *auth.Authenticator // API keys authentication
+	configMutex   sync.Mutex
+	configFile    *string
+	dbSemaphore   chan struct{} // Semaphore for the database connection
+	dbHandler     cdb.Handler
 )
 
 func initAll(configFile *string, config *cfg.Config, lmt **rate.Limiter) error {
@@ -112,6 +114,16 @@ func initAll(configFile *string, config *cfg.Config, lmt **rate.Limiter) error {
 		cmn.DebugMsg(cmn.DbgLvlInfo, "Database connection established")
 	}
 
+	// Initialize the API keys authenticator
+	if authenticator == nil {
+		authenticator = auth.NewAuthenticator(config.API.Auth, config.API.RateLimit, &dbHandler)
+	} else {
+		authenticator.Configure(config.API.Auth, config.API.RateLimit, &dbHandler)
+	}
+	if config.API.Auth.Enabled {
+		cmn.DebugMsg(cmn.DbgLvlInfo, "API keys authentication enabled")
+	}
+
 	return nil
 }
 
@@ -229,13 +241,15 @@ func initAPIv1() {
 	http.Handle("/v1/health", healthCheckWithMiddlewares)
 
 	// Query handlers
-	searchHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(searchHandler)))
-	scrImgSrchHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(scrImgSrchHandler)))
-	netInfoHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(netInfoHandler)))
-	httpInfoHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(httpInfoHandler)))
-	webObjectHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(webObjectHandler)))
-	webCorrelatedSitesHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(webCorrelatedSitesHandler)))
-	webScrapedDataHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(webScrapedDataHandler)))
+	searchHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(searchHandler))))
+	scrImgSrchHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(scrImgSrchHandler))))
+	netInfoHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(netInfoHandler))))
+	httpInfoHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(httpInfoHandler))))
+	webObjectHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(webObjectHandler))))
+	webCorrelatedSitesHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(webCorrelatedSitesHandler))))
+	webScrapedDataHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(webScrapedDataHandler))))
+	harHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(harHandler))))
+	technologiesHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeSearch, RateLimitMiddleware(http.HandlerFunc(technologiesHandler))))
 
 	http.Handle("/v1/search/general", searchHandlerWithMiddlewares)
 	http.Handle("/v1/search/netinfo", netInfoHandlerWithMiddlewares)
@@ -244,14 +258,16 @@ func initAPIv1() {
 	http.Handle("/v1/search/webobject", webObjectHandlerWithMiddlewares)
 	http.Handle("/v1/search/correlated_sites", webCorrelatedSitesHandlerWithMiddlewares)
 	http.Handle("/v1/search/collected_data", webScrapedDataHandlerWithMiddlewares)
+	http.Handle("/v1/search/har", harHandlerWithMiddlewares)
+	http.Handle("/v1/search/technologies", technologiesHandlerWithMiddlewares)
 
 	if config.API.EnableConsole {
-		addSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(addSourceHandler)))
-		removeSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(removeSourceHandler)))
-		updateSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(updateSourceHandler)))
-		vacuumSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(vacuumSourceHandler)))
-		singleURLstatusHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(singleURLstatusHandler)))
-		allURLstatusHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(allURLstatusHandler)))
+		addSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(addSourceHandler))))
+		removeSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(removeSourceHandler))))
+		updateSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(updateSourceHandler))))
+		vacuumSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(vacuumSourceHandler))))
+		singleURLstatusHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(singleURLstatusHandler))))
+		allURLstatusHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(allURLstatusHandler))))
 
 		http.Handle("/v1/source/add", addSourceHandlerWithMiddlewares)
 		http.Handle("/v1/source/remove", removeSourceHandlerWithMiddlewares)
@@ -261,21 +277,40 @@ func initAPIv1() {
 		http.Handle("/v1/source/statuses", allURLstatusHandlerWithMiddlewares)
 
 		// Owner endpoints
-		http.Handle("/v1/owner/add", SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(addOwnerHandler))))
-		http.Handle("/v1/owner/update", SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(updateOwnerHandler))))
-		http.Handle("/v1/owner/remove", SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(removeOwnerHandler))))
+		http.Handle("/v1/owner/add", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(addOwnerHandler)))))
+		http.Handle("/v1/owner/update", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(updateOwnerHandler)))))
+		http.Handle("/v1/owner/remove", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(removeOwnerHandler)))))
 
 		// Category endpoints
-		http.Handle("/v1/category/add", SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(addCategoryHandler))))
-		http.Handle("/v1/category/update", SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(updateCategoryHandler))))
-		http.Handle("/v1/category/remove", SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(removeCategoryHandler))))
+		http.Handle("/v1/category/add", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(addCategoryHandler)))))
+		http.Handle("/v1/category/update", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(updateCategoryHandler)))))
+		http.Handle("/v1/category/remove", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(removeCategoryHandler)))))
+	}
+
+	if config.API.Auth.Enabled {
+		// API keys management endpoints
+		http.Handle("/v1/apikey/create", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeAdmin, RateLimitMiddleware(http.HandlerFunc(createAPIKeyHandler)))))
+		http.Handle("/v1/apikey/list", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeAdmin, RateLimitMiddleware(http.HandlerFunc(listAPIKeysHandler)))))
+		http.Handle("/v1/apikey/revoke", SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeAdmin, RateLimitMiddleware(http.HandlerFunc(revokeAPIKeyHandler)))))
 	}
 }
 
-// RateLimitMiddleware is a middleware for rate limiting
+// AuthMiddleware is a middleware that requires an API key granting (at least)
+// the given scope (when authentication is enabled). Requests are rate limited
+// per client IP before the key is checked.
+func AuthMiddleware(scope string, next http.Handler) http.Handler {
+	return authenticator.ClientMiddleware(authenticator.Middleware(scope, next))
+}
+
+// RateLimitMiddleware is a middleware for rate limiting, requests carrying
+// an API key are limited per key, all the others share the global limiter
 func RateLimitMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !limiter.Allow() {
+		lmt := limiter
+		if key, ok := auth.KeyFromContext(r.Context()); ok {
+			lmt = authenticator.Limiter(key)
+		}
+		if !lmt.Allow() {
 			cmn.DebugMsg(cmn.DbgLvlDebug, errRateLimitExceed)
 			http.Error(w, errTooManyRequests, http.StatusTooManyRequests)
 			return
@@ -499,6 +534,108 @@ func webScrapedDataHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// harHandler handles the search requests for the HAR documents collected per page
+func harHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case dbSemaphore <- struct{}{}:
+		defer func() { <-dbSemaphore }()
+
+		successCode := http.StatusOK
+		query, err := extractQueryOrBody(r)
+		if err != nil {
+			handleErrorAndRespond(w, err, nil, "Missing parameter 'q' in har search request", http.StatusBadRequest, successCode)
+			return
+		}
+
+		results, err := performHARSearch(query, getQTypeFromName(r.Method), &dbHandler)
+		if results.IsEmpty() {
+			var retCode int
+			if config.API.Return404 {
+				retCode = http.StatusNotFound
+			} else {
+				retCode = successCode
+			}
+			handleErrorAndRespond(w, err, results, "Error performing har search: %v", http.StatusNotFound, retCode)
+		} else {
+			results.SetHeaderFields(
+				"har#search",
+				jsonResponse,
+				GetQueryTemplate("har", "v1", r.Method),
+				[]QueryRequest{
+					{
+						"search",
+						len(results.Items),
+						query,
+						len(results.Items),
+						results.Queries.Offset,
+						"utf8",
+						"utf8",
+						"off",
+						"0",
+					},
+				},
+			)
+			handleErrorAndRespond(w, err, results, "Error performing har search: %v", http.StatusInternalServerError, successCode)
+		}
+	case <-time.After(5 * time.Second): // Wait for a connection with timeout
+		healthStatus := HealthCheck{
+			Status: "DB is overloaded, please try again later",
+		}
+		handleErrorAndRespond(w, nil, healthStatus, "", http.StatusTooManyRequests, http.StatusTooManyRequests)
+	}
+}
+
+// technologiesHandler handles the search requests for the technologies detected on the pages (and their versions)
+func technologiesHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case dbSemaphore <- struct{}{}:
+		defer func() { <-dbSemaphore }()
+
+		successCode := http.StatusOK
+		query, err := extractQueryOrBody(r)
+		if err != nil {
+			handleErrorAndRespond(w, err, nil, "Missing parameter 'q' in technologies search request", http.StatusBadRequest, successCode)
+			return
+		}
+
+		results, err := performTechnologiesSearch(query, getQTypeFromName(r.Method), &dbHandler)
+		if results.IsEmpty() {
+			var retCode int
+			if config.API.Return404 {
+				retCode = http.StatusNotFound
+			} else {
+				retCode = successCode
+			}
+			handleErrorAndRespond(w, err, results, "Error performing technologies search: %v", http.StatusNotFound, retCode)
+		} else {
+			results.SetHeaderFields(
+				"technologies#search",
+				jsonResponse,
+				GetQueryTemplate("technologies", "v1", r.Method),
+				[]QueryRequest{
+					{
+						"search",
+						len(results.Items),
+						query,
+						len(results.Items),
+						results.Queries.Offset,
+						"utf8",
+						"utf8",
+						"off",
+						"0",
+					},
+				},
+			)
+			handleErrorAndRespond(w, err, results, "Error performing technologies search: %v", http.StatusInternalServerError, successCode)
+		}
+	case <-time.After(5 * time.Second): // Wait for a connection with timeout
+		healthStatus := HealthCheck{
+			Status: "DB is overloaded, please try again later",
+		}
+		handleErrorAndRespond(w, nil, healthStatus, "", http.StatusTooManyRequests, http.StatusTooManyRequests)
+	}
+}
+
 // scrImgSrchHandler handles the search requests for screenshot images
 func scrImgSrchHandler(w http.ResponseWriter, r *http.Request) {
 	select {
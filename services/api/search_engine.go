@@ -180,7 +180,7 @@ func isValidSpecifier(spec string) bool {
 		return true
 	}
 	//nolint:goconst
-	return spec == "title" || spec == "summary" || spec == "content" || spec == "details" || spec == "&details" || spec == "offset" || spec == "&offset" || spec == "limit" || spec == "&limit" || spec == "file_type"
+	return spec == "title" || spec == "summary" || spec == "content" || spec == "details" || spec == "&details" || spec == "offset" || spec == "&offset" || spec == "limit" || spec == "&limit" || spec == "file_type" || spec == "&mode"
 }
 
 // handleSpace appends the current token to the tokens slice.
@@ -386,6 +386,11 @@ func parseAdvancedQuery(queryBody string, input string, parsingType string) (Sea
 			skipNextToken = true
 			continue
 
+		case token.tValue == "&mode:":
+			// The search mode is handled by the caller (see searchMode)
+			skipNextToken = true
+			continue
+
 		case strings.HasPrefix(token.tValue, "&details.") || token.tValue == "&details:":
 			// Check if the next token is a number
 			if len(tokens) > i+1 {
@@ -516,6 +521,13 @@ func isLogicalOperator(op string) bool {
 }
 
 func performSearch(query string, db *cdb.Handler) (SearchResult, error) {
+	if searchMode(query, (*db).DBMS()) == searchModeFTS {
+		results, err := performFTSSearch(query, db)
+		if !errors.Is(err, errFTSUnsupported) {
+			return results, err
+		}
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Full-text search not supported for this query, falling back to LIKE search")
+	}
 	cmn.DebugMsg(cmn.DbgLvlDebug, searchLabel, query)
 
 	// Prepare the query body
@@ -527,9 +539,8 @@ func performSearch(query string, db *cdb.Handler) (SearchResult, error) {
 		FROM
 			SearchIndex si
 		LEFT JOIN
-			WebObjectsIndex woi ON si.index_id = woi.index_id
-		LEFT JOIN
-			WebObjects wo ON woi.object_id = wo.object_id
+			(WebObjectsIndex woi JOIN WebObjects wo ON woi.object_id = wo.object_id AND wo.object_type <> 'application/har+json')
+			ON si.index_id = woi.index_id
 		LEFT JOIN
 			KeywordIndex ki ON si.index_id = ki.index_id
 		LEFT JOIN
@@ -590,17 +601,16 @@ func performSearch(query string, db *cdb.Handler) (SearchResult, error) {
 		if err := rows.Scan(&title, &link, &summary, &snippet); err != nil {
 			return SearchResult{}, err
 		}
-		results.Items = append(results.Items, struct {
-			Title   string `json:"title"`
-			Link    string `json:"link"`
-			Summary string `json:"summary"`
-			Snippet string `json:"snippet"`
-		}{
+		item := SearchResultItem{
 			Title:   title,
 			Link:    link,
 			Summary: summary,
 			Snippet: snippet,
-		})
+		}
+		if config.API.ReturnContent {
+			item.Content = snippet
+		}
+		results.Items = append(results.Items, item)
 	}
 
 	// Calculate the query execution time
@@ -879,6 +889,7 @@ func parseWebObjectGetQuery(input string) (SearchQuery, error) {
 	WHERE
 		wo.object_link != ''
 		AND wo.object_link IS NOT NULL
+		AND wo.object_type <> 'application/har+json'
 		AND `
 
 	SQLQuery, err := parseAdvancedQuery(queryBody, input, "")
@@ -941,7 +952,9 @@ func parseWebObjectQuery(input string) (SearchQuery, error) {
 	WHERE
 		LOWER(si.page_url) LIKE LOWER($1)
 	AND
-		wo.object_link != '' AND wo.object_link IS NOT NULL;
+		wo.object_link != '' AND wo.object_link IS NOT NULL
+	AND
+		wo.object_type <> 'application/har+json';
 	`
 	sqlParams = append(sqlParams, query)
 
@@ -1040,7 +1053,7 @@ func parseScrapedDataGetQuery(input string) (SearchQuery, error) {
 	FROM
 		WebObjects AS sd
 	JOIN
-		WebObjectsIndex AS woi ON sd.object_id = woi.object_id
+		WebObjectsIndex AS woi ON sd.object_id = woi.object_id AND sd.object_type <> 'application/har+json'
 	JOIN
 		SearchIndex AS si ON woi.index_id = si.index_id
 	LEFT JOIN
@@ -1112,7 +1125,7 @@ func parseScrapedDataQuery(input string) (SearchQuery, error) {
 	FROM
 		WebObjects AS sd
 	JOIN
-		WebObjectsIndex AS woi ON sd.object_id = woi.object_id
+		WebObjectsIndex AS woi ON sd.object_id = woi.object_id AND sd.object_type <> 'application/har+json'
 	JOIN
 		SearchIndex AS si ON woi.index_id = si.index_id
 	LEFT JOIN
@@ -1146,6 +1159,332 @@ func parseScrapedDataQuery(input string) (SearchQuery, error) {
 	return SearchQuery{sqlQuery, sqlParams, 10, 0, Details{}}, nil
 }
 
+func performHARSearch(query string, qType int, db *cdb.Handler) (HARResponse, error) {
+	var err error
+	cmn.DebugMsg(cmn.DbgLvlDebug, searchLabel, query)
+
+	// Parse the user input
+	var SQLQuery SearchQuery
+	if qType == getQuery {
+		// it's a GET request, so we need to interpret the q parameter
+		SQLQuery, err = parseHARGetQuery(query)
+	} else {
+		// It's a POST request, so we can use the standard JSON parsing
+		SQLQuery, err = parseHARQuery(query)
+	}
+	if err != nil {
+		return HARResponse{}, err
+	}
+	sqlQuery := SQLQuery.sqlQuery
+	sqlParams := SQLQuery.sqlParams
+	cmn.DebugMsg(cmn.DbgLvlDebug1, sqlQueryLabel, sqlQuery)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, sqlQueryParamsLabel, sqlParams)
+
+	// Take current timer (to monitor query performance)
+	start := time.Now()
+
+	// Execute the query
+	rows, err := (*db).ExecuteQuery(sqlQuery, sqlParams...)
+	if err != nil {
+		return HARResponse{}, err
+	}
+	defer rows.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	// Calculate the query execution time
+	elapsed := time.Since(start)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, queryExecTime, elapsed)
+
+	// Take current timer (to monitor encapsulation performance)
+	start = time.Now()
+
+	// Iterate over the results
+	var results HARResponse
+	for rows.Next() {
+		var row HARRow
+		var harJSON string
+
+		if err := rows.Scan(&row.PageURL, &row.CreatedAt, &row.LastUpdatedAt, &harJSON); err != nil {
+			return HARResponse{}, err
+		}
+		if !json.Valid([]byte(harJSON)) {
+			cmn.DebugMsg(cmn.DbgLvlError, "invalid HAR document stored for %s", row.PageURL)
+			continue
+		}
+		row.HAR = json.RawMessage(harJSON)
+
+		// Append the row to the results
+		results.Items = append(results.Items, row)
+	}
+
+	// Calculate the query execution time
+	elapsed = time.Since(start)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, dataEncapTime, elapsed)
+
+	results.Queries.Limit = SQLQuery.limit
+	results.Queries.Offset = SQLQuery.offset
+
+	return results, nil
+}
+
+func parseHARGetQuery(input string) (SearchQuery, error) {
+	// Prepare the query body
+	queryBody := `
+	SELECT DISTINCT
+		si.page_url,
+		wo.created_at,
+		wo.last_updated_at,
+		wo.object_content
+	FROM
+		WebObjects AS wo
+	JOIN
+		WebObjectsIndex AS woi ON wo.object_id = woi.object_id AND wo.object_type = 'application/har+json'
+	JOIN
+		SearchIndex AS si ON woi.index_id = si.index_id
+	LEFT JOIN
+		KeywordIndex ki ON si.index_id = ki.index_id
+	LEFT JOIN
+		Keywords k ON ki.keyword_id = k.keyword_id
+	WHERE
+		`
+
+	SQLQuery, err := parseAdvancedQuery(queryBody, input, "")
+	if err != nil {
+		return SQLQuery, err
+	}
+	sqlQuery := SQLQuery.sqlQuery
+	sqlParams := SQLQuery.sqlParams
+
+	sqlQuery = sqlQuery + " ORDER BY wo.last_updated_at DESC"
+	limit := len(sqlParams) - 1
+	offset := len(sqlParams)
+	sqlQuery = sqlQuery + " LIMIT $" + strconv.Itoa(limit) + " OFFSET $" + strconv.Itoa(offset) + ";"
+
+	SQLQuery.sqlQuery = sqlQuery
+	SQLQuery.sqlParams = sqlParams
+
+	return SQLQuery, nil
+}
+
+func parseHARQuery(input string) (SearchQuery, error) {
+	input = PrepareInput(input)
+
+	// Unmarshal the JSON document
+	var req HARRequest
+	err := json.Unmarshal([]byte(input), &req)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "unmarshalling JSON: %v, %v", err, input)
+		return SearchQuery{}, err
+	}
+	if len(req.URL) == 0 {
+		return SearchQuery{}, errors.New(noQueryProvided)
+	}
+
+	limit := 10
+	if req.Limit > 0 {
+		limit = req.Limit
+	}
+	offset := 0
+	if req.Offset > 0 {
+		offset = req.Offset
+	}
+
+	sqlQuery := `
+	SELECT DISTINCT
+		si.page_url,
+		wo.created_at,
+		wo.last_updated_at,
+		wo.object_content
+	FROM
+		WebObjects AS wo
+	JOIN
+		WebObjectsIndex AS woi ON wo.object_id = woi.object_id
+	JOIN
+		SearchIndex AS si ON woi.index_id = si.index_id
+	WHERE
+		wo.object_type = 'application/har+json'
+		AND LOWER(si.page_url) LIKE LOWER($1)
+	ORDER BY wo.last_updated_at DESC
+	LIMIT $2 OFFSET $3;`
+	sqlParams := []interface{}{"%" + req.URL + "%", limit, offset}
+
+	return SearchQuery{sqlQuery, sqlParams, limit, offset, Details{}}, nil
+}
+
+func performTechnologiesSearch(query string, qType int, db *cdb.Handler) (TechnologiesResponse, error) {
+	var err error
+	cmn.DebugMsg(cmn.DbgLvlDebug, searchLabel, query)
+
+	// Parse the user input
+	var req TechnologiesRequest
+	if qType == getQuery {
+		// it's a GET request, so we need to interpret the q parameter
+		req, err = parseTechnologiesGetQuery(query)
+	} else {
+		// It's a POST request, so we can use the standard JSON parsing
+		req, err = parseTechnologiesQuery(query)
+	}
+	if err != nil {
+		return TechnologiesResponse{}, err
+	}
+	SQLQuery := buildTechnologiesQuery(req)
+	sqlQuery := SQLQuery.sqlQuery
+	sqlParams := SQLQuery.sqlParams
+	cmn.DebugMsg(cmn.DbgLvlDebug1, sqlQueryLabel, sqlQuery)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, sqlQueryParamsLabel, sqlParams)
+
+	// Take current timer (to monitor query performance)
+	start := time.Now()
+
+	// Execute the query
+	rows, err := (*db).ExecuteQuery(sqlQuery, sqlParams...)
+	if err != nil {
+		return TechnologiesResponse{}, err
+	}
+	defer rows.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	// Calculate the query execution time
+	elapsed := time.Since(start)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, queryExecTime, elapsed)
+
+	// Take current timer (to monitor encapsulation performance)
+	start = time.Now()
+
+	// Iterate over the results
+	var results TechnologiesResponse
+	skip := SQLQuery.offset
+	for rows.Next() {
+		var row TechnologyRow
+		var versionsJSON string
+
+		if err := rows.Scan(&row.PageURL, &row.Technology, &row.Version, &versionsJSON, &row.Confidence, &row.LastUpdatedAt); err != nil {
+			return TechnologiesResponse{}, err
+		}
+		if err := json.Unmarshal([]byte(versionsJSON), &row.Versions); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlDebug3, "invalid versions stored for %s on %s: %v", row.Technology, row.PageURL, err)
+		}
+
+		// Versions are compared semantically, so the version constraint
+		// (and then the pagination) is applied here
+		if req.Version != "" {
+			if !cmn.MatchVersionConstraint(row.Version, req.Version) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+		}
+
+		// Append the row to the results
+		results.Items = append(results.Items, row)
+		if req.Version != "" && len(results.Items) >= SQLQuery.limit {
+			break
+		}
+	}
+
+	// Calculate the query execution time
+	elapsed = time.Since(start)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, dataEncapTime, elapsed)
+
+	results.Queries.Limit = SQLQuery.limit
+	results.Queries.Offset = SQLQuery.offset
+
+	return results, nil
+}
+
+// parseTechnologiesGetQuery parses the q parameter of a technologies search,
+// which is the technology name followed by the &version:, &url:, &limit: and
+// &offset: options (e.g. "wordpress&version:<6.4.3")
+func parseTechnologiesGetQuery(input string) (TechnologiesRequest, error) {
+	var req TechnologiesRequest
+	parts := strings.Split(input, "&")
+	req.Technology = strings.TrimSpace(parts[0])
+	for _, part := range parts[1:] {
+		name, value, found := strings.Cut(part, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "version":
+			req.Version = value
+		case "url":
+			req.URL = value
+		case "limit":
+			req.Limit, _ = strconv.Atoi(value)
+		case "offset":
+			req.Offset, _ = strconv.Atoi(value)
+		}
+	}
+	if req.Technology == "" {
+		return TechnologiesRequest{}, errors.New(noQueryProvided)
+	}
+	return req, nil
+}
+
+func parseTechnologiesQuery(input string) (TechnologiesRequest, error) {
+	input = PrepareInput(input)
+
+	// Unmarshal the JSON document
+	var req TechnologiesRequest
+	err := json.Unmarshal([]byte(input), &req)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "unmarshalling JSON: %v, %v", err, input)
+		return TechnologiesRequest{}, err
+	}
+	req.Technology = strings.TrimSpace(req.Technology)
+	if req.Technology == "" {
+		return TechnologiesRequest{}, errors.New(noQueryProvided)
+	}
+	return req, nil
+}
+
+// buildTechnologiesQuery returns the SQL query of a technologies search.
+// The technology name can use "*" as a wildcard. When a version constraint
+// is requested the pagination is left to performTechnologiesSearch.
+func buildTechnologiesQuery(req TechnologiesRequest) SearchQuery {
+	limit := 10
+	if req.Limit > 0 {
+		limit = req.Limit
+	}
+	offset := 0
+	if req.Offset > 0 {
+		offset = req.Offset
+	}
+
+	sqlQuery := `
+	SELECT DISTINCT
+		si.page_url,
+		t.key,
+		COALESCE(t.value->>'version', ''),
+		COALESCE(t.value->'versions', '[]'::jsonb)::text,
+		COALESCE((t.value->>'confidence')::numeric, 0),
+		wo.last_updated_at
+	FROM
+		WebObjects AS wo
+	JOIN
+		WebObjectsIndex AS woi ON wo.object_id = woi.object_id
+	JOIN
+		SearchIndex AS si ON woi.index_id = si.index_id
+	CROSS JOIN LATERAL
+		jsonb_each(COALESCE(wo.details->'detected_tech', '{}'::jsonb)) AS t(key, value)
+	WHERE
+		LOWER(t.key) LIKE LOWER($1)`
+	sqlParams := []interface{}{strings.ReplaceAll(req.Technology, "*", "%")}
+	if req.URL != "" {
+		sqlParams = append(sqlParams, "%"+req.URL+"%")
+		sqlQuery += "\n\t\tAND LOWER(si.page_url) LIKE LOWER($" + strconv.Itoa(len(sqlParams)) + ")"
+	}
+	sqlQuery += "\n\tORDER BY wo.last_updated_at DESC"
+	if req.Version == "" {
+		sqlParams = append(sqlParams, limit, offset)
+		sqlQuery += "\n\tLIMIT $" + strconv.Itoa(len(sqlParams)-1) + " OFFSET $" + strconv.Itoa(len(sqlParams))
+	}
+	sqlQuery += ";"
+
+	return SearchQuery{sqlQuery, sqlParams, limit, offset, Details{}}
+}
+
 func performCorrelatedSitesSearch(query string, qType int, db *cdb.Handler) (CorrelatedSitesResponse, error) {
 	var err error
 	cmn.DebugMsg(cmn.DbgLvlDebug, searchLabel, query)
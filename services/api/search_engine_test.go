@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -254,3 +256,194 @@ func TestParseAdvancedQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestParseHARQuery(t *testing.T) {
+	SQLQuery, err := parseHARQuery(`{"url":"example.com","limit":5,"offset":10}`)
+	if err != nil {
+		t.Fatalf("parseHARQuery() returned an error: %v", err)
+	}
+	want := []interface{}{"%example.com%", 5, 10}
+	if !reflect.DeepEqual(SQLQuery.sqlParams, want) {
+		t.Errorf("parseHARQuery() params = %v, want %v", SQLQuery.sqlParams, want)
+	}
+	if SQLQuery.limit != 5 || SQLQuery.offset != 10 {
+		t.Errorf("parseHARQuery() limit = %d, offset = %d, want 5, 10", SQLQuery.limit, SQLQuery.offset)
+	}
+
+	if _, err := parseHARQuery(`{"url":""}`); err == nil {
+		t.Errorf("expected an error for an empty URL")
+	}
+}
+
+func TestParseWebObjectQueryExcludesHAR(t *testing.T) {
+	getQuery, err := parseWebObjectGetQuery("example")
+	if err != nil {
+		t.Fatalf("parseWebObjectGetQuery() returned an error: %v", err)
+	}
+	postQuery, err := parseWebObjectQuery(`{"url":"example.com"}`)
+	if err != nil {
+		t.Fatalf("parseWebObjectQuery() returned an error: %v", err)
+	}
+	for _, query := range []string{getQuery.sqlQuery, postQuery.sqlQuery} {
+		if !strings.Contains(query, "wo.object_type <> 'application/har+json'") {
+			t.Errorf("the HAR documents aren't excluded from the query:\n%s", query)
+		}
+	}
+}
+
+func TestParseTechnologiesGetQuery(t *testing.T) {
+	req, err := parseTechnologiesGetQuery("WordPress&version:<6.4.3&limit:5&offset:10")
+	if err != nil {
+		t.Fatalf("parseTechnologiesGetQuery() returned an error: %v", err)
+	}
+	want := TechnologiesRequest{Technology: "WordPress", Version: "<6.4.3", Limit: 5, Offset: 10}
+	if req != want {
+		t.Errorf("parseTechnologiesGetQuery() = %+v, want %+v", req, want)
+	}
+
+	if _, err := parseTechnologiesGetQuery("&version:6.4"); err == nil {
+		t.Errorf("expected an error for an empty technology")
+	}
+}
+
+func TestBuildTechnologiesQuery(t *testing.T) {
+	req, err := parseTechnologiesQuery(`{"technology":"word*","url":"example.com","limit":5,"offset":10}`)
+	if err != nil {
+		t.Fatalf("parseTechnologiesQuery() returned an error: %v", err)
+	}
+	SQLQuery := buildTechnologiesQuery(req)
+	want := []interface{}{"word%", "%example.com%", 5, 10}
+	if !reflect.DeepEqual(SQLQuery.sqlParams, want) {
+		t.Errorf("buildTechnologiesQuery() params = %v, want %v", SQLQuery.sqlParams, want)
+	}
+	if !strings.Contains(SQLQuery.sqlQuery, "LIMIT $3 OFFSET $4") {
+		t.Errorf("buildTechnologiesQuery() query = %s, want LIMIT $3 OFFSET $4", SQLQuery.sqlQuery)
+	}
+
+	// With a version constraint the pagination is done after the version filtering
+	req.Version = "<6.4.3"
+	SQLQuery = buildTechnologiesQuery(req)
+	if strings.Contains(SQLQuery.sqlQuery, "LIMIT") || len(SQLQuery.sqlParams) != 2 {
+		t.Errorf("buildTechnologiesQuery() with a version = %s %v, want no LIMIT", SQLQuery.sqlQuery, SQLQuery.sqlParams)
+	}
+	if SQLQuery.limit != 5 || SQLQuery.offset != 10 {
+		t.Errorf("buildTechnologiesQuery() limit = %d, offset = %d, want 5, 10", SQLQuery.limit, SQLQuery.offset)
+	}
+
+	if _, err := parseTechnologiesQuery(`{"technology":" "}`); err == nil {
+		t.Errorf("expected an error for an empty technology")
+	}
+}
+
+func TestSearchMode(t *testing.T) {
+	config.API.SearchMode = ""
+	defer func() { config.API.SearchMode = "" }()
+
+	tests := []struct {
+		input, dbms, configured, want string
+	}{
+		{"test", "postgres", "", searchModeLike},
+		{"test", "postgres", "fts", searchModeFTS},
+		{"test", "postgres", "like", searchModeLike},
+		{"test &mode:like", "postgres", "", searchModeLike},
+		{"test &mode:fts", "postgres", "like", searchModeFTS},
+		{"test &mode:fts", "sqlite", "", searchModeLike},
+		{"test", "mysql", "fts", searchModeLike},
+	}
+	for _, tt := range tests {
+		config.API.SearchMode = tt.configured
+		if got := searchMode(tt.input, tt.dbms); got != tt.want {
+			t.Errorf("searchMode(%q, %q) with %q configured = %q, want %q", tt.input, tt.dbms, tt.configured, got, tt.want)
+		}
+	}
+}
+
+func TestParseFTSQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		contains []string
+		params   []interface{}
+		wantErr  error
+	}{
+		{
+			name:     "plain words",
+			input:    "crowler engine",
+			contains: []string{"websearch_to_tsquery('english', $1)", "websearch_to_tsquery('english', $2)", "ORDER BY score DESC", "LIMIT $3 OFFSET $4"},
+			params:   []interface{}{"crowler", "engine", 10, 0},
+		},
+		{
+			name:     "phrase and prefix",
+			input:    `"web crawler" craw* &limit:5`,
+			contains: []string{"phraseto_tsquery('english', $1)", "to_tsquery('english', $2)", "ts_headline("},
+			params:   []interface{}{"web crawler", "craw:*", 5, 0},
+		},
+		{
+			name:     "or and negation",
+			input:    "go || rust -java",
+			contains: []string{") OR (", "NOT (numnode(websearch_to_tsquery('english', $3))"},
+			params:   []interface{}{"go", "rust", "java", 10, 0},
+		},
+		{
+			name:     "domains also match the URL",
+			input:    "example.com",
+			contains: []string{"LOWER(si.page_url) LIKE $2"},
+			params:   []interface{}{"example.com", "%example.com%", 10, 0},
+		},
+		{
+			name:    "JSON fields are not supported",
+			input:   "@title:test",
+			wantErr: errFTSUnsupported,
+		},
+		{
+			name:    "title and summary fields are not supported",
+			input:   "crowler summary:engine",
+			wantErr: errFTSUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SQLQuery, err := parseFTSQuery(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseFTSQuery() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFTSQuery() returned an error: %v", err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(SQLQuery.sqlQuery, s) {
+					t.Errorf("parseFTSQuery() query doesn't contain %q:\n%s", s, SQLQuery.sqlQuery)
+				}
+			}
+			if !reflect.DeepEqual(SQLQuery.sqlParams, tt.params) {
+				t.Errorf("parseFTSQuery() params = %v, want %v", SQLQuery.sqlParams, tt.params)
+			}
+		})
+	}
+}
+
+func TestParseFTSQueryContent(t *testing.T) {
+	config.API.ContentSearch = true
+	config.API.ReturnContent = true
+	defer func() {
+		config.API.ContentSearch = false
+		config.API.ReturnContent = false
+	}()
+
+	SQLQuery, err := parseFTSQuery("content:crowler")
+	if err != nil {
+		t.Fatalf("parseFTSQuery() returned an error: %v", err)
+	}
+	for _, s := range []string{"COALESCE(wo.object_content, '') AS content", "wo.object_content_fts @@ websearch_to_tsquery('english', $1)"} {
+		if !strings.Contains(SQLQuery.sqlQuery, s) {
+			t.Errorf("parseFTSQuery() query doesn't contain %q:\n%s", s, SQLQuery.sqlQuery)
+		}
+	}
+	if strings.Contains(SQLQuery.sqlQuery, "si.tsv @@") {
+		t.Errorf("parseFTSQuery() matches a content: term against the SearchIndex tsvector:\n%s", SQLQuery.sqlQuery)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (API) implements the API server for the Crowler search engine.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+const (
+	searchModeFTS  = "fts"
+	searchModeLike = "like"
+
+	// ftsLanguage is the text search configuration used by the tsvector triggers
+	ftsLanguage = "english"
+	// ftsHeadlineOptions are the ts_headline options used to generate the snippets
+	ftsHeadlineOptions = "StartSel=<b>, StopSel=</b>, MaxWords=35, MinWords=15, MaxFragments=2"
+)
+
+// errFTSUnsupported is returned when a query uses features the full-text
+// search doesn't support (for ex. JSON field specifiers or the title: and
+// summary: fields, which share the SearchIndex tsvector)
+var errFTSUnsupported = errors.New("query not supported by the full-text search")
+
+// searchMode returns the mode to use for a general search: the one requested
+// in the query (&mode:fts or &mode:like) or the configured one. LIKE is the
+// default, the full-text search must be requested and is only available on
+// PostgreSQL (every other DBMS uses LIKE).
+func searchMode(input, dbms string) string {
+	if dbms != cdb.DBPostgresStr {
+		return searchModeLike
+	}
+	mode := config.API.SearchMode
+	tokens := tokenize(input)
+	for i, t := range tokens {
+		if t.tValue == "&mode:" && i+1 < len(tokens) {
+			mode = strings.ToLower(strings.TrimSpace(tokens[i+1].tValue))
+		}
+	}
+	if mode == searchModeFTS {
+		return searchModeFTS
+	}
+	return searchModeLike
+}
+
+// ftsTerm is a single search term of a full-text query
+type ftsTerm struct {
+	condition string // SQL condition matching the term
+	tsquery   string // SQL tsquery expression of the term (used for ranking)
+	negated   bool
+}
+
+// parseFTSQuery compiles the "dorking" query language into a ranked
+// full-text search on the SearchIndex.tsv (and, if content search is
+// enabled, WebObjects.object_content_fts) columns.
+// Terms are ANDed by default, "|" and "||" OR them, "-term" excludes a term,
+// "term*" is a prefix query and "quoted text" a phrase query.
+func parseFTSQuery(input string) (SearchQuery, error) {
+	tokens := tokenize(input)
+
+	var params []interface{}
+	addParam := func(value interface{}) string {
+		params = append(params, value)
+		return "$" + strconv.Itoa(len(params))
+	}
+
+	limit := 10
+	offset := 0
+	currentField := ""
+	useContent := config.API.ContentSearch || config.API.ReturnContent
+	var groups [][]ftsTerm // OR-ed groups of AND-ed terms
+	newGroup := true
+
+	for i := 0; i < len(tokens); i++ {
+		tValue := tokens[i].tValue
+		switch {
+		case strings.TrimSpace(tValue) == "":
+			continue
+
+		case tValue == "&limit:" || tValue == "&offset:":
+			if i+1 < len(tokens) {
+				n, err := strconv.Atoi(tokens[i+1].tValue)
+				if err != nil {
+					return SearchQuery{}, fmt.Errorf("invalid %s value", strings.Trim(tValue, "&:"))
+				}
+				if tValue == "&limit:" {
+					limit = n
+				} else {
+					offset = n
+				}
+			}
+			i++
+
+		case tValue == "&mode:" || tValue == "&details:" || strings.HasPrefix(tValue, "&details."):
+			i++
+
+		case strings.HasPrefix(tValue, "@"):
+			return SearchQuery{}, errFTSUnsupported
+
+		case isFieldSpecifier(tValue):
+			currentField = strings.ToLower(strings.TrimSuffix(tValue, ":"))
+			if currentField != "content" {
+				return SearchQuery{}, errFTSUnsupported
+			}
+			useContent = true
+
+		case tValue == ";" || tValue == "&" || tValue == "&&":
+			// AND is the default operator
+
+		case tValue == "|" || tValue == "||":
+			newGroup = true
+
+		default:
+			term, ok := compileFTSTerm(tValue, currentField, addParam)
+			if !ok {
+				continue
+			}
+			if newGroup || len(groups) == 0 {
+				groups = append(groups, []ftsTerm{})
+				newGroup = false
+			}
+			groups[len(groups)-1] = append(groups[len(groups)-1], term)
+		}
+	}
+
+	// Build the WHERE condition and the ranking tsquery
+	var orConditions []string
+	var rankQueries []string
+	for _, group := range groups {
+		var andConditions []string
+		for _, term := range group {
+			if term.negated {
+				andConditions = append(andConditions, "NOT "+term.condition)
+				continue
+			}
+			andConditions = append(andConditions, term.condition)
+			rankQueries = append(rankQueries, term.tsquery)
+		}
+		if len(andConditions) > 0 {
+			orConditions = append(orConditions, "("+strings.Join(andConditions, " AND ")+")")
+		}
+	}
+	if len(orConditions) == 0 {
+		return SearchQuery{}, errors.New("no valid query provided")
+	}
+	rankQuery := "''::tsquery"
+	if len(rankQueries) > 0 {
+		rankQuery = strings.Join(rankQueries, " || ")
+	}
+
+	// Build the SQL query
+	score := "ts_rank_cd(COALESCE(si.tsv, ''::tsvector), q.query)"
+	content := "''"
+	snippetSource := "COALESCE(si.title, '') || ' ' || COALESCE(si.summary, '')"
+	latestObject := ""
+	if useContent {
+		latestObject = `
+		LEFT JOIN LATERAL (
+			SELECT o.object_content, o.object_content_fts
+			FROM WebObjectsIndex woi
+			JOIN WebObjects o ON o.object_id = woi.object_id
+			WHERE woi.index_id = si.index_id
+			  AND o.object_type <> 'application/har+json'
+			ORDER BY woi.created_at DESC
+			LIMIT 1
+		) wo ON true`
+		score += " + ts_rank_cd(COALESCE(wo.object_content_fts, ''::tsvector), q.query)"
+	}
+	if config.API.ReturnContent {
+		content = "COALESCE(wo.object_content, '')"
+		snippetSource = content
+	}
+	snippet := fmt.Sprintf("ts_headline('%s', %s, q.query, '%s')", ftsLanguage, snippetSource, ftsHeadlineOptions)
+	if len(rankQueries) == 0 {
+		// Nothing to highlight (only negated terms)
+		snippet = "COALESCE(si.summary, '')"
+	}
+
+	sqlQuery := `
+		WITH q AS (SELECT ` + rankQuery + ` AS query)
+		SELECT
+			COALESCE(si.title, ''), si.page_url, COALESCE(si.summary, ''), ` + content + ` AS content,
+			` + snippet + ` AS snippet,
+			` + score + ` AS score
+		FROM
+			SearchIndex si
+		CROSS JOIN
+			q` + latestObject + `
+		WHERE
+			` + strings.Join(orConditions, " OR ") + `
+		ORDER BY score DESC, si.last_updated_at DESC
+		LIMIT ` + addParam(limit) + ` OFFSET ` + addParam(offset) + `;`
+
+	return SearchQuery{sqlQuery, params, limit, offset, Details{}}, nil
+}
+
+// compileFTSTerm returns the condition and the tsquery of a single search term
+func compileFTSTerm(value, field string, addParam func(interface{}) string) (ftsTerm, bool) {
+	var term ftsTerm
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-") && len(value) > 1 {
+		term.negated = true
+		value = value[1:]
+	}
+	if value == "" {
+		return term, false
+	}
+
+	switch {
+	case strings.HasSuffix(value, "*"):
+		// Prefix query
+		lexeme := strings.ToLower(strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, value))
+		if lexeme == "" {
+			return term, false
+		}
+		term.tsquery = fmt.Sprintf("to_tsquery('%s', %s)", ftsLanguage, addParam(lexeme+":*"))
+	case strings.ContainsFunc(value, unicode.IsSpace):
+		// Phrase query
+		term.tsquery = fmt.Sprintf("phraseto_tsquery('%s', %s)", ftsLanguage, addParam(value))
+	default:
+		term.tsquery = fmt.Sprintf("websearch_to_tsquery('%s', %s)", ftsLanguage, addParam(value))
+	}
+
+	var matches []string
+	if field == "" {
+		matches = append(matches, "si.tsv @@ "+term.tsquery)
+	}
+	if field == "content" || (field == "" && config.API.ContentSearch) {
+		matches = append(matches, "wo.object_content_fts @@ "+term.tsquery)
+	}
+	if field == "" && strings.ContainsAny(value, "./") {
+		// URLs and domains are not split in words by the text parser, so
+		// also match them as part of the page URL
+		matches = append(matches, "LOWER(si.page_url) LIKE "+addParam("%"+strings.ToLower(value)+"%"))
+	}
+	// Stop words compile to an empty tsquery, which would match nothing, so ignore them
+	term.condition = fmt.Sprintf("(numnode(%s) = 0 OR %s)", term.tsquery, strings.Join(matches, " OR "))
+	return term, true
+}
+
+func performFTSSearch(query string, db *cdb.Handler) (SearchResult, error) {
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Performing full-text search for: %s", query)
+
+	SQLQuery, err := parseFTSQuery(query)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug1, sqlQueryLabel, SQLQuery.sqlQuery)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, sqlQueryParamsLabel, SQLQuery.sqlParams)
+
+	// Take the current timer (to monitor query performance)
+	start := time.Now()
+
+	// Execute the query
+	rows, err := (*db).ExecuteQuery(SQLQuery.sqlQuery, SQLQuery.sqlParams...)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	defer rows.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	// Calculate the query execution time
+	elapsed := time.Since(start)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, queryExecTime, elapsed)
+
+	// Take the current timer (to monitor encapsulation performance)
+	start = time.Now()
+
+	// Iterate over the results
+	var results SearchResult
+	for rows.Next() {
+		var item SearchResultItem
+		if err := rows.Scan(&item.Title, &item.Link, &item.Summary, &item.Content, &item.Snippet, &item.Score); err != nil {
+			return SearchResult{}, err
+		}
+		results.Items = append(results.Items, item)
+	}
+
+	// Calculate the query execution time
+	elapsed = time.Since(start)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, dataEncapTime, elapsed)
+
+	results.Queries.Limit = SQLQuery.limit
+	results.Queries.Offset = SQLQuery.offset
+	return results, rows.Err()
+}
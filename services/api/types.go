@@ -20,9 +20,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 	crawler "github.com/pzaino/thecrowler/pkg/crawler"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
 	httpi "github.com/pzaino/thecrowler/pkg/httpinfo"
 	neti "github.com/pzaino/thecrowler/pkg/netinfo"
 )
@@ -37,6 +39,33 @@ type ConsoleResponse struct {
 	Message string `json:"message" yaml:"message"`
 }
 
+// APIKeyRequest represents the structure of the create API key request POST
+type APIKeyRequest struct {
+	Name      string     `json:"name"`                 // A name to identify the key
+	Scope     string     `json:"scope"`                // search (default), console or admin
+	RateLimit string     `json:"rate_limit,omitempty"` // Per-key rate limit (for ex. "10,10")
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When the key expires (RFC 3339)
+}
+
+// APIKeyRevokeRequest represents the structure of the revoke API key request POST
+type APIKeyRevokeRequest struct {
+	KeyID uint64 `json:"key_id"`
+}
+
+// APIKeyResponse represents the structure of the create API key response
+// (the only time the key itself is returned)
+type APIKeyResponse struct {
+	Message string     `json:"message"`
+	Key     string     `json:"key,omitempty"`
+	Item    cdb.APIKey `json:"item"`
+}
+
+// APIKeyListResponse represents the structure of the list API keys response
+type APIKeyListResponse struct {
+	Message string       `json:"message"`
+	Items   []cdb.APIKey `json:"items"`
+}
+
 // StatusResponse represents the structure of the status response
 type StatusResponse struct {
 	Message string              `json:"message"`
@@ -87,12 +116,17 @@ type SearchResult struct {
 		Limit    int            `json:"limit"`    // Limit of results
 		Offset   int            `json:"offset"`   // Offset of results
 	} `json:"queries"`
-	Items []struct {
-		Title   string `json:"title"`   // Title of the page
-		Link    string `json:"link"`    // URL of the page
-		Summary string `json:"summary"` // Summary of the page
-		Snippet string `json:"snippet"` // Snippet of the page
-	} `json:"items"` // List of results
+	Items []SearchResultItem `json:"items"` // List of results
+}
+
+// SearchResultItem represents a single result of the general search
+type SearchResultItem struct {
+	Title   string  `json:"title"`             // Title of the page
+	Link    string  `json:"link"`              // URL of the page
+	Summary string  `json:"summary"`           // Summary of the page
+	Snippet string  `json:"snippet"`           // Snippet of the page (highlighted in fts mode)
+	Content string  `json:"content,omitempty"` // Content of the page (if return_content is enabled)
+	Score   float64 `json:"score,omitempty"`   // Relevance score of the page (fts mode only)
 }
 
 // APIResponse represents a closer approximation to the Google Search API response structure.
@@ -326,6 +360,98 @@ func (r *ScrapedDataResponse) SetHeaderFields(kind, urlType, urlTemplate string,
 	r.Queries.Request = requests
 }
 
+// HARRequest represents the structure of the HAR request POST
+type HARRequest struct {
+	URL    string `json:"url"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+}
+
+// HARResponse represents the structure of the HAR response
+type HARResponse struct {
+	Kind string `json:"kind"` // Identifier of the API's service
+	URL  struct {
+		Type     string `json:"type"`     // Type of the request (e.g., "application/json")
+		Template string `json:"template"` // URL template for requests
+	} `json:"url"`
+	Queries struct {
+		Request  []QueryRequest `json:"request"`  // The request that was made
+		NextPage []QueryRequest `json:"nextPage"` // Information for the next page of results
+		Limit    int            `json:"limit"`    // Limit of results
+		Offset   int            `json:"offset"`   // Offset of results
+	} `json:"queries"`
+	Items []HARRow `json:"items"`
+}
+
+// HARRow represents a single HAR document in the HAR response
+type HARRow struct {
+	PageURL       string          `json:"page_url"`
+	CreatedAt     string          `json:"created_at"`
+	LastUpdatedAt string          `json:"last_updated_at"`
+	HAR           json.RawMessage `json:"har"`
+}
+
+// IsEmpty returns true if the response is empty
+func (r *HARResponse) IsEmpty() bool {
+	return len(r.Items) == 0
+}
+
+// SetHeaderFields sets the header fields of the response
+func (r *HARResponse) SetHeaderFields(kind, urlType, urlTemplate string, requests []QueryRequest) {
+	r.Kind = kind
+	r.URL.Type = urlType
+	r.URL.Template = urlTemplate
+	r.Queries.Request = requests
+}
+
+// TechnologiesRequest represents the structure of the technologies request POST
+type TechnologiesRequest struct {
+	Technology string `json:"technology"`        // Technology name ("*" is a wildcard)
+	Version    string `json:"version,omitempty"` // Version constraint (e.g. "6.4", "<6.4.3" or ">=5.0,<6")
+	URL        string `json:"url,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+}
+
+// TechnologiesResponse represents the structure of the technologies response
+type TechnologiesResponse struct {
+	Kind string `json:"kind"` // Identifier of the API's service
+	URL  struct {
+		Type     string `json:"type"`     // Type of the request (e.g., "application/json")
+		Template string `json:"template"` // URL template for requests
+	} `json:"url"`
+	Queries struct {
+		Request  []QueryRequest `json:"request"`  // The request that was made
+		NextPage []QueryRequest `json:"nextPage"` // Information for the next page of results
+		Limit    int            `json:"limit"`    // Limit of results
+		Offset   int            `json:"offset"`   // Offset of results
+	} `json:"queries"`
+	Items []TechnologyRow `json:"items"`
+}
+
+// TechnologyRow represents a technology detected on a page in the technologies response
+type TechnologyRow struct {
+	PageURL       string   `json:"page_url"`
+	Technology    string   `json:"technology"`
+	Version       string   `json:"version,omitempty"`
+	Versions      []string `json:"versions,omitempty"`
+	Confidence    float64  `json:"confidence"`
+	LastUpdatedAt string   `json:"last_updated_at"`
+}
+
+// IsEmpty returns true if the response is empty
+func (r *TechnologiesResponse) IsEmpty() bool {
+	return len(r.Items) == 0
+}
+
+// SetHeaderFields sets the header fields of the response
+func (r *TechnologiesResponse) SetHeaderFields(kind, urlType, urlTemplate string, requests []QueryRequest) {
+	r.Kind = kind
+	r.URL.Type = urlType
+	r.URL.Template = urlTemplate
+	r.Queries.Request = requests
+}
+
 // SearchResponse is an interface that defines the methods that
 // a search response should implement.
 type SearchResponse interface {
@@ -0,0 +1,154 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (events) implements the CROWler Events Handler engine.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	agt "github.com/pzaino/thecrowler/pkg/agent"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+const (
+	// agentSchedulerMaxWait is the maximum time between two checks of the
+	// scheduled agents (so new and reloaded agents are picked up)
+	agentSchedulerMaxWait = time.Minute
+	// agentSchedulerMinWait avoids busy loops when a run is claimed by
+	// another events service
+	agentSchedulerMinWait = time.Second
+	// maxAgentRunRequestSize is the maximum size of a manual agent run request
+	maxAgentRunRequestSize = 1 << 20
+)
+
+// startAgentScheduler runs the scheduled agents (trigger_type "schedule").
+// The schedules are stored in the EventSchedules table, so missed runs are
+// executed (once) at startup and multiple events services sharing the same
+// database don't run the same agent twice.
+func startAgentScheduler() {
+	for {
+		time.Sleep(runScheduledAgents(time.Now()))
+	}
+}
+
+// runScheduledAgents starts the scheduled agents due at now and returns how
+// long to wait before the next check
+func runScheduledAgents(now time.Time) time.Duration {
+	wait := agentSchedulerMaxWait
+	agents, _ := agt.AgentsRegistry.GetAgentsByTriggerType(agt.TriggerSchedule)
+	for _, ac := range agents {
+		job := ac.Jobs[0]
+		nextRun, err := job.NextRun(now)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "Failed to schedule agent '%s': %v", job.Name, err)
+			continue
+		}
+
+		schedule, err := cdb.SyncAgentSchedule(&dbHandler, strings.TrimSpace(job.Name), strings.TrimSpace(job.TriggerName), nextRun)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "%v", err)
+			continue
+		}
+		if !schedule.Active {
+			continue
+		}
+
+		if !schedule.NextRun.After(now) {
+			due := schedule.NextRun
+			claimed, err := cdb.ClaimAgentScheduleRun(&dbHandler, schedule, nextRun)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "%v", err)
+			}
+			if claimed {
+				cmn.DebugMsg(cmn.DbgLvlInfo, "Running scheduled agent '%s'", job.Name)
+				// Scheduled agents have no event, their first step gets the schedule as input
+				iCfg := newAgentsConfig()
+				iCfg[agt.StrRequest] = map[string]interface{}{
+					"schedule":     schedule.Schedule,
+					"scheduled_at": due.Format(time.RFC3339),
+				}
+				go runAgent(ac, iCfg)
+			}
+		}
+
+		if d := schedule.NextRun.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < agentSchedulerMinWait {
+		wait = agentSchedulerMinWait
+	}
+	return wait
+}
+
+// newAgentsConfig returns the base configuration passed to the agents
+// that are not triggered by an event
+func newAgentsConfig() map[string]interface{} {
+	iCfg := make(map[string]interface{})
+	iCfg["vdi_hook"] = nil
+	iCfg["db_handler"] = dbHandler
+	iCfg["plugins_register"] = PluginRegister
+	iCfg["meta_data"] = make(map[string]interface{})
+	return iCfg
+}
+
+// runAgent executes an agent and logs its errors (the run itself is
+// recorded in the agents run history)
+func runAgent(ac *agt.JobConfig, iCfg map[string]interface{}) {
+	if err := agt.AgentsEngine.ExecuteJobs(ac, iCfg); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Failed to execute agent '%s': %v", ac.Jobs[0].Name, err)
+	}
+}
+
+// Handler to run a manual agent (trigger_type "manual"), the agent runs
+// asynchronously and its result can be retrieved via /v1/agent/runs
+func runAgentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleErrorAndRespond(w, errors.New("Invalid request method"), nil, "Invalid request method", http.StatusMethodNotAllowed, http.StatusOK)
+		return
+	}
+
+	var req AgentRunRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAgentRunRequestSize)).Decode(&req); err != nil {
+		handleErrorAndRespond(w, err, nil, "Invalid request body: ", http.StatusBadRequest, http.StatusOK)
+		return
+	}
+	if strings.TrimSpace(req.Agent) == "" {
+		handleErrorAndRespond(w, errors.New("missing agent name"), nil, "Invalid request body: ", http.StatusBadRequest, http.StatusOK)
+		return
+	}
+
+	ac, exists := agt.AgentsRegistry.GetManualAgent(req.Agent)
+	if !exists {
+		handleErrorAndRespond(w, fmt.Errorf("manual agent '%s' not found", req.Agent), nil, "Agent not found: ", http.StatusNotFound, http.StatusOK)
+		return
+	}
+
+	iCfg := newAgentsConfig()
+	if req.Input == nil {
+		req.Input = make(map[string]interface{})
+	}
+	iCfg[agt.StrRequest] = req.Input
+	go runAgent(ac, iCfg)
+
+	response := map[string]string{"message": "Agent started successfully", "agent": ac.Jobs[0].Name}
+	handleErrorAndRespond(w, nil, response, "Error running agent: ", http.StatusInternalServerError, http.StatusAccepted)
+}
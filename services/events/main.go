@@ -23,10 +23,12 @@ import (
 	"gopkg.in/yaml.v2"
 
 	agt "github.com/pzaino/thecrowler/pkg/agent"
+	auth "github.com/pzaino/thecrowler/pkg/auth"
 	cmn "github.com/pzaino/thecrowler/pkg/common"
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 	cdb "github.com/pzaino/thecrowler/pkg/database"
 	plg "github.com/pzaino/thecrowler/pkg/plugin"
+	reload "github.com/pzaino/thecrowler/pkg/reload"
 )
 
 const (
@@ -46,15 +48,21 @@ var (
 
 	dbHandler cdb.Handler
 
+	// authenticator is the API keys authentication
+	authenticator *auth.Authenticator
+
 	// PluginRegister is the plugin register
 	PluginRegister *plg.JSPluginRegister
 
+	// reloadWatcher reloads the event plugins and the agents (hot reload)
+	reloadWatcher *reload.Watcher
+
 	// AgentsEngine is the agent engine
 	AgentsEngine *agt.JobEngine
 
 	clientLimiters = make(map[string]*rate.Limiter)
 	limitersMutex  sync.Mutex
-	jobQueue       = make(chan cdb.Event, 120000) // buffered queue
+	jobQueue       = make(chan eventJob, 120000) // buffered queue
 )
 
 func main() {
@@ -118,7 +126,10 @@ func main() {
 	}
 
 	// Start the event listener (on a separate go routine)
-	go cdb.ListenForEvents(&dbHandler, handleNotification)
+	go cdb.ListenForEventsWithAck(&dbHandler, handleNotification)
+
+	// Start the scheduled agents
+	go startAgentScheduler()
 
 	srv := &http.Server{
 		Addr: config.Events.Host + ":" + fmt.Sprintf("%d", config.Events.Port),
@@ -212,6 +223,9 @@ func initAll(configFile *string, config *cfg.Config, lmt **rate.Limiter) error {
 	lmtBL = bl
 	*lmt = rate.NewLimiter(rate.Limit(rl), bl)
 
+	// Stop the hot reload (the plugins and the agents are going to be replaced)
+	reloadWatcher.Stop()
+
 	// Reload Plugins
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Reloading plugins...")
 	PluginRegister = plg.NewJSPluginRegister().LoadPluginsFromConfig(config, "event_plugin")
@@ -246,6 +260,22 @@ func initAll(configFile *string, config *cfg.Config, lmt **rate.Limiter) error {
 		cmn.DebugMsg(cmn.DbgLvlInfo, "Database connection established")
 	}
 
+	// Initialize the API keys authenticator (used by the upload end-points)
+	if authenticator == nil {
+		authenticator = auth.NewAuthenticator(config.Events.Auth, config.Events.RateLimit, &dbHandler)
+	} else {
+		authenticator.Configure(config.Events.Auth, config.Events.RateLimit, &dbHandler)
+	}
+
+	// Start the hot reload of the event plugins and the agents
+	reloadWatcher = reload.NewWatcher(&dbHandler).
+		WatchPlugins(PluginRegister, config.Plugins.Plugins, "event_plugin").
+		WatchAgents(agt.AgentsRegistry, config.Agents)
+	if reloadWatcher.IsWatching() {
+		cmn.DebugMsg(cmn.DbgLvlInfo, "Hot reload of plugins and agents enabled")
+	}
+	reloadWatcher.Start()
+
 	return nil
 }
 
@@ -273,11 +303,15 @@ func initAPIv1() {
 	http.Handle(baseAPI+"remove_before", removeEventsBeforeWithMiddlewares)
 	http.Handle(baseAPI+"list", listEventsWithMiddlewares)
 
+	// Manual agents
+	runAgentWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(runAgentHandler))))
+	http.Handle(baseAPI+"agent/run", runAgentWithMiddlewares)
+
 	// Handle uploads
 
-	uploadRulesetHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(uploadRulesetHandler)))
-	uploadPluginHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(uploadPluginHandler)))
-	uploadAgentHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(uploadAgentHandler)))
+	uploadRulesetHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(uploadRulesetHandler))))
+	uploadPluginHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(uploadPluginHandler))))
+	uploadAgentHandlerWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(uploadAgentHandler))))
 
 	baseAPI = "/v1/upload/"
 
@@ -285,6 +319,17 @@ func initAPIv1() {
 	http.Handle(baseAPI+"plugin", uploadPluginHandlerWithMiddlewares)
 	http.Handle(baseAPI+"agent", uploadAgentHandlerWithMiddlewares)
 
+	// Agents run history
+
+	listAgentRunsWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(listAgentRunsHandler))))
+	getAgentRunWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(getAgentRunHandler))))
+	getAgentRunStepsWithMiddlewares := SecurityHeadersMiddleware(AuthMiddleware(auth.ScopeConsole, RateLimitMiddleware(http.HandlerFunc(getAgentRunStepsHandler))))
+
+	baseAPI = "/v1/agent/"
+
+	http.Handle(baseAPI+"runs", listAgentRunsWithMiddlewares)
+	http.Handle(baseAPI+"run", getAgentRunWithMiddlewares)
+	http.Handle(baseAPI+"run/steps", getAgentRunStepsWithMiddlewares)
 }
 
 // RateLimitMiddleware is a middleware for rate limiting
@@ -299,11 +344,25 @@ func getLimiter(ip string) *rate.Limiter {
 	return limiter
 }
 
-// RateLimitMiddleware is a middleware for rate limiting
+// AuthMiddleware is a middleware that requires an API key granting (at least)
+// the given scope (when authentication is enabled). Requests are rate limited
+// per client IP before the key is checked.
+func AuthMiddleware(scope string, next http.Handler) http.Handler {
+	return authenticator.ClientMiddleware(authenticator.Middleware(scope, next))
+}
+
+// RateLimitMiddleware is a middleware for rate limiting, requests carrying
+// an API key are limited per key, all the others per client IP
 func RateLimitMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-		if !getLimiter(ip).Allow() {
+		var lmt *rate.Limiter
+		if key, ok := auth.KeyFromContext(r.Context()); ok {
+			lmt = authenticator.Limiter(key)
+		} else {
+			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+			lmt = getLimiter(ip)
+		}
+		if !lmt.Allow() {
 			http.Error(w, errTooManyRequests, http.StatusTooManyRequests)
 			return
 		}
@@ -364,7 +423,7 @@ func createEventHandler(w http.ResponseWriter, r *http.Request) {
 	event.Action = actionInsert
 
 	// Async process
-	jobQueue <- event
+	jobQueue <- eventJob{event: event}
 
 	response := map[string]string{"message": "Event created successfully", "event_id": eventID}
 	handleErrorAndRespond(w, nil, response, "Error creating event: ", http.StatusInternalServerError, http.StatusCreated)
@@ -532,23 +591,35 @@ func handleNotification(payload string) {
 }
 */
 
-func handleNotification(payload string) {
+// eventJob is an event waiting in the jobQueue, ack (if set) acknowledges
+// the notification of the event once it has been processed
+type eventJob struct {
+	event cdb.Event
+	ack   func()
+}
+
+func handleNotification(payload string, ack func()) {
 	var event cdb.Event
 	if err := json.Unmarshal([]byte(payload), &event); err == nil {
-		jobQueue <- event
+		jobQueue <- eventJob{event: event, ack: ack}
 	} else {
 		cmn.DebugMsg(cmn.DbgLvlError, "Failed to decode notification: %v", err)
+		// The notification will never be decoded, don't deliver it again
+		ack()
 	}
 }
 
 // eventWorker is a goroutine that processes events from the jobQueue
 func eventWorker() {
-	for event := range jobQueue {
+	for job := range jobQueue {
 		// Check if event.Action is empty
-		if event.Action != "" {
-			processInternalEvent(event)
+		if job.event.Action != "" {
+			processInternalEvent(job.event)
 		} else {
-			processEvent(event)
+			processEvent(job.event)
+		}
+		if job.ack != nil {
+			job.ack()
 		}
 	}
 }
@@ -855,9 +926,11 @@ func uploadPluginHandler(w http.ResponseWriter, r *http.Request) {
 	plgSrc := string(data)
 	// convert plgSrc to a plugin
 	plgObj := plg.NewJSPlugin(plgSrc)
+	// Apply the limits of the plugins location the file was saved into
+	plgObj.SetUploadLimits(&config, filename)
 
 	// Optionally validate plugin syntax or structure
-	PluginRegister.Register(header.Filename, *plgObj)
+	PluginRegister.RegisterUploaded(header.Filename, *plgObj)
 
 	// Generate and broadcast event with file content in details
 	event := cdb.Event{
@@ -919,7 +992,11 @@ func uploadAgentHandler(w http.ResponseWriter, r *http.Request) {
 		handleErrorAndRespond(w, err, nil, "Failed to parse agent configuration", http.StatusInternalServerError, http.StatusOK)
 		return
 	}
-	agt.AgentsRegistry.RegisterAgent(agentConfig) // Register the agent
+	if err := agentConfig.Validate(); err != nil {
+		handleErrorAndRespond(w, err, nil, "Failed to parse agent configuration", http.StatusInternalServerError, http.StatusOK)
+		return
+	}
+	agt.AgentsRegistry.RegisterUploadedAgent(agentConfig) // Register the agent (kept across reloads)
 
 	// Generate and broadcast event with file content in details
 	event := cdb.Event{
@@ -939,10 +1016,66 @@ func uploadAgentHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func validateAgent(data []byte) error {
-	var agent map[string]interface{}
-	if err := yaml.Unmarshal(data, &agent); err != nil {
+	// Validate against the agents schema
+	if err := agt.ValidateAgentDefinition(data, "yaml"); err != nil {
 		return err
 	}
-	// Validate against schema if necessary
-	return nil
+	// Check the steps policies (retries, timeouts and fallbacks)
+	agent := agt.NewJobConfig()
+	if err := yaml.Unmarshal(data, agent); err != nil {
+		return err
+	}
+	return agent.Validate()
+}
+
+// Handler to list the agents runs (filtered by job, event_id and status)
+func listAgentRunsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := cdb.AgentRunFilter{
+		JobName: query.Get("job"),
+		EventID: query.Get("event_id"),
+		Status:  query.Get("status"),
+	}
+	for name, value := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if query.Get(name) == "" {
+			continue
+		}
+		n, err := strconv.Atoi(query.Get(name))
+		if err != nil || n < 0 {
+			handleErrorAndRespond(w, fmt.Errorf("invalid %s parameter", name), nil, "Invalid parameter: ", http.StatusBadRequest, http.StatusOK)
+			return
+		}
+		*value = n
+	}
+
+	runs, err := cdb.ListAgentRuns(&dbHandler, filter)
+	handleErrorAndRespond(w, err, runs, "Failed to retrieve agent runs: ", http.StatusInternalServerError, http.StatusOK)
+}
+
+// Handler to get an agent run (and its steps)
+func getAgentRunHandler(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.ParseUint(r.URL.Query().Get("run_id"), 10, 64)
+	if err != nil {
+		handleErrorAndRespond(w, errors.New("missing or invalid run_id parameter"), nil, "Invalid run_id: ", http.StatusBadRequest, http.StatusOK)
+		return
+	}
+
+	run, err := cdb.GetAgentRun(&dbHandler, runID)
+	if err == nil && run == nil {
+		handleErrorAndRespond(w, fmt.Errorf("agent run %d not found", runID), nil, "Agent run not found: ", http.StatusNotFound, http.StatusOK)
+		return
+	}
+	handleErrorAndRespond(w, err, run, "Failed to retrieve agent run: ", http.StatusInternalServerError, http.StatusOK)
+}
+
+// Handler to get the steps (inputs and outputs) of an agent run
+func getAgentRunStepsHandler(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.ParseUint(r.URL.Query().Get("run_id"), 10, 64)
+	if err != nil {
+		handleErrorAndRespond(w, errors.New("missing or invalid run_id parameter"), nil, "Invalid run_id: ", http.StatusBadRequest, http.StatusOK)
+		return
+	}
+
+	steps, err := cdb.GetAgentRunSteps(&dbHandler, runID)
+	handleErrorAndRespond(w, err, steps, "Failed to retrieve agent run steps: ", http.StatusInternalServerError, http.StatusOK)
 }
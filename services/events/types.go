@@ -12,3 +12,9 @@ type PluginResponse struct {
 	Message     string      `json:"message"`
 	APIResponse interface{} `json:"apiResponse,omitempty"` // Use `interface{}` to allow flexibility in the API response structure
 }
+
+// AgentRunRequest is the body of a request to run a manual agent
+type AgentRunRequest struct {
+	Agent string                 `json:"agent"`
+	Input map[string]interface{} `json:"input,omitempty"`
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package perf contains the performance tests (benchmarks) of the CROWler
+// libraries.
+package perf
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	detect "github.com/pzaino/thecrowler/pkg/detection"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+)
+
+// detectionRules generates n detection rules, using all the signature
+// families, the first of which match the benchmark page
+func detectionRules(n int) []rules.DetectionRule {
+	detectionRules := make([]rules.DetectionRule, 0, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("tech%d", i)
+		detectionRules = append(detectionRules, rules.DetectionRule{
+			RuleName:   name,
+			ObjectName: name,
+			HTTPHeaderFields: []rules.HTTPHeaderField{
+				{Key: "Server", Value: []string{fmt.Sprintf("^%s/[0-9.]+", name)}, Confidence: 10},
+				{Key: "X-Powered-By", Value: []string{name}, Confidence: 5},
+			},
+			MetaTags: []rules.MetaTag{
+				{Name: "generator", Content: fmt.Sprintf("%s ?([0-9.]+)?", name), Confidence: 10},
+			},
+			PageContentPatterns: []rules.PageContentSignature{
+				{Key: "*", Signature: []string{fmt.Sprintf("/%s-assets/", name), fmt.Sprintf("%s\\.(min\\.)?js", name)}, Confidence: 4},
+				{Key: "script", Attribute: "src", Signature: []string{fmt.Sprintf("%s[.-]([0-9.]+)", name)}, Confidence: 3},
+			},
+			URLMicroSignatures: []rules.URLMicroSignature{
+				{Signature: fmt.Sprintf("/%s/", name), Confidence: 10},
+			},
+		})
+	}
+	return detectionRules
+}
+
+// detectionPage returns a page of about 100KB, which matches a few of the
+// generated detection rules
+func detectionPage() string {
+	var page strings.Builder
+	page.WriteString(`<html><head><meta name="generator" content="tech1 2.4.1"><title>Benchmark</title>`)
+	page.WriteString(`<script src="/static/tech2-1.9.3.js"></script><script src="/tech3-assets/main.js"></script></head><body>`)
+	for page.Len() < 100*1024 {
+		page.WriteString(`<div class="article"><h2>Lorem ipsum</h2><p>Lorem ipsum dolor sit amet, consectetur adipiscing elit, `)
+		page.WriteString(`sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.</p><a href="/blog/post">read more</a></div>`)
+	}
+	page.WriteString(`</body></html>`)
+	return page.String()
+}
+
+func benchmarkDetectTechnologies(b *testing.B, n int, noIndex bool) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	re := rules.NewRuleEngine("", []rules.Ruleset{
+		{
+			Name: "benchmark",
+			RuleGroups: []rules.RuleGroup{
+				{GroupName: "detection", IsEnabled: true, DetectionRules: detectionRules(n)},
+			},
+		},
+	})
+	header := http.Header{}
+	header.Set("Server", "tech0/1.2.3")
+	header.Set("X-Powered-By", "PHP/8.2")
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	page := detectionPage()
+
+	dtCtx := &detect.DContext{
+		CtxID:        "benchmark",
+		TargetURL:    "https://example.com/tech4/index.html",
+		Header:       &header,
+		ResponseBody: &page,
+		RE:           re,
+		NoIndex:      noIndex,
+	}
+
+	// Build the index (once per RuleEngine load) before measuring
+	re.GetDetectionIndex()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		detected := detect.DetectTechnologies(dtCtx)
+		if detected == nil || len(*detected) == 0 {
+			b.Fatalf("no technologies detected")
+		}
+	}
+}
+
+// BenchmarkDetectTechnologies measures the per page cost of the detection,
+// matching the rules one by one (linear) and with the precompiled index
+// (indexed).
+//
+//	go test -bench DetectTechnologies -benchmem ./tests/perf
+func BenchmarkDetectTechnologies(b *testing.B) {
+	for _, n := range []int{100, 1000, 3000} {
+		b.Run(fmt.Sprintf("rules=%d/linear", n), func(b *testing.B) {
+			benchmarkDetectTechnologies(b, n, true)
+		})
+		b.Run(fmt.Sprintf("rules=%d/indexed", n), func(b *testing.B) {
+			benchmarkDetectTechnologies(b, n, false)
+		})
+	}
+}
+
+// BenchmarkNewDetectionIndex measures the cost of building the index (paid
+// once per RuleEngine load and on every ruleset update)
+func BenchmarkNewDetectionIndex(b *testing.B) {
+	for _, n := range []int{100, 1000, 3000} {
+		detectionRules := detectionRules(n)
+		b.Run(fmt.Sprintf("rules=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rules.NewDetectionIndex(detectionRules)
+			}
+		})
+	}
+}